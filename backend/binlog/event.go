@@ -0,0 +1,327 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+)
+
+const (
+	eventHeaderSize = 19
+	checksumSize    = 4
+	tableIDSize     = 6
+)
+
+// binlog event types, only events used to find changed tables are listed
+const (
+	queryEvent        = 2
+	rotateEvent       = 4
+	xidEvent          = 16
+	tableMapEvent     = 19
+	writeRowsEventV1  = 23
+	updateRowsEventV1 = 24
+	deleteRowsEventV1 = 25
+	heartbeatEvent    = 27
+	writeRowsEventV2  = 30
+	updateRowsEventV2 = 31
+	deleteRowsEventV2 = 32
+)
+
+// ChangeType is type of change on table
+type ChangeType int
+
+// change types
+const (
+	ChangeInsert ChangeType = iota + 1
+	ChangeUpdate
+	ChangeDelete
+	ChangeDDL
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeInsert:
+		return "insert"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	case ChangeDDL:
+		return "ddl"
+	}
+	return "unknown"
+}
+
+// Change means rows or schema of a physical table are changed by a committed transaction
+type Change struct {
+	DB    string
+	Table string // empty if table is unknown, all tables of DB should be treated as changed
+	Type  ChangeType
+	Time  time.Time // commit time on master
+}
+
+type eventHeader struct {
+	timestamp uint32
+	eventType byte
+	logPos    uint32 // position of next event, 0 for artificial events
+}
+
+func parseEventHeader(data []byte) (*eventHeader, error) {
+	if len(data) < eventHeaderSize {
+		return nil, fmt.Errorf("invalid binlog event, length: %d", len(data))
+	}
+	return &eventHeader{
+		timestamp: binary.LittleEndian.Uint32(data),
+		eventType: data[4],
+		logPos:    binary.LittleEndian.Uint32(data[13:]),
+	}, nil
+}
+
+type tableInfo struct {
+	db    string
+	table string
+}
+
+// eventParser collects changed tables of transactions from binlog events, it's not safe for concurrent use
+type eventParser struct {
+	checksum bool // events end with crc32 checksum
+
+	file string
+	pos  uint32 // position after the last committed transaction, replication can be resumed from here
+
+	inTx    bool
+	tables  map[uint64]tableInfo // key: table id of table map event in current transaction
+	pending []*Change
+}
+
+func newEventParser(file string, pos uint32, checksum bool) *eventParser {
+	return &eventParser{
+		checksum: checksum,
+		file:     file,
+		pos:      pos,
+		tables:   make(map[uint64]tableInfo),
+	}
+}
+
+// parse handle an event, return changes of transaction committed by the event
+func (p *eventParser) parse(data []byte) ([]*Change, error) {
+	h, err := parseEventHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	body := data[eventHeaderSize:]
+	if p.checksum {
+		if len(body) < checksumSize {
+			return nil, fmt.Errorf("invalid binlog event, length: %d", len(data))
+		}
+		body = body[:len(body)-checksumSize]
+	}
+
+	var changes []*Change
+	switch h.eventType {
+	case heartbeatEvent:
+		return nil, nil
+	case rotateEvent:
+		if len(body) < 8 {
+			return nil, fmt.Errorf("invalid rotate event")
+		}
+		p.file = string(body[8:])
+		p.pos = uint32(binary.LittleEndian.Uint64(body))
+		return nil, nil
+	case queryEvent:
+		changes, err = p.parseQuery(h, body)
+	case tableMapEvent:
+		err = p.parseTableMap(body)
+	case writeRowsEventV1, writeRowsEventV2:
+		err = p.parseRows(h, body, ChangeInsert)
+	case updateRowsEventV1, updateRowsEventV2:
+		err = p.parseRows(h, body, ChangeUpdate)
+	case deleteRowsEventV1, deleteRowsEventV2:
+		err = p.parseRows(h, body, ChangeDelete)
+	case xidEvent:
+		changes = p.commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !p.inTx && h.logPos > 0 {
+		p.pos = h.logPos
+	}
+	return changes, nil
+}
+
+func (p *eventParser) parseQuery(h *eventHeader, body []byte) ([]*Change, error) {
+	// post header: thread id, execute time, length of db, error code and length of status vars
+	if len(body) < 13 {
+		return nil, fmt.Errorf("invalid query event")
+	}
+	dbLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:]))
+	pos := 13 + statusLen
+	if len(body) < pos+dbLen+1 {
+		return nil, fmt.Errorf("invalid query event")
+	}
+	db := string(body[pos : pos+dbLen])
+	query := string(body[pos+dbLen+1:])
+
+	var changeType ChangeType
+	switch parser.Preview(query) {
+	case parser.StmtBegin:
+		p.begin()
+		return nil, nil
+	case parser.StmtCommit:
+		return p.commit(), nil
+	case parser.StmtRollback:
+		p.rollback()
+		return nil, nil
+	case parser.StmtInsert, parser.StmtReplace:
+		changeType = ChangeInsert
+	case parser.StmtUpdate:
+		changeType = ChangeUpdate
+	case parser.StmtDelete:
+		changeType = ChangeDelete
+	case parser.StmtDDL:
+		changeType = ChangeDDL
+	default:
+		return nil, nil
+	}
+
+	t := time.Unix(int64(h.timestamp), 0)
+	tables := queryTables(query, db)
+	if len(tables) == 0 {
+		tables = []tableInfo{{db: db}}
+	}
+	for _, table := range tables {
+		p.addChange(&Change{DB: table.db, Table: table.table, Type: changeType, Time: t})
+	}
+	// ddl commits implicitly, statement out of transaction is committed by itself
+	if changeType == ChangeDDL || !p.inTx {
+		return p.commit(), nil
+	}
+	return nil, nil
+}
+
+func (p *eventParser) parseTableMap(body []byte) error {
+	// post header: table id and flags, body: db and table, each of them is length, name and 0x00
+	pos := tableIDSize + 2
+	if len(body) < pos+1 {
+		return fmt.Errorf("invalid table map event")
+	}
+	tableID := readTableID(body)
+	dbLen := int(body[pos])
+	pos++
+	if len(body) < pos+dbLen+2 {
+		return fmt.Errorf("invalid table map event")
+	}
+	db := string(body[pos : pos+dbLen])
+	pos += dbLen + 1
+	tableLen := int(body[pos])
+	pos++
+	if len(body) < pos+tableLen {
+		return fmt.Errorf("invalid table map event")
+	}
+	p.tables[tableID] = tableInfo{db: db, table: string(body[pos : pos+tableLen])}
+	return nil
+}
+
+func (p *eventParser) parseRows(h *eventHeader, body []byte, changeType ChangeType) error {
+	if len(body) < tableIDSize {
+		return fmt.Errorf("invalid rows event")
+	}
+	tableID := readTableID(body)
+	table, ok := p.tables[tableID]
+	if !ok {
+		return fmt.Errorf("table map event of table id %d not found", tableID)
+	}
+	p.addChange(&Change{DB: table.db, Table: table.table, Type: changeType, Time: time.Unix(int64(h.timestamp), 0)})
+	return nil
+}
+
+func (p *eventParser) begin() {
+	p.inTx = true
+	p.pending = nil
+}
+
+// addChange add change to current transaction, changes of the same table and type are merged
+func (p *eventParser) addChange(c *Change) {
+	for _, pc := range p.pending {
+		if pc.DB == c.DB && pc.Table == c.Table && pc.Type == c.Type {
+			pc.Time = c.Time
+			return
+		}
+	}
+	p.pending = append(p.pending, c)
+}
+
+func (p *eventParser) commit() []*Change {
+	changes := p.pending
+	p.inTx = false
+	p.pending = nil
+	p.tables = make(map[uint64]tableInfo)
+	return changes
+}
+
+func (p *eventParser) rollback() {
+	p.inTx = false
+	p.pending = nil
+	p.tables = make(map[uint64]tableInfo)
+}
+
+func readTableID(body []byte) uint64 {
+	var b [8]byte
+	copy(b[:], body[:tableIDSize])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// tableCollector collect table names in statement
+type tableCollector struct {
+	db     string
+	tables []tableInfo
+}
+
+// Enter for node visit
+func (c *tableCollector) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if t, ok := n.(*ast.TableName); ok {
+		db := c.db
+		if t.Schema.O != "" {
+			db = t.Schema.O
+		}
+		c.tables = append(c.tables, tableInfo{db: db, table: t.Name.O})
+	}
+	return n, false
+}
+
+// Leave for node visit
+func (c *tableCollector) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+// queryTables return tables of query in statement based binlog, nil if query can't be parsed
+func queryTables(query, db string) []tableInfo {
+	stmts, _, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return nil
+	}
+	c := &tableCollector{db: db}
+	for _, stmt := range stmts {
+		stmt.Accept(c)
+	}
+	return c.tables
+}
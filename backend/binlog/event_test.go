@@ -0,0 +1,174 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimestamp = 1700000000
+
+// buildEvent build event with header, a fake checksum is appended if checksum is true
+func buildEvent(eventType byte, logPos uint32, body []byte, checksum bool) []byte {
+	data := make([]byte, eventHeaderSize, eventHeaderSize+len(body)+checksumSize)
+	binary.LittleEndian.PutUint32(data, testTimestamp)
+	data[4] = eventType
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	data = append(data, body...)
+	if checksum {
+		data = append(data, 0xde, 0xad, 0xbe, 0xef)
+	}
+	binary.LittleEndian.PutUint32(data[9:], uint32(len(data)))
+	return data
+}
+
+func buildQueryEvent(logPos uint32, db, query string, checksum bool) []byte {
+	body := make([]byte, 13)
+	body[8] = byte(len(db))
+	// status vars
+	binary.LittleEndian.PutUint16(body[11:], 2)
+	body = append(body, 0, 0)
+	body = append(body, db...)
+	body = append(body, 0)
+	body = append(body, query...)
+	return buildEvent(queryEvent, logPos, body, checksum)
+}
+
+func buildTableMapEvent(logPos uint32, tableID uint64, db, table string, checksum bool) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, tableID)
+	body[6], body[7] = 1, 0
+	body = append(body, byte(len(db)))
+	body = append(body, db...)
+	body = append(body, 0, byte(len(table)))
+	body = append(body, table...)
+	// column count, types and metadata are not used
+	body = append(body, 0, 1, 3, 0, 0)
+	return buildEvent(tableMapEvent, logPos, body, checksum)
+}
+
+func buildRowsEvent(eventType byte, logPos uint32, tableID uint64, checksum bool) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, tableID)
+	body[6], body[7] = 1, 0
+	// rows are not used
+	body = append(body, 2, 0, 1, 0xff, 0, 1, 0, 0, 0)
+	return buildEvent(eventType, logPos, body, checksum)
+}
+
+func buildRotateEvent(file string, pos uint64, checksum bool) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, pos)
+	body = append(body, file...)
+	return buildEvent(rotateEvent, 0, body, checksum)
+}
+
+func TestEventParserRowsEvents(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		p := newEventParser("mysql-bin.000001", 4, checksum)
+
+		changes, err := p.parse(buildRotateEvent("mysql-bin.000002", 4, checksum))
+		assert.Nil(t, err)
+		assert.Nil(t, changes)
+		assert.Equal(t, "mysql-bin.000002", p.file)
+		assert.Equal(t, uint32(4), p.pos)
+
+		events := [][]byte{
+			buildQueryEvent(200, "db_0", "BEGIN", checksum),
+			buildTableMapEvent(260, 108, "db_0", "tbl_0000", checksum),
+			buildRowsEvent(writeRowsEventV2, 300, 108, checksum),
+			buildTableMapEvent(360, 109, "db_0", "tbl_0001", checksum),
+			buildRowsEvent(updateRowsEventV2, 400, 109, checksum),
+			buildRowsEvent(writeRowsEventV2, 440, 108, checksum),
+		}
+		for _, e := range events {
+			changes, err = p.parse(e)
+			assert.Nil(t, err)
+			assert.Nil(t, changes)
+		}
+		// position is not moved in transaction
+		assert.Equal(t, uint32(4), p.pos)
+
+		changes, err = p.parse(buildEvent(xidEvent, 480, make([]byte, 8), checksum))
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(480), p.pos)
+		if assert.Equal(t, 2, len(changes)) {
+			assert.Equal(t, Change{DB: "db_0", Table: "tbl_0000", Type: ChangeInsert, Time: changes[0].Time}, *changes[0])
+			assert.Equal(t, Change{DB: "db_0", Table: "tbl_0001", Type: ChangeUpdate, Time: changes[1].Time}, *changes[1])
+			assert.Equal(t, int64(testTimestamp), changes[0].Time.Unix())
+		}
+
+		// table map of last transaction is not kept
+		_, err = p.parse(buildRowsEvent(deleteRowsEventV1, 520, 108, checksum))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestEventParserQueryEvents(t *testing.T) {
+	p := newEventParser("mysql-bin.000001", 4, false)
+
+	// ddl is committed by itself
+	changes, err := p.parse(buildQueryEvent(100, "db_0", "alter table tbl_0000 add column c int", false))
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, "db_0", changes[0].DB)
+		assert.Equal(t, "tbl_0000", changes[0].Table)
+		assert.Equal(t, ChangeDDL, changes[0].Type)
+	}
+	assert.Equal(t, uint32(100), p.pos)
+
+	// statement based dml is reported at commit
+	for _, e := range [][]byte{
+		buildQueryEvent(200, "db_0", "BEGIN", false),
+		buildQueryEvent(300, "db_0", "update db_1.tbl_0001 set a = 1 where id = 1", false),
+		buildQueryEvent(400, "db_0", "delete from tbl_0000 where id = 1", false),
+	} {
+		changes, err = p.parse(e)
+		assert.Nil(t, err)
+		assert.Nil(t, changes)
+	}
+	changes, err = p.parse(buildQueryEvent(500, "db_0", "COMMIT", false))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(changes)) {
+		assert.Equal(t, Change{DB: "db_1", Table: "tbl_0001", Type: ChangeUpdate, Time: changes[0].Time}, *changes[0])
+		assert.Equal(t, Change{DB: "db_0", Table: "tbl_0000", Type: ChangeDelete, Time: changes[1].Time}, *changes[1])
+	}
+
+	// changes of rolled back transaction are discarded
+	for _, e := range [][]byte{
+		buildQueryEvent(600, "db_0", "BEGIN", false),
+		buildQueryEvent(700, "db_0", "insert into tbl_0000 values (1)", false),
+		buildQueryEvent(800, "db_0", "ROLLBACK", false),
+	} {
+		changes, err = p.parse(e)
+		assert.Nil(t, err)
+		assert.Nil(t, changes)
+	}
+	assert.Equal(t, uint32(800), p.pos)
+
+	// table of statement can't be parsed, the whole db is reported
+	changes, err = p.parse(buildQueryEvent(900, "db_0", "create table tbl_0002 like", false))
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, "db_0", changes[0].DB)
+		assert.Equal(t, "", changes[0].Table)
+	}
+
+	_, err = p.parse([]byte{1, 2, 3})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binlog tails binlog of backend mysql as a replica and reports tables changed by
+// committed transactions, proxy side state derived from backend data can be refreshed by the changes.
+package binlog
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+const (
+	heartbeatPeriod = time.Second
+	readTimeout     = 10 * heartbeatPeriod // connection is broken if no event or heartbeat is received
+	retryInterval   = 3 * time.Second
+
+	// random server id is in [minRandomServerID, 2*minRandomServerID), which is rarely used by mysql instances
+	minRandomServerID = 1 << 30
+)
+
+// Handler handle changes of a committed transaction, it's called in order by the tailing goroutine
+type Handler func(changes []*Change)
+
+// Status is replication status of tailer
+type Status struct {
+	Addr           string `json:"addr"`
+	ServerID       uint32 `json:"server_id"`
+	File           string `json:"file"`
+	Pos            uint32 `json:"pos"`
+	Running        bool   `json:"running"`
+	Events         uint64 `json:"events"`
+	Changes        uint64 `json:"changes"`
+	LastChangeTime string `json:"last_change_time"` // commit time of the last change on master
+	LastError      string `json:"last_error"`
+}
+
+// Tailer reads binlog of a mysql master from the current position, and reconnects from
+// the last committed position if replication breaks
+type Tailer struct {
+	addr     string
+	user     string
+	password string
+	serverID uint32
+	handler  Handler
+
+	mu     sync.Mutex
+	status Status
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewTailer create tailer of mysql at addr, the user needs REPLICATION SLAVE and REPLICATION CLIENT privileges.
+// serverID should be unique among replicas of the master, a random one is used if it's 0.
+func NewTailer(addr, user, password string, serverID uint32, handler Handler) *Tailer {
+	if serverID == 0 {
+		serverID = uint32(minRandomServerID + rand.Int31n(minRandomServerID))
+	}
+	return &Tailer{
+		addr:     addr,
+		user:     user,
+		password: password,
+		serverID: serverID,
+		handler:  handler,
+		status:   Status{Addr: addr, ServerID: serverID},
+		closed:   make(chan struct{}),
+	}
+}
+
+// Start start tailing in background
+func (t *Tailer) Start() {
+	t.wg.Add(1)
+	go t.run()
+}
+
+// Close stop tailing and wait for the tailing goroutine
+func (t *Tailer) Close() {
+	close(t.closed)
+	t.wg.Wait()
+}
+
+// Status return replication status of tailer
+func (t *Tailer) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+func (t *Tailer) run() {
+	defer t.wg.Done()
+	for {
+		err := t.tail()
+		t.mu.Lock()
+		t.status.Running = false
+		if err != nil {
+			t.status.LastError = err.Error()
+			log.Warn("tail binlog of %s failed, file: %s, pos: %d, err: %v", t.addr, t.status.File, t.status.Pos, err)
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-t.closed:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// tail replicate from the last committed position until error occurs or tailer is closed
+func (t *Tailer) tail() error {
+	conn, err := backend.NewDirectConnection(t.addr, t.user, t.password, "", mysql.DefaultCharset, mysql.DefaultCollationID, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	t.mu.Lock()
+	file, pos := t.status.File, t.status.Pos
+	t.mu.Unlock()
+	if file == "" {
+		// changes before tailer starts are not reported
+		if file, pos, err = masterStatus(conn); err != nil {
+			return err
+		}
+	}
+	checksum, err := prepareReplication(conn)
+	if err != nil {
+		return err
+	}
+	if err = conn.StartBinlogDump(t.serverID, file, pos); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.status.File, t.status.Pos = file, pos
+	t.status.Running = true
+	t.status.LastError = ""
+	t.mu.Unlock()
+	log.Notice("start tailing binlog of %s, server id: %d, file: %s, pos: %d", t.addr, t.serverID, file, pos)
+
+	p := newEventParser(file, pos, checksum)
+	for {
+		select {
+		case <-t.closed:
+			return nil
+		default:
+		}
+		data, err := conn.ReadBinlogEvent(readTimeout)
+		if err != nil {
+			return err
+		}
+		changes, err := p.parse(data)
+		if err != nil {
+			return err
+		}
+		t.update(p.file, p.pos, changes)
+		if len(changes) > 0 {
+			t.handler(changes)
+		}
+	}
+}
+
+func (t *Tailer) update(file string, pos uint32, changes []*Change) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.File, t.status.Pos = file, pos
+	t.status.Events++
+	t.status.Changes += uint64(len(changes))
+	if len(changes) > 0 {
+		t.status.LastChangeTime = changes[len(changes)-1].Time.Format("2006-01-02 15:04:05")
+	}
+}
+
+// masterStatus return current binlog file and position of master
+func masterStatus(conn *backend.DirectConnection) (string, uint32, error) {
+	r, err := conn.Execute("SHOW MASTER STATUS", 0)
+	if err != nil {
+		// renamed since mysql 8.4
+		if r, err = conn.Execute("SHOW BINARY LOG STATUS", 0); err != nil {
+			return "", 0, err
+		}
+	}
+	if r.Resultset == nil || r.RowNumber() == 0 {
+		return "", 0, fmt.Errorf("binlog of %s is not enabled", conn.GetAddr())
+	}
+	file, err := r.GetString(0, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	pos, err := r.GetUint(0, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return file, uint32(pos), nil
+}
+
+// prepareReplication announce checksum and heartbeat period to master, return true if events have checksum
+func prepareReplication(conn *backend.DirectConnection) (bool, error) {
+	checksum := false
+	r, err := conn.Execute("SELECT @@global.binlog_checksum", 0)
+	// binlog_checksum is not supported before mysql 5.6
+	if err == nil && r.Resultset != nil && r.RowNumber() > 0 {
+		value, _ := r.GetString(0, 0)
+		if value != "" && !strings.EqualFold(value, "NONE") {
+			if _, err = conn.Execute("SET @master_binlog_checksum = @@global.binlog_checksum", 0); err != nil {
+				return false, err
+			}
+			checksum = true
+		}
+	}
+	// master sends heartbeat when there is no event, so broken connection is found by read timeout
+	if _, err = conn.Execute(fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeatPeriod.Nanoseconds()), 0); err != nil {
+		return false, err
+	}
+	return checksum, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// StartBinlogDump register the connection as a replica with serverID, and request binlog events
+// from file and pos. Events are read by ReadBinlogEvent, the connection can't be used for other commands.
+func (dc *DirectConnection) StartBinlogDump(serverID uint32, file string, pos uint32) error {
+	if dc.conn == nil {
+		return fmt.Errorf("get mysql conn of DirectConnection error.dc addr:%s", dc.GetAddr())
+	}
+	if err := dc.writeComRegisterSlave(serverID); err != nil {
+		return err
+	}
+	data, err := dc.readPacket()
+	if err != nil {
+		return err
+	}
+	if data[0] == mysql.ErrHeader {
+		return dc.handleErrorPacket(data)
+	}
+
+	// COM_BINLOG_DUMP: pos, flags, server id and file name
+	dc.conn.SetSequence(0)
+	data = make([]byte, 1+4+2+4+len(file))
+	p := mysql.WriteByte(data, 0, mysql.ComBinlogDump)
+	p = mysql.WriteUint32(data, p, pos)
+	p = mysql.WriteUint16(data, p, 0)
+	p = mysql.WriteUint32(data, p, serverID)
+	copy(data[p:], file)
+	return dc.writePacket(data)
+}
+
+// writeComRegisterSlave send COM_REGISTER_SLAVE, the replica is shown in SHOW SLAVE HOSTS of master
+func (dc *DirectConnection) writeComRegisterSlave(serverID uint32) error {
+	hostname, _ := os.Hostname()
+	if len(hostname) > 255 {
+		hostname = hostname[:255]
+	}
+	dc.conn.SetSequence(0)
+	data := make([]byte, 1+4+1+len(hostname)+1+1+2+4+4)
+	p := mysql.WriteByte(data, 0, mysql.ComRegisterSlave)
+	p = mysql.WriteUint32(data, p, serverID)
+	p = mysql.WriteByte(data, p, byte(len(hostname)))
+	p = mysql.WriteBytes(data, p, []byte(hostname))
+	// user and password of replica are not reported
+	p = mysql.WriteByte(data, p, 0)
+	p = mysql.WriteByte(data, p, 0)
+	p = mysql.WriteUint16(data, p, 0)
+	p = mysql.WriteUint32(data, p, 0)
+	mysql.WriteUint32(data, p, 0)
+	return dc.writePacket(data)
+}
+
+// ReadBinlogEvent read next binlog event after StartBinlogDump, including the event header.
+// An error is returned if no event is received in timeout, 0 means no timeout. io.EOF is returned
+// when master stops sending events.
+func (dc *DirectConnection) ReadBinlogEvent(timeout time.Duration) ([]byte, error) {
+	if dc.conn == nil {
+		return nil, fmt.Errorf("get mysql conn of DirectConnection error.dc addr:%s", dc.GetAddr())
+	}
+	if timeout > 0 {
+		if err := dc.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		defer dc.conn.SetDeadline(time.Time{})
+	}
+	data, err := dc.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch data[0] {
+	case mysql.OKHeader:
+		return data[1:], nil
+	case mysql.ErrHeader:
+		return nil, dc.handleErrorPacket(data)
+	case mysql.EOFHeader:
+		if len(data) < 9 {
+			return nil, io.EOF
+		}
+	}
+	return nil, fmt.Errorf("unexpected packet type of binlog event: %d", data[0])
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build chaos
+// +build chaos
+
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// ChaosEnabled is true when gaea is built with tag chaos, fault injection is only for testing.
+const ChaosEnabled = true
+
+var chaosFaults = struct {
+	sync.RWMutex
+	faults []*Fault
+}{}
+
+// AddFault add a fault, queries to backend matching the fault will fail or be delayed
+func AddFault(f *Fault) error {
+	if err := f.verify(); err != nil {
+		return err
+	}
+	chaosFaults.Lock()
+	defer chaosFaults.Unlock()
+	chaosFaults.faults = append(chaosFaults.faults, f)
+	return nil
+}
+
+// ClearFaults remove all faults
+func ClearFaults() {
+	chaosFaults.Lock()
+	defer chaosFaults.Unlock()
+	chaosFaults.faults = nil
+}
+
+// ListFaults return a copy of all faults
+func ListFaults() []Fault {
+	chaosFaults.RLock()
+	defer chaosFaults.RUnlock()
+	faults := make([]Fault, 0, len(chaosFaults.faults))
+	for _, f := range chaosFaults.faults {
+		faults = append(faults, *f)
+	}
+	return faults
+}
+
+func (f *Fault) verify() error {
+	switch f.Action {
+	case FaultActionDrop:
+	case FaultActionDelay:
+		if f.DelayMs <= 0 {
+			return fmt.Errorf("delay_ms of delay fault must be positive")
+		}
+	case FaultActionError:
+		if f.ErrCode == 0 {
+			return fmt.Errorf("err_code of error fault must not be zero")
+		}
+	default:
+		return fmt.Errorf("invalid fault action: %s", f.Action)
+	}
+	if f.Times < 0 {
+		return fmt.Errorf("times of fault must not be negative")
+	}
+	return nil
+}
+
+// matchFault return the first fault matching the backend addr and sql, the fault is removed once its times is used up
+func matchFault(addr string, sql string) *Fault {
+	chaosFaults.Lock()
+	defer chaosFaults.Unlock()
+	if len(chaosFaults.faults) == 0 {
+		return nil
+	}
+	var fingerprint string
+	for i, f := range chaosFaults.faults {
+		if f.Addr != "" && f.Addr != addr {
+			continue
+		}
+		if f.Fingerprint != "" {
+			if fingerprint == "" {
+				fingerprint = mysql.GetFingerprint(sql)
+			}
+			if f.Fingerprint != fingerprint {
+				continue
+			}
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				chaosFaults.faults = append(chaosFaults.faults[:i], chaosFaults.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// injectFault apply the fault matching the query to the connection, a non-nil error means the query should fail
+func (dc *DirectConnection) injectFault(sql string) error {
+	f := matchFault(dc.addr, sql)
+	if f == nil {
+		return nil
+	}
+	switch f.Action {
+	case FaultActionDrop:
+		// close the socket, the connection is broken and won't be put back to the pool
+		if dc.conn != nil {
+			dc.conn.Close()
+		}
+		dc.pkgErr = mysql.ErrBadConn
+		return mysql.ErrBadConn
+	case FaultActionDelay:
+		time.Sleep(time.Duration(f.DelayMs) * time.Millisecond)
+		return nil
+	default:
+		return mysql.NewError(f.ErrCode, f.ErrMsg)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !chaos
+// +build !chaos
+
+package backend
+
+import "errors"
+
+// ChaosEnabled is true when gaea is built with tag chaos, fault injection is only for testing.
+const ChaosEnabled = false
+
+var errChaosDisabled = errors.New("fault injection is disabled, build gaea with tag chaos to enable it")
+
+// AddFault add a fault, queries to backend matching the fault will fail or be delayed
+func AddFault(f *Fault) error {
+	return errChaosDisabled
+}
+
+// ClearFaults remove all faults
+func ClearFaults() {}
+
+// ListFaults return a copy of all faults
+func ListFaults() []Fault {
+	return nil
+}
+
+func (dc *DirectConnection) injectFault(sql string) error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build chaos
+// +build chaos
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFaultVerify(t *testing.T) {
+	defer ClearFaults()
+	require.Error(t, AddFault(&Fault{Action: "unknown"}))
+	require.Error(t, AddFault(&Fault{Action: FaultActionDelay}))
+	require.Error(t, AddFault(&Fault{Action: FaultActionError}))
+	require.Error(t, AddFault(&Fault{Action: FaultActionDrop, Times: -1}))
+	require.NoError(t, AddFault(&Fault{Action: FaultActionDrop}))
+	require.Len(t, ListFaults(), 1)
+	ClearFaults()
+	require.Len(t, ListFaults(), 0)
+}
+
+func TestInjectFault(t *testing.T) {
+	defer ClearFaults()
+	dc := &DirectConnection{addr: "127.0.0.1:3306"}
+
+	require.NoError(t, AddFault(&Fault{
+		Addr:    "127.0.0.1:3307",
+		Action:  FaultActionError,
+		ErrCode: mysql.ErrLockDeadlock,
+		ErrMsg:  "deadlock",
+	}))
+	require.NoError(t, dc.injectFault("select 1"))
+
+	require.NoError(t, AddFault(&Fault{
+		Addr:        "127.0.0.1:3306",
+		Fingerprint: "select * from t where id = ?",
+		Action:      FaultActionError,
+		ErrCode:     mysql.ErrLockDeadlock,
+		ErrMsg:      "deadlock",
+		Times:       1,
+	}))
+	require.NoError(t, dc.injectFault("select * from t"))
+	err := dc.injectFault("select * from t where id = 1")
+	require.Error(t, err)
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok)
+	require.Equal(t, uint16(mysql.ErrLockDeadlock), sqlErr.SQLCode())
+	// times used up, the fault is removed
+	require.NoError(t, dc.injectFault("select * from t where id = 2"))
+	require.Len(t, ListFaults(), 1)
+
+	ClearFaults()
+	require.NoError(t, AddFault(&Fault{Action: FaultActionDelay, DelayMs: 50, Times: 1}))
+	start := time.Now()
+	require.NoError(t, dc.injectFault("select 1"))
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	require.NoError(t, AddFault(&Fault{Action: FaultActionDrop, Times: 1}))
+	require.Equal(t, mysql.ErrBadConn, dc.injectFault("select 1"))
+	require.Equal(t, mysql.ErrBadConn, dc.pkgErr)
+}
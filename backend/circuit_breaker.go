@@ -0,0 +1,267 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// latencyBucketCount is the number of latency histogram buckets, one more than latencyBounds for overflow
+const latencyBucketCount = 14
+
+// latencyBounds are upper bounds of latency histogram, p99 is estimated by them
+var latencyBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// breakerBucket is the statistics of one second in sliding window
+type breakerBucket struct {
+	second     int64
+	total      int
+	failures   int
+	maxLatency time.Duration
+	latencies  [latencyBucketCount]int // the last one counts latencies exceeding all bounds
+}
+
+// circuitBreaker opens when error rate or p99 latency of backend instance crosses thresholds over sliding window,
+// reads are diverted to other instances. After open time it half opens and lets probe requests through,
+// it closes if all probes pass, otherwise opens again.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	cfg      models.CircuitBreaker
+	buckets  []breakerBucket
+	state    circuitState
+	changeAt time.Time // time when state changed
+	probes   int       // probe requests let through in half open state
+	passed   int       // probe requests passed in half open state
+}
+
+func newCircuitBreaker(cfg *models.CircuitBreaker) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:     *cfg,
+		buckets: make([]breakerBucket, cfg.Window),
+	}
+}
+
+// IsBackendFailure check if error is caused by backend instance rather than sql itself.
+// Timeout and cancel of statement are caused by the statement or client, they are not failures.
+func IsBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrExecuteTimeout) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var sqlErr *mysql.SQLError
+	if !errors.As(err, &sqlErr) {
+		return true
+	}
+	return mysql.IsServerShutdownErr(err) || mysql.IsSQLErrorCode(err, mysql.ErrConCount)
+}
+
+// allow check if request can be sent to the backend instance
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	openTime := time.Duration(cb.cfg.GetOpenTime()) * time.Second
+	switch cb.state {
+	case circuitOpen:
+		if now.Sub(cb.changeAt) < openTime {
+			return false
+		}
+		cb.setState(circuitHalfOpen, now)
+	case circuitHalfOpen:
+		// results of some probes are lost, e.g. connection is not used, let new probes through
+		if now.Sub(cb.changeAt) >= openTime {
+			cb.probes = cb.passed
+			cb.changeAt = now
+		}
+	default:
+		return true
+	}
+
+	if cb.probes < cb.cfg.GetProbes() {
+		cb.probes++
+		return true
+	}
+	return false
+}
+
+// record add result of request to the backend instance
+func (cb *circuitBreaker) record(now time.Time, latency time.Duration, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		return
+	case circuitHalfOpen:
+		if failed || cb.isSlow(latency) {
+			cb.setState(circuitOpen, now)
+			return
+		}
+		cb.passed++
+		if cb.passed >= cb.cfg.GetProbes() {
+			cb.setState(circuitClosed, now)
+		}
+		return
+	}
+
+	b := cb.bucket(now)
+	b.total++
+	if failed {
+		b.failures++
+	}
+	if latency > b.maxLatency {
+		b.maxLatency = latency
+	}
+	b.latencies[latencyIndex(latency)]++
+
+	if cb.shouldOpen(now) {
+		cb.setState(circuitOpen, now)
+	}
+}
+
+func (cb *circuitBreaker) setState(state circuitState, now time.Time) {
+	cb.state = state
+	cb.changeAt = now
+	cb.probes, cb.passed = 0, 0
+	if state == circuitClosed {
+		cb.buckets = make([]breakerBucket, cb.cfg.Window)
+	}
+}
+
+func (cb *circuitBreaker) isOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == circuitOpen
+}
+
+func (cb *circuitBreaker) isSlow(latency time.Duration) bool {
+	return cb.cfg.P99Latency > 0 && latency > time.Duration(cb.cfg.P99Latency)*time.Millisecond
+}
+
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	second := now.Unix()
+	b := &cb.buckets[second%int64(len(cb.buckets))]
+	if b.second != second {
+		*b = breakerBucket{second: second}
+	}
+	return b
+}
+
+func (cb *circuitBreaker) shouldOpen(now time.Time) bool {
+	var total, failures int
+	var maxLatency time.Duration
+	var latencies [latencyBucketCount]int
+	oldest := now.Unix() - int64(len(cb.buckets))
+	for i := range cb.buckets {
+		b := &cb.buckets[i]
+		if b.second <= oldest {
+			continue
+		}
+		total += b.total
+		failures += b.failures
+		if b.maxLatency > maxLatency {
+			maxLatency = b.maxLatency
+		}
+		for j, n := range b.latencies {
+			latencies[j] += n
+		}
+	}
+
+	if total < cb.cfg.GetMinRequests() {
+		return false
+	}
+	if cb.cfg.ErrorRate > 0 && failures*100 >= cb.cfg.ErrorRate*total {
+		return true
+	}
+	return cb.isSlow(estimateP99(latencies[:], total, maxLatency))
+}
+
+func latencyIndex(latency time.Duration) int {
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// estimateP99 estimate p99 latency by linear interpolation in the histogram bucket
+func estimateP99(latencies []int, total int, maxLatency time.Duration) time.Duration {
+	rank := (total*99 + 99) / 100
+	count := 0
+	for i, n := range latencies {
+		if n == 0 || count+n < rank {
+			count += n
+			continue
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = latencyBounds[i-1]
+		}
+		upper := maxLatency
+		if i < len(latencyBounds) && latencyBounds[i] < upper {
+			upper = latencyBounds[i]
+		}
+		return lower + (upper-lower)*time.Duration(rank-count)/time.Duration(n)
+	}
+	return maxLatency
+}
+
+// RecordBackendResult record result of request to backend instance for circuit breaker
+func (s *Slice) RecordBackendResult(addr string, latency time.Duration, err error) {
+	v, ok := s.breakers.Load(addr)
+	if !ok {
+		return
+	}
+	v.(*circuitBreaker).record(time.Now(), latency, IsBackendFailure(err))
+}
+
+// IsCircuitOpen check if circuit breaker of backend instance is open
+func (s *Slice) IsCircuitOpen(addr string) bool {
+	v, ok := s.breakers.Load(addr)
+	if !ok {
+		return false
+	}
+	return v.(*circuitBreaker).isOpen()
+}
+
+func (s *Slice) allowByCircuitBreaker(addr string) bool {
+	v, ok := s.breakers.Load(addr)
+	if !ok {
+		return true
+	}
+	return v.(*circuitBreaker).allow(time.Now())
+}
@@ -57,9 +57,14 @@ type connectionPoolImpl struct {
 	capacity         int // capacity of pool
 	maxCapacity      int // max capacity of pool
 	idleTimeout      time.Duration
+	maxLifetime      time.Duration
 	clientCapability uint32
 	initConnect      string
 	lastChecked      int64
+
+	// all connections created by the pool, both idle and in use
+	connsMu sync.Mutex
+	conns   map[*pooledConnectImpl]struct{}
 }
 
 // NewConnectionPool create connection pool
@@ -78,6 +83,7 @@ func NewConnectionPool(addr, user, password, db string, capacity, maxCapacity in
 		clientCapability: clientCapability,
 		initConnect:      strings.Trim(strings.TrimSpace(initConnect), ";"),
 		lastChecked:      time.Now().Unix(),
+		conns:            make(map[*pooledConnectImpl]struct{}),
 	}
 }
 
@@ -118,7 +124,47 @@ func (cp *connectionPoolImpl) connect() (util.Resource, error) {
 			}
 		}
 	}
-	return &pooledConnectImpl{directConnection: c, pool: cp}, nil
+	pc := newPooledConnect(c, cp)
+	cp.track(pc)
+	return pc, nil
+}
+
+func (cp *connectionPoolImpl) track(pc *pooledConnectImpl) {
+	cp.connsMu.Lock()
+	cp.conns[pc] = struct{}{}
+	cp.connsMu.Unlock()
+}
+
+func (cp *connectionPoolImpl) untrack(pc *pooledConnectImpl) {
+	cp.connsMu.Lock()
+	delete(cp.conns, pc)
+	cp.connsMu.Unlock()
+}
+
+// Connections return the snapshot of all connections created by the pool
+func (cp *connectionPoolImpl) Connections() []*PooledConnectInfo {
+	now := time.Now()
+	cp.connsMu.Lock()
+	defer cp.connsMu.Unlock()
+	infos := make([]*PooledConnectInfo, 0, len(cp.conns))
+	for pc := range cp.conns {
+		infos = append(infos, pc.info(now))
+	}
+	return infos
+}
+
+// KillConnection force close the connection with the given mysql connection id,
+// return false if no such connection in the pool
+func (cp *connectionPoolImpl) KillConnection(connectionID int64) bool {
+	cp.connsMu.Lock()
+	defer cp.connsMu.Unlock()
+	for pc := range cp.conns {
+		if id := pc.connectionID(); id != 0 && id == connectionID {
+			pc.kill()
+			return true
+		}
+	}
+	return false
 }
 
 // Addr return addr of connection pool
@@ -168,16 +214,28 @@ func (cp *connectionPoolImpl) Get(ctx context.Context) (pc PooledConnect, err er
 		return nil, err
 	}
 
-	pc = r.(*pooledConnectImpl)
+	pci := r.(*pooledConnectImpl)
+	pci.inUse.Set(true)
+	pci.lastUsed.Set(time.Now().UnixNano())
+
+	// connection killed by admin while idle, create new one
+	if pci.killed.Get() {
+		return pci, pci.Reconnect()
+	}
+
+	// connection may be closed by mysql wait_timeout or LVS/NAT idle timeout, create new one before use
+	if cp.isExpired(pci, time.Now()) {
+		return pci, pci.Reconnect()
+	}
 
 	//do ping when over the ping time. if error happen, create new one
-	if !pc.GetReturnTime().IsZero() && time.Until(pc.GetReturnTime().Add(pingPeriod)) < 0 {
-		if err = pc.PingWithTimeout(GetConnTimeout); err != nil {
-			err = pc.Reconnect()
+	if !pci.GetReturnTime().IsZero() && time.Until(pci.GetReturnTime().Add(pingPeriod)) < 0 {
+		if err = pci.PingWithTimeout(GetConnTimeout); err != nil {
+			err = pci.Reconnect()
 		}
 	}
 
-	return pc, err
+	return pci, err
 }
 
 // GetCheck return a check backend db connection, which independent with connection pool
@@ -227,7 +285,15 @@ func (cp *connectionPoolImpl) Put(pc PooledConnect) {
 
 	if pc == nil {
 		p.Put(nil)
-	} else if err := cp.tryReuse(pc.(*pooledConnectImpl)); err != nil {
+		return
+	}
+	pc.(*pooledConnectImpl).inUse.Set(false)
+	if cp.isAged(pc.(*pooledConnectImpl), time.Now()) {
+		pc.Close()
+		p.Put(nil)
+		return
+	}
+	if err := cp.tryReuse(pc.(*pooledConnectImpl)); err != nil {
 		pc.Close()
 		p.Put(nil)
 	} else {
@@ -259,6 +325,65 @@ func (cp *connectionPoolImpl) SetIdleTimeout(idleTimeout time.Duration) {
 	cp.idleTimeout = idleTimeout
 }
 
+// SetMaxLifetime set the max lifetime of connections, idle connections exceeding it are closed by pool,
+// connections in use are closed when they are recycled
+func (cp *connectionPoolImpl) SetMaxLifetime(maxLifetime time.Duration) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.connections != nil {
+		cp.connections.SetMaxLifetime(maxLifetime)
+	}
+	cp.maxLifetime = maxLifetime
+}
+
+// isAged check if connection exceeds max lifetime
+func (cp *connectionPoolImpl) isAged(pc *pooledConnectImpl, now time.Time) bool {
+	cp.mu.RLock()
+	maxLifetime := cp.maxLifetime
+	cp.mu.RUnlock()
+	return maxLifetime > 0 && now.Sub(pc.CreateTime()) > maxLifetime
+}
+
+// isExpired check if idle connection exceeds max lifetime or idle timeout
+func (cp *connectionPoolImpl) isExpired(pc *pooledConnectImpl, now time.Time) bool {
+	if cp.isAged(pc, now) {
+		return true
+	}
+	cp.mu.RLock()
+	idleTimeout := cp.idleTimeout
+	cp.mu.RUnlock()
+	returnTime := pc.GetReturnTime()
+	return idleTimeout > 0 && !returnTime.IsZero() && now.Sub(returnTime) > idleTimeout
+}
+
+// SetIdleLimits keep the number of idle connections between minIdle and maxIdle, 0 means no limit
+func (cp *connectionPoolImpl) SetIdleLimits(minIdle, maxIdle int) {
+	p := cp.pool()
+	if p == nil {
+		return
+	}
+	p.SetIdleLimits(minIdle, maxIdle)
+}
+
+// WarmUp pre-establish connections until there are size idle connections in the pool,
+// return the number of connections created
+func (cp *connectionPoolImpl) WarmUp(size int) (int, error) {
+	p := cp.pool()
+	if p == nil {
+		return 0, ErrConnectionPoolClosed
+	}
+	return p.WarmUp(size)
+}
+
+// Idle returns the number of idle connections in the pool
+func (cp *connectionPoolImpl) Idle() int64 {
+	p := cp.pool()
+	if p == nil {
+		return 0
+	}
+	return p.Idle()
+}
+
 // StatsJSON return the pool stats as JSON object.
 func (cp *connectionPoolImpl) StatsJSON() string {
 	p := cp.pool()
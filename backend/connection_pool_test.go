@@ -0,0 +1,85 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util/sync2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionPoolKillConnection(t *testing.T) {
+	cp := NewConnectionPool("127.0.0.1:3306", "root", "", "", 1, 1, 0, "utf8", 33, 0, "", "").(*connectionPoolImpl)
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := mysql.NewConn(client)
+	conn.ConnectionID = 10
+	pc := newPooledConnect(&DirectConnection{conn: conn, closed: sync2.NewAtomicBool(false)}, cp)
+	cp.track(pc)
+	pc.lastSQL.Set("select 1")
+
+	infos := cp.Connections()
+	require.Equal(t, 1, len(infos))
+	require.Equal(t, "127.0.0.1:3306", infos[0].Addr)
+	require.Equal(t, int64(10), infos[0].ConnectionID)
+	require.Equal(t, "select 1", infos[0].LastSQL)
+	require.False(t, infos[0].InUse)
+
+	require.False(t, cp.KillConnection(11))
+	require.True(t, cp.KillConnection(10))
+	require.True(t, pc.killed.Get())
+	require.True(t, conn.IsClosed())
+
+	pc.Close()
+	require.Equal(t, 0, len(cp.Connections()))
+}
+
+func TestConnectionPoolKillConnectionWhileReconnect(t *testing.T) {
+	cp := NewConnectionPool("127.0.0.1:3306", "root", "", "", 1, 1, 0, "utf8", 33, 0, "", "").(*connectionPoolImpl)
+
+	newDirectConnection := func(id uint32) *DirectConnection {
+		client, server := net.Pipe()
+		server.Close()
+		conn := mysql.NewConn(client)
+		conn.ConnectionID = id
+		return &DirectConnection{conn: conn, closed: sync2.NewAtomicBool(false)}
+	}
+	pc := newPooledConnect(newDirectConnection(1), cp)
+	cp.track(pc)
+	defer pc.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cp.Connections()
+			cp.KillConnection(int64(i))
+		}
+	}()
+	// same as Reconnect does, close the old direct connection and replace it with a new one
+	for i := 2; i < 102; i++ {
+		pc.directConnection.Close()
+		pc.setDirectConnection(newDirectConnection(uint32(i)))
+	}
+	<-done
+
+	infos := cp.Connections()
+	require.Equal(t, 1, len(infos))
+	require.Equal(t, int64(101), infos[0].ConnectionID)
+}
@@ -16,6 +16,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -25,6 +26,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -38,6 +41,19 @@ import (
 
 var ErrExecuteTimeout = errors.New("execute timeout")
 
+// defaultClientCapability is used to connect to mysql if capability of slice is not set
+const defaultClientCapability = mysql.ClientProtocol41 | mysql.ClientSecureConnection |
+	mysql.ClientLongPassword | mysql.ClientTransactions | mysql.ClientLongFlag
+
+// ConnectAttrs are connection attributes sent to backend mysql, which can be found in
+// performance_schema.session_connect_attrs. Backend connections are shared by clients,
+// so they carry the attributes of gaea, attributes of clients are recorded in sql log.
+var ConnectAttrs = map[string]string{
+	"_client_name": "gaea",
+	"_pid":         strconv.Itoa(os.Getpid()),
+	"program_name": "gaea",
+}
+
 // DirectConnection means connection to backend mysql
 type DirectConnection struct {
 	conn *mysql.Conn
@@ -66,6 +82,20 @@ type DirectConnection struct {
 	closed                   sync2.AtomicBool
 	capabilityConnectToMySQL uint32
 	moreRowExists            bool
+	reserveRowMemory         func(size int64) error // set by ExecuteWithContext and ExecutePipeline from ctx
+}
+
+type resultMemoryKey struct{}
+
+// WithResultMemory return a context carrying reserve, which is called with size of each row read by
+// ExecuteWithContext and ExecutePipeline. Reading stops and the rest rows are drained once it fails.
+func WithResultMemory(ctx context.Context, reserve func(size int64) error) context.Context {
+	return context.WithValue(ctx, resultMemoryKey{}, reserve)
+}
+
+func resultMemoryFromContext(ctx context.Context) func(size int64) error {
+	reserve, _ := ctx.Value(resultMemoryKey{}).(func(size int64) error)
+	return reserve
 }
 
 // NewDirectConnection return direct and authorised connection to mysql with real net connection
@@ -122,6 +152,9 @@ func (dc *DirectConnection) connect() error {
 		return err
 	}
 
+	// collation of handshake depends on version of backend mysql
+	dc.collation = dc.compatibleCollation(dc.charset, dc.collation)
+
 	// step2: write handshake response
 	if err := dc.writeHandshakeResponse41(); err != nil {
 		dc.conn.Close()
@@ -141,6 +174,11 @@ func (dc *DirectConnection) connect() error {
 		return err
 	}
 
+	// capability is negotiated with server, compressed protocol starts after authentication
+	if dc.capability&mysql.ClientCompress != 0 {
+		dc.conn.EnableCompression()
+	}
+
 	// we must always use autocommit
 	if !dc.IsAutoCommit() {
 		if _, err := dc.exec("set autocommit = 1", 0); err != nil {
@@ -442,8 +480,7 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 
 	var capability uint32
 	if dc.capabilityConnectToMySQL == 0 {
-		capability = mysql.ClientProtocol41 | mysql.ClientSecureConnection |
-			mysql.ClientLongPassword | mysql.ClientTransactions | mysql.ClientLongFlag
+		capability = defaultClientCapability
 	} else {
 		capability = dc.capabilityConnectToMySQL
 	}
@@ -467,6 +504,14 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 		length += mysql.LenNullString(dc.db)
 	}
 
+	// connection attributes must follow the auth plugin name
+	var attrs []byte
+	if dc.capability&mysql.ClientConnectAtts > 0 && len(ConnectAttrs) > 0 {
+		capability |= mysql.ClientConnectAtts
+		attrs = mysql.AppendConnectAttrs(nil, ConnectAttrs)
+		length += mysql.LenNullString(mysql.MysqlNativePassword) + len(attrs)
+	}
+
 	dc.capability = capability
 
 	data := make([]byte, length, length)
@@ -475,11 +520,17 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 	// Client capability flags.
 	pos = mysql.WriteUint32(data, pos, capability)
 
-	// Max-packet size, always 0. See doc.go.
-	pos = mysql.WriteZeroes(data, pos, 4)
+	// Max-packet size, results of any size up to the limit of mysql are accepted,
+	// commands larger than MaxPacketSize are split by WritePacket
+	pos = mysql.WriteUint32(data, pos, mysql.MaxAllowedPacketSize)
 
-	// Character set.
-	pos = mysql.WriteByte(data, pos, byte(dc.collation))
+	// Character set. collation id larger than one byte is set by SET NAMES later
+	collation := dc.collation
+	if collation > 255 {
+		collation = mysql.CharsetIds[dc.charset]
+		dc.collation = collation
+	}
+	pos = mysql.WriteByte(data, pos, byte(collation))
 
 	// 23 reserved bytes, all 0.
 	pos = mysql.WriteZeroes(data, pos, 23)
@@ -497,6 +548,11 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 		pos = mysql.WriteNullString(data, pos, dc.db)
 	}
 
+	if len(attrs) > 0 {
+		pos = mysql.WriteNullString(data, pos, mysql.MysqlNativePassword)
+		copy(data[pos:], attrs)
+	}
+
 	if err := dc.writePacket(data); err != nil {
 		return err
 	}
@@ -644,6 +700,165 @@ func (dc *DirectConnection) ExecuteWithTimeout(sql string, maxRows int, timeout
 	}
 }
 
+// ExecuteWithContext send ComQuery to backend mysql and read the result until ctx is done.
+// When ctx is done first, the blocked read is interrupted by expiring the socket deadline,
+// the connection is left in the middle of a response and is marked as broken, so it will be
+// closed instead of going back to the pool. Caller should kill the query on backend by itself.
+func (dc *DirectConnection) ExecuteWithContext(ctx context.Context, sql string, maxRows int) (*mysql.Result, error) {
+	dc.reserveRowMemory = resultMemoryFromContext(ctx)
+	defer func() { dc.reserveRowMemory = nil }()
+	if ctx.Done() == nil {
+		return dc.exec(sql, maxRows)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+
+	stop := dc.interruptOnDone(ctx)
+	rs, err := dc.exec(sql, maxRows)
+	if stop() {
+		err = contextError(ctx.Err())
+		dc.pkgErr = err
+		return nil, err
+	}
+	return rs, err
+}
+
+// interruptOnDone expire the socket deadline once ctx is done, so blocked io returns.
+// The returned stop function must be called when io is finished, it reports whether io is interrupted.
+func (dc *DirectConnection) interruptOnDone(ctx context.Context) (stop func() bool) {
+	conn := dc.conn
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	interrupted := sync2.NewAtomicBool(false)
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			interrupted.Set(true)
+			if conn != nil {
+				_ = conn.SetDeadline(time.Now())
+			}
+		case <-done:
+		}
+	}()
+	return func() bool {
+		close(done)
+		<-exited
+		return interrupted.Get()
+	}
+}
+
+// ExecutePipeline send sqls to backend mysql before reading their results, so round trips of small
+// queries are overlapped instead of being serial. Results and errors are in order of sqls, error of a sql
+// doesn't stop reading the others unless the connection is broken, then the rest of sqls get the same error.
+// ctx is handled like ExecuteWithContext. Compressed connections execute sqls one by one.
+func (dc *DirectConnection) ExecutePipeline(ctx context.Context, sqls []string, maxRows int) ([]*mysql.Result, []error) {
+	rs := make([]*mysql.Result, len(sqls))
+	errs := make([]error, len(sqls))
+	if dc.capability&mysql.ClientCompress != 0 {
+		for i, sql := range sqls {
+			if rs[i], errs[i] = dc.ExecuteWithContext(ctx, sql, maxRows); dc.pkgErr != nil {
+				fillErrors(errs[i+1:], errs[i])
+				break
+			}
+		}
+		return rs, errs
+	}
+	if err := ctx.Err(); err != nil {
+		fillErrors(errs, contextError(err))
+		return rs, errs
+	}
+	dc.reserveRowMemory = resultMemoryFromContext(ctx)
+	defer func() { dc.reserveRowMemory = nil }()
+
+	var stop func() bool
+	if ctx.Done() != nil {
+		stop = dc.interruptOnDone(ctx)
+	}
+	// sequence of the first response packet of each sql, it's not 1 if sql is split into packets
+	sequences := make([]uint8, len(sqls))
+	broken := len(sqls)
+	for start := 0; start < len(sqls) && broken == len(sqls); {
+		end := dc.writePipeline(sqls, start, sequences)
+		if dc.pkgErr != nil {
+			broken = start
+			break
+		}
+		for i := start; i < end; i++ {
+			dc.conn.SetSequence(sequences[i])
+			rs[i], errs[i] = dc.readPipelineResult(maxRows)
+			if dc.pkgErr != nil {
+				broken = i
+				break
+			}
+		}
+		start = end
+	}
+	if stop != nil && stop() {
+		dc.pkgErr = contextError(ctx.Err())
+	}
+	if broken < len(sqls) {
+		rs[broken] = nil
+		fillErrors(errs[broken:], dc.pkgErr)
+	}
+	return rs, errs
+}
+
+// maxPipelineBytes bounds sqls sent in a batch before reading results. backend mysql doesn't read
+// the next command until result of current one is sent, so the batch should fit in socket buffers.
+const maxPipelineBytes = 64 * 1024
+
+// writePipeline send a batch of sqls from start in one write, it returns end of the batch.
+// dc.pkgErr is set if the write fails.
+func (dc *DirectConnection) writePipeline(sqls []string, start int, sequences []uint8) int {
+	dc.conn.StartWriterBuffering()
+	end, size := start, 0
+	for end < len(sqls) && (end == start || size+len(sqls[end]) <= maxPipelineBytes) {
+		dc.conn.SetSequence(0)
+		data := dc.conn.StartEphemeralPacket(len(sqls[end]) + 1)
+		data[0] = mysql.ComQuery
+		copy(data[1:], sqls[end])
+		if err := dc.conn.WriteEphemeralPacket(); err != nil {
+			dc.conn.Flush()
+			dc.pkgErr = err
+			return end
+		}
+		sequences[end] = dc.conn.GetSequence()
+		size += len(sqls[end])
+		end++
+	}
+	if err := dc.conn.Flush(); err != nil {
+		dc.pkgErr = err
+	}
+	return end
+}
+
+// readPipelineResult read result of a sql sent by writePipeline, rows left by large results are read too
+func (dc *DirectConnection) readPipelineResult(maxRows int) (*mysql.Result, error) {
+	rs, err := dc.readResult(false, maxRows)
+	for err == nil && dc.moreRowExists {
+		err = dc.readResultRows(rs, false, maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func fillErrors(errs []error, err error) {
+	for i := range errs {
+		errs[i] = err
+	}
+}
+
+func contextError(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrExecuteTimeout
+	}
+	return err
+}
+
 // Begin send ComQuery with 'begin' to backend mysql to start transaction
 func (dc *DirectConnection) Begin() error {
 	_, err := dc.exec("begin", 0)
@@ -684,9 +899,10 @@ func (dc *DirectConnection) SetAutoCommit(v uint8) error {
 func (dc *DirectConnection) SetCharset(charset string, collation mysql.CollationID) ( /*changed*/ bool, error) {
 	charset = strings.Trim(charset, "\"'`")
 
-	if collation == 0 || (collation > 247 && (dc.versionCompare == nil || dc.versionCompare.LessThanMySQLVersion80)) {
+	if collation == 0 {
 		collation = mysql.CollationNames[mysql.Charsets[charset]]
 	}
+	collation = dc.compatibleCollation(charset, collation)
 
 	if dc.charset == charset && dc.collation == collation {
 		return false, nil
@@ -707,6 +923,21 @@ func (dc *DirectConnection) SetCharset(charset string, collation mysql.Collation
 	return true, nil
 }
 
+// compatibleCollation replace collations added in MySQL 8.0 with default collation of charset
+// when backend mysql is 5.x or its version is unknown
+func (dc *DirectConnection) compatibleCollation(charset string, collation mysql.CollationID) mysql.CollationID {
+	if !mysql.IsMySQL80Collation(collation) {
+		return collation
+	}
+	if dc.versionCompare != nil && !dc.versionCompare.LessThanMySQLVersion80 {
+		return collation
+	}
+	if id, ok := mysql.CharsetIds[charset]; ok {
+		return id
+	}
+	return collation
+}
+
 // ResetConnection reset connection stattus, include transaction、autocommit、charset、sql_mode .etc
 func (dc *DirectConnection) ResetConnection() error {
 	if dc.IsInTransaction() {
@@ -766,7 +997,8 @@ func (dc *DirectConnection) WriteSetStatement() error {
 	}
 	appendSetCharset(&setVariableSQL, dc.charset, collation)
 
-	for _, v := range dc.sessionVariables.GetAll() {
+	// only replay the variables changed since last write
+	for _, v := range dc.sessionVariables.GetChanged() {
 		if v.Name() == mysql.TxReadOnly && dc.versionCompare != nil && !dc.versionCompare.LessThanMySQLVersion803 {
 			appendSetVariable(&setVariableSQL, mysql.TransactionReadOnly, v.Get())
 			continue
@@ -774,17 +1006,22 @@ func (dc *DirectConnection) WriteSetStatement() error {
 		appendSetVariable(&setVariableSQL, v.Name(), v.Get())
 	}
 
-	for _, v := range dc.sessionVariables.GetUnusedAndClear() {
+	for _, v := range dc.sessionVariables.GetUnused() {
 		appendSetVariableToDefault(&setVariableSQL, v.Name())
 	}
 
 	setSQL := setVariableSQL.String()
 	if setSQL == "" {
+		dc.sessionVariables.CommitChanged()
 		return nil
 	}
 	if _, err := dc.exec(setSQL, 0); err != nil {
+		// mysql applies none of the assignments if one of them failed,
+		// so keep the variables same as backend.
+		dc.sessionVariables.RollbackChanged()
 		return err
 	}
+	dc.sessionVariables.CommitChanged()
 	return nil
 }
 
@@ -819,6 +1056,9 @@ func (dc *DirectConnection) FieldList(table string, wildcard string) ([]*mysql.F
 
 // execute ComQuery command
 func (dc *DirectConnection) exec(query string, maxRows int) (*mysql.Result, error) {
+	if err := dc.injectFault(query); err != nil {
+		return nil, err
+	}
 	if err := dc.writeComQuery(query); err != nil {
 		return nil, err
 	}
@@ -908,7 +1148,7 @@ func (dc *DirectConnection) readResultRows(result *mysql.Result, isBinary bool,
 		// EOF Packet
 		if dc.isEOFPacket(data) {
 			if dc.capability&mysql.ClientProtocol41 > 0 {
-				//result.Warnings = binary.LittleEndian.Uint16(data[1:])
+				result.Warnings = binary.LittleEndian.Uint16(data[1:])
 				//todo add strict_mode, warning will be treat as error
 				result.Status = binary.LittleEndian.Uint16(data[3:])
 				dc.status = result.Status
@@ -930,6 +1170,13 @@ func (dc *DirectConnection) readResultRows(result *mysql.Result, isBinary bool,
 			}
 			return fmt.Errorf("%v %d", sqlerr.ErrRowsLimitExceeded, maxRows)
 		}
+		if dc.reserveRowMemory != nil {
+			if err := dc.reserveRowMemory(int64(len(data))); err != nil {
+				// connection can be reused after the rest rows are drained, or it's broken if drain failed
+				dc.drainResults()
+				return err
+			}
+		}
 
 		if bufLength > mysql.MaxPayloadLen {
 			dc.moreRowExists = true
@@ -956,6 +1203,7 @@ func (dc *DirectConnection) drainResults() error {
 		data, err := dc.conn.ReadEphemeralPacket()
 		if err != nil {
 			dc.conn.RecycleReadPacket()
+			dc.pkgErr = err
 			return err
 		}
 
@@ -15,11 +15,19 @@ package backend
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/mocks/pipeTest"
 	"github.com/stretchr/testify/require"
-	"strings"
-	"testing"
 )
 
 func TestAppendSetVariable(t *testing.T) {
@@ -32,6 +40,36 @@ func TestAppendSetVariable(t *testing.T) {
 	t.Log(buf.String())
 }
 
+func TestSetCharsetCollation(t *testing.T) {
+	tests := []struct {
+		version   string
+		collation mysql.CollationID
+		expect    mysql.CollationID
+	}{
+		{"5.7.25-log", 255, 45},
+		{"5.7.25-log", 309, 45},
+		{"5.7.25-log", 249, 248},
+		{"8.0.22", 249, 249},
+		{"8.0.22", 255, 255},
+		{"8.0.22", 309, 309},
+		{"", 255, 45},
+	}
+	for _, test := range tests {
+		dc := &DirectConnection{charset: "utf8mb4", collation: 46}
+		if test.version != "" {
+			dc.versionCompare = util.NewVersionCompareStatus(test.version)
+		}
+		charset := "utf8mb4"
+		if test.collation == 249 {
+			charset = "gb18030"
+		}
+		changed, err := dc.SetCharset(charset, test.collation)
+		require.Nil(t, err)
+		require.True(t, changed)
+		require.Equal(t, test.expect, dc.collation, "version: %s, collation: %d", test.version, test.collation)
+	}
+}
+
 func TestAppendSetVariable2(t *testing.T) {
 	var buf bytes.Buffer
 	appendSetCharset(&buf, "utf8", "utf8_general_ci")
@@ -174,7 +212,10 @@ func TestDirectConnWithoutDB(t *testing.T) {
 		).CheckArrivedMsg(mockMariaDB) // get the arrived message and check. 对传送到达对方的讯息取出进行确认
 
 		// check result. 确认结果
-		require.Equal(t, len(responseMsg), 64) // check length of the packet. 确认封包长度
+		// check length of the packet, the server supports connection attributes. 确认封包长度, 服务端支持连接属性
+		attrsLength := mysql.LenNullString(mysql.MysqlNativePassword) + len(mysql.AppendConnectAttrs(nil, ConnectAttrs))
+		require.Equal(t, len(responseMsg), 64+attrsLength)
+		require.Equal(t, strings.Contains(string(responseMsg), "program_name"), true) // check the connection attributes. 确认连接属性
 
 		require.Equal(t, strings.Contains(string(responseMsg), "xiaomi"), true) // check the existence of the account in the packet. 确认 用户帐户 是否真的写到封包里
 
@@ -185,3 +226,120 @@ func TestDirectConnWithoutDB(t *testing.T) {
 
 	})
 }
+
+func TestExecuteWithContextTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	// backend reads the query but never responds
+	go io.Copy(ioutil.Discard, server)
+
+	dc := &DirectConnection{conn: mysql.NewConn(client)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := dc.ExecuteWithContext(ctx, "select sleep(10)", 0)
+	require.Equal(t, ErrExecuteTimeout, err)
+	require.True(t, time.Since(start) < time.Second)
+	require.NotNil(t, dc.pkgErr)
+}
+
+func TestExecuteWithContextCanceled(t *testing.T) {
+	dc := &DirectConnection{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := dc.ExecuteWithContext(ctx, "select 1", 0)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestExecuteWithContextResultMemory(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	rows := []string{"aaaa", "bbbb", "cccc"}
+	go func() {
+		backend := mysql.NewConn(server)
+		for {
+			backend.SetSequence(0)
+			if _, err := backend.ReadPacket(); err != nil {
+				return
+			}
+			backend.WritePacket(mysql.AppendLenEncInt(nil, 1))
+			backend.WritePacket((&mysql.Field{Name: []byte("a"), Type: mysql.TypeVarString}).Dump())
+			backend.WriteEOFPacket(mysql.ServerStatusAutocommit, 0)
+			for _, row := range rows {
+				backend.WritePacket(mysql.AppendLenEncStringBytes(nil, []byte(row)))
+			}
+			backend.WriteEOFPacket(mysql.ServerStatusAutocommit, 0)
+		}
+	}()
+
+	dc := &DirectConnection{conn: mysql.NewConn(client), capability: mysql.ClientProtocol41}
+	var reserved int64
+	budgetErr := errors.New("memory budget exceeded")
+	ctx := WithResultMemory(context.Background(), func(size int64) error {
+		if reserved+size > 10 {
+			return budgetErr
+		}
+		reserved += size
+		return nil
+	})
+	// reading is aborted once budget is exceeded, rest rows are drained
+	_, err := dc.ExecuteWithContext(ctx, "select a from t", 0)
+	require.Equal(t, budgetErr, err)
+	require.Equal(t, int64(10), reserved)
+	require.Nil(t, dc.pkgErr)
+	require.Nil(t, dc.reserveRowMemory)
+
+	// connection is reusable
+	rs, err := dc.ExecuteWithContext(context.Background(), "select a from t", 0)
+	require.NoError(t, err)
+	require.Len(t, rs.RowDatas, len(rows))
+}
+
+func TestExecutePipeline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sqls := []string{"update t_0 set a = 1", "update t_1 set a = 1", "update t_2 set a = 1"}
+	go func() {
+		// all sqls are read before any result is sent, it blocks if sqls are not pipelined
+		backend := mysql.NewConn(server)
+		received := make([]string, 0, len(sqls))
+		for range sqls {
+			backend.SetSequence(0)
+			data, err := backend.ReadPacket()
+			if err != nil {
+				return
+			}
+			received = append(received, string(data[1:]))
+		}
+		for i, sql := range received {
+			backend.SetSequence(1)
+			if sql == "update t_1 set a = 1" {
+				backend.WriteErrorPacket(mysql.ErrNoSuchTable, "42S02", "Table 't_1' doesn't exist")
+				continue
+			}
+			backend.WriteOKPacket(uint64(i+1), 0, mysql.ServerStatusAutocommit, 0, "")
+		}
+	}()
+
+	dc := &DirectConnection{conn: mysql.NewConn(client), capability: mysql.ClientProtocol41}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rs, errs := dc.ExecutePipeline(ctx, sqls, 0)
+	require.NoError(t, errs[0])
+	require.Equal(t, uint64(1), rs[0].AffectedRows)
+	require.Equal(t, uint16(mysql.ErrNoSuchTable), errs[1].(*mysql.SQLError).Code)
+	require.NoError(t, errs[2])
+	require.Equal(t, uint64(3), rs[2].AffectedRows)
+	require.Nil(t, dc.pkgErr)
+
+	// backend is gone, all sqls fail
+	server.Close()
+	rs, errs = dc.ExecutePipeline(ctx, sqls, 0)
+	for i := range sqls {
+		require.Nil(t, rs[i])
+		require.Error(t, errs[i])
+	}
+	require.NotNil(t, dc.pkgErr)
+}
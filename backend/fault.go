@@ -0,0 +1,37 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+const (
+	// FaultActionDrop close the backend connection before sending the query
+	FaultActionDrop = "drop"
+	// FaultActionDelay delay the query for DelayMs before sending it
+	FaultActionDelay = "delay"
+	// FaultActionError fail the query with ErrCode and ErrMsg without sending it
+	FaultActionError = "error"
+)
+
+// Fault describe a failure injected into queries to backend, see chaos.go.
+// Empty Addr or Fingerprint matches all backends or all sqls.
+type Fault struct {
+	Addr        string `json:"addr"`
+	Fingerprint string `json:"fingerprint"`
+	Action      string `json:"action"`
+	DelayMs     int    `json:"delay_ms"`
+	ErrCode     uint16 `json:"err_code"`
+	ErrMsg      string `json:"err_msg"`
+	// Times is how many queries the fault applies to, 0 means always
+	Times int `json:"times"`
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+)
+
+// heartbeat works like pt-heartbeat, gaea writes timestamp of master to heartbeat table periodically,
+// slaves compare it with their own clock to get replication lag.
+// the heartbeat table should be created on master:
+// CREATE TABLE heartbeat (id INT UNSIGNED NOT NULL PRIMARY KEY, ts BIGINT NOT NULL)
+const (
+	defaultHeartbeatInterval = time.Second
+	heartbeatID              = 1
+)
+
+func (s *Slice) heartbeatInterval() time.Duration {
+	if s.Cfg.HeartbeatInterval > 0 {
+		return time.Duration(s.Cfg.HeartbeatInterval) * time.Millisecond
+	}
+	return defaultHeartbeatInterval
+}
+
+// writeHeartbeat update heartbeat table on master until ctx is done
+func (s *Slice) writeHeartbeat(ctx context.Context, name string) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Fatal("[ns:%s, %s] write heartbeat panic:%s", name, s.Cfg.Name, err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn("[ns:%s, %s] write heartbeat canceled", name, s.Cfg.Name)
+			return
+		case <-time.After(s.heartbeatInterval()):
+			if len(s.Master.ConnPool) == 0 {
+				continue
+			}
+			if status, _ := s.GetMasterStatus(); status == StatusDown {
+				continue
+			}
+			cp := s.Master.ConnPool[0]
+			if err := updateHeartbeat(cp, s.Cfg.HeartbeatTable, s.healthCheckTimeout()); err != nil {
+				log.Warn("[ns:%s, %s:%s] write heartbeat error:%s", name, s.Cfg.Name, cp.Addr(), err)
+			}
+		}
+	}
+}
+
+func updateHeartbeat(cp ConnectionPool, table string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pc, err := cp.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("get conn error:%s", err)
+	}
+	defer pc.Recycle()
+
+	// use clock of mysql, so lag is not affected by clock of gaea proxies
+	sql := fmt.Sprintf("REPLACE INTO %s (id, ts) VALUES (%d, CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED))", table, heartbeatID)
+	_, err = pc.ExecuteWithTimeout(sql, 0, timeout)
+	return err
+}
+
+// getHeartbeatLag return replication lag of slave in milliseconds
+func getHeartbeatLag(pc PooledConnect, table string, timeout time.Duration) (int64, error) {
+	sql := fmt.Sprintf("SELECT CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED) - ts FROM %s WHERE id = %d", table, heartbeatID)
+	res, err := pc.ExecuteWithTimeout(sql, 0, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("read heartbeat error:%s", err)
+	}
+	if res.RowNumber() == 0 {
+		return 0, fmt.Errorf("heartbeat not found in %s", table)
+	}
+	lag, err := res.GetInt(0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("parse heartbeat error:%s", err)
+	}
+	// clock of slave may be a little behind master
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, nil
+}
+
+// checkSlaveSync check slave lag by heartbeat table if it's configured, otherwise by show slave status
+func (s *Slice) checkSlaveSync(pc PooledConnect, addr string, secondsBehindMaster int) (bool, error) {
+	if s.Cfg.HeartbeatTable == "" {
+		return checkSlaveSyncStatus(pc, secondsBehindMaster)
+	}
+
+	lag, err := getHeartbeatLag(pc, s.Cfg.HeartbeatTable, s.healthCheckTimeout())
+	if err != nil {
+		s.heartbeatLags.Delete(addr)
+		// if secondsBehindMaster is 0, we won't check slave sync status
+		return secondsBehindMaster == 0, err
+	}
+	s.heartbeatLags.Store(addr, lag)
+
+	if secondsBehindMaster > 0 && lag > int64(secondsBehindMaster)*1000 {
+		return false, fmt.Errorf("heartbeat lag(%dms) larger than %ds", lag, secondsBehindMaster)
+	}
+	return true, nil
+}
+
+// GetHeartbeatLag return replication lag of slave measured by heartbeat table, unit: milliseconds
+func (s *Slice) GetHeartbeatLag(addr string) (int64, bool) {
+	v, ok := s.heartbeatLags.Load(addr)
+	if !ok {
+		return 0, false
+	}
+	return v.(int64), true
+}
@@ -29,6 +29,8 @@ type PooledConnect interface {
 	UseDB(db string) error
 	Execute(sql string, maxRows int) (*mysql.Result, error)
 	ExecuteWithTimeout(sql string, maxRows int, timeout time.Duration) (*mysql.Result, error)
+	ExecuteWithContext(ctx context.Context, sql string, maxRows int) (*mysql.Result, error)
+	ExecutePipeline(ctx context.Context, sqls []string, maxRows int) ([]*mysql.Result, []error)
 	SetAutoCommit(v uint8) error
 	Begin() error
 	Commit() error
@@ -60,11 +62,15 @@ type ConnectionPool interface {
 
 	SetCapacity(capacity int) (err error)
 	SetIdleTimeout(idleTimeout time.Duration)
+	SetMaxLifetime(maxLifetime time.Duration)
+	SetIdleLimits(minIdle, maxIdle int)
+	WarmUp(size int) (int, error)
 	StatsJSON() string
 	Capacity() int64
 	Available() int64
 	Active() int64
 	InUse() int64
+	Idle() int64
 	MaxCap() int64
 	WaitCount() int64
 	WaitTime() time.Duration
@@ -72,4 +78,6 @@ type ConnectionPool interface {
 	IdleClosed() int64
 	SetLastChecked()
 	GetLastChecked() int64
+	Connections() []*PooledConnectInfo
+	KillConnection(connectionID int64) bool
 }
@@ -102,6 +102,20 @@ func (mr *MockConnectionPoolMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConnectionPool)(nil).Close))
 }
 
+// Connections mocks base method
+func (m *MockConnectionPool) Connections() []*PooledConnectInfo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Connections")
+	ret0, _ := ret[0].([]*PooledConnectInfo)
+	return ret0
+}
+
+// Connections indicates an expected call of Connections
+func (mr *MockConnectionPoolMockRecorder) Connections() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Connections", reflect.TypeOf((*MockConnectionPool)(nil).Connections))
+}
+
 // Datacenter mocks base method
 func (m *MockConnectionPool) Datacenter() string {
 	m.ctrl.T.Helper()
@@ -160,6 +174,20 @@ func (mr *MockConnectionPoolMockRecorder) GetLastChecked() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastChecked", reflect.TypeOf((*MockConnectionPool)(nil).GetLastChecked))
 }
 
+// Idle mocks base method
+func (m *MockConnectionPool) Idle() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Idle")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// Idle indicates an expected call of Idle
+func (mr *MockConnectionPoolMockRecorder) Idle() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Idle", reflect.TypeOf((*MockConnectionPool)(nil).Idle))
+}
+
 // IdleClosed mocks base method
 func (m *MockConnectionPool) IdleClosed() int64 {
 	m.ctrl.T.Helper()
@@ -202,6 +230,20 @@ func (mr *MockConnectionPoolMockRecorder) InUse() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InUse", reflect.TypeOf((*MockConnectionPool)(nil).InUse))
 }
 
+// KillConnection mocks base method
+func (m *MockConnectionPool) KillConnection(arg0 int64) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KillConnection", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// KillConnection indicates an expected call of KillConnection
+func (mr *MockConnectionPoolMockRecorder) KillConnection(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KillConnection", reflect.TypeOf((*MockConnectionPool)(nil).KillConnection), arg0)
+}
+
 // MaxCap mocks base method
 func (m *MockConnectionPool) MaxCap() int64 {
 	m.ctrl.T.Helper()
@@ -256,6 +298,18 @@ func (mr *MockConnectionPoolMockRecorder) SetCapacity(arg0 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCapacity", reflect.TypeOf((*MockConnectionPool)(nil).SetCapacity), arg0)
 }
 
+// SetIdleLimits mocks base method
+func (m *MockConnectionPool) SetIdleLimits(arg0, arg1 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetIdleLimits", arg0, arg1)
+}
+
+// SetIdleLimits indicates an expected call of SetIdleLimits
+func (mr *MockConnectionPoolMockRecorder) SetIdleLimits(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIdleLimits", reflect.TypeOf((*MockConnectionPool)(nil).SetIdleLimits), arg0, arg1)
+}
+
 // SetIdleTimeout mocks base method
 func (m *MockConnectionPool) SetIdleTimeout(arg0 time.Duration) {
 	m.ctrl.T.Helper()
@@ -280,6 +334,18 @@ func (mr *MockConnectionPoolMockRecorder) SetLastChecked() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLastChecked", reflect.TypeOf((*MockConnectionPool)(nil).SetLastChecked))
 }
 
+// SetMaxLifetime mocks base method
+func (m *MockConnectionPool) SetMaxLifetime(arg0 time.Duration) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxLifetime", arg0)
+}
+
+// SetMaxLifetime indicates an expected call of SetMaxLifetime
+func (mr *MockConnectionPoolMockRecorder) SetMaxLifetime(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxLifetime", reflect.TypeOf((*MockConnectionPool)(nil).SetMaxLifetime), arg0)
+}
+
 // StatsJSON mocks base method
 func (m *MockConnectionPool) StatsJSON() string {
 	m.ctrl.T.Helper()
@@ -321,3 +387,18 @@ func (mr *MockConnectionPoolMockRecorder) WaitTime() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitTime", reflect.TypeOf((*MockConnectionPool)(nil).WaitTime))
 }
+
+// WarmUp mocks base method
+func (m *MockConnectionPool) WarmUp(arg0 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WarmUp", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WarmUp indicates an expected call of WarmUp
+func (mr *MockConnectionPoolMockRecorder) WarmUp(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WarmUp", reflect.TypeOf((*MockConnectionPool)(nil).WarmUp), arg0)
+}
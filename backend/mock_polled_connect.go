@@ -5,6 +5,7 @@
 package backend
 
 import (
+	context "context"
 	mysql "github.com/XiaoMi/Gaea/mysql"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -104,6 +105,36 @@ func (mr *MockPooledConnectMockRecorder) ExecuteWithTimeout(arg0, arg1, arg2 int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteWithTimeout", reflect.TypeOf((*MockPooledConnect)(nil).ExecuteWithTimeout), arg0, arg1, arg2)
 }
 
+// ExecuteWithContext mocks base method
+func (m *MockPooledConnect) ExecuteWithContext(arg0 context.Context, arg1 string, arg2 int) (*mysql.Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteWithContext", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*mysql.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecuteWithContext indicates an expected call of ExecuteWithContext
+func (mr *MockPooledConnectMockRecorder) ExecuteWithContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteWithContext", reflect.TypeOf((*MockPooledConnect)(nil).ExecuteWithContext), arg0, arg1, arg2)
+}
+
+// ExecutePipeline mocks base method
+func (m *MockPooledConnect) ExecutePipeline(arg0 context.Context, arg1 []string, arg2 int) ([]*mysql.Result, []error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecutePipeline", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*mysql.Result)
+	ret1, _ := ret[1].([]error)
+	return ret0, ret1
+}
+
+// ExecutePipeline indicates an expected call of ExecutePipeline
+func (mr *MockPooledConnectMockRecorder) ExecutePipeline(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecutePipeline", reflect.TypeOf((*MockPooledConnect)(nil).ExecutePipeline), arg0, arg1, arg2)
+}
+
 // FetchMoreRows mocks base method
 func (m *MockPooledConnect) FetchMoreRows(arg0 *mysql.Result, arg1 int) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,67 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import "fmt"
+
+// SetOffline mark slave or statistic slave as administratively down for maintenance, reads are drained from it
+// and health check won't bring it up until SetOnline is called.
+func (s *Slice) SetOffline(addr string) error {
+	dbInfos := s.findSlaves(addr)
+	if len(dbInfos) == 0 {
+		return fmt.Errorf("slave %s not found in slice %s", addr, s.Cfg.Name)
+	}
+	s.offlines.Store(addr, true)
+	for db, idx := range dbInfos {
+		db.SetStatus(idx, StatusDown)
+	}
+	return nil
+}
+
+// SetOnline cancel administrative down of the slave, it's up again after passing health check
+func (s *Slice) SetOnline(addr string) error {
+	if len(s.findSlaves(addr)) == 0 {
+		return fmt.Errorf("slave %s not found in slice %s", addr, s.Cfg.Name)
+	}
+	if _, ok := s.offlines.Load(addr); !ok {
+		return fmt.Errorf("slave %s is not offline", addr)
+	}
+	s.offlines.Delete(addr)
+	return nil
+}
+
+// IsOffline check if the slave is administratively down
+func (s *Slice) IsOffline(addr string) bool {
+	_, ok := s.offlines.Load(addr)
+	return ok
+}
+
+// findSlaves return slaves and statistic slaves with the addr, an instance may be both of them
+func (s *Slice) findSlaves(addr string) map[*DBInfo]int {
+	s.RLock()
+	defer s.RUnlock()
+	dbInfos := make(map[*DBInfo]int)
+	for _, db := range []*DBInfo{s.Slave, s.StatisticSlave} {
+		if db == nil {
+			continue
+		}
+		for idx, cp := range db.ConnPool {
+			if cp.Addr() == addr {
+				dbInfos[db] = idx
+			}
+		}
+	}
+	return dbInfos
+}
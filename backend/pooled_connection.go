@@ -15,12 +15,15 @@
 package backend
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/XiaoMi/Gaea/log"
 
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util/sync2"
 )
 
 // PooledConnect app use this object to exec sql
@@ -30,20 +33,53 @@ type pooledConnectImpl struct {
 	returnTime       time.Time
 	moreRowsExist    bool
 	moreResultsExist bool
+
+	// fields below may be read by admin api, keep them atomic
+	createTime sync2.AtomicInt64 // unix nano
+	lastUsed   sync2.AtomicInt64 // unix nano
+	lastSQL    sync2.AtomicString
+	inUse      sync2.AtomicBool
+	killed     sync2.AtomicBool
+
+	// socket of current direct connection, directConnection is replaced by Reconnect and its conn is
+	// reset by Close, so admin api reads and kills connection by this one under connMu instead
+	connMu sync.Mutex
+	conn   *mysql.Conn
+}
+
+// PooledConnectInfo is the snapshot of a pooled connection, used by admin api
+type PooledConnectInfo struct {
+	Addr         string `json:"addr"`
+	ConnectionID int64  `json:"connection_id"`
+	InUse        bool   `json:"in_use"`
+	AgeMs        int64  `json:"age_ms"`
+	IdleMs       int64  `json:"idle_ms"`
+	LastSQL      string `json:"last_sql"`
+}
+
+func newPooledConnect(dc *DirectConnection, cp *connectionPoolImpl) *pooledConnectImpl {
+	pc := &pooledConnectImpl{pool: cp}
+	pc.setDirectConnection(dc)
+	now := time.Now().UnixNano()
+	pc.createTime.Set(now)
+	pc.lastUsed.Set(now)
+	return pc
 }
 
 // Recycle return PooledConnect to the pool
 func (pc *pooledConnectImpl) Recycle() {
-	//if has error,the connection can’t be recycled
-	if pc.directConnection.pkgErr != nil {
+	//if has error or killed by admin,the connection can’t be recycled
+	if pc.directConnection.pkgErr != nil || pc.killed.Get() {
 		pc.Close()
 	}
+	pc.lastUsed.Set(time.Now().UnixNano())
 
 	if pc.IsClosed() {
 		pc.pool.Put(nil)
 	} else {
-		pc.pool.Put(pc)
+		// set before put, the connection may be got by others once it's put
 		pc.returnTime = time.Now()
+		pc.pool.Put(pc)
 	}
 }
 
@@ -55,13 +91,66 @@ func (pc *pooledConnectImpl) Reconnect() error {
 	if err != nil {
 		return err
 	}
-	pc.directConnection = newConn
+	pc.setDirectConnection(newConn)
+	pc.killed.Set(false)
+	pc.createTime.Set(time.Now().UnixNano())
 	return nil
 }
 
+// setDirectConnection replace direct connection and socket of it read by admin api
+func (pc *pooledConnectImpl) setDirectConnection(dc *DirectConnection) {
+	pc.connMu.Lock()
+	defer pc.connMu.Unlock()
+	pc.directConnection = dc
+	if dc != nil {
+		pc.conn = dc.conn
+	} else {
+		pc.conn = nil
+	}
+}
+
+// connectionID return mysql connection id of current socket, 0 if it's not connected
+func (pc *pooledConnectImpl) connectionID() int64 {
+	pc.connMu.Lock()
+	defer pc.connMu.Unlock()
+	if pc.conn == nil {
+		return 0
+	}
+	return int64(pc.conn.ConnectionID)
+}
+
 // Close implement util.Resource interface
 func (pc *pooledConnectImpl) Close() {
 	pc.directConnection.Close()
+	if pc.pool != nil {
+		pc.pool.untrack(pc)
+	}
+}
+
+// kill shutdown the socket of connection, it's safe to call when the connection is used by others.
+// Reading or writing on the connection will fail and the connection won't be recycled.
+func (pc *pooledConnectImpl) kill() {
+	pc.killed.Set(true)
+	pc.connMu.Lock()
+	defer pc.connMu.Unlock()
+	if pc.conn != nil {
+		pc.conn.Close()
+	}
+}
+
+// info return the snapshot of pooled connection
+func (pc *pooledConnectImpl) info(now time.Time) *PooledConnectInfo {
+	info := &PooledConnectInfo{
+		Addr:    pc.pool.addr,
+		InUse:   pc.inUse.Get(),
+		AgeMs:   now.Sub(time.Unix(0, pc.createTime.Get())).Milliseconds(),
+		LastSQL: pc.lastSQL.Get(),
+	}
+	if !info.InUse {
+		info.IdleMs = now.Sub(time.Unix(0, pc.lastUsed.Get())).Milliseconds()
+	}
+	info.ConnectionID = pc.connectionID()
+	return info
 }
 
 // IsClosed check if pooled connection closed
@@ -90,6 +179,7 @@ func (pc *pooledConnectImpl) PingWithTimeout(timeout time.Duration) error {
 
 // Execute wrapper of direct connection, execute sql
 func (pc *pooledConnectImpl) Execute(sql string, maxRows int) (*mysql.Result, error) {
+	pc.lastSQL.Set(sql)
 	rs, err := pc.directConnection.Execute(sql, maxRows)
 	pc.moreRowsExist = pc.directConnection.moreRowExists
 	if err != nil {
@@ -105,6 +195,31 @@ func (pc *pooledConnectImpl) Execute(sql string, maxRows int) (*mysql.Result, er
 	return rs, err
 }
 
+// ExecuteWithContext wrapper of direct connection, execute sql until ctx is done
+func (pc *pooledConnectImpl) ExecuteWithContext(ctx context.Context, sql string, maxRows int) (*mysql.Result, error) {
+	pc.lastSQL.Set(sql)
+	rs, err := pc.directConnection.ExecuteWithContext(ctx, sql, maxRows)
+	pc.moreRowsExist = pc.directConnection.moreRowExists
+	if err != nil {
+		return nil, err
+	}
+	if rs != nil {
+		pc.moreResultsExist = rs.Status&mysql.ServerMoreResultsExists > 0
+	}
+	return rs, err
+}
+
+// ExecutePipeline wrapper of direct connection, send sqls before reading their results
+func (pc *pooledConnectImpl) ExecutePipeline(ctx context.Context, sqls []string, maxRows int) ([]*mysql.Result, []error) {
+	if len(sqls) > 0 {
+		pc.lastSQL.Set(sqls[len(sqls)-1])
+	}
+	rs, errs := pc.directConnection.ExecutePipeline(ctx, sqls, maxRows)
+	pc.moreRowsExist = false
+	pc.moreResultsExist = false
+	return rs, errs
+}
+
 func (pc *pooledConnectImpl) FetchMoreRows(result *mysql.Result, maxRows int) error {
 	err := pc.directConnection.readResultRows(result, false, maxRows)
 	pc.moreRowsExist = pc.directConnection.moreRowExists
@@ -125,6 +240,7 @@ func (pc *pooledConnectImpl) ReadMoreResult(maxRows int) (*mysql.Result, error)
 }
 
 func (pc *pooledConnectImpl) ExecuteWithTimeout(sql string, maxRows int, timeout time.Duration) (*mysql.Result, error) {
+	pc.lastSQL.Set(sql)
 	return pc.directConnection.ExecuteWithTimeout(sql, maxRows, timeout)
 }
 
@@ -199,3 +315,8 @@ func (pc *pooledConnectImpl) GetConnectionID() int64 {
 func (pc *pooledConnectImpl) GetReturnTime() time.Time {
 	return pc.returnTime
 }
+
+// CreateTime return the time when backend connection is created, implement util.AgedResource interface
+func (pc *pooledConnectImpl) CreateTime() time.Time {
+	return time.Unix(0, pc.createTime.Get())
+}
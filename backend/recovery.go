@@ -0,0 +1,54 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/rand"
+	"time"
+)
+
+// markRecovered record the time when slave recovers from down, reads to it will ramp up from recovery_ramp_start
+// percent to full in recovery_ramp_time seconds, so the slave won't be overwhelmed during warming up.
+func (s *Slice) markRecovered(addr string) {
+	if s.Cfg.RecoveryRampTime <= 0 {
+		return
+	}
+	s.recoverTimes.Store(addr, time.Now())
+}
+
+// recoveryPercent return the percent of reads the slave takes, increasing linearly during recovery ramp
+func (s *Slice) recoveryPercent(addr string, now time.Time) int {
+	if s.Cfg.RecoveryRampTime <= 0 {
+		return 100
+	}
+	v, ok := s.recoverTimes.Load(addr)
+	if !ok {
+		return 100
+	}
+	elapsed := now.Sub(v.(time.Time))
+	ramp := time.Duration(s.Cfg.RecoveryRampTime) * time.Second
+	if elapsed >= ramp {
+		s.recoverTimes.Delete(addr)
+		return 100
+	}
+	start := s.Cfg.RecoveryRampStart
+	return start + int(int64(100-start)*int64(elapsed)/int64(ramp))
+}
+
+// isThrottledByRecovery check if the read should skip the recovering slave
+func (s *Slice) isThrottledByRecovery(addr string) bool {
+	percent := s.recoveryPercent(addr, time.Now())
+	return percent < 100 && rand.Intn(100) >= percent
+}
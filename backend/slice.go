@@ -102,6 +102,10 @@ type Slice struct {
 	charset         string
 	collationID     mysql.CollationID
 	HealthCheckSql  string
+	heartbeatLags   sync.Map // key: slave addr, value: lag in milliseconds
+	recoverTimes    sync.Map // key: slave addr, value: time when slave recovers from down
+	breakers        sync.Map // key: slave addr, value: *circuitBreaker
+	offlines        sync.Map // key: slave addr of administratively down
 }
 
 // GetSliceName return name of slice
@@ -133,8 +137,43 @@ func (s *Slice) GetConn(fromSlave bool, userType int, localSlaveReadPriority int
 	return
 }
 
+// GetStatisticConn get connection from statistic slaves, if none of them is available, connection is got
+// by spill-over policy: fail, fall back to slaves or master. Role of the instance serving it is returned.
+func (s *Slice) GetStatisticConn(spillOver string, localSlaveReadPriority int) (PooledConnect, string, error) {
+	pc, err := s.GetSlaveConn(s.StatisticSlave, localSlaveReadPriority)
+	if err == nil {
+		return pc, RoleStatisticSlave, nil
+	}
+	switch spillOver {
+	case models.StatisticSpillOverSlave:
+		log.Warn("get connection from statistic slave failed, try to get from slave, error: %s", err.Error())
+		if pc, err = s.GetSlaveConn(s.Slave, localSlaveReadPriority); err == nil {
+			return pc, RoleSlave, nil
+		}
+	case models.StatisticSpillOverMaster:
+		log.Warn("get connection from statistic slave failed, try to get from master, error: %s", err.Error())
+		if pc, err = s.GetMasterConn(); err == nil {
+			return pc, RoleMaster, nil
+		}
+	}
+	log.Warn("get connection from backend failed, error: %s", err.Error())
+	return nil, "", err
+}
+
 func (s *Slice) GetDirectConn(addr string) (*DirectConnection, error) {
-	return NewDirectConnection(addr, s.Cfg.UserName, s.Cfg.Password, "", s.charset, s.collationID, s.Cfg.Capability)
+	return NewDirectConnection(addr, s.Cfg.UserName, s.Cfg.Password, "", s.charset, s.collationID, s.clientCapability())
+}
+
+// clientCapability return capability used to connect to mysql, CLIENT_COMPRESS is added if compress is zlib
+func (s *Slice) clientCapability() uint32 {
+	capability := s.Cfg.Capability
+	if s.Cfg.Compress != models.CompressZlib {
+		return capability
+	}
+	if capability == 0 {
+		capability = defaultClientCapability
+	}
+	return capability | mysql.ClientCompress
 }
 
 // GetMasterConn return a connection in master pool
@@ -162,6 +201,9 @@ func (s *Slice) CheckStatus(ctx context.Context, name string, downAfterNoAlive i
 	go s.checkBackendMasterStatus(ctx, name, downAfterNoAlive)
 	go s.checkBackendSlaveStatus(ctx, s.Slave, name, downAfterNoAlive, secondsBehindMaster)
 	go s.checkBackendSlaveStatus(ctx, s.StatisticSlave, name, downAfterNoAlive, secondsBehindMaster)
+	if s.Cfg.HeartbeatTable != "" {
+		go s.writeHeartbeat(ctx, name)
+	}
 }
 
 func (s *Slice) checkBackendMasterStatus(ctx context.Context, name string, downAfterNoAlive int) {
@@ -170,23 +212,24 @@ func (s *Slice) checkBackendMasterStatus(ctx context.Context, name string, downA
 			log.Fatal("[ns:%s, %s] check master status panic:%s", name, s.Cfg.Name, err)
 		}
 	}()
+	hc := &healthCounter{}
 	for {
 		select {
 		case <-ctx.Done():
 			log.Warn("[ns:%s, %s] check master status canceled", name, s.Cfg.Name)
 			return
-		case <-time.After(time.Duration(PingPeriod) * time.Second):
+		case <-time.After(s.healthCheckInterval()):
 			if len(s.Master.ConnPool) == 0 {
 				log.Warn("[ns:%s, %s] master is empty", name, s.Cfg.Name)
 				continue
 			}
 			cp := s.Master.ConnPool[0]
 			log.Debug("[ns:%s, %s:%s] start check master", name, s.Cfg.Name, cp.Addr())
-			_, err := checkInstanceStatus(name, cp, s.HealthCheckSql)
+			_, err := checkInstanceStatus(name, cp, s.HealthCheckSql, s.healthCheckTimeout())
 
-			if time.Now().Unix()-cp.GetLastChecked() >= int64(downAfterNoAlive) {
+			if s.isInstanceDown(cp, hc, err, downAfterNoAlive) {
 				s.SetMasterStatus(StatusDown)
-				log.Warn("[ns:%s, %s:%s] check master StatusDown for %ds. err: %s", name, s.Cfg.Name, cp.Addr(), time.Now().Unix()-cp.GetLastChecked(), err)
+				log.Warn("[ns:%s, %s:%s] check master StatusDown for %ds, failures: %d. err: %s", name, s.Cfg.Name, cp.Addr(), time.Now().Unix()-cp.GetLastChecked(), hc.failures, err)
 				continue
 			}
 
@@ -196,6 +239,9 @@ func (s *Slice) checkBackendMasterStatus(ctx context.Context, name string, downA
 				continue
 			}
 
+			if oldStatus == StatusDown && !s.isInstanceRisen(hc) {
+				continue
+			}
 			s.SetMasterStatus(StatusUp)
 			if oldStatus == StatusDown {
 				log.Warn("[ns:%s, %s:%s] check master StatusUp", name, s.Cfg.Name, cp.Addr())
@@ -211,25 +257,36 @@ func (s *Slice) checkBackendSlaveStatus(ctx context.Context, db *DBInfo, name st
 		}
 	}()
 
+	hcs := make([]healthCounter, len(db.ConnPool))
 	for {
 		select {
 		case <-ctx.Done():
 			log.Warn("[ns:%s, %s] check slave status canceled", name, s.Cfg.Name)
 			return
-		case <-time.After(time.Duration(PingPeriod) * time.Second):
+		case <-time.After(s.healthCheckInterval()):
 			for idx, cp := range db.ConnPool {
 				log.Debug("[ns:%s, %s:%s] start check slave", name, s.Cfg.Name, cp.Addr())
 
+				// keep administratively down slave down until it's set online
+				if s.IsOffline(cp.Addr()) {
+					db.SetStatus(idx, StatusDown)
+					continue
+				}
+
 				oldStatus, err := db.GetStatus(idx)
 				if err != nil {
 					log.Warn("[ns:%s, %s:%s] get slave status error:%s", name, s.Cfg.Name, cp.Addr(), err)
 					continue
 				}
-				pc, err := checkInstanceStatus(name, cp, s.HealthCheckSql)
+				hc := &hcs[idx]
+				pc, err := checkInstanceStatus(name, cp, s.HealthCheckSql, s.healthCheckTimeout())
 				// check slave status
-				if time.Now().Unix()-cp.GetLastChecked() >= int64(downAfterNoAlive) {
+				if s.isInstanceDown(cp, hc, err, downAfterNoAlive) {
 					db.SetStatus(idx, StatusDown)
-					log.Warn("[ns:%s, %s:%s] check slave StatusDown for %ds. err:%s", name, s.Cfg.Name, cp.Addr(), time.Now().Unix()-cp.GetLastChecked(), err)
+					log.Warn("[ns:%s, %s:%s] check slave StatusDown for %ds, failures: %d. err:%s", name, s.Cfg.Name, cp.Addr(), time.Now().Unix()-cp.GetLastChecked(), hc.failures, err)
+					continue
+				}
+				if oldStatus == StatusDown && !s.isInstanceRisen(hc) {
 					continue
 				}
 
@@ -241,6 +298,7 @@ func (s *Slice) checkBackendSlaveStatus(ctx context.Context, db *DBInfo, name st
 					// set slave status to up to avoid slave down when master is down on startup
 					db.SetStatus(idx, StatusUp)
 					if oldStatus == StatusDown {
+						s.markRecovered(cp.Addr())
 						log.Warn("[ns:%s, %s:%s] check slave StatusUp", name, s.Cfg.Name, cp.Addr())
 					}
 					continue
@@ -251,7 +309,9 @@ func (s *Slice) checkBackendSlaveStatus(ctx context.Context, db *DBInfo, name st
 					continue
 				}
 
-				if alive, err := checkSlaveSyncStatus(pc, secondBehindMaster); !alive {
+				if alive, err := s.checkSlaveSync(pc, cp.Addr(), secondBehindMaster); !alive {
+					// slave must rise again after it catches up with master
+					hc.successes = 0
 					db.SetStatus(idx, StatusDown)
 					log.Warn("[ns:%s, %s:%s] check slave StatusDown. sync err:%s", name, s.Cfg.Name, cp.Addr(), err)
 					continue
@@ -259,6 +319,7 @@ func (s *Slice) checkBackendSlaveStatus(ctx context.Context, db *DBInfo, name st
 
 				db.SetStatus(idx, StatusUp)
 				if oldStatus == StatusDown {
+					s.markRecovered(cp.Addr())
 					log.Warn("[ns:%s, %s:%s] check slave StatusUp", name, s.Cfg.Name, cp.Addr())
 				}
 			}
@@ -266,14 +327,62 @@ func (s *Slice) checkBackendSlaveStatus(ctx context.Context, db *DBInfo, name st
 	}
 }
 
-func checkInstanceStatus(name string, cp ConnectionPool, healthCheckSql string) (PooledConnect, error) {
+// healthCounter counts consecutive results of health check on an instance
+type healthCounter struct {
+	successes int
+	failures  int
+}
+
+func (hc *healthCounter) record(alive bool) {
+	if alive {
+		hc.successes++
+		hc.failures = 0
+	} else {
+		hc.failures++
+		hc.successes = 0
+	}
+}
+
+// isInstanceDown record the check result and decide whether the instance is down.
+// instance is down after health_check_fall consecutive failures if it's set,
+// otherwise after no alive for downAfterNoAlive seconds.
+func (s *Slice) isInstanceDown(cp ConnectionPool, hc *healthCounter, err error, downAfterNoAlive int) bool {
+	hc.record(err == nil)
+	if s.Cfg.HealthCheckFall > 0 {
+		return hc.failures >= s.Cfg.HealthCheckFall
+	}
+	return time.Now().Unix()-cp.GetLastChecked() >= int64(downAfterNoAlive)
+}
+
+// isInstanceRisen check if the down instance has passed health_check_rise consecutive checks
+func (s *Slice) isInstanceRisen(hc *healthCounter) bool {
+	return hc.successes >= s.Cfg.HealthCheckRise
+}
+
+func (s *Slice) healthCheckInterval() time.Duration {
+	if s.Cfg.HealthCheckInterval > 0 {
+		return time.Duration(s.Cfg.HealthCheckInterval) * time.Millisecond
+	}
+	return time.Duration(PingPeriod) * time.Second
+}
+
+func (s *Slice) healthCheckTimeout() time.Duration {
+	if s.Cfg.HealthCheckTimeout > 0 {
+		return time.Duration(s.Cfg.HealthCheckTimeout) * time.Millisecond
+	}
+	return ExecTimeOut
+}
+
+func checkInstanceStatus(name string, cp ConnectionPool, healthCheckSql string, timeout time.Duration) (PooledConnect, error) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Fatal("[ns:%s, %s] check instance status panic:%s", name, cp.Addr(), err)
 		}
 	}()
 
-	pc, err := cp.GetCheck(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pc, err := cp.GetCheck(ctx)
 	if err != nil {
 		if pc != nil {
 			pc.Close()
@@ -286,7 +395,7 @@ func checkInstanceStatus(name string, cp ConnectionPool, healthCheckSql string)
 	}
 
 	if len(healthCheckSql) > 0 {
-		_, err := pc.ExecuteWithTimeout(healthCheckSql, 0, ExecTimeOut)
+		_, err := pc.ExecuteWithTimeout(healthCheckSql, 0, timeout)
 		if err == nil {
 			cp.SetLastChecked()
 			return pc, nil
@@ -297,7 +406,7 @@ func checkInstanceStatus(name string, cp ConnectionPool, healthCheckSql string)
 			return nil, fmt.Errorf("exec health check query error:%s", err)
 		}
 	}
-	if err = pc.PingWithTimeout(GetConnTimeout); err != nil {
+	if err = pc.PingWithTimeout(timeout); err != nil {
 		pc.Close()
 		return nil, fmt.Errorf("ping conn error:%s", err)
 	}
@@ -321,11 +430,24 @@ func allSlaveIsOffline(SlaveStatusMap *sync.Map) bool {
 
 // GetSlaveConn get connection from salve
 func (s *Slice) GetSlaveConn(slavesInfo *DBInfo, localSlaveReadPriority int) (PooledConnect, error) {
+	return s.getSlaveConn(slavesInfo, localSlaveReadPriority, nil)
+}
+
+// GetOtherSlaveConn get connection from slaves except the given addrs, used to retry reads on another slave
+func (s *Slice) GetOtherSlaveConn(userType int, localSlaveReadPriority int, excludeAddrs map[string]bool) (PooledConnect, error) {
+	slavesInfo := s.Slave
+	if userType == models.StatisticUser {
+		slavesInfo = s.StatisticSlave
+	}
+	return s.getSlaveConn(slavesInfo, localSlaveReadPriority, excludeAddrs)
+}
+
+func (s *Slice) getSlaveConn(slavesInfo *DBInfo, localSlaveReadPriority int, excludeAddrs map[string]bool) (PooledConnect, error) {
 	if len(slavesInfo.ConnPool) == 0 || allSlaveIsOffline(slavesInfo.StatusMap) {
 		return nil, errors.ErrNoSlaveDB
 	}
 	var index int
-	partialFoundIndex, foundIndex := -1, -1
+	partialFoundIndex, foundIndex, throttledIndex := -1, -1, -1
 	// find the idx of the ConnPool that isn't mark as down
 	for size := len(slavesInfo.ConnPool); size > 0; size-- {
 		s.Lock()
@@ -344,6 +466,22 @@ func (s *Slice) GetSlaveConn(slavesInfo *DBInfo, localSlaveReadPriority int) (Po
 			continue
 		}
 
+		if excludeAddrs[slavesInfo.ConnPool[index].Addr()] {
+			continue
+		}
+
+		// circuit of slave is open, divert reads to other slaves
+		if !s.allowByCircuitBreaker(slavesInfo.ConnPool[index].Addr()) {
+			log.Debug("circuit of slave is open, addr:%s", slavesInfo.ConnPool[index].Addr())
+			continue
+		}
+
+		// recovering slave only takes part of reads, other slaves take the rest
+		if s.isThrottledByRecovery(slavesInfo.ConnPool[index].Addr()) {
+			throttledIndex = index
+			continue
+		}
+
 		// partial found slave cause slave status StatusUP
 		partialFoundIndex = index
 
@@ -358,6 +496,13 @@ func (s *Slice) GetSlaveConn(slavesInfo *DBInfo, localSlaveReadPriority int) (Po
 			break
 		}
 	}
+	// only recovering slaves are available, use it anyway
+	if foundIndex < 0 && partialFoundIndex < 0 && throttledIndex >= 0 {
+		partialFoundIndex = throttledIndex
+		if localSlaveReadPriority == LocalSlaveReadClosed || slavesInfo.ConnPool[throttledIndex].Datacenter() == s.ProxyDatacenter {
+			foundIndex = throttledIndex
+		}
+	}
 	if foundIndex >= 0 {
 		return slavesInfo.ConnPool[foundIndex].Get(context.TODO())
 	}
@@ -389,6 +534,39 @@ func (s *Slice) Close() error {
 	return nil
 }
 
+// GetConnectionInfos return snapshot of all pooled connections in slice, include master, slaves and statistic slaves
+func (s *Slice) GetConnectionInfos() []*PooledConnectInfo {
+	s.RLock()
+	defer s.RUnlock()
+	infos := make([]*PooledConnectInfo, 0)
+	for _, dbInfo := range []*DBInfo{s.Master, s.Slave, s.StatisticSlave} {
+		if dbInfo == nil {
+			continue
+		}
+		for _, cp := range dbInfo.ConnPool {
+			infos = append(infos, cp.Connections()...)
+		}
+	}
+	return infos
+}
+
+// KillConnection force close pooled connection by addr and mysql connection id, return false if not found
+func (s *Slice) KillConnection(addr string, connectionID int64) bool {
+	s.RLock()
+	defer s.RUnlock()
+	for _, dbInfo := range []*DBInfo{s.Master, s.Slave, s.StatisticSlave} {
+		if dbInfo == nil {
+			continue
+		}
+		for _, cp := range dbInfo.ConnPool {
+			if cp.Addr() == addr && cp.KillConnection(connectionID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ParseMaster create master connection pool
 func (s *Slice) ParseMaster(masterStr string) error {
 	if len(masterStr) == 0 {
@@ -403,10 +581,11 @@ func (s *Slice) ParseMaster(masterStr string) error {
 		log.Warn("get master(%s) datacenter err:%s,will use default proxy datacenter.", masterStr, err)
 		dc = s.ProxyDatacenter
 	}
-	connectionPool := NewConnectionPool(masterStr, s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID, s.Cfg.Capability, s.Cfg.InitConnect, dc)
+	connectionPool := NewConnectionPool(masterStr, s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID, s.clientCapability(), s.Cfg.InitConnect, dc)
 	if err := connectionPool.Open(); err != nil {
 		return err
 	}
+	s.initPool(connectionPool)
 
 	status := &sync.Map{}
 	status.Store(0, StatusUp)
@@ -415,6 +594,23 @@ func (s *Slice) ParseMaster(masterStr string) error {
 	return nil
 }
 
+// initPool set max lifetime and idle limits of connection pool and pre-establish connections,
+// warm up failure is only logged, connections will be created when they are used.
+func (s *Slice) initPool(cp ConnectionPool) {
+	cp.SetMaxLifetime(time.Duration(s.Cfg.MaxLifetime) * time.Second)
+	cp.SetIdleLimits(s.Cfg.MinIdle, s.Cfg.MaxIdle)
+	size := s.Cfg.WarmUp
+	if size < s.Cfg.MinIdle {
+		size = s.Cfg.MinIdle
+	}
+	if size <= 0 {
+		return
+	}
+	if n, err := cp.WarmUp(size); err != nil {
+		log.Warn("warm up connection pool failed, addr: %s, created: %d, err: %v", cp.Addr(), n, err)
+	}
+}
+
 // ParseSlave create connection pool of slaves
 // (127.0.0.1:3306@2,192.168.0.12:3306@3)
 func (s *Slice) ParseSlave(slaves []string) (*DBInfo, error) {
@@ -467,10 +663,14 @@ func (s *Slice) ParseSlave(slaves []string) (*DBInfo, error) {
 		}
 		datacenter = append(datacenter, dc)
 
-		cp := NewConnectionPool(addrAndWeight[0], s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID, s.Cfg.Capability, s.Cfg.InitConnect, dc)
+		cp := NewConnectionPool(addrAndWeight[0], s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID, s.clientCapability(), s.Cfg.InitConnect, dc)
 		if err = cp.Open(); err != nil {
 			return nil, err
 		}
+		s.initPool(cp)
+		if s.Cfg.CircuitBreaker.IsEnabled() {
+			s.breakers.Store(addrAndWeight[0], newCircuitBreaker(s.Cfg.CircuitBreaker))
+		}
 		connPool = append(connPool, cp)
 	}
 
@@ -19,7 +19,10 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/XiaoMi/Gaea/core/errors"
+	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/golang/mock/gomock"
@@ -310,3 +313,360 @@ func TestCheckSlaveSyncStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestHealthCheckRiseFall(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	cp := NewMockConnectionPool(mockCtl)
+	cp.EXPECT().GetLastChecked().Return(time.Now().Unix()).AnyTimes()
+
+	s := &Slice{}
+	hc := &healthCounter{}
+	checkErr := fmt.Errorf("ping conn error")
+
+	// down after no alive for a while if health_check_fall is not set
+	assert.False(t, s.isInstanceDown(cp, hc, checkErr, 10))
+	assert.True(t, s.isInstanceDown(cp, hc, checkErr, 0))
+
+	s.Cfg.HealthCheckFall = 3
+	s.Cfg.HealthCheckRise = 2
+	hc = &healthCounter{}
+	assert.False(t, s.isInstanceDown(cp, hc, checkErr, 0))
+	assert.False(t, s.isInstanceDown(cp, hc, checkErr, 0))
+	assert.True(t, s.isInstanceDown(cp, hc, checkErr, 0))
+
+	assert.False(t, s.isInstanceDown(cp, hc, nil, 0))
+	assert.False(t, s.isInstanceRisen(hc))
+	assert.False(t, s.isInstanceDown(cp, hc, nil, 0))
+	assert.True(t, s.isInstanceRisen(hc))
+
+	// failure resets successes
+	assert.False(t, s.isInstanceDown(cp, hc, checkErr, 0))
+	assert.False(t, s.isInstanceRisen(hc))
+}
+
+func TestHealthCheckConfig(t *testing.T) {
+	s := &Slice{}
+	assert.Equal(t, time.Duration(PingPeriod)*time.Second, s.healthCheckInterval())
+	assert.Equal(t, ExecTimeOut, s.healthCheckTimeout())
+
+	s.Cfg.HealthCheckInterval = 500
+	s.Cfg.HealthCheckTimeout = 200
+	assert.Equal(t, 500*time.Millisecond, s.healthCheckInterval())
+	assert.Equal(t, 200*time.Millisecond, s.healthCheckTimeout())
+}
+
+func TestClientCapability(t *testing.T) {
+	s := &Slice{}
+	assert.Equal(t, uint32(0), s.clientCapability())
+
+	s.Cfg.Compress = models.CompressZlib
+	assert.Equal(t, uint32(defaultClientCapability|mysql.ClientCompress), s.clientCapability())
+
+	s.Cfg.Capability = mysql.ClientProtocol41 | mysql.ClientMultiStatements
+	assert.Equal(t, uint32(mysql.ClientProtocol41|mysql.ClientMultiStatements|mysql.ClientCompress), s.clientCapability())
+
+	s.Cfg.Compress = "zstd"
+	assert.Equal(t, uint32(mysql.ClientProtocol41|mysql.ClientMultiStatements), s.clientCapability())
+}
+
+func TestCheckSlaveSyncByHeartbeat(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newLagResult := func(lag int64) *mysql.Result {
+		r := &mysql.Resultset{
+			Fields: []*mysql.Field{{Name: []byte("lag")}},
+			Values: [][]interface{}{{lag}},
+		}
+		return &mysql.Result{Resultset: r}
+	}
+
+	s := &Slice{}
+	s.Cfg.HeartbeatTable = "gaea.heartbeat"
+	pc := NewMockPooledConnect(mockCtl)
+
+	pc.EXPECT().ExecuteWithTimeout(gomock.Any(), 0, ExecTimeOut).Return(newLagResult(1500), nil)
+	alive, err := s.checkSlaveSync(pc, "127.0.0.1:3306", 2)
+	assert.True(t, alive)
+	assert.NoError(t, err)
+	lag, ok := s.GetHeartbeatLag("127.0.0.1:3306")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1500), lag)
+
+	pc.EXPECT().ExecuteWithTimeout(gomock.Any(), 0, ExecTimeOut).Return(newLagResult(2500), nil)
+	alive, err = s.checkSlaveSync(pc, "127.0.0.1:3306", 2)
+	assert.False(t, alive)
+	assert.Error(t, err)
+
+	// lag is only recorded if seconds_behind_master is not set
+	pc.EXPECT().ExecuteWithTimeout(gomock.Any(), 0, ExecTimeOut).Return(newLagResult(5000), nil)
+	alive, _ = s.checkSlaveSync(pc, "127.0.0.1:3306", 0)
+	assert.True(t, alive)
+
+	pc.EXPECT().ExecuteWithTimeout(gomock.Any(), 0, ExecTimeOut).Return(nil, fmt.Errorf("table doesn't exist"))
+	alive, err = s.checkSlaveSync(pc, "127.0.0.1:3306", 2)
+	assert.False(t, alive)
+	assert.Error(t, err)
+	_, ok = s.GetHeartbeatLag("127.0.0.1:3306")
+	assert.False(t, ok)
+}
+
+func TestRecoveryRamp(t *testing.T) {
+	addr := "c3-mysql-test00.bj:3306"
+	s := &Slice{}
+	s.markRecovered(addr)
+	assert.Equal(t, 100, s.recoveryPercent(addr, time.Now()))
+
+	s.Cfg.RecoveryRampTime = 10
+	s.Cfg.RecoveryRampStart = 20
+	s.markRecovered(addr)
+	v, _ := s.recoverTimes.Load(addr)
+	recoverTime := v.(time.Time)
+	assert.Equal(t, 20, s.recoveryPercent(addr, recoverTime))
+	assert.Equal(t, 60, s.recoveryPercent(addr, recoverTime.Add(5*time.Second)))
+	assert.Equal(t, 100, s.recoveryPercent(addr, recoverTime.Add(10*time.Second)))
+	_, ok := s.recoverTimes.Load(addr)
+	assert.False(t, ok)
+}
+
+func TestGetSlaveConnRecovering(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	slaveAddrs := []string{"c3-mysql-test00.bj:3306", "c3-mysql-test01.bj:3308"}
+	s := &Slice{ProxyDatacenter: "c3"}
+	s.Slave = generateDBInfo(mockCtl, slaveAddrs, []StatusCode{StatusUp, StatusUp})
+	s.Cfg.RecoveryRampTime = 3600
+	s.markRecovered(slaveAddrs[0])
+
+	// recovering slave takes no read at the beginning of ramp
+	for i := 0; i < 4; i++ {
+		pc, err := s.GetSlaveConn(s.Slave, LocalSlaveReadClosed)
+		assert.NoError(t, err)
+		assert.Equal(t, slaveAddrs[1], pc.GetAddr())
+	}
+
+	// recovering slave is used if other slaves are down
+	s.Slave.SetStatus(1, StatusDown)
+	pc, err := s.GetSlaveConn(s.Slave, LocalSlaveReadClosed)
+	assert.NoError(t, err)
+	assert.Equal(t, slaveAddrs[0], pc.GetAddr())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cfg := &models.CircuitBreaker{Window: 10, MinRequests: 10, ErrorRate: 50, P99Latency: 100, OpenTime: 5, Probes: 2}
+	now := time.Unix(1700000000, 0)
+
+	// too few requests
+	cb := newCircuitBreaker(cfg)
+	for i := 0; i < 9; i++ {
+		cb.record(now, time.Millisecond, true)
+	}
+	assert.True(t, cb.allow(now))
+
+	// error rate crosses threshold
+	cb.record(now, time.Millisecond, true)
+	assert.False(t, cb.allow(now))
+	assert.False(t, cb.allow(now.Add(4*time.Second)))
+
+	// half open after open time, a failed probe opens again
+	now = now.Add(5 * time.Second)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+	assert.False(t, cb.allow(now))
+	cb.record(now, time.Millisecond, true)
+	assert.True(t, cb.isOpen())
+
+	// all probes pass, close
+	now = now.Add(5 * time.Second)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+	cb.record(now, time.Millisecond, false)
+	cb.record(now, time.Millisecond, false)
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.allow(now))
+
+	// p99 latency crosses threshold
+	cb = newCircuitBreaker(cfg)
+	for i := 0; i < 100; i++ {
+		cb.record(now, time.Millisecond, false)
+	}
+	assert.False(t, cb.isOpen())
+	for i := 0; i < 2; i++ {
+		cb.record(now, time.Second, false)
+	}
+	assert.True(t, cb.isOpen())
+
+	// requests out of window are not counted
+	cb = newCircuitBreaker(cfg)
+	for i := 0; i < 9; i++ {
+		cb.record(now, time.Millisecond, true)
+	}
+	cb.record(now.Add(10*time.Second), time.Millisecond, true)
+	assert.False(t, cb.isOpen())
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	assert.False(t, IsBackendFailure(nil))
+	assert.True(t, IsBackendFailure(fmt.Errorf("connection reset by peer")))
+	assert.True(t, IsBackendFailure(mysql.NewError(mysql.ErrConCount, "Too many connections")))
+	assert.False(t, IsBackendFailure(mysql.NewError(mysql.ErrSyntax, "syntax error")))
+	assert.False(t, IsBackendFailure(ErrExecuteTimeout))
+	assert.False(t, IsBackendFailure(context.Canceled))
+	assert.False(t, IsBackendFailure(fmt.Errorf("exec error: %w", context.DeadlineExceeded)))
+}
+
+func TestGetSlaveConnCircuitOpen(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	slaveAddrs := []string{"c3-mysql-test00.bj:3306", "c3-mysql-test01.bj:3308"}
+	s := &Slice{ProxyDatacenter: "c3"}
+	s.Slave = generateDBInfo(mockCtl, slaveAddrs, []StatusCode{StatusUp, StatusUp})
+	s.Cfg.CircuitBreaker = &models.CircuitBreaker{Window: 10, MinRequests: 1, ErrorRate: 50}
+	for _, addr := range slaveAddrs {
+		s.breakers.Store(addr, newCircuitBreaker(s.Cfg.CircuitBreaker))
+	}
+	s.RecordBackendResult(slaveAddrs[0], time.Millisecond, fmt.Errorf("i/o timeout"))
+	assert.True(t, s.IsCircuitOpen(slaveAddrs[0]))
+
+	// reads are diverted to the other slave
+	for i := 0; i < 4; i++ {
+		pc, err := s.GetSlaveConn(s.Slave, LocalSlaveReadClosed)
+		assert.NoError(t, err)
+		assert.Equal(t, slaveAddrs[1], pc.GetAddr())
+	}
+
+	// no slave available if circuits of all slaves are open
+	s.RecordBackendResult(slaveAddrs[1], time.Millisecond, fmt.Errorf("i/o timeout"))
+	_, err := s.GetSlaveConn(s.Slave, LocalSlaveReadClosed)
+	assert.Error(t, err)
+}
+
+func TestGetOtherSlaveConn(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	slaveAddrs := []string{"c3-mysql-test00.bj:3306", "c3-mysql-test01.bj:3308"}
+	s := &Slice{ProxyDatacenter: "c3"}
+	s.Slave = generateDBInfo(mockCtl, slaveAddrs, []StatusCode{StatusUp, StatusUp})
+	s.StatisticSlave = &DBInfo{}
+
+	for i := 0; i < 4; i++ {
+		pc, err := s.GetOtherSlaveConn(0, LocalSlaveReadClosed, map[string]bool{slaveAddrs[0]: true})
+		assert.NoError(t, err)
+		assert.Equal(t, slaveAddrs[1], pc.GetAddr())
+	}
+
+	_, err := s.GetOtherSlaveConn(0, LocalSlaveReadClosed, map[string]bool{slaveAddrs[0]: true, slaveAddrs[1]: true})
+	assert.Error(t, err)
+
+	_, err = s.GetOtherSlaveConn(models.StatisticUser, LocalSlaveReadClosed, nil)
+	assert.Equal(t, errors.ErrNoSlaveDB, err)
+}
+
+func TestGetStatisticConn(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	addrs := []string{"c3-mysql-test00.bj:3306", "c3-mysql-test01.bj:3306", "c3-mysql-test02.bj:3306"}
+	s := &Slice{ProxyDatacenter: "c3"}
+	s.Master = generateDBInfo(mockCtl, addrs[:1], []StatusCode{StatusUp})
+	s.Slave = generateDBInfo(mockCtl, addrs[1:2], []StatusCode{StatusUp})
+	s.StatisticSlave = generateDBInfo(mockCtl, addrs[2:], []StatusCode{StatusUp})
+
+	pc, role, err := s.GetStatisticConn(models.StatisticSpillOverMaster, LocalSlaveReadClosed)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleStatisticSlave, role)
+	assert.Equal(t, addrs[2], pc.GetAddr())
+
+	s.StatisticSlave.SetStatus(0, StatusDown)
+	for _, spillOver := range []string{"", models.StatisticSpillOverFail} {
+		_, _, err = s.GetStatisticConn(spillOver, LocalSlaveReadClosed)
+		assert.Error(t, err)
+	}
+	pc, role, err = s.GetStatisticConn(models.StatisticSpillOverSlave, LocalSlaveReadClosed)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleSlave, role)
+	assert.Equal(t, addrs[1], pc.GetAddr())
+	pc, role, err = s.GetStatisticConn(models.StatisticSpillOverMaster, LocalSlaveReadClosed)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleMaster, role)
+	assert.Equal(t, addrs[0], pc.GetAddr())
+
+	// slaves are down too
+	s.Slave.SetStatus(0, StatusDown)
+	_, _, err = s.GetStatisticConn(models.StatisticSpillOverSlave, LocalSlaveReadClosed)
+	assert.Error(t, err)
+}
+
+func TestSetOffline(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	slaveAddrs := []string{"c3-mysql-test00.bj:3306", "c3-mysql-test01.bj:3308"}
+	s := &Slice{ProxyDatacenter: "c3"}
+	s.Slave = generateDBInfo(mockCtl, slaveAddrs, []StatusCode{StatusUp, StatusUp})
+	s.StatisticSlave = generateDBInfo(mockCtl, slaveAddrs[:1], []StatusCode{StatusUp})
+
+	assert.Error(t, s.SetOffline("c3-mysql-test02.bj:3306"))
+	assert.Error(t, s.SetOnline(slaveAddrs[0]))
+
+	assert.NoError(t, s.SetOffline(slaveAddrs[0]))
+	assert.True(t, s.IsOffline(slaveAddrs[0]))
+	status, _ := s.Slave.GetStatus(0)
+	assert.Equal(t, StatusDown, status)
+	status, _ = s.StatisticSlave.GetStatus(0)
+	assert.Equal(t, StatusDown, status)
+
+	// reads are drained from offline slave
+	for i := 0; i < 4; i++ {
+		pc, err := s.GetSlaveConn(s.Slave, LocalSlaveReadClosed)
+		assert.NoError(t, err)
+		assert.Equal(t, slaveAddrs[1], pc.GetAddr())
+	}
+
+	assert.NoError(t, s.SetOnline(slaveAddrs[0]))
+	assert.False(t, s.IsOffline(slaveAddrs[0]))
+}
+
+func TestGetBackendStatus(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newPool := func(addr string, capacity int64) ConnectionPool {
+		cp := NewMockConnectionPool(mockCtl)
+		cp.EXPECT().Addr().Return(addr).AnyTimes()
+		cp.EXPECT().Datacenter().Return("c3").AnyTimes()
+		cp.EXPECT().Capacity().Return(capacity).AnyTimes()
+		cp.EXPECT().Active().Return(int64(2)).AnyTimes()
+		cp.EXPECT().InUse().Return(int64(1)).AnyTimes()
+		cp.EXPECT().Idle().Return(int64(1)).AnyTimes()
+		cp.EXPECT().WaitCount().Return(int64(0)).AnyTimes()
+		return cp
+	}
+	newDBInfo := func(pools ...ConnectionPool) *DBInfo {
+		db := &DBInfo{ConnPool: pools, StatusMap: &sync.Map{}}
+		for i := range pools {
+			db.SetStatus(i, StatusUp)
+		}
+		return db
+	}
+	s := &Slice{}
+	s.Master = newDBInfo(newPool("c3-mysql-test00.bj:3306", 64))
+	s.Slave = newDBInfo(newPool("c3-mysql-test01.bj:3306", 32), newPool("c3-mysql-test02.bj:3306", 32))
+	s.StatisticSlave = newDBInfo()
+	s.heartbeatLags.Store("c3-mysql-test01.bj:3306", int64(120))
+	assert.NoError(t, s.SetOffline("c3-mysql-test02.bj:3306"))
+
+	status := s.GetBackendStatus()
+	assert.Equal(t, 3, len(status))
+	assert.Equal(t, &BackendStatus{Addr: "c3-mysql-test00.bj:3306", Role: RoleMaster, Datacenter: "c3", Up: true,
+		HeartbeatLag: -1, Capacity: 64, Active: 2, InUse: 1, Idle: 1}, status[0])
+	assert.Equal(t, RoleSlave, status[1].Role)
+	assert.Equal(t, int64(120), status[1].HeartbeatLag)
+	assert.True(t, status[1].Up)
+	assert.False(t, status[2].Up)
+	assert.True(t, status[2].Offline)
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+// roles of backend instances in slice
+const (
+	RoleMaster         = "master"
+	RoleSlave          = "slave"
+	RoleStatisticSlave = "statistic-slave"
+)
+
+// BackendStatus status of backend instance decided by health check of slice, and usage of its connection pool
+type BackendStatus struct {
+	Addr         string `json:"addr"`
+	Role         string `json:"role"`
+	Datacenter   string `json:"datacenter"`
+	Up           bool   `json:"up"`
+	Offline      bool   `json:"offline"`       // administratively down by SetOffline
+	CircuitOpen  bool   `json:"circuit_open"`  // reads are rejected by circuit breaker
+	HeartbeatLag int64  `json:"heartbeat_lag"` // milliseconds, -1 if it's not measured
+	Capacity     int64  `json:"capacity"`
+	Active       int64  `json:"active"`
+	InUse        int64  `json:"in_use"`
+	Idle         int64  `json:"idle"`
+	WaitCount    int64  `json:"wait_count"`
+}
+
+// GetBackendStatus return status of master, slaves and statistic slaves in slice
+func (s *Slice) GetBackendStatus() []*BackendStatus {
+	s.RLock()
+	defer s.RUnlock()
+	ret := make([]*BackendStatus, 0)
+	for _, db := range []struct {
+		role string
+		info *DBInfo
+	}{{RoleMaster, s.Master}, {RoleSlave, s.Slave}, {RoleStatisticSlave, s.StatisticSlave}} {
+		if db.info == nil {
+			continue
+		}
+		for i, cp := range db.info.ConnPool {
+			addr := cp.Addr()
+			status, _ := db.info.GetStatus(i)
+			lag, ok := s.GetHeartbeatLag(addr)
+			if !ok {
+				lag = -1
+			}
+			ret = append(ret, &BackendStatus{
+				Addr:         addr,
+				Role:         db.role,
+				Datacenter:   cp.Datacenter(),
+				Up:           status == StatusUp,
+				Offline:      db.role != RoleMaster && s.IsOffline(addr),
+				CircuitOpen:  s.IsCircuitOpen(addr),
+				HeartbeatLag: lag,
+				Capacity:     cp.Capacity(),
+				Active:       cp.Active(),
+				InUse:        cp.InUse(),
+				Idle:         cp.Idle(),
+				WaitCount:    cp.WaitCount(),
+			})
+		}
+	}
+	return ret
+}
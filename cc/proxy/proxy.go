@@ -93,6 +93,22 @@ func PrepareConfig(host, name string, cfg *models.CCConfig) error {
 	return nil
 }
 
+// PrepareCanaryConfig prepare phase of canary config change
+func PrepareCanaryConfig(host, name string, cfg *models.CCConfig) error {
+	c, err := newProxyClient(host, cfg.ProxyUserName, cfg.ProxyPassword)
+	if err != nil {
+		log.Warn("create proxy client failed, %v", err)
+		return err
+	}
+
+	err = c.PrepareCanaryConfig(name)
+	if err != nil {
+		log.Warn("prepare proxy canary config failed, %v", err)
+		return err
+	}
+	return nil
+}
+
 // CommitConfig commit phase of config change
 func CommitConfig(host, name string, cfg *models.CCConfig) error {
 	c, err := newProxyClient(host, cfg.ProxyUserName, cfg.ProxyPassword)
@@ -144,3 +160,12 @@ func QueryProxyConfigFingerprint(host string, cfg *models.CCConfig) (string, err
 	configFingerprint, err := c.proxyConfigFingerprint()
 	return configFingerprint, err
 }
+
+// QueryNamespaceVersions return config versions of namespaces loaded by proxy
+func QueryNamespaceVersions(host string, cfg *models.CCConfig) (map[string]string, error) {
+	c, err := newProxyClient(host, cfg.ProxyUserName, cfg.ProxyPassword)
+	if err != nil {
+		return nil, err
+	}
+	return c.namespaceVersions()
+}
@@ -16,6 +16,7 @@ package proxy
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/XiaoMi/Gaea/util/requests"
 )
@@ -38,6 +39,12 @@ func (c *APIClient) PrepareConfig(name string) error {
 	return requests.SendPut(url, c.user, c.password)
 }
 
+// PrepareCanaryConfig send prepare canary config
+func (c *APIClient) PrepareCanaryConfig(name string) error {
+	url := c.encodeURL("/api/proxy/config/prepare/%s", name) + "?canary=true"
+	return requests.SendPut(url, c.user, c.password)
+}
+
 // CommitConfig send commit config
 func (c *APIClient) CommitConfig(name string) error {
 	url := c.encodeURL("/api/proxy/config/commit/%s", name)
@@ -77,6 +84,23 @@ func (c *APIClient) proxyConfigFingerprint() (string, error) {
 	return r, err
 }
 
+func (c *APIClient) namespaceVersions() (map[string]string, error) {
+	r := make(map[string]string)
+	url := c.encodeURL("/api/proxy/config/versions")
+	resp, err := requests.SendGet(url, c.user, c.password)
+	if err != nil {
+		return nil, err
+	}
+	// resp is nil if status code is not 200, e.g. versions api is not supported by old proxy
+	if resp == nil {
+		return nil, fmt.Errorf("query namespace versions failed")
+	}
+	if err := json.Unmarshal(resp.Body, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // Ping ping proxy
 func (c *APIClient) Ping() error {
 	url := c.encodeURL("/api/proxy/ping")
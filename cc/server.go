@@ -19,6 +19,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -72,6 +73,12 @@ func (s *Server) registerURL() {
 	api.PUT("/namespace/delete/:name", s.delNamespace)
 	api.GET("/namespace/sqlfingerprint/:name", s.sqlFingerprint)
 	api.GET("/proxy/config/fingerprint", s.proxyConfigFingerprint)
+	api.GET("/proxy/list", s.listProxy)
+	api.PUT("/namespace/canary", s.canaryNamespace)
+	api.GET("/namespace/canary/:name", s.queryNamespaceCanary)
+	api.PUT("/namespace/canary/promote/:name", s.promoteNamespaceCanary)
+	api.PUT("/namespace/canary/rollback/:name", s.rollbackNamespaceCanary)
+	api.POST("/shard/simulate", s.simulateShard)
 }
 
 // ListNamespaceResp list names of all namespace response
@@ -318,9 +325,201 @@ func (s *Server) proxyConfigFingerprint(c *gin.Context) {
 	return
 }
 
+type listProxyResp struct {
+	RetHeader *RetHeader             `json:"ret_header"`
+	Data      *service.ClusterStatus `json:"data"`
+}
+
+// @Summary 获取集群proxy列表及配置一致性
+// @Description 获取集群名称, 返回注册的proxy及其加载的namespace配置版本, drifted为与配置中心不一致、未加载或已删除的namespace, 未传入为默认集群
+// @Produce  json
+// @Param cluster header string false "cluster name"
+// @Success 200 {object} listProxyResp
+// @Security BasicAuth
+// @Router /api/cc/proxy/list [get]
+func (s *Server) listProxy(c *gin.Context) {
+	var err error
+	r := &listProxyResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	r.Data, err = service.ProxyClusterStatus(s.cfg, cluster)
+	if err != nil {
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+	return
+}
+
+// CanaryReq canary namespace request
+type CanaryReq struct {
+	Namespace *models.Namespace `json:"namespace"`
+	Proxies   []string          `json:"proxies"` // token of proxy, i.e. ip:admin_port
+}
+
+// QueryNamespaceCanaryResp query namespace canary response
+type QueryNamespaceCanaryResp struct {
+	RetHeader *RetHeader              `json:"ret_header"`
+	Data      *models.NamespaceCanary `json:"data"`
+}
+
+// @Summary 灰度发布namespace配置
+// @Description 获取集群名称, 根据json body将namespace配置先发布到指定的proxy, 通过灰度proxy的监控验证后再全量发布或回滚, 未传入为默认集群
+// @Accept  json
+// @Produce  json
+// @Param cluster header string false "cluster name"
+// @Param canary body json true "{"namespace":{...},"proxies":["127.0.0.1:13307"]}"
+// @Success 200 {object} RetHeader
+// @Security BasicAuth
+// @Router /api/cc/namespace/canary [put]
+func (s *Server) canaryNamespace(c *gin.Context) {
+	var req CanaryReq
+	h := &RetHeader{RetCode: -1, RetMessage: ""}
+
+	if err := c.BindJSON(&req); err != nil {
+		log.Warn("canaryNamespace got invalid data, err: %v", err)
+		h.RetMessage = err.Error()
+		c.JSON(http.StatusBadRequest, h)
+		return
+	}
+	if req.Namespace == nil {
+		h.RetMessage = "missing namespace"
+		c.JSON(http.StatusBadRequest, h)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	if err := service.CanaryNamespace(req.Namespace, req.Proxies, s.cfg, cluster); err != nil {
+		log.Warn("canaryNamespace failed, err: %v", err)
+		h.RetMessage = err.Error()
+		c.JSON(http.StatusBadRequest, h)
+		return
+	}
+
+	h.RetCode = 0
+	h.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, h)
+}
+
+// @Summary 返回namespace灰度配置
+// @Description 获取集群名称, 返回指定namespace的灰度配置及灰度proxy, 没有灰度时data为空, 未传入为默认集群
+// @Produce  json
+// @Param cluster header string false "cluster name"
+// @Param name path string true "namespace name"
+// @Success 200 {object} QueryNamespaceCanaryResp
+// @Security BasicAuth
+// @Router /api/cc/namespace/canary/{name} [get]
+func (s *Server) queryNamespaceCanary(c *gin.Context) {
+	var err error
+	r := &QueryNamespaceCanaryResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		r.RetHeader.RetMessage = "input name is empty"
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	r.Data, err = service.QueryNamespaceCanary(name, s.cfg, cluster)
+	if err != nil {
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+}
+
+// @Summary 全量发布namespace灰度配置
+// @Description 获取集群名称, 将指定namespace的灰度配置发布到所有proxy, 未传入为默认集群
+// @Produce  json
+// @Param cluster header string false "cluster name"
+// @Param name path string true "namespace name"
+// @Success 200 {object} RetHeader
+// @Security BasicAuth
+// @Router /api/cc/namespace/canary/promote/{name} [put]
+func (s *Server) promoteNamespaceCanary(c *gin.Context) {
+	s.finishNamespaceCanary(c, service.PromoteNamespaceCanary)
+}
+
+// @Summary 回滚namespace灰度配置
+// @Description 获取集群名称, 灰度proxy恢复使用当前namespace配置, 未传入为默认集群
+// @Produce  json
+// @Param cluster header string false "cluster name"
+// @Param name path string true "namespace name"
+// @Success 200 {object} RetHeader
+// @Security BasicAuth
+// @Router /api/cc/namespace/canary/rollback/{name} [put]
+func (s *Server) rollbackNamespaceCanary(c *gin.Context) {
+	s.finishNamespaceCanary(c, service.RollbackNamespaceCanary)
+}
+
+func (s *Server) finishNamespaceCanary(c *gin.Context, finish func(name string, cfg *models.CCConfig, cluster string) error) {
+	h := &RetHeader{RetCode: -1, RetMessage: ""}
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		h.RetMessage = "input name is empty"
+		c.JSON(http.StatusOK, h)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	if err := finish(name, s.cfg, cluster); err != nil {
+		log.Warn("finish canary of namespace %s failed, err: %v", name, err)
+		h.RetMessage = err.Error()
+		c.JSON(http.StatusOK, h)
+		return
+	}
+
+	h.RetCode = 0
+	h.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, h)
+}
+
+// ShardSimulateResp route result of shard rule simulation
+type ShardSimulateResp struct {
+	RetHeader *RetHeader                   `json:"ret_header"`
+	Data      *service.ShardSimulateResult `json:"data"`
+}
+
+// @Summary 模拟分片规则路由
+// @Description 根据请求中的分片规则计算分片键值和SQL路由到的slice、物理库和物理表, 不保存规则, 用于上线前校验规则
+// @Produce  json
+// @Param simulate body json true "{"rule":{...},"keys":[1,"2021-01-01"],"sql":"select * from tbl where id = 1"}"
+// @Success 200 {object} ShardSimulateResp
+// @Security BasicAuth
+// @Router /api/cc/shard/simulate [post]
+func (s *Server) simulateShard(c *gin.Context) {
+	var err error
+	var req service.ShardSimulateReq
+	r := &ShardSimulateResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+
+	if err = c.BindJSON(&req); err != nil {
+		log.Warn("simulateShard got invalid data, err: %v", err)
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusBadRequest, r)
+		return
+	}
+	r.Data, err = service.SimulateShard(&req)
+	if err != nil {
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusBadRequest, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+}
+
 func (s *Server) Run() {
 	defer s.listener.Close()
 
+	done := make(chan struct{})
+	defer close(done)
+	if s.cfg.DriftCheckInterval > 0 {
+		go s.checkDrift(time.Duration(s.cfg.DriftCheckInterval)*time.Second, done)
+	}
+
 	errC := make(chan error)
 
 	go func(l net.Listener) {
@@ -345,3 +544,39 @@ func (s *Server) Close() {
 	s.exitC <- struct{}{}
 	return
 }
+
+// checkDrift check config of proxies in default cluster periodically, namespaces of proxies which are
+// different from store in two checks in a row are logged, so that stuck reloading is found quickly
+func (s *Server) checkDrift(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := make(map[string]bool) // key: token/namespace drifted in last check
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		status, err := service.ProxyClusterStatus(s.cfg, s.cfg.DefaultCluster)
+		if err != nil {
+			log.Warn("check config drift of cluster %s failed, %v", s.cfg.DefaultCluster, err)
+			continue
+		}
+		current := make(map[string]bool)
+		for _, p := range status.Proxies {
+			if p.Error != "" {
+				log.Warn("check config drift of proxy %s failed, %s", p.Token, p.Error)
+				continue
+			}
+			for _, name := range p.Drifted {
+				key := p.Token + "/" + name
+				if last[key] {
+					log.Warn("config of namespace %s in proxy %s is different from store, version: %s, version in store: %s",
+						name, p.Token, p.Versions[name], status.Namespaces[name])
+				}
+				current[key] = true
+			}
+		}
+		last = current
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/XiaoMi/Gaea/cc/proxy"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	etcdclient "github.com/XiaoMi/Gaea/models/etcd"
+)
+
+// CanaryNamespace apply namespace config to canary proxies only, other proxies keep the current config
+// until the canary is promoted. Canary config is rolled back on canary proxies if it fails to apply.
+func CanaryNamespace(namespace *models.Namespace, proxies []string, cfg *models.CCConfig, cluster string) (err error) {
+	if len(proxies) == 0 {
+		return fmt.Errorf("missing canary proxies")
+	}
+	if err = namespace.Verify(); err != nil {
+		return fmt.Errorf("verify namespace error: %v", err)
+	}
+	if err = namespace.Encrypt(cfg.EncryptKey); err != nil {
+		return fmt.Errorf("encrypt namespace error: %v", err)
+	}
+
+	client := models.NewClient(cfg.CoordinatorType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := models.NewStore(client)
+	defer storeConn.Close()
+
+	if err = checkForDuplicateUsernameAndPassword(cfg.EncryptKey, storeConn, *namespace); err != nil {
+		return fmt.Errorf("duplicate username and password in another namespace: %v", err)
+	}
+
+	if err = checkNoCanary(storeConn, cfg, namespace.Name); err != nil {
+		return err
+	}
+
+	allProxies, err := storeConn.ListProxyMonitorMetrics()
+	if err != nil {
+		log.Warn("list proxies failed, %v", err)
+		return err
+	}
+	canaryProxies := make(map[string]*models.ProxyMonitorMetric, len(proxies))
+	for _, token := range proxies {
+		p, ok := allProxies[token]
+		if !ok {
+			return fmt.Errorf("canary proxy %s not found", token)
+		}
+		canaryProxies[token] = p
+	}
+
+	canary := &models.NamespaceCanary{
+		Namespace:  namespace,
+		Proxies:    proxies,
+		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err = storeConn.UpdateNamespaceCanary(canary); err != nil {
+		log.Warn("update namespace canary failed, %s", namespace.Name)
+		return err
+	}
+
+	if err = reloadProxies(canaryProxies, namespace.Name, cfg, true); err != nil {
+		if err2 := rollbackCanaryProxies(canaryProxies, namespace.Name, cfg, storeConn); err2 != nil {
+			return fmt.Errorf("%s, rollback error:%s", err, err2)
+		}
+		return fmt.Errorf("%s, rollback success", err)
+	}
+	log.Notice("canary namespace %s on proxies %v", namespace.Name, proxies)
+	return nil
+}
+
+// checkNoCanary return error if canary of namespace is in progress, config of namespace in canary
+// is changed only by promoting or rolling back the canary, so that canary config isn't lost or mixed in
+func checkNoCanary(storeConn *models.Store, cfg *models.CCConfig, name string) error {
+	canary, err := storeConn.LoadNamespaceCanary(cfg.EncryptKey, name)
+	if err != nil {
+		return err
+	}
+	if canary != nil {
+		return fmt.Errorf("canary of namespace %s is in progress, promote or rollback it first", name)
+	}
+	return nil
+}
+
+// QueryNamespaceCanary return canary of namespace, nil if there is no canary
+func QueryNamespaceCanary(name string, cfg *models.CCConfig, cluster string) (*models.NamespaceCanary, error) {
+	client := models.NewClient(cfg.CoordinatorType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := models.NewStore(client)
+	defer storeConn.Close()
+	return storeConn.LoadNamespaceCanary(cfg.EncryptKey, name)
+}
+
+// PromoteNamespaceCanary apply canary config of namespace to all proxies
+func PromoteNamespaceCanary(name string, cfg *models.CCConfig, cluster string) error {
+	client := models.NewClient(cfg.CoordinatorType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := models.NewStore(client)
+	defer storeConn.Close()
+
+	canary, err := storeConn.LoadNamespaceCanary(cfg.EncryptKey, name)
+	if err != nil {
+		return err
+	}
+	if canary == nil {
+		return fmt.Errorf("canary of namespace %s not found", name)
+	}
+
+	if err = modifyNamespace(canary.Namespace, cfg, cluster, true); err != nil {
+		return fmt.Errorf("promote canary error: %v", err)
+	}
+	if err = storeConn.DelNamespaceCanary(name); err != nil {
+		log.Warn("delete namespace canary %s failed, %v", name, err)
+		return err
+	}
+	log.Notice("promote canary of namespace %s", name)
+	return nil
+}
+
+// RollbackNamespaceCanary restore current config of namespace on canary proxies
+func RollbackNamespaceCanary(name string, cfg *models.CCConfig, cluster string) error {
+	client := models.NewClient(cfg.CoordinatorType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := models.NewStore(client)
+	defer storeConn.Close()
+
+	canary, err := storeConn.LoadNamespaceCanary(cfg.EncryptKey, name)
+	if err != nil {
+		return err
+	}
+	if canary == nil {
+		return fmt.Errorf("canary of namespace %s not found", name)
+	}
+
+	allProxies, err := storeConn.ListProxyMonitorMetrics()
+	if err != nil {
+		log.Warn("list proxies failed, %v", err)
+		return err
+	}
+	// canary proxies which are gone will load current config when they start again
+	canaryProxies := make(map[string]*models.ProxyMonitorMetric, len(canary.Proxies))
+	for _, token := range canary.Proxies {
+		if p, ok := allProxies[token]; ok {
+			canaryProxies[token] = p
+		}
+	}
+
+	if err = rollbackCanaryProxies(canaryProxies, name, cfg, storeConn); err != nil {
+		return err
+	}
+	log.Notice("rollback canary of namespace %s", name)
+	return nil
+}
+
+// rollbackCanaryProxies make canary proxies reload current config of namespace and delete canary,
+// namespace is deleted on canary proxies if it's a new namespace.
+func rollbackCanaryProxies(proxies map[string]*models.ProxyMonitorMetric, name string, cfg *models.CCConfig, storeConn *models.Store) error {
+	_, err := storeConn.LoadNamespace(cfg.EncryptKey, name)
+	if err != nil && !etcdclient.IsErrNoNode(err) {
+		return err
+	}
+
+	if err == nil {
+		err = reloadProxies(proxies, name, cfg, false)
+	} else {
+		err = nil
+		for _, v := range proxies {
+			if err = proxy.DelNamespace(v.IP+":"+v.AdminPort, name, cfg); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("rollback canary proxies error: %v", err)
+	}
+
+	if err = storeConn.DelNamespaceCanary(name); err != nil {
+		log.Warn("delete namespace canary %s failed, %v", name, err)
+		return err
+	}
+	return nil
+}
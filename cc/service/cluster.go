@@ -0,0 +1,174 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/cc/proxy"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// ClusterStatus registered proxies of cluster and config versions of namespaces in store
+type ClusterStatus struct {
+	Namespaces map[string]string `json:"namespaces"` // key: namespace name, value: config version in store
+	Canaries   map[string]string `json:"canaries"`   // key: namespace name, value: config version of canary
+	Proxies    []*ProxyStatus    `json:"proxies"`
+}
+
+// ProxyStatus registered proxy and config versions of namespaces loaded by it
+type ProxyStatus struct {
+	Token     string            `json:"token"`
+	IP        string            `json:"ip"`
+	ProxyPort string            `json:"proxy_port"`
+	AdminPort string            `json:"admin_port"`
+	StartTime string            `json:"start_time"`
+	Versions  map[string]string `json:"versions"` // key: namespace name, value: config version
+	Drifted   []string          `json:"drifted"`  // namespaces whose version is different from store, not loaded or deleted
+	Error     string            `json:"error"`    // error of querying versions from proxy
+}
+
+// namespaceCanary version and proxies of canary config, proxies is empty if namespace has no canary
+type namespaceCanary struct {
+	version string
+	proxies map[string]bool
+}
+
+// ProxyClusterStatus list registered proxies of cluster, namespaces of proxies whose config differs from store are flagged
+func ProxyClusterStatus(cfg *models.CCConfig, cluster string) (*ClusterStatus, error) {
+	client := models.NewClient(cfg.CoordinatorType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	mConn := models.NewStore(client)
+	defer mConn.Close()
+
+	names, err := mConn.ListNamespace()
+	if err != nil {
+		log.Warn("list namespace failed, %v", err)
+		return nil, err
+	}
+	status := &ClusterStatus{
+		Namespaces: make(map[string]string, len(names)),
+		Canaries:   make(map[string]string),
+		Proxies:    make([]*ProxyStatus, 0),
+	}
+	canaries := make(map[string]*namespaceCanary)
+	for _, name := range names {
+		namespace, err := mConn.LoadNamespace(cfg.EncryptKey, name)
+		if err != nil {
+			log.Warn("load namespace %s failed, %v", name, err)
+			return nil, err
+		}
+		status.Namespaces[name] = namespace.Version()
+	}
+	// canary of new namespace is not in namespace list, so canaries of all namespaces loaded by proxies are checked
+	loadCanary := func(name string) error {
+		if _, ok := canaries[name]; ok {
+			return nil
+		}
+		canary, err := mConn.LoadNamespaceCanary(cfg.EncryptKey, name)
+		if err != nil {
+			log.Warn("load canary of namespace %s failed, %v", name, err)
+			return err
+		}
+		c := &namespaceCanary{proxies: make(map[string]bool)}
+		if canary != nil {
+			c.version = canary.Namespace.Version()
+			for _, token := range canary.Proxies {
+				c.proxies[token] = true
+			}
+			status.Canaries[name] = c.version
+		}
+		canaries[name] = c
+		return nil
+	}
+
+	proxies, err := mConn.ListProxyMonitorMetrics()
+	if err != nil {
+		log.Warn("list proxy failed, %v", err)
+		return nil, err
+	}
+	wg := new(sync.WaitGroup)
+	respC := make(chan *ProxyStatus, len(proxies))
+	for _, p := range proxies {
+		wg.Add(1)
+		go func(p *models.ProxyMonitorMetric) {
+			defer wg.Done()
+			s := &ProxyStatus{Token: p.Token, IP: p.IP, ProxyPort: p.ProxyPort, AdminPort: p.AdminPort, StartTime: p.StartTime}
+			versions, err := proxy.QueryNamespaceVersions(p.IP+":"+p.AdminPort, cfg)
+			if err != nil {
+				log.Warn("query namespace versions of proxy failed, %s %v", p.Token, err)
+				s.Error = err.Error()
+			} else {
+				s.Versions = versions
+			}
+			respC <- s
+		}(p)
+	}
+	wg.Wait()
+	close(respC)
+
+	for s := range respC {
+		status.Proxies = append(status.Proxies, s)
+	}
+	for name := range status.Namespaces {
+		if err := loadCanary(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range status.Proxies {
+		if s.Error != "" {
+			continue
+		}
+		for name := range s.Versions {
+			if err := loadCanary(name); err != nil {
+				return nil, err
+			}
+		}
+		s.Drifted = driftedNamespaces(s.Token, s.Versions, status.Namespaces, canaries)
+	}
+	sort.Slice(status.Proxies, func(i, j int) bool {
+		return status.Proxies[i].Token < status.Proxies[j].Token
+	})
+	return status, nil
+}
+
+// driftedNamespaces return sorted names of namespaces loaded by proxy which are different from expected versions,
+// canary version is expected if proxy is one of canary proxies of namespace
+func driftedNamespaces(token string, loaded, expected map[string]string, canaries map[string]*namespaceCanary) []string {
+	versions := make(map[string]string, len(expected))
+	for name, version := range expected {
+		versions[name] = version
+	}
+	for name, c := range canaries {
+		if c.proxies[token] {
+			versions[name] = c.version
+		}
+	}
+
+	drifted := make([]string, 0)
+	for name, version := range versions {
+		if loaded[name] != version {
+			drifted = append(drifted, name)
+		}
+	}
+	for name := range loaded {
+		if _, ok := versions[name]; !ok {
+			drifted = append(drifted, name)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
@@ -65,8 +65,13 @@ func QueryNamespace(names []string, cfg *models.CCConfig, cluster string) (data
 	return data, nil
 }
 
-// ModifyNamespace create or modify namespace
-func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster string) (err error) {
+// ModifyNamespace create or modify namespace, it's rejected if canary of namespace is in progress
+func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster string) error {
+	return modifyNamespace(namespace, cfg, cluster, false)
+}
+
+// modifyNamespace create or modify namespace, canary of namespace is checked unless it's promoted
+func modifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster string, promote bool) (err error) {
 	if err = namespace.Verify(); err != nil {
 		return fmt.Errorf("verify namespace error: %v", err)
 	}
@@ -81,6 +86,12 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 	storeConn := models.NewStore(client)
 	defer storeConn.Close()
 
+	if !promote {
+		if err = checkNoCanary(storeConn, cfg, namespace.Name); err != nil {
+			return err
+		}
+	}
+
 	if err = checkForDuplicateUsernameAndPassword(cfg.EncryptKey, storeConn, *namespace); err != nil {
 		return fmt.Errorf("duplicate username and password in another namespace: %v", err)
 	}
@@ -102,6 +113,18 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 		return err
 	}
 
+	if err = reloadProxies(proxies, namespace.Name, cfg, false); err != nil {
+		if err2 := rollbackNamespace(existNamespace, namespace, cfg, storeConn); err2 != nil {
+			return fmt.Errorf("%s, rollback error:%s", err, err2)
+		}
+		return fmt.Errorf("%s, rollback success", err)
+	}
+
+	return nil
+}
+
+// reloadProxies make proxies reload namespace config by two phase commit, canary config is used if canary is true
+func reloadProxies(proxies map[string]*models.ProxyMonitorMetric, name string, cfg *models.CCConfig, canary bool) error {
 	wg := sync.WaitGroup{}
 	prepareErrs := make(chan error, len(proxies))
 	commitErrs := make(chan error, len(proxies))
@@ -112,10 +135,15 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 			defer wg.Done()
 			var err error
 			for i := 0; i < PREPARE_RETRY_TIMES; i++ {
-				if err = proxy.PrepareConfig(v.IP+":"+v.AdminPort, namespace.Name, cfg); err == nil {
+				if canary {
+					err = proxy.PrepareCanaryConfig(v.IP+":"+v.AdminPort, name, cfg)
+				} else {
+					err = proxy.PrepareConfig(v.IP+":"+v.AdminPort, name, cfg)
+				}
+				if err == nil {
 					break
 				}
-				log.Warn("namespace %s, proxy prepare retry %d", namespace.Name, i)
+				log.Warn("namespace %s, proxy prepare retry %d", name, i)
 			}
 			prepareErrs <- err
 		}(v)
@@ -123,13 +151,9 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 	wg.Wait()
 	close(prepareErrs)
 
-	// check prepare res and rollback
 	for err := range prepareErrs {
 		if err != nil {
-			if err2 := rollbackNamespace(existNamespace, namespace, cfg, storeConn); err2 != nil {
-				return fmt.Errorf("prepareConfig error:%s, rollback error:%s", err, err2)
-			}
-			return fmt.Errorf("prepareConfig error:%s, rollback success", err)
+			return fmt.Errorf("prepareConfig error:%s", err)
 		}
 	}
 
@@ -140,10 +164,10 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 			defer wg.Done()
 			var err error
 			for i := 0; i < COMMIT_RETRY_TIMES; i++ {
-				if err = proxy.CommitConfig(v.IP+":"+v.AdminPort, namespace.Name, cfg); err == nil {
+				if err = proxy.CommitConfig(v.IP+":"+v.AdminPort, name, cfg); err == nil {
 					break
 				}
-				log.Warn("namespace %s, proxy prepare retry %d", namespace.Name, i)
+				log.Warn("namespace %s, proxy prepare retry %d", name, i)
 			}
 			commitErrs <- err
 		}(v)
@@ -151,16 +175,11 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 	wg.Wait()
 	close(commitErrs)
 
-	// check commit res and rollback
 	for err := range commitErrs {
 		if err != nil {
-			if err2 := rollbackNamespace(existNamespace, namespace, cfg, storeConn); err2 != nil {
-				return fmt.Errorf("commitConfig error:%s, rollback error:%s", err, err2)
-			}
-			return fmt.Errorf("commitConfig error:%s, rollback success", err)
+			return fmt.Errorf("commitConfig error:%s", err)
 		}
 	}
-
 	return nil
 }
 
@@ -170,6 +189,9 @@ func DelNamespace(name string, cfg *models.CCConfig, cluster string) error {
 	mConn := models.NewStore(client)
 	defer mConn.Close()
 
+	if err := checkNoCanary(mConn, cfg, name); err != nil {
+		return err
+	}
 	if err := mConn.DelNamespace(name); err != nil {
 		log.Warn("delete namespace %s failed, %s", name, err.Error())
 		return err
@@ -0,0 +1,176 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+)
+
+// ShardSimulateReq shard rule and key values or sql to route by it
+type ShardSimulateReq struct {
+	Rule *models.Shard     `json:"rule"`
+	Keys []json.RawMessage `json:"keys"` // values of sharding column, numbers or strings
+	SQL  string            `json:"sql"`  // sql in db of rule, tables without rule are routed to the first slice of rule
+}
+
+// ShardSimulateResult routes of key values and sql
+type ShardSimulateResult struct {
+	Keys []*KeyRoute `json:"keys"`
+	SQL  *SQLRoute   `json:"sql,omitempty"`
+}
+
+// KeyRoute sub table which a key value is routed to
+type KeyRoute struct {
+	Key   interface{} `json:"key"`
+	Slice string      `json:"slice"`
+	DB    string      `json:"db"`
+	Table string      `json:"table"`
+	Error string      `json:"error,omitempty"`
+}
+
+// SQLRoute sqls sent to backends
+type SQLRoute struct {
+	ShardType string           `json:"shard_type"` // shard or unshard
+	SQLs      []*SliceSQLRoute `json:"sqls"`
+}
+
+// SliceSQLRoute sql sent to db of slice
+type SliceSQLRoute struct {
+	Slice string `json:"slice"`
+	DB    string `json:"db"`
+	SQL   string `json:"sql"`
+}
+
+// SimulateShard route key values and sql by shard rule without saving it, so that rules can be checked before deployment
+func SimulateShard(req *ShardSimulateReq) (*ShardSimulateResult, error) {
+	if req.Rule == nil {
+		return nil, fmt.Errorf("missing shard rule")
+	}
+	if req.Rule.Type == models.ShardLinked {
+		return nil, fmt.Errorf("linked rule can't be simulated, use rule of parent table instead")
+	}
+	if len(req.Rule.Slices) == 0 {
+		return nil, fmt.Errorf("missing slices of shard rule")
+	}
+	namespace := &models.Namespace{DefaultSlice: req.Rule.Slices[0], ShardRules: []*models.Shard{req.Rule}}
+	for _, s := range req.Rule.Slices {
+		namespace.Slices = append(namespace.Slices, &models.Slice{Name: s})
+	}
+	rt, err := router.NewRouter(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard rule: %v", err)
+	}
+	rule := rt.GetRule(req.Rule.DB, strings.ToLower(req.Rule.Table))
+
+	ret := &ShardSimulateResult{Keys: make([]*KeyRoute, 0, len(req.Keys))}
+	for _, k := range req.Keys {
+		key, err := parseShardKey(k)
+		if err != nil {
+			return nil, err
+		}
+		ret.Keys = append(ret.Keys, routeShardKey(rule, key))
+	}
+	if req.SQL != "" {
+		if ret.SQL, err = routeShardSQL(rt, req.Rule.DB, req.SQL); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// parseShardKey return int64 or uint64 for numbers and string for strings, the same as values parsed from sql
+func parseShardKey(data json.RawMessage) (interface{}, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if v, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.ParseUint(string(data), 10, 64); err == nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid key: %s, should be integer or string", data)
+}
+
+func routeShardKey(rule router.Rule, key interface{}) *KeyRoute {
+	r := &KeyRoute{Key: key}
+	index, err := rule.FindTableIndex(key)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	sliceIndex := rule.GetSliceIndexFromTableIndex(index)
+	if sliceIndex < 0 {
+		r.Error = fmt.Sprintf("sub table %d is not in rule", index)
+		return r
+	}
+	if r.DB, err = rule.GetDatabaseNameByTableIndex(index); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Slice = rule.GetSlice(sliceIndex)
+	r.Table = rule.GetTable()
+	if rule.GetType() != router.GlobalTableRuleType && !router.IsMycatShardingRule(rule.GetType()) {
+		r.Table = fmt.Sprintf("%s_%04d", rule.GetTable(), index)
+	}
+	return r
+}
+
+func routeShardSQL(rt *router.Router, db, sql string) (*SQLRoute, error) {
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("parse sql error: %v", err)
+	}
+	p, err := plan.BuildPlan(stmt, map[string]string{db: db}, db, sql, rt, sequence.NewSequenceManager(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build plan error: %v", err)
+	}
+	shardType, sqls, err := plan.GetShardSQLs(p, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SQLRoute{ShardType: shardType, SQLs: make([]*SliceSQLRoute, 0)}
+	for slice, dbSQLs := range sqls {
+		for db, s := range dbSQLs {
+			for _, sql := range s {
+				r.SQLs = append(r.SQLs, &SliceSQLRoute{Slice: slice, DB: db, SQL: sql})
+			}
+		}
+	}
+	sort.SliceStable(r.SQLs, func(i, j int) bool {
+		if r.SQLs[i].Slice != r.SQLs[j].Slice {
+			return r.SQLs[i].Slice < r.SQLs[j].Slice
+		}
+		return r.SQLs[i].DB < r.SQLs[j].DB
+	})
+	return r, nil
+}
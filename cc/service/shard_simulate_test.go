@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func TestSimulateShard(t *testing.T) {
+	req := &ShardSimulateReq{
+		Rule: &models.Shard{DB: "db", Table: "tbl", Type: models.ShardHash, Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		Keys: []json.RawMessage{json.RawMessage(`5`), json.RawMessage(`"6"`)},
+		SQL:  "select * from tbl where id in (1, 2)",
+	}
+	ret, err := SimulateShard(req)
+	require.NoError(t, err)
+	require.Equal(t, []*KeyRoute{
+		{Key: int64(5), Slice: "slice-0", DB: "db", Table: "tbl_0001"},
+		{Key: "6", Slice: "slice-1", DB: "db", Table: "tbl_0002"},
+	}, ret.Keys)
+	require.Equal(t, &SQLRoute{ShardType: "shard", SQLs: []*SliceSQLRoute{
+		{Slice: "slice-0", DB: "db", SQL: "SELECT * FROM `tbl_0001` WHERE `id` IN (1)"},
+		{Slice: "slice-1", DB: "db", SQL: "SELECT * FROM `tbl_0002` WHERE `id` IN (2)"},
+	}}, ret.SQL)
+
+	req = &ShardSimulateReq{
+		Rule: &models.Shard{DB: "db", Table: "tbl", Type: models.ShardMonth, Key: "create_time", Slices: []string{"slice-0"}, DateRange: []string{"202101-202106"}},
+		Keys: []json.RawMessage{json.RawMessage(`"2021-03-01 10:00:00"`), json.RawMessage(`"2021-07-01"`), json.RawMessage(`1.5`)},
+		SQL:  "select * from other",
+	}
+	_, err = SimulateShard(req)
+	require.Error(t, err)
+
+	req.Keys = req.Keys[:2]
+	ret, err = SimulateShard(req)
+	require.NoError(t, err)
+	require.Equal(t, &KeyRoute{Key: "2021-03-01 10:00:00", Slice: "slice-0", DB: "db", Table: "tbl_202103"}, ret.Keys[0])
+	require.NotEmpty(t, ret.Keys[1].Error)
+	require.Equal(t, &SQLRoute{ShardType: "unshard", SQLs: []*SliceSQLRoute{{Slice: "slice-0", DB: "db", SQL: "SELECT * FROM `other`"}}}, ret.SQL)
+
+	req.Rule.Slices = []string{"slice-0", "slice-1"}
+	_, err = SimulateShard(req)
+	require.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gaea-bench runs point-select, read-write or scatter workload against gaea or mysql,
+// reports throughput and latency, and compares them with a stored baseline to find regression.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+var addr = flag.String("addr", "127.0.0.1:13306", "address of target")
+var user = flag.String("user", "gaea_user", "user of target")
+var password = flag.String("password", "gaea_pass", "password of target")
+var db = flag.String("db", "db_bench", "database of bench table")
+var table = flag.String("table", "tbl_bench", "bench table, should be a sharding table for scatter workload")
+var workloadName = flag.String("workload", workloadPointSelect, "workload, point-select, read-write or scatter")
+var threads = flag.Int("threads", 8, "number of concurrent connections")
+var duration = flag.Duration("duration", 30*time.Second, "duration of bench")
+var rows = flag.Int("rows", 10000, "number of rows in bench table")
+var prepare = flag.Bool("prepare", false, "create bench table and insert rows before bench")
+var baselineFile = flag.String("baseline", "", "baseline file, result is compared with it if specified")
+var saveBaseline = flag.Bool("save-baseline", false, "save result to baseline file instead of comparing")
+var maxRegression = flag.Float64("max-regression", 10, "max regression percent of qps and p99 latency compared with baseline")
+
+func connect() (*backend.DirectConnection, error) {
+	return backend.NewDirectConnection(*addr, *user, *password, *db, mysql.DefaultCharset, mysql.DefaultCollationID, 0)
+}
+
+// run execute workload in threads until duration passed
+func run(w *workload) (*result, error) {
+	conns := make([]*backend.DirectConnection, 0, *threads)
+	for i := 0; i < *threads; i++ {
+		conn, err := connect()
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, fmt.Errorf("connect to %s failed: %v", *addr, err)
+		}
+		conns = append(conns, conn)
+	}
+
+	recorders := make([]*recorder, len(conns))
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(*duration)
+	start := time.Now()
+	for i, conn := range conns {
+		recorders[i] = newRecorder()
+		wg.Add(1)
+		go func(conn *backend.DirectConnection, r *recorder, seed int64) {
+			defer wg.Done()
+			w.run(conn, r, seed, deadline)
+		}(conn, recorders[i], int64(i))
+	}
+	wg.Wait()
+	return summarize(w.name, recorders, time.Since(start)), nil
+}
+
+func main() {
+	flag.Parse()
+	w, err := newWorkload(*workloadName, *table, *rows)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *threads <= 0 || *rows <= 0 {
+		fmt.Println("threads and rows should be > 0")
+		os.Exit(1)
+	}
+	if *saveBaseline && *baselineFile == "" {
+		fmt.Println("baseline file must be specified by -baseline when -save-baseline is set")
+		os.Exit(1)
+	}
+
+	if *prepare {
+		conn, err := connect()
+		if err != nil {
+			fmt.Printf("connect to %s failed: %v\n", *addr, err)
+			os.Exit(1)
+		}
+		err = w.prepare(conn)
+		conn.Close()
+		if err != nil {
+			fmt.Printf("prepare bench table failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	res, err := run(w)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	res.print()
+
+	if *baselineFile == "" {
+		return
+	}
+	if *saveBaseline {
+		if err = saveResult(*baselineFile, res); err != nil {
+			fmt.Printf("save baseline failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	baseline, err := loadBaseline(*baselineFile, w.name)
+	if err != nil {
+		fmt.Printf("load baseline failed: %v\n", err)
+		os.Exit(1)
+	}
+	if regressions := compare(baseline, res, *maxRegression); len(regressions) != 0 {
+		for _, r := range regressions {
+			fmt.Println(r)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("no regression compared with baseline")
+}
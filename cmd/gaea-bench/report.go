@@ -0,0 +1,157 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// recorder record latency of one thread, it's not safe for concurrent use
+type recorder struct {
+	latencies []time.Duration
+	errors    int
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: make([]time.Duration, 0, 1024)}
+}
+
+func (r *recorder) record(latency time.Duration, err error) {
+	if err != nil {
+		r.errors++
+		return
+	}
+	r.latencies = append(r.latencies, latency)
+}
+
+// result of a bench, it's also the format of baseline
+type result struct {
+	Workload string  `json:"workload"`
+	Threads  int     `json:"threads"`
+	Count    int     `json:"count"`
+	Errors   int     `json:"errors"`
+	QPS      float64 `json:"qps"`
+	AvgMs    float64 `json:"avg_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+func summarize(workload string, recorders []*recorder, elapsed time.Duration) *result {
+	res := &result{Workload: workload, Threads: len(recorders)}
+	var latencies []time.Duration
+	for _, r := range recorders {
+		latencies = append(latencies, r.latencies...)
+		res.Errors += r.errors
+	}
+	res.Count = len(latencies)
+	if res.Count == 0 {
+		return res
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	res.QPS = float64(res.Count) / elapsed.Seconds()
+	res.AvgMs = durationMs(total / time.Duration(res.Count))
+	res.P95Ms = durationMs(percentile(latencies, 95))
+	res.P99Ms = durationMs(percentile(latencies, 99))
+	return res
+}
+
+// percentile return the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (r *result) print() {
+	fmt.Printf("workload: %s, threads: %d, count: %d, errors: %d\n", r.Workload, r.Threads, r.Count, r.Errors)
+	fmt.Printf("qps: %.2f, avg latency: %.3fms, p95 latency: %.3fms, p99 latency: %.3fms\n", r.QPS, r.AvgMs, r.P95Ms, r.P99Ms)
+}
+
+// readBaseline read results of all workloads in baseline file, key is workload name
+func readBaseline(file string) (map[string]*result, error) {
+	baseline := make(map[string]*result)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return baseline, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline file %s: %v", file, err)
+	}
+	return baseline, nil
+}
+
+// saveResult save result of the workload to baseline file, results of other workloads are kept
+func saveResult(file string, res *result) error {
+	baseline, err := readBaseline(file)
+	if err != nil {
+		return err
+	}
+	baseline[res.Workload] = res
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+func loadBaseline(file string, workload string) (*result, error) {
+	baseline, err := readBaseline(file)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := baseline[workload]
+	if !ok {
+		return nil, fmt.Errorf("workload %s not found in baseline file %s", workload, file)
+	}
+	return res, nil
+}
+
+// compare return regressions of result compared with baseline, qps drop or p99 latency rise more than
+// maxRegression percent is a regression, so is error in result.
+func compare(baseline *result, res *result, maxRegression float64) []string {
+	var regressions []string
+	if res.Errors > 0 {
+		regressions = append(regressions, fmt.Sprintf("%d errors in bench", res.Errors))
+	}
+	if baseline.QPS > 0 {
+		if drop := (baseline.QPS - res.QPS) / baseline.QPS * 100; drop > maxRegression {
+			regressions = append(regressions, fmt.Sprintf("qps drops %.2f%%, baseline: %.2f, current: %.2f", drop, baseline.QPS, res.QPS))
+		}
+	}
+	if baseline.P99Ms > 0 {
+		if rise := (res.P99Ms - baseline.P99Ms) / baseline.P99Ms * 100; rise > maxRegression {
+			regressions = append(regressions, fmt.Sprintf("p99 latency rises %.2f%%, baseline: %.3fms, current: %.3fms", rise, baseline.P99Ms, res.P99Ms))
+		}
+	}
+	return regressions
+}
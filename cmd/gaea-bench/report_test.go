@@ -0,0 +1,68 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	r1, r2 := newRecorder(), newRecorder()
+	for i := 1; i <= 100; i++ {
+		r := r1
+		if i%2 == 0 {
+			r = r2
+		}
+		r.record(time.Duration(i)*time.Millisecond, nil)
+	}
+	r2.record(time.Second, errors.New("failed"))
+
+	res := summarize(workloadPointSelect, []*recorder{r1, r2}, 2*time.Second)
+	require.Equal(t, 2, res.Threads)
+	require.Equal(t, 100, res.Count)
+	require.Equal(t, 1, res.Errors)
+	require.Equal(t, float64(50), res.QPS)
+	require.Equal(t, 50.5, res.AvgMs)
+	require.Equal(t, float64(95), res.P95Ms)
+	require.Equal(t, float64(99), res.P99Ms)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &result{QPS: 1000, P99Ms: 10}
+	require.Empty(t, compare(baseline, &result{QPS: 950, P99Ms: 10.5}, 10))
+	require.Len(t, compare(baseline, &result{QPS: 800, P99Ms: 10}, 10), 1)
+	require.Len(t, compare(baseline, &result{QPS: 1000, P99Ms: 12}, 10), 1)
+	require.Len(t, compare(baseline, &result{QPS: 800, P99Ms: 12, Errors: 1}, 10), 3)
+}
+
+func TestBaseline(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "baseline.json")
+	_, err := loadBaseline(file, workloadPointSelect)
+	require.Error(t, err)
+
+	require.NoError(t, saveResult(file, &result{Workload: workloadPointSelect, QPS: 1000}))
+	require.NoError(t, saveResult(file, &result{Workload: workloadScatter, QPS: 100}))
+	res, err := loadBaseline(file, workloadPointSelect)
+	require.NoError(t, err)
+	require.Equal(t, float64(1000), res.QPS)
+	res, err = loadBaseline(file, workloadScatter)
+	require.NoError(t, err)
+	require.Equal(t, float64(100), res.QPS)
+}
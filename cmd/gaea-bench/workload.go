@@ -0,0 +1,139 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+)
+
+const (
+	workloadPointSelect = "point-select"
+	workloadReadWrite   = "read-write"
+	workloadScatter     = "scatter"
+
+	// insertBatch is rows inserted by one statement in prepare
+	insertBatch = 500
+	// kRange is range of column k, scatter workload selects rows by k on all shards
+	kRange = 100
+)
+
+// workload generate statements of one transaction or query
+type workload struct {
+	name  string
+	table string
+	rows  int
+}
+
+func newWorkload(name string, table string, rows int) (*workload, error) {
+	switch name {
+	case workloadPointSelect, workloadReadWrite, workloadScatter:
+		return &workload{name: name, table: table, rows: rows}, nil
+	default:
+		return nil, fmt.Errorf("unknown workload: %s", name)
+	}
+}
+
+// prepare create bench table with id as sharding key and insert rows
+func (w *workload) prepare(conn *backend.DirectConnection) error {
+	sqls := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", w.table),
+		fmt.Sprintf("CREATE TABLE %s (id BIGINT NOT NULL, k INT NOT NULL DEFAULT 0, c VARCHAR(120) NOT NULL DEFAULT '', "+
+			"PRIMARY KEY (id), KEY idx_k (k)) ENGINE=InnoDB", w.table),
+	}
+	for _, sql := range sqls {
+		if _, err := conn.Execute(sql, 0); err != nil {
+			return fmt.Errorf("execute %s failed: %v", sql, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	for start := 1; start <= w.rows; start += insertBatch {
+		buf.Reset()
+		fmt.Fprintf(&buf, "INSERT INTO %s (id, k, c) VALUES ", w.table)
+		for id := start; id < start+insertBatch && id <= w.rows; id++ {
+			if id != start {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "(%d, %d, 'gaea-bench-%d')", id, id%kRange, id)
+		}
+		if _, err := conn.Execute(buf.String(), 0); err != nil {
+			return fmt.Errorf("insert rows from %d failed: %v", start, err)
+		}
+	}
+	return nil
+}
+
+// run execute workload on conn until deadline, latency of each transaction or query is recorded.
+// conn is closed when run returns, and is replaced by a new one if it's broken.
+func (w *workload) run(conn *backend.DirectConnection, r *recorder, seed int64, deadline time.Time) {
+	defer func() {
+		conn.Close()
+	}()
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + seed))
+	for time.Now().Before(deadline) {
+		start := time.Now()
+		err := w.execute(conn, rnd)
+		r.record(time.Since(start), err)
+		if err == nil || !backend.IsBackendFailure(err) {
+			continue
+		}
+		conn.Close()
+		newConn, err := connect()
+		if err != nil {
+			r.record(0, err)
+			return
+		}
+		conn = newConn
+	}
+}
+
+func (w *workload) execute(conn *backend.DirectConnection, rnd *rand.Rand) error {
+	id := rnd.Intn(w.rows) + 1
+	switch w.name {
+	case workloadPointSelect:
+		_, err := conn.Execute(fmt.Sprintf("SELECT c FROM %s WHERE id = %d", w.table, id), 0)
+		return err
+	case workloadScatter:
+		_, err := conn.Execute(fmt.Sprintf("SELECT id, c FROM %s WHERE k = %d ORDER BY id LIMIT 10", w.table, rnd.Intn(kRange)), 0)
+		return err
+	default:
+		return w.readWrite(conn, rnd, id)
+	}
+}
+
+// readWrite is a simplified sysbench oltp_read_write transaction
+func (w *workload) readWrite(conn *backend.DirectConnection, rnd *rand.Rand, id int) error {
+	sqls := []string{
+		fmt.Sprintf("SELECT c FROM %s WHERE id = %d", w.table, id),
+		fmt.Sprintf("SELECT c FROM %s WHERE id = %d", w.table, rnd.Intn(w.rows)+1),
+		fmt.Sprintf("UPDATE %s SET k = %d WHERE id = %d", w.table, rnd.Intn(kRange), id),
+		fmt.Sprintf("UPDATE %s SET c = 'gaea-bench-%d' WHERE id = %d", w.table, rnd.Int63(), id),
+	}
+	if err := conn.Begin(); err != nil {
+		return err
+	}
+	for _, sql := range sqls {
+		if _, err := conn.Execute(sql, 0); err != nil {
+			conn.Rollback()
+			return err
+		}
+	}
+	return conn.Commit()
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gaea-replay replays statements in capture file of gaea against a target mysql or gaea,
+// each captured client connection is replayed by a connection to the target in original order.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/log/capture"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+var captureFile = flag.String("file", "", "capture file of gaea")
+var addr = flag.String("addr", "127.0.0.1:3306", "address of target")
+var user = flag.String("user", "root", "user of target")
+var password = flag.String("password", "", "password of target")
+var speed = flag.Float64("speed", 1, "replay speed, 2 means twice as fast as original, 0 means as fast as possible")
+var selectOnly = flag.Bool("select-only", false, "only replay select statements")
+var verbose = flag.Bool("verbose", false, "print failed statements")
+
+// session replays statements of a captured client connection in order
+type session struct {
+	records chan *capture.Record
+	conn    *backend.DirectConnection
+	db      string
+}
+
+// summary of replay
+type summary struct {
+	sync.Mutex
+	count            int
+	errors           int
+	connectErrors    int
+	originalErrors   int
+	originalLatency  time.Duration
+	replayLatency    time.Duration
+	maxReplayLatency time.Duration
+}
+
+func (s *summary) record(r *capture.Record, latency time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.count++
+	if err != nil {
+		s.errors++
+	}
+	if r.Failed {
+		s.originalErrors++
+	}
+	s.originalLatency += r.Duration
+	s.replayLatency += latency
+	if latency > s.maxReplayLatency {
+		s.maxReplayLatency = latency
+	}
+}
+
+func (s *summary) print(elapsed time.Duration) {
+	fmt.Printf("replayed: %d, elapsed: %v, errors: %d (original: %d), connect errors: %d\n",
+		s.count, elapsed, s.errors, s.originalErrors, s.connectErrors)
+	if s.count > 0 {
+		fmt.Printf("avg latency: %v (original: %v), max latency: %v\n",
+			s.replayLatency/time.Duration(s.count), s.originalLatency/time.Duration(s.count), s.maxReplayLatency)
+	}
+}
+
+func (se *session) run(s *summary, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer func() {
+		if se.conn != nil {
+			se.conn.Close()
+		}
+	}()
+	for r := range se.records {
+		if err := se.prepare(r); err != nil {
+			s.Lock()
+			s.connectErrors++
+			s.Unlock()
+			if *verbose {
+				fmt.Printf("connect to %s failed, connection id: %d, db: %s, err: %v\n", *addr, r.ConnectionID, r.DB, err)
+			}
+			continue
+		}
+		start := time.Now()
+		_, err := se.conn.Execute(r.SQL, 0)
+		s.record(r, time.Since(start), err)
+		if err != nil && backend.IsBackendFailure(err) {
+			// reconnect for next statement
+			se.conn.Close()
+		}
+		if err != nil && *verbose {
+			fmt.Printf("replay failed, connection id: %d, db: %s, sql: %s, err: %v\n", r.ConnectionID, r.DB, r.SQL, err)
+		}
+	}
+}
+
+// prepare connect to target if needed and switch to db of record
+func (se *session) prepare(r *capture.Record) error {
+	if se.conn == nil || se.conn.IsClosed() {
+		conn, err := backend.NewDirectConnection(*addr, *user, *password, r.DB, mysql.DefaultCharset, mysql.DefaultCollationID, 0)
+		if err != nil {
+			return err
+		}
+		se.conn = conn
+		se.db = r.DB
+	}
+	if r.DB != "" && r.DB != se.db {
+		if err := se.conn.UseDB(r.DB); err != nil {
+			return err
+		}
+		se.db = r.DB
+	}
+	return nil
+}
+
+func replay(reader *capture.Reader) (*summary, error) {
+	s := &summary{}
+	sessions := make(map[uint32]*session)
+	var wg sync.WaitGroup
+	defer func() {
+		for _, se := range sessions {
+			close(se.records)
+		}
+		wg.Wait()
+	}()
+
+	var first time.Time
+	start := time.Now()
+	for {
+		r, err := reader.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		if *selectOnly && parser.Preview(r.SQL) != parser.StmtSelect {
+			continue
+		}
+
+		// keep intervals between statements, scaled by speed
+		if first.IsZero() {
+			first = r.StartTime
+		}
+		if *speed > 0 {
+			offset := time.Duration(float64(r.StartTime.Sub(first)) / *speed)
+			if wait := offset - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		se, ok := sessions[r.ConnectionID]
+		if !ok {
+			se = &session{records: make(chan *capture.Record, 1024)}
+			sessions[r.ConnectionID] = se
+			wg.Add(1)
+			go se.run(s, &wg)
+		}
+		se.records <- r
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *captureFile == "" {
+		fmt.Println("capture file must be specified by -file")
+		os.Exit(1)
+	}
+	if *speed < 0 {
+		fmt.Println("speed should be >= 0")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*captureFile)
+	if err != nil {
+		fmt.Printf("open capture file failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	reader, err := capture.NewReader(f)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	s, err := replay(reader)
+	s.print(time.Since(start))
+	if err != nil {
+		fmt.Printf("replay stopped by error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -68,7 +68,7 @@ func main() {
 	runtime.GOMAXPROCS(cpuNums)
 	cfg.NumCPU = cpuNums
 
-	if err = models.InitXLog(cfg.LogOutput, cfg.LogPath, cfg.LogFileName, cfg.LogLevel, cfg.Service, cfg.LogKeepDays, cfg.LogKeepCounts); err != nil {
+	if err = models.InitXLog(cfg.LogOutput, cfg.LogPath, cfg.LogFileName, cfg.LogLevel, cfg.Service, cfg.LogKeepDays, cfg.LogKeepCounts, cfg.LogMaxSize, cfg.LogCompress); err != nil {
 		fmt.Printf("init xlog error: %v\n", err.Error())
 		return
 	}
@@ -104,6 +104,14 @@ func main() {
 		for {
 			sig := <-sc
 			if sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGQUIT {
+				if sig == syscall.SIGQUIT {
+					// keep state of proxy for offline analysis before quit
+					if path, err := svr.DumpDiagnostics(); err != nil {
+						log.Warn("dump diagnostics error: %v", err)
+					} else {
+						log.Notice("dump diagnostics to %s", path)
+					}
+				}
 				log.Notice("got signal %d, quit", sig)
 				svr.Close()
 				break
@@ -48,8 +48,10 @@ require (
 	go.uber.org/multierr v1.1.0 // indirect
 	go.uber.org/zap v1.10.0
 	golang.org/x/time v0.0.0-20181108054448-85acf8d2951c // indirect
-	google.golang.org/grpc v1.21.0 // indirect
+	google.golang.org/grpc v1.21.0
+	google.golang.org/protobuf v1.28.0
 	gopkg.in/ini.v1 v1.42.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace github.com/dgrijalva/jwt-go => github.com/golang-jwt/jwt v3.2.2-0.20210713063142-860640e8862d+incompatible
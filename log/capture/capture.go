@@ -0,0 +1,261 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capture records client statements with session context to a binary file,
+// which can be replayed against another target by gaea-replay.
+//
+// The file starts with magic "GAEACAP\x01", followed by records. Each record is
+// the uvarint length of payload and the payload:
+//
+//	varint  start time, unix nanoseconds
+//	varint  duration, nanoseconds
+//	uvarint connection id
+//	byte    flags, bit 0 means the statement failed
+//	string  user, client addr, db and sql, each of them is uvarint length and bytes
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const magic = "GAEACAP\x01"
+
+const flagFailed = 1
+
+// maxRecordSize protects reader from corrupted length
+const maxRecordSize = 64 << 20
+
+// ErrFull is returned when size of capture file reaches max size, later records are dropped
+var ErrFull = errors.New("capture file is full")
+
+// Record is one statement executed by client
+type Record struct {
+	StartTime    time.Time
+	Duration     time.Duration
+	ConnectionID uint32
+	Failed       bool
+	User         string
+	ClientAddr   string
+	DB           string
+	SQL          string
+}
+
+// Encode append encoded record to buf, including length
+func (r *Record) Encode(buf []byte) []byte {
+	payload := make([]byte, 0, 32+len(r.User)+len(r.ClientAddr)+len(r.DB)+len(r.SQL))
+	payload = appendVarint(payload, r.StartTime.UnixNano())
+	payload = appendVarint(payload, int64(r.Duration))
+	payload = appendUvarint(payload, uint64(r.ConnectionID))
+	var flags byte
+	if r.Failed {
+		flags |= flagFailed
+	}
+	payload = append(payload, flags)
+	for _, s := range []string{r.User, r.ClientAddr, r.DB, r.SQL} {
+		payload = appendUvarint(payload, uint64(len(s)))
+		payload = append(payload, s...)
+	}
+	buf = appendUvarint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+func decodeRecord(payload []byte) (*Record, error) {
+	d := decoder{buf: payload}
+	r := &Record{}
+	r.StartTime = time.Unix(0, d.varint())
+	r.Duration = time.Duration(d.varint())
+	r.ConnectionID = uint32(d.uvarint())
+	r.Failed = d.byte()&flagFailed != 0
+	r.User = d.string()
+	r.ClientAddr = d.string()
+	r.DB = d.string()
+	r.SQL = d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return r, nil
+}
+
+// Writer appends records to capture file, it's safe for concurrent use
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	maxSize int64
+	buf     []byte
+}
+
+// NewWriter open capture file to append records, capturing stops when size of file reaches maxSize, 0 means no limit
+func NewWriter(filename string, maxSize int64) (*Writer, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &Writer{f: f, size: fi.Size(), maxSize: maxSize}
+	if w.size == 0 {
+		if _, err = f.Write([]byte(magic)); err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.size = int64(len(magic))
+	}
+	return w, nil
+}
+
+// Write append a record, ErrFull is returned if the file reaches max size.
+// Each record is written by one write call, so records of writers on the same file are not interleaved.
+func (w *Writer) Write(r *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = r.Encode(w.buf[:0])
+	if w.maxSize > 0 && w.size+int64(len(w.buf)) > w.maxSize {
+		return ErrFull
+	}
+	n, err := w.f.Write(w.buf)
+	w.size += int64(n)
+	return err
+}
+
+// Close close the capture file
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Reader reads records from capture file
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader check magic of capture file and return reader of its records
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("read header of capture file failed: %v", err)
+	}
+	if string(header) != magic {
+		return nil, fmt.Errorf("invalid capture file")
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next return next record, io.EOF is returned if there is no more record
+func (r *Reader) Next() (*Record, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		// the last record may be written partially
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("invalid record length: %d", length)
+	}
+	if uint64(cap(r.buf)) < length {
+		r.buf = make([]byte, length)
+	}
+	payload := r.buf[:length]
+	if _, err = io.ReadFull(r.r, payload); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return decodeRecord(payload)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+// decoder decode fields of payload, err is set by the first failure
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid record")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("invalid record")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = fmt.Errorf("invalid record")
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = fmt.Errorf("invalid record")
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "capture")
+	records := []*Record{
+		{
+			StartTime:    time.Unix(1700000000, 123456789),
+			Duration:     1500 * time.Microsecond,
+			ConnectionID: 10,
+			User:         "root",
+			ClientAddr:   "127.0.0.1:51234",
+			DB:           "test",
+			SQL:          "select * from t where id = 1",
+		},
+		{
+			StartTime:    time.Unix(1700000001, 0),
+			Duration:     time.Millisecond,
+			ConnectionID: 11,
+			Failed:       true,
+			User:         "root",
+			SQL:          "update t set a = '中文' where id = 2",
+		},
+	}
+
+	w, err := NewWriter(filename, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(records[0]))
+	assert.Nil(t, w.Close())
+
+	// records are appended when the file is opened again
+	w, err = NewWriter(filename, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(records[1]))
+	assert.Nil(t, w.Close())
+
+	f, err := os.Open(filename)
+	assert.Nil(t, err)
+	defer f.Close()
+	r, err := NewReader(f)
+	assert.Nil(t, err)
+	for _, expect := range records {
+		record, err := r.Next()
+		assert.Nil(t, err)
+		assert.True(t, expect.StartTime.Equal(record.StartTime))
+		record.StartTime = expect.StartTime
+		assert.Equal(t, expect, record)
+	}
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWriterMaxSize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "capture")
+	record := &Record{StartTime: time.Now(), SQL: "select 1"}
+	size := len(record.Encode(nil))
+
+	w, err := NewWriter(filename, int64(len(magic)+size*2))
+	assert.Nil(t, err)
+	defer w.Close()
+	assert.Nil(t, w.Write(record))
+	assert.Nil(t, w.Write(record))
+	assert.Equal(t, ErrFull, w.Write(record))
+}
+
+func TestReaderInvalidFile(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("GAEA")))
+	assert.NotNil(t, err)
+	_, err = NewReader(bytes.NewReader([]byte("NOTGAEA\x01")))
+	assert.NotNil(t, err)
+
+	// partially written record is ignored
+	buf := []byte(magic)
+	buf = (&Record{StartTime: time.Now(), SQL: "select 1"}).Encode(buf)
+	r, err := NewReader(bytes.NewReader(buf[:len(buf)-1]))
+	assert.Nil(t, err)
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
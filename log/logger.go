@@ -45,6 +45,18 @@ type Logger interface {
 	Close()
 }
 
+// Field is a key-value pair of structured log
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// FieldsLogger is implemented by loggers which can output structured fields, like json format
+type FieldsLogger interface {
+	NoticeFields(msg string, fields ...Field) error
+	WarnFields(msg string, fields ...Field) error
+}
+
 func init() {
 	cfg := make(map[string]string)
 	cfg["level"] = "debug"
@@ -63,6 +75,11 @@ func SetGlobalLogger(lg Logger) {
 	logger = lg
 }
 
+// SetLevel set level of the global logger at runtime
+func SetLevel(name, level string) error {
+	return logger.SetLevel(name, level)
+}
+
 // Debug log debug message.
 func Debug(format string, a ...interface{}) (err error) {
 	return logger.Debug(format, a...)
@@ -0,0 +1,266 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rotate provides a log writer which rotates files by size,
+// rotated files can be compressed by gzip and are removed by max age and max count.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupTimeFormat = "20060102150405.000"
+	compressSuffix   = ".gz"
+	megabyte         = 1024 * 1024
+)
+
+// Writer is an io.WriteCloser which writes to filename, the file is renamed to
+// filename.<time> when its size reaches maxSize and a new file is created.
+type Writer struct {
+	filename   string
+	maxSize    int64         // bytes
+	maxAge     time.Duration // 0 means backups are not removed by age
+	maxBackups int           // 0 means backups are not removed by count
+	compress   bool
+
+	mu     sync.Mutex
+	file   *os.File // nil if reopen failed in rotate, it's opened again by next write
+	size   int64
+	closed bool
+
+	millCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewWriter create size based rotate writer, maxSize is in megabytes
+func NewWriter(filename string, maxSize int, maxAge time.Duration, maxBackups int, compress bool) (*Writer, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid max size: %d", maxSize)
+	}
+	w := &Writer{
+		filename:   filename,
+		maxSize:    int64(maxSize) * megabyte,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		compress:   compress,
+		millCh:     make(chan struct{}, 1),
+	}
+	if err := w.openExistingOrNew(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.millRun()
+	// clean up backups left by last run
+	w.mill()
+	return w, nil
+}
+
+// Write implements io.Writer, it rotates the file if the write would exceed max size
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.openExistingOrNew(); err != nil {
+			return 0, err
+		}
+	}
+	if w.size+int64(len(p)) > w.maxSize && w.size > 0 {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	close(w.millCh)
+	w.wg.Wait()
+	return err
+}
+
+func (w *Writer) openExistingOrNew() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate must be called with mu held, the file is closed even if it fails, and next write opens it again
+func (w *Writer) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+	backup := w.filename + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(w.filename, backup); err != nil {
+		return err
+	}
+	if err := w.openExistingOrNew(); err != nil {
+		return err
+	}
+	w.mill()
+	return nil
+}
+
+// mill notify the background goroutine to compress and remove backups, never blocks
+func (w *Writer) mill() {
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Writer) millRun() {
+	defer w.wg.Done()
+	for range w.millCh {
+		if err := w.millRunOnce(); err != nil {
+			fmt.Fprintf(os.Stderr, "rotate log %s failed, err: %v\n", w.filename, err)
+		}
+	}
+}
+
+type backupInfo struct {
+	path      string
+	timestamp time.Time
+}
+
+// backups return backup files, newest first
+func (w *Writer) backups() ([]backupInfo, error) {
+	files, err := filepath.Glob(w.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+	prefix := w.filename + "."
+	var ret []backupInfo
+	for _, f := range files {
+		ts := strings.TrimSuffix(strings.TrimPrefix(f, prefix), compressSuffix)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, backupInfo{path: f, timestamp: t})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].timestamp.After(ret[j].timestamp)
+	})
+	return ret, nil
+}
+
+func (w *Writer) millRunOnce() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+
+	var remains []backupInfo
+	for i, b := range backups {
+		expired := w.maxAge > 0 && time.Since(b.timestamp) > w.maxAge
+		exceeded := w.maxBackups > 0 && i >= w.maxBackups
+		if expired || exceeded {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		remains = append(remains, b)
+	}
+
+	if !w.compress {
+		return nil
+	}
+	for _, b := range remains {
+		if strings.HasSuffix(b.path, compressSuffix) {
+			continue
+		}
+		if err := compressFile(b.path, b.path+compressSuffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressFile gzip src to dst and remove src
+func compressFile(src, dst string) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	gz := gzip.NewWriter(gzf)
+	if _, err = io.Copy(gz, f); err != nil {
+		gzf.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		gzf.Close()
+		return err
+	}
+	if err = gzf.Close(); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,174 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func newTestWriter(t *testing.T, maxBackups int, compress bool) (*Writer, string) {
+	filename := filepath.Join(newTestDir(t), "gaea.log")
+	return openTestWriter(t, filename, 0, maxBackups, compress), filename
+}
+
+func openTestWriter(t *testing.T, filename string, maxAge time.Duration, maxBackups int, compress bool) *Writer {
+	w, err := NewWriter(filename, 1, maxAge, maxBackups, compress)
+	require.NoError(t, err)
+	// use a small max size to make test fast
+	w.maxSize = 10
+	return w
+}
+
+// write one line, sleep to make sure backups get different names
+func writeAndWait(t *testing.T, w *Writer, line string) {
+	_, err := w.Write([]byte(line))
+	require.NoError(t, err)
+	// backup name has millisecond precision
+	time.Sleep(5 * time.Millisecond)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait for condition timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriterRotateBySize(t *testing.T) {
+	w, filename := newTestWriter(t, 0, false)
+	defer w.Close()
+
+	writeAndWait(t, w, "0123456789")
+	writeAndWait(t, w, "abc")
+	writeAndWait(t, w, "defghijklm")
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "defghijklm", string(data))
+
+	backups, err := w.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	data, err = ioutil.ReadFile(backups[0].path)
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(data))
+}
+
+func TestWriterMaxBackups(t *testing.T) {
+	w, _ := newTestWriter(t, 2, false)
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		writeAndWait(t, w, "0123456789")
+	}
+	waitFor(t, func() bool {
+		backups, err := w.backups()
+		require.NoError(t, err)
+		return len(backups) == 2
+	})
+}
+
+func TestWriterMaxAge(t *testing.T) {
+	filename := filepath.Join(newTestDir(t), "gaea.log")
+	old := filename + "." + time.Now().Add(-48*time.Hour).Format(backupTimeFormat)
+	require.NoError(t, ioutil.WriteFile(old, []byte("old"), 0644))
+
+	w := openTestWriter(t, filename, 24*time.Hour, 0, false)
+	defer w.Close()
+
+	writeAndWait(t, w, "0123456789")
+	writeAndWait(t, w, "0123456789")
+	waitFor(t, func() bool {
+		_, err := os.Stat(old)
+		return os.IsNotExist(err)
+	})
+	backups, err := w.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+}
+
+func TestWriterCompress(t *testing.T) {
+	w, _ := newTestWriter(t, 0, true)
+	defer w.Close()
+
+	writeAndWait(t, w, "0123456789")
+	writeAndWait(t, w, "abc")
+	waitFor(t, func() bool {
+		backups, err := w.backups()
+		require.NoError(t, err)
+		return len(backups) == 1 && strings.HasSuffix(backups[0].path, compressSuffix)
+	})
+
+	backups, err := w.backups()
+	require.NoError(t, err)
+	f, err := os.Open(backups[0].path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(gz)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", buf.String())
+}
+
+func TestWriterClosed(t *testing.T) {
+	w, _ := newTestWriter(t, 0, false)
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+	_, err := w.Write([]byte("a"))
+	require.Equal(t, os.ErrClosed, err)
+}
+
+func TestWriterReopenAfterRotateFailed(t *testing.T) {
+	w, filename := newTestWriter(t, 0, false)
+	defer w.Close()
+
+	writeAndWait(t, w, "0123456789")
+	// rotate fails since the file is removed with its directory
+	require.NoError(t, os.RemoveAll(filepath.Dir(filename)))
+	_, err := w.Write([]byte("abc"))
+	require.Error(t, err)
+
+	// the file is opened again by next write
+	writeAndWait(t, w, "defghijklm")
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "defghijklm", string(data))
+}
+
+func TestNewWriterInvalidSize(t *testing.T) {
+	_, err := NewWriter(filepath.Join(os.TempDir(), "gaea.log"), 0, 0, 0, false)
+	require.Error(t, err)
+}
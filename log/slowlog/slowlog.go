@@ -0,0 +1,122 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slowlog writes slow queries in the format of MySQL slow query log,
+// so tools like pt-query-digest and mysqldumpslow can analyse it directly.
+package slowlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+)
+
+const (
+	DefaultKeepDays = 3
+)
+
+// Entry is one slow query
+type Entry struct {
+	StartTime    time.Time
+	QueryTime    time.Duration
+	User         string
+	ClientAddr   string
+	ConnectionID uint32
+	DB           string
+	RowsSent     int
+	RowsAffected uint64
+	SQL          string
+}
+
+// Writer writes slow query to a file which is rotated hourly
+type Writer struct {
+	mu     sync.Mutex
+	writer io.WriteCloser
+	lastDB string
+}
+
+// NewWriter create slow log writer, rotated files are kept by keepDays or keepCounts, only one of them works
+func NewWriter(filename string, keepDays, keepCounts int) (*Writer, error) {
+	if keepDays <= 0 && keepCounts <= 0 {
+		keepDays = DefaultKeepDays
+	}
+	// rotatelogs 不允许全部设置 > 0
+	if keepDays > 0 && keepCounts > 0 {
+		if keepDays*24 > keepCounts {
+			keepDays = 0
+		} else {
+			keepCounts = 0
+		}
+	}
+	w, err := rotatelogs.New(
+		filename+"-%Y%m%d%H",
+		rotatelogs.WithLinkName(filename),
+		rotatelogs.WithMaxAge(time.Hour*24*time.Duration(keepDays)),
+		rotatelogs.WithRotationCount(uint(keepCounts)),
+		rotatelogs.WithRotationTime(time.Hour),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{writer: w}, nil
+}
+
+// Write write one slow query
+func (w *Writer) Write(e *Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	buf := Format(e, w.lastDB)
+	w.lastDB = e.DB
+	_, err := w.writer.Write(buf)
+	return err
+}
+
+// Close close the underlying file
+func (w *Writer) Close() error {
+	return w.writer.Close()
+}
+
+// Format return the entry in MySQL slow log format, `use db` is omitted if the db is the same as lastDB
+func Format(e *Entry, lastDB string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Time: %s\n", e.StartTime.UTC().Format("2006-01-02T15:04:05.000000Z"))
+	fmt.Fprintf(&buf, "# User@Host: %s[%s] @  [%s]  Id: %d\n", e.User, e.User, clientIP(e.ClientAddr), e.ConnectionID)
+	fmt.Fprintf(&buf, "# Query_time: %.6f  Lock_time: 0.000000 Rows_sent: %d  Rows_examined: 0  Rows_affected: %d\n",
+		e.QueryTime.Seconds(), e.RowsSent, e.RowsAffected)
+	if e.DB != "" && e.DB != lastDB {
+		fmt.Fprintf(&buf, "use %s;\n", e.DB)
+	}
+	fmt.Fprintf(&buf, "SET timestamp=%d;\n", e.StartTime.Unix())
+	sql := strings.TrimSpace(e.SQL)
+	buf.WriteString(sql)
+	if !strings.HasSuffix(sql, ";") {
+		buf.WriteString(";")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// clientIP strip port of client addr, like 127.0.0.1:3306 or [::1]:3306
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	e := &Entry{
+		StartTime:    time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC),
+		QueryTime:    1500 * time.Millisecond,
+		User:         "root",
+		ClientAddr:   "127.0.0.1:51234",
+		ConnectionID: 10,
+		DB:           "test",
+		RowsSent:     2,
+		SQL:          "select sleep(1.5)",
+	}
+	expect := "# Time: 2024-01-02T03:04:05.000006Z\n" +
+		"# User@Host: root[root] @  [127.0.0.1]  Id: 10\n" +
+		"# Query_time: 1.500000  Lock_time: 0.000000 Rows_sent: 2  Rows_examined: 0  Rows_affected: 0\n" +
+		"use test;\n" +
+		"SET timestamp=1704164645;\n" +
+		"select sleep(1.5);\n"
+	assert.Equal(t, expect, string(Format(e, "")))
+
+	// use db is omitted when db is not changed
+	assert.NotContains(t, string(Format(e, "test")), "use test;")
+}
+
+func TestClientIP(t *testing.T) {
+	assert.Equal(t, "::1", clientIP("[::1]:3306"))
+	assert.Equal(t, "127.0.0.1", clientIP("127.0.0.1:3306"))
+	assert.Equal(t, "127.0.0.1", clientIP("127.0.0.1"))
+}
@@ -58,9 +58,10 @@ func LevelFromStr(level string) int {
 		resultLevel = DebugLevel
 	case "trace":
 		resultLevel = TraceLevel
-	case "notice":
+	case "info", "notice":
 		resultLevel = NoticeLevel
-	case "warn":
+	case "warn", "error":
+		// xlog has no error level, errors are written as warnings
 		resultLevel = WarnLevel
 	case "fatal":
 		resultLevel = FatalLevel
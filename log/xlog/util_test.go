@@ -13,7 +13,9 @@ func TestLevelFromStr(t *testing.T) {
 		{"debug", DebugLevel},
 		{"trace", TraceLevel},
 		{"notice", NoticeLevel},
+		{"info", NoticeLevel},
 		{"warn", WarnLevel},
+		{"error", WarnLevel},
 		{"fatal", FatalLevel},
 		{"none", NoneLevel},
 		{"unknown", NoticeLevel}, // unknown level should default to NOTICE
@@ -17,12 +17,23 @@ package zap
 import (
 	"time"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
 )
 
 var zapBufferPool = buffer.NewPool()
 
+// newJSONEncoder return encoder output one json object per line, with fields ts, level and msg
+func newJSONEncoder() zapcore.Encoder {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "ts"
+	encoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
+	}
+	return zapcore.NewJSONEncoder(encoderConfig)
+}
+
 type ZapEncoder struct {
 }
 
@@ -17,11 +17,15 @@ package zap
 import (
 	"fmt"
 	"io"
+	"log/syslog"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/log/rotate"
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -29,10 +33,23 @@ import (
 
 const (
 	ZapLogDefaultlogID = "900000001"
+
+	// OutputFile write log to rotated files under path, it's the default output
+	OutputFile = "file"
+	// OutputStdout write log to stdout in json format
+	OutputStdout = "stdout"
+	// OutputSyslog write log to local syslog
+	OutputSyslog = "syslog"
+
+	// FormatText is the default format: [time] [LEVEL] message
+	FormatText = "text"
+	// FormatJSON output one json object per line, fields are kept as json keys
+	FormatJSON = "json"
 )
 
 type ZapLoggerManager struct {
 	logger  *zap.Logger
+	level   *zap.AtomicLevel
 	writers []io.WriteCloser
 }
 
@@ -60,21 +77,68 @@ func CreateLogManager(config map[string]string) (*ZapLoggerManager, error) {
 		logKeepCounts, _ = strconv.Atoi(value)
 	}
 
-	encoder := &ZapEncoder{}
+	// max_size is in megabytes, rotate by size instead of hour if it's set
+	maxSize := 0
+	if value, ok := config["max_size"]; ok {
+		maxSize, _ = strconv.Atoi(value)
+	}
+	compress, _ := strconv.ParseBool(config["compress"])
+
+	atomicLevel := zap.NewAtomicLevelAt(getZapLevelFromStr(level))
+
+	var encoder zapcore.Encoder = &ZapEncoder{}
+	switch format := strings.ToLower(config["format"]); format {
+	case "", FormatText:
+	case FormatJSON:
+		encoder = newJSONEncoder()
+	default:
+		return nil, fmt.Errorf("init XFileLog failed, unknown format: %s", format)
+	}
+
+	output := strings.ToLower(config["output"])
+	switch output {
+	case "", OutputFile:
+	case OutputStdout, "console":
+		core := zapcore.NewCore(newJSONEncoder(), zapcore.Lock(os.Stdout), atomicLevel)
+		return &ZapLoggerManager{logger: zap.New(core), level: &atomicLevel}, nil
+	case OutputSyslog:
+		writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_LOCAL0, config["service"])
+		if err != nil {
+			return nil, fmt.Errorf("init syslog failed, err: %v", err)
+		}
+		core := zapcore.NewCore(encoder, zapcore.AddSync(writer), atomicLevel)
+		return &ZapLoggerManager{logger: zap.New(core), level: &atomicLevel, writers: []io.WriteCloser{writer}}, nil
+	default:
+		return nil, fmt.Errorf("init XFileLog failed, unknown output: %s", output)
+	}
 
 	// 实现两个判断日志等级的interface (其实 zapcore.*Level 自身就是 interface)
 	infoLevel := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl < zapcore.WarnLevel && lvl >= getZapLevelFromStr(level)
+		return lvl < zapcore.WarnLevel && atomicLevel.Enabled(lvl)
 	})
 
 	warnLevel := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.WarnLevel && lvl >= getZapLevelFromStr(level)
+		return lvl >= zapcore.WarnLevel && atomicLevel.Enabled(lvl)
 	})
 	logFile := path.Join(logDir, filename+".log")
 
 	// 获取 info、warn日志文件的 io.WriteCloser 抽象 getWriter() 在下方实现
-	infoWriter := NewAsyncWriter(getInfoWriter(logFile, logKeepDays, logKeepCounts))
-	warnWriter := NewAsyncWriter(getWarnWriter(logFile, logKeepDays, logKeepCounts))
+	var infoWriter, warnWriter *LogAsyncWriter
+	if maxSize > 0 {
+		iw, err := getSizeRotateWriter(logFile, maxSize, logKeepDays, logKeepCounts, compress)
+		if err != nil {
+			return nil, err
+		}
+		ww, err := getSizeRotateWriter(logFile+".wf", maxSize, logKeepDays, logKeepCounts, compress)
+		if err != nil {
+			iw.Close()
+			return nil, err
+		}
+		infoWriter, warnWriter = NewAsyncWriter(iw), NewAsyncWriter(ww)
+	} else {
+		infoWriter = NewAsyncWriter(getInfoWriter(logFile, logKeepDays, logKeepCounts))
+		warnWriter = NewAsyncWriter(getWarnWriter(logFile, logKeepDays, logKeepCounts))
+	}
 
 	// 最后创建具体的Logger
 	core := zapcore.NewTee(
@@ -84,6 +148,7 @@ func CreateLogManager(config map[string]string) (*ZapLoggerManager, error) {
 	l := zap.New(core)
 	return &ZapLoggerManager{
 		logger:  l,
+		level:   &atomicLevel,
 		writers: []io.WriteCloser{infoWriter, warnWriter},
 	}, nil
 }
@@ -110,6 +175,16 @@ func getLogWriter(baseName string, filename string, logKeepDays, logKeepCounts i
 	return hook
 }
 
+// getSizeRotateWriter rotate file when its size reaches maxSize megabytes,
+// unlike rotatelogs, both logKeepDays and logKeepCounts take effect
+func getSizeRotateWriter(filename string, maxSize, logKeepDays, logKeepCounts int, compress bool) (io.WriteCloser, error) {
+	w, err := rotate.NewWriter(filename, maxSize, time.Hour*24*time.Duration(logKeepDays), logKeepCounts, compress)
+	if err != nil {
+		return nil, fmt.Errorf("init XFileLog failed, err: %v", err)
+	}
+	return w, nil
+}
+
 func getInfoWriter(filename string, logKeepDays, logKeepCounts int) io.WriteCloser {
 	return getLogWriter(filename, filename+"-%Y%m%d%H.log", logKeepDays, logKeepCounts)
 }
@@ -118,6 +193,15 @@ func getWarnWriter(filename string, logKeepDays, logKeepCounts int) io.WriteClos
 	return getLogWriter(filename+".wf", filename+".wf-%Y%m%d%H.log.wf", logKeepDays, logKeepCounts)
 }
 
+// IsValidLevel check if level string is supported
+func IsValidLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "trace", "info", "notice", "warn", "error", "fatal", "none":
+		return true
+	}
+	return false
+}
+
 // LevelFromStr get log level from level string
 func getZapLevelFromStr(level string) zapcore.Level {
 	resultLevel := zap.DebugLevel
@@ -127,10 +211,12 @@ func getZapLevelFromStr(level string) zapcore.Level {
 		resultLevel = zap.DebugLevel
 	case "trace":
 		resultLevel = zap.DebugLevel
-	case "notice":
+	case "info", "notice":
 		resultLevel = zap.InfoLevel
 	case "warn":
 		resultLevel = zap.WarnLevel
+	case "error":
+		resultLevel = zap.ErrorLevel
 	case "fatal":
 		resultLevel = zap.FatalLevel
 	case "none":
@@ -141,8 +227,15 @@ func getZapLevelFromStr(level string) zapcore.Level {
 	return resultLevel
 }
 
-// SetLevel implements XLogger
+// SetLevel implements XLogger, name is ignored because all outputs share one level
 func (l *ZapLoggerManager) SetLevel(name, level string) (err error) {
+	if !IsValidLevel(level) {
+		return fmt.Errorf("invalid log level: %s", level)
+	}
+	if l.level == nil {
+		return nil
+	}
+	l.level.SetLevel(getZapLevelFromStr(level))
 	return nil
 }
 
@@ -236,6 +329,32 @@ func (l *ZapLoggerManager) Debugx(logID, format string, a ...interface{}) (err e
 	return
 }
 
+// NoticeFields implements log.FieldsLogger, fields are dropped in text format
+func (l *ZapLoggerManager) NoticeFields(msg string, fields ...log.Field) (err error) {
+	if l.logger == nil {
+		return
+	}
+	l.logger.Info(msg, toZapFields(fields)...)
+	return
+}
+
+// WarnFields implements log.FieldsLogger, fields are dropped in text format
+func (l *ZapLoggerManager) WarnFields(msg string, fields ...log.Field) (err error) {
+	if l.logger == nil {
+		return
+	}
+	l.logger.Warn(msg, toZapFields(fields)...)
+	return
+}
+
+func toZapFields(fields []log.Field) []zap.Field {
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+	}
+	return zapFields
+}
+
 // Close implements XLogger
 func (l *ZapLoggerManager) Close() {
 	if l.logger == nil {
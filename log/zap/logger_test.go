@@ -15,6 +15,9 @@
 package zap
 
 import (
+	"bytes"
+	"encoding/json"
+	"github.com/XiaoMi/Gaea/log"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"os"
@@ -87,7 +90,9 @@ func TestGetZapLevelFromStr(t *testing.T) {
 	assert.Equal(t, zap.DebugLevel, getZapLevelFromStr("debug"))
 	assert.Equal(t, zap.DebugLevel, getZapLevelFromStr("TRACE"))
 	assert.Equal(t, zap.InfoLevel, getZapLevelFromStr("notice"))
+	assert.Equal(t, zap.InfoLevel, getZapLevelFromStr("info"))
 	assert.Equal(t, zap.WarnLevel, getZapLevelFromStr("warn"))
+	assert.Equal(t, zap.ErrorLevel, getZapLevelFromStr("error"))
 	assert.Equal(t, zap.FatalLevel, getZapLevelFromStr("fatal"))
 	assert.Equal(t, zapcore.Level(99), getZapLevelFromStr("none"))
 	assert.Equal(t, zap.InfoLevel, getZapLevelFromStr("unknown"))
@@ -99,6 +104,56 @@ func TestSetLevel(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSetLevelAtRuntime(t *testing.T) {
+	config := map[string]string{
+		"path":     "/tmp",
+		"filename": "test_level",
+		"level":    "notice",
+	}
+	loggerManager, err := CreateLogManager(config)
+	assert.NoError(t, err)
+	defer loggerManager.Close()
+
+	assert.False(t, loggerManager.logger.Core().Enabled(zap.DebugLevel))
+	assert.NoError(t, loggerManager.SetLevel("", "debug"))
+	assert.True(t, loggerManager.logger.Core().Enabled(zap.DebugLevel))
+	assert.NoError(t, loggerManager.SetLevel("", "warn"))
+	assert.False(t, loggerManager.logger.Core().Enabled(zap.InfoLevel))
+	assert.NoError(t, loggerManager.SetLevel("", "info"))
+	assert.True(t, loggerManager.logger.Core().Enabled(zap.InfoLevel))
+	assert.NoError(t, loggerManager.SetLevel("", "error"))
+	assert.False(t, loggerManager.logger.Core().Enabled(zap.WarnLevel))
+	assert.Error(t, loggerManager.SetLevel("", "unknown"))
+}
+
+func TestCreateLogManagerUnknownOutput(t *testing.T) {
+	config := map[string]string{
+		"path":     "/tmp",
+		"filename": "test",
+		"level":    "debug",
+		"output":   "unknown",
+	}
+	_, err := CreateLogManager(config)
+	assert.Error(t, err)
+}
+
+func TestJSONFormatFields(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(newJSONEncoder(), zapcore.AddSync(&buf), zap.DebugLevel)
+	loggerManager := &ZapLoggerManager{logger: zap.New(core)}
+
+	err := loggerManager.WarnFields("SLOW", log.Field{Key: "ns", Value: "test"}, log.Field{Key: "latency_ms", Value: 1.5})
+	assert.NoError(t, err)
+
+	var ret map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &ret))
+	assert.Equal(t, "SLOW", ret["msg"])
+	assert.Equal(t, "warn", ret["level"])
+	assert.Equal(t, "test", ret["ns"])
+	assert.Equal(t, 1.5, ret["latency_ms"])
+	assert.NotEmpty(t, ret["ts"])
+}
+
 func TestLoggerClose(t *testing.T) {
 	loggerManager := &ZapLoggerManager{
 		logger: zap.NewExample(),
@@ -35,9 +35,14 @@ type LogAsyncWriter struct {
 
 func NewAsyncWriter(w io.WriteCloser) *LogAsyncWriter {
 	buf := bufio.NewWriterSize(w, writerBuffSize)
+	// ticker and context are created before flushing goroutine starts, so Close called at once doesn't see nil ones
+	ctx, quit := context.WithCancel(context.Background())
 	syncer := &LogAsyncWriter{
 		writer: w,
 		buf:    buf,
+		timer:  time.NewTicker(time.Millisecond * 100),
+		quit:   quit,
+		ctx:    ctx,
 	}
 	go syncer.intervalFlush()
 	return syncer
@@ -56,8 +61,6 @@ func (l *LogAsyncWriter) Sync() error {
 }
 
 func (l *LogAsyncWriter) intervalFlush() {
-	l.ctx, l.quit = context.WithCancel(context.Background())
-	l.timer = time.NewTicker(time.Millisecond * 100)
 	for {
 		select {
 		case <-l.timer.C:
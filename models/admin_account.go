@@ -0,0 +1,99 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// roles of admin accounts, a role has all permissions of roles before it
+const (
+	AdminRoleViewer            = "viewer"             // read only
+	AdminRoleNamespaceOperator = "namespace-operator" // reload config and operate backends of namespaces
+	AdminRoleSuperAdmin        = "super-admin"        // all permissions, admin_user of proxy config is super admin
+)
+
+var adminRoleLevels = map[string]int{
+	AdminRoleViewer:            1,
+	AdminRoleNamespaceOperator: 2,
+	AdminRoleSuperAdmin:        3,
+}
+
+// AdminAccount means account of admin api
+type AdminAccount struct {
+	User       string   `json:"user"`
+	Password   string   `json:"password"`
+	Role       string   `json:"role"`       // viewer, namespace-operator或super-admin
+	Namespaces []string `json:"namespaces"` // 可访问的namespace, 为空时可访问全部namespace, 对super-admin无效
+}
+
+// LoadAdminAccounts load admin accounts from json file, the file is an array of accounts
+func LoadAdminAccounts(path string) ([]*AdminAccount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*AdminAccount
+	if err = json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("parse admin accounts file %s error: %v", path, err)
+	}
+	users := make(map[string]bool, len(accounts))
+	for _, a := range accounts {
+		if err = a.Verify(); err != nil {
+			return nil, err
+		}
+		if users[a.User] {
+			return nil, fmt.Errorf("duplicate admin account: %s", a.User)
+		}
+		users[a.User] = true
+	}
+	return accounts, nil
+}
+
+// Verify verify admin account
+func (a *AdminAccount) Verify() error {
+	if a.User == "" || a.Password == "" {
+		return fmt.Errorf("user and password of admin account should be set")
+	}
+	if _, ok := adminRoleLevels[a.Role]; !ok {
+		return fmt.Errorf("invalid role of admin account %s: %s", a.User, a.Role)
+	}
+	return nil
+}
+
+// HasRole check if account has permissions of role
+func (a *AdminAccount) HasRole(role string) bool {
+	return adminRoleLevels[a.Role] >= adminRoleLevels[role]
+}
+
+// IsGlobal check if account isn't limited to namespaces, only global accounts can access routes of whole proxy
+func (a *AdminAccount) IsGlobal() bool {
+	return a.Role == AdminRoleSuperAdmin || len(a.Namespaces) == 0
+}
+
+// CanAccess check if namespace is in scope of account
+func (a *AdminAccount) CanAccess(namespace string) bool {
+	if a.IsGlobal() {
+		return true
+	}
+	for _, ns := range a.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAdminAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_admin_accounts")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{`[{"user": "dba", "password": "p", "role": "super-admin"}, {"user": "ops", "password": "p", "role": "namespace-operator", "namespaces": ["ns1"]}]`, true},
+		{`[{"user": "dba", "password": "p", "role": "admin"}]`, false},
+		{`[{"user": "dba", "role": "viewer"}]`, false},
+		{`[{"user": "dba", "password": "p", "role": "viewer"}, {"user": "dba", "password": "q", "role": "viewer"}]`, false},
+		{`{"user": "dba"}`, false},
+	}
+	for _, test := range tests {
+		assert.Nil(t, ioutil.WriteFile(path, []byte(test.content), 0600))
+		accounts, err := LoadAdminAccounts(path)
+		if !test.valid {
+			assert.NotNil(t, err, test.content)
+			continue
+		}
+		assert.Nil(t, err, test.content)
+		assert.Equal(t, 2, len(accounts))
+	}
+}
+
+func TestAdminAccountPermission(t *testing.T) {
+	viewer := &AdminAccount{User: "v", Password: "p", Role: AdminRoleViewer}
+	operator := &AdminAccount{User: "o", Password: "p", Role: AdminRoleNamespaceOperator, Namespaces: []string{"ns1"}}
+	admin := &AdminAccount{User: "a", Password: "p", Role: AdminRoleSuperAdmin, Namespaces: []string{"ns1"}}
+
+	assert.True(t, viewer.HasRole(AdminRoleViewer))
+	assert.False(t, viewer.HasRole(AdminRoleNamespaceOperator))
+	assert.True(t, operator.HasRole(AdminRoleNamespaceOperator))
+	assert.False(t, operator.HasRole(AdminRoleSuperAdmin))
+	assert.True(t, admin.HasRole(AdminRoleSuperAdmin))
+
+	assert.True(t, viewer.CanAccess("ns2"))
+	assert.True(t, operator.CanAccess("ns1"))
+	assert.False(t, operator.CanAccess("ns2"))
+	assert.True(t, admin.CanAccess("ns2"))
+
+	assert.True(t, viewer.IsGlobal())
+	assert.False(t, operator.IsGlobal())
+	assert.True(t, admin.IsGlobal())
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BackendError means config of appending slice, db and backend of errors returned by backend mysql
+// to error messages sent to clients, like "[slice=slice-0 db=db_0 addr=mysql-a]"
+type BackendError struct {
+	ShowAddr    bool              `json:"show_addr"`    // 未配置别名的后端显示真实地址, 默认为 false 即不显示
+	AddrAliases map[string]string `json:"addr_aliases"` // 后端地址在错误信息中显示的别名, key: 后端地址 ip:port, 用于对客户端隐藏内部地址
+}
+
+// DisplayAddr return addr shown in error messages, empty if addr should be hidden
+func (b *BackendError) DisplayAddr(addr string) string {
+	if alias, ok := b.AddrAliases[addr]; ok {
+		return alias
+	}
+	if b.ShowAddr {
+		return addr
+	}
+	return ""
+}
+
+func (b *BackendError) verify() error {
+	for addr, alias := range b.AddrAliases {
+		if strings.TrimSpace(addr) == "" || strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("invalid addr alias of backend error, addr: %s, alias: %s", addr, alias)
+		}
+	}
+	return nil
+}
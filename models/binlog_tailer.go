@@ -0,0 +1,45 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+)
+
+// BinlogTailer means config of tailing binlog of slice masters, tables changed on backends are reported to proxy
+type BinlogTailer struct {
+	UserName string   `json:"user_name"` // 复制账号, 需要REPLICATION SLAVE和REPLICATION CLIENT权限, 为空时使用slice的账号, 支持secret uri
+	Password string   `json:"password"`  // 复制账号的密码, 支持secret uri
+	Slices   []string `json:"slices"`    // 订阅binlog的slice, 为空时订阅所有slice的主库
+}
+
+func (b *BinlogTailer) verify(n *Namespace) error {
+	if b.UserName == "" && b.Password != "" {
+		return fmt.Errorf("user_name of binlog_tailer should be set with password")
+	}
+	for _, name := range b.Slices {
+		found := false
+		for _, s := range n.Slices {
+			if s.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("slice of binlog_tailer not found: %s", name)
+		}
+	}
+	return nil
+}
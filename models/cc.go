@@ -35,6 +35,8 @@ type CCConfig struct {
 	Password        string `ini:"password"`
 
 	DefaultCluster string `ini:"default_cluster"`
+	// 定时检查默认集群中proxy加载的namespace配置是否与配置中心一致, 单位: 秒, 0表示不检查
+	DriftCheckInterval int `ini:"drift_check_interval"`
 
 	LogPath       string `ini:"log_path"`
 	LogLevel      string `ini:"log_level"`
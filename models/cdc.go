@@ -0,0 +1,65 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+)
+
+const defaultCDCQueueSize = 10000
+
+// CDC means config of publishing row change events of writes through gaea to kafka after commit
+type CDC struct {
+	Brokers   []string    `json:"brokers"`    // Kafka broker地址列表, 用于获取集群元数据
+	Topic     string      `json:"topic"`      // 变更事件发往的topic
+	Tables    []*CDCTable `json:"tables"`     // 发布变更事件的逻辑表
+	QueueSize int         `json:"queue_size"` // 等待发送的事件数上限, 超过时丢弃, 默认为10000
+}
+
+// CDCTable means logical table to publish change events and its primary key
+type CDCTable struct {
+	DB         string `json:"db"`
+	Table      string `json:"table"`
+	PrimaryKey string `json:"primary_key"` // 主键列, 从SQL中提取主键值, 不支持联合主键
+}
+
+// GetQueueSize return queue size of cdc, default is 10000
+func (c *CDC) GetQueueSize() int {
+	if c.QueueSize > 0 {
+		return c.QueueSize
+	}
+	return defaultCDCQueueSize
+}
+
+func (c *CDC) verify() error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("must specify brokers of cdc")
+	}
+	if c.Topic == "" {
+		return fmt.Errorf("must specify topic of cdc")
+	}
+	if len(c.Tables) == 0 {
+		return fmt.Errorf("must specify tables of cdc")
+	}
+	for _, t := range c.Tables {
+		if t.DB == "" || t.Table == "" || t.PrimaryKey == "" {
+			return fmt.Errorf("db, table and primary_key of cdc table should be set: %+v", *t)
+		}
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("queue_size of cdc should be >= 0")
+	}
+	return nil
+}
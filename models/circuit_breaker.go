@@ -0,0 +1,72 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "fmt"
+
+const (
+	defaultCircuitBreakerMinRequests = 20
+	defaultCircuitBreakerOpenTime    = 10
+	defaultCircuitBreakerProbes      = 3
+)
+
+// CircuitBreaker means config of circuit breaker on slave instances of slice
+type CircuitBreaker struct {
+	Window      int `json:"window"`       // 统计窗口, 单位: 秒, 为0时不开启熔断
+	MinRequests int `json:"min_requests"` // 窗口内请求数达到该值才会判断熔断, 默认为20
+	ErrorRate   int `json:"error_rate"`   // 窗口内错误率百分比达到该值时熔断, 为0时不按错误率熔断
+	P99Latency  int `json:"p99_latency"`  // 窗口内p99响应时间超过该值时熔断, 单位: 毫秒, 为0时不按响应时间熔断
+	OpenTime    int `json:"open_time"`    // 熔断持续时间, 之后进入半开状态放行探测请求, 单位: 秒, 默认为10
+	Probes      int `json:"probes"`       // 半开状态放行的探测请求数, 全部成功后恢复, 默认为3
+}
+
+// IsEnabled check if circuit breaker is enabled
+func (c *CircuitBreaker) IsEnabled() bool {
+	return c != nil && c.Window > 0 && (c.ErrorRate > 0 || c.P99Latency > 0)
+}
+
+// GetMinRequests return min requests in window, default is 20
+func (c *CircuitBreaker) GetMinRequests() int {
+	if c.MinRequests > 0 {
+		return c.MinRequests
+	}
+	return defaultCircuitBreakerMinRequests
+}
+
+// GetOpenTime return open time in seconds, default is 10
+func (c *CircuitBreaker) GetOpenTime() int {
+	if c.OpenTime > 0 {
+		return c.OpenTime
+	}
+	return defaultCircuitBreakerOpenTime
+}
+
+// GetProbes return probes in half open state, default is 3
+func (c *CircuitBreaker) GetProbes() int {
+	if c.Probes > 0 {
+		return c.Probes
+	}
+	return defaultCircuitBreakerProbes
+}
+
+func (c *CircuitBreaker) verify() error {
+	if c.Window < 0 || c.MinRequests < 0 || c.P99Latency < 0 || c.OpenTime < 0 || c.Probes < 0 {
+		return fmt.Errorf("window, min_requests, p99_latency, open_time and probes of circuit breaker should be >= 0")
+	}
+	if c.ErrorRate < 0 || c.ErrorRate > 100 {
+		return fmt.Errorf("error_rate of circuit breaker should be in [0, 100]")
+	}
+	return nil
+}
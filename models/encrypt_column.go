@@ -0,0 +1,52 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EncryptAlgorithmAESGCM encrypt column with AES-GCM, key length should be 16, 24 or 32 bytes
+const EncryptAlgorithmAESGCM = "aes-gcm"
+
+// EncryptColumn means config of column encrypted by proxy, values are encrypted when written and decrypted when read
+type EncryptColumn struct {
+	Table     string `json:"table"`     // 逻辑表名, 分表时同样适用于各个子表
+	Column    string `json:"column"`    // 列名, 列类型需为字符串类型, 存储base64编码后的密文
+	Algorithm string `json:"algorithm"` // 加密算法, 目前只支持aes-gcm, 默认为aes-gcm
+	KeyID     string `json:"key_id"`    // 密钥ID, 从proxy配置的encrypt_key_provider中获取密钥
+}
+
+// Encode means encode for easy use
+func (p *EncryptColumn) Encode() []byte {
+	return JSONEncode(p)
+}
+
+func (p *EncryptColumn) verify() error {
+	if strings.TrimSpace(p.Table) == "" || strings.TrimSpace(p.Column) == "" {
+		return fmt.Errorf("table and column of encrypt column must be specified, config: %s", p.Encode())
+	}
+	if p.Algorithm == "" {
+		p.Algorithm = EncryptAlgorithmAESGCM
+	}
+	if p.Algorithm != EncryptAlgorithmAESGCM {
+		return fmt.Errorf("unsupported encrypt algorithm: %s, config: %s", p.Algorithm, p.Encode())
+	}
+	if p.KeyID == "" {
+		return fmt.Errorf("key id of encrypt column must be specified, config: %s", p.Encode())
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+)
+
+// GeneralLog means config of reducing volume of general log of successful statements,
+// error and slow statements are always logged
+type GeneralLog struct {
+	SampleRate   int      `json:"sample_rate"`   // 每 N 条语句记录 1 条, 默认为 0 即全部记录
+	Users        []string `json:"users"`         // 只记录这些用户的语句, 默认为空即记录所有用户
+	SuppressSQLs []string `json:"suppress_sqls"` // 不记录的SQL, 按指纹匹配, 如高频的心跳语句
+}
+
+func (g *GeneralLog) verify(n *Namespace) error {
+	if g.SampleRate < 0 {
+		return fmt.Errorf("sample_rate of general log should be >= 0")
+	}
+	for _, name := range g.Users {
+		found := false
+		for _, u := range n.Users {
+			if u.UserName == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("user %s of general log not found in namespace", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GlobalUniqueKey means config of column unique across all shards of a sharding table, values are kept in an index
+// table whose primary key is the value, it's written before the insert in the same transaction
+type GlobalUniqueKey struct {
+	DB         string `json:"db"`          // 逻辑库名
+	Table      string `json:"table"`       // 逻辑表名
+	Column     string `json:"column"`      // 全局唯一列, 不需要是分片列
+	SliceName  string `json:"slice_name"`  // 索引表所在的分片
+	IndexTable string `json:"index_table"` // 索引表, 格式为 物理库名.表名, 需要预先创建, 如 CREATE TABLE t (v VARCHAR(255) NOT NULL PRIMARY KEY)
+}
+
+// Encode means encode for easy use
+func (p *GlobalUniqueKey) Encode() []byte {
+	return JSONEncode(p)
+}
+
+// GetIndexTable return physical db and table of index table
+func (p *GlobalUniqueKey) GetIndexTable() (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(p.IndexTable), ".", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func (p *GlobalUniqueKey) verify(slices map[string]bool) error {
+	if strings.TrimSpace(p.DB) == "" || strings.TrimSpace(p.Table) == "" || strings.TrimSpace(p.Column) == "" {
+		return fmt.Errorf("db, table and column of global unique key must be specified, config: %s", p.Encode())
+	}
+	if !slices[p.SliceName] {
+		return fmt.Errorf("slice of global unique key not found, config: %s", p.Encode())
+	}
+	if db, table := p.GetIndexTable(); db == "" || table == "" {
+		return fmt.Errorf("index table of global unique key should be db.table, config: %s", p.Encode())
+	}
+	return nil
+}
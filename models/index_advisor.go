@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+)
+
+const (
+	defaultIndexAdvisorInterval = 300
+	defaultIndexAdvisorTopN     = 20
+)
+
+// IndexAdvisor means config of learning indexes used by frequent sqls, FORCE INDEX hints are proposed
+// when plans of them regress, and injected after approved by admin api
+type IndexAdvisor struct {
+	Interval int `json:"interval"` // EXPLAIN 频繁SQL的间隔, 单位秒, 默认为300
+	TopN     int `json:"top_n"`    // 每次 EXPLAIN 的SQL指纹数, 按最近一个间隔内的总耗时排序, 默认为20
+}
+
+// GetInterval return interval of index advisor in seconds, default is 300
+func (a *IndexAdvisor) GetInterval() int {
+	if a.Interval > 0 {
+		return a.Interval
+	}
+	return defaultIndexAdvisorInterval
+}
+
+// GetTopN return count of fingerprints explained in each interval, default is 20
+func (a *IndexAdvisor) GetTopN() int {
+	if a.TopN > 0 {
+		return a.TopN
+	}
+	return defaultIndexAdvisorTopN
+}
+
+func (a *IndexAdvisor) verify(n *Namespace) error {
+	if n.SQLStatsCapacity <= 0 {
+		return fmt.Errorf("index advisor requires sql_stats_capacity > 0")
+	}
+	if a.Interval < 0 || a.TopN < 0 {
+		return fmt.Errorf("interval and top_n of index advisor should be >= 0")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mask types of MaskRule
+const (
+	MaskTypePartial = "partial" // 保留首尾部分字符, 其余用*代替
+	MaskTypeHash    = "hash"    // 替换为以命名空间mask_key_id为密钥的HMAC-SHA256十六进制值
+	MaskTypeNull    = "null"    // 替换为NULL
+)
+
+// MaskRule means config of column masking, the column in result set will be masked for users not unmasked
+type MaskRule struct {
+	Table  string `json:"table"`  // 逻辑表名, 分表时同样适用于各个子表
+	Column string `json:"column"` // 列名
+	Type   string `json:"type"`   // 脱敏方式: partial, hash, null
+}
+
+// Encode means encode for easy use
+func (p *MaskRule) Encode() []byte {
+	return JSONEncode(p)
+}
+
+func (p *MaskRule) verify() error {
+	if strings.TrimSpace(p.Table) == "" || strings.TrimSpace(p.Column) == "" {
+		return fmt.Errorf("table and column of mask rule must be specified, rule: %s", p.Encode())
+	}
+	switch p.Type {
+	case MaskTypePartial, MaskTypeHash, MaskTypeNull:
+		return nil
+	default:
+		return fmt.Errorf("invalid mask type: %s, rule: %s", p.Type, p.Encode())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultMirrorConcurrency = 4
+	defaultMirrorQueueSize   = 1024
+)
+
+// Mirror means config of mirroring traffic to a shadow slice, responses of mirror are discarded
+type Mirror struct {
+	Slice       string   `json:"slice"`        // 镜像流量发往的slice, 需在slices中配置, 且不能是default_slice
+	ReadPercent int      `json:"read_percent"` // 镜像读流量的百分比, 0-100
+	Tables      []string `json:"tables"`       // 镜像全部读写流量的逻辑表, 格式为db.table
+	Concurrency int      `json:"concurrency"`  // 同时执行镜像SQL的数量, 默认为4
+	QueueSize   int      `json:"queue_size"`   // 等待执行的镜像SQL数上限, 超过时丢弃, 默认为1024
+}
+
+// GetConcurrency return concurrency of mirror, default is 4
+func (m *Mirror) GetConcurrency() int {
+	if m.Concurrency > 0 {
+		return m.Concurrency
+	}
+	return defaultMirrorConcurrency
+}
+
+// GetQueueSize return queue size of mirror, default is 1024
+func (m *Mirror) GetQueueSize() int {
+	if m.QueueSize > 0 {
+		return m.QueueSize
+	}
+	return defaultMirrorQueueSize
+}
+
+func (m *Mirror) verify(n *Namespace) error {
+	if m.Slice == "" {
+		return fmt.Errorf("must specify slice of mirror")
+	}
+	if m.Slice == n.DefaultSlice {
+		return fmt.Errorf("slice of mirror should not be default slice: %s", m.Slice)
+	}
+	found := false
+	for _, s := range n.Slices {
+		if s.Name == m.Slice {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("slice of mirror not found: %s", m.Slice)
+	}
+	if m.ReadPercent < 0 || m.ReadPercent > 100 {
+		return fmt.Errorf("read_percent of mirror should be in [0, 100]")
+	}
+	if m.Concurrency < 0 || m.QueueSize < 0 {
+		return fmt.Errorf("concurrency and queue_size of mirror should be >= 0")
+	}
+	for _, t := range m.Tables {
+		parts := strings.Split(t, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid table of mirror: %s, should be db.table", t)
+		}
+	}
+	return nil
+}
@@ -15,9 +15,11 @@
 package models
 
 import (
+	"crypto/md5"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -28,37 +30,105 @@ import (
 	"github.com/XiaoMi/Gaea/util/crypto"
 )
 
+// 统计从库均不可用时统计用户读请求的处理策略
+const (
+	// StatisticSpillOverFail 返回错误
+	StatisticSpillOverFail = "fail"
+	// StatisticSpillOverSlave 使用普通从库
+	StatisticSpillOverSlave = "slave"
+	// StatisticSpillOverMaster 使用主库
+	StatisticSpillOverMaster = "master"
+)
+
+// 慢SQL执行计划的采集方式
+const (
+	// SlowSQLExplainPlain 执行 EXPLAIN
+	SlowSQLExplainPlain = "explain"
+	// SlowSQLExplainAnalyze 执行 EXPLAIN ANALYZE, 会再次执行SQL, 只对SELECT生效, 需MySQL 8.0.18及以上版本
+	SlowSQLExplainAnalyze = "analyze"
+)
+
 // Namespace means namespace model stored in etcd
 type Namespace struct {
-	OpenGeneralLog          bool              `json:"open_general_log"`
-	IsEncrypt               bool              `json:"is_encrypt"` // true: 加密存储 false: 非加密存储，目前加密Slice、User中的用户名、密码
-	Name                    string            `json:"name"`
-	Online                  bool              `json:"online"`
-	ReadOnly                bool              `json:"read_only"`
-	AllowedDBS              map[string]bool   `json:"allowed_dbs"`
-	DefaultPhyDBS           map[string]string `json:"default_phy_dbs"`
-	SlowSQLTime             string            `json:"slow_sql_time"`
-	BlackSQL                []string          `json:"black_sql"`
-	AllowedIP               []string          `json:"allowed_ip"`
-	Slices                  []*Slice          `json:"slices"`
-	ShardRules              []*Shard          `json:"shard_rules"`
-	Users                   []*User           `json:"users"` // 客户端接入proxy用户，每个用户可以设置读写分离、读写权限等
-	DefaultSlice            string            `json:"default_slice"`
-	GlobalSequences         []*GlobalSequence `json:"global_sequences"`
-	DefaultCharset          string            `json:"default_charset"`
-	DefaultCollation        string            `json:"default_collation"`
-	MaxSqlExecuteTime       int               `json:"max_sql_execute_time"`      // sql最大执行时间，大于该时间，进行熔断
-	MaxSqlResultSize        int               `json:"max_sql_result_size"`       // 限制单分片返回结果集大小不超过max_select_rows
-	MaxClientConnections    int               `json:"max_client_connections"`    // namespace中最大的前端连接数
-	DownAfterNoAlive        int               `json:"down_after_no_alive"`       // 如果探测MySQL服务offline超过该时间后标记mysql为下线
-	SecondsBehindMaster     uint64            `json:"seconds_behind_master"`     // slave延迟超过该值将slave标记为down, 默认值为0，即无限大
-	CheckSelectLock         bool              `json:"check_select_lock"`         // 是否将 select for update 语句打到主库
-	SupportMultiQuery       bool              `json:"support_multi_query"`       //是否支持多语句
-	LocalSlaveReadPriority  int               `json:"local_slave_read_priority"` //是否可以跨机房访问从库
-	SetForKeepSession       bool              `json:"set_for_keep_session"`      // 是否支持业务连接会话保持
-	ClientQPSLimit          uint32            `json:"client_qps_limit"`          // Namespace 级别的 qps 限制，默认为 0，即不开启
-	SupportLimitTransaction bool              `json:"support_limit_transaction"` // 是否支持限制事务
-	AllowedSessionVariables map[string]string `json:"allowed_session_variables"` // 允许设置的会话变量
+	OpenGeneralLog          bool               `json:"open_general_log"`
+	IsEncrypt               bool               `json:"is_encrypt"` // true: 加密存储 false: 非加密存储，目前加密Slice、User中的用户名、密码
+	Name                    string             `json:"name"`
+	Online                  bool               `json:"online"`
+	ReadOnly                bool               `json:"read_only"`
+	AllowedDBS              map[string]bool    `json:"allowed_dbs"`
+	DefaultPhyDBS           map[string]string  `json:"default_phy_dbs"`
+	SlowSQLTime             string             `json:"slow_sql_time"`
+	BlackSQL                []string           `json:"black_sql"`
+	AllowedIP               []string           `json:"allowed_ip"`
+	Slices                  []*Slice           `json:"slices"`
+	ShardRules              []*Shard           `json:"shard_rules"`
+	Users                   []*User            `json:"users"` // 客户端接入proxy用户，每个用户可以设置读写分离、读写权限等
+	DefaultSlice            string             `json:"default_slice"`
+	GlobalSequences         []*GlobalSequence  `json:"global_sequences"`
+	DefaultCharset          string             `json:"default_charset"`
+	DefaultCollation        string             `json:"default_collation"`
+	SQLMode                 string             `json:"sql_mode"`                  // 会话默认的sql_mode, 在使用的所有后端连接上设置并校验以保证各分片一致, 客户端可通过SET sql_mode修改, 默认为空即使用后端MySQL的配置
+	TimeZone                string             `json:"time_zone"`                 // 会话默认的time_zone, 如 +08:00, 在使用的所有后端连接上设置, 保证各分片TIMESTAMP的转换和比较一致, 默认为空即使用后端MySQL的配置
+	ServerVersion           string             `json:"server_version"`            // 客户端认证后看到的服务端版本, 如 8.0.32, 默认为空即使用 proxy 的 server_version, 所有 namespace 配置相同时也用于握手包
+	DisabledCapabilities    []string           `json:"disabled_capabilities"`     // 客户端认证后关闭的能力标志, 可选 multi_statements, multi_results, ps_multi_results, local_files, 所有 namespace 均关闭时握手包中不再声明
+	MaxSqlExecuteTime       int                `json:"max_sql_execute_time"`      // sql最大执行时间，大于该时间，进行熔断
+	MaxSqlResultSize        int                `json:"max_sql_result_size"`       // 限制单分片返回结果集大小不超过max_select_rows
+	SlowSQLKillTime         int                `json:"slow_sql_kill_time"`        // 执行时间超过该值的语句被主动kill, 单位: 毫秒, 默认为 0 即不开启, 可被用户的 slow_sql_kill_time 覆盖
+	SlowSQLKillWhitelist    []string           `json:"slow_sql_kill_whitelist"`   // 不会被主动kill的SQL, 按指纹匹配, 如已知的批处理任务
+	SlowSQLExplain          string             `json:"slow_sql_explain"`          // 慢SQL执行计划的采集方式: explain, analyze, 在执行该SQL的后端实例上异步执行, 默认为空即不采集
+	MaxClientConnections    int                `json:"max_client_connections"`    // namespace中最大的前端连接数
+	SessionIdleTimeout      int                `json:"session_idle_timeout"`      // 前端连接空闲超过该时间后返回错误并关闭, 单位: 分钟, 默认为 0 即使用 proxy 的 session_timeout
+	NetReadTimeout          int                `json:"net_read_timeout"`          // 读取客户端请求包剩余部分的超时时间, 单位: 秒, 默认为 0 即不限制
+	NetWriteTimeout         int                `json:"net_write_timeout"`         // 向客户端写入结果的超时时间, 单位: 秒, 默认为 0 即不限制
+	MaxAllowedPacket        int                `json:"max_allowed_packet"`        // 客户端请求包的最大长度, 超过时返回 ERROR 1153 并关闭连接, 单位: 字节, 默认为 0 即不限制
+	DownAfterNoAlive        int                `json:"down_after_no_alive"`       // 如果探测MySQL服务offline超过该时间后标记mysql为下线
+	SecondsBehindMaster     uint64             `json:"seconds_behind_master"`     // slave延迟超过该值将slave标记为down, 默认值为0，即无限大
+	CheckSelectLock         bool               `json:"check_select_lock"`         // 是否将 select for update 语句打到主库
+	SupportMultiQuery       bool               `json:"support_multi_query"`       //是否支持多语句
+	LocalSlaveReadPriority  int                `json:"local_slave_read_priority"` //是否可以跨机房访问从库
+	StatisticSpillOver      string             `json:"statistic_spill_over"`      // 统计从库均不可用时统计用户读请求的处理策略, fail: 返回错误(默认), slave: 使用普通从库, master: 使用主库
+	SetForKeepSession       bool               `json:"set_for_keep_session"`      // 是否支持业务连接会话保持
+	Multiplexing            bool               `json:"multiplexing"`              // 会话保持时按语句/事务绑定后端连接, 空闲时归还连接池
+	ReadRetryAttempts       int                `json:"read_retry_attempts"`       // 从库读请求因后端连接错误失败时, 最多尝试的次数(含首次), 默认为0即不重试
+	ReadOnlyTxToSlave       bool               `json:"read_only_tx_to_slave"`     // 只读事务整体路由到从库, 仅对读写分离用户生效, 默认为 false
+	DMLRetryAttempts        int                `json:"dml_retry_attempts"`        // 事务外的单语句 DML 因死锁或锁等待超时失败时, 最多执行的次数(含首次), 默认为0即不重试
+	DMLRetryBackoff         int                `json:"dml_retry_backoff"`         // DML 重试前的等待时间, 每次重试翻倍, 单位: 毫秒, 默认为 10
+	ClientQPSLimit          uint32             `json:"client_qps_limit"`          // Namespace 级别的 qps 限制，默认为 0，即不开启
+	MaxResultMemory         int64              `json:"max_result_memory"`         // Namespace 级别的结果集内存上限, 单位: MB, 默认为 0 即不限制
+	MaxBackendConcurrency   int                `json:"max_backend_concurrency"`   // Namespace 级别同时执行的后端 SQL 数上限, 默认为 0 即不限制
+	MaxConcurrentQueries    int                `json:"max_concurrent_queries"`    // Namespace 级别同时执行的查询数上限, 超过时排队等待, 默认为 0 即不限制
+	QueryQueueSize          int                `json:"query_queue_size"`          // 超过并发查询上限时最多排队的查询数, 默认为 0 即不排队
+	QueryQueueTimeout       int                `json:"query_queue_timeout"`       // 查询排队等待超时时间, 单位: 毫秒, 默认为 1000
+	QueryPriority           string             `json:"query_priority"`            // 用户查询排队的默认优先级, high 或 low, 默认为空即统计用户为 low, 其他用户为 high
+	ScatterParallelism      int                `json:"scatter_parallelism"`       // 跨分片查询同时执行的分片数上限, 默认为 0 即所有分片同时执行
+	ScatterShardTimeout     int                `json:"scatter_shard_timeout"`     // 跨分片查询中单个分片的执行超时时间, 单位: 毫秒, 默认为 0 即不限制
+	ScatterPartialResult    bool               `json:"scatter_partial_result"`    // 跨分片 SELECT 部分分片失败时是否返回其余分片的结果, 默认为 false 即任一分片失败则返回错误
+	ScatterPipelineDepth    int                `json:"scatter_pipeline_depth"`    // 跨分片查询中同一分片连接上先发送后读取结果的 SQL 数上限, 默认为 0 即逐条执行
+	SQLStatsCapacity        int                `json:"sql_stats_capacity"`        // 按SQL指纹统计执行次数、错误数、行数和延迟分位数的指纹数上限, 默认为 0 即不统计
+	TableStatsCapacity      int                `json:"table_stats_capacity"`      // 按逻辑表统计读写QPS和延迟的表数上限, 默认为 0 即不统计
+	PlanCacheCapacity       int                `json:"plan_cache_capacity"`       // 按参数化SQL缓存不分片语句执行计划的条目数上限, 默认为 0 即不缓存
+	Mirror                  *Mirror            `json:"mirror,omitempty"`          // 流量镜像配置, 将部分读流量或指定表的全部流量异步复制到镜像slice
+	IndexAdvisor            *IndexAdvisor      `json:"index_advisor,omitempty"`   // 索引顾问配置, 定期EXPLAIN频繁SQL, 执行计划退化时建议FORCE INDEX, 审批后注入
+	GeneralLog              *GeneralLog        `json:"general_log,omitempty"`     // 成功语句的general log采样、用户过滤和指纹屏蔽, 错误和慢SQL总是记录
+	BackendError            *BackendError      `json:"backend_error,omitempty"`   // 在后端MySQL返回的错误信息后追加slice、db和后端地址(可配置别名), 默认不开启
+	OSCCompatible           bool               `json:"osc_compatible"`            // 兼容gh-ost/pt-osc, 将其辅助表按原分片表路由, 并在所有分片上执行建表、改表、拷贝数据和RENAME
+	BinlogTailer            *BinlogTailer      `json:"binlog_tailer,omitempty"`   // 订阅slice主库binlog, 感知绕过gaea的数据和表结构变更
+	CDC                     *CDC               `json:"cdc,omitempty"`             // 写入提交后将行变更事件发布到Kafka
+	SupportLimitTransaction bool               `json:"support_limit_transaction"` // 是否支持限制事务
+	AllowedSessionVariables map[string]string  `json:"allowed_session_variables"` // 允许设置的会话变量
+	TrackSessionVariables   bool               `json:"track_session_variables"`   // 是否跟踪 allowed_session_variables 之外的常用会话变量, 默认为 false
+	LogSQLFingerprint       bool               `json:"log_sql_fingerprint"`       // SQL日志和慢日志中只记录SQL指纹, 不记录字面值, MySQL错误只记录错误码, 默认为 false
+	SlowLogFile             string             `json:"slow_log_file"`             // MySQL格式的慢日志文件, 相对proxy的log_path, 为空时不开启
+	SlowLogKeepDays         int                `json:"slow_log_keep_days"`        // 慢日志保留天数
+	SlowLogKeepCounts       int                `json:"slow_log_keep_counts"`      // 慢日志保留数量, 与 slow_log_keep_days 取最小值
+	CaptureFile             string             `json:"capture_file"`              // 流量录制文件, 记录客户端SQL及会话信息, 可用gaea-replay回放, 为空时不开启
+	CaptureMaxSize          int                `json:"capture_max_size"`          // 流量录制文件大小上限, 单位MB, 达到后停止录制, 默认为1024
+	MaskRules               []*MaskRule        `json:"mask_rules"`                // 结果集列脱敏规则, 对unmasked为false的用户生效
+	MaskKeyID               string             `json:"mask_key_id"`               // hash脱敏使用的HMAC密钥ID, 从proxy配置的encrypt_key_provider中获取, 有hash脱敏规则时必须配置
+	EncryptColumns          []*EncryptColumn   `json:"encrypt_columns"`           // 透明加密列, 写入时加密, 读取时解密
+	RewriteRules            []*RewriteRule     `json:"rewrite_rules"`             // SQL改写规则, 在生成执行计划前按顺序匹配, 只应用第一条匹配的规则
+	PurgeRules              []*PurgeRule       `json:"purge_rules"`               // 过期数据清理规则, 在后台按分片分批删除过期的行
+	GlobalUniqueKeys        []*GlobalUniqueKey `json:"global_unique_keys"`        // 跨分片全局唯一列, 写入时通过索引表检查唯一性
 }
 
 // Encode encode json
@@ -66,6 +136,11 @@ func (n *Namespace) Encode() []byte {
 	return JSONEncode(n)
 }
 
+// Version return md5 of json encoded config, config loaded from store by proxy and cc has the same version
+func (n *Namespace) Version() string {
+	return fmt.Sprintf("%x", md5.Sum(n.Encode()))
+}
+
 // Verify verify namespace contents
 func (n *Namespace) Verify() error {
 	if err := n.verifyName(); err != nil {
@@ -84,6 +159,144 @@ func (n *Namespace) Verify() error {
 		return err
 	}
 
+	if err := n.verifySlowLog(); err != nil {
+		return err
+	}
+
+	if err := n.verifyCapture(); err != nil {
+		return err
+	}
+
+	if err := n.verifyMultiplexing(); err != nil {
+		return err
+	}
+
+	if n.ReadRetryAttempts < 0 {
+		return fmt.Errorf("invalid read_retry_attempts: %d", n.ReadRetryAttempts)
+	}
+
+	if n.DMLRetryAttempts < 0 {
+		return fmt.Errorf("invalid dml_retry_attempts: %d", n.DMLRetryAttempts)
+	}
+
+	if n.DMLRetryBackoff < 0 {
+		return fmt.Errorf("invalid dml_retry_backoff: %d", n.DMLRetryBackoff)
+	}
+
+	if n.PlanCacheCapacity < 0 {
+		return fmt.Errorf("invalid plan_cache_capacity: %d", n.PlanCacheCapacity)
+	}
+
+	if n.MaxResultMemory < 0 {
+		return fmt.Errorf("invalid max_result_memory: %d", n.MaxResultMemory)
+	}
+
+	if n.MaxBackendConcurrency < 0 {
+		return fmt.Errorf("invalid max_backend_concurrency: %d", n.MaxBackendConcurrency)
+	}
+
+	if n.SlowSQLKillTime < 0 {
+		return fmt.Errorf("invalid slow_sql_kill_time: %d", n.SlowSQLKillTime)
+	}
+
+	switch n.SlowSQLExplain {
+	case "", SlowSQLExplainPlain, SlowSQLExplainAnalyze:
+	default:
+		return fmt.Errorf("invalid slow_sql_explain: %s", n.SlowSQLExplain)
+	}
+
+	if n.MaxConcurrentQueries < 0 || n.QueryQueueSize < 0 || n.QueryQueueTimeout < 0 {
+		return fmt.Errorf("invalid concurrent query limit, max_concurrent_queries: %d, query_queue_size: %d, query_queue_timeout: %d",
+			n.MaxConcurrentQueries, n.QueryQueueSize, n.QueryQueueTimeout)
+	}
+
+	switch n.StatisticSpillOver {
+	case "", StatisticSpillOverFail, StatisticSpillOverSlave, StatisticSpillOverMaster:
+	default:
+		return fmt.Errorf("invalid statistic_spill_over: %s", n.StatisticSpillOver)
+	}
+
+	if !IsValidQueryPriority(n.QueryPriority) {
+		return fmt.Errorf("invalid query_priority: %s", n.QueryPriority)
+	}
+
+	if n.SessionIdleTimeout < 0 {
+		return fmt.Errorf("invalid session_idle_timeout: %d", n.SessionIdleTimeout)
+	}
+
+	if n.NetReadTimeout < 0 || n.NetWriteTimeout < 0 {
+		return fmt.Errorf("invalid net timeout, net_read_timeout: %d, net_write_timeout: %d", n.NetReadTimeout, n.NetWriteTimeout)
+	}
+
+	if n.MaxAllowedPacket != 0 && (n.MaxAllowedPacket < mysql.MinAllowedPacketSize || n.MaxAllowedPacket > mysql.MaxAllowedPacketSize) {
+		return fmt.Errorf("invalid max_allowed_packet: %d, should be 0 or in [%d, %d]", n.MaxAllowedPacket, mysql.MinAllowedPacketSize, mysql.MaxAllowedPacketSize)
+	}
+
+	if n.ScatterParallelism < 0 || n.ScatterShardTimeout < 0 || n.ScatterPipelineDepth < 0 {
+		return fmt.Errorf("invalid scatter config, scatter_parallelism: %d, scatter_shard_timeout: %d, scatter_pipeline_depth: %d",
+			n.ScatterParallelism, n.ScatterShardTimeout, n.ScatterPipelineDepth)
+	}
+
+	if n.SQLStatsCapacity < 0 || n.TableStatsCapacity < 0 {
+		return fmt.Errorf("invalid stats capacity, sql_stats_capacity: %d, table_stats_capacity: %d", n.SQLStatsCapacity, n.TableStatsCapacity)
+	}
+
+	if n.IndexAdvisor != nil {
+		if err := n.IndexAdvisor.verify(n); err != nil {
+			return err
+		}
+	}
+
+	if n.GeneralLog != nil {
+		if err := n.GeneralLog.verify(n); err != nil {
+			return err
+		}
+	}
+
+	if n.BackendError != nil {
+		if err := n.BackendError.verify(); err != nil {
+			return err
+		}
+	}
+
+	if n.Mirror != nil {
+		if err := n.Mirror.verify(n); err != nil {
+			return err
+		}
+	}
+
+	if n.BinlogTailer != nil {
+		if err := n.BinlogTailer.verify(n); err != nil {
+			return err
+		}
+	}
+
+	if n.CDC != nil {
+		if err := n.CDC.verify(); err != nil {
+			return err
+		}
+	}
+
+	if err := n.verifyMaskRules(); err != nil {
+		return err
+	}
+
+	if err := n.verifyEncryptColumns(); err != nil {
+		return err
+	}
+
+	if err := n.verifyRewriteRules(); err != nil {
+		return err
+	}
+
+	if err := n.verifyPurgeRules(); err != nil {
+		return err
+	}
+
+	if err := n.verifyGlobalUniqueKeys(); err != nil {
+		return err
+	}
+
 	if err := n.verifyDBs(); err != nil {
 		return err
 	}
@@ -96,6 +309,18 @@ func (n *Namespace) Verify() error {
 		return err
 	}
 
+	if err := n.verifySQLMode(); err != nil {
+		return err
+	}
+
+	if err := n.verifyTimeZone(); err != nil {
+		return err
+	}
+
+	if err := n.verifyServerVersion(); err != nil {
+		return err
+	}
+
 	if err := n.verifySlices(); err != nil {
 		return err
 	}
@@ -152,6 +377,9 @@ func (n *Namespace) verifyUsers() error {
 		if err := u.verify(); err != nil {
 			return fmt.Errorf("user config error, schema: %s, %v", n.Name, err)
 		}
+		if err := u.verifyACL(n.AllowedDBS); err != nil {
+			return fmt.Errorf("user config error, schema: %s, %v", n.Name, err)
+		}
 
 		//check repeat username
 		for j := 0; j < i; j++ {
@@ -177,6 +405,112 @@ func (n *Namespace) verifySlowSQLTime() error {
 	return nil
 }
 
+func (n *Namespace) verifyMaskRules() error {
+	rules := make(map[string]bool, len(n.MaskRules))
+	for _, r := range n.MaskRules {
+		if err := r.verify(); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimSpace(r.Table) + "." + strings.TrimSpace(r.Column))
+		if rules[key] {
+			return fmt.Errorf("duplicate mask rule of %s", key)
+		}
+		rules[key] = true
+		// unkeyed hash of low entropy values such as phone number can be reversed by lookup table
+		if r.Type == MaskTypeHash && n.MaskKeyID == "" {
+			return fmt.Errorf("mask_key_id must be specified for hash mask rule of %s", key)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyEncryptColumns() error {
+	columns := make(map[string]bool, len(n.EncryptColumns))
+	for _, c := range n.EncryptColumns {
+		if err := c.verify(); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimSpace(c.Table) + "." + strings.TrimSpace(c.Column))
+		if columns[key] {
+			return fmt.Errorf("duplicate encrypt column of %s", key)
+		}
+		columns[key] = true
+	}
+	return nil
+}
+
+func (n *Namespace) verifyRewriteRules() error {
+	for _, r := range n.RewriteRules {
+		if err := r.verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyPurgeRules() error {
+	rules := make(map[string]bool, len(n.PurgeRules))
+	for _, r := range n.PurgeRules {
+		if err := r.verify(); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimSpace(r.DB) + "." + strings.TrimSpace(r.Table))
+		if rules[key] {
+			return fmt.Errorf("duplicate purge rule of %s", key)
+		}
+		rules[key] = true
+	}
+	return nil
+}
+
+func (n *Namespace) verifyGlobalUniqueKeys() error {
+	slices := make(map[string]bool, len(n.Slices))
+	for _, s := range n.Slices {
+		slices[s.Name] = true
+	}
+	keys := make(map[string]bool, len(n.GlobalUniqueKeys))
+	for _, k := range n.GlobalUniqueKeys {
+		if err := k.verify(slices); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimSpace(k.DB) + "." + strings.TrimSpace(k.Table) + "." + strings.TrimSpace(k.Column))
+		if keys[key] {
+			return fmt.Errorf("duplicate global unique key of %s", key)
+		}
+		keys[key] = true
+	}
+	return nil
+}
+
+func (n *Namespace) verifySlowLog() error {
+	if n.SlowLogKeepDays < 0 || n.SlowLogKeepCounts < 0 {
+		return fmt.Errorf("invalid slow log keep days: %d or keep counts: %d", n.SlowLogKeepDays, n.SlowLogKeepCounts)
+	}
+	// slow log file is relative to log_path of proxy, namespace config can't write files out of it
+	if n.SlowLogFile != "" {
+		f := filepath.Clean(n.SlowLogFile)
+		if filepath.IsAbs(f) || f == "." || f == ".." || strings.HasPrefix(f, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid slow log file: %s, it should be a relative path in log directory of proxy", n.SlowLogFile)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyCapture() error {
+	if n.CaptureMaxSize < 0 {
+		return fmt.Errorf("invalid capture max size: %d", n.CaptureMaxSize)
+	}
+	return nil
+}
+
+// verifyMultiplexing multiplexing only works with keep session, connections of other sessions are attached per statement already
+func (n *Namespace) verifyMultiplexing() error {
+	if n.Multiplexing && !n.SetForKeepSession {
+		return fmt.Errorf("multiplexing requires set_for_keep_session")
+	}
+	return nil
+}
+
 func (n *Namespace) isSlowSQLTimeExists() bool {
 	return n.SlowSQLTime != ""
 }
@@ -235,6 +569,22 @@ func (n *Namespace) verifyCharset() error {
 	return nil
 }
 
+func (n *Namespace) verifySQLMode() error {
+	if _, err := mysql.NormalizeSQLMode(n.SQLMode); err != nil {
+		return fmt.Errorf("verify sql_mode error: %v", err)
+	}
+	return nil
+}
+
+func (n *Namespace) verifyTimeZone() error {
+	if timeZone := strings.TrimSpace(n.TimeZone); timeZone != "" {
+		if err := mysql.VerifyTimeZone(timeZone); err != nil {
+			return fmt.Errorf("verify time_zone error: %v", err)
+		}
+	}
+	return nil
+}
+
 func (n *Namespace) verifySlices() error {
 	if n.isSlicesEmpty() {
 		return errors.New("empty slices")
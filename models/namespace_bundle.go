@@ -0,0 +1,279 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// NamespaceBundleVersion format version of namespace bundle
+	NamespaceBundleVersion = 1
+	// BundleVariablePrefix prefix of variables in namespace bundle, other environment variables can't be referenced
+	BundleVariablePrefix = "GAEA_"
+)
+
+var bundleVariableRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// NamespaceBundle exported namespace config, including its slices, shard rules, users and sequences,
+// it's signed by bundle key so that only bundles exported by trusted environments can be imported
+type NamespaceBundle struct {
+	Version    int        `json:"version"`
+	ExportTime string     `json:"export_time"`
+	Variables  []string   `json:"variables,omitempty"` // ${NAME} in namespace are replaced by environment variables when imported
+	Namespace  *Namespace `json:"namespace"`
+	Signature  string     `json:"signature"` // hex of hmac-sha256 of canonical json of the bundle without signature
+
+	payload []byte // canonical json of the bundle without signature as it's parsed, nil if it's built in memory
+}
+
+// NewNamespaceBundle create signed bundle of namespace, addresses and passwords of slices and passwords
+// of users are replaced by variables if template is true
+func NewNamespaceBundle(namespace *Namespace, template bool, key string) (*NamespaceBundle, error) {
+	n := &Namespace{}
+	if err := json.Unmarshal(namespace.Encode(), n); err != nil {
+		return nil, err
+	}
+	b := &NamespaceBundle{
+		Version:    NamespaceBundleVersion,
+		ExportTime: time.Now().Format("2006-01-02 15:04:05"),
+		Namespace:  n,
+	}
+	if template {
+		b.Variables = templateNamespace(n)
+	}
+	if err := b.Sign(key); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// templateNamespace replace addresses and passwords by variables, return names of variables
+func templateNamespace(n *Namespace) []string {
+	prefix := BundleVariablePrefix + bundleVariableName(n.Name) + "_"
+	var variables []string
+	replace := func(value *string, name string) {
+		if *value == "" {
+			return
+		}
+		name = prefix + name
+		variables = append(variables, name)
+		*value = "${" + name + "}"
+	}
+	for _, slice := range n.Slices {
+		s := bundleVariableName(slice.Name)
+		replace(&slice.Password, s+"_PASSWORD")
+		replace(&slice.Master, s+"_MASTER")
+		for i := range slice.Slaves {
+			replace(&slice.Slaves[i], fmt.Sprintf("%s_SLAVE_%d", s, i))
+		}
+		for i := range slice.StatisticSlaves {
+			replace(&slice.StatisticSlaves[i], fmt.Sprintf("%s_STATISTIC_SLAVE_%d", s, i))
+		}
+	}
+	for _, user := range n.Users {
+		replace(&user.Password, "USER_"+bundleVariableName(user.UserName)+"_PASSWORD")
+	}
+	return variables
+}
+
+// bundleVariableName convert name to upper case, characters except letters and digits are replaced by _
+func bundleVariableName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (b *NamespaceBundle) sign(key string) (string, error) {
+	payload := b.payload
+	if payload == nil {
+		unsigned := *b
+		unsigned.Signature = ""
+		data, err := json.Marshal(&unsigned)
+		if err != nil {
+			return "", err
+		}
+		if payload, _, err = canonicalBundle(data); err != nil {
+			return "", err
+		}
+	}
+	return signBundlePayload(payload, key)
+}
+
+func signBundlePayload(payload []byte, key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("missing bundle sign key")
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// canonicalBundle return json of bundle without signature whose keys are sorted and numbers are kept as they are,
+// so the same bundle in json and yaml has the same payload, and signature of bundle
+func canonicalBundle(data []byte) ([]byte, string, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc map[string]interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, "", err
+	}
+	signature, _ := doc["signature"].(string)
+	delete(doc, "signature")
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, signature, nil
+}
+
+// Sign set signature of bundle
+func (b *NamespaceBundle) Sign(key string) error {
+	signature, err := b.sign(key)
+	if err != nil {
+		return err
+	}
+	b.Signature = signature
+	return nil
+}
+
+// VerifySignature check if bundle is signed by key
+func (b *NamespaceBundle) VerifySignature(key string) error {
+	signature, err := b.sign(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(b.Signature)) {
+		return fmt.Errorf("invalid signature of namespace bundle")
+	}
+	return nil
+}
+
+// Expand return namespace whose variables are replaced by values returned by lookup
+func (b *NamespaceBundle) Expand(lookup func(string) (string, bool)) (*Namespace, error) {
+	if b.Namespace == nil {
+		return nil, fmt.Errorf("missing namespace of bundle")
+	}
+	values := make(map[string]string, len(b.Variables))
+	var missing []string
+	for _, name := range b.Variables {
+		if !strings.HasPrefix(name, BundleVariablePrefix) {
+			return nil, fmt.Errorf("variable %s should start with %s", name, BundleVariablePrefix)
+		}
+		value, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		// value is escaped as json string
+		v, _ := json.Marshal(value)
+		values[name] = string(v[1 : len(v)-1])
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing variables: %s", strings.Join(missing, ","))
+	}
+
+	data := bundleVariableRegexp.ReplaceAllFunc(b.Namespace.Encode(), func(m []byte) []byte {
+		if v, ok := values[string(m[2:len(m)-1])]; ok {
+			return []byte(v)
+		}
+		return m
+	})
+	n := &Namespace{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// EncodeYAML encode bundle as yaml, fields are in the same order as json
+func (b *NamespaceBundle) EncodeYAML() ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(JSONEncode(b), &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// ParseNamespaceBundle parse bundle in json or yaml, signature is verified against the bundle as it's parsed
+// before it's decoded, so fields unknown to this version of gaea are signed too
+func ParseNamespaceBundle(data []byte, key string) (*NamespaceBundle, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(yamlToJSON(doc)); err != nil {
+			return nil, err
+		}
+	}
+	payload, signature, err := canonicalBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := signBundlePayload(payload, key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, fmt.Errorf("invalid signature of namespace bundle")
+	}
+
+	b := &NamespaceBundle{payload: payload}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Version != NamespaceBundleVersion {
+		return nil, fmt.Errorf("unsupported version of namespace bundle: %d", b.Version)
+	}
+	return b, nil
+}
+
+// yamlToJSON convert maps decoded by yaml to maps with string keys
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlToJSON(item)
+		}
+	}
+	return v
+}
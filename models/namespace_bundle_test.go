@@ -0,0 +1,92 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bundleNamespace() *Namespace {
+	n := defaultNamespace()
+	n.Name = "order-db"
+	n.AllowedDBS["db1"] = true
+	n.Slices = append(n.Slices, &Slice{Name: "slice-0", UserName: "root", Password: `p"wd`, Master: "10.0.0.1:3306",
+		Slaves: []string{"10.0.0.2:3306@2"}, StatisticSlaves: []string{}})
+	n.Users = append(n.Users, &User{UserName: "app", Password: "app_pwd", Namespace: "order-db", RWFlag: 2})
+	n.ShardRules = append(n.ShardRules, &Shard{DB: "db1", Table: "t", Type: "hash", Key: "id", Locations: []int{1}, Slices: []string{"slice-0"}})
+	return n
+}
+
+func TestNamespaceBundle(t *testing.T) {
+	n := bundleNamespace()
+	b, err := NewNamespaceBundle(n, true, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"GAEA_ORDER_DB_SLICE_0_PASSWORD", "GAEA_ORDER_DB_SLICE_0_MASTER",
+		"GAEA_ORDER_DB_SLICE_0_SLAVE_0", "GAEA_ORDER_DB_USER_APP_PASSWORD"}, b.Variables)
+	assert.Equal(t, "${GAEA_ORDER_DB_SLICE_0_MASTER}", b.Namespace.Slices[0].Master)
+	// namespace exported is not modified
+	assert.Equal(t, "10.0.0.1:3306", n.Slices[0].Master)
+
+	json := JSONEncode(b)
+	y, err := b.EncodeYAML()
+	assert.Nil(t, err)
+	for _, data := range [][]byte{json, y} {
+		parsed, err := ParseNamespaceBundle(data, "key")
+		assert.Nil(t, err)
+		assert.Nil(t, parsed.VerifySignature("key"))
+		_, err = ParseNamespaceBundle(data, "other")
+		assert.NotNil(t, err)
+
+		env := map[string]string{
+			"GAEA_ORDER_DB_SLICE_0_PASSWORD":  `p"wd`,
+			"GAEA_ORDER_DB_SLICE_0_MASTER":    "10.0.0.1:3306",
+			"GAEA_ORDER_DB_SLICE_0_SLAVE_0":   "10.0.0.2:3306@2",
+			"GAEA_ORDER_DB_USER_APP_PASSWORD": "app_pwd",
+		}
+		expanded, err := parsed.Expand(func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, n.Version(), expanded.Version())
+
+		_, err = parsed.Expand(func(name string) (string, bool) { return "", false })
+		assert.NotNil(t, err)
+	}
+
+	// modified bundle is rejected
+	b.Namespace.Slices[0].Master = "10.0.0.3:3306"
+	assert.NotNil(t, b.VerifySignature("key"))
+
+	_, err = NewNamespaceBundle(n, false, "")
+	assert.NotNil(t, err)
+	_, err = ParseNamespaceBundle([]byte(`{"version": 2}`), "key")
+	assert.NotNil(t, err)
+
+	// fields unknown to the struct are signed too
+	data := JSONEncode(b)
+	_, err = ParseNamespaceBundle(data, "key")
+	assert.NotNil(t, err)
+	assert.Nil(t, b.Sign("key"))
+	data = JSONEncode(b)
+	_, err = ParseNamespaceBundle(data, "key")
+	assert.Nil(t, err)
+	data = bytes.Replace(data, []byte(`"version": 1,`), []byte(`"version": 1, "extra": "x",`), 1)
+	_, err = ParseNamespaceBundle(data, "key")
+	assert.NotNil(t, err)
+}
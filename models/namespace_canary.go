@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "fmt"
+
+// NamespaceCanary means namespace config applied to part of proxies first, it's promoted to all proxies
+// or rolled back after verified by metrics of canary proxies
+type NamespaceCanary struct {
+	Namespace  *Namespace `json:"namespace"`
+	Proxies    []string   `json:"proxies"` // 灰度proxy的token, 即管理地址 ip:admin_port
+	CreateTime string     `json:"create_time"`
+}
+
+// Encode encode json
+func (c *NamespaceCanary) Encode() []byte {
+	return JSONEncode(c)
+}
+
+// HasProxy check if the proxy is in canary
+func (c *NamespaceCanary) HasProxy(token string) bool {
+	for _, p := range c.Proxies {
+		if p == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify verify canary contents
+func (c *NamespaceCanary) Verify() error {
+	if c.Namespace == nil {
+		return fmt.Errorf("missing namespace of canary")
+	}
+	if len(c.Proxies) == 0 {
+		return fmt.Errorf("missing proxies of canary")
+	}
+	return c.Namespace.Verify()
+}
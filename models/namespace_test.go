@@ -63,6 +63,18 @@ func TestNamespaceEncode(t *testing.T) {
 	t.Logf(string(namespace.Encode()))
 }
 
+func TestNamespaceVersion(t *testing.T) {
+	n := defaultNamespace()
+	version := n.Version()
+	if len(version) != 32 || version != defaultNamespace().Version() {
+		t.Errorf("version of the same config should be the same, %s", version)
+	}
+	n.MaxClientConnections++
+	if n.Version() == version {
+		t.Errorf("version should change with config")
+	}
+}
+
 func TestEncrypt(t *testing.T) {
 	key := "1234abcd5678efg*"
 	var namespace = &Namespace{Name: "gaea_namespace_1", Online: true, ReadOnly: true, AllowedDBS: make(map[string]bool), Slices: make([]*Slice, 0), ShardRules: make([]*Shard, 0), Users: make([]*User, 0), DefaultSlice: "slice-0"}
@@ -141,6 +153,46 @@ func TestVerifyUsers_Error(t *testing.T) {
 	}
 }
 
+func TestVerifyUsers_ACL(t *testing.T) {
+	n := defaultNamespace()
+	n.AllowedDBS["db1"] = true
+	n.AllowedDBS["DB2"] = true
+	u := &User{UserName: "u1", Namespace: n.Name, Password: "pw1", RWFlag: ReadWrite, RWSplit: ReadWriteSplit,
+		AllowedDBs: []string{"db1"}, AllowedTables: []string{"db1.t1", "db2.*"}}
+	n.Users = append(n.Users, u)
+	if err := n.verifyUsers(); err != nil {
+		t.Errorf("test verifyUsers failed, %v", err)
+	}
+
+	tests := []struct {
+		allowedDBs    []string
+		allowedTables []string
+	}{
+		{allowedDBs: []string{"db3"}},
+		{allowedTables: []string{"db3.t1"}},
+		{allowedTables: []string{"t1"}},
+		{allowedTables: []string{"db1."}},
+		{allowedTables: []string{"db1.t1.c1"}},
+	}
+	for _, test := range tests {
+		u.AllowedDBs, u.AllowedTables = test.allowedDBs, test.allowedTables
+		if err := n.verifyUsers(); err == nil {
+			t.Errorf("test verifyUsers should fail but pass, user: %s", JSONEncode(u))
+		}
+	}
+}
+
+func TestParseAllowedTable(t *testing.T) {
+	db, table, err := ParseAllowedTable(" DB1.Tbl1 ")
+	if err != nil || db != "db1" || table != "tbl1" {
+		t.Errorf("test ParseAllowedTable failed, db: %s, table: %s, err: %v", db, table, err)
+	}
+	db, table, err = ParseAllowedTable("db1.*")
+	if err != nil || db != "db1" || table != "*" {
+		t.Errorf("test ParseAllowedTable failed, db: %s, table: %s, err: %v", db, table, err)
+	}
+}
+
 func TestVerifySlowSQLTime_Success(t *testing.T) {
 	n := defaultNamespace()
 	ssts := []string{"", "10"}
@@ -163,6 +215,360 @@ func TestVerifySlowSQLTime_Error(t *testing.T) {
 	}
 }
 
+func TestVerifySlowLog(t *testing.T) {
+	n := defaultNamespace()
+	for _, f := range []string{"", "slow.log", "slow/ns.log", "a/../slow.log"} {
+		n.SlowLogFile = f
+		if err := n.verifySlowLog(); err != nil {
+			t.Errorf("test verify slow log file %s failed, %v", f, err)
+		}
+	}
+	for _, f := range []string{"/tmp/slow.log", "../slow.log", "a/../../slow.log", ".."} {
+		n.SlowLogFile = f
+		if err := n.verifySlowLog(); err == nil {
+			t.Errorf("test verify slow log file %s should fail but pass", f)
+		}
+	}
+}
+
+func TestVerifyCompress(t *testing.T) {
+	for _, c := range []string{"", CompressZlib} {
+		if err := VerifyCompress(c); err != nil {
+			t.Errorf("test verify compress %s failed, %v", c, err)
+		}
+	}
+	for _, c := range []string{"zstd", "gzip"} {
+		if err := VerifyCompress(c); err == nil {
+			t.Errorf("test verify compress %s should fail but pass", c)
+		}
+	}
+}
+
+func TestVerifyMaskRules(t *testing.T) {
+	n := defaultNamespace()
+	n.MaskRules = []*MaskRule{
+		{Table: "user", Column: "phone", Type: MaskTypePartial},
+		{Table: "user", Column: "id_card", Type: MaskTypeHash},
+		{Table: "order", Column: "phone", Type: MaskTypeNull},
+	}
+	n.MaskKeyID = "mask"
+	if err := n.verifyMaskRules(); err != nil {
+		t.Errorf("test verifyMaskRules failed, %v", err)
+	}
+	n.MaskKeyID = ""
+	if err := n.verifyMaskRules(); err == nil {
+		t.Errorf("test verifyMaskRules should fail without mask_key_id but pass")
+	}
+
+	tests := []*MaskRule{
+		{Table: "", Column: "phone", Type: MaskTypePartial},
+		{Table: "user", Column: " ", Type: MaskTypePartial},
+		{Table: "user", Column: "name", Type: "unknown"},
+		{Table: "User", Column: "Phone", Type: MaskTypeNull},
+	}
+	for _, r := range tests {
+		n.MaskRules = []*MaskRule{{Table: "user", Column: "phone", Type: MaskTypePartial}, r}
+		if err := n.verifyMaskRules(); err == nil {
+			t.Errorf("test verifyMaskRules should fail but pass, rule: %s", r.Encode())
+		}
+	}
+}
+
+func TestVerifyIndexAdvisor(t *testing.T) {
+	n := defaultNamespace()
+	n.IndexAdvisor = &IndexAdvisor{}
+	if err := n.IndexAdvisor.verify(n); err == nil {
+		t.Errorf("test verify index advisor without sql stats should fail but pass")
+	}
+	n.SQLStatsCapacity = 100
+	if err := n.IndexAdvisor.verify(n); err != nil {
+		t.Errorf("test verify index advisor failed, %v", err)
+	}
+	if n.IndexAdvisor.GetInterval() != defaultIndexAdvisorInterval || n.IndexAdvisor.GetTopN() != defaultIndexAdvisorTopN {
+		t.Errorf("test default interval and top_n of index advisor failed")
+	}
+	n.IndexAdvisor.TopN = -1
+	if err := n.IndexAdvisor.verify(n); err == nil {
+		t.Errorf("test verify index advisor with negative top_n should fail but pass")
+	}
+}
+
+func TestVerifyGeneralLog(t *testing.T) {
+	n := defaultNamespace()
+	n.Users = append(n.Users, &User{UserName: "test"})
+	n.GeneralLog = &GeneralLog{SampleRate: 100, Users: []string{"test"}, SuppressSQLs: []string{"select 1"}}
+	if err := n.GeneralLog.verify(n); err != nil {
+		t.Errorf("test verify general log failed, %v", err)
+	}
+	n.GeneralLog.Users = []string{"unknown"}
+	if err := n.GeneralLog.verify(n); err == nil {
+		t.Errorf("test verify general log with unknown user should fail but pass")
+	}
+	n.GeneralLog = &GeneralLog{SampleRate: -1}
+	if err := n.GeneralLog.verify(n); err == nil {
+		t.Errorf("test verify general log with negative sample_rate should fail but pass")
+	}
+}
+
+func TestVerifyBackendError(t *testing.T) {
+	n := defaultNamespace()
+	n.BackendError = &BackendError{AddrAliases: map[string]string{"127.0.0.1:3306": "mysql-a"}}
+	if err := n.BackendError.verify(); err != nil {
+		t.Errorf("test verify backend error failed, %v", err)
+	}
+	if addr := n.BackendError.DisplayAddr("127.0.0.1:3307"); addr != "" {
+		t.Errorf("addr without alias should be hidden, got: %s", addr)
+	}
+	n.BackendError.AddrAliases["127.0.0.1:3307"] = " "
+	if err := n.BackendError.verify(); err == nil {
+		t.Errorf("test verify backend error with empty alias should fail but pass")
+	}
+}
+
+func TestVerifySQLMode(t *testing.T) {
+	n := defaultNamespace()
+	n.SQLMode = "STRICT_TRANS_TABLES,no_zero_date"
+	if err := n.verifySQLMode(); err != nil {
+		t.Errorf("test verify sql_mode failed, %v", err)
+	}
+	n.SQLMode = "STRICT_TRANS_TABLES,NOT_A_MODE"
+	if err := n.verifySQLMode(); err == nil {
+		t.Errorf("test verify invalid sql_mode should fail but pass")
+	}
+}
+
+func TestVerifyTimeZone(t *testing.T) {
+	n := defaultNamespace()
+	for _, tz := range []string{"", "+08:00", "UTC", "Asia/Shanghai"} {
+		n.TimeZone = tz
+		if err := n.verifyTimeZone(); err != nil {
+			t.Errorf("test verify time_zone %s failed, %v", tz, err)
+		}
+	}
+	n.TimeZone = "+25:00"
+	if err := n.verifyTimeZone(); err == nil {
+		t.Errorf("test verify invalid time_zone should fail but pass")
+	}
+}
+
+func TestVerifyServerVersion(t *testing.T) {
+	n := defaultNamespace()
+	n.ServerVersion = "8.0.32"
+	n.DisabledCapabilities = []string{"multi_statements", "LOCAL_FILES"}
+	if err := n.verifyServerVersion(); err != nil {
+		t.Errorf("test verify server_version failed, %v", err)
+	}
+	for _, version := range []string{"8.0", "8.0.32 gaea"} {
+		n.ServerVersion = version
+		if err := n.verifyServerVersion(); err == nil {
+			t.Errorf("test verify invalid server_version %s should fail but pass", version)
+		}
+	}
+	n.ServerVersion = ""
+	n.DisabledCapabilities = []string{"compress"}
+	if err := n.verifyServerVersion(); err == nil {
+		t.Errorf("test verify unsupported capability should fail but pass")
+	}
+}
+
+func TestVerifyRewriteRules(t *testing.T) {
+	n := defaultNamespace()
+	n.RewriteRules = []*RewriteRule{
+		{Match: RewriteMatchFingerprint, Pattern: "select * from t where a = ?", Rewrite: "select * from t force index(idx_a) where a = ?"},
+		{Match: RewriteMatchRegex, Pattern: `^select (.*) from t2 `, Rewrite: "select $1 from t2 use index(idx_b) "},
+		{Match: RewriteMatchFingerprint, Pattern: "select * from t3", Hint: "MAX_EXECUTION_TIME(1000)"},
+	}
+	if err := n.verifyRewriteRules(); err != nil {
+		t.Errorf("test verifyRewriteRules failed, %v", err)
+	}
+
+	tests := []*RewriteRule{
+		{Match: RewriteMatchFingerprint, Pattern: " ", Rewrite: "select 1"},
+		{Match: RewriteMatchFingerprint, Pattern: "select 1"},
+		{Match: RewriteMatchRegex, Pattern: "select (", Rewrite: "select 1"},
+		{Match: "unknown", Pattern: "select 1", Rewrite: "select 2"},
+		{Match: RewriteMatchFingerprint, Pattern: "select 1", Hint: "*/ drop table t /*"},
+	}
+	for _, r := range tests {
+		n.RewriteRules = []*RewriteRule{r}
+		if err := n.verifyRewriteRules(); err == nil {
+			t.Errorf("test verifyRewriteRules should fail but pass, rule: %s", r.Encode())
+		}
+	}
+}
+
+func TestVerifyPrecreatePeriods(t *testing.T) {
+	s := &Shard{DB: "db", Table: "t", Type: ShardMonth, Key: "create_time", Slices: []string{"slice-0"}, DateRange: []string{"202101-202106"}, PrecreatePeriods: 2}
+	if err := s.verify(); err != nil {
+		t.Errorf("test verify shard failed, %v", err)
+	}
+	s.PrecreatePeriods = -1
+	if err := s.verify(); err == nil {
+		t.Errorf("test verify shard should fail with negative precreate_periods")
+	}
+	s = &Shard{DB: "db", Table: "t", Type: ShardHash, Key: "id", Slices: []string{"slice-0"}, Locations: []int{2}, PrecreatePeriods: 2}
+	if err := s.verify(); err == nil {
+		t.Errorf("test verify shard should fail with precreate_periods of hash shard")
+	}
+}
+
+func TestVerifyPurgeRules(t *testing.T) {
+	n := defaultNamespace()
+	n.PurgeRules = []*PurgeRule{
+		{DB: "db", Table: "t_log", Column: "created_at", Retention: 720},
+		{DB: "db", Table: "t_event", Column: "ts", ColumnType: PurgeColumnUnix, Retention: 24, BatchSize: 500, Window: "23:00-05:00"},
+	}
+	if err := n.verifyPurgeRules(); err != nil {
+		t.Errorf("test verifyPurgeRules failed, %v", err)
+	}
+
+	tests := []*PurgeRule{
+		{DB: "db", Table: "t", Retention: 1},
+		{DB: "db", Table: "t", Column: "c", Retention: 0},
+		{DB: "db", Table: "t", Column: "c", ColumnType: "date", Retention: 1},
+		{DB: "db", Table: "t", Column: "c", Retention: 1, BatchSize: -1},
+		{DB: "db", Table: "t", Column: "c", Retention: 1, Window: "23:00"},
+		{DB: "db", Table: "t", Column: "c", Retention: 1, Window: "25:00-05:00"},
+		{DB: "db", Table: "t", Column: "c", Retention: 1, Window: "05:00-05:00"},
+	}
+	for _, r := range tests {
+		n.PurgeRules = []*PurgeRule{r}
+		if err := n.verifyPurgeRules(); err == nil {
+			t.Errorf("test verifyPurgeRules should fail but pass, rule: %s", r.Encode())
+		}
+	}
+
+	n.PurgeRules = []*PurgeRule{
+		{DB: "db", Table: "t", Column: "c", Retention: 1},
+		{DB: "DB", Table: "T", Column: "c2", Retention: 2},
+	}
+	if err := n.verifyPurgeRules(); err == nil {
+		t.Errorf("test verifyPurgeRules should fail with duplicate rules")
+	}
+}
+
+func TestVerifyGlobalUniqueKeys(t *testing.T) {
+	n := defaultNamespace()
+	n.Slices = []*Slice{{Name: "slice-0"}, {Name: "slice-1"}}
+	n.GlobalUniqueKeys = []*GlobalUniqueKey{
+		{DB: "db", Table: "t_user", Column: "email", SliceName: "slice-0", IndexTable: "gaea_unique.t_user_email"},
+		{DB: "db", Table: "t_user", Column: "phone", SliceName: "slice-1", IndexTable: "gaea_unique.t_user_phone"},
+	}
+	if err := n.verifyGlobalUniqueKeys(); err != nil {
+		t.Errorf("test verifyGlobalUniqueKeys failed, %v", err)
+	}
+
+	tests := []*GlobalUniqueKey{
+		{DB: "db", Table: "t", SliceName: "slice-0", IndexTable: "gaea_unique.t"},
+		{DB: "db", Table: "t", Column: "c", SliceName: "slice-2", IndexTable: "gaea_unique.t"},
+		{DB: "db", Table: "t", Column: "c", SliceName: "slice-0", IndexTable: "t"},
+	}
+	for _, k := range tests {
+		n.GlobalUniqueKeys = []*GlobalUniqueKey{k}
+		if err := n.verifyGlobalUniqueKeys(); err == nil {
+			t.Errorf("test verifyGlobalUniqueKeys should fail but pass, key: %s", k.Encode())
+		}
+	}
+
+	n.GlobalUniqueKeys = []*GlobalUniqueKey{
+		{DB: "db", Table: "t", Column: "c", SliceName: "slice-0", IndexTable: "gaea_unique.t1"},
+		{DB: "DB", Table: "T", Column: "C", SliceName: "slice-0", IndexTable: "gaea_unique.t2"},
+	}
+	if err := n.verifyGlobalUniqueKeys(); err == nil {
+		t.Errorf("test verifyGlobalUniqueKeys should fail with duplicate keys")
+	}
+}
+
+func TestVerifyMultiplexing(t *testing.T) {
+	n := defaultNamespace()
+	n.Multiplexing = true
+	if err := n.verifyMultiplexing(); err == nil {
+		t.Errorf("test verifyMultiplexing should fail without set_for_keep_session")
+	}
+	n.SetForKeepSession = true
+	if err := n.verifyMultiplexing(); err != nil {
+		t.Errorf("test verifyMultiplexing failed, %v", err)
+	}
+}
+
+func TestVerifyEncryptColumns(t *testing.T) {
+	n := defaultNamespace()
+	n.EncryptColumns = []*EncryptColumn{
+		{Table: "user", Column: "phone", KeyID: "k1"},
+		{Table: "user", Column: "id_card", Algorithm: EncryptAlgorithmAESGCM, KeyID: "k2"},
+	}
+	if err := n.verifyEncryptColumns(); err != nil {
+		t.Errorf("test verifyEncryptColumns failed, %v", err)
+	}
+	if n.EncryptColumns[0].Algorithm != EncryptAlgorithmAESGCM {
+		t.Errorf("default algorithm should be %s, got %s", EncryptAlgorithmAESGCM, n.EncryptColumns[0].Algorithm)
+	}
+
+	tests := []*EncryptColumn{
+		{Table: "", Column: "phone", KeyID: "k1"},
+		{Table: "user", Column: "email", Algorithm: "aes-ecb", KeyID: "k1"},
+		{Table: "user", Column: "email"},
+		{Table: "User", Column: "Phone", KeyID: "k1"},
+	}
+	for _, c := range tests {
+		n.EncryptColumns = []*EncryptColumn{{Table: "user", Column: "phone", KeyID: "k1"}, c}
+		if err := n.verifyEncryptColumns(); err == nil {
+			t.Errorf("test verifyEncryptColumns should fail but pass, config: %s", c.Encode())
+		}
+	}
+}
+
+func TestVerifyMirror(t *testing.T) {
+	n := defaultNamespace()
+	n.Slices = []*Slice{{Name: "slice-0"}, {Name: "slice-mirror"}}
+	n.DefaultSlice = "slice-0"
+	m := &Mirror{Slice: "slice-mirror", ReadPercent: 10, Tables: []string{"db_ks.tbl_ks"}}
+	if err := m.verify(n); err != nil {
+		t.Errorf("test verify mirror failed, %v", err)
+	}
+	if m.GetConcurrency() != defaultMirrorConcurrency || m.GetQueueSize() != defaultMirrorQueueSize {
+		t.Errorf("default concurrency and queue size of mirror are not used")
+	}
+
+	tests := []*Mirror{
+		{},
+		{Slice: "slice-0"},
+		{Slice: "slice-1"},
+		{Slice: "slice-mirror", ReadPercent: 101},
+		{Slice: "slice-mirror", Concurrency: -1},
+		{Slice: "slice-mirror", Tables: []string{"tbl_ks"}},
+		{Slice: "slice-mirror", Tables: []string{"db_ks."}},
+	}
+	for _, m := range tests {
+		if err := m.verify(n); err == nil {
+			t.Errorf("test verify mirror should fail but pass, config: %+v", m)
+		}
+	}
+}
+
+func TestVerifyCDC(t *testing.T) {
+	c := &CDC{Brokers: []string{"127.0.0.1:9092"}, Topic: "gaea_cdc", Tables: []*CDCTable{{DB: "db_ks", Table: "tbl_ks", PrimaryKey: "id"}}}
+	if err := c.verify(); err != nil {
+		t.Errorf("test verify cdc failed, %v", err)
+	}
+	if c.GetQueueSize() != defaultCDCQueueSize {
+		t.Errorf("default queue size of cdc is not used")
+	}
+
+	tests := []*CDC{
+		{},
+		{Brokers: []string{"127.0.0.1:9092"}},
+		{Brokers: []string{"127.0.0.1:9092"}, Topic: "gaea_cdc"},
+		{Brokers: []string{"127.0.0.1:9092"}, Topic: "gaea_cdc", Tables: []*CDCTable{{DB: "db_ks", Table: "tbl_ks"}}},
+		{Brokers: []string{"127.0.0.1:9092"}, Topic: "gaea_cdc", Tables: c.Tables, QueueSize: -1},
+	}
+	for _, c := range tests {
+		if err := c.verify(); err == nil {
+			t.Errorf("test verify cdc should fail but pass, config: %+v", c)
+		}
+	}
+}
+
 func TestVerifyDBs_Success(t *testing.T) {
 	n := defaultNamespace()
 	// no logic database mode
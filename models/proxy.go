@@ -19,6 +19,8 @@ import (
 	"github.com/XiaoMi/Gaea/log"
 	"github.com/XiaoMi/Gaea/log/zap"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util/keystore"
+	"os"
 	"strconv"
 	"strings"
 
@@ -27,6 +29,18 @@ import (
 
 const (
 	defaultGaeaCluster = "gaea"
+
+	// LogFormatText sql log in text format, which is the default
+	LogFormatText = "text"
+	// LogFormatJSON sql log in json format
+	LogFormatJSON = "json"
+
+	defaultProxySocketMode os.FileMode = 0660
+
+	// FrontendModeGoroutine each client connection is served by a goroutine, which is the default
+	FrontendModeGoroutine = "goroutine"
+	// FrontendModeNetpoll idle client connections are parked in epoll without goroutines, linux only
+	FrontendModeNetpoll = "netpoll"
 )
 
 // Proxy means proxy structure of proxy config
@@ -52,8 +66,11 @@ type Proxy struct {
 	LogLevel      string `ini:"log_level"`
 	LogFileName   string `ini:"log_filename"`
 	LogOutput     string `ini:"log_output"`
+	LogFormat     string `ini:"log_format"` // format of sql log, text or json
 	LogKeepDays   int    `ini:"log_keep_days"`
 	LogKeepCounts int    `ini:"log_keep_counts"`
+	LogMaxSize    int    `ini:"log_max_size"` // in megabytes, rotate log by size instead of hour if it's set
+	LogCompress   bool   `ini:"log_compress"` // gzip rotated log files, only works with log_max_size
 
 	ProtoType      string `ini:"proto_type"`
 	ProxyAddr      string `ini:"proxy_addr"`
@@ -63,17 +80,60 @@ type Proxy struct {
 	SlowSQLTime    int64  `ini:"slow_sql_time"`
 	SessionTimeout int    `ini:"session_timeout"`
 
+	// 管理接口的多账号及角色, admin_user 为 super-admin, 修改后通过 reload proxy config 生效
+	AdminAccountsFile string `ini:"admin_accounts_file"` // json file of admin accounts, empty means only admin_user
+
+	// 本地客户端的 unix socket 监听, 通过文件权限控制访问
+	ProxySocket     string `ini:"proxy_socket"`      // unix socket path, empty means not listen
+	ProxySocketMode string `ini:"proxy_socket_mode"` // file mode of unix socket in octal, default 0660
+
+	// 在管理端口提供 POST /api/query, 以 namespace 用户认证执行 SQL 并返回 JSON
+	QueryAPIEnabled bool `ini:"query_api_enabled"`
+
+	// 实验功能, PostgreSQL 协议监听, 仅支持简单查询协议
+	PGProxyAddr string `ini:"pg_proxy_addr"` // empty means not listen
+
+	// gRPC 管理接口监听, 以管理账号认证; 开启 query_api_enabled 时同时提供流式查询接口
+	GRPCAddr string `ini:"grpc_addr"` // empty means not listen
+
+	// 部署在 LVS/HAProxy 后时, 从 PROXY protocol v1/v2 头部获取客户端真实地址, 仅对 proxy_addr 生效
+	ProxyProtocol           bool   `ini:"proxy_protocol"`
+	ProxyProtocolTrustedIPs string `ini:"proxy_protocol_trusted_ips"` // comma separated ips or cidrs of load balancers, required if proxy_protocol is on
+
+	// 客户端连接的服务方式, netpoll 模式下空闲连接不占用 goroutine 和读缓存, 适用于大量空闲连接的场景
+	FrontendMode string `ini:"frontend_mode"` // goroutine or netpoll, default goroutine
+
 	// 监控配置
 	StatsEnabled  string `ini:"stats_enabled"`  // set true to enable stats
 	StatsInterval int    `ini:"stats_interval"` // set stats interval of connect pool
 
 	EncryptKey string `ini:"encrypt_key"`
+	// namespace 导入导出包的签名密钥, 导出和导入的环境需配置相同的密钥, 为空时不能导入导出
+	BundleSignKey string `ini:"bundle_sign_key"`
+
+	// 透明加密列的密钥及secret uri解析配置
+	EncryptKeyProvider  string `ini:"encrypt_key_provider"`   // file or vault, empty means no provider
+	EncryptKeyFile      string `ini:"encrypt_key_file"`       // json file of key id to base64 encoded key
+	EncryptKeyVaultPath string `ini:"encrypt_key_vault_path"` // vault secret path, fields are key id to base64 encoded key
+	VaultAddr           string `ini:"vault_addr"`             // VAULT_ADDR in environment is used if empty
+	VaultToken          string `ini:"vault_token"`            // VAULT_TOKEN in environment is used if empty
+	KMSRegion           string `ini:"kms_region"`             // region of aws kms, AWS_REGION in environment is used if empty
+	KMSEndpoint         string `ini:"kms_endpoint"`           // endpoint of aws kms, https://kms.{region}.amazonaws.com if empty
 
 	ServerVersion string `ini:"server_version"`
 	AuthPlugin    string `ini:"auth_plugin"`
 	NumCPU        int    `ini:"num_cpu"`
 	NetBufferSize int    `ini:"net_buffer_size"`
-	ConfigFile    string
+	// 结果集写入客户端时缓存的字节数, 超过后才写入socket, 默认 16384
+	NetWriteFlushThreshold int `ini:"net_write_flush_threshold"`
+	// 客户端连接的内核socket缓冲区大小(SO_RCVBUF/SO_SNDBUF), 0 表示使用系统默认值
+	NetSocketReadBuffer  int `ini:"net_socket_read_buffer"`
+	NetSocketWriteBuffer int `ini:"net_socket_write_buffer"`
+	// 数据包缓冲池中缓存的最大缓冲区大小, 更大的数据包直接分配, 默认 16777215(max_allowed_packet 为 16M 时的单包上限)
+	PacketPoolMaxSize int `ini:"packet_pool_max_size"`
+	ConfigFile        string
+
+	ClientCompress bool `ini:"client_compress"` // allow clients to use compressed protocol(zlib)
 }
 
 // ParseProxyConfigFromFile parser proxy config from file
@@ -103,6 +163,12 @@ func ParseProxyConfigFromFile(cfgFile string) (*Proxy, error) {
 	if proxyConfig.NetBufferSize > 0 {
 		mysql.InitNetBufferSize(proxyConfig.NetBufferSize)
 	}
+	if proxyConfig.NetWriteFlushThreshold > 0 {
+		mysql.InitWriteFlushThreshold(proxyConfig.NetWriteFlushThreshold)
+	}
+	if proxyConfig.PacketPoolMaxSize > 0 {
+		mysql.InitPacketPoolMaxSize(proxyConfig.PacketPoolMaxSize)
+	}
 
 	if err := proxyConfig.Verify(); err != nil {
 		return nil, err
@@ -129,6 +195,35 @@ func (p *Proxy) Verify() (err error) {
 		return fmt.Errorf("stats_interval should be >= 0: %d", p.StatsInterval)
 	}
 
+	if _, err = p.GetProxySocketMode(); err != nil {
+		return err
+	}
+
+	if p.NetSocketReadBuffer < 0 || p.NetSocketWriteBuffer < 0 {
+		return fmt.Errorf("net_socket_read_buffer and net_socket_write_buffer should be >= 0: %d, %d",
+			p.NetSocketReadBuffer, p.NetSocketWriteBuffer)
+	}
+
+	// header from untrusted peer may forge client address and bypass allowed_ip
+	if p.ProxyProtocol && strings.TrimSpace(p.ProxyProtocolTrustedIPs) == "" {
+		return fmt.Errorf("proxy_protocol_trusted_ips must be specified if proxy_protocol is on")
+	}
+
+	switch p.FrontendMode {
+	case "", FrontendModeGoroutine, FrontendModeNetpoll:
+	default:
+		return fmt.Errorf("unsupport frontend_mode: %s", p.FrontendMode)
+	}
+
+	switch strings.ToLower(p.LogFormat) {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("unsupport log_format: %s", p.LogFormat)
+	}
+	if p.LogMaxSize < 0 {
+		return fmt.Errorf("log_max_size should be >= 0: %d", p.LogMaxSize)
+	}
+
 	// check gloal slow query and session timeout
 	if p.SlowSQLTime < 0 {
 		return fmt.Errorf("slow_sql_time should be >= 0: %d", p.SlowSQLTime)
@@ -137,6 +232,12 @@ func (p *Proxy) Verify() (err error) {
 		return fmt.Errorf("session_timeout should be >= 0: %d", p.SlowSQLTime)
 	}
 
+	switch p.EncryptKeyProvider {
+	case keystore.ProviderNone, keystore.ProviderFile, keystore.ProviderVault:
+	default:
+		return fmt.Errorf("unsupport encrypt_key_provider: %s", p.EncryptKeyProvider)
+	}
+
 	switch p.AuthPlugin {
 	case "", mysql.MysqlNativePassword, mysql.CachingSHA2Password:
 	default:
@@ -145,6 +246,18 @@ func (p *Proxy) Verify() (err error) {
 	return
 }
 
+// GetProxySocketMode return file mode of unix socket
+func (p *Proxy) GetProxySocketMode() (os.FileMode, error) {
+	if p.ProxySocketMode == "" {
+		return defaultProxySocketMode, nil
+	}
+	mode, err := strconv.ParseUint(p.ProxySocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid proxy_socket_mode: %s", p.ProxySocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
 // ProxyInfo for report proxy information
 type ProxyInfo struct {
 	Token     string `json:"token"`
@@ -165,8 +278,9 @@ func (p *ProxyInfo) Encode() []byte {
 	return JSONEncode(p)
 }
 
-func InitXLog(output, path, filename, level, service string, logKeepDays int, logKeepCounts int) error {
+func InitXLog(output, path, filename, level, service string, logKeepDays int, logKeepCounts int, logMaxSize int, logCompress bool) error {
 	cfg := make(map[string]string)
+	cfg["output"] = output
 	cfg["path"] = path
 	cfg["filename"] = filename
 	cfg["level"] = level
@@ -181,6 +295,8 @@ func InitXLog(output, path, filename, level, service string, logKeepDays int, lo
 	if logKeepCounts != 0 {
 		cfg["log_keep_counts"] = strconv.Itoa(logKeepCounts)
 	}
+	cfg["max_size"] = strconv.Itoa(logMaxSize)
+	cfg["compress"] = strconv.FormatBool(logCompress)
 	logger, err := zap.CreateLogManager(cfg)
 	if err != nil {
 		return err
@@ -0,0 +1,116 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// column types of PurgeRule
+const (
+	PurgeColumnDatetime = "datetime" // DATETIME、TIMESTAMP 等时间类型
+	PurgeColumnUnix     = "unix"     // 整数类型的unix时间戳, 单位: 秒
+)
+
+const (
+	defaultPurgeBatchSize     = 1000
+	defaultPurgeBatchInterval = 100
+	purgeWindowLayout         = "15:04"
+)
+
+// PurgeRule means config of purging expired rows of a logical table, rows are deleted shard by shard in small batches
+type PurgeRule struct {
+	DB            string `json:"db"`             // 逻辑库名
+	Table         string `json:"table"`          // 逻辑表名, 分片表在每个子表上分别清理
+	Column        string `json:"column"`         // 时间列, 建议有索引
+	ColumnType    string `json:"column_type"`    // 时间列类型: datetime, unix, 默认为datetime
+	Retention     int    `json:"retention"`      // 保留时间, 单位: 小时, 时间列早于该时间的行被删除
+	BatchSize     int    `json:"batch_size"`     // 每次DELETE的行数, 默认为1000
+	BatchInterval int    `json:"batch_interval"` // 两次DELETE之间的间隔, 单位: 毫秒, 默认为100
+	Window        string `json:"window"`         // 执行时间段, 格式为 HH:MM-HH:MM, 可跨零点, 如 23:00-05:00, 为空时不限制
+}
+
+// Encode means encode for easy use
+func (p *PurgeRule) Encode() []byte {
+	return JSONEncode(p)
+}
+
+// GetColumnType return column type of purge rule, default is datetime
+func (p *PurgeRule) GetColumnType() string {
+	if p.ColumnType != "" {
+		return p.ColumnType
+	}
+	return PurgeColumnDatetime
+}
+
+// GetBatchSize return rows deleted by a batch, default is 1000
+func (p *PurgeRule) GetBatchSize() int {
+	if p.BatchSize > 0 {
+		return p.BatchSize
+	}
+	return defaultPurgeBatchSize
+}
+
+// GetBatchInterval return interval between batches in milliseconds, default is 100
+func (p *PurgeRule) GetBatchInterval() int {
+	if p.BatchInterval > 0 {
+		return p.BatchInterval
+	}
+	return defaultPurgeBatchInterval
+}
+
+// ParseWindow return start and end of window as minutes of day, ok is false if window is not set
+func (p *PurgeRule) ParseWindow() (start int, end int, ok bool, err error) {
+	if strings.TrimSpace(p.Window) == "" {
+		return 0, 0, false, nil
+	}
+	parts := strings.Split(p.Window, "-")
+	if len(parts) != 2 {
+		return 0, 0, false, fmt.Errorf("invalid window of purge rule: %s, should be HH:MM-HH:MM", p.Window)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse(purgeWindowLayout, strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("invalid window of purge rule: %s, should be HH:MM-HH:MM", p.Window)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, false, fmt.Errorf("invalid window of purge rule: %s, start and end should be different", p.Window)
+	}
+	return minutes[0], minutes[1], true, nil
+}
+
+func (p *PurgeRule) verify() error {
+	if strings.TrimSpace(p.DB) == "" || strings.TrimSpace(p.Table) == "" || strings.TrimSpace(p.Column) == "" {
+		return fmt.Errorf("db, table and column of purge rule must be specified, rule: %s", p.Encode())
+	}
+	switch p.GetColumnType() {
+	case PurgeColumnDatetime, PurgeColumnUnix:
+	default:
+		return fmt.Errorf("invalid column type: %s, rule: %s", p.ColumnType, p.Encode())
+	}
+	if p.Retention <= 0 {
+		return fmt.Errorf("retention of purge rule should be > 0, rule: %s", p.Encode())
+	}
+	if p.BatchSize < 0 || p.BatchInterval < 0 {
+		return fmt.Errorf("batch_size and batch_interval of purge rule should be >= 0, rule: %s", p.Encode())
+	}
+	_, _, _, err := p.ParseWindow()
+	return err
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// match types of RewriteRule
+const (
+	RewriteMatchFingerprint = "fingerprint" // 按SQL指纹匹配, 改写模板中的?依次替换为原SQL中的字面量
+	RewriteMatchRegex       = "regex"       // 按正则表达式匹配, 改写模板中可以使用$1等引用分组
+)
+
+// RewriteRule means config of sql rewriting, sql of clients matching the rule is rewritten before planning
+type RewriteRule struct {
+	Match   string `json:"match"`   // 匹配方式: fingerprint, regex
+	Pattern string `json:"pattern"` // 匹配的SQL指纹或正则表达式
+	Rewrite string `json:"rewrite"` // 改写模板, 为空时保持原SQL, 可在模板中加入force index等
+	Hint    string `json:"hint"`    // 可选, 加在语句首个关键字后的优化器hint, 如 MAX_EXECUTION_TIME(1000)
+}
+
+// Encode means encode for easy use
+func (p *RewriteRule) Encode() []byte {
+	return JSONEncode(p)
+}
+
+func (p *RewriteRule) verify() error {
+	if strings.TrimSpace(p.Pattern) == "" {
+		return fmt.Errorf("pattern of rewrite rule must be specified, rule: %s", p.Encode())
+	}
+	if strings.TrimSpace(p.Rewrite) == "" && strings.TrimSpace(p.Hint) == "" {
+		return fmt.Errorf("rewrite or hint of rewrite rule must be specified, rule: %s", p.Encode())
+	}
+	if strings.Contains(p.Hint, "*/") {
+		return fmt.Errorf("invalid hint of rewrite rule, rule: %s", p.Encode())
+	}
+	switch p.Match {
+	case RewriteMatchFingerprint:
+		return nil
+	case RewriteMatchRegex:
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("invalid regex of rewrite rule: %v, rule: %s", err, p.Encode())
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid match type: %s, rule: %s", p.Match, p.Encode())
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/util/crypto"
+	"github.com/XiaoMi/Gaea/util/kms"
+	"github.com/XiaoMi/Gaea/util/vault"
+)
+
+// schemes of secret uri, value of config starts with scheme is resolved by secret provider
+const (
+	SecretSchemeVault = "vault://" // vault://{path}#{field}, such as vault://secret/data/gaea/slice-0#password
+	SecretSchemeKMS   = "kms://"   // kms://{base64 encrypted data key}:{base64 aes-gcm cipher text}, envelope encryption of aws kms
+	SecretSchemeLocal = "enc://"   // enc://{base64 aes-ecb cipher text}, encrypted with encrypt_key of proxy config
+)
+
+// SecretProvider resolve secret reference to plain text, reference is secret uri without scheme
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+var (
+	secretLock      sync.RWMutex
+	secretProviders = make(map[string]SecretProvider)
+)
+
+// RegisterSecretProvider register secret provider of scheme, provider registered before is replaced
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secretProviders[scheme] = p
+}
+
+// InitSecretProviders register vault, kms and local secret providers with proxy config
+func InitSecretProviders(cfg *Proxy) {
+	RegisterSecretProvider(SecretSchemeVault, &vaultSecretProvider{addr: cfg.VaultAddr, token: cfg.VaultToken})
+	RegisterSecretProvider(SecretSchemeKMS, &kmsSecretProvider{region: cfg.KMSRegion, endpoint: cfg.KMSEndpoint})
+	RegisterSecretProvider(SecretSchemeLocal, &localSecretProvider{key: cfg.EncryptKey})
+}
+
+// IsSecretURI check if value is secret uri
+func IsSecretURI(s string) bool {
+	_, _, ok := getSecretProvider(s)
+	return ok
+}
+
+// ResolveSecret resolve value to plain text if it's secret uri, or return value itself
+func ResolveSecret(s string) (string, error) {
+	p, ref, ok := getSecretProvider(s)
+	if !ok {
+		return s, nil
+	}
+	if p == nil {
+		return "", fmt.Errorf("secret provider of %s is not initialized", s[:len(s)-len(ref)])
+	}
+	v, err := p.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve secret %s error: %v", s, err)
+	}
+	return v, nil
+}
+
+func getSecretProvider(s string) (SecretProvider, string, bool) {
+	for _, scheme := range []string{SecretSchemeVault, SecretSchemeKMS, SecretSchemeLocal} {
+		if strings.HasPrefix(s, scheme) {
+			secretLock.RLock()
+			p := secretProviders[scheme]
+			secretLock.RUnlock()
+			return p, strings.TrimPrefix(s, scheme), true
+		}
+	}
+	return nil, "", false
+}
+
+// vaultSecretProvider read field of vault secret, client is created when resolving to pick up changed token in environment
+type vaultSecretProvider struct {
+	addr  string
+	token string
+}
+
+func (p *vaultSecretProvider) Resolve(ref string) (string, error) {
+	idx := strings.LastIndex(ref, "#")
+	if idx <= 0 || idx == len(ref)-1 {
+		return "", fmt.Errorf("vault secret should be vault://{path}#{field}")
+	}
+	client, err := vault.NewClient(p.addr, p.token)
+	if err != nil {
+		return "", err
+	}
+	return client.ReadField(ref[:idx], ref[idx+1:])
+}
+
+// kmsSecretProvider decrypt data key by aws kms, and then decrypt secret by data key
+type kmsSecretProvider struct {
+	region   string
+	endpoint string
+}
+
+func (p *kmsSecretProvider) Resolve(ref string) (string, error) {
+	parts := strings.Split(ref, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("kms secret should be kms://{base64 encrypted data key}:{base64 cipher text}")
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted data key error: %v", err)
+	}
+	cipherText, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("decode cipher text error: %v", err)
+	}
+
+	client, err := kms.NewClient(p.region, p.endpoint)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := client.Decrypt(encryptedKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := crypto.DecryptGCM(dataKey, cipherText)
+	if err != nil {
+		return "", fmt.Errorf("decrypt cipher text error: %v", err)
+	}
+	return string(plain), nil
+}
+
+// localSecretProvider decrypt secret with encrypt_key of proxy config, which is the same as encrypted namespace
+type localSecretProvider struct {
+	key string
+}
+
+func (p *localSecretProvider) Resolve(ref string) (string, error) {
+	if p.key == "" {
+		return "", fmt.Errorf("encrypt_key of proxy config is empty")
+	}
+	return decrypt(p.key, ref)
+}
+
+// EncryptLocalSecret encrypt plain text to local secret uri with encrypt_key of proxy config
+func EncryptLocalSecret(key, plain string) (string, error) {
+	cipherText, err := encrypt(key, plain)
+	if err != nil {
+		return "", err
+	}
+	return SecretSchemeLocal + cipherText, nil
+}
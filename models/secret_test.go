@@ -0,0 +1,112 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/util/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func resetSecretProviders() {
+	secretLock.Lock()
+	secretProviders = make(map[string]SecretProvider)
+	secretLock.Unlock()
+}
+
+func TestResolveSecret(t *testing.T) {
+	defer resetSecretProviders()
+	resetSecretProviders()
+
+	v, err := ResolveSecret("plain password")
+	require.NoError(t, err)
+	require.Equal(t, "plain password", v)
+
+	require.True(t, IsSecretURI("enc://abc"))
+	require.False(t, IsSecretURI("encabc"))
+	_, err = ResolveSecret("enc://abc")
+	require.Error(t, err)
+
+	key := "1234abcd5678efg*"
+	InitSecretProviders(&Proxy{EncryptKey: key})
+	secret, err := EncryptLocalSecret(key, "root")
+	require.NoError(t, err)
+	v, err = ResolveSecret(secret)
+	require.NoError(t, err)
+	require.Equal(t, "root", v)
+
+	InitSecretProviders(&Proxy{})
+	_, err = ResolveSecret(secret)
+	require.Error(t, err)
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	defer resetSecretProviders()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/gaea" || r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"user":"gaea","password":"p#wd"},"metadata":{}}}`))
+	}))
+	defer s.Close()
+
+	InitSecretProviders(&Proxy{VaultAddr: s.URL, VaultToken: "token"})
+	v, err := ResolveSecret("vault://secret/data/gaea#password")
+	require.NoError(t, err)
+	require.Equal(t, "p#wd", v)
+
+	for _, uri := range []string{"vault://secret/data/gaea", "vault://secret/data/gaea#", "vault://secret/data/other#password"} {
+		_, err = ResolveSecret(uri)
+		require.Error(t, err, uri)
+	}
+}
+
+func TestKMSSecretProvider(t *testing.T) {
+	defer resetSecretProviders()
+
+	dataKey := []byte("1234abcd5678efg*1234abcd5678efg*")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Plaintext":"` + base64.StdEncoding.EncodeToString(dataKey) + `"}`))
+	}))
+	defer s.Close()
+
+	for k, v := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		old := os.Getenv(k)
+		os.Setenv(k, v)
+		defer os.Setenv(k, old)
+	}
+
+	cipherText, err := crypto.EncryptGCM(dataKey, []byte("root"))
+	require.NoError(t, err)
+	uri := SecretSchemeKMS + base64.StdEncoding.EncodeToString([]byte("encrypted data key")) + ":" + base64.StdEncoding.EncodeToString(cipherText)
+
+	InitSecretProviders(&Proxy{KMSRegion: "us-east-1", KMSEndpoint: s.URL})
+	v, err := ResolveSecret(uri)
+	require.NoError(t, err)
+	require.Equal(t, "root", v)
+
+	for _, uri := range []string{"kms://abc", "kms://!:abc", "kms://YWJj:!", "kms://YWJj:YWJj"} {
+		_, err = ResolveSecret(uri)
+		require.Error(t, err, uri)
+	}
+}
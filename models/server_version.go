@@ -0,0 +1,63 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+const maxServerVersionLength = 64
+
+// DisableableCapabilities capability flags of proxy which can be disabled by namespace, key: name in config
+var DisableableCapabilities = map[string]uint32{
+	"multi_statements": mysql.ClientMultiStatements,
+	"multi_results":    mysql.ClientMultiResults,
+	"ps_multi_results": mysql.ClientPSMultiResults,
+	"local_files":      mysql.ClientLocalFiles,
+}
+
+// ParseDisabledCapabilities return capability flags of names in disabled_capabilities
+func ParseDisabledCapabilities(names []string) (uint32, error) {
+	var capability uint32
+	for _, name := range names {
+		flag, ok := DisableableCapabilities[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("unsupported capability: %s", name)
+		}
+		capability |= flag
+	}
+	return capability, nil
+}
+
+func (n *Namespace) verifyServerVersion() error {
+	version := strings.TrimSpace(n.ServerVersion)
+	if version != "" {
+		if len(version) > maxServerVersionLength || len(strings.Split(version, ".")) < 3 {
+			return fmt.Errorf("invalid server_version: %s, it should be like 8.0.32", n.ServerVersion)
+		}
+		for _, c := range version {
+			if c < 0x21 || c > 0x7e {
+				return fmt.Errorf("invalid server_version: %s, it should be like 8.0.32", n.ServerVersion)
+			}
+		}
+	}
+	if _, err := ParseDisabledCapabilities(n.DisabledCapabilities); err != nil {
+		return fmt.Errorf("verify disabled_capabilities error: %v", err)
+	}
+	return nil
+}
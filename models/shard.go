@@ -64,6 +64,9 @@ type Shard struct {
 	DateRange     []string `json:"date_range"`
 	TableRowLimit int      `json:"table_row_limit"`
 
+	// used in date shard, number of future periods whose sub tables are created ahead by gaea
+	PrecreatePeriods int `json:"precreate_periods"`
+
 	// only used in mycat logic database (schema)
 	Databases []string `json:"databases"`
 
@@ -89,6 +92,19 @@ func (s *Shard) verify() error {
 	if err := s.verifyRuleSliceInfos(); err != nil {
 		return err
 	}
+	if err := s.verifyPrecreatePeriods(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Shard) verifyPrecreatePeriods() error {
+	if s.PrecreatePeriods < 0 {
+		return fmt.Errorf("precreate_periods of table %s should be >= 0", s.Table)
+	}
+	if s.PrecreatePeriods > 0 && s.Type != ShardDay && s.Type != ShardMonth && s.Type != ShardYear {
+		return fmt.Errorf("precreate_periods of table %s is only supported by date shard, type: %s", s.Table, s.Type)
+	}
 	return nil
 }
 
@@ -17,22 +17,40 @@ package models
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
+// CompressZlib zlib algorithm of mysql compressed protocol, zstd is not supported
+const CompressZlib = "zlib"
+
 // Slice means config model of slice
 type Slice struct {
-	Name            string   `json:"name"`
-	UserName        string   `json:"user_name"`
-	Password        string   `json:"password"`
-	Master          string   `json:"master"`
-	Slaves          []string `json:"slaves"`
-	StatisticSlaves []string `json:"statistic_slaves"`
-	Capacity        int      `json:"capacity"`         // connection pool capacity
-	MaxCapacity     int      `json:"max_capacity"`     // max connection pool capacity
-	IdleTimeout     int      `json:"idle_timeout"`     // close backend direct connection after idle_timeout,unit: seconds
-	Capability      uint32   `json:"capability"`       // capability set by client, this capability is used as mysql client parameter when
-	InitConnect     string   `json:"init_connect"`     // 与MySQL的init_connect相同，连接池中的连接新建之后即会发送请求，以分号分隔
-	HealthCheckSql  string   `json:"health_check_sql"` // 简单语句的健康查询
+	Name                string          `json:"name"`
+	UserName            string          `json:"user_name"` // 支持secret uri, 加载namespace时解析, 如 vault://secret/data/gaea#user
+	Password            string          `json:"password"`  // 支持secret uri, 加载namespace时解析, 如 vault://secret/data/gaea#password
+	Master              string          `json:"master"`
+	Slaves              []string        `json:"slaves"`
+	StatisticSlaves     []string        `json:"statistic_slaves"`
+	Capacity            int             `json:"capacity"`                  // connection pool capacity
+	MaxCapacity         int             `json:"max_capacity"`              // max connection pool capacity
+	IdleTimeout         int             `json:"idle_timeout"`              // close backend direct connection after idle_timeout,unit: seconds
+	MaxLifetime         int             `json:"max_lifetime"`              // close backend direct connection after max_lifetime since it's created,unit: seconds
+	MinIdle             int             `json:"min_idle"`                  // 连接池保持的最小空闲连接数, 默认为0, 即不保持
+	MaxIdle             int             `json:"max_idle"`                  // 连接池最大空闲连接数, 超过时关闭空闲最久的连接, 默认为0, 即不限制
+	WarmUp              int             `json:"warm_up"`                   // 加载namespace时每个后端实例预建立的连接数, 小于min_idle时使用min_idle
+	Capability          uint32          `json:"capability"`                // capability set by client, this capability is used as mysql client parameter when
+	InitConnect         string          `json:"init_connect"`              // 与MySQL的init_connect相同，连接池中的连接新建之后即会发送请求，以分号分隔
+	Compress            string          `json:"compress"`                  // 与MySQL连接使用的压缩协议, 为空不压缩, 目前支持zlib
+	HealthCheckSql      string          `json:"health_check_sql"`          // 简单语句的健康查询
+	HealthCheckInterval int             `json:"health_check_interval"`     // 健康检查间隔, 单位: 毫秒, 默认为0, 即4秒
+	HealthCheckTimeout  int             `json:"health_check_timeout"`      // 健康检查超时时间, 单位: 毫秒, 默认为0, 即2秒
+	HealthCheckRise     int             `json:"health_check_rise"`         // 下线实例连续检查成功多少次后上线, 默认为0, 即检查成功立即上线
+	HealthCheckFall     int             `json:"health_check_fall"`         // 实例连续检查失败多少次后下线, 默认为0, 即使用namespace的down_after_no_alive
+	HeartbeatTable      string          `json:"heartbeat_table"`           // 心跳表, 格式为db.table, 配置后通过心跳表计算从库延迟, 替代Seconds_Behind_Master
+	HeartbeatInterval   int             `json:"heartbeat_interval"`        // 主库写入心跳的间隔, 单位: 毫秒, 默认为0, 即1秒
+	RecoveryRampTime    int             `json:"recovery_ramp_time"`        // 从库恢复上线后流量线性增长到全量的时间, 单位: 秒, 默认为0, 即立即承担全量流量
+	RecoveryRampStart   int             `json:"recovery_ramp_start"`       // 从库恢复上线时承担的读流量百分比, 默认为0
+	CircuitBreaker      *CircuitBreaker `json:"circuit_breaker,omitempty"` // 从库实例熔断配置, 按错误率和p99响应时间熔断, 读请求转移到其他从库
 	// gaea proxy as client connected to MySQL  default is 0
 }
 
@@ -67,5 +85,61 @@ func (s *Slice) verify() error {
 		return fmt.Errorf("connection pool capacity should be less than max connection pool capactiy")
 	}
 
+	if s.IdleTimeout < 0 || s.MaxLifetime < 0 {
+		return fmt.Errorf("idle_timeout and max_lifetime should be >= 0")
+	}
+
+	if s.HealthCheckInterval < 0 || s.HealthCheckTimeout < 0 || s.HealthCheckRise < 0 || s.HealthCheckFall < 0 {
+		return fmt.Errorf("health_check_interval, health_check_timeout, health_check_rise and health_check_fall should be >= 0")
+	}
+
+	if s.RecoveryRampTime < 0 || s.RecoveryRampStart < 0 || s.RecoveryRampStart > 100 {
+		return fmt.Errorf("recovery_ramp_time should be >= 0 and recovery_ramp_start should be in [0, 100]")
+	}
+
+	if err := s.verifyHeartbeat(); err != nil {
+		return err
+	}
+
+	if s.CircuitBreaker != nil {
+		if err := s.CircuitBreaker.verify(); err != nil {
+			return err
+		}
+	}
+
+	if s.MinIdle < 0 || s.MaxIdle < 0 || s.WarmUp < 0 {
+		return fmt.Errorf("min_idle, max_idle and warm_up should be >= 0")
+	}
+
+	if s.MinIdle > s.Capacity || s.WarmUp > s.Capacity {
+		return fmt.Errorf("min_idle and warm_up should not be greater than connection pool capacity")
+	}
+
+	if s.MaxIdle > 0 && s.MaxIdle < s.MinIdle {
+		return fmt.Errorf("max_idle should not be less than min_idle")
+	}
+
+	return VerifyCompress(s.Compress)
+}
+
+func (s *Slice) verifyHeartbeat() error {
+	if s.HeartbeatInterval < 0 {
+		return fmt.Errorf("heartbeat_interval should be >= 0")
+	}
+	if s.HeartbeatTable == "" {
+		return nil
+	}
+	parts := strings.Split(s.HeartbeatTable, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid heartbeat_table: %s, should be db.table", s.HeartbeatTable)
+	}
+	return nil
+}
+
+// VerifyCompress check compress algorithm of slice, only zlib is supported
+func VerifyCompress(compress string) error {
+	if compress != "" && compress != CompressZlib {
+		return fmt.Errorf("unsupport compress: %s, only %s is supported", compress, CompressZlib)
+	}
 	return nil
 }
@@ -109,6 +109,11 @@ func (s *Store) NamespacePath(name string) string {
 	return filepath.Join(s.prefix, "namespace", name)
 }
 
+// CanaryPath concat namespace canary path, it's not under namespace base so canary won't be loaded as namespace
+func (s *Store) CanaryPath(name string) string {
+	return filepath.Join(s.prefix, "canary", name)
+}
+
 // ProxyBase return proxy path base
 func (s *Store) ProxyBase() string {
 	return filepath.Join(s.prefix, "proxy")
@@ -182,6 +187,41 @@ func (s *Store) DelNamespace(name string) error {
 	return s.client.Delete(s.NamespacePath(name))
 }
 
+// LoadNamespaceCanary load namespace canary, return nil if canary not exists
+func (s *Store) LoadNamespaceCanary(key, name string) (*NamespaceCanary, error) {
+	b, err := s.client.Read(s.CanaryPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	c := &NamespaceCanary{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if err = c.Verify(); err != nil {
+		return nil, err
+	}
+
+	if err = c.Namespace.Decrypt(key); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// UpdateNamespaceCanary update namespace canary path with data
+func (s *Store) UpdateNamespaceCanary(c *NamespaceCanary) error {
+	return s.client.Update(s.CanaryPath(c.Namespace.Name), c.Encode())
+}
+
+// DelNamespaceCanary delete namespace canary
+func (s *Store) DelNamespaceCanary(name string) error {
+	return s.client.Delete(s.CanaryPath(name))
+}
+
 // ListProxyMonitorMetrics list proxies in proxy register path
 func (s *Store) ListProxyMonitorMetrics() (map[string]*ProxyMonitorMetric, error) {
 	files, err := s.client.List(s.ProxyBase())
@@ -49,3 +49,12 @@ func TestNamespacePath(t *testing.T) {
 		t.Fatalf("test NamespacePath failed, %v", path)
 	}
 }
+
+func TestCanaryPath(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	path := store.CanaryPath("test")
+	if path != "/gaea/canary/test" {
+		t.Fatalf("test CanaryPath failed, %v", path)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
 )
 
 // 用户只读标识
@@ -39,14 +41,53 @@ const (
 	StatisticUser = 1
 )
 
+// 查询排队优先级, 并发查询数达到上限时高优先级的查询先于低优先级的查询执行
+const (
+	// QueryPriorityHigh 高优先级, 如在线业务
+	QueryPriorityHigh = "high"
+	// QueryPriorityLow 低优先级, 如报表统计
+	QueryPriorityLow = "low"
+)
+
 // User meand user struct
 type User struct {
 	UserName      string `json:"user_name"`
-	Password      string `json:"password"`
+	Password      string `json:"password"` // 明文, 或 mysql_native_password 密文(*HEX), 或 caching_sha2_password 摘要($SHA2$HEX)
 	Namespace     string `json:"namespace"`
 	RWFlag        int    `json:"rw_flag"`        //1: 只读 2:读写
 	RWSplit       int    `json:"rw_split"`       //0: 不采用读写分离 1:读写分离
 	OtherProperty int    `json:"other_property"` // 1:统计用户
+
+	// 用户级别的库表权限, 为空时不限制, 仍受 namespace 的 allowed_dbs 限制
+	AllowedDBs    []string `json:"allowed_dbs,omitempty"`    // 可访问的库
+	AllowedTables []string `json:"allowed_tables,omitempty"` // 可访问的表, 格式为 db.table, table 为 * 时表示库下所有表
+	Unmasked      bool     `json:"unmasked,omitempty"`       // 为true时结果集不做脱敏, 用于有权限查看敏感字段的用户
+
+	// 用户级别同时执行的查询数上限, 排队长度和超时时间使用 namespace 的配置, 为 0 时不限制
+	MaxConcurrentQueries int `json:"max_concurrent_queries,omitempty"`
+
+	// 用户在当前 proxy 上的前端连接数上限, 同时受 namespace 的 max_client_connections 限制, 为 0 时不限制
+	MaxConnections int `json:"max_connections,omitempty"`
+
+	// 用户查询排队的优先级, high 或 low, 为空时使用 namespace 的 query_priority, 均为空时统计用户为 low, 其他用户为 high
+	QueryPriority string `json:"query_priority,omitempty"`
+
+	// 用户语句执行时间超过该值时被主动kill, 单位: 毫秒, 为 0 时使用 namespace 的 slow_sql_kill_time
+	SlowSQLKillTime int `json:"slow_sql_kill_time,omitempty"`
+}
+
+// IsValidQueryPriority check priority is empty, high or low
+func IsValidQueryPriority(priority string) bool {
+	return priority == "" || priority == QueryPriorityHigh || priority == QueryPriorityLow
+}
+
+// ParseAllowedTable split allowed table into db and table, table may be *
+func ParseAllowedTable(t string) (db string, table string, err error) {
+	parts := strings.Split(strings.TrimSpace(t), ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid allowed table: %s, format should be db.table", t)
+	}
+	return strings.ToLower(parts[0]), strings.ToLower(parts[1]), nil
 }
 
 func (p *User) verify() error {
@@ -64,6 +105,9 @@ func (p *User) verify() error {
 		return fmt.Errorf("missing password: [%s]%s", p.Namespace, p.UserName)
 	}
 	p.Password = strings.TrimSpace(p.Password)
+	if strings.HasPrefix(p.Password, mysql.CachingSha2DigestPrefix) && !mysql.IsCachingSha2Digest(p.Password) {
+		return fmt.Errorf("invalid caching_sha2_password digest: [%s]%s", p.Namespace, p.UserName)
+	}
 
 	if p.RWFlag != ReadOnly && p.RWFlag != ReadWrite {
 		return fmt.Errorf("invalid RWFlag, user: %s, rwflag: %d", p.UserName, p.RWFlag)
@@ -77,5 +121,56 @@ func (p *User) verify() error {
 		return fmt.Errorf("invalid other property, user: %s, %d", p.UserName, p.OtherProperty)
 	}
 
+	for _, t := range p.AllowedTables {
+		if _, _, err := ParseAllowedTable(t); err != nil {
+			return fmt.Errorf("user: %s, %v", p.UserName, err)
+		}
+	}
+
+	if p.MaxConcurrentQueries < 0 {
+		return fmt.Errorf("invalid max concurrent queries, user: %s, %d", p.UserName, p.MaxConcurrentQueries)
+	}
+
+	if p.MaxConnections < 0 {
+		return fmt.Errorf("invalid max connections, user: %s, %d", p.UserName, p.MaxConnections)
+	}
+
+	if !IsValidQueryPriority(p.QueryPriority) {
+		return fmt.Errorf("invalid query priority, user: %s, %s", p.UserName, p.QueryPriority)
+	}
+
+	if p.SlowSQLKillTime < 0 {
+		return fmt.Errorf("invalid slow sql kill time, user: %s, %d", p.UserName, p.SlowSQLKillTime)
+	}
+
 	return nil
 }
+
+// verifyACL check user's allowed dbs and tables are in namespace allowed dbs
+func (p *User) verifyACL(nsAllowedDBs map[string]bool) error {
+	for _, db := range p.AllowedDBs {
+		if !isDBAllowed(nsAllowedDBs, strings.TrimSpace(db)) {
+			return fmt.Errorf("user: %s, allowed db %s is not in namespace allowed dbs", p.UserName, db)
+		}
+	}
+	for _, t := range p.AllowedTables {
+		db, _, err := ParseAllowedTable(t)
+		if err != nil {
+			return fmt.Errorf("user: %s, %v", p.UserName, err)
+		}
+		if !isDBAllowed(nsAllowedDBs, db) {
+			return fmt.Errorf("user: %s, db of allowed table %s is not in namespace allowed dbs", p.UserName, t)
+		}
+	}
+	return nil
+}
+
+// isDBAllowed check db in allowed dbs case-insensitively
+func isDBAllowed(allowedDBs map[string]bool, db string) bool {
+	for name, allowed := range allowedDBs {
+		if allowed && strings.EqualFold(strings.TrimSpace(name), db) {
+			return true
+		}
+	}
+	return false
+}
@@ -610,10 +610,58 @@ var CollationNames = map[string]CollationID{
 	"utf8mb4_unicode_520_ci":   246,
 	"utf8mb4_vietnamese_ci":    247,
 
-	"gb18030_chinese_ci":     248,
-	"gb18030_bin":            249,
-	"gb18030_unicode_520_ci": 250,
-	"utf8mb4_0900_ai_ci":     255,
+	"gb18030_chinese_ci":         248,
+	"gb18030_bin":                249,
+	"gb18030_unicode_520_ci":     250,
+	"utf8mb4_0900_ai_ci":         255,
+	"utf8mb4_de_pb_0900_ai_ci":   256,
+	"utf8mb4_is_0900_ai_ci":      257,
+	"utf8mb4_lv_0900_ai_ci":      258,
+	"utf8mb4_ro_0900_ai_ci":      259,
+	"utf8mb4_sl_0900_ai_ci":      260,
+	"utf8mb4_pl_0900_ai_ci":      261,
+	"utf8mb4_et_0900_ai_ci":      262,
+	"utf8mb4_es_0900_ai_ci":      263,
+	"utf8mb4_sv_0900_ai_ci":      264,
+	"utf8mb4_tr_0900_ai_ci":      265,
+	"utf8mb4_cs_0900_ai_ci":      266,
+	"utf8mb4_da_0900_ai_ci":      267,
+	"utf8mb4_lt_0900_ai_ci":      268,
+	"utf8mb4_sk_0900_ai_ci":      269,
+	"utf8mb4_es_trad_0900_ai_ci": 270,
+	"utf8mb4_la_0900_ai_ci":      271,
+	"utf8mb4_eo_0900_ai_ci":      273,
+	"utf8mb4_hu_0900_ai_ci":      274,
+	"utf8mb4_hr_0900_ai_ci":      275,
+	"utf8mb4_vi_0900_ai_ci":      277,
+	"utf8mb4_0900_as_cs":         278,
+	"utf8mb4_de_pb_0900_as_cs":   279,
+	"utf8mb4_is_0900_as_cs":      280,
+	"utf8mb4_lv_0900_as_cs":      281,
+	"utf8mb4_ro_0900_as_cs":      282,
+	"utf8mb4_sl_0900_as_cs":      283,
+	"utf8mb4_pl_0900_as_cs":      284,
+	"utf8mb4_et_0900_as_cs":      285,
+	"utf8mb4_es_0900_as_cs":      286,
+	"utf8mb4_sv_0900_as_cs":      287,
+	"utf8mb4_tr_0900_as_cs":      288,
+	"utf8mb4_cs_0900_as_cs":      289,
+	"utf8mb4_da_0900_as_cs":      290,
+	"utf8mb4_lt_0900_as_cs":      291,
+	"utf8mb4_sk_0900_as_cs":      292,
+	"utf8mb4_es_trad_0900_as_cs": 293,
+	"utf8mb4_la_0900_as_cs":      294,
+	"utf8mb4_eo_0900_as_cs":      296,
+	"utf8mb4_hu_0900_as_cs":      297,
+	"utf8mb4_hr_0900_as_cs":      298,
+	"utf8mb4_vi_0900_as_cs":      300,
+	"utf8mb4_ja_0900_as_cs":      303,
+	"utf8mb4_ja_0900_as_cs_ks":   304,
+	"utf8mb4_0900_as_ci":         305,
+	"utf8mb4_ru_0900_ai_ci":      306,
+	"utf8mb4_ru_0900_as_cs":      307,
+	"utf8mb4_zh_0900_as_cs":      308,
+	"utf8mb4_0900_bin":           309,
 }
 
 // CollationNameToCharset collation name to charset
@@ -906,8 +954,15 @@ const (
 	UTF8DefaultCollation    = "utf8_bin"
 	UTF8MB4DefaultCollation = "utf8mb4_bin"
 	DefaultCollationName    = UTF8MB4DefaultCollation
+	// MySQL80MinCollationID is gb18030_chinese_ci(248), collations from it are replaced for MySQL 5.x backends
+	MySQL80MinCollationID = 248
 )
 
+// IsMySQL80Collation check if collation is only supported by MySQL 8.0 or later
+func IsMySQL80Collation(collation CollationID) bool {
+	return collation >= MySQL80MinCollationID
+}
+
 // IsValidCharset check if is valid charset
 func IsValidCharset(charset string) bool {
 	_, ok := CharsetIds[strings.ToLower(charset)]
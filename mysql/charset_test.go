@@ -0,0 +1,42 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"testing"
+)
+
+func TestMySQL80Collations(t *testing.T) {
+	for id, name := range Collations {
+		if !IsMySQL80Collation(id) {
+			continue
+		}
+		if cid, ok := CollationNames[name]; !ok || cid != id {
+			t.Errorf("collation %s(%d) not found in CollationNames", name, id)
+		}
+		if CollationNameToCharset[name] != UTF8MB4Charset {
+			continue
+		}
+		if err := VerifyCharset(UTF8MB4Charset, name); err != nil {
+			t.Errorf("verify collation %s error: %v", name, err)
+		}
+	}
+	if !IsMySQL80Collation(CharsetIds["gb18030"]) {
+		t.Errorf("gb18030_chinese_ci should be replaced for MySQL 5.x")
+	}
+	if IsMySQL80Collation(CharsetIds[UTF8MB4Charset]) {
+		t.Errorf("utf8mb4_general_ci should be supported by MySQL 5.x")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// compressHeaderSize is the size of compressed packet header:
+	// 3 bytes compressed length, 1 byte sequence and 3 bytes uncompressed length
+	compressHeaderSize = 7
+
+	// minCompressLength payload shorter than it is sent uncompressed, same as MIN_COMPRESS_LENGTH of mysql
+	minCompressLength = 50
+
+	// compressFlushSize pending data larger than it is compressed and written without waiting for Flush
+	compressFlushSize = 64 * 1024
+)
+
+// compressor implements the compressed protocol of mysql with zlib.
+// Packets are written into compressor and sent as compressed packets when flushed,
+// and compressed packets read from connection are decompressed into packets.
+type compressor struct {
+	c *Conn
+
+	// sequence of compressed packets, it's independent of the sequence of packets inside
+	sequence uint8
+
+	// readBuf decompressed data not consumed yet
+	readBuf []byte
+	zr      io.ReadCloser
+
+	// writeBuf packets not compressed yet
+	writeBuf bytes.Buffer
+	zw       *zlib.Writer
+}
+
+func newCompressor(c *Conn) *compressor {
+	return &compressor{c: c, zw: zlib.NewWriter(nil)}
+}
+
+// Read implements io.Reader, it reads decompressed data
+func (cp *compressor) Read(p []byte) (int, error) {
+	for len(cp.readBuf) == 0 {
+		if err := cp.readCompressedPacket(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cp.readBuf)
+	cp.readBuf = cp.readBuf[n:]
+	return n, nil
+}
+
+func (cp *compressor) readCompressedPacket() error {
+	r := cp.c.rawReader()
+	var header [compressHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if strings.HasSuffix(err.Error(), "read: connection reset by peer") {
+			return ErrResetConn
+		}
+		return ErrBadConn
+	}
+
+	compressedLength := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	uncompressedLength := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+	// the peer checks sequence of compressed packets, so continue with the sequence it sent
+	cp.sequence = header[3] + 1
+
+	payload := make([]byte, compressedLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fmt.Errorf("io.ReadFull(compressed packet body of length %v) failed: %v", compressedLength, err)
+	}
+
+	// uncompressed length 0 means payload is not compressed
+	if uncompressedLength == 0 {
+		cp.readBuf = payload
+		return nil
+	}
+
+	var err error
+	if cp.zr == nil {
+		cp.zr, err = zlib.NewReader(bytes.NewReader(payload))
+	} else {
+		err = cp.zr.(zlib.Resetter).Reset(bytes.NewReader(payload), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("decompress packet failed: %v", err)
+	}
+
+	data := make([]byte, uncompressedLength)
+	if _, err := io.ReadFull(cp.zr, data); err != nil {
+		return fmt.Errorf("decompress packet of length %v failed: %v", uncompressedLength, err)
+	}
+	cp.readBuf = data
+	return nil
+}
+
+// Write implements io.Writer, data is kept in buffer until flush
+func (cp *compressor) Write(p []byte) (int, error) {
+	n, _ := cp.writeBuf.Write(p)
+	if cp.writeBuf.Len() >= compressFlushSize {
+		if err := cp.flush(cp.c.rawWriter()); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// flush compress data in buffer and write them to w
+func (cp *compressor) flush(w io.Writer) error {
+	for cp.writeBuf.Len() > 0 {
+		length := cp.writeBuf.Len()
+		if length > MaxPacketSize {
+			length = MaxPacketSize
+		}
+		if err := cp.writeCompressedPacket(w, cp.writeBuf.Next(length)); err != nil {
+			return err
+		}
+	}
+	cp.writeBuf.Reset()
+	return nil
+}
+
+func (cp *compressor) writeCompressedPacket(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, compressHeaderSize))
+
+	uncompressedLength := 0
+	if len(data) >= minCompressLength {
+		cp.zw.Reset(&buf)
+		if _, err := cp.zw.Write(data); err != nil {
+			return fmt.Errorf("compress packet failed: %v", err)
+		}
+		if err := cp.zw.Close(); err != nil {
+			return fmt.Errorf("compress packet failed: %v", err)
+		}
+		uncompressedLength = len(data)
+	}
+
+	// send it uncompressed if it's not worth compressing
+	if uncompressedLength == 0 || buf.Len()-compressHeaderSize >= len(data) {
+		buf.Truncate(compressHeaderSize)
+		buf.Write(data)
+		uncompressedLength = 0
+	}
+
+	packet := buf.Bytes()
+	compressedLength := len(packet) - compressHeaderSize
+	packet[0] = byte(compressedLength)
+	packet[1] = byte(compressedLength >> 8)
+	packet[2] = byte(compressedLength >> 16)
+	packet[3] = cp.sequence
+	packet[4] = byte(uncompressedLength)
+	packet[5] = byte(uncompressedLength >> 8)
+	packet[6] = byte(uncompressedLength >> 16)
+
+	if n, err := w.Write(packet); err != nil {
+		if strings.Contains(err.Error(), ErrResetConn.Error()) {
+			return ErrResetConn
+		}
+		return fmt.Errorf("Conn %v:Write(compressed packet) failed: %v", cp.c.GetConnectionID(), err)
+	} else if n != len(packet) {
+		return fmt.Errorf("Write(compressed packet) returned a short write: %v < %v", n, len(packet))
+	}
+	cp.sequence++
+	return nil
+}
+
+// EnableCompression switch connection to compressed protocol, it should be called
+// after the handshake is done if CLIENT_COMPRESS is negotiated.
+func (c *Conn) EnableCompression() {
+	c.compressor = newCompressor(c)
+}
+
+// IsCompressed return true if connection uses compressed protocol
+func (c *Conn) IsCompressed() bool {
+	return c.compressor != nil
+}
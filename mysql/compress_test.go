@@ -0,0 +1,84 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedPacketRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	cc := NewConn(client)
+	sc := NewConn(server)
+	cc.EnableCompression()
+	sc.EnableCompression()
+	require.True(t, cc.IsCompressed())
+
+	small := []byte("select 1")
+	large := bytes.Repeat([]byte("gaea compressed protocol "), 10000)
+
+	// unbuffered write is sent right now
+	go func() {
+		cc.SetSequence(0)
+		require.Nil(t, cc.WritePacket(small))
+	}()
+	sc.SetSequence(0)
+	data, err := sc.ReadPacket()
+	require.Nil(t, err)
+	require.Equal(t, small, data)
+	require.Equal(t, uint8(1), sc.compressor.sequence)
+
+	// buffered writes are sent when flushed
+	go func() {
+		sc.StartWriterBuffering()
+		require.Nil(t, sc.WritePacket(large))
+		require.Nil(t, sc.WritePacket(small))
+		require.Nil(t, sc.Flush())
+	}()
+	data, err = cc.ReadPacket()
+	require.Nil(t, err)
+	require.Equal(t, large, data)
+	data, err = cc.ReadPacket()
+	require.Nil(t, err)
+	require.Equal(t, small, data)
+}
+
+func TestCompressedPacketHeader(t *testing.T) {
+	var buf bytes.Buffer
+	cp := newCompressor(&Conn{})
+	cp.sequence = 3
+
+	// short payload is not compressed
+	cp.writeBuf.Write([]byte("short"))
+	require.Nil(t, cp.flush(&buf))
+	require.Equal(t, []byte{5, 0, 0, 3, 0, 0, 0, 's', 'h', 'o', 'r', 't'}, buf.Bytes())
+	require.Equal(t, uint8(4), cp.sequence)
+
+	buf.Reset()
+	payload := bytes.Repeat([]byte("a"), 1000)
+	cp.writeBuf.Write(payload)
+	require.Nil(t, cp.flush(&buf))
+	header := buf.Bytes()[:compressHeaderSize]
+	require.Equal(t, buf.Len()-compressHeaderSize, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	require.Equal(t, uint8(4), header[3])
+	require.Equal(t, 1000, int(header[4])|int(header[5])<<8|int(header[6])<<16)
+}
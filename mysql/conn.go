@@ -32,13 +32,14 @@ package mysql
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math/bits"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/XiaoMi/Gaea/util/bucketpool"
 	"github.com/XiaoMi/Gaea/util/sync2"
@@ -50,6 +51,10 @@ const (
 	MinPacketSize   = 128
 	MaxPacketSize   = (1 << 24) - 1
 	WritePacketSize = 16 * 1024
+
+	// MinAllowedPacketSize and MaxAllowedPacketSize are the range of max_allowed_packet of mysql
+	MinAllowedPacketSize = 1024
+	MaxAllowedPacketSize = 1 << 30
 )
 
 var (
@@ -108,8 +113,16 @@ type Conn struct {
 
 	// Packet encoding variables.
 	bufferedReader *bufio.Reader
-	bufferedWriter *bufio.Writer
-	sequence       uint8
+	// readBufferReleased is set when bufferedReader is returned to pool by idle connection
+	readBufferReleased bool
+	bufferedWriter     *packetWriter
+	sequence           uint8
+	// header and iov of packet being written, kept in conn to avoid allocation
+	header [4]byte
+	iov    net.Buffers
+
+	// compressor is set when compressed protocol is negotiated
+	compressor *compressor
 
 	// Keep track of how and of the buffer we allocated for an
 	// ephemeral packet on the read and write sides.
@@ -120,13 +133,42 @@ type Conn struct {
 	// currentEphemeralBuffer for tracking allocated temporary buffer for writes and reads respectively.
 	// It can be allocated from bufPool or heap and should be recycled in the same manner.
 	currentEphemeralBuffer *[]byte
+
+	// readTimeout bounds reading rest of a packet once its header is received, like net_read_timeout of mysql,
+	// writeTimeout bounds each write to the socket, like net_write_timeout of mysql. 0 means no timeout.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// writeDeadline is the time write deadline of socket is refreshed at
+	writeDeadline time.Time
+
+	// maxAllowedPacket bounds length of a request read by ReadEphemeralPacket, like max_allowed_packet of mysql,
+	// 0 means no limit
+	maxAllowedPacket int
 }
 
 // bufPool is used to allocate and free buffers in an efficient way.
 var bufPool = bucketpool.New(MinPacketSize, MaxPacketSize)
 
-// writersPool is used for pooling bufio.Writer objects.
-var writersPool = sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, WritePacketSize) }}
+// InitPacketPoolMaxSize should only be set when starting the proxy, packet buffers larger than size
+// are allocated when used and left to gc rather than pooled. size is rounded down to power of 2.
+func InitPacketPoolMaxSize(size int) {
+	if size < MinPacketSize {
+		size = MinPacketSize
+	}
+	if size >= MaxPacketSize {
+		bufPool = bucketpool.New(MinPacketSize, MaxPacketSize)
+		return
+	}
+	// keep sizes of levels the same as default pool
+	size = MinPacketSize << (bits.Len(uint(size/MinPacketSize)) - 1)
+	bufPool = bucketpool.New(MinPacketSize, size)
+}
+
+// readersPool is used for pooling bufio.Reader objects released by idle connections.
+var readersPool = sync.Pool{New: func() interface{} { return bufio.NewReaderSize(nil, connBufferSize) }}
+
+// writersPool is used for pooling packetWriter objects.
+var writersPool = sync.Pool{New: func() interface{} { return newPacketWriter() }}
 
 // NewConn is an internal method to create a Conn. Used by client and server
 // side for common creation code.
@@ -141,7 +183,7 @@ func NewConn(conn net.Conn) *Conn {
 // StartWriterBuffering starts using buffered writes. This should
 // be terminated by a call to flush.
 func (c *Conn) StartWriterBuffering() {
-	c.bufferedWriter = writersPool.Get().(*bufio.Writer)
+	c.bufferedWriter = writersPool.Get().(*packetWriter)
 	c.bufferedWriter.Reset(c.conn)
 }
 
@@ -151,6 +193,9 @@ func (c *Conn) Flush() error {
 	if c.bufferedWriter == nil {
 		return nil
 	}
+	if err := c.refreshWriteDeadline(); err != nil {
+		return err
+	}
 
 	defer func() {
 		c.bufferedWriter.Reset(nil)
@@ -158,21 +203,66 @@ func (c *Conn) Flush() error {
 		c.bufferedWriter = nil
 	}()
 
+	if c.compressor != nil {
+		if err := c.compressor.flush(c.bufferedWriter); err != nil {
+			return err
+		}
+	}
 	return c.bufferedWriter.Flush()
 }
 
 // getWriter returns the current writer. It may be either
 // the original connection or a wrapper.
 func (c *Conn) getWriter() io.Writer {
+	if c.compressor != nil {
+		return c.compressor
+	}
+	return c.rawWriter()
+}
+
+// rawWriter returns the writer under compressed protocol.
+func (c *Conn) rawWriter() io.Writer {
 	if c.bufferedWriter != nil {
 		return c.bufferedWriter
 	}
 	return c.conn
 }
 
+// ReleaseReadBuffer returns read buffer to pool so that idle connection doesn't hold it,
+// it's taken from pool again by next read. It returns false if there is data buffered.
+func (c *Conn) ReleaseReadBuffer() bool {
+	if c.compressor != nil && len(c.compressor.readBuf) > 0 {
+		return false
+	}
+	if c.bufferedReader == nil {
+		return true
+	}
+	if c.bufferedReader.Buffered() > 0 {
+		return false
+	}
+	c.bufferedReader.Reset(nil)
+	readersPool.Put(c.bufferedReader)
+	c.bufferedReader = nil
+	c.readBufferReleased = true
+	return true
+}
+
 // getReader returns reader for connection. It can be *bufio.Reader or net.Conn
 // depending on which buffer size was passed to newServerConn.
 func (c *Conn) getReader() io.Reader {
+	if c.compressor != nil {
+		return c.compressor
+	}
+	return c.rawReader()
+}
+
+// rawReader returns the reader under compressed protocol.
+func (c *Conn) rawReader() io.Reader {
+	if c.readBufferReleased {
+		c.bufferedReader = readersPool.Get().(*bufio.Reader)
+		c.bufferedReader.Reset(c.conn)
+		c.readBufferReleased = false
+	}
 	if c.bufferedReader != nil {
 		return c.bufferedReader
 	}
@@ -206,6 +296,11 @@ func (c *Conn) readHeaderFrom(r io.Reader) (int, error) {
 	}
 
 	sequence := uint8(header[3])
+	if c.compressor != nil {
+		// sequence of packets inside compressed packets is not checked, like mysql does
+		c.sequence = sequence + 1
+		return length, nil
+	}
 	if sequence != c.sequence {
 		return 0, fmt.Errorf("invalid sequence, expected %v got %v", c.sequence, sequence)
 	}
@@ -240,6 +335,17 @@ func (c *Conn) ReadEphemeralPacket() ([]byte, error) {
 		// exactly size MaxPacketSize.
 		return []byte{}, nil
 	}
+	if c.maxAllowedPacket > 0 && length > c.maxAllowedPacket {
+		return nil, NewDefaultError(ErrNetPacketTooLarge)
+	}
+
+	// waiting for header is not limited, it's idle time between requests
+	if c.readTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return nil, err
+		}
+		defer c.conn.SetReadDeadline(time.Time{})
+	}
 
 	// Use the bufPool.
 	if length < MaxPacketSize {
@@ -269,6 +375,9 @@ func (c *Conn) ReadEphemeralPacket() ([]byte, error) {
 		}
 
 		data = append(data, next...)
+		if c.maxAllowedPacket > 0 && len(data) > c.maxAllowedPacket {
+			return nil, NewDefaultError(ErrNetPacketTooLarge)
+		}
 		if len(next) < MaxPacketSize {
 			break
 		}
@@ -395,16 +504,17 @@ func (c *Conn) ReadPacket() ([]byte, error) {
 }
 
 // WritePacket writes a packet, possibly cutting it into multiple
-// chunks.  Note this is not very efficient, as the client probably
-// has to build the []byte and that makes a memory copy.
-// Try to use StartEphemeralPacket/writeEphemeralPacket instead.
+// chunks. Header and payload are buffered if writer buffering is started,
+// otherwise they are sent in one syscall by writev without copying payload.
 //
 // This method returns a generic error, not a SQLError.
 func (c *Conn) WritePacket(data []byte) error {
 	index := 0
 	length := len(data)
 
-	w := c.getWriter()
+	if err := c.refreshWriteDeadline(); err != nil {
+		return err
+	}
 
 	for {
 		// Packet length is capped to MaxPacketSize.
@@ -414,22 +524,16 @@ func (c *Conn) WritePacket(data []byte) error {
 		}
 
 		// Compute and write the header.
-		header := make([]byte, 4)
-		header[0] = byte(packetLength)
-		header[1] = byte(packetLength >> 8)
-		header[2] = byte(packetLength >> 16)
-		header[3] = c.sequence
-
-		// 这边合并写入，旧版本分开写入，会多一个 tcp PSH 包和一个 tcp ACK 包
-		buf := bytes.NewBuffer(header)
-		buf.Write(data[index : index+packetLength])
-		if n, err := w.Write(buf.Bytes()); err != nil {
+		c.header[0] = byte(packetLength)
+		c.header[1] = byte(packetLength >> 8)
+		c.header[2] = byte(packetLength >> 16)
+		c.header[3] = c.sequence
+
+		if err := c.writePacketData(data[index : index+packetLength]); err != nil {
 			if strings.Contains(err.Error(), ErrResetConn.Error()) {
 				return ErrResetConn
 			}
 			return fmt.Errorf("Conn %v:Write(packet) failed: %v", c.GetConnectionID(), err)
-		} else if n != packetLength+4 {
-			return fmt.Errorf("Write(packet) returned a short write: %v < %v", n, packetLength)
 		}
 
 		// Update our state.
@@ -440,23 +544,41 @@ func (c *Conn) WritePacket(data []byte) error {
 				// The packet we just sent had exactly
 				// MaxPacketSize size, we need to
 				// sent a zero-size packet too.
-				header[0] = 0
-				header[1] = 0
-				header[2] = 0
-				header[3] = c.sequence
-				if n, err := w.Write(header[:]); err != nil {
+				c.header[0] = 0
+				c.header[1] = 0
+				c.header[2] = 0
+				c.header[3] = c.sequence
+				if err := c.writePacketData(nil); err != nil {
 					return fmt.Errorf("Write(empty header) failed: %v", err)
-				} else if n != 4 {
-					return fmt.Errorf("Write(empty header) returned a short write: %v < 4", n)
 				}
 				c.sequence++
 			}
+			// not buffered, send compressed packets right now
+			if c.compressor != nil && c.bufferedWriter == nil {
+				return c.compressor.flush(c.conn)
+			}
 			return nil
 		}
 		index += packetLength
 	}
 }
 
+// writePacketData writes c.header and payload of a packet
+func (c *Conn) writePacketData(payload []byte) error {
+	if c.compressor != nil {
+		// data is kept in buffer of compressor until flush
+		if _, err := c.compressor.Write(c.header[:]); err != nil {
+			return err
+		}
+		_, err := c.compressor.Write(payload)
+		return err
+	}
+	if c.bufferedWriter != nil {
+		return c.bufferedWriter.writePacket(c.header[:], payload)
+	}
+	return writeVectored(c.conn, &c.iov, c.header[:], payload)
+}
+
 // StartEphemeralPacket get []byte from pool
 func (c *Conn) StartEphemeralPacket(length int) []byte {
 	if c.currentEphemeralPolicy != ephemeralUnused {
@@ -506,7 +628,7 @@ func (c *Conn) recycleWritePacket() {
 // Returns SQLError(CRServerGone) if it can't.
 func (c *Conn) writeComQuit() error {
 	// This is a new command, need to reset the sequence.
-	c.sequence = 0
+	c.SetSequence(0)
 
 	data := c.StartEphemeralPacket(1)
 	data[0] = ComQuit
@@ -521,6 +643,44 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// SetDeadline sets the read and write deadlines of the underlying socket.
+// A zero value for t means I/O operations will not time out.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetMaxAllowedPacket set max length of request read by ReadEphemeralPacket, 0 means no limit
+func (c *Conn) SetMaxAllowedPacket(n int) {
+	c.maxAllowedPacket = n
+}
+
+// SetNetTimeouts set net read and write timeout of connection, 0 means no timeout
+func (c *Conn) SetNetTimeouts(readTimeout, writeTimeout time.Duration) {
+	c.readTimeout = readTimeout
+	if writeTimeout != c.writeTimeout {
+		c.writeTimeout = writeTimeout
+		// deadline is set again or cleared by next write
+		c.writeDeadline = time.Time{}
+		if writeTimeout <= 0 {
+			c.conn.SetWriteDeadline(time.Time{})
+		}
+	}
+}
+
+// refreshWriteDeadline extend write deadline of socket, it's refreshed at most once in 1/10 of timeout
+// to reduce syscalls when writing many rows, so actual timeout is between 0.9 and 1 times of writeTimeout
+func (c *Conn) refreshWriteDeadline() error {
+	if c.writeTimeout <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(c.writeDeadline) < c.writeTimeout/10 {
+		return nil
+	}
+	c.writeDeadline = now
+	return c.conn.SetWriteDeadline(now.Add(c.writeTimeout))
+}
+
 // GetConnectionID returns the MySQL connection ID for this connection.
 func (c *Conn) GetConnectionID() uint32 {
 	return c.ConnectionID
@@ -534,6 +694,9 @@ func (c *Conn) SetConnectionID(connectionID uint32) {
 // SetSequence set sequence of conn
 func (c *Conn) SetSequence(sequence uint8) {
 	c.sequence = sequence
+	if c.compressor != nil {
+		c.compressor.sequence = sequence
+	}
 }
 
 // GetSequence return sequence of conn
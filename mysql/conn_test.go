@@ -16,7 +16,9 @@ package mysql
 
 import (
 	"bufio"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/XiaoMi/Gaea/util/mocks/pipeTest"
 	"github.com/stretchr/testify/require"
@@ -30,7 +32,7 @@ func TestMariadbConnWithoutDB(t *testing.T) {
 		mockClient, mockServer := pipeTest.NewDcServerClient(t, pipeTest.TestReplyMsgFunc) // 产生 Gaea 和 MariaDB 模拟物件
 
 		// 针对这次测试进行临时修改
-		err := mockClient.OverwriteConnBufWrite(nil, writersPool.Get().(*bufio.Writer))
+		err := mockClient.OverwriteConnBufWrite(nil, bufio.NewWriterSize(nil, WritePacketSize))
 		mockClient.GetBufWriter().Reset(mockClient.GetConnWrite())
 		require.Equal(t, err, nil)
 
@@ -62,3 +64,107 @@ func TestInitNetBufferSize(t *testing.T) {
 	InitNetBufferSize(16*1024 + 1)
 	require.Equal(t, connBufferSize, 16*1024)
 }
+
+func TestConnNetTimeouts(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	defer c.Close()
+	c.SetNetTimeouts(50*time.Millisecond, 50*time.Millisecond)
+
+	// waiting for header is not limited
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		client.Write([]byte{1, 0, 0, 0, ComQuery})
+	}()
+	data, err := c.ReadEphemeralPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte{ComQuery}, data)
+	c.RecycleReadPacket()
+
+	// rest of packet is not received in time
+	go client.Write([]byte{2, 0, 0, 1, ComQuery})
+	_, err = c.ReadEphemeralPacket()
+	require.Error(t, err)
+	c.RecycleReadPacket()
+
+	// client doesn't read
+	c.SetSequence(0)
+	start := time.Now()
+	require.Error(t, c.WritePacket([]byte{0}))
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestConnMaxAllowedPacket(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	defer c.Close()
+	c.SetMaxAllowedPacket(2)
+
+	go client.Write([]byte{2, 0, 0, 0, ComQuery, '1'})
+	data, err := c.ReadEphemeralPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte{ComQuery, '1'}, data)
+	c.RecycleReadPacket()
+
+	// body is not read if header exceeds the limit
+	go client.Write([]byte{3, 0, 0, 0})
+	c.SetSequence(0)
+	_, err = c.ReadEphemeralPacket()
+	require.Equal(t, uint16(ErrNetPacketTooLarge), err.(*SQLError).Code)
+	c.RecycleReadPacket()
+}
+
+func TestReleaseReadBuffer(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	defer c.Close()
+
+	go client.Write([]byte{1, 0, 0, 0, ComPing, 1, 0, 0, 0, ComQuit})
+	data, err := c.ReadEphemeralPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte{ComPing}, data)
+	c.RecycleReadPacket()
+	// the second packet is buffered
+	require.False(t, c.ReleaseReadBuffer())
+
+	c.SetSequence(0)
+	data, err = c.ReadEphemeralPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte{ComQuit}, data)
+	c.RecycleReadPacket()
+	require.True(t, c.ReleaseReadBuffer())
+	require.Nil(t, c.bufferedReader)
+
+	// buffer is taken from pool by next read
+	go client.Write([]byte{1, 0, 0, 0, ComPing})
+	c.SetSequence(0)
+	data, err = c.ReadEphemeralPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte{ComPing}, data)
+	c.RecycleReadPacket()
+	require.NotNil(t, c.bufferedReader)
+}
+
+func TestInitPacketPoolMaxSize(t *testing.T) {
+	defer InitPacketPoolMaxSize(MaxPacketSize)
+
+	InitPacketPoolMaxSize(1000 * 1000)
+	// rounded down to power of 2, larger buffers are allocated with exact size
+	buf := bufPool.Get(512 * 1024)
+	require.Equal(t, 512*1024, cap(*buf))
+	bufPool.Put(buf)
+	buf = bufPool.Get(512*1024 + 1)
+	require.Equal(t, 512*1024+1, cap(*buf))
+	bufPool.Put(buf)
+
+	InitPacketPoolMaxSize(0)
+	buf = bufPool.Get(MinPacketSize + 1)
+	require.Equal(t, MinPacketSize+1, cap(*buf))
+
+	InitPacketPoolMaxSize(MaxPacketSize + 1)
+	buf = bufPool.Get(MaxPacketSize - 1)
+	require.Equal(t, MaxPacketSize, cap(*buf))
+}
@@ -221,6 +221,7 @@ const (
 
 const (
 	TkStrFrom = "from"
+	TkStrJoin = "join"
 	TkStrInto = "into"
 	TkStrSet  = "set"
 	TkStrShow = "show"
@@ -35,6 +35,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"time"
 
@@ -250,7 +251,7 @@ func ReadByte(data []byte, pos int) (byte, int, bool) {
 
 // ReadBytes read []byte from pos with sized size
 func ReadBytes(data []byte, pos int, size int) ([]byte, int, bool) {
-	if pos+size-1 >= len(data) {
+	if size < 0 || pos+size-1 >= len(data) {
 		return nil, 0, false
 	}
 	return data[pos : pos+size], pos + size, true
@@ -259,7 +260,7 @@ func ReadBytes(data []byte, pos int, size int) ([]byte, int, bool) {
 // ReadBytesCopy returns a copy of the bytes in the packet.
 // Useful to remember contents of ephemeral packets.
 func ReadBytesCopy(data []byte, pos int, size int) ([]byte, int, bool) {
-	if pos+size-1 >= len(data) {
+	if size < 0 || pos+size-1 >= len(data) {
 		return nil, 0, false
 	}
 	result := make([]byte, size)
@@ -360,7 +361,7 @@ func readLenEncString(data []byte, pos int) (string, int, bool) {
 		return "", 0, false
 	}
 	s := int(size)
-	if pos+s-1 >= len(data) {
+	if s < 0 || pos+s-1 >= len(data) {
 		return "", 0, false
 	}
 	return string(data[pos : pos+s]), pos + s, true
@@ -373,12 +374,56 @@ func skipLenEncString(data []byte, pos int) (int, bool) {
 		return 0, false
 	}
 	s := int(size)
-	if pos+s-1 >= len(data) {
+	if s < 0 || pos+s-1 >= len(data) {
 		return 0, false
 	}
 	return pos + s, true
 }
 
+// ReadConnectAttrs read connection attributes in handshake response, which are
+// a length encoded total length followed by length encoded key value strings.
+// return attributes, next pos, handle result
+func ReadConnectAttrs(data []byte, pos int) (map[string]string, int, bool) {
+	total, pos, _, ok := ReadLenEncInt(data, pos)
+	if !ok {
+		return nil, 0, false
+	}
+	end := pos + int(total)
+	if end < pos || end > len(data) {
+		return nil, 0, false
+	}
+
+	attrs := make(map[string]string)
+	var key, value string
+	for pos < end {
+		if key, pos, ok = readLenEncString(data[:end], pos); !ok {
+			return nil, 0, false
+		}
+		if value, pos, ok = readLenEncString(data[:end], pos); !ok {
+			return nil, 0, false
+		}
+		attrs[key] = value
+	}
+	return attrs, pos, true
+}
+
+// AppendConnectAttrs append connection attributes in handshake response format, keys are sorted
+func AppendConnectAttrs(data []byte, attrs map[string]string) []byte {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf []byte
+	for _, k := range keys {
+		buf = AppendLenEncStringBytes(buf, []byte(k))
+		buf = AppendLenEncStringBytes(buf, []byte(attrs[k]))
+	}
+	data = AppendLenEncInt(data, uint64(len(buf)))
+	return append(data, buf...)
+}
+
 // ReadLenEncStringAsBytes read len encoded string, return []byte format, next pos, is null, handle result
 func ReadLenEncStringAsBytes(data []byte, pos int) ([]byte, int, bool, bool) {
 	size, pos, isNull, ok := ReadLenEncInt(data, pos)
@@ -386,7 +431,7 @@ func ReadLenEncStringAsBytes(data []byte, pos int) ([]byte, int, bool, bool) {
 		return nil, 0, isNull, false
 	}
 	s := int(size)
-	if pos+s-1 >= len(data) {
+	if s < 0 || pos+s-1 >= len(data) {
 		return nil, 0, isNull, false
 	}
 	return data[pos : pos+s], pos + s, isNull, true
@@ -394,6 +439,9 @@ func ReadLenEncStringAsBytes(data []byte, pos int) ([]byte, int, bool, bool) {
 
 // FormatBinaryDate format binary date type
 func FormatBinaryDate(n int, data []byte) ([]byte, error) {
+	if len(data) < n {
+		return nil, ErrMalformPacket
+	}
 	switch n {
 	case 0:
 		return []byte("0000-00-00"), nil
@@ -405,7 +453,7 @@ func FormatBinaryDate(n int, data []byte) ([]byte, error) {
 			data[2],
 			data[3])), nil
 	case 10: // string '2017-02-17'
-		return data, nil
+		return data[:n], nil
 	default:
 		return nil, fmt.Errorf("invalid date packet length %d", n)
 	}
@@ -413,6 +461,9 @@ func FormatBinaryDate(n int, data []byte) ([]byte, error) {
 
 // FormatBinaryDateTime format binary datetime type
 func FormatBinaryDateTime(n int, data []byte) ([]byte, error) {
+	if len(data) < n {
+		return nil, ErrMalformPacket
+	}
 	switch n {
 	case 0:
 		return []byte("0000-00-00 00:00:00"), nil
@@ -441,7 +492,7 @@ func FormatBinaryDateTime(n int, data []byte) ([]byte, error) {
 			data[6],
 			binary.LittleEndian.Uint32(data[7:11]))), nil
 	case 19, 26:
-		return data, nil
+		return data[:n], nil
 	default:
 		return nil, fmt.Errorf("invalid datetime packet length %d", n)
 	}
@@ -449,6 +500,9 @@ func FormatBinaryDateTime(n int, data []byte) ([]byte, error) {
 
 // FormatBinaryTime format binary time type
 func FormatBinaryTime(n int, data []byte) ([]byte, error) {
+	if len(data) < n {
+		return nil, ErrMalformPacket
+	}
 	if n == 0 {
 		return []byte("0000-00-00"), nil
 	} else if n == 1 {
@@ -18,6 +18,7 @@ package mysql
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -359,3 +360,27 @@ func TestEncString(t *testing.T) {
 		}
 	}
 }
+
+func TestConnectAttrs(t *testing.T) {
+	attrs := map[string]string{
+		"_client_name": "libmysql",
+		"program_name": "mysql",
+		"empty":        "",
+	}
+	data := AppendConnectAttrs([]byte{0xff}, attrs)
+	got, pos, ok := ReadConnectAttrs(data, 1)
+	if !ok {
+		t.Fatalf("ReadConnectAttrs failed, data: %v", data)
+	}
+	if pos != len(data) {
+		t.Errorf("unexpected pos %v after ReadConnectAttrs, expected %v", pos, len(data))
+	}
+	if !reflect.DeepEqual(got, attrs) {
+		t.Errorf("unexpected attrs %v, expected %v", got, attrs)
+	}
+
+	// truncated data
+	if _, _, ok := ReadConnectAttrs(data[:len(data)-1], 1); ok {
+		t.Errorf("ReadConnectAttrs should fail with truncated data")
+	}
+}
@@ -920,6 +920,7 @@ const (
 	ErrWindowNoGroupOrderUnused                                     = 3597
 	ErrWindowExplainJSON                                            = 3598
 	ErrWindowFunctionIgnoresFrame                                   = 3599
+	ErrQueryTimeout                                                 = 3024
 	ErrClientQpsLimited                                             = 901
 )
 
@@ -0,0 +1,93 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package mysql
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// readerConn is a net.Conn reading from a buffer, writes are discarded
+type readerConn struct {
+	net.Conn
+	r *bytes.Reader
+}
+
+func (c *readerConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *readerConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *readerConn) Close() error                       { return nil }
+func (c *readerConn) SetDeadline(t time.Time) error      { return nil }
+func (c *readerConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *readerConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// FuzzReadPacket check that reading packets from a malformed stream returns error instead of panic
+func FuzzReadPacket(f *testing.F) {
+	f.Add([]byte{0x01, 0x00, 0x00, 0x00, ComQuit}, false)
+	f.Add(append([]byte{0x09, 0x00, 0x00, 0x00, ComQuery}, "select 1"...), false)
+	f.Add([]byte{0xff, 0xff, 0xff, 0x00, 0x00}, false)
+	f.Add([]byte{0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, true)
+
+	f.Fuzz(func(t *testing.T, data []byte, compressed bool) {
+		c := NewConn(&readerConn{r: bytes.NewReader(data)})
+		if compressed {
+			c.EnableCompression()
+		}
+		for i := 0; i < 16; i++ {
+			if _, err := c.ReadPacket(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// FuzzDecodePacket check that decoders of packet payload don't panic on malformed payload
+func FuzzDecodePacket(f *testing.F) {
+	f.Add([]byte{OKHeader, 0x01, 0x02, 0x02, 0x00, 0x00, 0x00})
+	f.Add(append([]byte{ErrHeader, 0x15, 0x04, '#', '2', '8', '0', '0', '0'}, "Access denied"...))
+	f.Add([]byte{EOFHeader, 0x00, 0x00, 0x02, 0x00})
+	f.Add([]byte{0xfc, 0xfb, 0x00, 0x03, 'a', 'b', 'c'})
+	f.Add(AppendConnectAttrs(nil, map[string]string{"_client_name": "libmysql", "program_name": "mysql"}))
+	f.Add([]byte{0x0b, 0xe4, 0x07, 0x01, 0x02, 0x03, 0x04, 0x05, 0x40, 0x42, 0x0f, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		// clip capacity, so reading beyond the payload panics instead of reading garbage
+		data = data[:len(data):len(data)]
+		switch {
+		case IsOKPacket(data):
+			_, _, _, _, _ = parseOKHeader(data)
+		case IsErrorPacket(data):
+			_ = ParseErrorPacket(data)
+		case isEOFHeader(data):
+			_, _, _ = parseEOFHeader(data)
+		}
+		_, _, _, _ = ReadLenEncInt(data, 0)
+		_, _, _, _ = ReadLenEncStringAsBytes(data, 0)
+		_, _, _ = ReadNullString(data, 0)
+		_, _, _ = ReadConnectAttrs(data, 0)
+		// binary date and time values, the first byte is length of value
+		n := int(data[0])
+		_, _ = FormatBinaryDate(n, data[1:])
+		_, _ = FormatBinaryDateTime(n, data[1:])
+		_, _ = FormatBinaryTime(n, data[1:])
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"io"
+	"net"
+)
+
+const (
+	minWriteFlushThreshold = 1024
+	maxWriteFlushThreshold = 1024 * 1024
+)
+
+// writeFlushThreshold is how many bytes of packets are buffered before they are written to socket
+var writeFlushThreshold = WritePacketSize
+
+// InitWriteFlushThreshold should only be set when starting the proxy
+func InitWriteFlushThreshold(size int) {
+	if size < minWriteFlushThreshold {
+		size = minWriteFlushThreshold
+	}
+	if size > maxWriteFlushThreshold {
+		size = maxWriteFlushThreshold
+	}
+	writeFlushThreshold = size
+}
+
+// packetWriter buffers packets until flush threshold is reached, data which can't fit in the buffer
+// is written together with buffered data by writev, so large payloads are sent in one syscall without copying.
+type packetWriter struct {
+	w   io.Writer
+	buf []byte
+	iov net.Buffers
+}
+
+func newPacketWriter() *packetWriter {
+	return &packetWriter{buf: make([]byte, 0, writeFlushThreshold)}
+}
+
+// Reset discards buffered data and switches to write to w
+func (pw *packetWriter) Reset(w io.Writer) {
+	pw.w = w
+	pw.buf = pw.buf[:0]
+}
+
+// Write implements io.Writer
+func (pw *packetWriter) Write(p []byte) (int, error) {
+	if err := pw.writePacket(p, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writePacket buffers header and payload, they are written with buffered data if threshold is exceeded
+func (pw *packetWriter) writePacket(header, payload []byte) error {
+	if len(pw.buf)+len(header)+len(payload) <= cap(pw.buf) {
+		pw.buf = append(pw.buf, header...)
+		pw.buf = append(pw.buf, payload...)
+		return nil
+	}
+	err := writeVectored(pw.w, &pw.iov, pw.buf, header, payload)
+	pw.buf = pw.buf[:0]
+	return err
+}
+
+// Flush writes buffered data to underlying writer
+func (pw *packetWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	_, err := pw.w.Write(pw.buf)
+	pw.buf = pw.buf[:0]
+	return err
+}
+
+// writeVectored writes non-empty bufs in one writev syscall if w is a tcp or unix socket,
+// iov is reused to avoid allocation and cleared after writing so that bufs are not referenced.
+func writeVectored(w io.Writer, iov *net.Buffers, bufs ...[]byte) error {
+	v := (*iov)[:0]
+	for _, b := range bufs {
+		if len(b) > 0 {
+			v = append(v, b)
+		}
+	}
+	// WriteTo consumes *iov, v keeps the backing array for reuse
+	*iov = v
+	_, err := iov.WriteTo(w)
+	for i := range v {
+		v[i] = nil
+	}
+	*iov = v[:0]
+	return err
+}
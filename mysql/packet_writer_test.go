@@ -0,0 +1,111 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordConn records data and count of writes
+type recordConn struct {
+	net.Conn
+	buf    bytes.Buffer
+	writes int
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	c.writes++
+	return c.buf.Write(p)
+}
+
+func TestInitWriteFlushThreshold(t *testing.T) {
+	defer InitWriteFlushThreshold(WritePacketSize)
+	InitWriteFlushThreshold(0)
+	require.Equal(t, minWriteFlushThreshold, writeFlushThreshold)
+	InitWriteFlushThreshold(64 * 1024)
+	require.Equal(t, 64*1024, writeFlushThreshold)
+	InitWriteFlushThreshold(maxWriteFlushThreshold + 1)
+	require.Equal(t, maxWriteFlushThreshold, writeFlushThreshold)
+}
+
+func TestPacketWriter(t *testing.T) {
+	conn := &recordConn{}
+	pw := &packetWriter{buf: make([]byte, 0, 16)}
+	pw.Reset(conn)
+
+	// small packets are buffered until flush
+	require.Nil(t, pw.writePacket([]byte{1, 0, 0, 0}, []byte("a")))
+	require.Nil(t, pw.writePacket([]byte{2, 0, 0, 1}, []byte("bc")))
+	require.Equal(t, 0, conn.writes)
+	require.Nil(t, pw.Flush())
+	require.Equal(t, 1, conn.writes)
+	require.Equal(t, []byte{1, 0, 0, 0, 'a', 2, 0, 0, 1, 'b', 'c'}, conn.buf.Bytes())
+	require.Nil(t, pw.Flush())
+	require.Equal(t, 1, conn.writes)
+
+	// packet exceeding threshold is written with buffered data
+	conn.buf.Reset()
+	large := bytes.Repeat([]byte("x"), 20)
+	require.Nil(t, pw.writePacket([]byte{1, 0, 0, 0}, []byte("a")))
+	require.Nil(t, pw.writePacket([]byte{20, 0, 0, 1}, large))
+	require.Equal(t, append([]byte{1, 0, 0, 0, 'a', 20, 0, 0, 1}, large...), conn.buf.Bytes())
+	require.Equal(t, 0, len(pw.buf))
+	for _, b := range pw.iov[:cap(pw.iov)] {
+		require.Nil(t, b)
+	}
+}
+
+func TestWritePacketBuffered(t *testing.T) {
+	conn := &recordConn{}
+	c := NewConn(conn)
+	c.StartWriterBuffering()
+	rows := 100
+	for i := 0; i < rows; i++ {
+		require.Nil(t, c.WritePacket([]byte("gaea row")))
+	}
+	require.Nil(t, c.Flush())
+	require.Equal(t, 1, conn.writes)
+	require.Equal(t, rows*(4+len("gaea row")), conn.buf.Len())
+
+	// unbuffered packet is written in one call
+	conn.buf.Reset()
+	c.SetSequence(3)
+	require.Nil(t, c.WritePacket([]byte("select 1")))
+	require.Equal(t, append([]byte{8, 0, 0, 3}, "select 1"...), conn.buf.Bytes())
+}
+
+func BenchmarkWritePacketBuffered(b *testing.B) {
+	b.ReportAllocs()
+	conn := &recordConn{}
+	c := NewConn(conn)
+	row := bytes.Repeat([]byte("gaea"), 64)
+	for i := 0; i < b.N; i++ {
+		c.StartWriterBuffering()
+		for j := 0; j < 1000; j++ {
+			if err := c.WritePacket(row); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := c.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		conn.buf.Reset()
+	}
+	b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+}
@@ -199,7 +199,8 @@ func (p RowData) ParseBinary(f []*Field) ([]interface{}, error) {
 		case TypeDecimal, TypeNewDecimal, TypeVarchar,
 			TypeBit, TypeEnum, TypeSet, TypeTinyBlob,
 			TypeMediumBlob, TypeLongBlob, TypeBlob,
-			TypeVarString, TypeString, TypeGeometry:
+			TypeVarString, TypeString, TypeGeometry,
+			TypeJSON:
 			var ok = false
 			v, pos, isNull, ok = ReadLenEncStringAsBytes(p, pos)
 			if !ok {
@@ -516,13 +517,17 @@ func BuildResultset(fields []*Field, names []string, values [][]interface{}) (*R
 
 	var b []byte
 	var err error
+	// numbers are formatted in scratch, rows are likely to have similar size as the previous one
+	var scratch [32]byte
+	rowSize := 0
+	r.RowDatas = make([]RowData, 0, len(values))
 
 	for i, vs := range values {
 		if len(vs) != len(r.Fields) {
 			return nil, fmt.Errorf("row %d has %d column not equal %d", i, len(vs), len(r.Fields))
 		}
 
-		var row []byte
+		row := make([]byte, 0, rowSize)
 		for j, value := range vs {
 			// build fields
 			if i == 0 {
@@ -541,7 +546,7 @@ func BuildResultset(fields []*Field, names []string, values [][]interface{}) (*R
 
 			}
 			// build row values
-			b, err = formatValue(value)
+			b, err = appendFormatValue(scratch[:0], value)
 			if err != nil {
 				return nil, err
 			}
@@ -549,6 +554,7 @@ func BuildResultset(fields []*Field, names []string, values [][]interface{}) (*R
 			row = AppendLenEncStringBytes(row, b)
 		}
 
+		rowSize = len(row)
 		r.RowDatas = append(r.RowDatas, row)
 	}
 	//assign the values to the result
@@ -567,6 +573,7 @@ func BuildBinaryResultset(fields []*Field, values [][]interface{}) (*Resultset,
 	}
 
 	bitmapLen := (len(fields) + 7 + 2) >> 3
+	r.RowDatas = make([]RowData, 0, len(values))
 	for i, v := range values {
 		if len(v) != len(r.Fields) {
 			return nil, fmt.Errorf("row %d has %d columns not equal %d", i, len(v), len(r.Fields))
@@ -623,34 +630,40 @@ func formatField(field *Field, value interface{}) error {
 
 // formatValue encode value into a string format
 func formatValue(value interface{}) ([]byte, error) {
+	return appendFormatValue(nil, value)
+}
+
+// appendFormatValue encode value into a string format, numbers are appended to dst,
+// []byte and string values are returned as they are without copying
+func appendFormatValue(dst []byte, value interface{}) ([]byte, error) {
 	if value == nil {
 		return hack.Slice("NULL"), nil
 	}
 	switch v := value.(type) {
 	case int8:
-		return strconv.AppendInt(nil, int64(v), 10), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case int16:
-		return strconv.AppendInt(nil, int64(v), 10), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case int32:
-		return strconv.AppendInt(nil, int64(v), 10), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case int64:
-		return strconv.AppendInt(nil, int64(v), 10), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case int:
-		return strconv.AppendInt(nil, int64(v), 10), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case uint8:
-		return strconv.AppendUint(nil, uint64(v), 10), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case uint16:
-		return strconv.AppendUint(nil, uint64(v), 10), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case uint32:
-		return strconv.AppendUint(nil, uint64(v), 10), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case uint64:
-		return strconv.AppendUint(nil, uint64(v), 10), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case uint:
-		return strconv.AppendUint(nil, uint64(v), 10), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case float32:
-		return strconv.AppendFloat(nil, float64(v), 'f', -1, 64), nil
+		return strconv.AppendFloat(dst, float64(v), 'f', -1, 64), nil
 	case float64:
-		return strconv.AppendFloat(nil, float64(v), 'f', -1, 64), nil
+		return strconv.AppendFloat(dst, float64(v), 'f', -1, 64), nil
 	case []byte:
 		return v, nil
 	case string:
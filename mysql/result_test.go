@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONField(t *testing.T) {
+	fields := []*Field{
+		{Name: []byte("id"), Type: TypeLonglong, Flag: uint16(BinaryFlag | NotNullFlag)},
+		{Name: []byte("data"), Type: TypeJSON, Charset: 63, Flag: uint16(BinaryFlag | BlobFlag)},
+	}
+	doc := []byte(`{"name": "a\"b", "tags": [1, 2]}`)
+	values := [][]interface{}{{int64(1), doc}, {int64(2), []byte("[]")}}
+
+	// text protocol
+	rs, err := BuildResultset(fields, []string{"id", "data"}, values)
+	assert.Nil(t, err)
+	for i, row := range rs.RowDatas {
+		parsed, err := row.ParseText(rs.Fields)
+		assert.Nil(t, err)
+		assert.Equal(t, values[i][1], parsed[1])
+	}
+
+	// binary protocol, with null json value
+	values = append(values, []interface{}{int64(3), nil})
+	rs, err = BuildBinaryResultset(fields, values)
+	assert.Nil(t, err)
+	for i, row := range rs.RowDatas {
+		parsed, err := row.ParseBinary(rs.Fields)
+		assert.Nil(t, err)
+		assert.Equal(t, values[i][0], parsed[0])
+		assert.Equal(t, values[i][1], parsed[1])
+	}
+}
+
+func BenchmarkBuildResultset(b *testing.B) {
+	b.ReportAllocs()
+	names := []string{"id", "name", "score"}
+	values := [][]interface{}{{int64(1), "abc", 1.5}, {int64(2), "def", 2.5}}
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildResultset(nil, names, values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
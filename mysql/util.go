@@ -34,10 +34,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"math/rand"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
 
+// CachingSha2DigestPrefix prefix of caching_sha2_password digest in user config
+const CachingSha2DigestPrefix = "$SHA2$"
+
 var (
 	dontEscape = byte(255)
 	encodeMap  [256]byte
@@ -79,7 +83,7 @@ func CheckHashPassword(clientResp, scramble, encryptPassword []byte) bool {
 	// SHA1('password') XOR SHA1("20-bytes rnd"+SHA1(SHA1('password')))
 	// Server
 	// SHA1(client-response XOR SHA1("20-bytes rnd"+mysql.user.password))
-	if len(encryptPassword) == 0 {
+	if len(encryptPassword) == 0 || len(clientResp) != sha1.Size {
 		return false
 	}
 	hashBytes, _ := hex.DecodeString(string(encryptPassword))
@@ -88,12 +92,14 @@ func CheckHashPassword(clientResp, scramble, encryptPassword []byte) bool {
 	crypt.Write(hashBytes)
 	hash := crypt.Sum(nil)
 
+	// clientResp is not modified, it may be checked with other passwords
+	stage1 := make([]byte, sha1.Size)
 	for i := range clientResp {
-		clientResp[i] ^= hash[i]
+		stage1[i] = clientResp[i] ^ hash[i]
 	}
 
 	crypt.Reset()
-	crypt.Write(clientResp)
+	crypt.Write(stage1)
 	hash = crypt.Sum(nil)
 
 	return bytes.Equal(hashBytes, hash)
@@ -124,6 +130,60 @@ func CalcCachingSha2Password(salt []byte, password string) []byte {
 	return message1
 }
 
+// NativePasswordHash 返回mysql_native_password密文, 与mysql 5.x PASSWORD()函数结果相同, 即 *HEX(SHA1(SHA1(password)))
+func NativePasswordHash(password string) string {
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(stage2[:]))
+}
+
+// IsNativePasswordHash check if password is mysql_native_password hash like *6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9
+func IsNativePasswordHash(password string) bool {
+	return len(password) == 41 && strings.HasPrefix(password, "*") && isHex(password[1:])
+}
+
+// CachingSha2PasswordDigest 返回caching_sha2_password快速认证使用的摘要, 即 $SHA2$HEX(SHA256(SHA256(password)))
+func CachingSha2PasswordDigest(password string) string {
+	stage1 := sha256.Sum256([]byte(password))
+	stage2 := sha256.Sum256(stage1[:])
+	return CachingSha2DigestPrefix + strings.ToUpper(hex.EncodeToString(stage2[:]))
+}
+
+// IsCachingSha2Digest check if password is caching_sha2_password digest returned by CachingSha2PasswordDigest
+func IsCachingSha2Digest(password string) bool {
+	return len(password) == len(CachingSha2DigestPrefix)+2*sha256.Size &&
+		strings.HasPrefix(password, CachingSha2DigestPrefix) && isHex(password[len(CachingSha2DigestPrefix):])
+}
+
+// CheckCachingSha2Digest 以摘要验证caching_sha2_password快速认证的客户端密码
+func CheckCachingSha2Digest(clientResp, salt []byte, digest string) bool {
+	// Client
+	// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), salt))
+	// Server
+	// SHA256(XOR(client-response, SHA256(digest, salt))) == digest
+	stage2, err := hex.DecodeString(strings.TrimPrefix(digest, CachingSha2DigestPrefix))
+	if err != nil || len(stage2) != sha256.Size || len(clientResp) != sha256.Size {
+		return false
+	}
+	crypt := sha256.New()
+	crypt.Write(stage2)
+	crypt.Write(salt)
+	hash := crypt.Sum(nil)
+
+	stage1 := make([]byte, sha256.Size)
+	for i := range clientResp {
+		stage1[i] = clientResp[i] ^ hash[i]
+	}
+	crypt.Reset()
+	crypt.Write(stage1)
+	return bytes.Equal(crypt.Sum(nil), stage2)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 // CalcPasswordSHA1 根据一次sha1加密半成品生成最终加密串
 func CalcPasswordSHA1(scramble, passwordSHA1 []byte) []byte {
 	if len(passwordSHA1) == 0 {
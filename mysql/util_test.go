@@ -70,3 +70,48 @@ func TestCalcPassword2(t *testing.T) {
 	hexScramble := hex.EncodeToString(scramble)
 	t.Logf("scramble: %s equal %s, pass: %v", "896d208c92429f5d1d5cb67f1ca3a639d7abdf335b05f58894e7f11d90608ca4", hexScramble, "896d208c92429f5d1d5cb67f1ca3a639d7abdf335b05f58894e7f11d90608ca4" == hexScramble)
 }
+
+func TestNativePasswordHash(t *testing.T) {
+	// select password('123456') in mysql 5.7
+	hash := NativePasswordHash("123456")
+	if hash != "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9" {
+		t.Fatalf("unexpected hash: %s", hash)
+	}
+	if !IsNativePasswordHash(hash) || IsNativePasswordHash("123456") || IsNativePasswordHash("*"+hash[2:]) {
+		t.Fatal("check native password hash failed")
+	}
+
+	salt, _ := RandomBuf(20)
+	auth := CalcPassword(salt, []byte("123456"))
+	if !CheckHashPassword(auth, salt, []byte(hash[1:])) {
+		t.Fatal("check hash password failed")
+	}
+	// auth is not modified, so it can be checked again
+	if !CheckHashPassword(auth, salt, []byte(hash[1:])) {
+		t.Fatal("check hash password again failed")
+	}
+	if CheckHashPassword(CalcPassword(salt, []byte("654321")), salt, []byte(hash[1:])) {
+		t.Fatal("wrong password passed")
+	}
+	if CheckHashPassword(CalcCachingSha2Password(salt, "123456"), salt, []byte(hash[1:])) {
+		t.Fatal("auth response of wrong length passed")
+	}
+}
+
+func TestCachingSha2PasswordDigest(t *testing.T) {
+	digest := CachingSha2PasswordDigest("123456")
+	if !IsCachingSha2Digest(digest) || IsCachingSha2Digest(digest[:len(digest)-1]) || IsCachingSha2Digest("$SHA2$123456") {
+		t.Fatal("check caching_sha2_password digest failed")
+	}
+
+	salt, _ := RandomBuf(20)
+	if !CheckCachingSha2Digest(CalcCachingSha2Password(salt, "123456"), salt, digest) {
+		t.Fatal("check caching_sha2_password digest failed")
+	}
+	if CheckCachingSha2Digest(CalcCachingSha2Password(salt, "654321"), salt, digest) {
+		t.Fatal("wrong password passed")
+	}
+	if CheckCachingSha2Digest(CalcPassword(salt, []byte("123456")), salt, digest) {
+		t.Fatal("auth response of wrong length passed")
+	}
+}
@@ -60,10 +60,66 @@ var variableVerifyFuncMap = map[string]verifyFunc{
 	TransactionIsolation:   verifyString,
 }
 
+// session variable types, same as the types of allowed_session_variables in namespace config
+const (
+	VariableTypeInt    = "int"
+	VariableTypeString = "string"
+	VariableTypeBool   = "bool"
+)
+
+// trackedSessionVariables are session scope system variables commonly set by ORMs and connectors,
+// they are tracked per client session and replayed when the session switches backend connection
+// if track_session_variables of namespace is enabled. Values are checked by their types when set.
+var trackedSessionVariables = map[string]string{
+	"auto_increment_increment":        VariableTypeInt,
+	"auto_increment_offset":           VariableTypeInt,
+	"big_tables":                      VariableTypeBool,
+	"block_encryption_mode":           VariableTypeString,
+	"cte_max_recursion_depth":         VariableTypeInt,
+	"default_storage_engine":          VariableTypeString,
+	"default_tmp_storage_engine":      VariableTypeString,
+	"default_week_format":             VariableTypeInt,
+	"div_precision_increment":         VariableTypeInt,
+	"end_markers_in_json":             VariableTypeBool,
+	"eq_range_index_dive_limit":       VariableTypeInt,
+	"explicit_defaults_for_timestamp": VariableTypeBool,
+	"foreign_key_checks":              VariableTypeBool,
+	"innodb_lock_wait_timeout":        VariableTypeInt,
+	"innodb_strict_mode":              VariableTypeBool,
+	"join_buffer_size":                VariableTypeInt,
+	"lc_time_names":                   VariableTypeString,
+	"lock_wait_timeout":               VariableTypeInt,
+	"max_heap_table_size":             VariableTypeInt,
+	"max_join_size":                   VariableTypeInt,
+	"max_sort_length":                 VariableTypeInt,
+	"optimizer_search_depth":          VariableTypeInt,
+	"optimizer_switch":                VariableTypeString,
+	"sort_buffer_size":                VariableTypeInt,
+	"sql_auto_is_null":                VariableTypeBool,
+	"sql_big_selects":                 VariableTypeBool,
+	"sql_buffer_result":               VariableTypeBool,
+	"sql_notes":                       VariableTypeBool,
+	"sql_quote_show_create":           VariableTypeBool,
+	"sql_warnings":                    VariableTypeBool,
+	"tmp_table_size":                  VariableTypeInt,
+	"updatable_views_with_limit":      VariableTypeBool,
+}
+
+// GetTrackedVariableType return the type of tracked session variable, ok is false if the variable is not tracked
+func GetTrackedVariableType(name string) (typ string, ok bool) {
+	typ, ok = trackedSessionVariables[formatVariableName(name)]
+	return
+}
+
 // SessionVariables variables in session
 type SessionVariables struct {
 	variables map[string]*Variable
 	unused    map[string]*Variable
+
+	// changed records variables changed by SetEqualsWith and their values before change,
+	// the value is nil if the variable is newly added. It's used by backend connections
+	// to replay only the diffs, and to roll back if the replay failed.
+	changed map[string]*Variable
 }
 
 // NewSessionVariables constructor of SessionVariables
@@ -71,6 +127,7 @@ func NewSessionVariables() *SessionVariables {
 	return &SessionVariables{
 		variables: make(map[string]*Variable),
 		unused:    make(map[string]*Variable),
+		changed:   make(map[string]*Variable),
 	}
 }
 
@@ -114,7 +171,7 @@ func (s *SessionVariables) Equals(dst *SessionVariables) bool {
 func (s *SessionVariables) SetEqualsWith(dst *SessionVariables) ( /*changed*/ bool, error) {
 	if len(s.variables) == 0 && len(dst.variables) != 0 {
 		for _, v := range dst.variables {
-			if err := s.Set(v.Name(), v.Get()); err != nil {
+			if err := s.setChanged(v.Name(), v.Get()); err != nil {
 				return false, err
 			}
 		}
@@ -123,8 +180,7 @@ func (s *SessionVariables) SetEqualsWith(dst *SessionVariables) ( /*changed*/ bo
 
 	if len(s.variables) != 0 && len(dst.variables) == 0 {
 		for _, v := range s.variables {
-			s.unused[v.Name()] = v
-			delete(s.variables, v.Name())
+			s.markUnused(v)
 		}
 		return true, nil
 	}
@@ -136,14 +192,14 @@ func (s *SessionVariables) SetEqualsWith(dst *SessionVariables) ( /*changed*/ bo
 		if srcVar, ok := s.variables[name]; ok {
 			// 如果源存在相同名称的变量并且值不同，则更新
 			if srcVar.Get() != dstVar.Get() {
-				if err := srcVar.Set(dstVar.Get()); err != nil {
+				if err := s.setChanged(name, dstVar.Get()); err != nil {
 					return false, err
 				}
 				changed = true
 			}
 		} else {
 			// 如果源不存在这个变量，则添加
-			if err := s.Set(name, dstVar.Get()); err != nil {
+			if err := s.setChanged(name, dstVar.Get()); err != nil {
 				return false, err
 			}
 			changed = true
@@ -153,8 +209,7 @@ func (s *SessionVariables) SetEqualsWith(dst *SessionVariables) ( /*changed*/ bo
 	// 检查源中有而目标中没有的变量，这些变量应被视为不再使用
 	for name, srcVar := range s.variables {
 		if _, ok := dst.variables[name]; !ok {
-			s.unused[name] = srcVar
-			delete(s.variables, name)
+			s.markUnused(srcVar)
 			changed = true
 		}
 	}
@@ -162,6 +217,70 @@ func (s *SessionVariables) SetEqualsWith(dst *SessionVariables) ( /*changed*/ bo
 	return changed, nil
 }
 
+// recordChange save the value before the first change of variable
+func (s *SessionVariables) recordChange(name string) {
+	if _, ok := s.changed[name]; ok {
+		return
+	}
+	if v, ok := s.variables[name]; ok {
+		s.changed[name] = &Variable{name: v.name, value: v.value, verify: v.verify}
+	} else if v, ok := s.unused[name]; ok {
+		s.changed[name] = v
+	} else {
+		s.changed[name] = nil
+	}
+}
+
+func (s *SessionVariables) setChanged(name string, value interface{}) error {
+	name = formatVariableName(name)
+	s.recordChange(name)
+	delete(s.unused, name)
+	return s.Set(name, value)
+}
+
+func (s *SessionVariables) markUnused(v *Variable) {
+	s.recordChange(v.Name())
+	s.unused[v.Name()] = v
+	delete(s.variables, v.Name())
+}
+
+// GetChanged return variables changed by SetEqualsWith since last CommitChanged or RollbackChanged,
+// variables need to be set to default are not included, see GetUnused
+func (s *SessionVariables) GetChanged() []*Variable {
+	ret := make([]*Variable, 0, len(s.changed))
+	for name := range s.changed {
+		if v, ok := s.variables[name]; ok {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// GetUnused return variables need to be set to default
+func (s *SessionVariables) GetUnused() map[string]*Variable {
+	return s.unused
+}
+
+// CommitChanged is called after the changes are applied to backend
+func (s *SessionVariables) CommitChanged() {
+	s.changed = make(map[string]*Variable)
+	s.unused = make(map[string]*Variable)
+}
+
+// RollbackChanged restore variables to the values before SetEqualsWith,
+// it's called when the changes failed to apply to backend.
+func (s *SessionVariables) RollbackChanged() {
+	for name, prev := range s.changed {
+		if prev == nil {
+			delete(s.variables, name)
+		} else {
+			s.variables[name] = prev
+		}
+	}
+	s.changed = make(map[string]*Variable)
+	s.unused = make(map[string]*Variable)
+}
+
 // Delete delete variables with specific key
 func (s *SessionVariables) Delete(key string) {
 	delete(s.variables, formatVariableName(key))
@@ -333,6 +452,41 @@ var SQLModeSet = map[string]bool{
 	"TRADITIONAL": true,
 }
 
+// combinationSQLModes modes expanded to other modes by mysql
+var combinationSQLModes = map[string]bool{
+	"ANSI":        true,
+	"DB2":         true,
+	"MAXDB":       true,
+	"MSSQL":       true,
+	"MYSQL323":    true,
+	"MYSQL40":     true,
+	"ORACLE":      true,
+	"POSTGRESQL":  true,
+	"TRADITIONAL": true,
+}
+
+// IsCombinationSQLMode check if mode is a combination mode like TRADITIONAL, which is shown as the modes it
+// stands for in @@sql_mode
+func IsCombinationSQLMode(mode string) bool {
+	return combinationSQLModes[mode]
+}
+
+// NormalizeSQLMode check modes in comma separated sql_mode, and return them in upper case without spaces
+func NormalizeSQLMode(sqlMode string) (string, error) {
+	var modes []string
+	for _, mode := range strings.Split(sqlMode, ",") {
+		mode = strings.ToUpper(strings.TrimSpace(mode))
+		if mode == "" {
+			continue
+		}
+		if !SQLModeSet[mode] {
+			return "", fmt.Errorf("invalid sql mode: %s", mode)
+		}
+		modes = append(modes, mode)
+	}
+	return strings.Join(modes, ","), nil
+}
+
 func verifyOnOffInteger(v interface{}) error {
 	val, ok := v.(int64)
 	if !ok {
@@ -352,13 +506,21 @@ func verifyInteger(v interface{}) error {
 	return nil
 }
 
+// VerifyTimeZone check time_zone like +08:00, SYSTEM or a named time zone
+func VerifyTimeZone(timeZone string) error {
+	return verifyTimeZone(timeZone)
+}
+
 func verifyTimeZone(v interface{}) error {
 	value, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("invalid type of time_zone")
 	}
+	if isNamedTimeZone(value) {
+		return nil
+	}
 	values := strings.Split(value, ":")
-	if len(values) != 2 {
+	if len(values) != 2 || len(values[0]) == 0 {
 		return fmt.Errorf("invalid format of time_zone")
 	}
 	if values[0][0] != '+' && values[0][0] != '-' {
@@ -385,6 +547,20 @@ func verifyTimeZone(v interface{}) error {
 	return nil
 }
 
+// isNamedTimeZone check if time_zone is SYSTEM or a name like UTC and Asia/Shanghai, which must be loaded
+// into time zone tables of mysql
+func isNamedTimeZone(value string) bool {
+	if value == "" || value[0] == '+' || value[0] == '-' {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("/_-+", c)) {
+			return false
+		}
+	}
+	return true
+}
+
 func verifyString(v interface{}) error {
 	_, ok := v.(string)
 	if !ok {
@@ -277,3 +277,63 @@ func TestSetEqualsWith(t *testing.T) {
 		}
 	})
 }
+
+func TestSessionVariablesChangedAndRollback(t *testing.T) {
+	backend := NewSessionVariables()
+	frontend := NewSessionVariables()
+	assert.Nil(t, frontend.Set(SQLModeStr, "STRICT_TRANS_TABLES"))
+	assert.Nil(t, frontend.Set(TimeZone, "+08:00"))
+
+	changed, err := backend.SetEqualsWith(frontend)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Len(t, backend.GetChanged(), 2)
+	backend.CommitChanged()
+	assert.Len(t, backend.GetChanged(), 0)
+
+	// only the diff should be replayed
+	assert.Nil(t, frontend.Set(GroupConcatMaxLen, int64(4096)))
+	frontend.Delete(TimeZone)
+	changed, err = backend.SetEqualsWith(frontend)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changedVars := backend.GetChanged()
+	assert.Len(t, changedVars, 1)
+	assert.Equal(t, GroupConcatMaxLen, changedVars[0].Name())
+	assert.Contains(t, backend.GetUnused(), TimeZone)
+
+	// rollback restores the state before SetEqualsWith
+	backend.RollbackChanged()
+	assert.Len(t, backend.GetChanged(), 0)
+	assert.Len(t, backend.GetUnused(), 0)
+	assert.Len(t, backend.GetAll(), 2)
+	v, ok := backend.Get(TimeZone)
+	assert.True(t, ok)
+	assert.Equal(t, "+08:00", v.(*Variable).Get())
+	_, ok = backend.Get(GroupConcatMaxLen)
+	assert.False(t, ok)
+
+	// value changed then rolled back
+	assert.Nil(t, frontend.Set(TimeZone, "+00:00"))
+	_, err = backend.SetEqualsWith(frontend)
+	assert.Nil(t, err)
+	backend.RollbackChanged()
+	v, _ = backend.Get(TimeZone)
+	assert.Equal(t, "+08:00", v.(*Variable).Get())
+}
+
+func TestTrackedSessionVariables(t *testing.T) {
+	typ, ok := GetTrackedVariableType("FOREIGN_KEY_CHECKS")
+	assert.True(t, ok)
+	assert.Equal(t, VariableTypeBool, typ)
+
+	_, ok = GetTrackedVariableType("not_exist_variable")
+	assert.False(t, ok)
+
+	// tracked variables are not verified globally, values are checked by their types when set,
+	// and they are removed by Reset like other variables without verify function
+	s := NewSessionVariables()
+	assert.Nil(t, s.Set("max_heap_table_size", "16384"))
+	s.Reset(nil)
+	assert.Len(t, s.GetAll(), 0)
+}
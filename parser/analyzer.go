@@ -108,7 +108,7 @@ func Preview(sql string) int {
 	// as StmtBegin.
 	trimmedNoComments, _ := SplitMarginComments(trimmed)
 	switch strings.ToLower(trimmedNoComments) {
-	case "begin", "start transaction":
+	case "begin", "start transaction", "start transaction read only", "start transaction read write":
 		return StmtBegin
 	case "commit":
 		return StmtCommit
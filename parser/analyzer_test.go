@@ -294,6 +294,9 @@ func TestPreview(t *testing.T) {
 		{"begin ;", StmtBegin},
 		{"begin; /*...*/", StmtBegin},
 		{"start transaction", StmtBegin},
+		{"start transaction read only", StmtBegin},
+		{"START TRANSACTION READ WRITE /*...*/", StmtBegin},
+		{"start transaction read only ...", StmtUnknown},
 		{"commit", StmtCommit},
 		{"commit /*...*/", StmtCommit},
 		{"rollback", StmtRollback},
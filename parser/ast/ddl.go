@@ -672,6 +672,7 @@ func (n *ColumnDef) Accept(v Visitor) (Node, bool) {
 type CreateTableStmt struct {
 	ddlNode
 
+	IsTemporary bool
 	IfNotExists bool
 	Table       *TableName
 	ReferTable  *TableName
@@ -685,7 +686,11 @@ type CreateTableStmt struct {
 
 // Restore implements Node interface.
 func (n *CreateTableStmt) Restore(ctx *format.RestoreCtx) error {
-	ctx.WriteKeyWord("CREATE TABLE ")
+	if n.IsTemporary {
+		ctx.WriteKeyWord("CREATE TEMPORARY TABLE ")
+	} else {
+		ctx.WriteKeyWord("CREATE TABLE ")
+	}
 	if n.IfNotExists {
 		ctx.WriteKeyWord("IF NOT EXISTS ")
 	}
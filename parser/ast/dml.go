@@ -785,6 +785,94 @@ func (n *OrderByClause) Accept(v Visitor) (Node, bool) {
 	return v.Leave(n)
 }
 
+// CommonTableExpression represents a common table expression in WITH clause.
+// See https://dev.mysql.com/doc/refman/8.0/en/with.html
+type CommonTableExpression struct {
+	node
+
+	Name        model.CIStr
+	ColNameList []model.CIStr
+	Query       *SubqueryExpr
+}
+
+// Restore implements Node interface.
+func (n *CommonTableExpression) Restore(ctx *format.RestoreCtx) error {
+	ctx.WriteName(n.Name.O)
+	if len(n.ColNameList) > 0 {
+		ctx.WritePlain(" (")
+		for i, name := range n.ColNameList {
+			if i != 0 {
+				ctx.WritePlain(",")
+			}
+			ctx.WriteName(name.O)
+		}
+		ctx.WritePlain(")")
+	}
+	ctx.WriteKeyWord(" AS ")
+	if err := n.Query.Restore(ctx); err != nil {
+		return errors.Annotate(err, "An error occurred while restore CommonTableExpression.Query")
+	}
+	return nil
+}
+
+// Accept implements Node Accept interface.
+func (n *CommonTableExpression) Accept(v Visitor) (Node, bool) {
+	newNode, skipChildren := v.Enter(n)
+	if skipChildren {
+		return v.Leave(newNode)
+	}
+	n = newNode.(*CommonTableExpression)
+	node, ok := n.Query.Accept(v)
+	if !ok {
+		return n, false
+	}
+	n.Query = node.(*SubqueryExpr)
+	return v.Leave(n)
+}
+
+// WithClause represents the WITH clause of common table expressions.
+type WithClause struct {
+	node
+
+	IsRecursive bool
+	CTEs        []*CommonTableExpression
+}
+
+// Restore implements Node interface.
+func (n *WithClause) Restore(ctx *format.RestoreCtx) error {
+	ctx.WriteKeyWord("WITH ")
+	if n.IsRecursive {
+		ctx.WriteKeyWord("RECURSIVE ")
+	}
+	for i, cte := range n.CTEs {
+		if i != 0 {
+			ctx.WritePlain(",")
+		}
+		if err := cte.Restore(ctx); err != nil {
+			return errors.Annotatef(err, "An error occurred while restore WithClause.CTEs[%d]", i)
+		}
+	}
+	ctx.WritePlain(" ")
+	return nil
+}
+
+// Accept implements Node Accept interface.
+func (n *WithClause) Accept(v Visitor) (Node, bool) {
+	newNode, skipChildren := v.Enter(n)
+	if skipChildren {
+		return v.Leave(newNode)
+	}
+	n = newNode.(*WithClause)
+	for i, cte := range n.CTEs {
+		node, ok := cte.Accept(v)
+		if !ok {
+			return n, false
+		}
+		n.CTEs[i] = node.(*CommonTableExpression)
+	}
+	return v.Leave(n)
+}
+
 // SelectStmt represents the select query node.
 // See https://dev.mysql.com/doc/refman/5.7/en/select.html
 type SelectStmt struct {
@@ -819,10 +907,17 @@ type SelectStmt struct {
 	IsAfterUnionDistinct bool
 	// IsInBraces indicates whether it's a stmt in brace.
 	IsInBraces bool
+	// With is the WITH clause of common table expressions.
+	With *WithClause
 }
 
 // Restore implements Node interface.
 func (n *SelectStmt) Restore(ctx *format.RestoreCtx) error {
+	if n.With != nil {
+		if err := n.With.Restore(ctx); err != nil {
+			return errors.Annotate(err, "An error occurred while restore SelectStmt.With")
+		}
+	}
 	ctx.WriteKeyWord("SELECT ")
 
 	if n.SelectStmtOpts.Priority > 0 {
@@ -938,6 +1033,14 @@ func (n *SelectStmt) Accept(v Visitor) (Node, bool) {
 	}
 
 	n = newNode.(*SelectStmt)
+	if n.With != nil {
+		node, ok := n.With.Accept(v)
+		if !ok {
+			return n, false
+		}
+		n.With = node.(*WithClause)
+	}
+
 	if n.TableHints != nil && len(n.TableHints) != 0 {
 		newHints := make([]*TableOptimizerHint, len(n.TableHints))
 		for i, hint := range n.TableHints {
@@ -1072,10 +1175,16 @@ type UnionStmt struct {
 	SelectList *UnionSelectList
 	OrderBy    *OrderByClause
 	Limit      *Limit
+	With       *WithClause
 }
 
 // Restore implements Node interface.
 func (n *UnionStmt) Restore(ctx *format.RestoreCtx) error {
+	if n.With != nil {
+		if err := n.With.Restore(ctx); err != nil {
+			return errors.Annotate(err, "An error occurred while restore UnionStmt.With")
+		}
+	}
 	if err := n.SelectList.Restore(ctx); err != nil {
 		errors.Annotate(err, "An error occurred while restore UnionStmt.SelectList")
 	}
@@ -1103,6 +1212,13 @@ func (n *UnionStmt) Accept(v Visitor) (Node, bool) {
 		return v.Leave(newNode)
 	}
 	n = newNode.(*UnionStmt)
+	if n.With != nil {
+		node, ok := n.With.Accept(v)
+		if !ok {
+			return n, false
+		}
+		n.With = node.(*WithClause)
+	}
 	if n.SelectList != nil {
 		node, ok := n.SelectList.Accept(v)
 		if !ok {
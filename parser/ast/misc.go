@@ -329,11 +329,16 @@ func (n *ExecuteStmt) Accept(v Visitor) (Node, bool) {
 // See https://dev.mysql.com/doc/refman/5.7/en/commit.html
 type BeginStmt struct {
 	stmtNode
+
+	ReadOnly bool
 }
 
 // Restore implements Node interface.
 func (n *BeginStmt) Restore(ctx *format.RestoreCtx) error {
 	ctx.WriteKeyWord("START TRANSACTION")
+	if n.ReadOnly {
+		ctx.WriteKeyWord(" READ ONLY")
+	}
 	return nil
 }
 
@@ -0,0 +1,67 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ParameterizeSQL replace literals in sql with ?, statements differing only in literals get the same
+// parameterized sql. Unlike fingerprint, identifiers and lists are kept as they are, so it keeps
+// everything which routing depends on except literals. ok is false if sql can't be scanned.
+func ParameterizeSQL(sql string) (string, bool) {
+	s := NewScanner(sql)
+	var b strings.Builder
+	b.Grow(len(sql))
+	for {
+		tok, _, lit := s.scan()
+		switch tok {
+		case 0:
+			return b.String(), true
+		case invalid, unicode.ReplacementChar:
+			return "", false
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		switch tok {
+		case intLit, floatLit, decLit, hexLit, bitLit, stringLit:
+			b.WriteByte('?')
+		case quotedIdentifier:
+			b.WriteString("`" + strings.Replace(lit, "`", "``", -1) + "`")
+		default:
+			b.WriteString(lit)
+		}
+	}
+}
+
+// ExtractLiterals return source text of literals in sql in order, they are what ParameterizeSQL
+// replaces with ?. ok is false if sql can't be scanned.
+func ExtractLiterals(sql string) ([]string, bool) {
+	s := NewScanner(sql)
+	var literals []string
+	for {
+		tok, pos, _ := s.scan()
+		switch tok {
+		case 0:
+			return literals, true
+		case invalid, unicode.ReplacementChar:
+			return nil, false
+		case intLit, floatLit, decLit, hexLit, bitLit, stringLit:
+			literals = append(literals, sql[pos.Offset:s.r.pos().Offset])
+		}
+	}
+}
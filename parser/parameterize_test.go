@@ -0,0 +1,68 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterizeSQL(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{"select * from t where id = 1", "select * from t where id = ?"},
+		{"SELECT a FROM db.t WHERE name='x' AND b>1.5 LIMIT 10", "SELECT a FROM db . t WHERE name = ? AND b > ? LIMIT ?"},
+		{"select * from `t 1` where c in (1, 0x1f, b'01')", "select * from `t 1` where c in ( ? , ? , ? )"},
+		{"insert into t(a,b) values (1,'a'),(2,\"b\")", "insert into t ( a , b ) values ( ? , ? ) , ( ? , ? )"},
+		{"select * from tbl_0001 where a=1 /* comment */", "select * from tbl_0001 where a = ?"},
+		{"select * from t where a in (select b from t2)", "select * from t where a in ( select b from t2 )"},
+	}
+	for _, tt := range tests {
+		actual, ok := ParameterizeSQL(tt.sql)
+		require.True(t, ok, tt.sql)
+		require.Equal(t, tt.expect, actual, tt.sql)
+	}
+
+	a, _ := ParameterizeSQL("update t set a = 'x' where id = 1")
+	b, _ := ParameterizeSQL("update  t set a='y' where id=2")
+	require.Equal(t, a, b)
+
+	_, ok := ParameterizeSQL("select 'abc")
+	require.False(t, ok)
+}
+
+func TestExtractLiterals(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect []string
+	}{
+		{"select * from t where id = 1", []string{"1"}},
+		{"SELECT a FROM t WHERE name='x''y' AND b>1.5 LIMIT 10", []string{"'x''y'", "1.5", "10"}},
+		{"select * from t where c in (1, 0x1f, b'01', \"s\")", []string{"1", "0x1f", "b'01'", "\"s\""}},
+		{"select * from t /* 1 */ where a = -2", []string{"2"}},
+		{"select a from t", nil},
+	}
+	for _, tt := range tests {
+		actual, ok := ExtractLiterals(tt.sql)
+		require.True(t, ok, tt.sql)
+		require.Equal(t, tt.expect, actual, tt.sql)
+	}
+
+	_, ok := ExtractLiterals("select 'abc")
+	require.False(t, ok)
+}
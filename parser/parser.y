@@ -204,6 +204,7 @@ import (
 	rank			"RANK"
 	read			"READ"
 	realType		"REAL"
+	recursive		"RECURSIVE"
 	references		"REFERENCES"
 	regexpKwd		"REGEXP"
 	rename         		"RENAME"
@@ -615,6 +616,7 @@ import (
 	LockTablesStmt			"Lock tables statement"
 	PreparedStmt			"PreparedStmt"
 	SelectStmt			"SELECT statement"
+	SelectStmtWithClause		"SELECT statement with WITH clause"
 	RenameTableStmt         	"rename table statement"
 	ReplaceIntoStmt			"REPLACE INTO statement"
 	RevokeStmt			"Revoke statement"
@@ -794,6 +796,8 @@ import (
 	ShowTableAliasOpt       	"Show table alias option"
 	ShowLikeOrWhereOpt		"Show like or where clause option"
 	Starting			"Starting by"
+	StartTransactionOption		"start transaction characteristic"
+	StartTransactionOptionList	"start transaction characteristic list"
 	StatementList			"statement list"
 	StatsPersistentVal		"stats_persistent value"
 	StringName			"string literal or identifier"
@@ -819,6 +823,7 @@ import (
 	TableToTable 			"rename table to table"
 	TableToTableList 		"rename table to table by list"
 	LockType			"Table locks type"
+	TemporaryOpt			"temporary or empty"
 
 	TransactionChar		"Transaction characteristic"
 	TransactionChars	"Transaction characteristic list"
@@ -863,6 +868,9 @@ import (
 	OptWindowingClause	"Optional OVER clause"
 	WindowingClause		"OVER clause"
 	WindowClauseOptional	"Optional WINDOW clause"
+	WithClause		"WITH clause"
+	WithList		"common table expression list"
+	CommonTableExpr		"common table expression"
 	WindowDefinitionList	"WINDOW definition list"
 	WindowDefinition	"WINDOW definition"
 	WindowFrameUnits	"WINDOW frame units"
@@ -1455,9 +1463,47 @@ BeginTransactionStmt:
 	{
 		$$ = &ast.BeginStmt{}
 	}
-|	"START" "TRANSACTION" "WITH" "CONSISTENT" "SNAPSHOT"
+|	"START" "TRANSACTION" StartTransactionOptionList
 	{
-		$$ = &ast.BeginStmt{}
+		stmt := &ast.BeginStmt{}
+		readWrite := false
+		for _, opt := range $3.([]string) {
+			switch opt {
+			case "READ ONLY":
+				stmt.ReadOnly = true
+			case "READ WRITE":
+				readWrite = true
+			}
+		}
+		if stmt.ReadOnly && readWrite {
+			yylex.Errorf("READ ONLY and READ WRITE can not be used together")
+			return 1
+		}
+		$$ = stmt
+	}
+
+StartTransactionOptionList:
+	StartTransactionOption
+	{
+		$$ = []string{$1.(string)}
+	}
+|	StartTransactionOptionList ',' StartTransactionOption
+	{
+		$$ = append($1.([]string), $3.(string))
+	}
+
+StartTransactionOption:
+	"WITH" "CONSISTENT" "SNAPSHOT"
+	{
+		$$ = "WITH CONSISTENT SNAPSHOT"
+	}
+|	"READ" "ONLY"
+	{
+		$$ = "READ ONLY"
+	}
+|	"READ" "WRITE"
+	{
+		$$ = "READ WRITE"
 	}
 
 BinlogStmt:
@@ -1999,28 +2045,39 @@ DatabaseOptionList:
  *******************************************************************/
 
 CreateTableStmt:
-	"CREATE" "TABLE" IfNotExists TableName TableElementListOpt CreateTableOptionListOpt PartitionOpt DuplicateOpt AsOpt CreateTableSelectOpt
+	"CREATE" TemporaryOpt "TABLE" IfNotExists TableName TableElementListOpt CreateTableOptionListOpt PartitionOpt DuplicateOpt AsOpt CreateTableSelectOpt
 	{
-		stmt := $5.(*ast.CreateTableStmt)
-		stmt.Table = $4.(*ast.TableName)
-		stmt.IfNotExists = $3.(bool)
-		stmt.Options = $6.([]*ast.TableOption)
-		if $7 != nil {
-			stmt.Partition = $7.(*ast.PartitionOptions)
+		stmt := $6.(*ast.CreateTableStmt)
+		stmt.Table = $5.(*ast.TableName)
+		stmt.IsTemporary = $2.(bool)
+		stmt.IfNotExists = $4.(bool)
+		stmt.Options = $7.([]*ast.TableOption)
+		if $8 != nil {
+			stmt.Partition = $8.(*ast.PartitionOptions)
 		}
-		stmt.OnDuplicate = $8.(ast.OnDuplicateCreateTableSelectType)
-		stmt.Select = $10.(*ast.CreateTableStmt).Select
+		stmt.OnDuplicate = $9.(ast.OnDuplicateCreateTableSelectType)
+		stmt.Select = $11.(*ast.CreateTableStmt).Select
 		$$ = stmt
 	}
-|	"CREATE" "TABLE" IfNotExists TableName LikeTableWithOrWithoutParen
+|	"CREATE" TemporaryOpt "TABLE" IfNotExists TableName LikeTableWithOrWithoutParen
 	{
 		$$ = &ast.CreateTableStmt{
-			Table:          $4.(*ast.TableName),
-			ReferTable:	$5.(*ast.TableName),
-			IfNotExists:    $3.(bool),
+			Table:          $5.(*ast.TableName),
+			ReferTable:	$6.(*ast.TableName),
+			IsTemporary:    $2.(bool),
+			IfNotExists:    $4.(bool),
 		}
 	}
 
+TemporaryOpt:
+	{
+		$$ = false
+	}
+|	"TEMPORARY"
+	{
+		$$ = true
+	}
+
 DefaultKwdOpt:
 	{}
 |	"DEFAULT"
@@ -4736,6 +4793,55 @@ SelectStmt:
 		$$ = st
 	}
 
+// See https://dev.mysql.com/doc/refman/8.0/en/with.html
+SelectStmtWithClause:
+	WithClause SelectStmt
+	{
+		st := $2.(*ast.SelectStmt)
+		st.With = $1.(*ast.WithClause)
+		$$ = st
+	}
+|	WithClause UnionStmt
+	{
+		st := $2.(*ast.UnionStmt)
+		st.With = $1.(*ast.WithClause)
+		$$ = st
+	}
+
+WithClause:
+	"WITH" WithList
+	{
+		$$ = $2
+	}
+|	"WITH" "RECURSIVE" WithList
+	{
+		ws := $3.(*ast.WithClause)
+		ws.IsRecursive = true
+		$$ = ws
+	}
+
+WithList:
+	WithList ',' CommonTableExpr
+	{
+		ws := $1.(*ast.WithClause)
+		ws.CTEs = append(ws.CTEs, $3.(*ast.CommonTableExpression))
+		$$ = ws
+	}
+|	CommonTableExpr
+	{
+		$$ = &ast.WithClause{CTEs: []*ast.CommonTableExpression{$1.(*ast.CommonTableExpression)}}
+	}
+
+CommonTableExpr:
+	Identifier ViewFieldList "AS" SubSelect
+	{
+		cte := &ast.CommonTableExpression{Name: model.NewCIStr($1), Query: $4.(*ast.SubqueryExpr)}
+		if $2 != nil {
+			cte.ColNameList = $2.([]model.CIStr)
+		}
+		$$ = cte
+	}
+
 FromDual:
 	"FROM" "DUAL"
 
@@ -5681,6 +5787,9 @@ SetStmt:
 			if assigns[i].Name == "tx_isolation" {
 				// A special session variable that make setting tx_isolation take effect one time.
 				assigns[i].Name = "tx_isolation_one_shot"
+			} else if assigns[i].Name == "tx_read_only" {
+				// same as tx_isolation_one_shot, access mode only takes effect in next transaction
+				assigns[i].Name = "tx_read_only_one_shot"
 			}
 		}
 		$$ = &ast.SetStmt{Variables: assigns}
@@ -6641,6 +6750,7 @@ Statement:
 |	RevokeRoleStmt
 |	SavepointStmt
 |	SelectStmt
+|	SelectStmtWithClause
 |	UnionStmt
 |	SetStmt
 |	SetRoleStmt
@@ -6669,6 +6779,7 @@ TraceableStmt:
 
 ExplainableStmt:
 	SelectStmt
+|	SelectStmtWithClause
 |	DeleteFromStmt
 |	UpdateStmt
 |	InsertIntoStmt
@@ -64,7 +64,7 @@ func TestSimple(t *testing.T) {
 		"generated", "virtual", "stored", "usage",
 		"delayed", "high_priority", "low_priority",
 		"cumeDist", "denseRank", "firstValue", "lag", "lastValue", "lead", "nthValue", "ntile",
-		"over", "percentRank", "rank", "row", "rows", "rowNumber", "window",
+		"over", "percentRank", "rank", "row", "rows", "rowNumber", "window", "recursive",
 		// TODO: support the following keywords
 		// "with",
 	}
@@ -366,6 +366,15 @@ func TestDMLStmt(t *testing.T) {
 			FROM stuff)`, true, "SELECT `stuff`.`id` FROM `stuff` WHERE `stuff`.`value`>=ALL (SELECT `stuff`.`value` FROM `stuff`)"},
 		{"BEGIN", true, "START TRANSACTION"},
 		{"START TRANSACTION", true, "START TRANSACTION"},
+		{"START TRANSACTION READ ONLY", true, "START TRANSACTION READ ONLY"},
+		{"START TRANSACTION READ WRITE", true, "START TRANSACTION"},
+		{"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY", true, "START TRANSACTION READ ONLY"},
+		{"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ WRITE", true, "START TRANSACTION"},
+		{"START TRANSACTION WITH CONSISTENT SNAPSHOT", true, "START TRANSACTION"},
+		{"START TRANSACTION READ ONLY, WITH CONSISTENT SNAPSHOT", true, "START TRANSACTION READ ONLY"},
+		{"START TRANSACTION READ WRITE, WITH CONSISTENT SNAPSHOT", true, "START TRANSACTION"},
+		{"START TRANSACTION READ ONLY, READ WRITE", false, ""},
+		{"START TRANSACTION READ ONLY,", false, ""},
 		// 45
 		{"COMMIT", true, "COMMIT"},
 		{"ROLLBACK", true, "ROLLBACK"},
@@ -747,8 +756,8 @@ func TestDBAStmt(t *testing.T) {
 		{"SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED", true, "SET @@SESSION.`tx_isolation`='READ-UNCOMMITTED'"},
 		{"SET SESSION TRANSACTION ISOLATION LEVEL SERIALIZABLE", true, "SET @@SESSION.`tx_isolation`='SERIALIZABLE'"},
 		{"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ", true, "SET @@SESSION.`tx_isolation_one_shot`='REPEATABLE-READ'"},
-		{"SET TRANSACTION READ WRITE", true, "SET @@SESSION.`tx_read_only`='0'"},
-		{"SET TRANSACTION READ ONLY", true, "SET @@SESSION.`tx_read_only`='1'"},
+		{"SET TRANSACTION READ WRITE", true, "SET @@SESSION.`tx_read_only_one_shot`='0'"},
+		{"SET TRANSACTION READ ONLY", true, "SET @@SESSION.`tx_read_only_one_shot`='1'"},
 		{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED", true, "SET @@SESSION.`tx_isolation_one_shot`='READ-COMMITTED'"},
 		{"SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED", true, "SET @@SESSION.`tx_isolation_one_shot`='READ-UNCOMMITTED'"},
 		{"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", true, "SET @@SESSION.`tx_isolation_one_shot`='SERIALIZABLE'"},
@@ -1777,6 +1786,8 @@ func TestDDL(t *testing.T) {
 		{"create table a like b", true, "CREATE TABLE `a` LIKE `b`"},
 		{"create table a (like b)", true, "CREATE TABLE `a` LIKE `b`"},
 		{"create table if not exists a like b", true, "CREATE TABLE IF NOT EXISTS `a` LIKE `b`"},
+		{"create temporary table a (id int)", true, "CREATE TEMPORARY TABLE `a` (`id` INT)"},
+		{"create temporary table if not exists a like b", true, "CREATE TEMPORARY TABLE IF NOT EXISTS `a` LIKE `b`"},
 		{"create table if not exists a (like b)", true, "CREATE TABLE IF NOT EXISTS `a` LIKE `b`"},
 		{"create table if not exists a like (b)", false, ""},
 		{"create table a (t int) like b", false, ""},
@@ -2279,6 +2290,20 @@ func TestUnion(t *testing.T) {
 	RunTest(t, table, false)
 }
 
+func TestCommonTableExpression(t *testing.T) {
+	table := []testCase{
+		{"with cte as (select * from t) select * from cte", true, "WITH `cte` AS (SELECT * FROM `t`) SELECT * FROM `cte`"},
+		{"with cte (a, b) as (select c1, c2 from t) select a from cte where b = 1", true, "WITH `cte` (`a`,`b`) AS (SELECT `c1`,`c2` FROM `t`) SELECT `a` FROM `cte` WHERE `b`=1"},
+		{"with c1 as (select 1), c2 as (select * from c1) select * from c2", true, "WITH `c1` AS (SELECT 1),`c2` AS (SELECT * FROM `c1`) SELECT * FROM `c2`"},
+		{"with recursive cte (n) as (select 1 union all select n + 1 from cte where n < 5) select * from cte", true, "WITH RECURSIVE `cte` (`n`) AS (SELECT 1 UNION ALL SELECT `n`+1 FROM `cte` WHERE `n`<5) SELECT * FROM `cte`"},
+		{"with cte as (select id from db.t) select id from cte union select id from t2 order by id limit 1", true, "WITH `cte` AS (SELECT `id` FROM `db`.`t`) SELECT `id` FROM `cte` UNION SELECT `id` FROM `t2` ORDER BY `id` LIMIT 1"},
+		{"explain with cte as (select 1) select * from cte", true, "EXPLAIN FORMAT = 'row' WITH `cte` AS (SELECT 1) SELECT * FROM `cte`"},
+		{"with cte as select 1 select * from cte", false, ""},
+		{"with cte as (select 1)", false, ""},
+	}
+	RunTest(t, table, false)
+}
+
 func checkOrderBy(t *testing.T, s ast.Node, hasOrderBy []bool, i int) int {
 	switch x := s.(type) {
 	case *ast.SelectStmt:
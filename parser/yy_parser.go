@@ -19,6 +19,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/pingcap/errors"
@@ -270,8 +271,71 @@ func getUint64FromNUM(num interface{}) uint64 {
 
 // ParseSQL only for test, use ClientConn.parser for handling request
 func ParseSQL(sql string) (ast.StmtNode, error) {
-	ps := New()
-	return ps.ParseOneStmt(sql, "", "")
+	return ParseOneStmt(sql)
+}
+
+// maxPooledParserStack parsers whose yacc stack grows larger than it by deeply nested sql are not pooled
+const maxPooledParserStack = 1024
+
+// parserPools reuse parsers and their yacc stacks, index 1 is parsers with window function enabled
+var parserPools = [2]sync.Pool{
+	{New: func() interface{} { return New() }},
+	{New: func() interface{} {
+		p := New()
+		p.EnableWindowFunc(true)
+		return p
+	}},
+}
+
+func getPooledParser(windowFunc bool) *Parser {
+	if windowFunc {
+		return parserPools[1].Get().(*Parser)
+	}
+	return parserPools[0].Get().(*Parser)
+}
+
+// putPooledParser return parser to pool, references to sql and ast nodes are dropped so that they can be collected
+func putPooledParser(p *Parser, windowFunc bool) {
+	if len(p.cache) > maxPooledParserStack {
+		return
+	}
+	for i := range p.result {
+		p.result[i] = nil
+	}
+	p.result = p.result[:0]
+	p.src = ""
+	p.lexer.reset("")
+	for i := range p.cache {
+		p.cache[i] = yySymType{}
+	}
+	p.yylval = yySymType{}
+	p.yyVAL = yySymType{}
+	if windowFunc {
+		parserPools[1].Put(p)
+	} else {
+		parserPools[0].Put(p)
+	}
+}
+
+// parseOneStmtWithPooledParser parse sql by parser from pool, the parser is returned to pool after parsing
+func parseOneStmtWithPooledParser(sql string, windowFunc bool) (ast.StmtNode, error) {
+	p := getPooledParser(windowFunc)
+	stmt, err := p.ParseOneStmt(sql, "", "")
+	putPooledParser(p, windowFunc)
+	return stmt, err
+}
+
+// ParseOneStmt parses sql without window function first, so that keywords of window function
+// can still be used as identifiers like MySQL 5.7, and parses again with window function if failed.
+func ParseOneStmt(sql string) (ast.StmtNode, error) {
+	stmt, err := parseOneStmtWithPooledParser(sql, false)
+	if err == nil {
+		return stmt, nil
+	}
+	if stmt, werr := parseOneStmtWithPooledParser(sql, true); werr == nil {
+		return stmt, nil
+	}
+	return nil, err
 }
 
 const resultTableNameFlag pformat.RestoreFlags = 0
@@ -43,3 +43,39 @@ func TestASTNode(t *testing.T) {
 	v := &NodePrintVisitor{}
 	n.Accept(v)
 }
+
+func TestParseOneStmtWithPooledParser(t *testing.T) {
+	// window function fallback and reused parsers should not affect results
+	sqls := []string{
+		"select id, name from t where id = 1",
+		"select rank() over (order by id) from t",
+		"select id from t where name = 'a'",
+		"select id, name from t where id = 1",
+	}
+	for i := 0; i < 3; i++ {
+		for _, sql := range sqls {
+			stmt, err := ParseOneStmt(sql)
+			if err != nil {
+				t.Fatalf("parse sql error: %s, %v", sql, err)
+			}
+			if stmt.Text() != sql {
+				t.Errorf("text of stmt not equal, expect: %s, actual: %s", sql, stmt.Text())
+			}
+		}
+	}
+	if _, err := ParseOneStmt("select from"); err == nil {
+		t.Errorf("expect error of invalid sql")
+	}
+	if _, err := ParseOneStmt("select 1"); err != nil {
+		t.Errorf("parse sql after error: %v", err)
+	}
+}
+
+func BenchmarkParseOneStmt(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseOneStmt("select id, name from t where id = 1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
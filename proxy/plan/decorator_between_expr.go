@@ -27,8 +27,8 @@ import (
 // BetweenExprDecorator decorate BetweenExpr
 // Between只需要改写表名并计算路由, 不需要改写边界值.
 type BetweenExprDecorator struct {
-	*ast.BetweenExpr // origin
-	column           *ColumnNameExprDecorator
+	*ast.BetweenExpr              // origin
+	expr             ast.ExprNode // column decorator, or date function with column decorator
 
 	tableIndexes []int
 
@@ -38,9 +38,9 @@ type BetweenExprDecorator struct {
 
 // NeedCreateBetweenExprDecorator check if BetweenExpr needs decoration
 func NeedCreateBetweenExprDecorator(p *TableAliasStmtInfo, n *ast.BetweenExpr) (router.Rule, bool, bool, error) {
-	// 如果不是ColumnNameExpr, 则不做任何路由计算和装饰, 直接返回
-	columnNameExpr, ok := n.Expr.(*ast.ColumnNameExpr)
-	if !ok {
+	// 如果不是ColumnNameExpr或时间函数中的列, 则不做任何路由计算和装饰, 直接返回
+	columnNameExpr := getBetweenExprColumn(n)
+	if columnNameExpr == nil {
 		return nil, false, false, nil
 	}
 
@@ -54,17 +54,21 @@ func NeedCreateBetweenExprDecorator(p *TableAliasStmtInfo, n *ast.BetweenExpr) (
 
 // CreateBetweenExprDecorator create BetweenExprDecorator
 func CreateBetweenExprDecorator(n *ast.BetweenExpr, rule router.Rule, isAlias bool, result *RouteResult) (*BetweenExprDecorator, error) {
-	columnNameExpr := n.Expr.(*ast.ColumnNameExpr)
-	columnNameExprDecorator := CreateColumnNameExprDecorator(columnNameExpr, rule, isAlias, result)
-
 	tableIndexes, err := getBetweenExprRouteResult(rule, n)
 	if err != nil {
 		return nil, fmt.Errorf("getBetweenExprRouteResult error: %v", err)
 	}
 
+	columnNameExpr := getBetweenExprColumn(n)
+	var expr ast.ExprNode = CreateColumnNameExprDecorator(columnNameExpr, rule, isAlias, result)
+	if f, ok := n.Expr.(*ast.FuncCallExpr); ok {
+		f.Args[0] = expr
+		expr = f
+	}
+
 	ret := &BetweenExprDecorator{
 		BetweenExpr:  n,
-		column:       columnNameExprDecorator,
+		expr:         expr,
 		tableIndexes: tableIndexes,
 		rule:         rule,
 		result:       result,
@@ -79,7 +83,7 @@ func (b *BetweenExprDecorator) Accept(v ast.Visitor) (ast.Node, bool) {
 
 // Restore column name restore is different from BetweenExpr
 func (b *BetweenExprDecorator) Restore(ctx *format.RestoreCtx) error {
-	if err := b.column.Restore(ctx); err != nil {
+	if err := b.expr.Restore(ctx); err != nil {
 		return fmt.Errorf("an error occurred while restore BetweenExpr.Expr: %v", err)
 	}
 	if b.Not {
@@ -109,7 +113,7 @@ func getBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int, err
 		return indexes, nil
 	}
 
-	columnNameExpr := n.Expr.(*ast.ColumnNameExpr)
+	columnNameExpr := getBetweenExprColumn(n)
 	_, _, column := getColumnInfoFromColumnName(columnNameExpr.Name)
 
 	if rule.GetShardingColumn() != column {
@@ -117,6 +121,12 @@ func getBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int, err
 		return indexes, nil
 	}
 
+	// 时间函数只在日期分表中计算路由
+	if _, ok := n.Expr.(*ast.FuncCallExpr); ok && !router.IsDateShardingRule(rule.GetType()) {
+		indexes := rule.GetSubTableIndexes()
+		return indexes, nil
+	}
+
 	if _, ok := rule.GetShard().(router.RangeShard); ok {
 		return getShardBetweenExprRouteResult(rule, n)
 	}
@@ -125,6 +135,18 @@ func getBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int, err
 	return indexes, nil
 }
 
+// getBetweenExprColumn return the column of BetweenExpr, such as create_time or DATE(create_time)
+func getBetweenExprColumn(n *ast.BetweenExpr) *ast.ColumnNameExpr {
+	switch expr := n.Expr.(type) {
+	case *ast.ColumnNameExpr:
+		return expr
+	case *ast.FuncCallExpr:
+		return getDateFuncColumn(expr)
+	default:
+		return nil
+	}
+}
+
 // copy from origin PlanBuilder.getRangeShardTableIndex
 func getShardBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int, error) {
 	rangeShard := rule.GetShard().(router.RangeShard)
@@ -147,6 +169,11 @@ func getShardBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int
 		return nil, fmt.Errorf("get value from n.Right error: %v", err)
 	}
 
+	if f, ok := n.Expr.(*ast.FuncCallExpr); ok && (!isDateFuncValueMatch(f, leftValue) || !isDateFuncValueMatch(f, rightValue)) {
+		indexes := rule.GetSubTableIndexes()
+		return indexes, nil
+	}
+
 	start, err := rule.FindTableIndex(leftValue)
 	if err != nil {
 		return nil, fmt.Errorf("FindTableIndex for n.Left error: %v", err)
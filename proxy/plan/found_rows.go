@@ -0,0 +1,87 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/model"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// SQL_CALC_FOUND_ROWS is emulated by a separate COUNT(*) select executed after the paged select,
+// since FOUND_ROWS() of backends only knows rows of one shard and may be asked on another connection.
+// SQL_CALC_FOUND_ROWS itself is not sent to backends.
+
+// isCalcFoundRows check if select has SQL_CALC_FOUND_ROWS
+func isCalcFoundRows(stmt *ast.SelectStmt) bool {
+	return stmt.SelectStmtOpts != nil && stmt.SelectStmtOpts.CalcFoundRows
+}
+
+// needDerivedFoundRowsCount check if rows of select are counted as derived table,
+// counts of such selects in different shards can't be summed
+func needDerivedFoundRowsCount(stmt *ast.SelectStmt) bool {
+	return stmt.GroupBy != nil || stmt.Distinct || stmt.Having != nil
+}
+
+// createFoundRowsCountStmt create select counting rows of stmt without LIMIT
+func createFoundRowsCountStmt(stmt *ast.SelectStmt) *ast.SelectStmt {
+	one := &driver.ValueExpr{}
+	one.SetInt64(1)
+	fields := &ast.FieldList{Fields: []*ast.SelectField{
+		{Expr: &ast.AggregateFuncExpr{F: ast.AggFuncCount, Args: []ast.ExprNode{one}}},
+	}}
+
+	count := *stmt
+	count.OrderBy = nil
+	count.Limit = nil
+	count.LockTp = ast.SelectLockNone
+	if !needDerivedFoundRowsCount(stmt) {
+		count.Fields = fields
+		return &count
+	}
+
+	count.IsInBraces = false
+	return &ast.SelectStmt{
+		SelectStmtOpts: &ast.SelectStmtOpts{SQLCache: true},
+		Fields:         fields,
+		From: &ast.TableRefsClause{TableRefs: &ast.Join{
+			Left: &ast.TableSource{Source: &count, AsName: model.NewCIStr("gaea_found_rows")},
+		}},
+	}
+}
+
+// executeFoundRowsCount execute count sqls and set their sum as found rows of session
+func executeFoundRowsCount(reqCtx *util.RequestContext, se Executor, sqls map[string]map[string][]string) error {
+	rs, err := se.ExecuteSQLs(reqCtx, sqls)
+	if err != nil {
+		return fmt.Errorf("execute found rows count error: %v", err)
+	}
+	var total uint64
+	for _, r := range rs {
+		if r.Resultset == nil || r.RowNumber() == 0 {
+			continue
+		}
+		n, err := r.GetUint(0, 0)
+		if err != nil {
+			return fmt.Errorf("get found rows count error: %v", err)
+		}
+		total += n
+	}
+	se.SetFoundRows(total)
+	return nil
+}
@@ -424,6 +424,7 @@ func MergeExecResult(rs []*mysql.Result) (*mysql.Result, error) {
 	for _, v := range rs {
 		r.Status |= v.Status
 		r.AffectedRows += v.AffectedRows
+		r.Warnings = addWarnings(r.Warnings, v.Warnings)
 		if r.InsertID == 0 {
 			r.InsertID = v.InsertID
 		} else if v.InsertID != 0 && r.InsertID > v.InsertID {
@@ -436,6 +437,14 @@ func MergeExecResult(rs []*mysql.Result) (*mysql.Result, error) {
 	return r, nil
 }
 
+// addWarnings sum warning counts of results, it's capped to max value of warnings in protocol
+func addWarnings(a, b uint16) uint16 {
+	if sum := a + b; sum >= a {
+		return sum
+	}
+	return ^uint16(0)
+}
+
 // MergeSelectResult merge select results
 func MergeSelectResult(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result) (*mysql.Result, error) {
 	ret := mergeMultiResultSet(rs)
@@ -487,6 +496,7 @@ func mergeMultiResultSet(rs []*mysql.Result) *mysql.Result {
 			rs[0].Fields = rs[i].Fields
 		}
 		rs[0].Status |= rs[i].Status
+		rs[0].Warnings = addWarnings(rs[0].Warnings, rs[i].Warnings)
 		rs[0].Values = append(rs[0].Values, rs[i].Values...)
 		rs[0].RowDatas = append(rs[0].RowDatas, rs[i].RowDatas...)
 	}
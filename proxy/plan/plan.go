@@ -36,7 +36,9 @@ var _ Plan = &DeletePlan{}
 var _ Plan = &UpdatePlan{}
 var _ Plan = &InsertPlan{}
 var _ Plan = &SelectLastInsertIDPlan{}
+var _ Plan = &SelectFoundRowsPlan{}
 var _ Plan = &SetPlan{}
+var _ Plan = &InformationSchemaPlan{}
 
 // Plan is a interface for select/insert etc.
 type Plan interface {
@@ -60,6 +62,14 @@ type Executor interface {
 
 	GetLastInsertID() uint64
 
+	// FOUND_ROWS() 和 ROW_COUNT() 的值, 由上一条语句的结果确定
+	GetFoundRows() uint64
+
+	// 用于执行 SQL_CALC_FOUND_ROWS 时设置 FOUND_ROWS() 的值
+	SetFoundRows(uint64)
+
+	GetRowCount() int64
+
 	HandleSet(*util.RequestContext, string, *ast.SetStmt) (*mysql.Result, error)
 }
 
@@ -70,6 +80,7 @@ type Checker struct {
 	hasShardTable bool // 是否包含分片表
 	dbInvalid     bool // SQL是否No database selected
 	tableNames    []*ast.TableName
+	cteNames      map[string]bool // WITH子句中定义的公用表表达式名称
 }
 
 // NewChecker db为USE db中设置的DB名. 如果没有执行USE db, 则为空字符串
@@ -79,6 +90,7 @@ func NewChecker(db string, router *router.Router) *Checker {
 		router:        router,
 		hasShardTable: false,
 		dbInvalid:     false,
+		cteNames:      make(map[string]bool),
 	}
 }
 
@@ -103,7 +115,13 @@ func (s *Checker) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
 		return n, true
 	}
 	switch nn := n.(type) {
+	case *ast.CommonTableExpression:
+		s.cteNames[nn.Name.L] = true
 	case *ast.TableName:
+		// common table expression is not a real table
+		if nn.Schema.L == "" && s.cteNames[nn.Name.L] {
+			return n, true
+		}
 		if s.isTableNameDatabaseInvalid(nn) {
 			s.dbInvalid = true
 			return n, true
@@ -148,6 +166,50 @@ func (s *Checker) hasShardTableInColumnName(n *ast.ColumnName) bool {
 	return ok
 }
 
+// tableCollector collect logical tables used in statement
+type tableCollector struct {
+	db       string
+	tables   []string
+	cteNames map[string]bool
+}
+
+// GetStmtTables return logical tables used in statement as db.table, db is session db if not specified.
+// It must be called before building plan, because sharding plan rewrites table names of statement.
+func GetStmtTables(stmt ast.StmtNode, db string) []string {
+	c := &tableCollector{db: db, cteNames: make(map[string]bool)}
+	stmt.Accept(c)
+	return c.tables
+}
+
+// Enter for node visit
+func (c *tableCollector) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch nn := n.(type) {
+	case *ast.CommonTableExpression:
+		c.cteNames[nn.Name.L] = true
+	case *ast.TableName:
+		if nn.Schema.L == "" && c.cteNames[nn.Name.L] {
+			return n, true
+		}
+		db := nn.Schema.L
+		if db == "" {
+			db = c.db
+		}
+		table := db + "." + nn.Name.L
+		for _, t := range c.tables {
+			if t == table {
+				return n, true
+			}
+		}
+		c.tables = append(c.tables, table)
+	}
+	return n, false
+}
+
+// Leave for node visit
+func (c *tableCollector) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
 type basePlan struct{}
 
 func (*basePlan) Size() int {
@@ -178,14 +240,26 @@ func BuildPlan(stmt ast.StmtNode, phyDBs map[string]string, db, sql string, rout
 		return CreateSelectLastInsertIDPlan(stmt.(*ast.SelectStmt)), nil
 	}
 
+	if IsSelectFoundRowsStmt(stmt) {
+		return CreateSelectFoundRowsPlan(stmt.(*ast.SelectStmt)), nil
+	}
+
 	if IsSetStmt(stmt) {
 		return CreateSetPlan(sql, stmt), nil
 	}
 
+	if p, ok := CreateInformationSchemaPlan(stmt, phyDBs, db, router); ok {
+		return p, nil
+	}
+
 	if estmt, ok := stmt.(*ast.ExplainStmt); ok {
 		return buildExplainPlan(estmt, phyDBs, db, sql, router, seq, hintPlan)
 	}
 
+	if IsOSCStmt(stmt, db, router) {
+		return CreateOSCPlan(stmt, db, router)
+	}
+
 	checker := NewChecker(db, router)
 	stmt.Accept(checker)
 
@@ -202,6 +276,9 @@ func BuildPlan(stmt ast.StmtNode, phyDBs map[string]string, db, sql string, rout
 func buildShardPlan(stmt ast.StmtNode, db string, sql string, router *router.Router, seq *sequence.SequenceManager, hintPlan Plan) (Plan, error) {
 	switch s := stmt.(type) {
 	case *ast.SelectStmt:
+		if s.With != nil {
+			return nil, fmt.Errorf("WITH clause does not support sharding table now")
+		}
 		plan := NewSelectPlan(db, sql, router)
 		// convert MyCat hint Plan to hint DB
 		if p, ok := hintPlan.(*SelectPlan); ok {
@@ -236,6 +313,11 @@ func buildShardPlan(stmt ast.StmtNode, db string, sql string, router *router.Rou
 			return nil, err
 		}
 		return plan, nil
+	case *ast.UnionStmt:
+		if s.With != nil {
+			return nil, fmt.Errorf("WITH clause does not support sharding table now")
+		}
+		return nil, fmt.Errorf("stmt type does not support shard now")
 	default:
 		return nil, fmt.Errorf("stmt type does not support shard now")
 	}
@@ -266,9 +348,14 @@ func (s *StmtInfo) GetRouteResult() *RouteResult {
 	return s.result
 }
 
+// checkAndGetDB return db of table, session db is used if db is empty.
+// Table in other db is allowed, so cross db sql like db1.t1 join db2.t2 is routed by rule of each table.
 func (s *StmtInfo) checkAndGetDB(db string) (string, error) {
-	if db != "" && db != s.db {
-		return "", fmt.Errorf("db not match")
+	if db != "" {
+		return db, nil
+	}
+	if s.db == "" {
+		return "", fmt.Errorf("no database selected")
 	}
 	return s.db, nil
 }
@@ -300,6 +387,14 @@ func (s *StmtInfo) getShardRule(db, table string) (router.Rule, error) {
 		return nil, fmt.Errorf("rule not found")
 	}
 
+	// 使用到的rule按表名记录, 不同DB的同名表无法区分
+	if r, ok := s.tableRules[table]; ok && r.GetDB() != rule.GetDB() {
+		return nil, fmt.Errorf("table %s in db %s and %s is ambiguous", table, r.GetDB(), rule.GetDB())
+	}
+	if r, ok := s.globalTableRules[table]; ok && r.GetDB() != rule.GetDB() {
+		return nil, fmt.Errorf("table %s in db %s and %s is ambiguous", table, r.GetDB(), rule.GetDB())
+	}
+
 	if rule.GetType() == router.GlobalTableRuleType {
 		s.globalTableRules[table] = rule
 	} else {
@@ -47,34 +47,32 @@ func buildExplainPlan(stmt *ast.ExplainStmt, phyDBs map[string]string, db, sql s
 		return nil, fmt.Errorf("build plan to explain error: %v", err)
 	}
 
-	ep := &ExplainPlan{}
+	shardType, sqls, err := GetShardSQLs(p, r)
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainPlan{shardType: shardType, sqls: sqls}, nil
+}
 
+// GetShardSQLs return shard type and sqls sent to backends of plan, key of sqls is slice, and then db
+func GetShardSQLs(p Plan, r *router.Router) (string, map[string]map[string][]string, error) {
 	switch pl := p.(type) {
 	case *SelectPlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *DeletePlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *UpdatePlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *InsertPlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *UnshardPlan:
-		ep.shardType = ShardTypeUnshard
-		ep.sqls = make(map[string]map[string][]string)
+		sqls := make(map[string]map[string][]string)
 		dbSQLs := make(map[string][]string)
 		dbSQLs[pl.db] = []string{pl.sql}
-		ep.sqls[r.GetDefaultRule().GetSlice(0)] = dbSQLs
-		return ep, nil
+		sqls[r.GetDefaultRule().GetSlice(0)] = dbSQLs
+		return ShardTypeUnshard, sqls, nil
 	default:
-		return nil, fmt.Errorf("unsupport plan to explain, type: %T", p)
+		return "", nil, fmt.Errorf("unsupport plan to explain, type: %T", p)
 	}
 }
 
@@ -0,0 +1,93 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package plan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// e2eCaseDir contains sql files of e2e cases, they are used as seed corpus
+const e2eCaseDir = "../../tests/e2e"
+
+var fuzzPlanSeeds = []string{
+	"select * from tbl_ks where id = 1",
+	"select id, count(*) from tbl_ks where id in (1, 2, 3) group by id order by id desc limit 10",
+	"select SQL_CALC_FOUND_ROWS * from tbl_ks where id > 1 limit 5",
+	"select a.id from tbl_ks a join tbl_ks_child b on a.id = b.id where a.id = 1",
+	"insert into tbl_ks (id, name) values (1, 'a'), (2, 'b')",
+	"update tbl_ks set name = 'a' where id = 1",
+	"delete from tbl_ks where id between 1 and 10",
+	"select * from tbl_mycat where id = 1 union select * from tbl_mycat where id = 2",
+	"select last_insert_id(), found_rows()",
+	"explain select * from tbl_mycat where id = 1",
+}
+
+// readE2eSQLs read sqls in e2e case files, one sql per line
+func readE2eSQLs(f *testing.F) []string {
+	var sqls []string
+	err := filepath.Walk(e2eCaseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".sql" {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "--") {
+				sqls = append(sqls, strings.TrimSuffix(line, ";"))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		f.Fatalf("read e2e sql cases error: %v", err)
+	}
+	return sqls
+}
+
+// FuzzBuildPlan check that parsing and building plan of any sql don't panic.
+// Failed inputs are saved to testdata/fuzz/FuzzBuildPlan by go test -fuzz, and are run by go test as regression tests.
+func FuzzBuildPlan(f *testing.F) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		f.Fatalf("prepare plan info error: %v", err)
+	}
+	for _, db := range []string{"db_ks", "db_mycat"} {
+		for _, sql := range fuzzPlanSeeds {
+			f.Add(db, sql)
+		}
+	}
+	for _, sql := range readE2eSQLs(f) {
+		f.Add("db_ks", sql)
+	}
+
+	f.Fuzz(func(t *testing.T, db string, sql string) {
+		stmt, err := parser.ParseSQL(sql)
+		if err != nil {
+			return
+		}
+		_, _ = BuildPlan(stmt, info.phyDBs, db, sql, info.rt, info.seqs, nil)
+	})
+}
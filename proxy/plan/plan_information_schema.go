@@ -0,0 +1,659 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/model"
+	"github.com/XiaoMi/Gaea/parser/opcode"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/hack"
+	"github.com/XiaoMi/Gaea/util/math"
+)
+
+// InformationSchemaDB is the name of information_schema
+const InformationSchemaDB = "information_schema"
+
+// informationSchemaTable describe how rows of sub tables are merged into the logical table
+type informationSchemaTable struct {
+	keys []string // columns identify a row of logical table
+	sums []string // columns summed over sub tables
+	maxs []string // columns use the max value of sub tables
+}
+
+// information_schema tables federated for sharding tables, others are forwarded to default slice as before
+var informationSchemaTables = map[string]*informationSchemaTable{
+	"tables": {
+		keys: []string{"table_schema", "table_name"},
+		sums: []string{"table_rows", "data_length", "index_length", "data_free"},
+		maxs: []string{"avg_row_length", "max_data_length", "auto_increment", "create_time", "update_time", "check_time"},
+	},
+	"columns": {
+		keys: []string{"table_schema", "table_name", "column_name"},
+	},
+	"statistics": {
+		keys: []string{"table_schema", "table_name", "index_name", "seq_in_index"},
+		sums: []string{"cardinality"},
+	},
+}
+
+// InformationSchemaPlan is the plan for SELECT on information_schema tables when namespace has sharding tables.
+// The SELECT is executed in all slices, then sub table names and physical dbs in result are replaced
+// by the logical ones, and rows of sub tables are merged into one row.
+type InformationSchemaPlan struct {
+	basePlan
+
+	table       *informationSchemaTable
+	logicalDBs  map[string]string // key = physical db, value = logical db
+	router      *router.Router
+	sqls        map[string]map[string][]string
+	columns     []string // lower case column names of result, nil means SELECT *
+	columnCount int      // count of columns selected by client, extra columns are trimmed
+	orderBy     []informationSchemaOrderBy
+	distinct    bool
+	offset      int64
+	count       int64 // -1 means no limit
+}
+
+type informationSchemaOrderBy struct {
+	column string // column name, used if index is -1
+	index  int
+	desc   bool
+}
+
+// IsInformationSchemaSQL check if tokens of SELECT refer to information_schema
+func IsInformationSchemaSQL(tokens []string, db string) bool {
+	if strings.EqualFold(db, InformationSchemaDB) {
+		return true
+	}
+	for _, token := range tokens {
+		if strings.Contains(strings.ToLower(token), InformationSchemaDB) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateInformationSchemaPlan create InformationSchemaPlan, ok is false if stmt is not a supported SELECT on information_schema
+func CreateInformationSchemaPlan(stmt ast.StmtNode, phyDBs map[string]string, db string, r *router.Router) (*InformationSchemaPlan, bool) {
+	s, ok := stmt.(*ast.SelectStmt)
+	if !ok || r == nil || len(r.GetAllRules()) == 0 {
+		return nil, false
+	}
+	if s.GroupBy != nil || s.Having != nil || s.From == nil || s.From.TableRefs == nil || s.From.TableRefs.Right != nil {
+		return nil, false
+	}
+	ts, ok := s.From.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return nil, false
+	}
+	tn, ok := ts.Source.(*ast.TableName)
+	if !ok {
+		return nil, false
+	}
+	schema := tn.Schema.L
+	if schema == "" {
+		schema = strings.ToLower(db)
+	}
+	table, ok := informationSchemaTables[tn.Name.L]
+	if schema != InformationSchemaDB || !ok {
+		return nil, false
+	}
+
+	p := &InformationSchemaPlan{
+		table:      table,
+		logicalDBs: make(map[string]string),
+		router:     r,
+		distinct:   s.Distinct,
+		count:      -1,
+	}
+	for logicalDB, phyDB := range phyDBs {
+		p.logicalDBs[phyDB] = logicalDB
+	}
+	for _, rules := range r.GetAllRules() {
+		for _, rule := range rules {
+			if mr, ok := rule.(router.MycatRule); ok {
+				for _, phyDB := range mr.GetDatabases() {
+					p.logicalDBs[phyDB] = rule.GetDB()
+				}
+			}
+		}
+	}
+
+	// stmt is used by unshard plan if not supported, so check all before rewriting
+	if !p.handleFields(s) || !p.handleOrderBy(s) || !p.handleLimit(s) || hasSubquery(s.Where) {
+		return nil, false
+	}
+	for i := len(s.Fields.Fields); i < len(p.columns); i++ {
+		s.Fields.Fields = append(s.Fields.Fields, &ast.SelectField{
+			Expr: &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: model.NewCIStr(p.columns[i])}},
+		})
+	}
+	if s.Where != nil {
+		where, _ := s.Where.Accept(&informationSchemaWhereRewriter{db: db, phyDBs: phyDBs, router: r})
+		s.Where = where.(ast.ExprNode)
+	}
+	s.OrderBy = nil
+	s.Limit = nil
+
+	sql, err := generateUnshardingSQL(s)
+	if err != nil {
+		return nil, false
+	}
+	p.sqls = make(map[string]map[string][]string)
+	for _, slice := range allRouterSlices(r) {
+		p.sqls[slice] = map[string][]string{InformationSchemaDB: {sql}}
+	}
+	return p, true
+}
+
+// handleFields record column names and add key columns of table to SELECT if missing
+func (p *InformationSchemaPlan) handleFields(s *ast.SelectStmt) bool {
+	fields := s.Fields.Fields
+	if len(fields) == 1 && fields[0].WildCard != nil {
+		return true
+	}
+
+	p.columns = []string{}
+	for _, f := range fields {
+		c, ok := f.Expr.(*ast.ColumnNameExpr)
+		if f.WildCard != nil || !ok {
+			return false
+		}
+		p.columns = append(p.columns, c.Name.Name.L)
+	}
+	p.columnCount = len(fields)
+	for _, key := range p.table.keys {
+		p.addExtraColumn(key)
+	}
+	return true
+}
+
+// addExtraColumn record column to be added to SELECT if it's not selected, return index of column
+func (p *InformationSchemaPlan) addExtraColumn(column string) int {
+	if index := findColumnIndex(p.columns, column); index >= 0 {
+		return index
+	}
+	p.columns = append(p.columns, column)
+	return len(p.columns) - 1
+}
+
+func (p *InformationSchemaPlan) handleOrderBy(s *ast.SelectStmt) bool {
+	if s.OrderBy == nil {
+		return true
+	}
+	for _, item := range s.OrderBy.Items {
+		orderBy := informationSchemaOrderBy{index: -1, desc: item.Desc}
+		switch expr := item.Expr.(type) {
+		case *ast.PositionExpr:
+			if expr.P != nil || expr.N < 1 || (p.columns != nil && expr.N > p.columnCount) {
+				return false
+			}
+			orderBy.index = expr.N - 1
+		case *ast.ColumnNameExpr:
+			orderBy.column = expr.Name.Name.L
+			for i, f := range s.Fields.Fields {
+				if f.AsName.L != "" && f.AsName.L == orderBy.column && i < p.columnCount {
+					orderBy.index = i
+				}
+			}
+			if orderBy.index == -1 && p.columns != nil {
+				orderBy.index = p.addExtraColumn(orderBy.column)
+			}
+		default:
+			return false
+		}
+		p.orderBy = append(p.orderBy, orderBy)
+	}
+	return true
+}
+
+func (p *InformationSchemaPlan) handleLimit(s *ast.SelectStmt) bool {
+	if s.Limit == nil {
+		return true
+	}
+	count, ok := s.Limit.Count.(*driver.ValueExpr)
+	if !ok {
+		return false
+	}
+	p.count = count.GetInt64()
+	if s.Limit.Offset != nil {
+		offset, ok := s.Limit.Offset.(*driver.ValueExpr)
+		if !ok {
+			return false
+		}
+		p.offset = offset.GetInt64()
+	}
+	return true
+}
+
+// ExecuteIn implement Plan
+func (p *InformationSchemaPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	rs, err := se.ExecuteSQLs(reqCtx, p.sqls)
+	if err != nil {
+		return nil, fmt.Errorf("execute in InformationSchemaPlan error: %v", err)
+	}
+	r, err := p.mergeResult(rs)
+	if err != nil {
+		return nil, fmt.Errorf("merge information schema result error: %v", err)
+	}
+	return r, nil
+}
+
+// GetSQLs get generated SQLs
+func (p *InformationSchemaPlan) GetSQLs() map[string]map[string][]string {
+	return p.sqls
+}
+
+func (p *InformationSchemaPlan) mergeResult(rs []*mysql.Result) (*mysql.Result, error) {
+	ret := mergeMultiResultSet(rs)
+	if ret.Resultset == nil {
+		return ret, nil
+	}
+
+	columns := p.columns
+	columnCount := p.columnCount
+	if columns == nil {
+		for _, f := range ret.Fields {
+			columns = append(columns, strings.ToLower(string(f.Name)))
+		}
+		columnCount = len(columns)
+	}
+	if len(columns) != len(ret.Fields) {
+		return nil, fmt.Errorf("column count not match, expect: %d, actual: %d", len(columns), len(ret.Fields))
+	}
+
+	keys, err := getColumnIndexes(columns, p.table.keys)
+	if err != nil {
+		return nil, err
+	}
+	sums := findColumnIndexes(columns, p.table.sums)
+	maxs := findColumnIndexes(columns, p.table.maxs)
+
+	groups := make(map[string]ResultRow)
+	rows := ret.Values[:0]
+	for _, row := range ret.Values {
+		schema, table, sharded := p.logicalTable(string(toBytes(row[keys[0]])), string(toBytes(row[keys[1]])))
+		row[keys[0]], row[keys[1]] = []byte(schema), []byte(table)
+
+		keySlice := make([]interface{}, 0, len(keys))
+		for _, i := range keys {
+			keySlice = append(keySlice, row[i])
+		}
+		mk, err := generateMapKey(keySlice)
+		if err != nil {
+			return nil, err
+		}
+		to, ok := groups[mk]
+		if !ok {
+			groups[mk] = row
+			rows = append(rows, row)
+			continue
+		}
+		// the same table in different slices, e.g. global table or mysql.user
+		if !sharded {
+			continue
+		}
+		for _, i := range sums {
+			if err := mergeSumValue(row, to, i); err != nil {
+				return nil, err
+			}
+		}
+		for _, i := range maxs {
+			mergeMaxValue(row, to, i)
+		}
+	}
+	ret.Values = rows
+
+	if err := p.sortResult(ret, columns); err != nil {
+		return nil, err
+	}
+
+	if columnCount < len(columns) {
+		ret.Fields = ret.Fields[:columnCount]
+		for i := range ret.Values {
+			ret.Values[i] = ret.Values[i][:columnCount]
+		}
+	}
+	if p.distinct {
+		if err := removeDuplicateRows(ret); err != nil {
+			return nil, err
+		}
+	}
+	if p.count >= 0 {
+		rowLen := int64(len(ret.Values))
+		start := math.MinInt64(p.offset, rowLen)
+		ret.Values = ret.Values[start:math.MinInt64(p.offset+p.count, rowLen)]
+	}
+
+	if err := GenerateSelectResultRowData(ret); err != nil {
+		return nil, fmt.Errorf("generate RowData error: %v", err)
+	}
+	return ret, nil
+}
+
+func (p *InformationSchemaPlan) sortResult(ret *mysql.Result, columns []string) error {
+	if len(p.orderBy) == 0 {
+		return nil
+	}
+	var sortKeys []mysql.SortKey
+	for _, orderBy := range p.orderBy {
+		index := orderBy.index
+		if index == -1 {
+			if index = findColumnIndex(columns, orderBy.column); index == -1 {
+				return fmt.Errorf("unknown column '%s' in 'order clause'", orderBy.column)
+			}
+		}
+		if index >= len(columns) {
+			return fmt.Errorf("unknown column '%d' in 'order clause'", index+1)
+		}
+		sortKey := mysql.SortKey{Column: index, Direction: mysql.SortAsc}
+		if orderBy.desc {
+			sortKey.Direction = mysql.SortDesc
+		}
+		sortKeys = append(sortKeys, sortKey)
+	}
+	return ret.SortWithoutColumnName(sortKeys)
+}
+
+// logicalTable replace physical db and sub table name with the logical ones,
+// sharded is true if the table is one of sub tables of a sharding table
+func (p *InformationSchemaPlan) logicalTable(schema, table string) (string, string, bool) {
+	if db, ok := p.logicalDBs[schema]; ok {
+		schema = db
+	}
+	if rule, ok := p.router.GetShardRule(schema, table); ok {
+		// mycat sub tables have the same name in different dbs
+		return schema, table, router.IsMycatShardingRule(rule.GetType())
+	}
+
+	i := strings.LastIndexByte(table, '_')
+	if i <= 0 {
+		return schema, table, false
+	}
+	index, err := strconv.Atoi(table[i+1:])
+	if err != nil {
+		return schema, table, false
+	}
+	rule, ok := p.router.GetShardRule(schema, table[:i])
+	if !ok || rule.GetType() == router.GlobalTableRuleType || router.IsMycatShardingRule(rule.GetType()) {
+		return schema, table, false
+	}
+	for _, idx := range rule.GetSubTableIndexes() {
+		if idx == index {
+			return schema, table[:i], true
+		}
+	}
+	return schema, table, false
+}
+
+// informationSchemaWhereRewriter replace DATABASE() with session db, and expand logical db and table
+// in table_schema = 'db', table_name IN ('t') to physical dbs and sub tables
+type informationSchemaWhereRewriter struct {
+	db     string
+	phyDBs map[string]string
+	router *router.Router
+}
+
+// Enter implement ast.Visitor
+func (v *informationSchemaWhereRewriter) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *informationSchemaWhereRewriter) Leave(n ast.Node) (node ast.Node, ok bool) {
+	switch nn := n.(type) {
+	case *ast.FuncCallExpr:
+		if (nn.FnName.L == "database" || nn.FnName.L == "schema") && v.db != "" {
+			return ast.NewValueExpr(v.db), true
+		}
+	case *ast.BinaryOperationExpr:
+		if nn.Op != opcode.EQ {
+			return n, true
+		}
+		column, value := nn.L, nn.R
+		if _, ok := column.(*ast.ColumnNameExpr); !ok {
+			column, value = nn.R, nn.L
+		}
+		if list, ok := v.expand(column, []ast.ExprNode{value}); ok && len(list) > 1 {
+			return &ast.PatternInExpr{Expr: column, List: list}, true
+		}
+	case *ast.PatternInExpr:
+		if nn.Not || nn.Sel != nil {
+			return n, true
+		}
+		if list, ok := v.expand(nn.Expr, nn.List); ok {
+			nn.List = list
+		}
+	}
+	return n, true
+}
+
+// expand return physical names of values if column is table_schema or table_name
+func (v *informationSchemaWhereRewriter) expand(column ast.ExprNode, values []ast.ExprNode) ([]ast.ExprNode, bool) {
+	c, ok := column.(*ast.ColumnNameExpr)
+	if !ok || (c.Name.Name.L != "table_schema" && c.Name.Name.L != "table_name") {
+		return nil, false
+	}
+
+	var names []string
+	for _, value := range values {
+		ve, ok := value.(*driver.ValueExpr)
+		if !ok {
+			return nil, false
+		}
+		name, err := util.GetValueExprResult(ve)
+		if err != nil {
+			return nil, false
+		}
+		s, ok := name.(string)
+		if !ok {
+			return nil, false
+		}
+		if c.Name.Name.L == "table_schema" {
+			names = append(names, v.physicalDBs(s)...)
+		} else {
+			names = append(names, v.subTables(s)...)
+		}
+	}
+
+	var list []ast.ExprNode
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, ast.NewValueExpr(name))
+		}
+	}
+	return list, true
+}
+
+func (v *informationSchemaWhereRewriter) physicalDBs(db string) []string {
+	dbs := []string{db}
+	if phyDB, ok := v.phyDBs[db]; ok {
+		dbs[0] = phyDB
+	}
+	for _, rule := range v.router.GetAllRules()[db] {
+		if mr, ok := rule.(router.MycatRule); ok {
+			dbs = append(dbs, mr.GetDatabases()...)
+		}
+	}
+	return dbs
+}
+
+func (v *informationSchemaWhereRewriter) subTables(table string) []string {
+	tables := []string{table}
+	for _, rules := range v.router.GetAllRules() {
+		rule, ok := rules[table]
+		if !ok || rule.GetType() == router.GlobalTableRuleType || router.IsMycatShardingRule(rule.GetType()) {
+			continue
+		}
+		for _, index := range rule.GetSubTableIndexes() {
+			tables = append(tables, fmt.Sprintf("%s_%04d", table, index))
+		}
+	}
+	return tables
+}
+
+// subqueryChecker check if there is subquery in expr
+type subqueryChecker struct {
+	hasSubquery bool
+}
+
+// Enter implement ast.Visitor
+func (c *subqueryChecker) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*ast.SubqueryExpr); ok {
+		c.hasSubquery = true
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (c *subqueryChecker) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+func hasSubquery(expr ast.ExprNode) bool {
+	if expr == nil {
+		return false
+	}
+	c := &subqueryChecker{}
+	expr.Accept(c)
+	return c.hasSubquery
+}
+
+// allRouterSlices return sorted slices of all rules and default rule
+func allRouterSlices(r *router.Router) []string {
+	set := make(map[string]bool)
+	for _, slice := range r.GetDefaultRule().GetSlices() {
+		set[slice] = true
+	}
+	for _, rules := range r.GetAllRules() {
+		for _, rule := range rules {
+			for _, slice := range rule.GetSlices() {
+				set[slice] = true
+			}
+		}
+	}
+	slices := make([]string, 0, len(set))
+	for slice := range set {
+		slices = append(slices, slice)
+	}
+	sort.Strings(slices)
+	return slices
+}
+
+func findColumnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+func getColumnIndexes(columns []string, names []string) ([]int, error) {
+	var indexes []int
+	for _, name := range names {
+		index := findColumnIndex(columns, name)
+		if index == -1 {
+			return nil, fmt.Errorf("column %s not found in result", name)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// findColumnIndexes return indexes of selected columns in names
+func findColumnIndexes(columns []string, names []string) []int {
+	var indexes []int
+	for _, name := range names {
+		if index := findColumnIndex(columns, name); index != -1 {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func mergeSumValue(from, to ResultRow, idx int) error {
+	if to.GetValue(idx) == nil {
+		to.SetValue(idx, from.GetValue(idx))
+		return nil
+	}
+	merger := &AggregateFuncSumMerger{aggregateFuncBaseMerger{fieldIndex: idx}}
+	return merger.MergeTo(from, to)
+}
+
+func mergeMaxValue(from, to ResultRow, idx int) {
+	fromValue, toValue := from.GetValue(idx), to.GetValue(idx)
+	switch v := fromValue.(type) {
+	case nil:
+	case int64:
+		if t, ok := toValue.(int64); !ok || v > t {
+			to.SetValue(idx, v)
+		}
+	case uint64:
+		if t, ok := toValue.(uint64); !ok || v > t {
+			to.SetValue(idx, v)
+		}
+	case float64:
+		if t, ok := toValue.(float64); !ok || v > t {
+			to.SetValue(idx, v)
+		}
+	case []byte:
+		// datetime values are compared as string
+		if t, ok := toValue.([]byte); !ok || bytes.Compare(v, t) > 0 {
+			to.SetValue(idx, v)
+		}
+	}
+}
+
+func removeDuplicateRows(r *mysql.Result) error {
+	seen := make(map[string]bool)
+	rows := r.Values[:0]
+	for _, row := range r.Values {
+		mk, err := generateMapKey(row)
+		if err != nil {
+			return err
+		}
+		if !seen[mk] {
+			seen[mk] = true
+			rows = append(rows, row)
+		}
+	}
+	r.Values = rows
+	return nil
+}
+
+func toBytes(v interface{}) []byte {
+	switch s := v.(type) {
+	case []byte:
+		return s
+	case string:
+		return hack.Slice(s)
+	default:
+		return nil
+	}
+}
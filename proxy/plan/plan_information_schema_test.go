@@ -0,0 +1,147 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+func buildInformationSchemaPlan(t *testing.T, info *PlanInfo, db, sql string) Plan {
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	p, err := BuildPlan(stmt, info.phyDBs, db, sql, info.rt, info.seqs, nil)
+	if err != nil {
+		t.Fatalf("build plan error: %v", err)
+	}
+	return p
+}
+
+func TestInformationSchemaPlanSQL(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		db     string
+		sql    string
+		expect string
+	}{
+		{
+			db:     "db_ks",
+			sql:    "select table_name, table_rows from information_schema.tables where table_schema = database() and table_name = 'tbl_ks' order by table_rows desc limit 1",
+			expect: "SELECT `table_name`,`table_rows`,`table_schema` FROM `information_schema`.`tables` WHERE `table_schema`='db_ks' AND `table_name` IN ('tbl_ks','tbl_ks_0000','tbl_ks_0001','tbl_ks_0002','tbl_ks_0003')",
+		},
+		{
+			db:     "db_mycat",
+			sql:    "select column_name from information_schema.columns where table_schema in ('db_mycat') and table_name = 'tbl_mycat'",
+			expect: "SELECT `column_name`,`table_schema`,`table_name` FROM `information_schema`.`columns` WHERE `table_schema` IN ('db_mycat_0','db_mycat_1','db_mycat_2','db_mycat_3') AND `table_name`='tbl_mycat'",
+		},
+		{
+			db:     "",
+			sql:    "select * from information_schema.statistics where table_schema = 'db_ks'",
+			expect: "SELECT * FROM `information_schema`.`statistics` WHERE `table_schema`='db_ks'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			p, ok := buildInformationSchemaPlan(t, info, test.db, test.sql).(*InformationSchemaPlan)
+			if !ok {
+				t.Fatalf("plan should be InformationSchemaPlan")
+			}
+			sqls := p.GetSQLs()
+			if len(sqls) != 2 {
+				t.Fatalf("sql should be sent to all slices, got: %v", sqls)
+			}
+			for slice, dbSQLs := range sqls {
+				if actual := dbSQLs[InformationSchemaDB][0]; actual != test.expect {
+					t.Errorf("slice: %s, expect: %s, actual: %s", slice, test.expect, actual)
+				}
+			}
+		})
+	}
+
+	unsupported := []string{
+		"select count(*) from information_schema.tables where table_schema = 'db_ks'",
+		"select table_name from information_schema.tables where table_name in (select 'tbl_ks')",
+		"select * from information_schema.processlist",
+	}
+	for _, sql := range unsupported {
+		if _, ok := buildInformationSchemaPlan(t, info, "db_ks", sql).(*UnshardPlan); !ok {
+			t.Errorf("unsupported sql should use unshard plan: %s", sql)
+		}
+	}
+}
+
+func TestInformationSchemaPlanMergeResult(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	sql := "select table_name, table_rows as cnt from information_schema.tables where table_schema in ('db_ks', 'db_mycat') order by cnt desc"
+	p := buildInformationSchemaPlan(t, info, "", sql).(*InformationSchemaPlan)
+
+	newResult := func(rows ...[]interface{}) *mysql.Result {
+		rs := &mysql.Resultset{}
+		for _, name := range []string{"table_name", "cnt", "table_schema"} {
+			rs.Fields = append(rs.Fields, &mysql.Field{Name: hack.Slice(name)})
+		}
+		rs.Values = rows
+		return &mysql.Result{Resultset: rs}
+	}
+	rs := []*mysql.Result{
+		newResult(
+			[]interface{}{[]byte("tbl_ks_0000"), uint64(1), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_ks_0001"), uint64(2), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_unshard"), uint64(5), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_ks_global_one"), uint64(7), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_mycat"), uint64(3), []byte("db_mycat_0")},
+		),
+		newResult(
+			[]interface{}{[]byte("tbl_ks_0002"), uint64(4), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_ks_0003"), uint64(8), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_ks_global_one"), uint64(7), []byte("db_ks")},
+			[]interface{}{[]byte("tbl_mycat"), uint64(6), []byte("db_mycat_1")},
+		),
+	}
+
+	r, err := p.mergeResult(rs)
+	if err != nil {
+		t.Fatalf("merge result error: %v", err)
+	}
+	expect := []struct {
+		table string
+		rows  uint64
+	}{
+		{"tbl_ks", 15},
+		{"tbl_mycat", 9},
+		{"tbl_ks_global_one", 7},
+		{"tbl_unshard", 5},
+	}
+	if len(r.Fields) != 2 || len(r.Values) != len(expect) || len(r.RowDatas) != len(expect) {
+		t.Fatalf("result not match, fields: %d, values: %v", len(r.Fields), r.Values)
+	}
+	for i, e := range expect {
+		if string(r.Values[i][0].([]byte)) != e.table || r.Values[i][1].(uint64) != e.rows {
+			t.Errorf("row %d not match, expect: %v, actual: %v", i, e, r.Values[i])
+		}
+	}
+}
@@ -40,7 +40,8 @@ type InsertPlan struct {
 	isAssignmentMode    bool
 	shardingColumnIndex int
 
-	sequences *sequence.SequenceManager
+	sequences   *sequence.SequenceManager
+	generatedID int64 // the first value generated by global sequence, returned as insert id
 
 	sqls map[string]map[string][]string
 }
@@ -60,6 +61,58 @@ func (s *InsertPlan) GetStmt() *ast.InsertStmt {
 	return s.stmt
 }
 
+// GetTable return logical db and table of insert
+func (s *InsertPlan) GetTable() (string, string) {
+	tableSource, ok := s.stmt.Table.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return "", ""
+	}
+	dec, ok := tableSource.Source.(*TableNameDecorator)
+	if !ok {
+		return "", ""
+	}
+	return dec.rule.GetDB(), dec.rule.GetTable()
+}
+
+// GetColumnValues return non null values of column in inserted rows, values of global sequence are generated.
+// nil is returned if column is not specified, and error is returned if any value is not a constant.
+func (s *InsertPlan) GetColumnValues(column string) ([]interface{}, error) {
+	var exprs []ast.ExprNode
+	if s.isAssignmentMode {
+		for _, a := range s.stmt.Setlist {
+			if a.Column.Name.L == column {
+				exprs = append(exprs, a.Expr)
+			}
+		}
+	} else {
+		for i, c := range s.stmt.Columns {
+			if c.Name.L != column {
+				continue
+			}
+			for _, valueList := range s.stmt.Lists {
+				exprs = append(exprs, valueList[i])
+			}
+			break
+		}
+	}
+
+	values := make([]interface{}, 0, len(exprs))
+	for _, expr := range exprs {
+		x, ok := expr.(*driver.ValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("value of column %s is not a constant", column)
+		}
+		v, err := util.GetValueExprResult(x)
+		if err != nil {
+			return nil, fmt.Errorf("get value expr result failed, %v", err)
+		}
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
 // HandleInsertStmt build a InsertPlan
 func HandleInsertStmt(p *InsertPlan, stmt *ast.InsertStmt) error {
 	p.stmt = stmt
@@ -74,7 +127,7 @@ func HandleInsertStmt(p *InsertPlan, stmt *ast.InsertStmt) error {
 		return fmt.Errorf("handleInsertTableRefs error: %v", err)
 	}
 
-	if err := handleInsertGlobalSequenceValue(p); err != nil {
+	if err := handleInsertGlobalSequenceValue(p, isGlobalTable); err != nil {
 		return fmt.Errorf("handleInsertGlobalSequenceValue error: %v", err)
 	}
 
@@ -308,29 +361,36 @@ func handleInsertOnDuplicate(p *InsertPlan) error {
 }
 
 // 处理全局序列号, 目前一条SQL中只允许一个列使用全局序列号
-func handleInsertGlobalSequenceValue(p *InsertPlan) error {
+func handleInsertGlobalSequenceValue(p *InsertPlan, isGlobalTable bool) error {
 	seq, ok := p.sequences.GetSequence(p.db, p.table)
 	if !ok {
 		return nil
 	}
 	pkName := seq.GetPKName()
 
-	// not assignment mode
+	// assignment mode
 	if p.isAssignmentMode {
+		var seqAssignment *ast.Assignment
 		for _, assignment := range p.stmt.Setlist {
-			columnName := assignment.Column.Name.L
-			if columnName == pkName {
-				if x, ok := assignment.Expr.(*ast.FuncCallExpr); ok {
-					if x.FnName.L == "nextval" {
-						id, err := seq.NextSeq()
-						if err != nil {
-							return fmt.Errorf("get next seq error: %v", err)
-						}
-						assignment.Expr = ast.NewValueExpr(id)
-						break
-					}
-				}
+			if assignment.Column.Name.L == pkName {
+				seqAssignment = assignment
+				break
+			}
+		}
+		// 有配置全局自增列但是没有指定自增列，自动补齐, 全局表保持原有行为不补齐
+		if seqAssignment == nil && !isGlobalTable {
+			seqAssignment = &ast.Assignment{
+				Column: &ast.ColumnName{Name: model.NewCIStr(pkName)},
+				Expr:   &ast.FuncCallExpr{FnName: model.NewCIStr("nextval")},
 			}
+			p.stmt.Setlist = append(p.stmt.Setlist, seqAssignment)
+		}
+		if seqAssignment != nil && needGenerateNextSeq(seqAssignment.Expr) {
+			id, err := p.nextSeq(seq)
+			if err != nil {
+				return err
+			}
+			seqAssignment.Expr = ast.NewValueExpr(id)
 		}
 		return nil
 	}
@@ -359,33 +419,44 @@ func handleInsertGlobalSequenceValue(p *InsertPlan) error {
 	}
 
 	for _, valueList := range p.stmt.Lists {
-		generateNextSeq := false
-		switch x := valueList[seqIndex].(type) {
-		// insert into t(col) values(val)  ->  insert into t(col,id) values(val, nextSeq)
-		case *ast.FuncCallExpr:
-			if x.FnName.L == "nextval" {
-				generateNextSeq = true
-			}
-		// insert into t(id, col) values(null, val)  ->  insert into t(id,col) values(nextSeq, val)
-		case *driver.ValueExpr:
-			if x.IsNull() {
-				generateNextSeq = true
-			}
-		}
-
-		if generateNextSeq {
-			id, err := seq.NextSeq()
+		if needGenerateNextSeq(valueList[seqIndex]) {
+			id, err := p.nextSeq(seq)
 			if err != nil {
-				return fmt.Errorf("get next seq error: %v", err)
+				return err
 			}
 			valueList[seqIndex] = ast.NewValueExpr(id)
 		}
-
 	}
 
 	return nil
 }
 
+// needGenerateNextSeq check if value of global sequence column should be generated
+func needGenerateNextSeq(expr ast.ExprNode) bool {
+	switch x := expr.(type) {
+	// insert into t(col) values(val)  ->  insert into t(col,id) values(val, nextSeq)
+	case *ast.FuncCallExpr:
+		return x.FnName.L == "nextval"
+	// insert into t(id, col) values(null, val)  ->  insert into t(id,col) values(nextSeq, val)
+	case *driver.ValueExpr:
+		return x.IsNull()
+	}
+	return false
+}
+
+// nextSeq generate next value of global sequence, the first one of statement is recorded as insert id
+// like auto increment column of MySQL
+func (p *InsertPlan) nextSeq(seq sequence.Sequence) (int64, error) {
+	id, err := seq.NextSeq()
+	if err != nil {
+		return 0, fmt.Errorf("get next seq error: %v", err)
+	}
+	if p.generatedID == 0 {
+		p.generatedID = id
+	}
+	return id, nil
+}
+
 // ExecuteIn implement Plan
 func (s *InsertPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mysql.Result, error) {
 	rs, err := sess.ExecuteSQLs(reqCtx, s.sqls)
@@ -398,6 +469,10 @@ func (s *InsertPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 		return nil, err
 	}
 
+	// values of global sequence are generated by proxy, backends don't know them
+	if s.generatedID != 0 {
+		r.InsertID = uint64(s.generatedID)
+	}
 	if r.InsertID != 0 {
 		sess.SetLastInsertID(r.InsertID)
 	}
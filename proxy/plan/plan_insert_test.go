@@ -14,7 +14,13 @@
 
 package plan
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
 
 func TestMycatShardSimpleInsert(t *testing.T) {
 	ns, err := preparePlanInfo()
@@ -992,3 +998,196 @@ func TestInserTableNameColumnCaseInsensitive(t *testing.T) {
 		t.Run(test.sql, getTestFunc(ns, test))
 	}
 }
+
+func TestInsertPlanGetColumnValues(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sql    string
+		column string
+		values []interface{}
+		hasErr bool
+	}{
+		{sql: "insert into tbl_mycat (id, a) values (0, 'hi'), (1, null), (2, 'there')", column: "a", values: []interface{}{"hi", "there"}},
+		{sql: "insert into tbl_mycat (id, A) values (0, 'hi')", column: "a", values: []interface{}{"hi"}},
+		{sql: "insert into tbl_mycat set id = 1, a = 'hi'", column: "a", values: []interface{}{"hi"}},
+		{sql: "insert into tbl_mycat (id, a) values (0, 'hi')", column: "b", values: []interface{}{}},
+		{sql: "insert into tbl_mycat (id, a) values (0, concat('h', 'i'))", column: "a", hasErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			if err != nil {
+				t.Fatalf("parse sql error: %v", err)
+			}
+			p, err := BuildPlan(stmt, ns.phyDBs, "db_mycat", test.sql, ns.rt, ns.seqs, nil)
+			if err != nil {
+				t.Fatalf("BuildPlan error: %v", err)
+			}
+			ip := p.(*InsertPlan)
+			if db, table := ip.GetTable(); db != "db_mycat" || table != "tbl_mycat" {
+				t.Errorf("table not equal, db: %s, table: %s", db, table)
+			}
+			values, err := ip.GetColumnValues(test.column)
+			if test.hasErr {
+				if err == nil {
+					t.Errorf("GetColumnValues should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetColumnValues error: %v", err)
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("values not equal, expect: %v, actual: %v", test.values, values)
+			}
+		})
+	}
+}
+
+func TestMycatInsertSequenceGeneratedID(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		SQLTestcase
+		generatedID int64
+	}{
+		{
+			// sequence column is filled in assignment mode as well
+			SQLTestcase: SQLTestcase{
+				db:  "db_ks",
+				sql: "insert into tbl_ks set id = 0, a = 'hi'",
+				sqls: map[string]map[string][]string{
+					"slice-0": {
+						"db_ks": {"INSERT INTO `tbl_ks_0000` SET `id`=0,`a`='hi',`user_id`=1"},
+					},
+				},
+			},
+			generatedID: 1,
+		},
+		{
+			// insert id of multi rows is the first generated value
+			SQLTestcase: SQLTestcase{
+				db:  "db_ks",
+				sql: "insert into tbl_ks (id, a) values (3, 'a'), (3, 'b')",
+				sqls: map[string]map[string][]string{
+					"slice-1": {
+						"db_ks": {"INSERT INTO `tbl_ks_0003` (`id`,`a`,`user_id`) VALUES (3,'a',2),(3,'b',3)"},
+					},
+				},
+			},
+			generatedID: 2,
+		},
+		{
+			SQLTestcase: SQLTestcase{
+				db:  "db_ks",
+				sql: "insert into tbl_ks set id = 0, user_id = null, a = 'hi'",
+				sqls: map[string]map[string][]string{
+					"slice-0": {
+						"db_ks": {"INSERT INTO `tbl_ks_0000` SET `id`=0,`user_id`=4,`a`='hi'"},
+					},
+				},
+			},
+			generatedID: 4,
+		},
+		{
+			// explicit values are not generated
+			SQLTestcase: SQLTestcase{
+				db:  "db_ks",
+				sql: "insert into tbl_ks (id, user_id, a) values (3, 100, 'a')",
+				sqls: map[string]map[string][]string{
+					"slice-1": {
+						"db_ks": {"INSERT INTO `tbl_ks_0003` (`id`,`user_id`,`a`) VALUES (3,100,'a')"},
+					},
+				},
+			},
+			generatedID: 0,
+		},
+	}
+	// plans are built in order since they share the sequence
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatalf("parse sql error: %v", err)
+		}
+		p, err := BuildPlan(stmt, ns.phyDBs, test.db, test.sql, ns.rt, ns.seqs, nil)
+		if err != nil {
+			t.Fatalf("BuildPlan error, sql: %s, err: %v", test.sql, err)
+		}
+		ip := p.(*InsertPlan)
+		if !checkSQLs(test.sqls, ip.sqls) {
+			t.Errorf("not equal, sql: %s, expect: %v, actual: %v", test.sql, test.sqls, ip.sqls)
+		}
+		if ip.generatedID != test.generatedID {
+			t.Errorf("generated id not equal, sql: %s, expect: %d, actual: %d", test.sql, test.generatedID, ip.generatedID)
+		}
+	}
+}
+
+func TestMycatInsertSequenceLastInsertID(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	// backend connection of insert doesn't know the generated sequence value
+	se := &sessionExecutor{insertID: 0}
+	sql := "insert into tbl_ks (id, a) values (3, 'a'), (3, 'b')"
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	p, err := BuildPlan(stmt, ns.phyDBs, "db_ks", sql, ns.rt, ns.seqs, nil)
+	if err != nil {
+		t.Fatalf("BuildPlan error: %v", err)
+	}
+	r, err := p.ExecuteIn(util.NewRequestContext(), se)
+	if err != nil {
+		t.Fatalf("ExecuteIn error: %v", err)
+	}
+	if r.InsertID != 1 || se.GetLastInsertID() != 1 {
+		t.Fatalf("insert id not equal, expect: 1, result: %d, session: %d", r.InsertID, se.GetLastInsertID())
+	}
+
+	// later select is answered by session on any connection
+	sql = "select last_insert_id()"
+	stmt, err = parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	p, err = BuildPlan(stmt, ns.phyDBs, "db_ks", sql, ns.rt, ns.seqs, nil)
+	if err != nil {
+		t.Fatalf("BuildPlan error: %v", err)
+	}
+	r, err = p.ExecuteIn(util.NewRequestContext(), se)
+	if err != nil {
+		t.Fatalf("ExecuteIn error: %v", err)
+	}
+	if r.Values[0][0] != uint64(1) {
+		t.Fatalf("last_insert_id() not equal, expect: 1, actual: %v", r.Values[0][0])
+	}
+
+	// insert without generated value keeps insert id returned by backend
+	se.insertID = 100
+	sql = "insert into tbl_ks (id, user_id, a) values (3, 100, 'a')"
+	stmt, err = parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	p, err = BuildPlan(stmt, ns.phyDBs, "db_ks", sql, ns.rt, ns.seqs, nil)
+	if err != nil {
+		t.Fatalf("BuildPlan error: %v", err)
+	}
+	if _, err = p.ExecuteIn(util.NewRequestContext(), se); err != nil {
+		t.Fatalf("ExecuteIn error: %v", err)
+	}
+	if se.GetLastInsertID() != 100 {
+		t.Fatalf("last insert id not equal, expect: 100, actual: %d", se.GetLastInsertID())
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/format"
+	"github.com/XiaoMi/Gaea/parser/model"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// OSCPlan is the plan for statements of online schema change tools like gh-ost and pt-osc,
+// such as creating and altering auxiliary table, copying rows and the final RENAME.
+// The statement is executed on every physical table of the original sharding table.
+type OSCPlan struct {
+	basePlan
+
+	sqls map[string]map[string][]string
+}
+
+// oscTableCollector collect table names and qualified column names in statement
+type oscTableCollector struct {
+	tableNames  []*ast.TableName
+	columnNames []*ast.ColumnName
+}
+
+// Enter for node visit
+func (c *oscTableCollector) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch nn := n.(type) {
+	case *ast.TableName:
+		c.tableNames = append(c.tableNames, nn)
+	case *ast.ColumnName:
+		if nn.Table.L != "" {
+			c.columnNames = append(c.columnNames, nn)
+		}
+	}
+	return n, false
+}
+
+// Leave for node visit
+func (c *oscTableCollector) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+// IsOSCStmt check if statement is executed by online schema change tools on auxiliary tables,
+// only ddl and INSERT ... SELECT with auxiliary tables are handled as online schema change.
+func IsOSCStmt(stmt ast.StmtNode, db string, r *router.Router) bool {
+	if !r.IsOSCCompatible() {
+		return false
+	}
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt, *ast.AlterTableStmt, *ast.DropTableStmt, *ast.RenameTableStmt:
+	case *ast.InsertStmt:
+		if s.Select == nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	c := &oscTableCollector{}
+	stmt.Accept(c)
+	for _, t := range c.tableNames {
+		if r.IsOSCTable(getOSCTableDB(t, db), t.Name.L) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateOSCPlan create OSCPlan, all tables in statement should be the original sharding table or its auxiliary tables
+func CreateOSCPlan(stmt ast.StmtNode, db string, r *router.Router) (*OSCPlan, error) {
+	c := &oscTableCollector{}
+	stmt.Accept(c)
+
+	var baseDB, baseTable string
+	rules := make([]router.Rule, len(c.tableNames))
+	for i, t := range c.tableNames {
+		tdb := getOSCTableDB(t, db)
+		rule, ok := r.GetShardRule(tdb, t.Name.L)
+		if !ok {
+			return nil, fmt.Errorf("table %s.%s is not sharding table or its auxiliary table", tdb, t.Name.O)
+		}
+		base := r.GetOSCBaseTable(tdb, t.Name.L)
+		if i == 0 {
+			baseDB, baseTable = tdb, base
+		} else if tdb != baseDB || base != baseTable {
+			return nil, fmt.Errorf("tables of online schema change should be %s.%s or its auxiliary tables, but got %s.%s", baseDB, baseTable, tdb, t.Name.O)
+		}
+		rules[i] = rule
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no table found in online schema change statement")
+	}
+
+	// restore table names after sqls are generated, the statement may be used by others
+	tableNames := make([]model.CIStr, len(c.tableNames))
+	schemas := make([]model.CIStr, len(c.tableNames))
+	for i, t := range c.tableNames {
+		tableNames[i], schemas[i] = t.Name, t.Schema
+	}
+	columnTables := make([]model.CIStr, len(c.columnNames))
+	for i, col := range c.columnNames {
+		columnTables[i] = col.Table
+	}
+	defer func() {
+		for i, t := range c.tableNames {
+			t.Name, t.Schema = tableNames[i], schemas[i]
+		}
+		for i, col := range c.columnNames {
+			col.Table = columnTables[i]
+		}
+	}()
+
+	rule := rules[0]
+	sqls := make(map[string]map[string][]string)
+	for _, index := range rule.GetSubTableIndexes() {
+		phyNames := make(map[string]model.CIStr, len(c.tableNames))
+		for i, t := range c.tableNames {
+			name, schema, err := getOSCPhysicalTable(rules[i], tableNames[i], schemas[i], index)
+			if err != nil {
+				return nil, err
+			}
+			t.Name, t.Schema = name, schema
+			phyNames[tableNames[i].L] = name
+		}
+		for i, col := range c.columnNames {
+			if name, ok := phyNames[columnTables[i].L]; ok {
+				col.Table = name
+			}
+		}
+
+		sb := &strings.Builder{}
+		if err := stmt.Restore(format.NewRestoreCtx(format.EscapeRestoreFlags, sb)); err != nil {
+			return nil, fmt.Errorf("generate online schema change sql error: %v", err)
+		}
+		sliceName := rule.GetSlice(rule.GetSliceIndexFromTableIndex(index))
+		dbName, err := rule.GetDatabaseNameByTableIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		if sqls[sliceName] == nil {
+			sqls[sliceName] = make(map[string][]string)
+		}
+		sqls[sliceName][dbName] = append(sqls[sliceName][dbName], sb.String())
+	}
+	return &OSCPlan{sqls: sqls}, nil
+}
+
+// getOSCPhysicalTable return physical table name and db of table at index, it's the same as TableNameDecorator
+func getOSCPhysicalTable(rule router.Rule, name, schema model.CIStr, index int) (model.CIStr, model.CIStr, error) {
+	ruleType := rule.GetType()
+	if ruleType == router.GlobalTableRuleType || router.IsMycatShardingRule(ruleType) {
+		if schema.O == "" {
+			return name, schema, nil
+		}
+		dbName, err := rule.GetDatabaseNameByTableIndex(index)
+		if err != nil {
+			return name, schema, fmt.Errorf("get database name error: %v", err)
+		}
+		return name, model.NewCIStr(dbName), nil
+	}
+	return model.NewCIStr(fmt.Sprintf("%s_%04d", name.O, index)), schema, nil
+}
+
+func getOSCTableDB(t *ast.TableName, db string) string {
+	if t.Schema.O != "" {
+		return t.Schema.O
+	}
+	return db
+}
+
+// ExecuteIn implement Plan
+func (p *OSCPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	rs, err := se.ExecuteSQLs(reqCtx, p.sqls)
+	if err != nil {
+		return nil, err
+	}
+	return MergeExecResult(rs)
+}
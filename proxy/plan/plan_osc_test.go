@@ -0,0 +1,252 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func prepareOSCPlanInfo(oscCompatible bool) (*PlanInfo, error) {
+	nsStr := `
+{
+    "name": "gaea_namespace_1",
+    "online": true,
+    "read_only": true,
+    "allowed_dbs": {
+        "db_ks": true,
+        "db_mycat": true
+    },
+    "default_phy_dbs": {
+        "db_ks": "db_ks",
+        "db_mycat": "db_mycat_0"
+    },
+    "slices": [
+        {
+            "name": "slice-0",
+            "user_name": "root",
+            "password": "root",
+            "master": "127.0.0.1:3306",
+            "capacity": 64,
+            "max_capacity": 128,
+            "idle_timeout": 3600
+        },
+        {
+            "name": "slice-1",
+            "user_name": "root",
+            "password": "root",
+            "master": "127.0.0.1:3307",
+            "capacity": 64,
+            "max_capacity": 128,
+            "idle_timeout": 3600
+        }
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ks",
+            "type": "mod",
+            "key": "id",
+            "locations": [
+                2,
+                2
+            ],
+            "slices": [
+                "slice-0",
+                "slice-1"
+            ]
+        },
+        {
+            "db": "db_mycat",
+            "table": "tbl_mycat",
+            "type": "mycat_mod",
+            "key": "id",
+            "locations": [
+                2,
+                2
+            ],
+            "slices": [
+                "slice-0",
+                "slice-1"
+            ],
+            "databases": [
+                "db_mycat_[0-3]"
+            ]
+        }
+    ],
+    "users": [
+        {
+            "user_name": "test",
+            "password": "test",
+            "namespace": "gaea_namespace_1",
+            "rw_flag": 2,
+            "rw_split": 1
+        }
+    ],
+    "default_slice": "slice-0"
+}`
+	nsCfg, err := createNamespace(nsStr)
+	if err != nil {
+		return nil, err
+	}
+	nsCfg.OSCCompatible = oscCompatible
+	rt, err := createRouter(nsCfg)
+	if err != nil {
+		return nil, err
+	}
+	seqs, err := createSequenceManager(nsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &PlanInfo{
+		phyDBs: nsCfg.DefaultPhyDBS,
+		rt:     rt,
+		seqs:   seqs,
+	}, nil
+}
+
+func TestOSCPlan(t *testing.T) {
+	info, err := prepareOSCPlanInfo(true)
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "create table _tbl_ks_gho like tbl_ks",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"CREATE TABLE `_tbl_ks_gho_0000` LIKE `tbl_ks_0000`", "CREATE TABLE `_tbl_ks_gho_0001` LIKE `tbl_ks_0001`"},
+				},
+				"slice-1": {
+					"db_ks": {"CREATE TABLE `_tbl_ks_gho_0002` LIKE `tbl_ks_0002`", "CREATE TABLE `_tbl_ks_gho_0003` LIKE `tbl_ks_0003`"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "alter table db_ks._tbl_ks_gho add column c int",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"ALTER TABLE `db_ks`.`_tbl_ks_gho_0000` ADD COLUMN `c` INT", "ALTER TABLE `db_ks`.`_tbl_ks_gho_0001` ADD COLUMN `c` INT"},
+				},
+				"slice-1": {
+					"db_ks": {"ALTER TABLE `db_ks`.`_tbl_ks_gho_0002` ADD COLUMN `c` INT", "ALTER TABLE `db_ks`.`_tbl_ks_gho_0003` ADD COLUMN `c` INT"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "insert ignore into _tbl_ks_new (id, a) select id, tbl_ks.a from tbl_ks where id >= 1 and id <= 100 lock in share mode",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {
+						"INSERT IGNORE INTO `_tbl_ks_new_0000` (`id`,`a`) SELECT `id`,`tbl_ks_0000`.`a` FROM `tbl_ks_0000` WHERE `id`>=1 AND `id`<=100 LOCK IN SHARE MODE",
+						"INSERT IGNORE INTO `_tbl_ks_new_0001` (`id`,`a`) SELECT `id`,`tbl_ks_0001`.`a` FROM `tbl_ks_0001` WHERE `id`>=1 AND `id`<=100 LOCK IN SHARE MODE",
+					},
+				},
+				"slice-1": {
+					"db_ks": {
+						"INSERT IGNORE INTO `_tbl_ks_new_0002` (`id`,`a`) SELECT `id`,`tbl_ks_0002`.`a` FROM `tbl_ks_0002` WHERE `id`>=1 AND `id`<=100 LOCK IN SHARE MODE",
+						"INSERT IGNORE INTO `_tbl_ks_new_0003` (`id`,`a`) SELECT `id`,`tbl_ks_0003`.`a` FROM `tbl_ks_0003` WHERE `id`>=1 AND `id`<=100 LOCK IN SHARE MODE",
+					},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "rename table tbl_ks to _tbl_ks_del, _tbl_ks_gho to tbl_ks",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {
+						"RENAME TABLE `tbl_ks_0000` TO `_tbl_ks_del_0000`, `_tbl_ks_gho_0000` TO `tbl_ks_0000`",
+						"RENAME TABLE `tbl_ks_0001` TO `_tbl_ks_del_0001`, `_tbl_ks_gho_0001` TO `tbl_ks_0001`",
+					},
+				},
+				"slice-1": {
+					"db_ks": {
+						"RENAME TABLE `tbl_ks_0002` TO `_tbl_ks_del_0002`, `_tbl_ks_gho_0002` TO `tbl_ks_0002`",
+						"RENAME TABLE `tbl_ks_0003` TO `_tbl_ks_del_0003`, `_tbl_ks_gho_0003` TO `tbl_ks_0003`",
+					},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "drop table if exists db_mycat._tbl_mycat_old",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"DROP TABLE IF EXISTS `db_mycat_0`.`_tbl_mycat_old`"},
+					"db_mycat_1": {"DROP TABLE IF EXISTS `db_mycat_1`.`_tbl_mycat_old`"},
+				},
+				"slice-1": {
+					"db_mycat_2": {"DROP TABLE IF EXISTS `db_mycat_2`.`_tbl_mycat_old`"},
+					"db_mycat_3": {"DROP TABLE IF EXISTS `db_mycat_3`.`_tbl_mycat_old`"},
+				},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "insert into _tbl_ks_gho select * from tbl_unshard",
+			hasErr: true,
+		},
+		{
+			db:     "db_ks",
+			sql:    "rename table db_mycat.tbl_mycat to db_mycat._tbl_mycat_del, _tbl_ks_gho to tbl_ks",
+			hasErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			if err != nil {
+				t.Fatalf("parse sql error: %v", err)
+			}
+			p, err := BuildPlan(stmt, info.phyDBs, test.db, test.sql, info.rt, info.seqs, nil)
+			if test.hasErr {
+				if err == nil {
+					t.Errorf("BuildPlan should fail, sql: %s", test.sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan error, sql: %s, err: %v", test.sql, err)
+			}
+			oscPlan, ok := p.(*OSCPlan)
+			if !ok {
+				t.Fatalf("plan should be OSCPlan, got %T", p)
+			}
+			if !checkSQLs(test.sqls, oscPlan.sqls) {
+				t.Errorf("not equal, expect: %v, actual: %v", test.sqls, oscPlan.sqls)
+			}
+		})
+	}
+}
+
+func TestOSCPlanDisabled(t *testing.T) {
+	info, err := prepareOSCPlanInfo(false)
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	stmt, err := parser.ParseSQL("create table _tbl_ks_gho like tbl_ks")
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	if IsOSCStmt(stmt, "db_ks", info.rt) {
+		t.Errorf("statement should not be handled as online schema change when osc_compatible is off")
+	}
+}
@@ -43,7 +43,8 @@ type SelectPlan struct {
 	offset int64 // LIMIT offset
 	count  int64 // LIMIT count, 未设置则为-1
 
-	sqls map[string]map[string][]string
+	sqls      map[string]map[string][]string
+	countSQLs map[string]map[string][]string // SQL_CALC_FOUND_ROWS 时统计总行数的SQL
 }
 
 // NewSelectPlan constructor of SelectPlan
@@ -68,6 +69,9 @@ func (s *SelectPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 		r := newEmptyResultset(s, s.GetStmt())
 		ret := mysql.ResultPool.Get()
 		ret.Resultset = r
+		if s.countSQLs != nil {
+			sess.SetFoundRows(0)
+		}
 		return ret, nil
 	}
 
@@ -75,6 +79,11 @@ func (s *SelectPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 	if err != nil {
 		return nil, fmt.Errorf("execute in SelectPlan error: %v", err)
 	}
+	if s.countSQLs != nil {
+		if err := executeFoundRowsCount(reqCtx, sess, s.countSQLs); err != nil {
+			return nil, err
+		}
+	}
 	// fix: 修复全局表或分片表 order by/group by等情况下单分片执行时多一列的问题, 修复由于 limit offset 语句改写导致结果行数不正确问题
 	if s.isExecOnSingleNode() && s.noAddColumns() && !s.HasLimit() {
 		return rs[0], nil
@@ -164,6 +173,9 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 
 	p.distinct = stmt.Distinct
 
+	// check before nodes are replaced by decorators
+	windowFunc := hasWindowFunc(stmt)
+
 	if err := handleTableRefs(p, stmt); err != nil {
 		return fmt.Errorf("handle From error: %v", err)
 	}
@@ -224,6 +236,22 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 		return fmt.Errorf("post handle global table error: %v", err)
 	}
 
+	// window function is calculated in each shard, the merged result is wrong
+	if !p.isExecOnSingleNode() && windowFunc {
+		return fmt.Errorf("window function does not support multiple shards")
+	}
+
+	if isCalcFoundRows(stmt) {
+		if !p.isExecOnSingleNode() && needDerivedFoundRowsCount(stmt) {
+			return fmt.Errorf("SQL_CALC_FOUND_ROWS with GROUP BY, DISTINCT or HAVING does not support multiple shards")
+		}
+		countSQLs, err := generateShardingSQLs(createFoundRowsCountStmt(p.stmt), p.result, p.router)
+		if err != nil {
+			return fmt.Errorf("generate found rows count SQL error: %v", err)
+		}
+		p.countSQLs = countSQLs
+	}
+
 	sqls, err := generateShardingSQLs(p.stmt, p.result, p.router)
 	if err != nil {
 		return fmt.Errorf("generate select SQL error: %v", err)
@@ -234,6 +262,31 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 	return nil
 }
 
+// windowFuncChecker check if there is window function in stmt
+type windowFuncChecker struct {
+	hasWindowFunc bool
+}
+
+// Enter implement ast.Visitor
+func (c *windowFuncChecker) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*ast.WindowFuncExpr); ok {
+		c.hasWindowFunc = true
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (c *windowFuncChecker) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+func hasWindowFunc(stmt *ast.SelectStmt) bool {
+	c := &windowFuncChecker{}
+	stmt.Accept(c)
+	return c.hasWindowFunc
+}
+
 // 处理GroupBy, 把GroupBy的列补到FieldList中, 然后把GroupBy去掉
 func handleGroupBy(p *SelectPlan, stmt *ast.SelectStmt) error {
 	if stmt.GroupBy == nil {
@@ -776,6 +829,18 @@ func handleBinaryOperationExprMathCompare(p *TableAliasStmtInfo, expr *ast.Binar
 		return handleBinaryOperationExprCompareLeftColumnRightColumn(p, expr)
 	}
 
+	// handle date function of column: SELECT * from tbl where DATE(create_time) = '2014-09-05'
+	if lType == FuncCallExpr && rType == ValueExpr {
+		if f := expr.L.(*ast.FuncCallExpr); getDateFuncColumn(f) != nil {
+			return handleBinaryOperationExprCompareDateFuncValue(p, expr, f, expr.R.(*driver.ValueExpr), getFindTableIndexesFunc(expr.Op))
+		}
+	}
+	if rType == FuncCallExpr && lType == ValueExpr {
+		if f := expr.R.(*ast.FuncCallExpr); getDateFuncColumn(f) != nil {
+			return handleBinaryOperationExprCompareDateFuncValue(p, expr, f, expr.L.(*driver.ValueExpr), getFindTableIndexesFunc(inverseOperator(expr.Op)))
+		}
+	}
+
 	if lType == ColumnNameExpr {
 		if rType == ValueExpr {
 			return handleBinaryOperationExprCompareLeftColumnRightValue(p, expr, getFindTableIndexesFunc(expr.Op))
@@ -857,6 +922,35 @@ func getDatabaseFuncHint(f *ast.FuncCallExpr, v ast.ExprNode) (string, error) {
 	}
 }
 
+// 日期分表中可以根据结果计算路由的时间函数, value表示函数结果是否为日期字符串, 否则为unix时间戳
+var dateShardingFuncs = map[string]bool{
+	"date":           true,
+	"timestamp":      true,
+	"from_unixtime":  true,
+	"unix_timestamp": false,
+}
+
+// getDateFuncColumn return the column argument of date function such as DATE(create_time), or nil if f is not
+func getDateFuncColumn(f *ast.FuncCallExpr) *ast.ColumnNameExpr {
+	if _, ok := dateShardingFuncs[f.FnName.L]; !ok || len(f.Args) != 1 {
+		return nil
+	}
+	column, _ := f.Args[0].(*ast.ColumnNameExpr)
+	return column
+}
+
+// isDateFuncValueMatch check if the type of value matches the result of date function
+func isDateFuncValueMatch(f *ast.FuncCallExpr, v interface{}) bool {
+	switch v.(type) {
+	case string:
+		return dateShardingFuncs[f.FnName.L]
+	case int64, uint64:
+		return !dateShardingFuncs[f.FnName.L]
+	default:
+		return false
+	}
+}
+
 // 返回一个根据路由信息和路由值获取路由结果的函数
 // 左边为列名, 右边为参数
 func getFindTableIndexesFunc(op opcode.Op) func(rule router.Rule, columnName string, v interface{}) ([]int, error) {
@@ -1011,6 +1105,40 @@ func handleBinaryOperationExprCompareLeftValueRightColumn(p *TableAliasStmtInfo,
 	return true, tableIndexes, expr, nil
 }
 
+// 处理时间函数与值的比较, 替换函数参数中的列名
+// 如果是日期分表的分表列, 函数结果与列值落在同一个分片, 可以直接用比较的值计算路由
+func handleBinaryOperationExprCompareDateFuncValue(p *TableAliasStmtInfo, expr *ast.BinaryOperationExpr, f *ast.FuncCallExpr, valueExpr *driver.ValueExpr, findTableIndexes func(router.Rule, string, interface{}) ([]int, error)) (bool, []int, ast.ExprNode, error) {
+	column := getDateFuncColumn(f)
+	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, column)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in FuncCallExpr: %v", err)
+	}
+	if !need {
+		return false, nil, expr, nil
+	}
+
+	f.Args[0] = CreateColumnNameExprDecorator(column, rule, isAlias, p.GetRouteResult())
+
+	if !router.IsDateShardingRule(rule.GetType()) {
+		return false, nil, expr, nil
+	}
+
+	v, err := util.GetValueExprResult(valueExpr)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("get ValueExpr value error: %v", err)
+	}
+	if !isDateFuncValueMatch(f, v) {
+		return false, nil, expr, nil
+	}
+
+	tableIndexes, err := findTableIndexes(rule, column.Name.Name.L, v)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("find table index error: %v", err)
+	}
+
+	return true, tableIndexes, expr, nil
+}
+
 func mergeBinaryOperationRouteResult(op opcode.Op, lHas bool, lResult []int, rHas bool, rResult []int) (bool, []int) {
 	switch op {
 	case opcode.LogicAnd:
@@ -17,7 +17,9 @@ package plan
 import (
 	"testing"
 
+	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
 )
 
 func TestSimpleSelectShardMycatMod(t *testing.T) {
@@ -835,6 +837,42 @@ func TestSelectColumnCaseInsensitive(t *testing.T) {
 	}
 }
 
+func TestSelectCrossDB(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select * from db_mycat.tbl_mycat where id = 0",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT * FROM `db_mycat_0`.`tbl_mycat` WHERE `id`=0"},
+				},
+			},
+		},
+		{
+			db:  "",
+			sql: "select * from db_ks.tbl_ks where id = 1",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"SELECT * FROM `db_ks`.`tbl_ks_0001` WHERE `id`=1"},
+				},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "select * from db_ks.tbl_ks a join db_mycat.tbl_mycat b on a.id = b.id where a.id = 1", // tables have different route
+			hasErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
+
 func TestSelectTableNameCaseInsensitive(t *testing.T) {
 	ns, err := preparePlanInfo()
 	if err != nil {
@@ -2065,6 +2103,83 @@ func TestMycatSelectLimit(t *testing.T) {
 	}
 }
 
+func TestMycatSelectCalcFoundRows(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sql       string
+		sqls      map[string]map[string][]string
+		countSQLs map[string]map[string][]string
+		foundRows uint64
+		hasErr    bool
+	}{
+		{
+			sql: "select SQL_CALC_FOUND_ROWS id, user from tbl_mycat where id in (0, 2) order by id limit 10, 10",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_mycat_0": {"SELECT `id`,`user` FROM `tbl_mycat` WHERE `id` IN (0) ORDER BY `id` LIMIT 20"}},
+				"slice-1": {"db_mycat_2": {"SELECT `id`,`user` FROM `tbl_mycat` WHERE `id` IN (2) ORDER BY `id` LIMIT 20"}},
+			},
+			countSQLs: map[string]map[string][]string{
+				"slice-0": {"db_mycat_0": {"SELECT COUNT(1) FROM `tbl_mycat` WHERE `id` IN (0)"}},
+				"slice-1": {"db_mycat_2": {"SELECT COUNT(1) FROM `tbl_mycat` WHERE `id` IN (2)"}},
+			},
+			foundRows: 10,
+		},
+		{
+			// rows of group by in single shard are counted as derived table
+			sql: "select SQL_CALC_FOUND_ROWS age, count(*) from tbl_mycat where id = 1 group by age limit 10",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_mycat_1": {"SELECT `age`,COUNT(1) FROM `tbl_mycat` WHERE `id`=1 GROUP BY `age` LIMIT 10"}},
+			},
+			countSQLs: map[string]map[string][]string{
+				"slice-0": {"db_mycat_1": {"SELECT COUNT(1) FROM (SELECT `age`,COUNT(1) FROM (`tbl_mycat`) WHERE `id`=1 GROUP BY `age`) AS `gaea_found_rows`"}},
+			},
+			foundRows: 5,
+		},
+		{
+			sql:    "select SQL_CALC_FOUND_ROWS age from tbl_mycat group by age limit 10",
+			hasErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			if err != nil {
+				t.Fatalf("parse sql error: %v", err)
+			}
+			p, err := BuildPlan(stmt, ns.phyDBs, "db_mycat", test.sql, ns.rt, ns.seqs, nil)
+			if test.hasErr {
+				if err == nil {
+					t.Fatalf("expect error, sql: %s", test.sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan error: %v", err)
+			}
+			sp := p.(*SelectPlan)
+			if !checkSQLs(test.sqls, sp.sqls) {
+				t.Errorf("sqls not equal, expect: %v, actual: %v", test.sqls, sp.sqls)
+			}
+			if !checkSQLs(test.countSQLs, sp.countSQLs) {
+				t.Errorf("count sqls not equal, expect: %v, actual: %v", test.countSQLs, sp.countSQLs)
+			}
+
+			se := &sessionExecutor{count: 5}
+			if _, err := sp.ExecuteIn(util.NewRequestContext(), se); err != nil {
+				t.Fatalf("ExecuteIn error: %v", err)
+			}
+			if se.foundRows != test.foundRows {
+				t.Errorf("found rows not equal, expect: %d, actual: %d", test.foundRows, se.foundRows)
+			}
+		})
+	}
+}
+
 func TestSelectMycatMultiTablesDatabaseHint(t *testing.T) {
 	ns, err := preparePlanInfo()
 	if err != nil {
@@ -3913,3 +4028,223 @@ func prepareShardKingshardRouter() (*router.Router, error) {
 
 	return createRouter(nsModel)
 }
+
+func TestJSONPath(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select data->'$.name', tbl_ks.data->>'$.tags[0]', data->>'$.\"it''s\"' from tbl_ks where id = 1 and data->>'$.name' = 'a'",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"SELECT JSON_EXTRACT(`data`, '$.name'),JSON_UNQUOTE(JSON_EXTRACT(`tbl_ks_0001`.`data`, '$.tags[0]')),JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.\"it''s\"')) FROM `tbl_ks_0001` WHERE `id`=1 AND JSON_UNQUOTE(JSON_EXTRACT(`data`, '$.name'))='a'"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "update tbl_ks set data = json_set(data, '$.name', 'b') where id = 1",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"UPDATE `tbl_ks_0001` SET `data`=JSON_SET(`data`, '$.name', 'b') WHERE `id`=1"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "insert into tbl_ks (id, data) values (1, '{\"name\": \"a\\\\\"b\"}')",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"INSERT INTO `tbl_ks_0001` (`id`,`data`,`user_id`) VALUES (1,'{\"name\": \"a\\\\\"b\"}',1)"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
+
+func TestSelectWindowFunction(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select id, row_number() over (partition by name order by id desc) as rn, rank() over w from tbl_ks where id = 1 window w as (order by id)",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"SELECT `id`,ROW_NUMBER() OVER (PARTITION BY `name` ORDER BY `id` DESC) AS `rn`,RANK() OVER (`w`) FROM `tbl_ks_0001` WHERE `id`=1 WINDOW `w` AS (ORDER BY `id`)"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select id, sum(id) over (order by id) from tbl_ks_global_one",
+			randomSqls: []map[string]map[string][]string{
+				{
+					"slice-0": {
+						"db_ks": {"SELECT `id`,SUM(`id`) OVER (ORDER BY `id`) FROM `tbl_ks_global_one`"},
+					},
+				},
+				{
+					"slice-1": {
+						"db_ks": {"SELECT `id`,SUM(`id`) OVER (ORDER BY `id`) FROM `tbl_ks_global_one`"},
+					},
+				},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "select id, row_number() over (order by id) from tbl_ks where id in (1, 2)",
+			hasErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
+
+func TestSelectCommonTableExpression(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "with cte as (select * from tbl_unshard where id > 1) select * from cte",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"WITH `cte` AS (SELECT * FROM `tbl_unshard` WHERE `id`>1) SELECT * FROM `cte`"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "with tbl_ks (id) as (select 1) select * from tbl_ks",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"WITH `tbl_ks` (`id`) AS (SELECT 1) SELECT * FROM `tbl_ks`"},
+				},
+			},
+		},
+		{
+			db:  "",
+			sql: "with recursive cte (n) as (select 1 union all select n + 1 from cte where n < 5) select n from cte",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"": {"WITH RECURSIVE `cte` (`n`) AS (SELECT 1 UNION ALL SELECT `n`+1 FROM `cte` WHERE `n`<5) SELECT `n` FROM `cte`"},
+				},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "with cte as (select * from tbl_ks) select * from cte where id = 1",
+			hasErr: true,
+		},
+		{
+			db:     "db_ks",
+			sql:    "with cte as (select id from tbl_unshard) select id from cte union select id from tbl_ks",
+			hasErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
+
+func TestSelectKingshardDateFunction(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_day where DATE(create_time) = '2014-09-05'",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"SELECT * FROM `tbl_ks_day_20140905` WHERE DATE(`create_time`)='2014-09-05'"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_day where date(tbl_ks_day.create_time) >= '2014-09-07'",
+			sqls: map[string]map[string][]string{
+				"slice-1": {
+					"db_ks": {
+						"SELECT * FROM `tbl_ks_day_20140907` WHERE DATE(`tbl_ks_day_20140907`.`create_time`)>='2014-09-07'",
+						"SELECT * FROM `tbl_ks_day_20140908` WHERE DATE(`tbl_ks_day_20140908`.`create_time`)>='2014-09-07'",
+					},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_day as a where '2014-09-03' > date(a.create_time)",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {
+						"SELECT * FROM `tbl_ks_day_20140901` AS `a` WHERE '2014-09-03'>DATE(`a`.`create_time`)",
+						"SELECT * FROM `tbl_ks_day_20140902` AS `a` WHERE '2014-09-03'>DATE(`a`.`create_time`)",
+					},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_day where unix_timestamp(create_time) between 1409846400 and 1410019200", // 2014/09/05 - 2014/09/07
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {"SELECT * FROM `tbl_ks_day_20140905` WHERE UNIX_TIMESTAMP(`create_time`) BETWEEN 1409846400 AND 1410019200"},
+				},
+				"slice-1": {
+					"db_ks": {"SELECT * FROM `tbl_ks_day_20140907` WHERE UNIX_TIMESTAMP(`create_time`) BETWEEN 1409846400 AND 1410019200"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_month where from_unixtime(create_time) = '2014-08-15 12:00:00'",
+			sqls: map[string]map[string][]string{
+				"slice-1": {
+					"db_ks": {"SELECT * FROM `tbl_ks_month_201408` WHERE FROM_UNIXTIME(`create_time`)='2014-08-15 12:00:00'"},
+				},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks_year where date(create_time) = 20150101", // not a date string, route to all tables
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_ks": {
+						"SELECT * FROM `tbl_ks_year_2014` WHERE DATE(`create_time`)=20150101",
+						"SELECT * FROM `tbl_ks_year_2015` WHERE DATE(`create_time`)=20150101",
+						"SELECT * FROM `tbl_ks_year_2016` WHERE DATE(`create_time`)=20150101",
+						"SELECT * FROM `tbl_ks_year_2017` WHERE DATE(`create_time`)=20150101",
+					},
+				},
+				"slice-1": {
+					"db_ks": {
+						"SELECT * FROM `tbl_ks_year_2018` WHERE DATE(`create_time`)=20150101",
+						"SELECT * FROM `tbl_ks_year_2019` WHERE DATE(`create_time`)=20150101",
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
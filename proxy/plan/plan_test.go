@@ -17,6 +17,7 @@ package plan
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"sync/atomic"
 	"testing"
 
@@ -126,6 +127,29 @@ func getTestFunc(info *PlanInfo, test SQLTestcase) func(t *testing.T) {
 		}
 	}
 }
+func TestGetStmtTables(t *testing.T) {
+	tests := []struct {
+		db     string
+		sql    string
+		tables []string
+	}{
+		{"db_ks", "select * from tbl_ks a join db_mycat.tbl_mycat b on a.id = b.id where a.id in (select id from tbl_ks)", []string{"db_ks.tbl_ks", "db_mycat.tbl_mycat"}},
+		{"db_ks", "insert into tbl_ks(id) select id from tbl_unshard", []string{"db_ks.tbl_unshard", "db_ks.tbl_ks"}},
+		{"db_ks", "update TBL_KS set a = 1 where id = 1", []string{"db_ks.tbl_ks"}},
+		{"db_ks", "with t as (select id from tbl_ks) select * from t", []string{"db_ks.tbl_ks"}},
+		{"db_ks", "select 1", nil},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatalf("parse sql error: %v", err)
+		}
+		if actual := GetStmtTables(stmt, test.db); !reflect.DeepEqual(test.tables, actual) {
+			t.Errorf("sql: %s, expect: %v, actual: %v", test.sql, test.tables, actual)
+		}
+	}
+}
+
 func TestCheckRandomSQLs(t *testing.T) {
 	randomSqlsFirst := []map[string]map[string][]string{
 		{
@@ -23,6 +23,7 @@ import (
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/parser/ast"
 	"github.com/XiaoMi/Gaea/parser/format"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
 	"github.com/XiaoMi/Gaea/util"
 )
 
@@ -30,10 +31,12 @@ import (
 type UnshardPlan struct {
 	basePlan
 
-	db     string
-	phyDBs map[string]string
-	sql    string
-	stmt   ast.StmtNode
+	db        string
+	phyDBs    map[string]string
+	sql       string
+	stmt      ast.StmtNode
+	rewritten bool   // db names of tables in sql are replaced by physical db names
+	countSQL  string // counts rows of select with SQL_CALC_FOUND_ROWS
 }
 
 // SelectLastInsertIDPlan is the plan for SELECT LAST_INSERT_ID()
@@ -43,7 +46,17 @@ type UnshardPlan struct {
 // to a non-“magic” value (that is, a value that is not NULL and not 0).
 type SelectLastInsertIDPlan struct {
 	basePlan
-	asName string
+	name string
+	// LAST_INSERT_ID(N) with integer constant N sets last insert id of session to N
+	setID bool
+	value uint64
+}
+
+// SelectFoundRowsPlan is the plan for SELECT FOUND_ROWS() and SELECT ROW_COUNT()
+type SelectFoundRowsPlan struct {
+	basePlan
+	name     string
+	rowCount bool // ROW_COUNT() if true, otherwise FOUND_ROWS()
 }
 
 type SetPlan struct {
@@ -56,27 +69,87 @@ type IgnorePlan struct {
 	basePlan
 }
 
-// IsSelectLastInsertIDStmt check if the statement is SELECT LAST_INSERT_ID()
+// IsSelectLastInsertIDStmt check if the statement is SELECT LAST_INSERT_ID(), SELECT LAST_INSERT_ID(N)
+// with integer constant N, SELECT @@IDENTITY or SELECT @@LAST_INSERT_ID, they are answered by proxy since
+// the insert may be executed by another backend connection
 func IsSelectLastInsertIDStmt(stmt ast.StmtNode) bool {
-	s, ok := stmt.(*ast.SelectStmt)
+	expr, ok := getSingleFieldExpr(stmt)
 	if !ok {
 		return false
 	}
 
-	if len(s.Fields.Fields) != 1 {
+	switch x := expr.(type) {
+	case *ast.FuncCallExpr:
+		if x.FnName.L != "last_insert_id" {
+			return false
+		}
+		if len(x.Args) == 0 {
+			return true
+		}
+		_, ok := getLastInsertIDArg(x)
+		return ok
+	case *ast.VariableExpr:
+		return isLastInsertIDVariable(x)
+	}
+	return false
+}
+
+// IsSelectFoundRowsStmt check if the statement is SELECT FOUND_ROWS() or SELECT ROW_COUNT(), they are answered
+// by proxy since the previous statement may be executed by another backend connection or by multiple slices
+func IsSelectFoundRowsStmt(stmt ast.StmtNode) bool {
+	expr, ok := getSingleFieldExpr(stmt)
+	if !ok {
+		return false
+	}
+	f, ok := expr.(*ast.FuncCallExpr)
+	if !ok || len(f.Args) != 0 {
 		return false
 	}
+	return f.FnName.L == "found_rows" || f.FnName.L == "row_count"
+}
+
+// getSingleFieldExpr return expr of select which has only one field and no other clauses
+func getSingleFieldExpr(stmt ast.StmtNode) (ast.ExprNode, bool) {
+	s, ok := stmt.(*ast.SelectStmt)
+	if !ok {
+		return nil, false
+	}
+
+	if s.Fields == nil || len(s.Fields.Fields) != 1 {
+		return nil, false
+	}
 
 	if s.From != nil || s.Where != nil || s.GroupBy != nil || s.Having != nil || s.OrderBy != nil || s.Limit != nil {
-		return false
+		return nil, false
 	}
+	return s.Fields.Fields[0].Expr, true
+}
 
-	f, ok := s.Fields.Fields[0].Expr.(*ast.FuncCallExpr)
+// getLastInsertIDArg return N of LAST_INSERT_ID(N), only integer constant is supported,
+// other expressions are evaluated by backend
+func getLastInsertIDArg(f *ast.FuncCallExpr) (uint64, bool) {
+	if len(f.Args) != 1 {
+		return 0, false
+	}
+	v, ok := f.Args[0].(*driver.ValueExpr)
 	if !ok {
-		return false
+		return 0, false
+	}
+	switch n := v.GetValue().(type) {
+	case int64:
+		return uint64(n), true
+	case uint64:
+		return n, true
 	}
+	return 0, false
+}
 
-	return f.FnName.L == "last_insert_id"
+func isLastInsertIDVariable(v *ast.VariableExpr) bool {
+	if !v.IsSystem || v.IsGlobal {
+		return false
+	}
+	name := strings.ToLower(v.Name)
+	return name == "identity" || name == "last_insert_id"
 }
 
 // IsSetStmt check if the statement is set comment
@@ -96,12 +169,15 @@ func CreateUnshardPlan(stmt ast.StmtNode, phyDBs map[string]string, db string, t
 		phyDBs: phyDBs,
 		stmt:   stmt,
 	}
-	rewriteUnshardTableName(phyDBs, tableNames)
+	p.rewritten = rewriteUnshardTableName(phyDBs, tableNames)
 	rsql, err := generateUnshardingSQL(stmt)
 	if err != nil {
 		return nil, fmt.Errorf("generate unshardPlan SQL error: %v", err)
 	}
 	p.sql = rsql
+	if s, ok := stmt.(*ast.SelectStmt); ok && isCalcFoundRows(s) {
+		p.countSQL, _ = generateUnshardingSQL(createFoundRowsCountStmt(s))
+	}
 	return p, nil
 }
 
@@ -122,13 +198,19 @@ func PreCreateUnshardPlan(sql string, phyDBs map[string]string, db string) (*Uns
 	}, nil
 }
 
-func rewriteUnshardTableName(phyDBs map[string]string, tableNames []*ast.TableName) {
+// rewriteUnshardTableName replace db names of tables by physical db names, return true if any is changed
+func rewriteUnshardTableName(phyDBs map[string]string, tableNames []*ast.TableName) bool {
+	rewritten := false
 	for _, tableName := range tableNames {
 		if phyDB, ok := phyDBs[tableName.Schema.String()]; ok {
+			if tableName.Schema.O != phyDB {
+				rewritten = true
+			}
 			tableName.Schema.O = phyDB
 			tableName.Schema.L = strings.ToLower(phyDB)
 		}
 	}
+	return rewritten
 }
 
 func generateUnshardingSQL(stmt ast.StmtNode) (string, error) {
@@ -138,13 +220,61 @@ func generateUnshardingSQL(stmt ast.StmtNode) (string, error) {
 	return s.String(), nil
 }
 
+// CreateUnshardPlanWithSQL constructor of UnshardPlan whose sql is sent to backend as it is,
+// tables in sql must be known to be unshard and need no rewriting
+func CreateUnshardPlanWithSQL(sql string, phyDBs map[string]string, db string) *UnshardPlan {
+	return &UnshardPlan{
+		db:     db,
+		phyDBs: phyDBs,
+		sql:    sql,
+	}
+}
+
+// IsRewritten check if sql of plan differs from the original sql in table names,
+// plan which is not rewritten can be reused by statements differing only in literals
+func (p *UnshardPlan) IsRewritten() bool {
+	return p.rewritten
+}
+
+// NeedFoundRowsCount check if select has SQL_CALC_FOUND_ROWS, rows are counted by another sql after it
+func (p *UnshardPlan) NeedFoundRowsCount() bool {
+	return p.countSQL != ""
+}
+
 // CreateSelectLastInsertIDPlan constructor of SelectLastInsertIDPlan
 func CreateSelectLastInsertIDPlan(stmt *ast.SelectStmt) *SelectLastInsertIDPlan {
-	asName := ""
-	if len(stmt.Fields.Fields) > 0 && stmt.Fields.Fields[0].AsName.String() != "" {
-		asName = stmt.Fields.Fields[0].AsName.String()
+	p := &SelectLastInsertIDPlan{name: "last_insert_id()"}
+	if len(stmt.Fields.Fields) == 0 {
+		return p
 	}
-	return &SelectLastInsertIDPlan{asName: asName}
+	field := stmt.Fields.Fields[0]
+	switch x := field.Expr.(type) {
+	case *ast.FuncCallExpr:
+		if v, ok := getLastInsertIDArg(x); ok {
+			p.setID, p.value = true, v
+			p.name = fmt.Sprintf("last_insert_id(%d)", v)
+		}
+	case *ast.VariableExpr:
+		p.name = "@@" + x.Name
+	}
+	if field.AsName.String() != "" {
+		p.name = field.AsName.String()
+	}
+	return p
+}
+
+// CreateSelectFoundRowsPlan constructor of SelectFoundRowsPlan
+func CreateSelectFoundRowsPlan(stmt *ast.SelectStmt) *SelectFoundRowsPlan {
+	field := stmt.Fields.Fields[0]
+	f := field.Expr.(*ast.FuncCallExpr)
+	p := &SelectFoundRowsPlan{
+		name:     f.FnName.L + "()",
+		rowCount: f.FnName.L == "row_count",
+	}
+	if field.AsName.String() != "" {
+		p.name = field.AsName.String()
+	}
+	return p
 }
 
 // CreateSetPlan constructor of SetPlan
@@ -170,15 +300,38 @@ func (p *UnshardPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysq
 		se.SetLastInsertID(r.InsertID)
 	}
 
+	if p.countSQL != "" {
+		cr, err := se.ExecuteSQL(reqCtx, reqCtx.GetDefaultSlice(), p.db, p.countSQL)
+		if err != nil {
+			return nil, fmt.Errorf("execute found rows count error: %v", err)
+		}
+		n, err := cr.GetUint(0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("get found rows count error: %v", err)
+		}
+		se.SetFoundRows(n)
+	}
+
 	return r, nil
 }
 
 // ExecuteIn implement Plan
 func (p *SelectLastInsertIDPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
-	r := createLastInsertIDResult(se.GetLastInsertID(), p.asName)
+	if p.setID {
+		se.SetLastInsertID(p.value)
+	}
+	r := createLastInsertIDResult(se.GetLastInsertID(), p.name)
 	return r, nil
 }
 
+// ExecuteIn implement Plan
+func (p *SelectFoundRowsPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	if p.rowCount {
+		return createSingleValueResult(p.name, se.GetRowCount()), nil
+	}
+	return createSingleValueResult(p.name, se.GetFoundRows()), nil
+}
+
 // ExecuteIn implement Plan
 func (p *SetPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
 	if stmt, ok := p.stmt.(*ast.SetStmt); ok {
@@ -193,28 +346,13 @@ func (p *IgnorePlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql
 	return mysql.ResultPool.GetWithoutResultSet(), nil
 }
 
-func createLastInsertIDResult(lastInsertID uint64, asName string) *mysql.Result {
-	name := "last_insert_id()"
-	if asName != "" {
-		name = asName
-	}
-	var column = 1
-	var rows [][]uint64
-	var names = []string{
-		name,
-	}
-
-	rows = append(rows, []uint64{lastInsertID})
-
-	var values = make([][]interface{}, len(rows))
-	for i := range rows {
-		values[i] = make([]interface{}, column)
-		for j := range rows[i] {
-			values[i][j] = rows[i][j]
-		}
-	}
+func createLastInsertIDResult(lastInsertID uint64, name string) *mysql.Result {
+	return createSingleValueResult(name, lastInsertID)
+}
 
-	r, _ := mysql.BuildResultset(nil, names, values)
+// createSingleValueResult create result of one row and one column
+func createSingleValueResult(name string, value interface{}) *mysql.Result {
+	r, _ := mysql.BuildResultset(nil, []string{name}, [][]interface{}{{value}})
 	ret := mysql.ResultPool.Get()
 	ret.Resultset = r
 
@@ -223,9 +361,11 @@ func createLastInsertIDResult(lastInsertID uint64, asName string) *mysql.Result
 
 func CheckUnshardBase(tokenId int, tokens []string, rt *router.Router, db string) (string, bool) {
 	ruleDB := db
+	explicitDB := ""
 	tokensLen := len(tokens)
 	for i := 0; i < tokensLen; i++ {
-		if strings.ToLower(tokens[i]) != mysql.ParseTokenIdStrMap[tokenId] {
+		token := strings.ToLower(tokens[i])
+		if token != mysql.ParseTokenIdStrMap[tokenId] && token != mysql.TkStrJoin {
 			continue
 		}
 		if i+1 >= tokensLen {
@@ -233,9 +373,15 @@ func CheckUnshardBase(tokenId int, tokens []string, rt *router.Router, db string
 		}
 		// select: select col1 from db.t where...
 		// delete: delete from db.t where...
+		// join: select col1 from db1.t1 join db2.t2 on...
 		dbName, tableName := parser.GetDBTable(tokens[i+1])
 		//if the token[i+1] like this: db.test_shard_hash
 		if dbName != "" {
+			// physical db of tables in different dbs are resolved one by one in plan
+			if explicitDB != "" && explicitDB != dbName {
+				return ruleDB, false
+			}
+			explicitDB = dbName
 			ruleDB = dbName
 		}
 		// if table in shard rule, is shard plan
@@ -23,6 +23,7 @@ import (
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/stretchr/testify/assert"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/XiaoMi/Gaea/backend"
@@ -70,6 +71,65 @@ func TestUnshardPlanWithoutDB(t *testing.T) {
 	}
 }
 
+func TestUnshardPlanRewritten(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	tests := []struct {
+		sql       string
+		rewritten bool
+	}{
+		{`select * from tbl_unshard where id = 1`, false},
+		{`select * from tbl_unshard_a as a join db_mycat.tbl_unshard_b as b on a.id = b.id`, true},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		assert.Nil(t, err)
+		p, err := BuildPlan(stmt, ns.phyDBs, "db_mycat", test.sql, ns.rt, ns.seqs, nil)
+		assert.Nil(t, err)
+		up, ok := p.(*UnshardPlan)
+		assert.True(t, ok)
+		assert.Equal(t, test.rewritten, up.IsRewritten(), test.sql)
+	}
+
+	sql := "select * from tbl_unshard where id = 2"
+	p := CreateUnshardPlanWithSQL(sql, ns.phyDBs, "db_mycat")
+	assert.Equal(t, sql, p.sql)
+	assert.Equal(t, "db_mycat", p.db)
+}
+
+func TestUnshardPlanCalcFoundRows(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	tests := []struct {
+		sql      string
+		countSQL string
+	}{
+		{"select SQL_CALC_FOUND_ROWS * from tbl_unshard where id > 1 order by id limit 10, 10", "SELECT COUNT(1) FROM `tbl_unshard` WHERE `id`>1"},
+		{"select SQL_CALC_FOUND_ROWS name from tbl_unshard group by name limit 10", "SELECT COUNT(1) FROM (SELECT `name` FROM (`tbl_unshard`) GROUP BY `name`) AS `gaea_found_rows`"},
+		{"select * from tbl_unshard limit 10", ""},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		assert.Nil(t, err)
+		p, err := BuildPlan(stmt, ns.phyDBs, "db_mycat", test.sql, ns.rt, ns.seqs, nil)
+		assert.Nil(t, err)
+		up := p.(*UnshardPlan)
+		assert.Equal(t, test.countSQL, up.countSQL, test.sql)
+		assert.Equal(t, test.countSQL != "", up.NeedFoundRowsCount())
+
+		se := &sessionExecutor{count: 25}
+		_, err = up.ExecuteIn(util.NewRequestContext(), se)
+		assert.Nil(t, err)
+		if test.countSQL != "" {
+			assert.Equal(t, uint64(25), se.foundRows)
+		}
+	}
+}
+
 func TestSelectInsertID(t *testing.T) {
 	ns, err := preparePlanInfo()
 	if err != nil {
@@ -114,10 +174,154 @@ func (*mockExecutor) GetLastInsertID() uint64 {
 	return 0
 }
 
+func (*mockExecutor) GetFoundRows() uint64 {
+	return 0
+}
+
+func (*mockExecutor) SetFoundRows(uint64) {
+}
+
+func (*mockExecutor) GetRowCount() int64 {
+	return 0
+}
+
 func (*mockExecutor) HandleSet(*util.RequestContext, string, *ast.SetStmt) (*mysql.Result, error) {
 	return mysql.ResultPool.Get(), nil
 }
 
+// sessionExecutor keeps last insert id and found rows like SessionExecutor,
+// backends return insertID for dml, count for COUNT(1) of each shard and no rows for other selects
+type sessionExecutor struct {
+	mockExecutor
+	insertID     uint64
+	count        uint64
+	lastInsertID uint64
+	foundRows    uint64
+	rowCount     int64
+}
+
+func (e *sessionExecutor) ExecuteSQL(ctx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
+	rs, err := e.ExecuteSQLs(ctx, map[string]map[string][]string{slice: {db: {sql}}})
+	if err != nil {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+func (e *sessionExecutor) ExecuteSQLs(ctx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
+	var rs []*mysql.Result
+	for _, dbSQLs := range sqls {
+		for _, ss := range dbSQLs {
+			for _, sql := range ss {
+				if strings.HasPrefix(sql, "SELECT COUNT(1)") {
+					r, err := mysql.BuildResultset(nil, []string{"COUNT(1)"}, [][]interface{}{{e.count}})
+					if err != nil {
+						return nil, err
+					}
+					rs = append(rs, &mysql.Result{Resultset: r})
+					continue
+				}
+				if strings.HasPrefix(sql, "SELECT") {
+					rs = append(rs, &mysql.Result{Resultset: &mysql.Resultset{}})
+					continue
+				}
+				r := mysql.ResultPool.GetWithoutResultSet()
+				r.InsertID = e.insertID
+				rs = append(rs, r)
+			}
+		}
+	}
+	return rs, nil
+}
+
+func (e *sessionExecutor) SetLastInsertID(id uint64) {
+	e.lastInsertID = id
+}
+
+func (e *sessionExecutor) GetLastInsertID() uint64 {
+	return e.lastInsertID
+}
+
+func (e *sessionExecutor) GetFoundRows() uint64 {
+	return e.foundRows
+}
+
+func (e *sessionExecutor) SetFoundRows(n uint64) {
+	e.foundRows = n
+}
+
+func (e *sessionExecutor) GetRowCount() int64 {
+	return e.rowCount
+}
+
+func TestSelectFoundRowsPlan(t *testing.T) {
+	tests := []struct {
+		sql         string
+		isFoundRows bool
+		name        string
+		value       interface{}
+	}{
+		{"select found_rows()", true, "found_rows()", uint64(20)},
+		{"select FOUND_ROWS() as total", true, "total", uint64(20)},
+		{"select row_count()", true, "row_count()", int64(-1)},
+		{"select found_rows() from t", false, "", nil},
+		{"select found_rows(), row_count()", false, "", nil},
+		{"select row_count() + 1", false, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			assert.Nil(t, err)
+			assert.Equal(t, test.isFoundRows, IsSelectFoundRowsStmt(stmt))
+			if !test.isFoundRows {
+				return
+			}
+			p, err := BuildPlan(stmt, map[string]string{}, "test", test.sql, nil, nil, nil)
+			assert.Nil(t, err)
+			r, err := p.ExecuteIn(util.NewRequestContext(), &sessionExecutor{foundRows: 20, rowCount: -1})
+			assert.Nil(t, err)
+			assert.Equal(t, test.name, string(r.Fields[0].Name))
+			assert.Equal(t, test.value, r.Values[0][0])
+		})
+	}
+}
+
+func TestSelectLastInsertIDPlan(t *testing.T) {
+	tests := []struct {
+		sql          string
+		isLastInsert bool
+		name         string
+		value        uint64
+	}{
+		{"select last_insert_id()", true, "last_insert_id()", 10},
+		{"select LAST_INSERT_ID() as id", true, "id", 10},
+		{"select @@identity", true, "@@identity", 10},
+		{"select @@session.last_insert_id", true, "@@last_insert_id", 10},
+		{"select last_insert_id(5)", true, "last_insert_id(5)", 5},
+		{"select @@global.identity", false, "", 0},
+		{"select last_insert_id(id)", false, "", 0},
+		{"select last_insert_id() from t", false, "", 0},
+		{"select last_insert_id(), 1", false, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			assert.Nil(t, err)
+			assert.Equal(t, test.isLastInsert, IsSelectLastInsertIDStmt(stmt))
+			if !test.isLastInsert {
+				return
+			}
+			se := &sessionExecutor{lastInsertID: 10}
+			p := CreateSelectLastInsertIDPlan(stmt.(*ast.SelectStmt))
+			r, err := p.ExecuteIn(util.NewRequestContext(), se)
+			assert.Nil(t, err)
+			assert.Equal(t, test.name, string(r.Fields[0].Name))
+			assert.Equal(t, test.value, r.Values[0][0])
+			assert.Equal(t, test.value, se.lastInsertID)
+		})
+	}
+}
+
 func TestBuildPlan(t *testing.T) {
 	tests := []struct {
 		sql        string
@@ -209,6 +413,28 @@ func TestCheckUnshardBase(t *testing.T) {
 			want:  "other_db",
 			want1: true,
 		},
+		{
+			name: "Test join tables in same db",
+			args: args{
+				tokenId: mysql.TkIdSelect,
+				tokens:  []string{"select", "*", "from", "db1.t1", "join", "db1.t2"},
+				rt:      newMockRouter(),
+				db:      "db",
+			},
+			want:  "db1",
+			want1: true,
+		},
+		{
+			name: "Test join tables in different dbs",
+			args: args{
+				tokenId: mysql.TkIdSelect,
+				tokens:  []string{"select", "*", "from", "db1.t1", "join", "db2.t2"},
+				rt:      newMockRouter(),
+				db:      "db",
+			},
+			want:  "db1",
+			want1: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
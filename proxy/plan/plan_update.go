@@ -40,6 +40,31 @@ func NewUpdatePlan(stmt *ast.UpdateStmt, db, sql string, r *router.Router) *Upda
 	}
 }
 
+// GetTable return logical db and table of update
+func (s *UpdatePlan) GetTable() (string, string) {
+	if s.stmt.TableRefs == nil || s.stmt.TableRefs.TableRefs == nil {
+		return "", ""
+	}
+	tableSource, ok := s.stmt.TableRefs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return "", ""
+	}
+	dec, ok := tableSource.Source.(*TableNameDecorator)
+	if !ok {
+		return "", ""
+	}
+	return dec.rule.GetDB(), dec.rule.GetTable()
+}
+
+// GetAssignedColumns return names of columns assigned by update in lower case
+func (s *UpdatePlan) GetAssignedColumns() []string {
+	columns := make([]string, 0, len(s.stmt.List))
+	for _, a := range s.stmt.List {
+		columns = append(columns, a.Column.Name.L)
+	}
+	return columns
+}
+
 // ExecuteIn implement Plan
 func (s *UpdatePlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mysql.Result, error) {
 	sqls := s.sqls
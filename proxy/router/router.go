@@ -20,8 +20,14 @@ import (
 	"github.com/XiaoMi/Gaea/models"
 )
 
+// oscTableSuffixes suffixes of auxiliary tables created by online schema change tools,
+// the auxiliary table of tbl is _tbl_gho or _tbl_del for gh-ost, and _tbl_new or _tbl_old for pt-osc
+var oscTableSuffixes = []string{"_gho", "_del", "_new", "_old"}
+
 type Router struct {
-	rules       map[string]map[string]Rule // dbname-tablename
+	rules       map[string]map[string]Rule   // dbname-tablename
+	oscRules    map[string]map[string]Rule   // auxiliary tables of online schema change tools, nil if osc compatible mode is off
+	oscTables   map[string]map[string]string // auxiliary table to its original table
 	defaultRule Rule
 }
 
@@ -97,9 +103,62 @@ func NewRouter(namespace *models.Namespace) (*Router, error) {
 		rt.rules[rule.db][rule.table] = rule
 	}
 
+	if namespace.OSCCompatible {
+		rt.oscRules, rt.oscTables = createOSCRules(rt.rules)
+	}
+
 	return rt, nil
 }
 
+// createOSCRules create rules of auxiliary tables of online schema change tools,
+// they have the same sharding rule as the original table, so statements can be executed on every physical table
+func createOSCRules(rules map[string]map[string]Rule) (map[string]map[string]Rule, map[string]map[string]string) {
+	ret := make(map[string]map[string]Rule)
+	baseTables := make(map[string]map[string]string)
+	for db, tables := range rules {
+		for table, rule := range tables {
+			baseRule, ok := rule.(*BaseRule)
+			if !ok {
+				// linked table shares the rule of its parent, online schema change on it is not supported
+				continue
+			}
+			for _, suffix := range oscTableSuffixes {
+				name := "_" + table + suffix
+				if _, ok := tables[name]; ok {
+					continue
+				}
+				if ret[db] == nil {
+					ret[db] = make(map[string]Rule)
+					baseTables[db] = make(map[string]string)
+				}
+				ret[db][name] = baseRule.clone(name)
+				baseTables[db][name] = table
+			}
+		}
+	}
+	return ret, baseTables
+}
+
+// AddSubTable add sub table of date rule at runtime, auxiliary tables of online schema change tools are added too
+func (r *Router) AddSubTable(db, table string, index int, sliceIndex int) error {
+	rule, ok := r.rules[db][table].(*BaseRule)
+	if !ok {
+		return fmt.Errorf("shard rule of %s.%s not found", db, table)
+	}
+	if err := rule.AddSubTable(index, sliceIndex); err != nil {
+		return err
+	}
+	for name, base := range r.oscTables[db] {
+		if base != table {
+			continue
+		}
+		if err := r.oscRules[db][name].(*BaseRule).AddSubTable(index, sliceIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *Router) GetShardRule(db, table string) (Rule, bool) {
 	arry := strings.Split(table, ".")
 	if len(arry) == 2 {
@@ -107,6 +166,9 @@ func (r *Router) GetShardRule(db, table string) (Rule, bool) {
 		db = strings.Trim(arry[0], "`")
 	}
 	rule, ok := r.rules[db][table]
+	if !ok && r.oscRules != nil {
+		rule, ok = r.oscRules[db][table]
+	}
 	return rule, ok
 }
 
@@ -117,6 +179,9 @@ func (r *Router) GetRule(db, table string) Rule {
 		db = strings.Trim(arry[0], "`")
 	}
 	rule := r.rules[db][table]
+	if rule == nil && r.oscRules != nil {
+		rule = r.oscRules[db][table]
+	}
 	if rule == nil {
 		//set the database of default rule
 		r.defaultRule.(*BaseRule).db = db
@@ -126,6 +191,25 @@ func (r *Router) GetRule(db, table string) Rule {
 	}
 }
 
+// IsOSCCompatible return true if auxiliary tables of online schema change tools are routed as sharding tables
+func (r *Router) IsOSCCompatible() bool {
+	return r != nil && r.oscRules != nil
+}
+
+// IsOSCTable check if table is auxiliary table of online schema change tools
+func (r *Router) IsOSCTable(db, table string) bool {
+	_, ok := r.oscTables[db][table]
+	return ok
+}
+
+// GetOSCBaseTable return the original table of auxiliary table, or table itself if it's not auxiliary table
+func (r *Router) GetOSCBaseTable(db, table string) string {
+	if base, ok := r.oscTables[db][table]; ok {
+		return base
+	}
+	return table
+}
+
 // GetAllRules return all shard rules
 func (r *Router) GetAllRules() map[string]map[string]Rule {
 	return r.rules
@@ -33,6 +33,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/models"
@@ -88,9 +89,10 @@ type BaseRule struct {
 	shardingColumn string
 
 	ruleType        string
-	slices          []string    // not the namespace slices
-	subTableIndexes []int       //subTableIndexes store all the index of sharding sub-table
-	tableToSlice    map[int]int //key is table index, and value is slice index
+	slices          []string     // not the namespace slices
+	lock            sync.RWMutex // protect subTableIndexes and tableToSlice, sub tables of date rule can be added at runtime
+	subTableIndexes []int        //subTableIndexes store all the index of sharding sub-table
+	tableToSlice    map[int]int  //key is table index, and value is slice index
 	shard           Shard
 
 	// TODO: 目前全局表也借用这两个field存放默认分片的物理DB名
@@ -146,6 +148,8 @@ func (r *BaseRule) GetSlice(i int) string {
 }
 
 func (r *BaseRule) GetSliceIndexFromTableIndex(i int) int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	sliceIndex, ok := r.tableToSlice[i]
 	if !ok {
 		return -1
@@ -160,17 +164,67 @@ func (r *BaseRule) GetSlices() []string {
 }
 
 func (r *BaseRule) GetSubTableIndexes() []int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	return r.subTableIndexes
 }
 
 func (r *BaseRule) GetFirstTableIndex() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	return r.subTableIndexes[0]
 }
 
 func (r *BaseRule) GetLastTableIndex() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	return r.subTableIndexes[len(r.subTableIndexes)-1]
 }
 
+// clone return copy of rule with another table name
+func (r *BaseRule) clone(table string) *BaseRule {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	tableToSlice := make(map[int]int, len(r.tableToSlice))
+	for k, v := range r.tableToSlice {
+		tableToSlice[k] = v
+	}
+	return &BaseRule{
+		db:                           r.db,
+		table:                        table,
+		shardingColumn:               r.shardingColumn,
+		ruleType:                     r.ruleType,
+		slices:                       r.slices,
+		subTableIndexes:              r.subTableIndexes,
+		tableToSlice:                 tableToSlice,
+		shard:                        r.shard,
+		mycatDatabases:               r.mycatDatabases,
+		mycatDatabaseToTableIndexMap: r.mycatDatabaseToTableIndexMap,
+	}
+}
+
+// AddSubTable add sub table of date rule after the last one, sub table index is the date of new period,
+// e.g. 202101 of month rule. Indexes returned by GetSubTableIndexes before are not changed.
+func (r *BaseRule) AddSubTable(index int, sliceIndex int) error {
+	if r.ruleType != DateYearRuleType && r.ruleType != DateMonthRuleType && r.ruleType != DateDayRuleType {
+		return fmt.Errorf("sub table can't be added to rule of type %s", r.ruleType)
+	}
+	if sliceIndex < 0 || sliceIndex >= len(r.slices) {
+		return fmt.Errorf("invalid slice index %d of table %s", sliceIndex, r.table)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if n := len(r.subTableIndexes); n > 0 && index <= r.subTableIndexes[n-1] {
+		return fmt.Errorf("sub table index %d of table %s should be greater than the last one %d", index, r.table, r.subTableIndexes[n-1])
+	}
+	indexes := make([]int, len(r.subTableIndexes), len(r.subTableIndexes)+1)
+	copy(indexes, r.subTableIndexes)
+	r.subTableIndexes = append(indexes, index)
+	r.tableToSlice[index] = sliceIndex
+	return nil
+}
+
 func (r *BaseRule) GetType() string {
 	return r.ruleType
 }
@@ -637,6 +691,11 @@ func IsMycatShardingRule(ruleType string) bool {
 	return ruleType == MycatModRuleType || ruleType == MycatLongRuleType || ruleType == MycatMurmurRuleType || ruleType == MycatPaddingModRuleType || ruleType == MycatStringRuleType
 }
 
+// IsDateShardingRule check if the rule type is date_year, date_month or date_day
+func IsDateShardingRule(ruleType string) bool {
+	return ruleType == DateYearRuleType || ruleType == DateMonthRuleType || ruleType == DateDayRuleType
+}
+
 func GetRealDatabases(dbs []string) ([]string, error) {
 	return getRealDatabases(dbs)
 }
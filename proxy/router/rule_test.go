@@ -622,6 +622,71 @@ func TestCreateLinkedRule(t *testing.T) {
 	})
 }
 
+func TestCreateOSCRules(t *testing.T) {
+	rules := map[string]map[string]Rule{
+		"db1": {
+			"table1": &BaseRule{db: "db1", table: "table1", ruleType: ModRuleType, subTableIndexes: []int{0, 1}},
+			"table2": &LinkedRule{db: "db1", table: "table2"},
+			// real table is not replaced by auxiliary table
+			"_table1_old": &BaseRule{db: "db1", table: "_table1_old", ruleType: HashRuleType},
+		},
+	}
+	oscRules, oscTables := createOSCRules(rules)
+	rt := &Router{rules: rules, oscRules: oscRules, oscTables: oscTables}
+	assert.True(t, rt.IsOSCCompatible())
+
+	for _, name := range []string{"_table1_gho", "_table1_del", "_table1_new"} {
+		rule, ok := rt.GetShardRule("db1", name)
+		assert.True(t, ok)
+		assert.Equal(t, name, rule.GetTable())
+		assert.Equal(t, ModRuleType, rule.GetType())
+		assert.Equal(t, []int{0, 1}, rule.GetSubTableIndexes())
+		assert.Equal(t, "table1", rt.GetOSCBaseTable("db1", name))
+		assert.Equal(t, name, rt.GetRule("db1", name).GetTable())
+	}
+	assert.Equal(t, "table1", rules["db1"]["table1"].GetTable())
+
+	rule, ok := rt.GetShardRule("db1", "_table1_old")
+	assert.True(t, ok)
+	assert.Equal(t, HashRuleType, rule.GetType())
+	assert.False(t, rt.IsOSCTable("db1", "_table1_old"))
+	assert.Equal(t, "_table1_old", rt.GetOSCBaseTable("db1", "_table1_old"))
+
+	_, ok = rt.GetShardRule("db1", "_table2_gho")
+	assert.False(t, ok)
+	assert.False(t, (&Router{}).IsOSCCompatible())
+}
+
+func TestAddSubTable(t *testing.T) {
+	monthRule, err := parseRule(&models.Shard{
+		DB:        "db1",
+		Table:     "table1",
+		Type:      DateMonthRuleType,
+		Key:       "create_time",
+		Slices:    []string{"slice-0", "slice-1"},
+		DateRange: []string{"202011-202012", "202101"},
+	})
+	assert.Nil(t, err)
+	rules := map[string]map[string]Rule{"db1": {"table1": monthRule}}
+	oscRules, oscTables := createOSCRules(rules)
+	rt := &Router{rules: rules, oscRules: oscRules, oscTables: oscTables}
+
+	indexes := monthRule.GetSubTableIndexes()
+	assert.Nil(t, rt.AddSubTable("db1", "table1", 202102, 1))
+	assert.Equal(t, []int{202011, 202012, 202101}, indexes)
+	assert.Equal(t, []int{202011, 202012, 202101, 202102}, monthRule.GetSubTableIndexes())
+	assert.Equal(t, 202102, monthRule.GetLastTableIndex())
+	assert.Equal(t, 1, monthRule.GetSliceIndexFromTableIndex(202102))
+	assert.Equal(t, []int{202011, 202012, 202101, 202102}, rt.GetRule("db1", "_table1_gho").GetSubTableIndexes())
+
+	assert.NotNil(t, rt.AddSubTable("db1", "table1", 202102, 1))
+	assert.NotNil(t, rt.AddSubTable("db1", "table1", 202103, 2))
+	assert.NotNil(t, rt.AddSubTable("db1", "table2", 202103, 1))
+
+	hashRule := &BaseRule{db: "db1", table: "table2", ruleType: HashRuleType, slices: []string{"slice-0"}}
+	assert.NotNil(t, hashRule.AddSubTable(1, 0))
+}
+
 func TestBaseRuleMethods(t *testing.T) {
 	baseRule := &BaseRule{
 		db:              "db1",
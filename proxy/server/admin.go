@@ -15,6 +15,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/XiaoMi/Gaea/core"
 	"net"
@@ -22,9 +23,11 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/log"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/util"
@@ -36,6 +39,18 @@ const (
 	selfDefinedInternalError = 800
 )
 
+// NamespaceStatus client connections of namespace and status of backends
+type NamespaceStatus struct {
+	Name                 string                              `json:"name"`
+	ClientConnections    int                                 `json:"client_connections"`
+	MaxClientConnections int                                 `json:"max_client_connections"` // 0 means no limit
+	UserConnections      map[string]int                      `json:"user_connections"`       // key: user name
+	ActiveTransactions   int64                               `json:"active_transactions"`
+	Mode                 string                              `json:"mode"`         // normal, readonly or maintenance
+	ModeMessage          string                              `json:"mode_message"` // error message of rejected queries
+	Slices               map[string][]*backend.BackendStatus `json:"slices"`       // key: slice name
+}
+
 // SQLFingerprint sql fingerprint
 type SQLFingerprint struct {
 	SlowSQL  map[string]string `json:"slow_sql"`
@@ -52,16 +67,16 @@ type AdminServer struct {
 	// proxy config file path
 	configFile string
 
-	listener      net.Listener
-	adminUser     string
-	adminPassword string
-	engine        *gin.Engine
+	listener net.Listener
+	accounts *adminAccounts
+	engine   *gin.Engine
 
 	configType          string
 	coordinatorAddr     string
 	coordinatorUsername string
 	coordinatorPassword string
 	coordinatorRoot     string
+	bundleSignKey       string
 }
 
 // NewAdminServer create new admin server
@@ -82,14 +97,16 @@ func NewAdminServer(proxy *Server, cfg *models.Proxy) (*AdminServer, error) {
 
 	s.exit.C = make(chan struct{})
 	s.proxy = proxy
-	s.adminUser = cfg.AdminUser
-	s.adminPassword = cfg.AdminPassword
 	s.configType = cfg.ConfigType
 	s.coordinatorAddr = cfg.CoordinatorAddr
 	s.coordinatorUsername = cfg.UserName
 	s.coordinatorPassword = cfg.Password
 	s.coordinatorRoot = cfg.CoordinatorRoot
 	s.configFile = cfg.ConfigFile
+	s.bundleSignKey = cfg.BundleSignKey
+	if s.accounts, err = newAdminAccounts(cfg); err != nil {
+		return nil, err
+	}
 	s.engine = gin.New()
 	l, err := net.Listen(cfg.ProtoType, cfg.AdminAddr)
 	if err != nil {
@@ -100,6 +117,10 @@ func NewAdminServer(proxy *Server, cfg *models.Proxy) (*AdminServer, error) {
 	s.registerMetric()
 	s.registerProf()
 	s.registerVersion()
+	s.registerConsole()
+	if cfg.QueryAPIEnabled {
+		s.registerQuery()
+	}
 
 	proxyInfo, err := NewProxyInfo(cfg, s.proxy.Listener().Addr().String())
 	if err != nil {
@@ -146,18 +167,64 @@ func (s *AdminServer) Close() error {
 }
 
 func (s *AdminServer) registerURL() {
-	adminGroup := s.engine.Group("/api/proxy", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
-	adminGroup.GET("/ping", s.ping)
-	adminGroup.PUT("/proxyconfig/reload", s.reloadProxyConfig)
-	adminGroup.PUT("/config/prepare/:name", s.prepareConfig)
-	adminGroup.PUT("/config/commit/:name", s.commitConfig)
-	adminGroup.PUT("/namespace/delete/:name", s.deleteNamespace)
-	adminGroup.GET("/config/fingerprint", s.configFingerprint)
-
-	adminGroup.GET("/stats/sessionsqlfingerprint/:namespace", s.getNamespaceSessionSQLFingerprint)
-	adminGroup.GET("/stats/backendsqlfingerprint/:namespace", s.getNamespaceBackendSQLFingerprint)
-	adminGroup.DELETE("/stats/sessionsqlfingerprint/:namespace", s.clearNamespaceSessionSQLFingerprint)
-	adminGroup.DELETE("/stats/backendsqlfingerprint/:namespace", s.clearNamespaceBackendSQLFingerprint)
+	viewer := s.authRequired(models.AdminRoleViewer)
+	operator := s.authRequired(models.AdminRoleNamespaceOperator)
+	superAdmin := s.authRequired(models.AdminRoleSuperAdmin)
+
+	adminGroup := s.engine.Group("/api/proxy")
+	adminGroup.GET("/ping", viewer, s.ping)
+	adminGroup.PUT("/proxyconfig/reload", superAdmin, s.reloadProxyConfig)
+	adminGroup.PUT("/config/prepare/:name", operator, s.prepareConfig)
+	adminGroup.PUT("/config/commit/:name", operator, s.commitConfig)
+	adminGroup.PUT("/namespace/delete/:name", superAdmin, s.deleteNamespace)
+	adminGroup.GET("/config/fingerprint", viewer, s.configFingerprint)
+	adminGroup.GET("/config/versions", viewer, s.configVersions)
+	adminGroup.GET("/config/namespace/:name", operator, s.getNamespaceConfig)
+	adminGroup.PUT("/config/namespace/:name", operator, s.updateNamespaceConfig)
+	adminGroup.POST("/config/verify", viewer, s.verifyNamespaceConfig)
+	adminGroup.GET("/config/export/:name", operator, s.exportNamespaceConfig)
+	adminGroup.PUT("/config/import/:name", operator, s.importNamespaceConfig)
+	adminGroup.PUT("/config/loglevel/:level", superAdmin, s.setLogLevel)
+	adminGroup.PUT("/config/logoutput/:output", superAdmin, s.setLogOutput)
+
+	adminGroup.GET("/namespace/list", viewer, s.listNamespaces)
+	adminGroup.GET("/namespace/status/:namespace", viewer, s.getNamespaceStatus)
+	adminGroup.PUT("/namespace/mode/:namespace/:mode", operator, s.setNamespaceMode)
+	adminGroup.GET("/slowsql/kill/:namespace", viewer, s.getSlowSQLKillStatus)
+	adminGroup.PUT("/slowsql/kill/whitelist/:namespace", operator, s.addSlowSQLKillWhitelist)
+	adminGroup.DELETE("/slowsql/kill/whitelist/:namespace/:md5", operator, s.removeSlowSQLKillWhitelist)
+	adminGroup.GET("/indexadvisor/:namespace", viewer, s.listIndexAdvices)
+	adminGroup.PUT("/indexadvisor/approve/:namespace/:md5", operator, s.approveIndexAdvice)
+	adminGroup.DELETE("/indexadvisor/:namespace/:md5", operator, s.removeIndexAdvice)
+	adminGroup.GET("/purge/:namespace", viewer, s.getPurgeStatus)
+	adminGroup.PUT("/purge/run/:namespace/:db/:table", operator, s.runPurge)
+	adminGroup.GET("/checksum/:namespace", viewer, s.getChecksumStatus)
+	adminGroup.PUT("/checksum/run/:namespace/:db/:table", operator, s.runChecksum)
+
+	adminGroup.GET("/stats/sessionsqlfingerprint/:namespace", viewer, s.getNamespaceSessionSQLFingerprint)
+	adminGroup.GET("/stats/backendsqlfingerprint/:namespace", viewer, s.getNamespaceBackendSQLFingerprint)
+	adminGroup.DELETE("/stats/sessionsqlfingerprint/:namespace", operator, s.clearNamespaceSessionSQLFingerprint)
+	adminGroup.DELETE("/stats/backendsqlfingerprint/:namespace", operator, s.clearNamespaceBackendSQLFingerprint)
+	adminGroup.GET("/stats/slowsql/plan/:namespace/:md5", viewer, s.getSlowSQLPlan)
+	adminGroup.GET("/stats/sql/topn/:namespace", viewer, s.getNamespaceSQLStatsTopN)
+	adminGroup.DELETE("/stats/sql/:namespace", operator, s.resetNamespaceSQLStats)
+	adminGroup.GET("/stats/table/:namespace", viewer, s.getNamespaceTableStats)
+	adminGroup.DELETE("/stats/table/:namespace", operator, s.resetNamespaceTableStats)
+	adminGroup.GET("/stats/mirror/:namespace", viewer, s.getNamespaceMirrorStats)
+	adminGroup.GET("/stats/binlog/:namespace", viewer, s.getNamespaceBinlogStats)
+	adminGroup.GET("/stats/cdc/:namespace", viewer, s.getNamespaceCDCStats)
+
+	adminGroup.GET("/backend/connections/:namespace", viewer, s.getNamespaceBackendConnections)
+	adminGroup.DELETE("/backend/connections/:namespace/:slice/:id", operator, s.killNamespaceBackendConnection)
+	adminGroup.PUT("/backend/offline/:namespace/:slice", operator, s.setBackendOffline)
+	adminGroup.PUT("/backend/online/:namespace/:slice", operator, s.setBackendOnline)
+	adminGroup.GET("/diagnostics/sessions", viewer, s.getSessions)
+	adminGroup.PUT("/diagnostics/dump", superAdmin, s.dumpDiagnostics)
+	if backend.ChaosEnabled {
+		adminGroup.GET("/chaos/fault", viewer, s.listFaults)
+		adminGroup.PUT("/chaos/fault", superAdmin, s.addFault)
+		adminGroup.DELETE("/chaos/fault", superAdmin, s.clearFaults)
+	}
 
 	adminGroup.Use(gzip.Gzip(gzip.DefaultCompression))
 	adminGroup.Use(gin.Recovery())
@@ -171,7 +238,7 @@ func (s *AdminServer) registerURL() {
 // @Security BasicAuth
 // @Router /api/metric/metrics [get]
 func (s *AdminServer) registerMetric() {
-	metricGroup := s.engine.Group("/api/metric", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
+	metricGroup := s.engine.Group("/api/metric", s.authRequired(models.AdminRoleViewer))
 	for path, handler := range s.proxy.manager.GetStatisticManager().GetHandlers() {
 		log.Debug("[server] AdminServer got metric handler, path: %s", path)
 		metricGroup.GET(path, gin.WrapH(handler))
@@ -179,7 +246,7 @@ func (s *AdminServer) registerMetric() {
 }
 
 func (s *AdminServer) registerProf() {
-	profGroup := s.engine.Group("/debug/pprof", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
+	profGroup := s.engine.Group("/debug/pprof", s.authRequired(models.AdminRoleSuperAdmin))
 	profGroup.GET("/", gin.WrapF(pprof.Index))
 	profGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
 	profGroup.GET("/profile", gin.WrapF(pprof.Profile))
@@ -293,10 +360,47 @@ func (s *AdminServer) reloadProxyConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
+// @Summary 修改日志级别
+// @Description 通过管理接口在运行时修改系统日志和SQL日志的级别, 不需要重启
+// @Produce  json
+// @Param level path string true "log level: debug, trace, notice, warn, fatal, none"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/config/loglevel/{level} [put]
+func (s *AdminServer) setLogLevel(c *gin.Context) {
+	level := strings.TrimSpace(c.Param("level"))
+	if err := s.proxy.SetLogLevel(level); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 修改日志输出
+// @Description 通过管理接口在运行时切换系统日志和SQL日志的输出, 支持 file、stdout(json格式)、syslog
+// @Produce  json
+// @Param output path string true "log output: file, stdout, syslog"
+// @Param path query string false "log path relative to log_path of proxy config, only for file output, can't be out of log_path"
+// @Param filename query string false "log filename without path separator, only for file output"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/config/logoutput/{output} [put]
+func (s *AdminServer) setLogOutput(c *gin.Context) {
+	output := strings.TrimSpace(c.Param("output"))
+	path := strings.TrimSpace(c.Query("path"))
+	filename := strings.TrimSpace(c.Query("filename"))
+	if err := s.proxy.SetLogOutput(output, path, filename); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
+
 // @Summary prepare namespace配置
-// @Description 通过管理接口, 二阶段提交, prepare namespace配置
+// @Description 通过管理接口, 二阶段提交, prepare namespace配置, canary为true时使用灰度配置
 // @Produce  json
 // @Param name path string true "namespace name"
+// @Param canary query bool false "prepare canary config"
 // @Success 200 {string} string "OK"
 // @Security BasicAuth
 // @Router /api/proxy/config/prepare/{name} [put]
@@ -308,7 +412,12 @@ func (s *AdminServer) prepareConfig(c *gin.Context) {
 	}
 	client := models.NewClient(s.configType, s.coordinatorAddr, s.coordinatorUsername, s.coordinatorPassword, s.coordinatorRoot)
 	defer client.Close()
-	err := s.proxy.ReloadNamespacePrepare(name, client)
+	var err error
+	if c.Query("canary") == "true" {
+		err = s.proxy.ReloadNamespaceCanaryPrepare(name, client)
+	} else {
+		err = s.proxy.ReloadNamespacePrepare(name, client)
+	}
 	if err != nil {
 		log.Warn("prepare config of namespace: %s failed, err: %v", name, err)
 		c.JSON(selfDefinedInternalError, err.Error())
@@ -370,14 +479,237 @@ func (s *AdminServer) configFingerprint(c *gin.Context) {
 	c.JSON(http.StatusOK, s.proxy.manager.ConfigFingerprint())
 }
 
-// @Summary 获取Porxy 慢SQL、错误SQL信息
-// @Description 通过管理接口获取Porxy 慢SQL、错误SQL信息
+// @Summary 返回namespace配置版本
+// @Description 返回当前加载的各namespace配置版本, 版本为配置的md5, 与配置中心中的配置版本比较可发现未成功加载的配置
+// @Produce  json
+// @Success 200 {object} map[string]string "key: namespace name, value: version"
+// @Security BasicAuth
+// @Router /api/proxy/config/versions [get]
+func (s *AdminServer) configVersions(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.manager.GetNamespaceVersions())
+}
+
+// @Summary 获取namespace配置
+// @Description 从配置中心读取namespace配置, 用户和slice的账号密码为解密后的值
+// @Produce  json
+// @Param name path string true "namespace name"
+// @Success 200 {object} models.Namespace
+// @Security BasicAuth
+// @Router /api/proxy/config/namespace/{name} [get]
+func (s *AdminServer) getNamespaceConfig(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(selfDefinedInternalError, "missing namespace name")
+		return
+	}
+	client := models.NewClient(s.configType, s.coordinatorAddr, s.coordinatorUsername, s.coordinatorPassword, s.coordinatorRoot)
+	store := models.NewStore(client)
+	defer store.Close()
+	namespace, err := store.LoadNamespace(s.proxy.EncryptKey, name)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, namespace)
+}
+
+// @Summary 校验namespace配置
+// @Description 校验namespace配置格式及内容, 不保存
+// @Accept  json
+// @Produce  json
+// @Param namespace body models.Namespace true "namespace config"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/config/verify [post]
+func (s *AdminServer) verifyNamespaceConfig(c *gin.Context) {
+	if _, err := parseNamespaceConfig(c); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 修改namespace配置
+// @Description 校验namespace配置后写入配置中心, 不在当前proxy上加载, 需要通过gaea-cc或各proxy的prepare/commit接口使集群内proxy一起加载. 仅支持etcd配置中心
+// @Accept  json
+// @Produce  json
+// @Param name path string true "namespace name"
+// @Param namespace body models.Namespace true "namespace config"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/config/namespace/{name} [put]
+func (s *AdminServer) updateNamespaceConfig(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if s.configType == models.ConfigFile {
+		c.JSON(selfDefinedInternalError, "namespace config in file can't be modified by admin api")
+		return
+	}
+	namespace, err := parseNamespaceConfig(c)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if namespace.Name != name {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("name of namespace config %s is not %s", namespace.Name, name))
+		return
+	}
+	if err = s.saveNamespaceConfig(namespace); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("namespace config of %s is updated by admin api", name)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// saveNamespaceConfig write verified namespace config to coordinator, it's not loaded on this proxy
+// so that proxies of cluster don't drift from each other, they load it by prepare/commit together
+func (s *AdminServer) saveNamespaceConfig(namespace *models.Namespace) error {
+	if namespace.IsEncrypt {
+		if err := namespace.Encrypt(s.proxy.EncryptKey); err != nil {
+			return err
+		}
+	}
+
+	client := models.NewClient(s.configType, s.coordinatorAddr, s.coordinatorUsername, s.coordinatorPassword, s.coordinatorRoot)
+	store := models.NewStore(client)
+	defer store.Close()
+	return store.UpdateNamespace(namespace)
+}
+
+// @Summary 导出namespace配置
+// @Description 从配置中心读取namespace配置(包括slice、分片规则、用户和全局序列号), 导出为以bundle_sign_key签名的配置包, 用于导入到其他环境
+// @Produce  json
+// @Param name path string true "namespace name"
+// @Param format query string false "json(default) or yaml"
+// @Param template query bool false "replace addresses and passwords by variables GAEA_{NAMESPACE}_*"
+// @Success 200 {object} models.NamespaceBundle
+// @Security BasicAuth
+// @Router /api/proxy/config/export/{name} [get]
+func (s *AdminServer) exportNamespaceConfig(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("unsupported format: %s", format))
+		return
+	}
+	client := models.NewClient(s.configType, s.coordinatorAddr, s.coordinatorUsername, s.coordinatorPassword, s.coordinatorRoot)
+	store := models.NewStore(client)
+	defer store.Close()
+	namespace, err := store.LoadNamespace(s.proxy.EncryptKey, name)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	bundle, err := models.NewNamespaceBundle(namespace, c.Query("template") == "true", s.bundleSignKey)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+	data, err := bundle.EncodeYAML()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/x-yaml; charset=utf-8", data)
+}
+
+// @Summary 导入namespace配置
+// @Description 校验配置包的签名, 以proxy的环境变量替换其中的变量后写入配置中心, 与修改namespace配置相同, 需要通过prepare/commit接口加载
+// @Accept  json
+// @Produce  json
+// @Param name path string true "namespace name"
+// @Param bundle body models.NamespaceBundle true "namespace bundle in json or yaml"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/config/import/{name} [put]
+func (s *AdminServer) importNamespaceConfig(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if s.configType == models.ConfigFile {
+		c.JSON(selfDefinedInternalError, "namespace config in file can't be modified by admin api")
+		return
+	}
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	bundle, err := models.ParseNamespaceBundle(data, s.bundleSignKey)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid namespace bundle: %v", err))
+		return
+	}
+	namespace, err := bundle.Expand(os.LookupEnv)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if namespace.Name != name {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("name of namespace config %s is not %s", namespace.Name, name))
+		return
+	}
+	if err = namespace.Verify(); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if err = s.saveNamespaceConfig(namespace); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("namespace config of %s is imported by admin api, bundle exported at %s", name, bundle.ExportTime)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// parseNamespaceConfig parse and verify namespace config in request body
+func parseNamespaceConfig(c *gin.Context) (*models.Namespace, error) {
+	namespace := &models.Namespace{}
+	if err := json.NewDecoder(c.Request.Body).Decode(namespace); err != nil {
+		return nil, fmt.Errorf("invalid namespace config: %v", err)
+	}
+	if err := namespace.Verify(); err != nil {
+		return nil, err
+	}
+	return namespace, nil
+}
+
+// @Summary 获取namespace列表
+// @Description 获取当前proxy加载的namespace名称, 按名称排序, 响应头X-Total-Count为过滤后的总数
+// @Produce  json
+// @Param limit query int false "page size, default 0 means all"
+// @Param offset query int false "items skipped"
+// @Param filter query string false "substring of name, case insensitive"
+// @Success 200 {array} string
+// @Security BasicAuth
+// @Router /api/proxy/namespace/list [get]
+func (s *AdminServer) listNamespaces(c *gin.Context) {
+	opts, err := parseListOptions(c, 0)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	account := getAdminAccount(c)
+	names := make([]string, 0)
+	for _, name := range s.proxy.manager.GetNamespaceNames() {
+		if account.CanAccess(name) && opts.match(name) {
+			names = append(names, name)
+		}
+	}
+	start, end := opts.page(len(names))
+	c.Header(totalCountHeader, strconv.Itoa(len(names)))
+	c.JSON(http.StatusOK, names[start:end])
+}
+
+// @Summary 获取namespace状态
+// @Description 获取namespace及各用户的客户端连接数、活跃事务数, 以及健康检查得到的各后端实例状态、从库延迟和连接池使用情况
 // @Produce  json
 // @Param namespace path string true "namespace name"
-// @Success 200 {object} SQLFingerprint
+// @Success 200 {object} NamespaceStatus
 // @Security BasicAuth
-// @Router /api/proxy/stats/sessionsqlfingerprint/{namespace} [get]
-func (s *AdminServer) getNamespaceSessionSQLFingerprint(c *gin.Context) {
+// @Router /api/proxy/namespace/status/{namespace} [get]
+func (s *AdminServer) getNamespaceStatus(c *gin.Context) {
 	ns := strings.TrimSpace(c.Param("namespace"))
 	namespace := s.proxy.manager.GetNamespace(ns)
 	if namespace == nil {
@@ -385,74 +717,865 @@ func (s *AdminServer) getNamespaceSessionSQLFingerprint(c *gin.Context) {
 		return
 	}
 
-	slowSQLFingerprints := namespace.GetSlowSQLFingerprints()
-	errSQLFingerprints := namespace.GetErrorSQLFingerprints()
-	ret := &SQLFingerprint{SlowSQL: slowSQLFingerprints, ErrorSQL: errSQLFingerprints}
-
-	c.JSON(http.StatusOK, ret)
+	mode, message := namespace.mode.get()
+	c.JSON(http.StatusOK, &NamespaceStatus{
+		Name:                 ns,
+		ClientConnections:    s.proxy.manager.GetStatisticManager().GetConnectionCount(ns),
+		MaxClientConnections: namespace.maxClientConnections,
+		UserConnections:      namespace.getUserConnections(s.proxy.manager.GetStatisticManager()),
+		ActiveTransactions:   namespace.activeTxs.Get(),
+		Mode:                 mode,
+		ModeMessage:          message,
+		Slices:               namespace.GetBackendStatus(),
+	})
 }
 
-// @Summary 获取后端节点慢SQL、错误SQL信息
-// @Description 通过管理接口获取后端节点慢SQL、错误SQL信息
+// @Summary 切换namespace运行模式
+// @Description 通过管理接口切换namespace运行模式, readonly拒绝DML和DDL, maintenance拒绝除commit、rollback外的所有新请求, 执行中的请求不受影响, normal恢复正常, 用于后端维护窗口. 模式在namespace重新加载后保留, proxy重启后恢复normal
 // @Produce  json
 // @Param namespace path string true "namespace name"
-// @Success 200 {object} SQLFingerprint
+// @Param mode path string true "normal, readonly or maintenance"
+// @Param message query string false "error message returned to client for rejected queries"
+// @Success 200 {string} string "OK"
 // @Security BasicAuth
-// @Router /api/proxy/stats/backendsqlfingerprint/{namespace} [get]
-func (s *AdminServer) getNamespaceBackendSQLFingerprint(c *gin.Context) {
+// @Router /api/proxy/namespace/mode/{namespace}/{mode} [put]
+func (s *AdminServer) setNamespaceMode(c *gin.Context) {
 	ns := strings.TrimSpace(c.Param("namespace"))
 	namespace := s.proxy.manager.GetNamespace(ns)
 	if namespace == nil {
 		c.JSON(selfDefinedInternalError, "namespace not found")
 		return
 	}
+	mode := c.Param("mode")
+	if err := namespace.mode.set(mode, c.Query("message")); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("set namespace mode, namespace: %s, mode: %s", ns, mode)
+	c.JSON(http.StatusOK, "OK")
+}
 
-	slowSQLFingerprints := namespace.GetBackendSlowSQLFingerprints()
-	errSQLFingerprints := namespace.GetBackendErrorSQLFingerprints()
-	ret := &SQLFingerprint{SlowSQL: slowSQLFingerprints, ErrorSQL: errSQLFingerprints}
+// @Summary 获取慢SQL主动kill状态
+// @Description 获取namespace被主动kill的语句数、正在跟踪的语句数和kill白名单, 需配置namespace或用户的slow_sql_kill_time
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {object} SlowSQLKillStatus
+// @Security BasicAuth
+// @Router /api/proxy/slowsql/kill/{namespace} [get]
+func (s *AdminServer) getSlowSQLKillStatus(c *gin.Context) {
+	namespace, ok := s.getSlowSQLKillNamespace(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, namespace.slowSQLReaper.status())
+}
 
-	c.JSON(http.StatusOK, ret)
+// @Summary 添加慢SQL kill白名单
+// @Description 将请求体中SQL的指纹加入kill白名单, 匹配的语句不会被主动kill, 返回指纹的md5. 修改在namespace重新加载后保留, proxy重启后以配置为准
+// @Accept  plain
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param sql body string true "sql or fingerprint"
+// @Success 200 {string} string "md5 of fingerprint"
+// @Security BasicAuth
+// @Router /api/proxy/slowsql/kill/whitelist/{namespace} [put]
+func (s *AdminServer) addSlowSQLKillWhitelist(c *gin.Context) {
+	namespace, ok := s.getSlowSQLKillNamespace(c)
+	if !ok {
+		return
+	}
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	md5, err := namespace.slowSQLReaper.addWhitelist(string(data))
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("add slow sql kill whitelist, namespace: %s, md5: %s", namespace.GetName(), md5)
+	c.JSON(http.StatusOK, md5)
 }
 
-// @Summary 清空Porxy节点慢SQL、错误SQL信息
-// @Description 通过管理接口清空Porxy慢SQL、错误SQL信息
+// @Summary 删除慢SQL kill白名单
+// @Description 按指纹md5从kill白名单中删除, 配置中的条目在namespace重新加载后恢复
 // @Produce  json
 // @Param namespace path string true "namespace name"
-// @Success 200 {object} SQLFingerprint
+// @Param md5 path string true "md5 of fingerprint"
+// @Success 200 {string} string "OK"
 // @Security BasicAuth
-// @Router /api/proxy/stats/sessionsqlfingerprint/{namespace} [delete]
-func (s *AdminServer) clearNamespaceSessionSQLFingerprint(c *gin.Context) {
+// @Router /api/proxy/slowsql/kill/whitelist/{namespace}/{md5} [delete]
+func (s *AdminServer) removeSlowSQLKillWhitelist(c *gin.Context) {
+	namespace, ok := s.getSlowSQLKillNamespace(c)
+	if !ok {
+		return
+	}
+	md5 := strings.TrimSpace(c.Param("md5"))
+	if !namespace.slowSQLReaper.removeWhitelist(md5) {
+		c.JSON(selfDefinedInternalError, "fingerprint not found in whitelist")
+		return
+	}
+	log.Notice("remove slow sql kill whitelist, namespace: %s, md5: %s", namespace.GetName(), md5)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getSlowSQLKillNamespace return namespace whose slow sql kill is enabled, error is written if not ok
+func (s *AdminServer) getSlowSQLKillNamespace(c *gin.Context) (*Namespace, bool) {
 	ns := strings.TrimSpace(c.Param("namespace"))
 	namespace := s.proxy.manager.GetNamespace(ns)
 	if namespace == nil {
 		c.JSON(selfDefinedInternalError, "namespace not found")
-		return
+		return nil, false
+	}
+	if namespace.slowSQLReaper == nil {
+		c.JSON(selfDefinedInternalError, "slow sql kill is disabled, slow_sql_kill_time of namespace or users is not set")
+		return nil, false
 	}
+	return namespace, true
+}
 
-	namespace.ClearSlowSQLFingerprints()
-	namespace.ClearErrorSQLFingerprints()
+// @Summary 获取索引顾问的建议
+// @Description 获取频繁SQL学习到的索引、最近一次执行计划使用的索引和建议的hint, 状态为pending的hint审批后才会注入, 需配置namespace的index_advisor
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {array} IndexAdvice
+// @Security BasicAuth
+// @Router /api/proxy/indexadvisor/{namespace} [get]
+func (s *AdminServer) listIndexAdvices(c *gin.Context) {
+	namespace, ok := s.getIndexAdvisorNamespace(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, namespace.indexAdvisor.list())
+}
 
+// @Summary 审批索引顾问的建议
+// @Description 审批状态为pending的建议, 之后该指纹的单表查询会被注入FORCE INDEX. 审批在namespace重新加载后保留, proxy重启后失效
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param md5 path string true "md5 of fingerprint"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/indexadvisor/approve/{namespace}/{md5} [put]
+func (s *AdminServer) approveIndexAdvice(c *gin.Context) {
+	namespace, ok := s.getIndexAdvisorNamespace(c)
+	if !ok {
+		return
+	}
+	md5 := strings.TrimSpace(c.Param("md5"))
+	if err := namespace.indexAdvisor.approve(md5); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("approve index advice, namespace: %s, md5: %s", namespace.GetName(), md5)
 	c.JSON(http.StatusOK, "OK")
 }
 
-// @Summary 清空后端节点慢SQL、错误SQL信息
-// @Description 通过管理接口清空后端节点慢SQL、错误SQL信息
+// @Summary 删除索引顾问的建议
+// @Description 删除指纹的hint和学习到的索引, 之后重新学习, 可用于拒绝建议或撤销已审批的hint
 // @Produce  json
 // @Param namespace path string true "namespace name"
-// @Success 200 {object} SQLFingerprint
+// @Param md5 path string true "md5 of fingerprint"
+// @Success 200 {string} string "OK"
 // @Security BasicAuth
-// @Router /api/proxy/stats/backendsqlfingerprint/{namespace} [delete]
-func (s *AdminServer) clearNamespaceBackendSQLFingerprint(c *gin.Context) {
+// @Router /api/proxy/indexadvisor/{namespace}/{md5} [delete]
+func (s *AdminServer) removeIndexAdvice(c *gin.Context) {
+	namespace, ok := s.getIndexAdvisorNamespace(c)
+	if !ok {
+		return
+	}
+	md5 := strings.TrimSpace(c.Param("md5"))
+	if !namespace.indexAdvisor.remove(md5) {
+		c.JSON(selfDefinedInternalError, "index advice not found")
+		return
+	}
+	log.Notice("remove index advice, namespace: %s, md5: %s", namespace.GetName(), md5)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getIndexAdvisorNamespace return namespace whose index advisor is enabled, error is written if not ok
+func (s *AdminServer) getIndexAdvisorNamespace(c *gin.Context) (*Namespace, bool) {
 	ns := strings.TrimSpace(c.Param("namespace"))
 	namespace := s.proxy.manager.GetNamespace(ns)
 	if namespace == nil {
 		c.JSON(selfDefinedInternalError, "namespace not found")
-		return
+		return nil, false
 	}
+	if namespace.indexAdvisor == nil {
+		c.JSON(selfDefinedInternalError, "index advisor is disabled, index_advisor of namespace is not set")
+		return nil, false
+	}
+	return namespace, true
+}
 
-	namespace.ClearBackendSlowSQLFingerprints()
-	namespace.ClearBackendErrorSQLFingerprints()
+// @Summary 获取过期数据清理进度
+// @Description 获取namespace各清理规则当前或最近一次执行的进度, 需配置namespace的purge_rules
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {array} PurgeStatus
+// @Security BasicAuth
+// @Router /api/proxy/purge/{namespace} [get]
+func (s *AdminServer) getPurgeStatus(c *gin.Context) {
+	namespace, ok := s.getPurgeNamespace(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, namespace.purger.status())
+}
 
+// @Summary 立即执行过期数据清理
+// @Description 不受执行时间段和执行间隔限制, 立即清理逻辑表的过期数据, 正在执行的清理结束后开始
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param db path string true "logical db name"
+// @Param table path string true "logical table name"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/purge/run/{namespace}/{db}/{table} [put]
+func (s *AdminServer) runPurge(c *gin.Context) {
+	namespace, ok := s.getPurgeNamespace(c)
+	if !ok {
+		return
+	}
+	db := strings.TrimSpace(c.Param("db"))
+	table := strings.TrimSpace(c.Param("table"))
+	if err := namespace.purger.runNow(db, table); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("run purge, namespace: %s, table: %s.%s", namespace.GetName(), db, table)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getPurgeNamespace return namespace which has purge rules, error is written if not ok
+func (s *AdminServer) getPurgeNamespace(c *gin.Context) (*Namespace, bool) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return nil, false
+	}
+	if namespace.purger == nil {
+		c.JSON(selfDefinedInternalError, "purge is disabled, purge_rules of namespace is not set")
+		return nil, false
+	}
+	return namespace, true
+}
+
+// @Summary 获取主从数据一致性校验结果
+// @Description 获取namespace各逻辑表当前或最近一次主从数据一致性校验的进度及不一致的数据块
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {array} ChecksumStatus
+// @Security BasicAuth
+// @Router /api/proxy/checksum/{namespace} [get]
+func (s *AdminServer) getChecksumStatus(c *gin.Context) {
+	namespace, ok := s.getChecksumNamespace(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, namespace.checksums.status())
+}
+
+// @Summary 执行主从数据一致性校验
+// @Description 按分块列将逻辑表各分表切分成数据块, 逐块比较主库和从库的CRC32校验和, 校验在后台执行
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param db path string true "logical db name"
+// @Param table path string true "logical table name"
+// @Param column query string false "integer column to split chunks, default id"
+// @Param chunk_size query int false "range of chunk column in a chunk, default 1000"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/checksum/run/{namespace}/{db}/{table} [put]
+func (s *AdminServer) runChecksum(c *gin.Context) {
+	namespace, ok := s.getChecksumNamespace(c)
+	if !ok {
+		return
+	}
+	db := strings.TrimSpace(c.Param("db"))
+	table := strings.TrimSpace(c.Param("table"))
+	column := strings.TrimSpace(c.Query("column"))
+	var chunkSize int64
+	if v := c.Query("chunk_size"); v != "" {
+		var err error
+		if chunkSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(selfDefinedInternalError, "invalid chunk_size")
+			return
+		}
+	}
+	if err := namespace.checksums.run(db, table, column, chunkSize); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("run checksum, namespace: %s, table: %s.%s", namespace.GetName(), db, table)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getChecksumNamespace return namespace by name, error is written if not found
+func (s *AdminServer) getChecksumNamespace(c *gin.Context) (*Namespace, bool) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil || namespace.checksums == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return nil, false
+	}
+	return namespace, true
+}
+
+// @Summary 获取Porxy 慢SQL、错误SQL信息
+// @Description 通过管理接口获取Porxy 慢SQL、错误SQL信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param limit query int false "page size of slow sql and error sql ordered by md5, default 0 means all"
+// @Param offset query int false "items skipped"
+// @Param filter query string false "substring of md5 or fingerprint, case insensitive"
+// @Success 200 {object} SQLFingerprint
+// @Security BasicAuth
+// @Router /api/proxy/stats/sessionsqlfingerprint/{namespace} [get]
+func (s *AdminServer) getNamespaceSessionSQLFingerprint(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	opts, err := parseListOptions(c, 0)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+
+	slowSQLFingerprints := opts.pageMap(namespace.GetSlowSQLFingerprints())
+	errSQLFingerprints := opts.pageMap(namespace.GetErrorSQLFingerprints())
+	ret := &SQLFingerprint{SlowSQL: slowSQLFingerprints, ErrorSQL: errSQLFingerprints}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// @Summary 获取慢SQL的执行计划
+// @Description 获取慢SQL指纹最近一次采集的执行计划, 在执行该SQL的后端实例上异步采集, 需配置namespace的slow_sql_explain
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param md5 path string true "md5 of fingerprint"
+// @Success 200 {object} SlowSQLPlan
+// @Security BasicAuth
+// @Router /api/proxy/stats/slowsql/plan/{namespace}/{md5} [get]
+func (s *AdminServer) getSlowSQLPlan(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	if namespace.slowSQLExplainer == nil {
+		c.JSON(selfDefinedInternalError, "slow sql explain is disabled, slow_sql_explain of namespace is not set")
+		return
+	}
+	p, ok := namespace.slowSQLExplainer.get(strings.TrimSpace(c.Param("md5")))
+	if !ok {
+		c.JSON(selfDefinedInternalError, "plan of slow sql not found")
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// @Summary 获取后端节点慢SQL、错误SQL信息
+// @Description 通过管理接口获取后端节点慢SQL、错误SQL信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param limit query int false "page size of slow sql and error sql ordered by md5, default 0 means all"
+// @Param offset query int false "items skipped"
+// @Param filter query string false "substring of md5 or fingerprint, case insensitive"
+// @Success 200 {object} SQLFingerprint
+// @Security BasicAuth
+// @Router /api/proxy/stats/backendsqlfingerprint/{namespace} [get]
+func (s *AdminServer) getNamespaceBackendSQLFingerprint(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	opts, err := parseListOptions(c, 0)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+
+	slowSQLFingerprints := opts.pageMap(namespace.GetBackendSlowSQLFingerprints())
+	errSQLFingerprints := opts.pageMap(namespace.GetBackendErrorSQLFingerprints())
+	ret := &SQLFingerprint{SlowSQL: slowSQLFingerprints, ErrorSQL: errSQLFingerprints}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// @Summary 清空Porxy节点慢SQL、错误SQL信息
+// @Description 通过管理接口清空Porxy慢SQL、错误SQL信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {object} SQLFingerprint
+// @Security BasicAuth
+// @Router /api/proxy/stats/sessionsqlfingerprint/{namespace} [delete]
+func (s *AdminServer) clearNamespaceSessionSQLFingerprint(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	namespace.ClearSlowSQLFingerprints()
+	namespace.ClearErrorSQLFingerprints()
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 清空后端节点慢SQL、错误SQL信息
+// @Description 通过管理接口清空后端节点慢SQL、错误SQL信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {object} SQLFingerprint
+// @Security BasicAuth
+// @Router /api/proxy/stats/backendsqlfingerprint/{namespace} [delete]
+func (s *AdminServer) clearNamespaceBackendSQLFingerprint(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	namespace.ClearBackendSlowSQLFingerprints()
+	namespace.ClearBackendErrorSQLFingerprints()
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 获取SQL指纹执行统计TopN
+// @Description 通过管理接口获取按SQL指纹统计的执行次数、错误数、行数和延迟分位数, 需配置namespace的sql_stats_capacity
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param sort query string false "latency(p99, default), avg, total, count, errors or rows"
+// @Param limit query int false "top n, default 10, 0 means all"
+// @Param offset query int false "items skipped"
+// @Param filter query string false "substring of md5 or fingerprint, case insensitive"
+// @Param fields query string false "json fields of items separated by comma, default all"
+// @Param window query string false "time window like 5m, at most 60m, default all"
+// @Param reset query bool false "reset stats after read"
+// @Success 200 {array} SQLStats
+// @Security BasicAuth
+// @Router /api/proxy/stats/sql/topn/{namespace} [get]
+func (s *AdminServer) getNamespaceSQLStatsTopN(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	opts, err := parseListOptions(c, 10)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	var window time.Duration
+	if w := strings.TrimSpace(c.Query("window")); w != "" {
+		if window, err = time.ParseDuration(w); err != nil {
+			c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid window: %s", w))
+			return
+		}
+	}
+
+	stats, err := namespace.GetSQLStatsTopN(strings.TrimSpace(c.Query("sort")), 0, window)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if c.Query("reset") == "true" {
+		namespace.ResetSQLStats()
+	}
+
+	matched := make([]*SQLStats, 0, len(stats))
+	for _, st := range stats {
+		if opts.match(st.MD5, st.Fingerprint) {
+			matched = append(matched, st)
+		}
+	}
+	start, end := opts.page(len(matched))
+	c.Header(totalCountHeader, strconv.Itoa(len(matched)))
+	opts.render(c, matched[start:end])
+}
+
+// @Summary 清空SQL指纹执行统计
+// @Description 通过管理接口清空按SQL指纹统计的执行信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/stats/sql/{namespace} [delete]
+func (s *AdminServer) resetNamespaceSQLStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	namespace.ResetSQLStats()
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 获取逻辑表读写统计
+// @Description 通过管理接口获取按逻辑表统计的读写次数、QPS和延迟分位数, 需配置namespace的table_stats_capacity
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param window query string false "time window like 5m, at most 60m, default 1m, 0 means since recorded"
+// @Param reset query bool false "reset stats after read"
+// @Success 200 {array} TableStats
+// @Security BasicAuth
+// @Router /api/proxy/stats/table/{namespace} [get]
+func (s *AdminServer) getNamespaceTableStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	w := strings.TrimSpace(c.DefaultQuery("window", "1m"))
+	window, err := time.ParseDuration(w)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid window: %s", w))
+		return
+	}
+
+	stats, err := namespace.GetTableStats(window)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if c.Query("reset") == "true" {
+		namespace.ResetTableStats()
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary 清空逻辑表读写统计
+// @Description 通过管理接口清空按逻辑表统计的读写信息
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/stats/table/{namespace} [delete]
+func (s *AdminServer) resetNamespaceTableStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	namespace.ResetTableStats()
+
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 获取流量镜像统计
+// @Description 通过管理接口获取复制到镜像slice的SQL执行次数、错误数、丢弃数和延迟分位数, 需配置namespace的mirror
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param window query string false "time window like 5m, at most 60m, default 1m, 0 means since mirror started"
+// @Success 200 {object} MirrorStats
+// @Security BasicAuth
+// @Router /api/proxy/stats/mirror/{namespace} [get]
+func (s *AdminServer) getNamespaceMirrorStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	w := strings.TrimSpace(c.DefaultQuery("window", "1m"))
+	window, err := time.ParseDuration(w)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid window: %s", w))
+		return
+	}
+
+	stats, err := namespace.GetMirrorStats(window)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary 获取binlog订阅状态
+// @Description 获取namespace下各slice主库binlog订阅的位点和状态, 以及binlog中各物理表的变更次数
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {object} BinlogStats
+// @Security BasicAuth
+// @Router /api/proxy/stats/binlog/{namespace} [get]
+func (s *AdminServer) getNamespaceBinlogStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	stats, err := namespace.GetBinlogStats()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary 获取行变更事件发布状态
+// @Description 获取namespace下发布到Kafka的行变更事件数量, 包括发送成功、失败、队列满丢弃和等待发送的事件数
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Success 200 {object} CDCStats
+// @Security BasicAuth
+// @Router /api/proxy/stats/cdc/{namespace} [get]
+func (s *AdminServer) getNamespaceCDCStats(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	stats, err := namespace.GetCDCStats()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary 获取后端连接池中的连接信息
+// @Description 通过管理接口获取namespace下各个slice的后端连接信息, 包括地址、连接时长、空闲时长和最后执行的SQL
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param limit query int false "page size of connections in each slice, default 0 means all"
+// @Param offset query int false "items skipped in each slice"
+// @Param filter query string false "substring of addr or last sql, case insensitive"
+// @Param fields query string false "json fields of connections separated by comma, default all"
+// @Success 200 {object} map[string][]backend.PooledConnectInfo
+// @Security BasicAuth
+// @Router /api/proxy/backend/connections/{namespace} [get]
+func (s *AdminServer) getNamespaceBackendConnections(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+
+	opts, err := parseListOptions(c, 0)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	ret := namespace.GetBackendConnections()
+	for name, infos := range ret {
+		matched := make([]*backend.PooledConnectInfo, 0, len(infos))
+		for _, info := range infos {
+			if opts.match(info.Addr, info.LastSQL) {
+				matched = append(matched, info)
+			}
+		}
+		start, end := opts.page(len(matched))
+		ret[name] = matched[start:end]
+	}
+	opts.render(c, ret)
+}
+
+// @Summary 强制关闭后端连接
+// @Description 通过管理接口强制关闭指定的后端连接, 用于处理泄漏或卡住的连接, 连接在使用中时当前请求会报错
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param slice path string true "slice name"
+// @Param id path int true "mysql connection id"
+// @Param addr query string true "backend addr"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/backend/connections/{namespace}/{slice}/{id} [delete]
+func (s *AdminServer) killNamespaceBackendConnection(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	sliceName := strings.TrimSpace(c.Param("slice"))
+	slice := namespace.GetSlice(sliceName)
+	if slice == nil {
+		c.JSON(selfDefinedInternalError, "slice not found")
+		return
+	}
+	connectionID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid connection id: %s", c.Param("id")))
+		return
+	}
+	addr := strings.TrimSpace(c.Query("addr"))
+	if addr == "" {
+		c.JSON(selfDefinedInternalError, "missing backend addr")
+		return
+	}
+
+	if !slice.KillConnection(addr, connectionID) {
+		c.JSON(selfDefinedInternalError, "connection not found")
+		return
+	}
+	log.Notice("kill backend connection, namespace: %s, slice: %s, addr: %s, connection id: %d", ns, sliceName, addr, connectionID)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 下线后端从库
+// @Description 通过管理接口将从库或统计从库标记为下线, 读流量不再路由到该实例, 健康检查不会将其恢复, 用于DBA维护
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param slice path string true "slice name"
+// @Param addr query string true "backend addr"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/backend/offline/{namespace}/{slice} [put]
+func (s *AdminServer) setBackendOffline(c *gin.Context) {
+	s.setBackendStatus(c, true)
+}
+
+// @Summary 上线后端从库
+// @Description 通过管理接口取消从库或统计从库的下线标记, 健康检查通过后恢复读流量
+// @Produce  json
+// @Param namespace path string true "namespace name"
+// @Param slice path string true "slice name"
+// @Param addr query string true "backend addr"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/backend/online/{namespace}/{slice} [put]
+func (s *AdminServer) setBackendOnline(c *gin.Context) {
+	s.setBackendStatus(c, false)
+}
+
+func (s *AdminServer) setBackendStatus(c *gin.Context, offline bool) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	sliceName := strings.TrimSpace(c.Param("slice"))
+	slice := namespace.GetSlice(sliceName)
+	if slice == nil {
+		c.JSON(selfDefinedInternalError, "slice not found")
+		return
+	}
+	addr := strings.TrimSpace(c.Query("addr"))
+	if addr == "" {
+		c.JSON(selfDefinedInternalError, "missing backend addr")
+		return
+	}
+
+	var err error
+	if offline {
+		err = slice.SetOffline(addr)
+	} else {
+		err = slice.SetOnline(addr)
+	}
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("set backend offline: %v, namespace: %s, slice: %s, addr: %s", offline, ns, sliceName, addr)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 获取客户端会话
+// @Description 返回经过握手的客户端会话及其状态, 正在执行的会话在前, sql 为正在执行的 sql 的指纹
+// @Produce  json
+// @Success 200 {array} SessionInfo
+// @Security BasicAuth
+// @Router /api/proxy/diagnostics/sessions [get]
+func (s *AdminServer) getSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.GetSessions())
+}
+
+// @Summary 导出诊断信息
+// @Description 将 goroutine、heap profile、客户端会话、后端连接池状态和 namespace 配置版本打包写入日志目录, 用于离线分析, 返回文件路径
+// @Produce  json
+// @Success 200 {string} string "path of diagnostics bundle"
+// @Security BasicAuth
+// @Router /api/proxy/diagnostics/dump [put]
+func (s *AdminServer) dumpDiagnostics(c *gin.Context) {
+	path, err := s.proxy.DumpDiagnostics()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Notice("dump diagnostics to %s", path)
+	c.JSON(http.StatusOK, path)
+}
+
+// @Summary 获取注入的后端故障
+// @Description 仅在使用 chaos tag 编译时可用, 返回当前注入的后端故障
+// @Produce  json
+// @Success 200 {array} backend.Fault
+// @Security BasicAuth
+// @Router /api/proxy/chaos/fault [get]
+func (s *AdminServer) listFaults(c *gin.Context) {
+	c.JSON(http.StatusOK, backend.ListFaults())
+}
+
+// @Summary 注入后端故障
+// @Description 仅在使用 chaos tag 编译时可用, 对匹配后端地址和 sql 指纹的请求断开连接、延迟或返回指定错误
+// @Produce  json
+// @Param fault body backend.Fault true "fault"
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/chaos/fault [put]
+func (s *AdminServer) addFault(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	fault := &backend.Fault{}
+	if err = json.Unmarshal(data, fault); err != nil {
+		c.JSON(selfDefinedInternalError, fmt.Sprintf("invalid fault: %v", err))
+		return
+	}
+	if err = backend.AddFault(fault); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Warn("add backend fault: %+v", *fault)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// @Summary 清除注入的后端故障
+// @Description 仅在使用 chaos tag 编译时可用
+// @Produce  json
+// @Success 200 {string} string "OK"
+// @Security BasicAuth
+// @Router /api/proxy/chaos/fault [delete]
+func (s *AdminServer) clearFaults(c *gin.Context) {
+	backend.ClearFaults()
+	log.Warn("clear backend faults")
 	c.JSON(http.StatusOK, "OK")
 }
 
@@ -0,0 +1,137 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	adminAccountKey = "admin_account"
+	adminAuthRealm  = `Basic realm="Authorization Required"`
+)
+
+// scopedGlobalRoutes routes without namespace in path which are allowed for accounts limited to namespaces,
+// results of them are filtered by namespaces of account. Other global routes require global account
+var scopedGlobalRoutes = map[string]bool{
+	"/api/proxy/ping":           true,
+	"/api/proxy/namespace/list": true,
+}
+
+// auditedGetRoutes GET routes recorded in audit log since they return passwords in namespace config
+var auditedGetRoutes = map[string]bool{
+	"/api/proxy/config/namespace/:name": true,
+	"/api/proxy/config/export/:name":    true,
+}
+
+// adminAccounts accounts of admin api, admin_user of proxy config is super admin
+type adminAccounts struct {
+	sync.RWMutex
+	accounts map[string]*models.AdminAccount // key: user
+}
+
+func newAdminAccounts(cfg *models.Proxy) (*adminAccounts, error) {
+	a := &adminAccounts{}
+	if err := a.reload(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload load accounts of admin_user and admin_accounts_file
+func (a *adminAccounts) reload(cfg *models.Proxy) error {
+	accounts := map[string]*models.AdminAccount{
+		cfg.AdminUser: {User: cfg.AdminUser, Password: cfg.AdminPassword, Role: models.AdminRoleSuperAdmin},
+	}
+	if cfg.AdminAccountsFile != "" {
+		list, err := models.LoadAdminAccounts(cfg.AdminAccountsFile)
+		if err != nil {
+			return err
+		}
+		for _, account := range list {
+			if _, ok := accounts[account.User]; ok {
+				return fmt.Errorf("admin account %s is the same as admin_user", account.User)
+			}
+			accounts[account.User] = account
+		}
+	}
+	a.Lock()
+	a.accounts = accounts
+	a.Unlock()
+	return nil
+}
+
+// check return account of user if password is right
+func (a *adminAccounts) check(user, password string) *models.AdminAccount {
+	a.RLock()
+	account, ok := a.accounts[user]
+	a.RUnlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(account.Password)) != 1 {
+		return nil
+	}
+	return account
+}
+
+// authRequired authenticate account by basic auth, and check its role and namespace in path,
+// routes without namespace in path are global and require account not limited to namespaces except scopedGlobalRoutes,
+// requests except GET are recorded in audit log, GET requests returning passwords as well
+func (s *AdminServer) authRequired(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, password, _ := c.Request.BasicAuth()
+		account := s.accounts.check(user, password)
+		if account == nil {
+			c.Header("WWW-Authenticate", adminAuthRealm)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if c.Request.Method != http.MethodGet || auditedGetRoutes[c.FullPath()] {
+			defer func() {
+				auditAdmin(account, c.ClientIP(), c.Request.Method+" "+c.Request.URL.RequestURI(), strconv.Itoa(c.Writer.Status()))
+			}()
+		}
+
+		ns := c.Param("namespace")
+		if ns == "" {
+			ns = c.Param("name")
+		}
+		ns = strings.TrimSpace(ns)
+		global := ns == "" && !scopedGlobalRoutes[c.FullPath()]
+		if !account.HasRole(role) || (global && !account.IsGlobal()) || (ns != "" && !account.CanAccess(ns)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, "permission denied")
+			return
+		}
+		c.Set(adminAccountKey, account)
+		c.Next()
+	}
+}
+
+// getAdminAccount return account of request authenticated by authRequired
+func getAdminAccount(c *gin.Context) *models.AdminAccount {
+	return c.MustGet(adminAccountKey).(*models.AdminAccount)
+}
+
+// auditAdmin record operation of admin account
+func auditAdmin(account *models.AdminAccount, client, operation, result string) {
+	log.Notice("[admin audit] user: %s, role: %s, client: %s, operation: %s, result: %s", account.User, account.Role, client, operation, result)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuthRequired(t *testing.T) {
+	accounts, err := newAdminAccounts(&models.Proxy{AdminUser: "admin", AdminPassword: "secret"})
+	assert.Nil(t, err)
+	accounts.accounts["viewer"] = &models.AdminAccount{User: "viewer", Password: "v", Role: models.AdminRoleViewer}
+	accounts.accounts["operator"] = &models.AdminAccount{User: "operator", Password: "o", Role: models.AdminRoleNamespaceOperator, Namespaces: []string{"ns1"}}
+
+	s := &AdminServer{accounts: accounts, engine: gin.New()}
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, getAdminAccount(c).User) }
+	s.engine.GET("/stats/:namespace", s.authRequired(models.AdminRoleViewer), ok)
+	s.engine.PUT("/prepare/:name", s.authRequired(models.AdminRoleNamespaceOperator), ok)
+	s.engine.PUT("/reload", s.authRequired(models.AdminRoleSuperAdmin), ok)
+	s.engine.GET("/api/proxy/config/fingerprint", s.authRequired(models.AdminRoleViewer), ok)
+	s.engine.POST("/api/proxy/config/verify", s.authRequired(models.AdminRoleViewer), ok)
+	s.engine.GET("/api/metric/metrics", s.authRequired(models.AdminRoleViewer), ok)
+	s.engine.GET("/api/proxy/namespace/list", s.authRequired(models.AdminRoleViewer), ok)
+
+	for _, test := range []struct {
+		user, password string
+		method, path   string
+		code           int
+	}{
+		{"admin", "wrong", http.MethodGet, "/stats/ns1", http.StatusUnauthorized},
+		{"nobody", "", http.MethodGet, "/stats/ns1", http.StatusUnauthorized},
+		{"admin", "secret", http.MethodPut, "/reload", http.StatusOK},
+		{"admin", "secret", http.MethodPut, "/prepare/ns2", http.StatusOK},
+		{"viewer", "v", http.MethodGet, "/stats/ns2", http.StatusOK},
+		{"viewer", "v", http.MethodPut, "/prepare/ns1", http.StatusForbidden},
+		{"operator", "o", http.MethodGet, "/stats/ns1", http.StatusOK},
+		{"operator", "o", http.MethodGet, "/stats/ns2", http.StatusForbidden},
+		{"operator", "o", http.MethodPut, "/prepare/ns1", http.StatusOK},
+		{"operator", "o", http.MethodPut, "/prepare/ns2", http.StatusForbidden},
+		{"operator", "o", http.MethodPut, "/reload", http.StatusForbidden},
+		// global routes require account not limited to namespaces
+		{"viewer", "v", http.MethodGet, "/api/proxy/config/fingerprint", http.StatusOK},
+		{"viewer", "v", http.MethodPost, "/api/proxy/config/verify", http.StatusOK},
+		{"viewer", "v", http.MethodGet, "/api/metric/metrics", http.StatusOK},
+		{"operator", "o", http.MethodGet, "/api/proxy/config/fingerprint", http.StatusForbidden},
+		{"operator", "o", http.MethodPost, "/api/proxy/config/verify", http.StatusForbidden},
+		{"operator", "o", http.MethodGet, "/api/metric/metrics", http.StatusForbidden},
+		{"operator", "o", http.MethodGet, "/api/proxy/namespace/list", http.StatusOK},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.SetBasicAuth(test.user, test.password)
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		assert.Equal(t, test.code, w.Code, test.user+" "+test.path)
+	}
+}
+
+func TestAdminAccountsReload(t *testing.T) {
+	accounts, err := newAdminAccounts(&models.Proxy{AdminUser: "admin", AdminPassword: "secret"})
+	assert.Nil(t, err)
+	assert.NotNil(t, accounts.check("admin", "secret"))
+	assert.Nil(t, accounts.check("admin", ""))
+
+	err = accounts.reload(&models.Proxy{AdminUser: "admin", AdminPassword: "new", AdminAccountsFile: "not_exist.json"})
+	assert.NotNil(t, err)
+	// accounts are kept if reload failed
+	assert.NotNil(t, accounts.check("admin", "secret"))
+
+	assert.Nil(t, accounts.reload(&models.Proxy{AdminUser: "admin", AdminPassword: "new"}))
+	assert.Nil(t, accounts.check("admin", "secret"))
+	assert.NotNil(t, accounts.check("admin", "new"))
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totalCountHeader is header of item count matching filter before paging
+const totalCountHeader = "X-Total-Count"
+
+// listOptions paging, filtering and field selection of admin list apis,
+// parsed from query parameters limit, offset, filter and fields
+type listOptions struct {
+	limit  int    // 0 means all
+	offset int    // items skipped
+	filter string // lower case substring matched by items, empty means all
+	fields map[string]bool
+}
+
+func parseListOptions(c *gin.Context, defaultLimit int) (*listOptions, error) {
+	o := &listOptions{limit: defaultLimit, filter: strings.ToLower(strings.TrimSpace(c.Query("filter")))}
+	var err error
+	if v := strings.TrimSpace(c.Query("limit")); v != "" {
+		if o.limit, err = strconv.Atoi(v); err != nil || o.limit < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if v := strings.TrimSpace(c.Query("offset")); v != "" {
+		if o.offset, err = strconv.Atoi(v); err != nil || o.offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+	if v := strings.TrimSpace(c.Query("fields")); v != "" {
+		o.fields = make(map[string]bool)
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				o.fields[f] = true
+			}
+		}
+	}
+	return o, nil
+}
+
+// match check if any of values contains filter, case insensitive
+func (o *listOptions) match(values ...string) bool {
+	if o.filter == "" {
+		return true
+	}
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), o.filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// page return range [start, end) of current page in n items
+func (o *listOptions) page(n int) (int, int) {
+	start := o.offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if o.limit > 0 && start+o.limit < n {
+		end = start + o.limit
+	}
+	return start, end
+}
+
+// pageMap filter items of map by key and value, and return current page ordered by key
+func (o *listOptions) pageMap(items map[string]string) map[string]string {
+	keys := make([]string, 0, len(items))
+	for k, v := range items {
+		if o.match(k, v) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start, end := o.page(len(keys))
+	ret := make(map[string]string, end-start)
+	for _, k := range keys[start:end] {
+		ret[k] = items[k]
+	}
+	return ret
+}
+
+// render write v as json, only selected fields of objects in lists are kept if fields is set
+func (o *listOptions) render(c *gin.Context, v interface{}) {
+	if len(o.fields) == 0 {
+		c.JSON(http.StatusOK, v)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	var ret interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&ret); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	o.selectFields(ret)
+	c.JSON(http.StatusOK, ret)
+}
+
+func (o *listOptions) selectFields(v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				for k := range m {
+					if !o.fields[k] {
+						delete(m, k)
+					}
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			o.selectFields(item)
+		}
+	}
+}
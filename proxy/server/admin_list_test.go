@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newListContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/list?"+query, nil)
+	return c
+}
+
+func TestParseListOptions(t *testing.T) {
+	opts, err := parseListOptions(newListContext(""), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, &listOptions{limit: 10}, opts)
+
+	opts, err = parseListOptions(newListContext("limit=0&offset=5&filter=Ns&fields=a,,b"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, &listOptions{offset: 5, filter: "ns", fields: map[string]bool{"a": true, "b": true}}, opts)
+
+	for _, query := range []string{"limit=a", "limit=-1", "offset=-1"} {
+		_, err = parseListOptions(newListContext(query), 0)
+		assert.NotNil(t, err, query)
+	}
+}
+
+func TestListOptionsPage(t *testing.T) {
+	for _, test := range []struct {
+		limit, offset, n int
+		start, end       int
+	}{
+		{0, 0, 5, 0, 5},
+		{2, 0, 5, 0, 2},
+		{2, 4, 5, 4, 5},
+		{2, 6, 5, 5, 5},
+		{0, 3, 5, 3, 5},
+	} {
+		start, end := (&listOptions{limit: test.limit, offset: test.offset}).page(test.n)
+		assert.Equal(t, test.start, start)
+		assert.Equal(t, test.end, end)
+	}
+
+	opts := &listOptions{limit: 1, offset: 1, filter: "select"}
+	ret := opts.pageMap(map[string]string{"a": "select 1", "b": "update t", "c": "SELECT 2", "d": "select 3"})
+	assert.Equal(t, map[string]string{"c": "SELECT 2"}, ret)
+}
+
+func TestListOptionsRender(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	opts := &listOptions{fields: map[string]bool{"md5": true, "count": true}}
+	opts.render(c, map[string][]*SQLStats{"s0": {{MD5: "m", Fingerprint: "f", Count: 12345678901234567}}})
+
+	var ret map[string][]map[string]interface{}
+	d := json.NewDecoder(w.Body)
+	d.UseNumber()
+	assert.Nil(t, d.Decode(&ret))
+	assert.Equal(t, map[string][]map[string]interface{}{"s0": {{"md5": "m", "count": json.Number("12345678901234567")}}}, ret)
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/binlog"
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// BinlogStats status of binlog tailers and tables changed on slice masters
+type BinlogStats struct {
+	Tailers map[string]binlog.Status `json:"tailers"` // key: slice name
+	Tables  []*TableChangeStats      `json:"tables"`
+}
+
+// TableChangeStats changes of a physical table found in binlog since tailer started
+type TableChangeStats struct {
+	Slice          string `json:"slice"`
+	DB             string `json:"db"`
+	Table          string `json:"table"` // empty if table of statement is unknown
+	Inserts        uint64 `json:"inserts"`
+	Updates        uint64 `json:"updates"`
+	Deletes        uint64 `json:"deletes"`
+	DDLs           uint64 `json:"ddls"`
+	LastChangeTime string `json:"last_change_time"`
+}
+
+// binlogTailers tail binlog of slice masters and record changed tables, including changes not made through gaea.
+// Proxy side state derived from backend data, like caches, should be refreshed in handle.
+type binlogTailers struct {
+	tailers map[string]*binlog.Tailer // key: slice name
+
+	mu     sync.Mutex
+	tables map[string]*TableChangeStats // key: slice.db.table
+}
+
+func newBinlogTailers(cfg *models.BinlogTailer, slices map[string]*backend.Slice) (*binlogTailers, error) {
+	user, err := models.ResolveSecret(cfg.UserName)
+	if err != nil {
+		return nil, fmt.Errorf("resolve user name of binlog_tailer error: %v", err)
+	}
+	password, err := models.ResolveSecret(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("resolve password of binlog_tailer error: %v", err)
+	}
+
+	names := cfg.Slices
+	if len(names) == 0 {
+		for name := range slices {
+			names = append(names, name)
+		}
+	}
+	b := &binlogTailers{
+		tailers: make(map[string]*binlog.Tailer, len(names)),
+		tables:  make(map[string]*TableChangeStats),
+	}
+	for _, name := range names {
+		slice, ok := slices[name]
+		if !ok {
+			return nil, fmt.Errorf("slice of binlog_tailer not found: %s", name)
+		}
+		sliceUser, slicePassword := user, password
+		if sliceUser == "" {
+			sliceUser, slicePassword = slice.Cfg.UserName, slice.Cfg.Password
+		}
+		sliceName := name
+		b.tailers[name] = binlog.NewTailer(slice.Cfg.Master, sliceUser, slicePassword, 0, func(changes []*binlog.Change) {
+			b.handle(sliceName, changes)
+		})
+	}
+	return b, nil
+}
+
+func (b *binlogTailers) start() {
+	for _, t := range b.tailers {
+		t.Start()
+	}
+}
+
+func (b *binlogTailers) close() {
+	for _, t := range b.tailers {
+		t.Close()
+	}
+}
+
+func (b *binlogTailers) handle(slice string, changes []*binlog.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range changes {
+		key := slice + "." + c.DB + "." + c.Table
+		s, ok := b.tables[key]
+		if !ok {
+			s = &TableChangeStats{Slice: slice, DB: c.DB, Table: c.Table}
+			b.tables[key] = s
+		}
+		switch c.Type {
+		case binlog.ChangeInsert:
+			s.Inserts++
+		case binlog.ChangeUpdate:
+			s.Updates++
+		case binlog.ChangeDelete:
+			s.Deletes++
+		case binlog.ChangeDDL:
+			s.DDLs++
+		}
+		s.LastChangeTime = c.Time.Format("2006-01-02 15:04:05")
+	}
+}
+
+func (b *binlogTailers) stats() *BinlogStats {
+	stats := &BinlogStats{Tailers: make(map[string]binlog.Status, len(b.tailers))}
+	for name, t := range b.tailers {
+		stats.Tailers[name] = t.Status()
+	}
+
+	b.mu.Lock()
+	stats.Tables = make([]*TableChangeStats, 0, len(b.tables))
+	for _, s := range b.tables {
+		c := *s
+		stats.Tables = append(stats.Tables, &c)
+	}
+	b.mu.Unlock()
+	sort.Slice(stats.Tables, func(i, j int) bool {
+		a, c := stats.Tables[i], stats.Tables[j]
+		if a.Slice != c.Slice {
+			return a.Slice < c.Slice
+		}
+		if a.DB != c.DB {
+			return a.DB < c.DB
+		}
+		return a.Table < c.Table
+	})
+	return stats
+}
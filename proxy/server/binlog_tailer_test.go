@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/binlog"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinlogTailersStats(t *testing.T) {
+	slices := map[string]*backend.Slice{
+		"slice-0": {Cfg: models.Slice{Name: "slice-0", Master: "127.0.0.1:3306", UserName: "root"}},
+		"slice-1": {Cfg: models.Slice{Name: "slice-1", Master: "127.0.0.1:3307", UserName: "root"}},
+	}
+	_, err := newBinlogTailers(&models.BinlogTailer{Slices: []string{"slice-2"}}, slices)
+	assert.NotNil(t, err)
+
+	b, err := newBinlogTailers(&models.BinlogTailer{UserName: "repl", Password: "repl"}, slices)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(b.tailers))
+
+	now := time.Now()
+	b.handle("slice-1", []*binlog.Change{
+		{DB: "db_0", Table: "tbl_0002", Type: binlog.ChangeInsert, Time: now},
+		{DB: "db_0", Table: "tbl_0002", Type: binlog.ChangeUpdate, Time: now},
+	})
+	b.handle("slice-0", []*binlog.Change{{DB: "db_0", Table: "tbl_0000", Type: binlog.ChangeDDL, Time: now}})
+	b.handle("slice-1", []*binlog.Change{{DB: "db_0", Table: "tbl_0002", Type: binlog.ChangeInsert, Time: now}})
+
+	stats := b.stats()
+	assert.Equal(t, "127.0.0.1:3307", stats.Tailers["slice-1"].Addr)
+	assert.False(t, stats.Tailers["slice-1"].Running)
+	if assert.Equal(t, 2, len(stats.Tables)) {
+		assert.Equal(t, TableChangeStats{Slice: "slice-0", DB: "db_0", Table: "tbl_0000", DDLs: 1, LastChangeTime: now.Format("2006-01-02 15:04:05")}, *stats.Tables[0])
+		assert.Equal(t, uint64(2), stats.Tables[1].Inserts)
+		assert.Equal(t, uint64(1), stats.Tables[1].Updates)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+// resourceBudget limits result set memory and concurrent backend executions of a namespace,
+// so one namespace can't starve others in a shared proxy. Zero limit means no limit.
+type resourceBudget struct {
+	maxMemory      int64 // bytes
+	maxConcurrency int64
+
+	memory      sync2.AtomicInt64 // bytes of result sets held by sessions
+	concurrency sync2.AtomicInt64 // backend executions in progress
+}
+
+func newResourceBudget(maxMemoryMB int64, maxConcurrency int) *resourceBudget {
+	return &resourceBudget{
+		maxMemory:      maxMemoryMB << 20,
+		maxConcurrency: int64(maxConcurrency),
+	}
+}
+
+// acquireConcurrency reserve n backend executions, fail at once instead of waiting if budget is exceeded
+func (b *resourceBudget) acquireConcurrency(namespace string, n int) error {
+	if b.concurrency.Add(int64(n)) > b.maxConcurrency && b.maxConcurrency > 0 {
+		b.concurrency.Add(-int64(n))
+		return mysql.NewError(mysql.ErrOutOfResources,
+			fmt.Sprintf("namespace %s exceeds backend concurrency budget %d, need %d", namespace, b.maxConcurrency, n))
+	}
+	return nil
+}
+
+func (b *resourceBudget) releaseConcurrency(n int) {
+	b.concurrency.Add(-int64(n))
+}
+
+// reserveMemory reserve size bytes for result sets, it should be released after response is written
+func (b *resourceBudget) reserveMemory(namespace string, size int64) error {
+	if b.memory.Add(size) > b.maxMemory && b.maxMemory > 0 {
+		b.memory.Add(-size)
+		return mysql.NewError(mysql.ErrOutOfResources,
+			fmt.Sprintf("namespace %s exceeds result memory budget %d bytes, need %d bytes", namespace, b.maxMemory, size))
+	}
+	return nil
+}
+
+func (b *resourceBudget) releaseMemory(size int64) {
+	b.memory.Add(-size)
+}
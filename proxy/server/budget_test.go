@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestResourceBudget(t *testing.T) {
+	b := newResourceBudget(1, 2)
+	if err := b.acquireConcurrency("ns", 2); err != nil {
+		t.Fatalf("acquire concurrency error: %v", err)
+	}
+	err := b.acquireConcurrency("ns", 1)
+	if sqlErr, ok := err.(*mysql.SQLError); !ok || sqlErr.Code != mysql.ErrOutOfResources {
+		t.Fatalf("concurrency budget should be exceeded, err: %v", err)
+	}
+	b.releaseConcurrency(2)
+	if b.concurrency.Get() != 0 {
+		t.Errorf("concurrency should be released, got: %d", b.concurrency.Get())
+	}
+
+	if err := b.reserveMemory("ns", 1<<19); err != nil {
+		t.Fatalf("reserve memory error: %v", err)
+	}
+	if err := b.reserveMemory("ns", 1<<20); err == nil {
+		t.Fatalf("memory budget should be exceeded")
+	}
+	if b.memory.Get() != 1<<19 {
+		t.Errorf("failed reservation should be rolled back, got: %d", b.memory.Get())
+	}
+	b.releaseMemory(1 << 19)
+
+	unlimited := newResourceBudget(0, 0)
+	if err := unlimited.acquireConcurrency("ns", 1000); err != nil {
+		t.Errorf("zero concurrency budget means no limit, err: %v", err)
+	}
+	if err := unlimited.reserveMemory("ns", 1<<40); err != nil {
+		t.Errorf("zero memory budget means no limit, err: %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/opcode"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
+	"github.com/XiaoMi/Gaea/util/kafka"
+)
+
+const (
+	cdcBatchSize     = 500
+	cdcSendTimeout   = 5 * time.Second
+	cdcSendAttempts  = 3
+	cdcRetryInterval = time.Second
+)
+
+// CDCEvent is row change event published to kafka, one event for each primary key
+type CDCEvent struct {
+	Namespace  string  `json:"namespace"`
+	DB         string  `json:"db"`
+	Table      string  `json:"table"`
+	Slice      string  `json:"slice"`
+	PhyDB      string  `json:"phy_db"`
+	PhyTable   string  `json:"phy_table"`
+	Op         string  `json:"op"`          // insert, replace, update or delete
+	PrimaryKey *string `json:"primary_key"` // nil if primary key is not found in sql, rows changed are decided by SQL
+	SQL        string  `json:"sql,omitempty"`
+	CommitTime int64   `json:"commit_time"` // unix milliseconds
+}
+
+// CDCStats stats of change events publishing
+type CDCStats struct {
+	Topic     string `json:"topic"`
+	Published uint64 `json:"published"`
+	Failed    uint64 `json:"failed"`  // failed to send to kafka after retries
+	Dropped   uint64 `json:"dropped"` // dropped because queue is full
+	Pending   int    `json:"pending"`
+}
+
+// messageSender send messages to kafka
+type messageSender interface {
+	Send(topic string, msgs []*kafka.Message) error
+	Close()
+}
+
+// cdcPublisher extract change events from sqls executed on backends and publish them to kafka asynchronously
+type cdcPublisher struct {
+	// first fields to be 64-bit aligned for atomic operations
+	published uint64
+	failed    uint64
+	dropped   uint64
+
+	namespace string
+	topic     string
+	tables    map[string]string // key: db.table in lower case, value: primary key column in lower case
+	sender    messageSender
+
+	events chan *CDCEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newCDCPublisher(namespace string, cfg *models.CDC, sender messageSender) *cdcPublisher {
+	c := &cdcPublisher{
+		namespace: namespace,
+		topic:     cfg.Topic,
+		tables:    make(map[string]string, len(cfg.Tables)),
+		sender:    sender,
+		events:    make(chan *CDCEvent, cfg.GetQueueSize()),
+		done:      make(chan struct{}),
+	}
+	for _, t := range cfg.Tables {
+		c.tables[strings.ToLower(t.DB+"."+t.Table)] = strings.ToLower(t.PrimaryKey)
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// buildEvents build events of physical sql, tables are logical tables of statement in db.table format
+func (c *cdcPublisher) buildEvents(tables []string, slice, phyDB, sql string) []*CDCEvent {
+	var table, pk string
+	for _, t := range tables {
+		if k, ok := c.tables[t]; ok {
+			table, pk = t, k
+			break
+		}
+	}
+	if table == "" {
+		return nil
+	}
+
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		log.Warn("[ns:%s] parse sql of cdc error, sql: %s, err: %v", c.namespace, sql, err)
+		return nil
+	}
+	var op string
+	var refs *ast.TableRefsClause
+	var keys []string
+	var found bool
+	switch s := stmt.(type) {
+	case *ast.InsertStmt:
+		op = "insert"
+		if s.IsReplace {
+			op = "replace"
+		}
+		refs = s.Table
+		keys, found = insertKeys(s, pk)
+	case *ast.UpdateStmt:
+		op = "update"
+		refs = s.TableRefs
+		keys, found = whereKeys(s.Where, pk)
+	case *ast.DeleteStmt:
+		op = "delete"
+		refs = s.TableRefs
+		keys, found = whereKeys(s.Where, pk)
+	default:
+		return nil
+	}
+
+	phyTable := ""
+	if refs != nil && refs.TableRefs != nil {
+		if ts, ok := refs.TableRefs.Left.(*ast.TableSource); ok {
+			if tn, ok := ts.Source.(*ast.TableName); ok {
+				phyTable = tn.Name.O
+			}
+		}
+	}
+	parts := strings.SplitN(table, ".", 2)
+	newEvent := func() *CDCEvent {
+		return &CDCEvent{
+			Namespace: c.namespace,
+			DB:        parts[0],
+			Table:     parts[1],
+			Slice:     slice,
+			PhyDB:     phyDB,
+			PhyTable:  phyTable,
+			Op:        op,
+		}
+	}
+	if !found {
+		e := newEvent()
+		e.SQL = sql
+		return []*CDCEvent{e}
+	}
+	events := make([]*CDCEvent, 0, len(keys))
+	for i := range keys {
+		e := newEvent()
+		e.PrimaryKey = &keys[i]
+		events = append(events, e)
+	}
+	return events
+}
+
+// insertKeys return primary keys of inserted rows, false if any of them is not constant
+func insertKeys(s *ast.InsertStmt, pk string) ([]string, bool) {
+	if s.Select != nil {
+		return nil, false
+	}
+	if s.Setlist != nil {
+		for _, a := range s.Setlist {
+			if a.Column.Name.L == pk {
+				v, ok := constantValue(a.Expr)
+				return []string{v}, ok
+			}
+		}
+		return nil, false
+	}
+	index := -1
+	for i, col := range s.Columns {
+		if col.Name.L == pk {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, false
+	}
+	keys := make([]string, 0, len(s.Lists))
+	for _, row := range s.Lists {
+		if index >= len(row) {
+			return nil, false
+		}
+		v, ok := constantValue(row[index])
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, v)
+	}
+	return keys, true
+}
+
+// whereKeys return primary keys in where condition like `pk = 1` or `pk in (1, 2)` joined by AND
+func whereKeys(where ast.ExprNode, pk string) ([]string, bool) {
+	switch e := where.(type) {
+	case *ast.ParenthesesExpr:
+		return whereKeys(e.Expr, pk)
+	case *ast.BinaryOperationExpr:
+		switch e.Op {
+		case opcode.LogicAnd:
+			if keys, ok := whereKeys(e.L, pk); ok {
+				return keys, true
+			}
+			return whereKeys(e.R, pk)
+		case opcode.EQ:
+			col, v := e.L, e.R
+			if _, ok := col.(*ast.ColumnNameExpr); !ok {
+				col, v = e.R, e.L
+			}
+			if !isColumn(col, pk) {
+				return nil, false
+			}
+			key, ok := constantValue(v)
+			return []string{key}, ok
+		}
+	case *ast.PatternInExpr:
+		if e.Not || e.Sel != nil || !isColumn(e.Expr, pk) {
+			return nil, false
+		}
+		keys := make([]string, 0, len(e.List))
+		for _, item := range e.List {
+			v, ok := constantValue(item)
+			if !ok {
+				return nil, false
+			}
+			keys = append(keys, v)
+		}
+		return keys, true
+	}
+	return nil, false
+}
+
+func isColumn(expr ast.ExprNode, name string) bool {
+	c, ok := expr.(*ast.ColumnNameExpr)
+	return ok && c.Name.Name.L == name
+}
+
+func constantValue(expr ast.ExprNode) (string, bool) {
+	v, ok := expr.(*driver.ValueExpr)
+	if !ok {
+		return "", false
+	}
+	s, err := v.ToString()
+	return s, err == nil
+}
+
+// publish queue events of committed statement or transaction, events are dropped if queue is full or publisher is closed
+func (c *cdcPublisher) publish(events []*CDCEvent) {
+	select {
+	case <-c.done:
+		atomic.AddUint64(&c.dropped, uint64(len(events)))
+		return
+	default:
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, e := range events {
+		e.CommitTime = now
+		select {
+		case c.events <- e:
+		default:
+			atomic.AddUint64(&c.dropped, 1)
+		}
+	}
+}
+
+func (c *cdcPublisher) run() {
+	defer c.wg.Done()
+	batch := make([]*CDCEvent, 0, cdcBatchSize)
+	for {
+		select {
+		case e := <-c.events:
+			batch = append(batch[:0], e)
+		case <-c.done:
+			// send queued events before exit
+			batch = c.drain(batch[:0])
+			if len(batch) > 0 {
+				c.send(batch)
+			}
+			return
+		}
+		batch = c.drain(batch)
+		c.send(batch)
+	}
+}
+
+// drain append queued events to batch until it's full
+func (c *cdcPublisher) drain(batch []*CDCEvent) []*CDCEvent {
+	for len(batch) < cdcBatchSize {
+		select {
+		case e := <-c.events:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (c *cdcPublisher) send(events []*CDCEvent) {
+	msgs := make([]*kafka.Message, 0, len(events))
+	for _, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		// events of the same row are sent to the same partition to keep their order
+		key := e.DB + "." + e.Table
+		if e.PrimaryKey != nil {
+			key += "." + *e.PrimaryKey
+		}
+		msgs = append(msgs, &kafka.Message{
+			Key:   []byte(key),
+			Value: value,
+			Time:  time.Unix(0, e.CommitTime*int64(time.Millisecond)),
+		})
+	}
+
+	var err error
+	for i := 0; i < cdcSendAttempts; i++ {
+		if err = c.sender.Send(c.topic, msgs); err == nil {
+			atomic.AddUint64(&c.published, uint64(len(msgs)))
+			return
+		}
+		if i < cdcSendAttempts-1 {
+			select {
+			case <-c.done:
+			case <-time.After(cdcRetryInterval):
+			}
+		}
+	}
+	atomic.AddUint64(&c.failed, uint64(len(msgs)))
+	log.Warn("[ns:%s] publish %d change events to kafka failed: %v", c.namespace, len(msgs), err)
+}
+
+// Stats return stats of publishing since publisher started
+func (c *cdcPublisher) Stats() *CDCStats {
+	return &CDCStats{
+		Topic:     c.topic,
+		Published: atomic.LoadUint64(&c.published),
+		Failed:    atomic.LoadUint64(&c.failed),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+		Pending:   len(c.events),
+	}
+}
+
+// Close send queued events and stop publisher
+func (c *cdcPublisher) Close() {
+	close(c.done)
+	c.wg.Wait()
+	c.sender.Close()
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSender struct {
+	mu     sync.Mutex
+	err    error
+	topics []string
+	msgs   []*kafka.Message
+	closed bool
+}
+
+func (s *fakeSender) Send(topic string, msgs []*kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.topics = append(s.topics, topic)
+	s.msgs = append(s.msgs, msgs...)
+	return nil
+}
+
+func (s *fakeSender) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+func newTestCDCPublisher(sender messageSender) *cdcPublisher {
+	cfg := &models.CDC{
+		Brokers: []string{"127.0.0.1:9092"},
+		Topic:   "gaea_cdc",
+		Tables:  []*models.CDCTable{{DB: "db", Table: "tbl", PrimaryKey: "ID"}},
+	}
+	return newCDCPublisher("ns", cfg, sender)
+}
+
+func primaryKeys(events []*CDCEvent) []string {
+	var keys []string
+	for _, e := range events {
+		if e.PrimaryKey == nil {
+			keys = append(keys, "<nil>")
+			continue
+		}
+		keys = append(keys, *e.PrimaryKey)
+	}
+	return keys
+}
+
+func TestCDCBuildEvents(t *testing.T) {
+	c := newTestCDCPublisher(&fakeSender{})
+	defer c.Close()
+
+	tests := []struct {
+		sql  string
+		op   string
+		keys []string
+	}{
+		{"insert into tbl_0001 (id, name) values (1, 'a'), (2, 'b')", "insert", []string{"1", "2"}},
+		{"replace into tbl_0001 set name = 'a', id = 'k1'", "replace", []string{"k1"}},
+		{"insert into tbl_0001 values (1, 'a')", "insert", []string{"<nil>"}},
+		{"insert into tbl_0001 (id, name) select id, name from tbl_0002", "insert", []string{"<nil>"}},
+		{"update tbl_0001 set name = 'a' where id = 3 and name = 'b'", "update", []string{"3"}},
+		{"update tbl_0001 set name = 'a' where (name = 'b' and 4 = id)", "update", []string{"4"}},
+		{"delete from tbl_0001 where id in (5, 6)", "delete", []string{"5", "6"}},
+		{"delete from tbl_0001 where id = 5 or id = 6", "delete", []string{"<nil>"}},
+		{"delete from tbl_0001 where id > 5", "delete", []string{"<nil>"}},
+	}
+	for _, test := range tests {
+		events := c.buildEvents([]string{"db.tbl"}, "slice-0", "db_0", test.sql)
+		assert.Equal(t, test.keys, primaryKeys(events), test.sql)
+		for _, e := range events {
+			assert.Equal(t, CDCEvent{
+				Namespace:  "ns",
+				DB:         "db",
+				Table:      "tbl",
+				Slice:      "slice-0",
+				PhyDB:      "db_0",
+				PhyTable:   "tbl_0001",
+				Op:         test.op,
+				PrimaryKey: e.PrimaryKey,
+				SQL:        e.SQL,
+			}, *e, test.sql)
+			// sql is kept only if primary key is unknown
+			assert.Equal(t, e.PrimaryKey == nil, e.SQL == test.sql, test.sql)
+		}
+	}
+
+	// tables not configured and non-write statements are ignored
+	assert.Nil(t, c.buildEvents([]string{"db.other"}, "slice-0", "db_0", "delete from other where id = 1"))
+	assert.Nil(t, c.buildEvents([]string{"db.tbl"}, "slice-0", "db_0", "select * from tbl_0001 where id = 1"))
+}
+
+func TestCDCPublish(t *testing.T) {
+	sender := &fakeSender{}
+	c := newTestCDCPublisher(sender)
+
+	events := c.buildEvents([]string{"db.tbl"}, "slice-0", "db_0", "delete from tbl_0001 where id in (5, 6)")
+	c.publish(events)
+	c.Close()
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Published)
+	assert.Equal(t, uint64(0), stats.Failed)
+	assert.True(t, sender.closed)
+	if assert.Equal(t, 2, len(sender.msgs)) {
+		assert.Equal(t, []string{"gaea_cdc"}, sender.topics)
+		assert.Equal(t, "db.tbl.5", string(sender.msgs[0].Key))
+		assert.Equal(t, "db.tbl.6", string(sender.msgs[1].Key))
+		var e CDCEvent
+		assert.Nil(t, json.Unmarshal(sender.msgs[1].Value, &e))
+		assert.Equal(t, "delete", e.Op)
+		assert.Equal(t, "6", *e.PrimaryKey)
+		assert.True(t, e.CommitTime > 0)
+	}
+}
+
+func TestCDCPublishFailed(t *testing.T) {
+	sender := &fakeSender{err: errors.New("broker not available")}
+	c := newTestCDCPublisher(sender)
+	// retry is not waited after closed
+	close(c.done)
+	c.wg.Wait()
+
+	c.publish(c.buildEvents([]string{"db.tbl"}, "slice-0", "db_0", "delete from tbl_0001 where id = 1"))
+	assert.Equal(t, uint64(1), c.Stats().Dropped)
+
+	c.send(c.buildEvents([]string{"db.tbl"}, "slice-0", "db_0", "delete from tbl_0001 where id = 2"))
+	assert.Equal(t, uint64(1), c.Stats().Failed)
+}
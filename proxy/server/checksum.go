@@ -0,0 +1,454 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+const (
+	defaultChecksumColumn    = "id"
+	defaultChecksumChunkSize = 1000
+	maxChecksumChunkSize     = 1000000
+	maxChecksumDiffs         = 100                    // diverging chunks kept in status of a table
+	checksumChunkInterval    = 10 * time.Millisecond  // pause between chunks to limit load of backends
+	checksumRecheckDelay     = 500 * time.Millisecond // diverging chunk is checked again after it in case of replication lag
+	checksumRecheckTimes     = 3
+)
+
+// ChecksumDiff chunk of sub table whose checksum of slave is different from master
+type ChecksumDiff struct {
+	Shard      string `json:"shard"` // as slice/db.table
+	Slave      string `json:"slave"`
+	Lower      string `json:"lower"` // chunk is [lower, upper) of chunk column, empty if unbounded
+	Upper      string `json:"upper"`
+	MasterRows uint64 `json:"master_rows"`
+	SlaveRows  uint64 `json:"slave_rows"`
+	MasterCRC  uint64 `json:"master_crc"`
+	SlaveCRC   uint64 `json:"slave_crc"`
+	SlaveError string `json:"slave_error"` // error of checksum on slave, checksum is not compared if set
+}
+
+// ChecksumStatus progress and result of the current or last consistency check of a logical table
+type ChecksumStatus struct {
+	DB         string          `json:"db"`
+	Table      string          `json:"table"`
+	Column     string          `json:"column"`
+	ChunkSize  int64           `json:"chunk_size"`
+	Running    bool            `json:"running"`
+	Shard      string          `json:"shard"` // sub table being checked, as slice/db.table
+	Shards     int             `json:"shards"`
+	ShardsDone int             `json:"shards_done"`
+	Chunks     int             `json:"chunks"` // chunks checked
+	Diffs      []*ChecksumDiff `json:"diffs"`
+	StartTime  string          `json:"start_time"`
+	EndTime    string          `json:"end_time"`
+	Error      string          `json:"error"`
+}
+
+// checksumConn connection to a backend instance used by consistency check
+type checksumConn interface {
+	Execute(sql string, maxRows int) (*mysql.Result, error)
+	Close()
+}
+
+type chunkChecksum struct {
+	rows uint64
+	crc  uint64
+}
+
+type checksumTask struct {
+	lock   sync.Mutex
+	status ChecksumStatus
+}
+
+// checksumChecker compare chunked CRC32 checksums of sub tables between master and slaves of their slices,
+// pt-table-checksum style. Checksums are calculated on instances at nearly the same time instead of being
+// replicated, so a diverging chunk is checked several times before it's reported to rule out replication lag.
+type checksumChecker struct {
+	namespace string
+	targets   func(db, table string) ([]*purgeTarget, error)
+	instances func(slice string) (master string, slaves []string, err error)
+	connect   func(slice, addr string) (checksumConn, error)
+	now       func() time.Time
+
+	lock  sync.Mutex
+	tasks map[string]*checksumTask // key: db.table in lower case
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newChecksumChecker(namespace string, targets func(db, table string) ([]*purgeTarget, error),
+	instances func(slice string) (string, []string, error), connect func(slice, addr string) (checksumConn, error)) *checksumChecker {
+	return &checksumChecker{
+		namespace: namespace,
+		targets:   targets,
+		instances: instances,
+		connect:   connect,
+		now:       time.Now,
+		tasks:     make(map[string]*checksumTask),
+		done:      make(chan struct{}),
+	}
+}
+
+func checksumKey(db, table string) string {
+	return strings.ToLower(db + "." + table)
+}
+
+// run start checking consistency of table in background, column must be an integer column which is used to
+// split sub tables into chunks, error is returned if the table is being checked
+func (c *checksumChecker) run(db, table, column string, chunkSize int64) error {
+	if column == "" {
+		column = defaultChecksumColumn
+	}
+	if chunkSize == 0 {
+		chunkSize = defaultChecksumChunkSize
+	}
+	if chunkSize < 0 || chunkSize > maxChecksumChunkSize {
+		return fmt.Errorf("invalid chunk size %d, should be in (0, %d]", chunkSize, maxChecksumChunkSize)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed() {
+		return fmt.Errorf("namespace is closed")
+	}
+	key := checksumKey(db, table)
+	t, ok := c.tasks[key]
+	if !ok {
+		t = &checksumTask{}
+		c.tasks[key] = t
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.status.Running {
+		return fmt.Errorf("checksum of %s.%s is running", db, table)
+	}
+	t.status = ChecksumStatus{
+		DB:        db,
+		Table:     table,
+		Column:    column,
+		ChunkSize: chunkSize,
+		Running:   true,
+		StartTime: c.now().Format("2006-01-02 15:04:05"),
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.check(t, db, table, column, chunkSize)
+	}()
+	return nil
+}
+
+func (c *checksumChecker) check(t *checksumTask, db, table, column string, chunkSize int64) {
+	err := c.checkTable(t, db, table, column, chunkSize)
+
+	t.lock.Lock()
+	t.status.Running = false
+	t.status.Shard = ""
+	t.status.EndTime = c.now().Format("2006-01-02 15:04:05")
+	if err != nil {
+		t.status.Error = err.Error()
+	}
+	diffs := len(t.status.Diffs)
+	t.lock.Unlock()
+	if err != nil {
+		log.Warn("[ns:%s] checksum table %s.%s failed, diverging chunks: %d, err: %v", c.namespace, db, table, diffs, err)
+		return
+	}
+	log.Notice("[ns:%s] checksum table %s.%s finished, diverging chunks: %d", c.namespace, db, table, diffs)
+}
+
+func (c *checksumChecker) checkTable(t *checksumTask, db, table, column string, chunkSize int64) error {
+	targets, err := c.targets(db, table)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	t.status.Shards = len(targets)
+	t.lock.Unlock()
+
+	for _, target := range targets {
+		t.lock.Lock()
+		t.status.Shard = target.slice + "/" + target.db + "." + target.table
+		t.lock.Unlock()
+
+		if err := c.checkTarget(t, target, column, chunkSize); err != nil {
+			return fmt.Errorf("checksum %s.%s of slice %s error: %v", target.db, target.table, target.slice, err)
+		}
+
+		t.lock.Lock()
+		t.status.ShardsDone++
+		t.lock.Unlock()
+	}
+	return nil
+}
+
+func (c *checksumChecker) checkTarget(t *checksumTask, target *purgeTarget, column string, chunkSize int64) error {
+	master, slaves, err := c.instances(target.slice)
+	if err != nil {
+		return err
+	}
+	if len(slaves) == 0 {
+		return nil
+	}
+	mc, err := c.connect(target.slice, master)
+	if err != nil {
+		return fmt.Errorf("connect to master %s error: %v", master, err)
+	}
+	defer mc.Close()
+
+	columns, err := checksumColumns(mc, target)
+	if err != nil {
+		return err
+	}
+	chunks, err := checksumChunks(mc, target, column, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	scs := make([]checksumConn, len(slaves))
+	defer func() {
+		for _, sc := range scs {
+			if sc != nil {
+				sc.Close()
+			}
+		}
+	}()
+	for i, slave := range slaves {
+		// an unreachable slave is reported as diverging chunks instead of stopping the check
+		if scs[i], err = c.connect(target.slice, slave); err != nil {
+			log.Warn("[ns:%s] connect to slave %s of slice %s for checksum failed, err: %v", c.namespace, slave, target.slice, err)
+		}
+	}
+
+	shard := target.slice + "/" + target.db + "." + target.table
+	for _, chunk := range chunks {
+		if c.closed() {
+			return fmt.Errorf("checksum is stopped by closing namespace")
+		}
+		sql := checksumSQL(target, columns, column, chunk)
+		for i, slave := range slaves {
+			diff, err := c.checkChunk(mc, scs[i], sql)
+			if err != nil {
+				return fmt.Errorf("checksum on master %s error: %v", master, err)
+			}
+			if diff == nil {
+				continue
+			}
+			diff.Shard, diff.Slave, diff.Lower, diff.Upper = shard, slave, chunk.lower, chunk.upper
+			t.lock.Lock()
+			if len(t.status.Diffs) < maxChecksumDiffs {
+				t.status.Diffs = append(t.status.Diffs, diff)
+			}
+			t.lock.Unlock()
+		}
+		t.lock.Lock()
+		t.status.Chunks++
+		t.lock.Unlock()
+
+		select {
+		case <-c.done:
+		case <-time.After(checksumChunkInterval):
+		}
+	}
+	return nil
+}
+
+// checkChunk compare checksum of chunk on master and slave, nil is returned if they're the same
+func (c *checksumChecker) checkChunk(mc, sc checksumConn, sql string) (*ChecksumDiff, error) {
+	var diff *ChecksumDiff
+	for i := 0; i < checksumRecheckTimes; i++ {
+		if i > 0 {
+			select {
+			case <-c.done:
+				return diff, nil
+			case <-time.After(checksumRecheckDelay):
+			}
+		}
+		mcs, err := chunkChecksumOf(mc, sql)
+		if err != nil {
+			return nil, err
+		}
+		diff = &ChecksumDiff{MasterRows: mcs.rows, MasterCRC: mcs.crc}
+		if sc == nil {
+			diff.SlaveError = "connect to slave failed"
+			continue
+		}
+		scs, err := chunkChecksumOf(sc, sql)
+		if err != nil {
+			diff.SlaveError = err.Error()
+			continue
+		}
+		if *mcs == *scs {
+			return nil, nil
+		}
+		diff.SlaveRows, diff.SlaveCRC = scs.rows, scs.crc
+	}
+	return diff, nil
+}
+
+func chunkChecksumOf(conn checksumConn, sql string) (*chunkChecksum, error) {
+	r, err := conn.Execute(sql, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil || len(r.Values) != 1 {
+		return nil, fmt.Errorf("invalid result of checksum sql")
+	}
+	rows, err := r.GetUint(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	crc, err := r.GetUint(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkChecksum{rows: rows, crc: crc}, nil
+}
+
+// checksumColumns return quoted columns of sub table in order of definition
+func checksumColumns(conn checksumConn, target *purgeTarget) ([]string, error) {
+	sql := fmt.Sprintf("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s' ORDER BY ORDINAL_POSITION",
+		mysql.Escape(target.db), mysql.Escape(target.table))
+	r, err := conn.Execute(sql, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil || len(r.Values) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", target.db, target.table)
+	}
+	columns := make([]string, 0, len(r.Values))
+	for i := range r.Values {
+		name, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, quoteIdentifier(name))
+	}
+	return columns, nil
+}
+
+// checksumChunk range of chunk column, the first and last chunks are unbounded so that rows out of range
+// of master are also compared
+type checksumChunk struct {
+	lower string
+	upper string
+}
+
+// checksumChunks split sub table into chunks of chunk size by range of column on master
+func checksumChunks(conn checksumConn, target *purgeTarget, column string, chunkSize int64) ([]checksumChunk, error) {
+	sql := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s.%s", quoteIdentifier(column), quoteIdentifier(column),
+		quoteIdentifier(target.db), quoteIdentifier(target.table))
+	r, err := conn.Execute(sql, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil || len(r.Values) != 1 {
+		return nil, fmt.Errorf("invalid result of range of chunk column")
+	}
+	if null, _ := r.IsNull(0, 0); null {
+		// empty on master, compare the whole table
+		return []checksumChunk{{}}, nil
+	}
+	first, err := r.GetInt(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("chunk column %s is not integer: %v", column, err)
+	}
+	last, err := r.GetInt(0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("chunk column %s is not integer: %v", column, err)
+	}
+
+	var chunks []checksumChunk
+	lower := ""
+	for upper := first + chunkSize; upper <= last; upper += chunkSize {
+		u := fmt.Sprintf("%d", upper)
+		chunks = append(chunks, checksumChunk{lower: lower, upper: u})
+		lower = u
+	}
+	return append(chunks, checksumChunk{lower: lower}), nil
+}
+
+// checksumSQL return sql calculating row count and BIT_XOR of CRC32 of rows in chunk, NULL values are
+// distinguished from empty strings by the trailing ISNULL flags
+func checksumSQL(target *purgeTarget, columns []string, column string, chunk checksumChunk) string {
+	nulls := make([]string, 0, len(columns))
+	for _, c := range columns {
+		nulls = append(nulls, "ISNULL("+c+")")
+	}
+	row := fmt.Sprintf("CONCAT_WS('#', %s, CONCAT(%s))", strings.Join(columns, ", "), strings.Join(nulls, ", "))
+	sql := fmt.Sprintf("SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(%s)), 0) FROM %s.%s",
+		row, quoteIdentifier(target.db), quoteIdentifier(target.table))
+
+	var conds []string
+	if chunk.lower != "" {
+		conds = append(conds, fmt.Sprintf("%s >= %s", quoteIdentifier(column), chunk.lower))
+	}
+	if chunk.upper != "" {
+		conds = append(conds, fmt.Sprintf("%s < %s", quoteIdentifier(column), chunk.upper))
+	}
+	if len(conds) > 0 {
+		sql += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return sql
+}
+
+// status return result of consistency checks ordered by table
+func (c *checksumChecker) status() []*ChecksumStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ret := make([]*ChecksumStatus, 0, len(c.tasks))
+	for _, t := range c.tasks {
+		t.lock.Lock()
+		s := t.status
+		s.Diffs = append([]*ChecksumDiff{}, t.status.Diffs...)
+		t.lock.Unlock()
+		ret = append(ret, &s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return checksumKey(ret[i].DB, ret[i].Table) < checksumKey(ret[j].DB, ret[j].Table)
+	})
+	return ret
+}
+
+func (c *checksumChecker) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stop running checks, the running chunk is finished
+func (c *checksumChecker) close() {
+	c.lock.Lock()
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.lock.Unlock()
+	c.wg.Wait()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChecksumConn struct {
+	addr    string
+	execute func(addr, sql string) (*mysql.Result, error)
+}
+
+func (c *fakeChecksumConn) Execute(sql string, maxRows int) (*mysql.Result, error) {
+	return c.execute(c.addr, sql)
+}
+
+func (c *fakeChecksumConn) Close() {}
+
+func newChecksumResult(t *testing.T, values ...interface{}) *mysql.Result {
+	fields := make([]*mysql.Field, len(values))
+	names := make([]string, len(values))
+	for i := range values {
+		fields[i] = &mysql.Field{}
+		names[i] = string(rune('a' + i))
+	}
+	rs, err := mysql.BuildResultset(fields, names, [][]interface{}{values})
+	require.NoError(t, err)
+	return &mysql.Result{Resultset: rs}
+}
+
+func waitChecksum(t *testing.T, c *checksumChecker) *ChecksumStatus {
+	for i := 0; i < 500; i++ {
+		if s := c.status(); len(s) == 1 && !s[0].Running {
+			return s[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("checksum is not finished")
+	return nil
+}
+
+func TestChecksumChunksAndSQL(t *testing.T) {
+	target := &purgeTarget{slice: "slice-0", db: "db_0", table: "t_0000"}
+	conn := &fakeChecksumConn{execute: func(addr, sql string) (*mysql.Result, error) {
+		require.Equal(t, "SELECT MIN(`id`), MAX(`id`) FROM `db_0`.`t_0000`", sql)
+		return newChecksumResult(t, int64(1), int64(25)), nil
+	}}
+	chunks, err := checksumChunks(conn, target, "id", 10)
+	require.NoError(t, err)
+	require.Equal(t, []checksumChunk{{upper: "11"}, {lower: "11", upper: "21"}, {lower: "21"}}, chunks)
+
+	conn.execute = func(addr, sql string) (*mysql.Result, error) {
+		return newChecksumResult(t, nil, nil), nil
+	}
+	chunks, err = checksumChunks(conn, target, "id", 10)
+	require.NoError(t, err)
+	require.Equal(t, []checksumChunk{{}}, chunks)
+
+	require.Equal(t, "SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#', `id`, `name`, CONCAT(ISNULL(`id`), ISNULL(`name`))))), 0) "+
+		"FROM `db_0`.`t_0000` WHERE `id` >= 11 AND `id` < 21",
+		checksumSQL(target, []string{"`id`", "`name`"}, "id", checksumChunk{lower: "11", upper: "21"}))
+	require.Equal(t, "SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#', `id`, CONCAT(ISNULL(`id`))))), 0) FROM `db_0`.`t_0000`",
+		checksumSQL(target, []string{"`id`"}, "id", checksumChunk{}))
+}
+
+func TestChecksumChecker(t *testing.T) {
+	targets := func(db, table string) ([]*purgeTarget, error) {
+		return []*purgeTarget{
+			{slice: "slice-0", db: "db_0", table: table + "_0000"},
+			{slice: "slice-1", db: "db_1", table: table + "_0001"},
+		}, nil
+	}
+	instances := func(slice string) (string, []string, error) {
+		if slice == "slice-0" {
+			return "m0:3306", []string{"s0:3306"}, nil
+		}
+		return "m1:3306", []string{"s1:3306"}, nil
+	}
+	execute := func(addr, sql string) (*mysql.Result, error) {
+		switch {
+		case strings.HasPrefix(sql, "SELECT COLUMN_NAME"):
+			return newChecksumResult(t, "id"), nil
+		case strings.HasPrefix(sql, "SELECT MIN"):
+			return newChecksumResult(t, int64(1), int64(15)), nil
+		case addr == "s1:3306" && strings.Contains(sql, "`id` >= 11"):
+			// the last chunk of slice-1 diverges
+			return newChecksumResult(t, uint64(4), uint64(1234)), nil
+		default:
+			return newChecksumResult(t, uint64(5), uint64(4321)), nil
+		}
+	}
+	connect := func(slice, addr string) (checksumConn, error) {
+		return &fakeChecksumConn{addr: addr, execute: execute}, nil
+	}
+	c := newChecksumChecker("test", targets, instances, connect)
+	defer c.close()
+
+	require.Error(t, c.run("db", "t", "id", -1))
+	require.NoError(t, c.run("db", "t", "", 10))
+	s := waitChecksum(t, c)
+	require.Equal(t, "", s.Error)
+	require.Equal(t, "id", s.Column)
+	require.Equal(t, 2, s.ShardsDone)
+	require.Equal(t, 4, s.Chunks)
+	require.Len(t, s.Diffs, 1)
+	require.Equal(t, &ChecksumDiff{
+		Shard:      "slice-1/db_1.t_0001",
+		Slave:      "s1:3306",
+		Lower:      "11",
+		MasterRows: 5,
+		SlaveRows:  4,
+		MasterCRC:  4321,
+		SlaveCRC:   1234,
+	}, s.Diffs[0])
+}
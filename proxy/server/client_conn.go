@@ -47,6 +47,7 @@ type HandshakeResponseInfo struct {
 	Salt         []byte
 	Database     string
 	AuthPlugin   string
+	ConnectAttrs map[string]string
 }
 
 // NewClientConn constructor of ClientConn
@@ -62,10 +63,16 @@ func NewClientConn(c *mysql.Conn, manager *Manager) *ClientConn {
 }
 
 func (cc *ClientConn) writeInitialHandshakeV10() error {
+	serverVersion := cc.proxy.ServerVersion
+	capability := DefaultCapability
+	if cc.manager != nil {
+		serverVersion = cc.manager.handshakeServerVersion(serverVersion)
+		capability = cc.manager.handshakeCapability(capability)
+	}
 
 	length :=
 		1 + // protocol version
-			mysql.LenNullString(cc.proxy.ServerVersion) +
+			mysql.LenNullString(serverVersion) +
 			4 + // connection ID
 			8 + // first part of salt data
 			1 + // filler byte
@@ -89,7 +96,7 @@ func (cc *ClientConn) writeInitialHandshakeV10() error {
 
 	// Copy server version.
 	// server version data with terminate character 0x00, type: string[NUL].
-	pos = mysql.WriteNullString(data, pos, cc.proxy.ServerVersion)
+	pos = mysql.WriteNullString(data, pos, serverVersion)
 
 	// Add connectionID in.
 	// connection id type: 4 bytes.
@@ -102,7 +109,7 @@ func (cc *ClientConn) writeInitialHandshakeV10() error {
 	pos = mysql.WriteByte(data, pos, 0)
 
 	// Lower part of the capability flags, lower 2 bytes.
-	pos = mysql.WriteUint16(data, pos, uint16(DefaultCapability))
+	pos = mysql.WriteUint16(data, pos, uint16(capability))
 
 	// Character set.
 	pos = mysql.WriteByte(data, pos, byte(mysql.DefaultCollationID))
@@ -111,7 +118,7 @@ func (cc *ClientConn) writeInitialHandshakeV10() error {
 	pos = mysql.WriteUint16(data, pos, initClientConnStatus)
 
 	// Upper part of the capability flags.
-	pos = mysql.WriteUint16(data, pos, uint16(DefaultCapability>>16))
+	pos = mysql.WriteUint16(data, pos, uint16(capability>>16))
 
 	// Length of auth plugin data.
 	// Always 21 (8 + 13).
@@ -222,22 +229,35 @@ func (cc *ClientConn) readHandshakeResponse() (HandshakeResponseInfo, error) {
 		}
 		info.Database = db
 	}
+	authSwitch := false
 	if capability&mysql.ClientPluginAuth > 0 {
 		var authPlugin string
 		authPlugin, pos, ok = mysql.ReadNullString(data, pos)
-		if ok && (authPlugin != cc.proxy.AuthPlugin) {
-			info.AuthPlugin = cc.proxy.AuthPlugin
-			cc.RecycleReadPacket()
-			cc.WriteAuthSwitchRequest(info.AuthPlugin)
-			// readAuthSwitchRequestResponse
-			info.AuthResponse, err = cc.ReadEphemeralPacketDirect()
-			if err != nil {
-				return info, fmt.Errorf("readHandshakeResponse: can't read auth switch response")
-			}
+		authSwitch = ok && authPlugin != cc.proxy.AuthPlugin
+	}
+
+	// client connection attributes, e.g. program_name, _client_name
+	if ok && capability&mysql.ClientConnectAtts > 0 && pos < len(data) {
+		var attrs map[string]string
+		attrs, pos, ok = mysql.ReadConnectAttrs(data, pos)
+		if !ok {
+			return info, fmt.Errorf("readHandshakeResponse: can't read connection attributes")
+		}
+		info.ConnectAttrs = attrs
+	}
+
+	// auth switch must be handled at last, the packet is recycled
+	if authSwitch {
+		info.AuthPlugin = cc.proxy.AuthPlugin
+		cc.RecycleReadPacket()
+		cc.WriteAuthSwitchRequest(info.AuthPlugin)
+		// readAuthSwitchRequestResponse
+		info.AuthResponse, err = cc.ReadEphemeralPacketDirect()
+		if err != nil {
+			return info, fmt.Errorf("readHandshakeResponse: can't read auth switch response")
 		}
 	}
 
-	// TODO auth plugin name、client conn attrs .etc
 	return info, nil
 }
 
@@ -250,7 +270,8 @@ func (cc *ClientConn) writeOK(status uint16) error {
 	return nil
 }
 
-func (cc *ClientConn) writeOKResultStream(status uint16, rs *mysql.Result, continueConn backend.PooledConnect, maxRows int, isBinary bool) error {
+// writeOKResultStream write result and rows left in continueConn, rewriteRows is applied to rows fetched from continueConn
+func (cc *ClientConn) writeOKResultStream(status uint16, rs *mysql.Result, continueConn backend.PooledConnect, maxRows int, isBinary bool, rewriteRows func(*mysql.Result)) error {
 	if rs == nil {
 		return cc.writeOK(status)
 	}
@@ -280,6 +301,9 @@ func (cc *ClientConn) writeOKResultStream(status uint16, rs *mysql.Result, conti
 			Fields: globalFields,
 		}
 		err = continueConn.FetchMoreRows(result, maxRows)
+		if rewriteRows != nil {
+			rewriteRows(result)
+		}
 		if isBinary {
 			if err := result.BuildBinaryResultSet(); err != nil {
 				return err
@@ -316,7 +340,7 @@ func (cc *ClientConn) writeOKResult(status uint16, moreRows bool, r *mysql.Resul
 	if r.Resultset == nil {
 		return cc.WriteOKPacket(r.AffectedRows, r.InsertID, status, 0, r.Info)
 	}
-	return cc.writeResultset(status, moreRows, r.Resultset)
+	return cc.writeResultset(status, moreRows, r.Resultset, r.Warnings)
 }
 
 // 写入结果集后，不能再引用结果集
@@ -342,7 +366,11 @@ func (cc *ClientConn) writeRowsWithEOF(result *mysql.Result, moreRowsExists bool
 }
 
 func (cc *ClientConn) writeEOFPacket(status uint16) error {
-	err := cc.WriteEOFPacket(status, 0)
+	return cc.writeEOFPacketWithWarnings(status, 0)
+}
+
+func (cc *ClientConn) writeEOFPacketWithWarnings(status uint16, warnings uint16) error {
+	err := cc.WriteEOFPacket(status, warnings)
 	if err != nil {
 		log.Warn("write eof packet failed, %v", err)
 		return err
@@ -371,6 +399,11 @@ func (cc *ClientConn) writeRow(row []byte) error {
 	return cc.WriteEphemeralPacket()
 }
 
+// writeStatistics write status string in a packet without header, the response of COM_STATISTICS
+func (cc *ClientConn) writeStatistics(info string) error {
+	return cc.writeRow([]byte(info))
+}
+
 func (cc *ClientConn) writeFields(status uint16, r *mysql.Resultset) error {
 	var err error
 	cc.StartWriterBuffering()
@@ -399,7 +432,7 @@ func (cc *ClientConn) writeEndResult(status uint16) error {
 }
 
 // https://dev.mysql.com/doc/internals/en/com-query-response.html#packet-ProtocolText::Resultset
-func (cc *ClientConn) writeResultset(status uint16, moreRows bool, r *mysql.Resultset) error {
+func (cc *ClientConn) writeResultset(status uint16, moreRows bool, r *mysql.Resultset, warnings uint16) error {
 	var err error
 	cc.StartWriterBuffering()
 
@@ -426,7 +459,7 @@ func (cc *ClientConn) writeResultset(status uint16, moreRows bool, r *mysql.Resu
 	}
 	// if moreRows exists, will not send EOF packet
 	if !moreRows {
-		err = cc.writeEOFPacket(status)
+		err = cc.writeEOFPacketWithWarnings(status, warnings)
 		if err != nil {
 			return err
 		}
@@ -46,6 +46,6 @@ func TestWriteOkResultStreamMoreRowsExistFields(t *testing.T) {
 		}
 		backendConn := &backend.MockPooledConnect{}
 		c := ClientConn{}
-		c.writeOKResultStream(0, rs, backendConn, 0, true)
+		c.writeOKResultStream(0, rs, backendConn, 0, true, nil)
 	})
 }
@@ -0,0 +1,277 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/format"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/crypto"
+	"github.com/XiaoMi/Gaea/util/keystore"
+)
+
+// encryptColumn is key of encrypt column and additional data authenticated with its cipher text
+type encryptColumn struct {
+	key []byte
+	// logic table and column name, cipher text copied to other column can't be decrypted
+	aad []byte
+}
+
+func newEncryptColumn(key []byte, table, column string) *encryptColumn {
+	return &encryptColumn{key: key, aad: []byte(table + "." + column)}
+}
+
+// parseEncryptColumns load keys of encrypt columns, key of result is table, value is column to encrypt column
+func parseEncryptColumns(columns []*models.EncryptColumn) (map[string]map[string]*encryptColumn, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]map[string]*encryptColumn)
+	for _, c := range columns {
+		key, err := keystore.GetKey(c.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("get key of encrypt column %s.%s error: %v", c.Table, c.Column, err)
+		}
+		table := strings.ToLower(strings.TrimSpace(c.Table))
+		column := strings.ToLower(strings.TrimSpace(c.Column))
+		if ret[table] == nil {
+			ret[table] = make(map[string]*encryptColumn)
+		}
+		ret[table][column] = newEncryptColumn(key, table, column)
+	}
+	return ret, nil
+}
+
+// getEncryptColumns return encrypt columns of table, table may be sub table name of shard table
+func (n *Namespace) getEncryptColumns(table string) map[string]*encryptColumn {
+	if len(n.encryptColumns) == 0 || table == "" {
+		return nil
+	}
+	table = strings.ToLower(table)
+	if columns, ok := n.encryptColumns[table]; ok {
+		return columns
+	}
+	return n.encryptColumns[trimShardTableSuffix(table)]
+}
+
+// encryptSQL rewrite values of encrypt columns in INSERT, REPLACE and UPDATE to cipher text.
+// only constant values can be encrypted, cipher text is random so encrypt columns can't be used in WHERE.
+func (se *SessionExecutor) encryptSQL(reqCtx *util.RequestContext, sql string) (string, error) {
+	ns := se.GetNamespace()
+	if len(ns.encryptColumns) == 0 {
+		return sql, nil
+	}
+	switch reqCtx.GetStmtType() {
+	case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate:
+	default:
+		return sql, nil
+	}
+
+	query, comments := parser.SplitMarginComments(sql)
+	stmt, err := se.Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
+	}
+
+	var changed bool
+	switch s := stmt.(type) {
+	case *ast.InsertStmt:
+		changed, err = ns.encryptInsert(s)
+	case *ast.UpdateStmt:
+		changed, err = ns.encryptUpdate(s)
+	}
+	if err != nil || !changed {
+		return sql, err
+	}
+
+	sb := &strings.Builder{}
+	if err := stmt.Restore(format.NewRestoreCtx(format.EscapeRestoreFlags, sb)); err != nil {
+		return "", fmt.Errorf("restore encrypted sql error: %v", err)
+	}
+	return comments.Leading + sb.String() + comments.Trailing, nil
+}
+
+func (n *Namespace) encryptInsert(stmt *ast.InsertStmt) (bool, error) {
+	tableSource, ok := stmt.Table.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return false, nil
+	}
+	tableName, ok := tableSource.Source.(*ast.TableName)
+	if !ok {
+		return false, nil
+	}
+	columns := n.getEncryptColumns(tableName.Name.L)
+	if columns == nil {
+		return false, nil
+	}
+
+	if stmt.Select != nil {
+		return false, fmt.Errorf("insert select is not supported for table %s with encrypt columns", tableName.Name.O)
+	}
+	if len(stmt.Lists) > 0 && len(stmt.Columns) == 0 {
+		return false, fmt.Errorf("column list must be specified for table %s with encrypt columns", tableName.Name.O)
+	}
+
+	var err error
+	changed := false
+	for _, row := range stmt.Lists {
+		for i, c := range stmt.Columns {
+			col, ok := columns[c.Name.L]
+			if !ok || i >= len(row) {
+				continue
+			}
+			if row[i], err = encryptExpr(row[i], col); err != nil {
+				return false, fmt.Errorf("column %s: %v", c.Name.O, err)
+			}
+			changed = true
+		}
+	}
+
+	for _, assignments := range [][]*ast.Assignment{stmt.Setlist, stmt.OnDuplicate} {
+		for _, a := range assignments {
+			col, ok := columns[a.Column.Name.L]
+			if !ok {
+				continue
+			}
+			// VALUES(col) refers to the encrypted value in insert list
+			if _, ok := a.Expr.(*ast.ValuesExpr); ok {
+				continue
+			}
+			if a.Expr, err = encryptExpr(a.Expr, col); err != nil {
+				return false, fmt.Errorf("column %s: %v", a.Column.Name.O, err)
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+func (n *Namespace) encryptUpdate(stmt *ast.UpdateStmt) (bool, error) {
+	if stmt.TableRefs == nil {
+		return false, nil
+	}
+	var tableSources []*ast.TableSource
+	collectTableSources(stmt.TableRefs.TableRefs, &tableSources)
+
+	var err error
+	changed := false
+	for _, a := range stmt.List {
+		col := n.getAssignmentColumn(a.Column, tableSources)
+		if col == nil {
+			continue
+		}
+		if a.Expr, err = encryptExpr(a.Expr, col); err != nil {
+			return false, fmt.Errorf("column %s: %v", a.Column.Name.O, err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// getAssignmentColumn find the table of column by table name or alias, and return encrypt column if column is encrypted
+func (n *Namespace) getAssignmentColumn(column *ast.ColumnName, tableSources []*ast.TableSource) *encryptColumn {
+	for _, ts := range tableSources {
+		tableName, ok := ts.Source.(*ast.TableName)
+		if !ok {
+			continue
+		}
+		if column.Table.L != "" {
+			if ts.AsName.L != "" && ts.AsName.L != column.Table.L {
+				continue
+			}
+			if ts.AsName.L == "" && tableName.Name.L != column.Table.L {
+				continue
+			}
+		}
+		if col, ok := n.getEncryptColumns(tableName.Name.L)[column.Name.L]; ok {
+			return col
+		}
+	}
+	return nil
+}
+
+func collectTableSources(node ast.ResultSetNode, tableSources *[]*ast.TableSource) {
+	switch n := node.(type) {
+	case *ast.TableSource:
+		*tableSources = append(*tableSources, n)
+	case *ast.Join:
+		collectTableSources(n.Left, tableSources)
+		if n.Right != nil {
+			collectTableSources(n.Right, tableSources)
+		}
+	}
+}
+
+// encryptExpr encrypt constant value to base64 encoded cipher text, NULL is kept
+func encryptExpr(expr ast.ExprNode, col *encryptColumn) (ast.ExprNode, error) {
+	v, ok := expr.(*driver.ValueExpr)
+	if !ok {
+		return nil, fmt.Errorf("value of encrypt column must be constant")
+	}
+	if v.IsNull() {
+		return expr, nil
+	}
+	plain, err := v.ToString()
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := crypto.EncryptGCMWithAAD(col.key, []byte(plain), col.aad)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewValueExpr(base64.StdEncoding.EncodeToString(cipherText)), nil
+}
+
+// decryptRows decrypt encrypt columns in result, values can't be decrypted are returned as they are,
+// so plain text written before column encrypted is still readable.
+func (se *SessionExecutor) decryptRows(r *mysql.Result) {
+	ns := se.GetNamespace()
+	if len(ns.encryptColumns) == 0 {
+		return
+	}
+
+	rewriters := make(map[int]columnRewriter)
+	for i, f := range r.Fields {
+		col, ok := ns.getEncryptColumns(string(f.OrgTable))[strings.ToLower(string(f.OrgName))]
+		if !ok {
+			continue
+		}
+		rewriters[i] = func(v []byte) []byte { return decryptValue(col, v) }
+	}
+	if err := rewriteColumns(r, rewriters); err != nil {
+		log.Warn("[ns:%s, %s@%s] decrypt result error: %v", se.namespace, se.user, se.clientAddr, err)
+	}
+}
+
+func decryptValue(col *encryptColumn, v []byte) []byte {
+	cipherText, err := base64.StdEncoding.DecodeString(string(v))
+	if err != nil {
+		return v
+	}
+	plain, err := crypto.DecryptGCMWithAAD(col.key, cipherText, col.aad)
+	if err != nil {
+		return v
+	}
+	return plain
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	driver "github.com/XiaoMi/Gaea/parser/tidb-types/parser_driver"
+	"github.com/XiaoMi/Gaea/util/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+var testEncryptKey = []byte("1234abcd5678efg*")
+
+var testEncryptColumn = newEncryptColumn(testEncryptKey, "user", "phone")
+
+func newEncryptTestNamespace() *Namespace {
+	return &Namespace{encryptColumns: map[string]map[string]*encryptColumn{
+		"user": {"phone": testEncryptColumn},
+	}}
+}
+
+func requireEncrypted(t *testing.T, expr ast.ExprNode, plain string) {
+	v, ok := expr.(*driver.ValueExpr)
+	require.True(t, ok)
+	require.Equal(t, plain, string(decryptValue(testEncryptColumn, []byte(v.GetString()))))
+	require.NotEqual(t, plain, v.GetString())
+}
+
+func TestEncryptInsert(t *testing.T) {
+	ns := newEncryptTestNamespace()
+
+	stmt, err := parser.ParseSQL("insert into user(id, phone) values (1, '13812345678'), (2, NULL), (3, 138)")
+	require.NoError(t, err)
+	insert := stmt.(*ast.InsertStmt)
+	changed, err := ns.encryptInsert(insert)
+	require.NoError(t, err)
+	require.True(t, changed)
+	requireEncrypted(t, insert.Lists[0][1], "13812345678")
+	require.True(t, insert.Lists[1][1].(*driver.ValueExpr).IsNull())
+	requireEncrypted(t, insert.Lists[2][1], "138")
+	require.Equal(t, int64(1), insert.Lists[0][0].(*driver.ValueExpr).GetInt64())
+
+	stmt, err = parser.ParseSQL("insert into user set id = 1, phone = '138' on duplicate key update phone = values(phone)")
+	require.NoError(t, err)
+	insert = stmt.(*ast.InsertStmt)
+	changed, err = ns.encryptInsert(insert)
+	require.NoError(t, err)
+	require.True(t, changed)
+	requireEncrypted(t, insert.Setlist[1].Expr, "138")
+	require.IsType(t, &ast.ValuesExpr{}, insert.OnDuplicate[0].Expr)
+
+	stmt, err = parser.ParseSQL("insert into orders(id, phone) values (1, '138')")
+	require.NoError(t, err)
+	changed, err = ns.encryptInsert(stmt.(*ast.InsertStmt))
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	for _, sql := range []string{
+		"insert into user values (1, '138')",
+		"insert into user(id, phone) select id, phone from orders",
+		"insert into user(id, phone) values (1, concat('1', '38'))",
+		"insert into user(id, phone) values (1, '138') on duplicate key update phone = '139' + 1",
+	} {
+		stmt, err = parser.ParseSQL(sql)
+		require.NoError(t, err)
+		_, err = ns.encryptInsert(stmt.(*ast.InsertStmt))
+		require.Error(t, err, sql)
+	}
+}
+
+func TestEncryptUpdate(t *testing.T) {
+	ns := newEncryptTestNamespace()
+
+	stmt, err := parser.ParseSQL("update user set phone = '138', name = 'a' where id = 1")
+	require.NoError(t, err)
+	update := stmt.(*ast.UpdateStmt)
+	changed, err := ns.encryptUpdate(update)
+	require.NoError(t, err)
+	require.True(t, changed)
+	requireEncrypted(t, update.List[0].Expr, "138")
+	require.Equal(t, "a", update.List[1].Expr.(*driver.ValueExpr).GetString())
+
+	stmt, err = parser.ParseSQL("update user u join orders o on u.id = o.uid set u.phone = '138', o.phone = '139'")
+	require.NoError(t, err)
+	update = stmt.(*ast.UpdateStmt)
+	changed, err = ns.encryptUpdate(update)
+	require.NoError(t, err)
+	require.True(t, changed)
+	requireEncrypted(t, update.List[0].Expr, "138")
+	require.Equal(t, "139", update.List[1].Expr.(*driver.ValueExpr).GetString())
+
+	stmt, err = parser.ParseSQL("update orders set phone = '139'")
+	require.NoError(t, err)
+	changed, err = ns.encryptUpdate(stmt.(*ast.UpdateStmt))
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	stmt, err = parser.ParseSQL("update user set phone = concat(phone, '1')")
+	require.NoError(t, err)
+	_, err = ns.encryptUpdate(stmt.(*ast.UpdateStmt))
+	require.Error(t, err)
+}
+
+func TestDecryptValue(t *testing.T) {
+	cipherText, err := crypto.EncryptGCMWithAAD(testEncryptKey, []byte("13812345678"), []byte("user.phone"))
+	require.NoError(t, err)
+	encoded := base64.StdEncoding.EncodeToString(cipherText)
+	require.Equal(t, "13812345678", string(decryptValue(testEncryptColumn, []byte(encoded))))
+
+	// plain text written before encrypted is returned as it is
+	require.Equal(t, "13812345678", string(decryptValue(testEncryptColumn, []byte("13812345678"))))
+	require.Equal(t, encoded, string(decryptValue(newEncryptColumn([]byte("5678efg*1234abcd"), "user", "phone"), []byte(encoded))))
+
+	// cipher text copied to other column with the same key can't be decrypted
+	require.Equal(t, encoded, string(decryptValue(newEncryptColumn(testEncryptKey, "user", "id_card"), []byte(encoded))))
+	require.Equal(t, encoded, string(decryptValue(newEncryptColumn(testEncryptKey, "orders", "phone"), []byte(encoded))))
+}
+
+func TestGetEncryptColumns(t *testing.T) {
+	ns := newEncryptTestNamespace()
+	require.NotNil(t, ns.getEncryptColumns("USER"))
+	require.NotNil(t, ns.getEncryptColumns("user_0001"))
+	require.Nil(t, ns.getEncryptColumns("orders"))
+	require.Nil(t, ns.getEncryptColumns(""))
+}
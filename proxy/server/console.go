@@ -0,0 +1,41 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// assets of web console, it's a single page calling admin api with basic auth of browser
+//
+//go:embed console
+var consoleAssets embed.FS
+
+// @Summary web管理控制台
+// @Description 展示namespace状态、后端实例状态、慢SQL, 并支持下线从库和修改namespace配置
+// @Security BasicAuth
+// @Router /console/ [get]
+func (s *AdminServer) registerConsole() {
+	assets, err := fs.Sub(consoleAssets, "console")
+	if err != nil {
+		panic(err)
+	}
+	consoleGroup := s.engine.Group("/console", s.authRequired(models.AdminRoleViewer))
+	consoleGroup.StaticFS("/", http.FS(assets))
+}
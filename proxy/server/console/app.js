@@ -0,0 +1,292 @@
+// web console of gaea proxy, data is loaded from admin api of the same origin,
+// credentials of basic auth are sent by browser after login prompt.
+(function () {
+  'use strict';
+
+  var api = '/api/proxy';
+  var refreshInterval = 5000;
+  var namespaceLimit = 100;
+  var current = '';
+  var timer = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function escape(s) {
+    return String(s).replace(/[&<>"']/g, function (c) {
+      return { '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c];
+    });
+  }
+
+  function showMessage(text, isError) {
+    var m = $('message');
+    m.textContent = text;
+    m.className = isError ? 'error' : 'info';
+  }
+
+  function clearMessage() {
+    $('message').className = '';
+  }
+
+  // request admin api, errors of admin api are returned as json string with status 800
+  function request(method, path, body) {
+    var opts = { method: method, credentials: 'same-origin', headers: {} };
+    if (body !== undefined) {
+      opts.headers['Content-Type'] = 'application/json';
+      opts.body = body;
+    }
+    return fetch(path, opts).then(function (resp) {
+      return resp.text().then(function (text) {
+        var data = text;
+        try { data = JSON.parse(text); } catch (e) { /* plain text */ }
+        if (!resp.ok) {
+          throw new Error(typeof data === 'string' ? data : text);
+        }
+        return data;
+      });
+    });
+  }
+
+  function table(columns, rows) {
+    if (!rows.length) {
+      return '<p>none</p>';
+    }
+    var html = '<table><tr>' + columns.map(function (c) { return '<th>' + escape(c) + '</th>'; }).join('') + '</tr>';
+    rows.forEach(function (row) {
+      html += '<tr>' + row.join('') + '</tr>';
+    });
+    return html + '</table>';
+  }
+
+  function cell(v, cls) {
+    return '<td' + (cls ? ' class="' + cls + '"' : '') + '>' + escape(v) + '</td>';
+  }
+
+  function card(label, value) {
+    return '<div class="card"><div class="value">' + escape(value) + '</div><div class="label">' + escape(label) + '</div></div>';
+  }
+
+  // at most namespaceLimit namespaces are listed, others can be found by filter
+  function loadNamespaces() {
+    var path = api + '/namespace/list?limit=' + namespaceLimit + '&filter=' + encodeURIComponent($('namespace-filter').value);
+    return request('GET', path).then(function (names) {
+      var select = $('namespace');
+      select.innerHTML = names.map(function (n) {
+        return '<option value="' + escape(n) + '">' + escape(n) + '</option>';
+      }).join('');
+      var hash = decodeURIComponent(location.hash.slice(1));
+      current = names.indexOf(hash) >= 0 ? hash : (names[0] || '');
+      select.value = current;
+    });
+  }
+
+  function loadDashboard() {
+    var ns = encodeURIComponent(current);
+    return request('GET', api + '/namespace/status/' + ns).then(function (status) {
+      var backends = 0;
+      var down = 0;
+      Object.keys(status.slices).forEach(function (name) {
+        status.slices[name].forEach(function (b) {
+          backends++;
+          if (!b.up) {
+            down++;
+          }
+        });
+      });
+      var maxConnections = status.max_client_connections > 0 ? status.max_client_connections : 'unlimited';
+      $('cards').innerHTML =
+        card('client connections / max', status.client_connections + ' / ' + maxConnections) +
+        card('active transactions', status.active_transactions) +
+        card('mode', status.mode) +
+        card('slices', Object.keys(status.slices).length) +
+        card('backends down', down + ' / ' + backends);
+
+      var html = '';
+      Object.keys(status.slices).sort().forEach(function (name) {
+        html += '<h2>' + escape(name) + '</h2>';
+        html += table(['role', 'addr', 'datacenter', 'status', 'heartbeat lag', 'pool in use / active / capacity', 'idle', 'wait count', ''],
+          status.slices[name].map(function (b) {
+            var state = b.up ? 'up' : 'down';
+            if (b.offline) {
+              state += ' (offline)';
+            }
+            if (b.circuit_open) {
+              state += ' (circuit open)';
+            }
+            var action = '';
+            if (b.role !== 'master') {
+              action = '<button data-slice="' + escape(name) + '" data-addr="' + escape(b.addr) + '" data-offline="' + !b.offline + '">' +
+                (b.offline ? 'online' : 'offline') + '</button>';
+            }
+            return [
+              cell(b.role),
+              cell(b.addr),
+              cell(b.datacenter),
+              cell(state, b.up ? 'up' : 'down'),
+              cell(b.heartbeat_lag < 0 ? '-' : b.heartbeat_lag + 'ms'),
+              cell(b.in_use + ' / ' + b.active + ' / ' + b.capacity),
+              cell(b.idle),
+              cell(b.wait_count),
+              '<td>' + action + '</td>'
+            ];
+          }));
+      });
+      $('slices').innerHTML = html;
+    });
+  }
+
+  function fingerprintTable(fingerprints) {
+    return table(['md5', 'fingerprint'], Object.keys(fingerprints || {}).sort().map(function (md5) {
+      return [cell(md5), cell(fingerprints[md5], 'sql')];
+    }));
+  }
+
+  function loadSQL() {
+    var ns = encodeURIComponent(current);
+    var fields = 'fingerprint,count,errors,rows,avg_latency,p99_latency,max_latency';
+    var stats = request('GET', api + '/stats/sql/topn/' + ns + '?limit=20&window=5m&fields=' + fields).then(function (rows) {
+      $('sql-stats').innerHTML = table(['fingerprint', 'count', 'errors', 'rows', 'avg (ms)', 'p99 (ms)', 'max (ms)'],
+        rows.map(function (s) {
+          return [cell(s.fingerprint, 'sql'), cell(s.count), cell(s.errors), cell(s.rows),
+            cell(s.avg_latency.toFixed(2)), cell(s.p99_latency.toFixed(2)), cell(s.max_latency.toFixed(2))];
+        }));
+    }, function (err) {
+      // sql stats is disabled if sql_stats_capacity of namespace is not set
+      $('sql-stats').innerHTML = '<p>' + escape(err.message) + '</p>';
+    });
+    var session = request('GET', api + '/stats/sessionsqlfingerprint/' + ns).then(function (f) {
+      $('session-slow-sql').innerHTML = fingerprintTable(f.slow_sql);
+      $('session-error-sql').innerHTML = fingerprintTable(f.error_sql);
+    });
+    var backend = request('GET', api + '/stats/backendsqlfingerprint/' + ns).then(function (f) {
+      $('backend-slow-sql').innerHTML = fingerprintTable(f.slow_sql);
+      $('backend-error-sql').innerHTML = fingerprintTable(f.error_sql);
+    });
+    return Promise.all([stats, session, backend]);
+  }
+
+  function loadConfig() {
+    return request('GET', api + '/config/namespace/' + encodeURIComponent(current)).then(function (config) {
+      $('config-text').value = JSON.stringify(config, null, 2);
+    });
+  }
+
+  function activeTab() {
+    return document.querySelector('nav button.active').getAttribute('data-tab');
+  }
+
+  function refresh() {
+    if (!current) {
+      return;
+    }
+    var tab = activeTab();
+    var p;
+    if (tab === 'dashboard') {
+      p = loadDashboard();
+    } else if (tab === 'sql') {
+      p = loadSQL();
+    } else {
+      return;
+    }
+    p.then(clearMessage, function (err) {
+      showMessage(err.message, true);
+    });
+  }
+
+  function resetTimer() {
+    if (timer) {
+      clearInterval(timer);
+      timer = null;
+    }
+    if ($('auto-refresh').checked) {
+      timer = setInterval(refresh, refreshInterval);
+    }
+  }
+
+  function switchTab(tab) {
+    document.querySelectorAll('nav button').forEach(function (b) {
+      b.classList.toggle('active', b.getAttribute('data-tab') === tab);
+    });
+    document.querySelectorAll('main section').forEach(function (s) {
+      s.classList.toggle('active', s.id === tab);
+    });
+    if (tab === 'config') {
+      loadConfig().then(clearMessage, function (err) { showMessage(err.message, true); });
+    } else {
+      refresh();
+    }
+  }
+
+  document.querySelectorAll('nav button').forEach(function (b) {
+    b.addEventListener('click', function () { switchTab(b.getAttribute('data-tab')); });
+  });
+
+  $('namespace').addEventListener('change', function () {
+    current = this.value;
+    location.hash = encodeURIComponent(current);
+    switchTab(activeTab());
+  });
+
+  $('namespace-filter').addEventListener('change', function () {
+    loadNamespaces().then(function () {
+      switchTab(activeTab());
+    }, function (err) {
+      showMessage(err.message, true);
+    });
+  });
+
+  $('refresh').addEventListener('click', refresh);
+  $('auto-refresh').addEventListener('change', resetTimer);
+
+  $('slices').addEventListener('click', function (e) {
+    var b = e.target;
+    if (b.tagName !== 'BUTTON') {
+      return;
+    }
+    var offline = b.getAttribute('data-offline') === 'true';
+    var addr = b.getAttribute('data-addr');
+    if (!confirm((offline ? 'offline ' : 'online ') + addr + '?')) {
+      return;
+    }
+    var path = api + '/backend/' + (offline ? 'offline/' : 'online/') + encodeURIComponent(current) + '/' +
+      encodeURIComponent(b.getAttribute('data-slice')) + '?addr=' + encodeURIComponent(addr);
+    request('PUT', path).then(function () {
+      showMessage((offline ? 'offline ' : 'online ') + addr + ' succeed', false);
+      loadDashboard();
+    }, function (err) {
+      showMessage(err.message, true);
+    });
+  });
+
+  $('config-load').addEventListener('click', function () {
+    loadConfig().then(clearMessage, function (err) { showMessage(err.message, true); });
+  });
+
+  $('config-verify').addEventListener('click', function () {
+    request('POST', api + '/config/verify', $('config-text').value).then(function () {
+      showMessage('config is valid', false);
+    }, function (err) {
+      showMessage(err.message, true);
+    });
+  });
+
+  $('config-save').addEventListener('click', function () {
+    if (!confirm('save config of ' + current + ' to coordinator?')) {
+      return;
+    }
+    request('PUT', api + '/config/namespace/' + encodeURIComponent(current), $('config-text').value).then(function () {
+      showMessage('config of ' + current + ' is saved, reload it on all proxies by prepare/commit', false);
+    }, function (err) {
+      showMessage(err.message, true);
+    });
+  });
+
+  request('GET', api + '/version').then(function (v) {
+    $('version').textContent = v;
+  });
+  loadNamespaces().then(function () {
+    refresh();
+    resetTimer();
+  }, function (err) {
+    showMessage(err.message, true);
+  });
+})();
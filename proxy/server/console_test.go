@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsole(t *testing.T) {
+	accounts, _ := newAdminAccounts(&models.Proxy{AdminUser: "admin", AdminPassword: "secret"})
+	s := &AdminServer{accounts: accounts, engine: gin.New()}
+	s.registerConsole()
+
+	for _, test := range []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{"/console/", http.StatusOK, "Gaea Console"},
+		{"/console/app.js", http.StatusOK, "/api/proxy"},
+		{"/console/none.js", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.SetBasicAuth("admin", "secret")
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		assert.Equal(t, test.code, w.Code, test.path)
+		assert.True(t, strings.Contains(w.Body.String(), test.contains), test.path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/console/", nil)
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// diagnosticsFilePrefix prefix of diagnostics bundle file name in log path
+const diagnosticsFilePrefix = "gaea_diagnostics_"
+
+// sessionActivity what a session is doing, replaced as a whole so it can be read without lock of session
+type sessionActivity struct {
+	cmd         byte
+	fingerprint string    // fingerprint of running sql, literals are not kept
+	start       time.Time // zero if session is idle
+	inTrans     bool
+	lastActive  time.Time
+}
+
+// SessionInfo state of a client session in diagnostics bundle
+type SessionInfo struct {
+	ConnectionID  uint32 `json:"conn_id"`
+	Namespace     string `json:"namespace"`
+	User          string `json:"user"`
+	ClientAddr    string `json:"client_addr"`
+	DB            string `json:"db"`
+	InTransaction bool   `json:"in_transaction"`
+	Running       bool   `json:"running"`
+	Command       byte   `json:"command,omitempty"` // command being executed
+	SQL           string `json:"sql,omitempty"`     // fingerprint of sql being executed
+	Elapsed       int64  `json:"elapsed_ms"`        // time of running command, or idle time if session is idle
+}
+
+// NamespaceDiagnostics config version and backend status of a namespace in diagnostics bundle
+type NamespaceDiagnostics struct {
+	Version  string                              `json:"version"`
+	Backends map[string][]*backend.BackendStatus `json:"backends"` // key: slice name
+}
+
+// addSession register a session after handshake, so it's listed in diagnostics bundle
+func (s *Server) addSession(cc *Session) {
+	s.sessions.Store(cc.c.GetConnectionID(), cc)
+}
+
+// removeSession unregister a released session
+func (s *Server) removeSession(cc *Session) {
+	s.sessions.Delete(cc.c.GetConnectionID())
+}
+
+// setActivity record the command being executed by session, fingerprint is empty if it's not a sql
+func (cc *Session) setActivity(cmd byte, data []byte) {
+	var fingerprint string
+	if cmd == mysql.ComQuery || cmd == mysql.ComStmtPrepare {
+		fingerprint = mysql.GetFingerprint(string(data))
+	}
+	cc.activity.Store(&sessionActivity{
+		cmd:         cmd,
+		fingerprint: fingerprint,
+		start:       time.Now(),
+		inTrans:     cc.executor.isInTransaction(),
+	})
+}
+
+// clearActivity mark session idle after the response is written
+func (cc *Session) clearActivity() {
+	cc.activity.Store(&sessionActivity{
+		inTrans:    cc.executor.isInTransaction(),
+		lastActive: time.Now(),
+	})
+}
+
+func (cc *Session) info(now time.Time) *SessionInfo {
+	info := &SessionInfo{
+		ConnectionID: cc.c.GetConnectionID(),
+		Namespace:    cc.namespace,
+		User:         cc.executor.user,
+		ClientAddr:   cc.executor.clientAddr,
+		DB:           cc.executor.db,
+	}
+	a, ok := cc.activity.Load().(*sessionActivity)
+	if !ok {
+		return info
+	}
+	info.InTransaction = a.inTrans
+	if a.start.IsZero() {
+		info.Elapsed = now.Sub(a.lastActive).Milliseconds()
+		return info
+	}
+	info.Running = true
+	info.Command = a.cmd
+	info.SQL = a.fingerprint
+	info.Elapsed = now.Sub(a.start).Milliseconds()
+	return info
+}
+
+// GetSessions return state of client sessions, running sessions first and then ordered by elapsed time
+func (s *Server) GetSessions() []*SessionInfo {
+	now := time.Now()
+	var ret []*SessionInfo
+	s.sessions.Range(func(_, value interface{}) bool {
+		ret = append(ret, value.(*Session).info(now))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Running != ret[j].Running {
+			return ret[i].Running
+		}
+		return ret[i].Elapsed > ret[j].Elapsed
+	})
+	return ret
+}
+
+// GetNamespaceDiagnostics return config versions and backend status of all namespaces
+func (s *Server) GetNamespaceDiagnostics() map[string]*NamespaceDiagnostics {
+	ret := make(map[string]*NamespaceDiagnostics)
+	for name, version := range s.manager.GetNamespaceVersions() {
+		ns := s.manager.GetNamespace(name)
+		if ns == nil {
+			continue
+		}
+		ret[name] = &NamespaceDiagnostics{
+			Version:  version,
+			Backends: ns.GetBackendStatus(),
+		}
+	}
+	return ret
+}
+
+// DumpDiagnostics write a tar.gz bundle of goroutines, heap profile, client sessions, backend status
+// and config versions of namespaces into log path for offline analysis, return path of the bundle
+func (s *Server) DumpDiagnostics() (string, error) {
+	now := time.Now()
+	files := make(map[string][]byte)
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return "", fmt.Errorf("dump goroutine error: %v", err)
+	}
+	files["goroutine.txt"] = buf.Bytes()
+
+	buf = bytes.Buffer{}
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		return "", fmt.Errorf("dump heap error: %v", err)
+	}
+	files["heap.pprof"] = buf.Bytes()
+
+	config := map[string]interface{}{
+		"time":        now.Format(time.RFC3339),
+		"version":     s.ServerVersion,
+		"fingerprint": s.manager.ConfigFingerprint(),
+	}
+	for name, v := range map[string]interface{}{
+		"config.json":     config,
+		"sessions.json":   s.GetSessions(),
+		"namespaces.json": s.GetNamespaceDiagnostics(),
+	} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("dump %s error: %v", name, err)
+		}
+		files[name] = data
+	}
+
+	s.configLock.Lock()
+	logPath := s.ServerConfig.LogPath
+	s.configLock.Unlock()
+	path := filepath.Join(logPath, diagnosticsFilePrefix+now.Format("20060102150405")+".tar.gz")
+	if err := writeDiagnosticsBundle(path, now, files); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func writeDiagnosticsBundle(path string, modTime time.Time, files map[string][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create diagnostics bundle error: %v", err)
+	}
+	defer f.Close()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(files[name])),
+			ModTime: modTime,
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write diagnostics bundle error: %v", err)
+		}
+		if _, err = tw.Write(files[name]); err != nil {
+			return fmt.Errorf("write diagnostics bundle error: %v", err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("write diagnostics bundle error: %v", err)
+	}
+	if err = gw.Close(); err != nil {
+		return fmt.Errorf("write diagnostics bundle error: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiagnosticsSession(t *testing.T, s *Server, id uint32) *Session {
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	cc := se.session
+	cc.executor = se
+	cc.manager = localManager
+	cc.namespace = se.namespace
+	cc.proxy = s
+	cc.c.SetConnectionID(id)
+	cc.clearActivity()
+	s.addSession(cc)
+	return cc
+}
+
+func TestGetSessions(t *testing.T) {
+	s := &Server{manager: localManager}
+	idle := newDiagnosticsSession(t, s, 1)
+	running := newDiagnosticsSession(t, s, 2)
+	running.setActivity(mysql.ComQuery, []byte("select * from t where id = 1"))
+
+	sessions := s.GetSessions()
+	require.Len(t, sessions, 2)
+	assert.Equal(t, uint32(2), sessions[0].ConnectionID)
+	assert.True(t, sessions[0].Running)
+	assert.Equal(t, byte(mysql.ComQuery), sessions[0].Command)
+	assert.Equal(t, "select * from t where id = ?", sessions[0].SQL)
+	assert.Equal(t, "test_executor", sessions[0].User)
+	assert.Equal(t, uint32(1), sessions[1].ConnectionID)
+	assert.False(t, sessions[1].Running)
+	assert.Empty(t, sessions[1].SQL)
+
+	running.clearActivity()
+	s.removeSession(idle)
+	sessions = s.GetSessions()
+	require.Len(t, sessions, 1)
+	assert.False(t, sessions[0].Running)
+}
+
+func TestDumpDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_diagnostics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Server{manager: localManager, ServerConfig: &models.Proxy{LogPath: dir}}
+	cc := newDiagnosticsSession(t, s, 1)
+	cc.setActivity(mysql.ComQuery, []byte("select sleep(10)"))
+
+	path, err := s.DumpDiagnostics()
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.True(t, strings.HasPrefix(filepath.Base(path), diagnosticsFilePrefix))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = data
+	}
+
+	for _, name := range []string{"goroutine.txt", "heap.pprof", "config.json", "sessions.json", "namespaces.json"} {
+		assert.NotEmpty(t, files[name], name)
+	}
+	assert.Contains(t, string(files["goroutine.txt"]), "TestDumpDiagnostics")
+
+	var sessions []*SessionInfo
+	require.NoError(t, json.Unmarshal(files["sessions.json"], &sessions))
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "select sleep(?)", sessions[0].SQL)
+
+	var namespaces map[string]*NamespaceDiagnostics
+	require.NoError(t, json.Unmarshal(files["namespaces.json"], &namespaces))
+	require.Contains(t, namespaces, "test_executor_namespace")
+	assert.NotEmpty(t, namespaces["test_executor_namespace"].Version)
+}
@@ -17,7 +17,9 @@ package server
 import (
 	"context"
 	"fmt"
+	"math"
 	"net"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -37,6 +39,7 @@ import (
 	"github.com/XiaoMi/Gaea/proxy/plan"
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/hack"
+	"github.com/XiaoMi/Gaea/util/sync2"
 )
 
 const (
@@ -45,6 +48,11 @@ const (
 	masterHint         = "*master*"
 	mycatHint          = "/* !mycat:"
 	standardMasterHint = "/*+ master */"
+	// scatter select hints, return results of succeeded slices or fail at once when some slices fail
+	partialResultHint = "/*partial_result*/"
+	failFastHint      = "/*fail_fast*/"
+	// session variable to return partial results of scatter select
+	gaeaPartialResultVariable = "gaea_partial_result"
 	// general query log variable
 	gaeaGeneralLogVariable   = "gaea_general_log"
 	readonlyVariable         = "read_only"
@@ -62,11 +70,13 @@ const (
 
 	// multiBackendAddrMark marks the backend addr is one of multi backend addrs
 	multiBackendAddrMark = ">"
-
-	// select last_insert_id()
-	lastInsetIdMark = "SELECTLAST_INSERT_ID()"
 )
 
+// sessionFuncTokens are second tokens of selects of session last insert id, found rows and row count,
+// which are answered by proxy
+var sessionFuncTokens = []string{"last_insert_id", "@@identity", "@@last_insert_id", "@@session.identity", "@@session.last_insert_id",
+	"found_rows", "row_count"}
+
 // SessionExecutor is bound to a session, so requests are serializable
 type SessionExecutor struct {
 	manager *Manager
@@ -78,19 +88,41 @@ type SessionExecutor struct {
 
 	status       uint16
 	lastInsertID uint64
+	foundRows    uint64       // FOUND_ROWS() of session, rows of last result set
+	foundRowsSet bool         // found rows are set by SQL_CALC_FOUND_ROWS of current statement
+	rowCount     int64        // ROW_COUNT() of session, affected rows of last statement
+	warnings     []warningRow // warnings of last statement merged from all slices, answered by SHOW WARNINGS
+	stmtWarnings []warningRow // warnings collected from backends during current statement
 
 	collation        mysql.CollationID
 	charset          string
 	sessionVariables *mysql.SessionVariables
 
-	keepSession bool
-	userPriv    int
+	keepSession  bool
+	multiplexing bool // detach keep session connections after statement or transaction
+	pinned       bool // state is left on keep session connections, they can't be detached any more
+	userPriv     int
+	connectAttrs map[string]string // client connection attributes in handshake
 
 	txConns          map[string]backend.PooledConnect
 	ksConns          map[string]backend.PooledConnect // keep session connections
 	nsChangeIndexOld uint32
 	savepoints       []string
 	txLock           sync.Mutex
+	txNamespace      *Namespace     // namespace which backend connections of transaction belong to
+	txReadOnly       bool           // transaction is started by START TRANSACTION READ ONLY
+	nextTxReadOnly   bool           // next transaction is read only, set by SET TRANSACTION READ ONLY
+	txFromSlave      bool           // backend connections of transaction are got from slaves
+	txAborted        bool           // transaction is rolled back by proxy since one of its backend connections is lost
+	cdcEvents        []*CDCEvent    // change events of transaction, published after commit
+	cdcSavepoints    map[string]int // key: savepoint, value: count of change events before savepoint
+
+	memoryBudget     *resourceBudget // budget which result memory of current command is reserved from
+	reservedMemory   sync2.AtomicInt64
+	querySlotRelease func() // release query slot held by current command, nil if no slot is held
+	partialResult    *bool  // session gaea_partial_result, nil means namespace scatter_partial_result is used
+
+	planTemplates sessionPlanCache // session local plan templates in front of namespace plan cache
 
 	stmtID uint32
 	stmts  map[uint32]*Stmt //prepare相关,client端到proxy的stmt
@@ -125,6 +157,8 @@ const (
 	RespEOF
 	// RespNoop means empty message
 	RespNoop
+	// RespStatistics means human readable status string, for ComStatistics
+	RespStatistics
 )
 
 // CreateOKResponse create ok response
@@ -187,6 +221,14 @@ func CreateNoopResponse() Response {
 	}
 }
 
+// CreateStatisticsResponse create status string response, for ComStatistics
+func CreateStatisticsResponse(info string) Response {
+	return Response{
+		RespType: RespStatistics,
+		Data:     info,
+	}
+}
+
 func newSessionExecutor(manager *Manager) *SessionExecutor {
 
 	return &SessionExecutor{
@@ -243,6 +285,140 @@ func (se *SessionExecutor) setStringSessionVariable(name string, valueStr string
 	return se.sessionVariables.Set(name, valueStr)
 }
 
+func (se *SessionExecutor) setOnOffSessionVariable(name string, valueStr string) error {
+	if valueStr == mysql.KeywordDefault {
+		se.sessionVariables.Delete(name)
+		return nil
+	}
+
+	onOffValue, err := getOnOffVariable(valueStr)
+	if err != nil {
+		return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, valueStr)
+	}
+	return se.setIntSessionVariable(name, onOffValue)
+}
+
+// setNamespaceSessionVariables set default session variables of namespace after the session is authenticated
+func (se *SessionExecutor) setNamespaceSessionVariables() {
+	ns := se.GetNamespace()
+	if ns == nil {
+		return
+	}
+	if ns.sqlMode != "" {
+		if err := se.sessionVariables.Set(mysql.SQLModeStr, ns.sqlMode); err != nil {
+			log.Warn("set sql_mode of namespace %s error: %v", ns.name, err)
+		}
+	}
+	if ns.timeZone != "" {
+		if err := se.sessionVariables.Set(mysql.TimeZone, ns.timeZone); err != nil {
+			log.Warn("set time_zone of namespace %s error: %v", ns.name, err)
+		}
+	}
+}
+
+// setNamespaceDefaultVariable set session variable which has default value in namespace config,
+// DEFAULT means the value of namespace instead of the one of backend mysql
+func (se *SessionExecutor) setNamespaceDefaultVariable(name string, valueStr string, nsDefault string) error {
+	if strings.ToLower(valueStr) == mysql.KeywordDefault && nsDefault != "" {
+		valueStr = nsDefault
+	}
+	return se.setStringSessionVariable(name, valueStr)
+}
+
+// GetConnectAttrs return client connection attributes
+func (se *SessionExecutor) GetConnectAttrs() map[string]string {
+	return se.connectAttrs
+}
+
+// getProgramName return program name of client in connection attributes
+func (se *SessionExecutor) getProgramName() string {
+	if name, ok := se.connectAttrs["program_name"]; ok {
+		return name
+	}
+	return se.connectAttrs["_client_name"]
+}
+
+// formatConnectAttrs format connection attributes as sorted key=value list
+func formatConnectAttrs(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+attrs[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// getIntSessionVariable return value of int session variable, 0 if it's not set
+func (se *SessionExecutor) getIntSessionVariable(name string) int64 {
+	v, ok := se.sessionVariables.Get(name)
+	if !ok {
+		return 0
+	}
+	value, _ := v.(*mysql.Variable).Get().(int64)
+	return value
+}
+
+// getMaxExecuteTime return max execute time in milliseconds, 0 means no limit.
+// MAX_EXECUTION_TIME hint of statement, or session max_execution_time if hint is not set, takes precedence
+// over namespace max_sql_execute_time if it's stricter, so clients can limit themselves but can't bypass the namespace limit.
+// Like mysql, hint and session max_execution_time only work for select, other statements are limited by namespace only.
+func (se *SessionExecutor) getMaxExecuteTime(stmtType int, hintLimit int) int {
+	nsLimit := se.GetNamespace().GetMaxExecuteTime()
+	if stmtType != parser.StmtSelect {
+		return nsLimit
+	}
+	sessionLimit := se.getIntSessionVariable(mysql.MaxExecutionTime)
+	if hintLimit > 0 {
+		sessionLimit = int64(hintLimit)
+	}
+	if sessionLimit > 0 && (nsLimit <= 0 || sessionLimit < int64(nsLimit)) {
+		return int(sessionLimit)
+	}
+	return nsLimit
+}
+
+var maxExecutionTimeHintRegexp = regexp.MustCompile(`(?i)/\*\+[^*]*\bmax_execution_time\s*\(\s*(\d+)\s*\)`)
+
+// getMaxExecutionTimeHint return limit of optimizer hint /*+ MAX_EXECUTION_TIME(N) */ in milliseconds,
+// it only works for select like mysql, 0 means not set
+func getMaxExecutionTimeHint(stmtType int, sql string) int {
+	if stmtType != parser.StmtSelect || !strings.Contains(sql, "/*+") {
+		return 0
+	}
+	m := maxExecutionTimeHintRegexp.FindStringSubmatch(sql)
+	if m == nil {
+		return 0
+	}
+	limit, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// getSelectLimit return session sql_select_limit, 0 means no limit
+func (se *SessionExecutor) getSelectLimit() int {
+	limit := se.getIntSessionVariable(mysql.SQLSelectLimit)
+	if limit <= 0 || limit > math.MaxInt32 {
+		return 0
+	}
+	return int(limit)
+}
+
+func (se *SessionExecutor) setPartialResultVariable(valueStr string) error {
+	v, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return errors.ErrInvalidArgument
+	}
+	partialResult := v == 1
+	se.partialResult = &partialResult
+	return nil
+}
+
 func (se *SessionExecutor) setGeneralLogVariable(valueStr string) error {
 	v, err := strconv.Atoi(valueStr)
 	if err != nil {
@@ -262,6 +438,44 @@ func (se *SessionExecutor) SetLastInsertID(id uint64) {
 	se.lastInsertID = id
 }
 
+// GetFoundRows return found_rows() of session
+func (se *SessionExecutor) GetFoundRows() uint64 {
+	return se.foundRows
+}
+
+// SetFoundRows store found_rows() counted for SQL_CALC_FOUND_ROWS
+func (se *SessionExecutor) SetFoundRows(n uint64) {
+	se.foundRows = n
+	se.foundRowsSet = true
+}
+
+// GetRowCount return row_count() of session
+func (se *SessionExecutor) GetRowCount() int64 {
+	return se.rowCount
+}
+
+// recordRowCount record found_rows() and row_count() by result of statement like MySQL:
+// row_count() is -1 for statements returning result set or failed, affected rows for others,
+// found_rows() is rows of the last result set unless it's set by SQL_CALC_FOUND_ROWS
+func (se *SessionExecutor) recordRowCount(r *mysql.Result, err error) {
+	defer func() {
+		se.foundRowsSet = false
+	}()
+	switch {
+	case err != nil:
+		se.rowCount = -1
+	case r == nil:
+		se.rowCount = 0
+	case r.Resultset != nil:
+		se.rowCount = -1
+		if !se.foundRowsSet {
+			se.foundRows = uint64(len(r.RowDatas))
+		}
+	default:
+		se.rowCount = int64(r.AffectedRows)
+	}
+}
+
 func (se *SessionExecutor) HandleSet(reqCtx *util.RequestContext, sql string, stmt *ast.SetStmt) (*mysql.Result, error) {
 	return se.handleSet(reqCtx, sql, stmt)
 }
@@ -394,6 +608,12 @@ func (se *SessionExecutor) ExecuteCommand(cmd byte, data []byte) Response {
 		return CreateOKResponse(se.status)
 	case mysql.ComSetOption:
 		return CreateEOFResponse(se.status)
+	case mysql.ComStatistics:
+		// answered by proxy, status of backends is meaningless to client
+		return CreateStatisticsResponse(se.manager.GetStatisticManager().statisticsInfo())
+	case mysql.ComDebug:
+		// mysql dumps debug info to error log, nothing to do for proxy
+		return CreateOKResponse(se.status)
 	default:
 		msg := fmt.Sprintf("command %d not supported now", cmd)
 		log.Warn("dispatch command failed, error: %s", msg)
@@ -424,6 +644,39 @@ func (se *SessionExecutor) getBackendConns(sqls map[string]map[string][]string,
 	return
 }
 
+// getHealthyBackendConns get connections for partial result scatter select, slices which can't get connection
+// (e.g. all instances are down) are skipped, and the skipped sqls are counted as warnings.
+// error is returned only if no connection is got.
+func (se *SessionExecutor) getHealthyBackendConns(reqCtx *util.RequestContext, sqls map[string]map[string][]string) (map[string]backend.PooledConnect, map[string]map[string][]string, error) {
+	pcs := make(map[string]backend.PooledConnect, len(sqls))
+	healthySQLs := make(map[string]map[string][]string, len(sqls))
+	var firstErr error
+	for sliceName, sliceSQLs := range sqls {
+		pc, err := se.getBackendConn(sliceName, getFromSlave(reqCtx))
+		if err != nil {
+			log.Warn("[ns:%s]skip slice %s in partial result query, get connection error: %v", se.GetNamespace().name, sliceName, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			for _, dbSQLs := range sliceSQLs {
+				reqCtx.AddWarnings(len(dbSQLs))
+			}
+			continue
+		}
+		pcs[sliceName] = pc
+		healthySQLs[sliceName] = sliceSQLs
+		se.backendAddr = pc.GetAddr()
+		se.backendConnectionId = pc.GetConnectionID()
+	}
+	if len(pcs) == 0 {
+		return pcs, sqls, firstErr
+	}
+	if len(pcs) > 1 {
+		se.backendAddr = multiBackendAddrMark + se.backendAddr
+	}
+	return pcs, healthySQLs, nil
+}
+
 func (se *SessionExecutor) getBackendConn(sliceName string, fromSlave bool) (pc backend.PooledConnect, err error) {
 	if se.IsKeepSession() {
 		return se.getBackendKsConn(sliceName)
@@ -434,11 +687,27 @@ func (se *SessionExecutor) getBackendConn(sliceName string, fromSlave bool) (pc
 func (se *SessionExecutor) getBackendNoKsConn(sliceName string, fromSlave bool) (pc backend.PooledConnect, err error) {
 	if !se.isInTransaction() {
 		slice := se.GetNamespace().GetSlice(sliceName)
-		return slice.GetConn(fromSlave, se.GetNamespace().GetUserProperty(se.user), se.GetNamespace().localSlaveReadPriority)
+		return se.getSliceConn(slice, fromSlave)
 	}
 	return se.getTransactionConn(sliceName)
 }
 
+// getSliceConn get connection of slice by user type, reads of statistic users are served by statistic slaves,
+// or by slaves or master according to spill-over policy of namespace, the serving role is recorded
+func (se *SessionExecutor) getSliceConn(slice *backend.Slice, fromSlave bool) (backend.PooledConnect, error) {
+	ns := se.GetNamespace()
+	userType := ns.GetUserProperty(se.user)
+	if !fromSlave || userType != models.StatisticUser {
+		return slice.GetConn(fromSlave, userType, ns.localSlaveReadPriority)
+	}
+	pc, role, err := slice.GetStatisticConn(ns.statisticSpillOver, ns.localSlaveReadPriority)
+	if err != nil {
+		return nil, err
+	}
+	se.manager.GetStatisticManager().RecordStatisticQuery(ns.name, slice.GetSliceName(), role)
+	return pc, nil
+}
+
 func (se *SessionExecutor) getBackendKsConn(sliceName string) (pc backend.PooledConnect, err error) {
 	pc, ok := se.ksConns[sliceName]
 	if ok {
@@ -446,7 +715,7 @@ func (se *SessionExecutor) getBackendKsConn(sliceName string) (pc backend.Pooled
 	}
 
 	slice := se.GetNamespace().GetSlice(sliceName)
-	pc, err = slice.GetConn(se.userPriv == models.ReadOnly, se.GetNamespace().GetUserProperty(se.user), se.GetNamespace().localSlaveReadPriority)
+	pc, err = se.getSliceConn(slice, se.userPriv == models.ReadOnly)
 	if err != nil {
 		log.Warn("get connection from backend failed, error: %s", err.Error())
 		return
@@ -476,13 +745,29 @@ func (se *SessionExecutor) getTransactionConn(sliceName string) (pc backend.Pool
 	se.txLock.Lock()
 	defer se.txLock.Unlock()
 
+	if se.txAborted {
+		return nil, newTxAbortedError()
+	}
+
 	var ok bool
 	if pc, ok = se.txConns[sliceName]; ok {
 		return
 	}
 
-	slice := se.GetNamespace().GetSlice(sliceName) // returns nil only when the conf is error (fatal) so panic is correct
-	if pc, err = slice.GetMasterConn(); err != nil {
+	ns := se.GetNamespace()
+	slice := ns.GetSlice(sliceName) // returns nil only when the conf is error (fatal) so panic is correct
+	// all connections of a transaction are got from the same role
+	fromSlave := se.txFromSlave
+	if len(se.txConns) == 0 {
+		fromSlave = se.isReadOnlyTxToSlave(se.txReadOnly)
+	}
+	if fromSlave {
+		// lagging or down slaves are skipped, master is used if no slave is available
+		pc, err = se.getSliceConn(slice, true)
+	} else {
+		pc, err = slice.GetMasterConn()
+	}
+	if err != nil {
 		return
 	}
 	// Synchronize session variables before starting the transaction.
@@ -490,7 +775,7 @@ func (se *SessionExecutor) getTransactionConn(sliceName string) (pc backend.Pool
 	// Setting session variables after `BEGIN` might not affect the transaction as expected,
 	// since some session settings need to be established before the transaction starts.
 	// pc.SetAutoCommit(0) is equivalent to starting a transaction
-	if err = pc.SyncSessionVariables(se.sessionVariables); err != nil {
+	if err = InitializeSessionVariables(pc, se.GetCharset(), se.GetCollationID(), se.sessionVariables, ns.sqlMode != ""); err != nil {
 		pc.Close()
 		pc.Recycle()
 		return
@@ -501,8 +786,9 @@ func (se *SessionExecutor) getTransactionConn(sliceName string) (pc backend.Pool
 			pc.Recycle()
 			return
 		}
-	} else {
-		if err = pc.Begin(); err != nil {
+	}
+	if se.isAutoCommit() || se.txReadOnly {
+		if err = se.beginTx(pc); err != nil {
 			pc.Close()
 			pc.Recycle()
 			return
@@ -511,10 +797,24 @@ func (se *SessionExecutor) getTransactionConn(sliceName string) (pc backend.Pool
 	for _, savepoint := range se.savepoints {
 		pc.Execute("savepoint "+savepoint, 0)
 	}
+	// old namespace won't be closed until the transaction ends
+	if se.txNamespace == nil {
+		se.txNamespace = se.GetNamespace()
+		se.txNamespace.activeTxs.Add(1)
+	}
 	se.txConns[sliceName] = pc
+	se.txFromSlave = fromSlave
 	return
 }
 
+// releaseTxNamespace release namespace held by transaction, must be called with txLock held
+func (se *SessionExecutor) releaseTxNamespace() {
+	if se.txNamespace != nil {
+		se.txNamespace.activeTxs.Add(-1)
+		se.txNamespace = nil
+	}
+}
+
 func (se *SessionExecutor) recycleBackendConn(pc backend.PooledConnect) {
 	if pc == nil {
 		return
@@ -533,6 +833,7 @@ func (se *SessionExecutor) recycleBackendConn(pc backend.PooledConnect) {
 
 	if se.IsKeepSession() {
 		se.session.clearKsConns(se.nsChangeIndexOld)
+		se.detachKsConns()
 		return
 	}
 
@@ -544,7 +845,11 @@ func (se *SessionExecutor) recycleBackendConn(pc backend.PooledConnect) {
 }
 
 func (se *SessionExecutor) recycleBackendConns(pcs map[string]backend.PooledConnect, rollback bool) {
-	if se.isInTransaction() || se.IsKeepSession() {
+	if se.IsKeepSession() {
+		se.detachKsConns()
+		return
+	}
+	if se.isInTransaction() {
 		return
 	}
 
@@ -561,16 +866,17 @@ func (se *SessionExecutor) recycleBackendConns(pcs map[string]backend.PooledConn
 
 // initBackendConn tries to initialize the database connection with the specified database,
 // charset, and session variables.
-func initBackendConn(pc backend.PooledConnect, phyDB string, charset string, collation mysql.CollationID, sessionVariables *mysql.SessionVariables) error {
+// sql_mode of connection is verified after session variables are changed if verifySQLMode is true.
+func initBackendConn(pc backend.PooledConnect, phyDB string, charset string, collation mysql.CollationID, sessionVariables *mysql.SessionVariables, verifySQLMode bool) error {
 	if err := pc.UseDB(phyDB); err != nil {
 		return err
 	}
-	return InitializeSessionVariables(pc, charset, collation, sessionVariables)
+	return InitializeSessionVariables(pc, charset, collation, sessionVariables, verifySQLMode)
 }
 
 // InitializeSessionVariables sets the charset and session variables for the pooled connection.
 // It attempts to write these settings and handles errors appropriately by closing the connection.
-func InitializeSessionVariables(pc backend.PooledConnect, charset string, collation mysql.CollationID, sessionVariables *mysql.SessionVariables) error {
+func InitializeSessionVariables(pc backend.PooledConnect, charset string, collation mysql.CollationID, sessionVariables *mysql.SessionVariables, verifySQLMode bool) error {
 	charsetChanged, err := pc.SetCharset(charset, collation)
 	if err != nil {
 		return err
@@ -589,6 +895,9 @@ func InitializeSessionVariables(pc backend.PooledConnect, charset string, collat
 			sessionVariables.Reset(err)
 			return err
 		}
+		if verifySQLMode && variablesChanged {
+			return verifyBackendSQLMode(pc, sessionVariables)
+		}
 	}
 
 	return nil
@@ -599,30 +908,53 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 
 	parallel := len(pcs)
 	if parallel != len(sqls) {
-		log.Warn("Session executeInMultiSlices error, conns: %v, sqls: %v, error: %s", pcs, sqls, errors.ErrConnNotEqual.Error())
+		log.Warn("Session executeInMultiSlices error, conns: %v, sqls: %v, error: %s", pcs, se.GetNamespace().redactLogSQLs(sqls), errors.ErrConnNotEqual.Error())
 		return nil, errors.ErrConnNotEqual
 	} else if parallel == 0 {
 		return nil, errors.ErrNoPlan
 	}
 
-	var ctx = context.Background()
-	var cancel context.CancelFunc
-	maxExecuteTime := se.manager.GetNamespace(se.namespace).GetMaxExecuteTime()
-	if maxExecuteTime > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(maxExecuteTime)*time.Millisecond)
-		defer cancel()
+	ctx, cancel, maxExecuteTime := se.statementContext(reqCtx)
+	defer cancel()
+	ctx, stmt := se.trackSlowSQL(ctx, reqCtx)
+	ctx = se.resultMemoryContext(ctx)
+
+	ns := se.GetNamespace()
+	// limit slices executed at the same time, all slices are executed at once by default
+	var running chan struct{}
+	if ns.scatterParallelism > 0 && ns.scatterParallelism < parallel {
+		running = make(chan struct{}, ns.scatterParallelism)
+	}
+	shardTimeout := time.Duration(ns.scatterShardTimeout) * time.Millisecond
+	// sqls of a slice are pipelined on its connection, but not if each of them has its own timeout
+	pipelineDepth := ns.scatterPipelineDepth
+	if shardTimeout > 0 {
+		pipelineDepth = 0
+	}
+	partialResult := reqCtx.IsPartialResult()
+	failed := sync2.NewAtomicBool(false)
+	// once a slice fails, reads of other slices are interrupted, so their connections are not pinned by
+	// the statement which has already failed. They are not interrupted for partial result which needs
+	// other slices, or in transaction whose work on other slices would be lost with closed connections.
+	shardsCtx, cancelShards := ctx, context.CancelFunc(func() {})
+	if !partialResult && !se.isInTransaction() {
+		shardsCtx, cancelShards = context.WithCancel(ctx)
+	}
+	defer cancelShards()
+	var failOnce sync.Once
+	var failErr error // the first error failing the statement
+	fail := func(err error) {
+		failed.Set(true)
+		failOnce.Do(func() {
+			failErr = err
+			cancelShards()
+		})
 	}
 
 	// Control go routine execution
 	done := make(chan string, parallel)
 	defer close(done)
 
-	// This map is not thread safe.
-	pcsUnCompleted := make(map[string]backend.PooledConnect, parallel)
-	for sliceName, pc := range pcs {
-		pcsUnCompleted[sliceName] = pc
-	}
-
 	resultCount := 0
 	for _, sqlSlice := range sqls {
 		for _, sqlDB := range sqlSlice {
@@ -630,7 +962,22 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 		}
 	}
 	rs := make([]interface{}, resultCount)
+	warnings := make([][]warningRow, resultCount)
 	f := func(reqCtx *util.RequestContext, rs []interface{}, i int, sliceName string, execSqls map[string][]string, pc backend.PooledConnect) {
+		defer func() {
+			done <- sliceName
+		}()
+		if running != nil {
+			running <- struct{}{}
+			defer func() {
+				<-running
+			}()
+		}
+		// fail fast, slices waiting for execution are skipped once a slice fails
+		if !partialResult && failed.Get() {
+			return
+		}
+
 		// 对 execSqls 排序后处理
 		dbs := make([]string, 0, len(execSqls))
 		for k := range execSqls {
@@ -640,25 +987,49 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 			return dbs[i] < dbs[j]
 		})
 		for _, db := range dbs {
-			err := initBackendConn(pc, db, se.GetCharset(), se.GetCollationID(), se.GetVariables())
+			err := initBackendConn(pc, db, se.GetCharset(), se.GetCollationID(), se.GetVariables(), ns.sqlMode != "")
 			if err != nil {
+				err = ns.enrichBackendError(err, sliceName, db, pc.GetAddr())
 				rs[i] = err
+				fail(err)
 				break
 			}
 			sqls := execSqls[db]
-			for _, v := range sqls {
+			for len(sqls) > 0 {
+				n := 1
+				if pipelineDepth > 1 {
+					n = pipelineDepth
+					if n > len(sqls) {
+						n = len(sqls)
+					}
+				}
 				startTime := time.Now()
-				r, err := pc.Execute(v, se.manager.GetNamespace(se.namespace).GetMaxResultSize())
-				se.manager.RecordBackendSQLMetrics(reqCtx, se, sliceName, v, pc.GetAddr(), startTime, err)
-				if err != nil {
-					rs[i] = err
-				} else {
-					rs[i] = r
+				results, errs := executeBatchInScatterShard(shardsCtx, shardTimeout, pc, sqls[:n], ns.GetMaxResultSize())
+				for j, v := range sqls[:n] {
+					err := errs[j]
+					se.manager.RecordBackendSQLMetrics(reqCtx, se, sliceName, v, pc.GetAddr(), startTime, err)
+					if err == backend.ErrExecuteTimeout {
+						se.killTimeoutQuery(sliceName, pc)
+						rs[i] = err
+						fail(err)
+						return
+					}
+					if err != nil {
+						err = ns.enrichBackendError(err, sliceName, db, pc.GetAddr())
+						rs[i] = err
+						fail(err)
+					} else {
+						rs[i] = results[j]
+						// warnings of pipelined sqls are overwritten by the later ones, only their counts are kept
+						if j == n-1 {
+							warnings[i] = fetchWarnings(pc, results[j])
+						}
+					}
+					i++
 				}
-				i++
+				sqls = sqls[n:]
 			}
 		}
-		done <- sliceName
 	}
 
 	offset := 0
@@ -678,84 +1049,257 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 		}
 	}
 
+	// wait for all slices, timed out reads are interrupted by ctx so this won't block forever
 	for i := 0; i < parallel; i++ {
-		select {
-		case sliceName := <-done:
-			delete(pcsUnCompleted, sliceName)
-		case <-ctx.Done():
-			for sliceName, pc := range pcsUnCompleted {
-				connID := pc.GetConnectionID()
-				dc, err := se.manager.GetNamespace(se.namespace).GetSlice(sliceName).GetDirectConn(pc.GetAddr())
-				if err != nil {
-					log.Warn("kill thread id: %d failed, get connection err: %v", connID, err.Error())
-					continue
-				}
-				if _, err = dc.Execute(fmt.Sprintf("KILL QUERY %d", connID), 0); err != nil {
-					log.Warn("kill thread id: %d failed, err: %v", connID, err.Error())
-				}
-				dc.Close()
-			}
-			for j := 0; j < len(pcsUnCompleted); j++ {
-				<-done
-			}
-			return nil, fmt.Errorf("%v %dms", errors.ErrTimeLimitExceeded, maxExecuteTime)
+		<-done
+	}
+	for _, w := range warnings {
+		se.addStmtWarnings(w)
+	}
+	if ns.slowSQLExplainer != nil {
+		if slice, db, sql, ok := anySQL(sqls); ok {
+			reqCtx.SetBackendExecution(slice, pcs[slice].GetAddr(), db, sql)
 		}
 	}
+	killErr := untrackSlowSQL(stmt)
 
-	var err error
-	r := make([]*mysql.Result, resultCount)
-	for i, v := range rs {
-		if e, ok := v.(error); ok {
-			err = e
-			break
+	for sliceName, pc := range pcs {
+		if !pc.IsClosed() {
+			continue
+		}
+		// recycleBackendConns skips connections held by session, recycle them here
+		if se.IsKeepSession() || se.isInTransaction() {
+			se.dropClosedConn(sliceName, pc)
+			pc.Recycle()
+		}
+	}
+	if partialResult && killErr == nil {
+		if r, ok := getPartialResults(ns.redactLogSQLs(sqls), rs); ok {
+			reqCtx.AddWarnings(len(rs) - len(r))
+			return r, nil
+		}
+	}
+
+	if failErr == backend.ErrExecuteTimeout {
+		log.Warn("exec sqls: %v, error: %s", ns.redactLogSQLs(sqls), errors.ErrTimeLimitExceeded.Error())
+		if killErr != nil {
+			return nil, killErr
+		}
+		// the whole query is not timed out, so it's interrupted by shard timeout
+		if ctx.Err() == nil {
+			return nil, newQueryTimeoutError(ns.scatterShardTimeout)
 		}
+		return nil, newQueryTimeoutError(maxExecuteTime)
+	}
+	if failErr != nil {
+		return nil, failErr
+	}
+
+	r := make([]*mysql.Result, resultCount)
+	for i := range rs {
 		if rs[i] != nil {
 			r[i] = rs[i].(*mysql.Result)
 		}
 	}
-	return r, err
+	return r, nil
 }
 
-func (se *SessionExecutor) executeInSlice(reqCtx *util.RequestContext, pc backend.PooledConnect, phyDb, sql string) (*mysql.Result, error) {
-	var ctx = context.Background()
-	var cancel context.CancelFunc
-	maxExecuteTime := se.GetNamespace().GetMaxExecuteTime()
-	if maxExecuteTime > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(maxExecuteTime)*time.Millisecond)
-		defer cancel()
+func (se *SessionExecutor) executeInSlice(reqCtx *util.RequestContext, pc backend.PooledConnect, sliceName, phyDb, sql string) (*mysql.Result, error) {
+	if pc == nil {
+		return nil, fmt.Errorf("no backend connection")
 	}
 
-	// Control go routine execution
-	done := make(chan struct{})
+	if err := initBackendConn(pc, phyDb, se.GetCharset(), se.GetCollationID(), se.GetVariables(), se.GetNamespace().sqlMode != ""); err != nil {
+		return nil, se.GetNamespace().enrichBackendError(err, sliceName, phyDb, pc.GetAddr())
+	}
 
-	var rs *mysql.Result
-	var err error
-	go func() {
-		defer close(done)
-		if pc == nil {
-			err = fmt.Errorf("no backend connection")
-			done <- struct{}{}
-			return
+	if se.GetNamespace().slowSQLExplainer != nil {
+		reqCtx.SetBackendExecution(sliceName, pc.GetAddr(), phyDb, sql)
+	}
+
+	ctx, cancel, maxExecuteTime := se.statementContext(reqCtx)
+	defer cancel()
+	ctx, stmt := se.trackSlowSQL(ctx, reqCtx)
+	ctx = se.resultMemoryContext(ctx)
+
+	startTime := time.Now()
+	rs, err := executeWithContext(ctx, pc, sql, se.GetNamespace().GetMaxResultSize())
+	killErr := untrackSlowSQL(stmt)
+	se.manager.RecordBackendSQLMetrics(reqCtx, se, sliceName, sql, pc.GetAddr(), startTime, err)
+	if err == backend.ErrExecuteTimeout {
+		log.Warn("exec sql: %s, error: %s", se.GetNamespace().redactLogSQL(sql), errors.ErrTimeLimitExceeded.Error())
+		se.killTimeoutQuery(sliceName, pc)
+		se.dropClosedConn(sliceName, pc)
+		if killErr != nil {
+			return nil, killErr
 		}
-		err = initBackendConn(pc, phyDb, se.GetCharset(), se.GetCollationID(), se.GetVariables())
-		if err != nil {
-			done <- struct{}{}
-			return
+		return nil, newQueryTimeoutError(maxExecuteTime)
+	}
+	if err != nil {
+		return nil, se.GetNamespace().enrichBackendError(err, sliceName, phyDb, pc.GetAddr())
+	}
+	se.addStmtWarnings(fetchWarnings(pc, rs))
+	return rs, nil
+}
+
+// executeBatchInScatterShard execute sqls on connection of a slice, they are pipelined if there are more than one
+func executeBatchInScatterShard(ctx context.Context, shardTimeout time.Duration, pc backend.PooledConnect, sqls []string, maxRows int) ([]*mysql.Result, []error) {
+	if len(sqls) == 1 {
+		r, err := executeInScatterShard(ctx, shardTimeout, pc, sqls[0], maxRows)
+		return []*mysql.Result{r}, []error{err}
+	}
+	return pc.ExecutePipeline(ctx, sqls, maxRows)
+}
+
+// executeInScatterShard execute sql of one slice in scatter query, the sql is interrupted if shard timeout is exceeded
+func executeInScatterShard(ctx context.Context, shardTimeout time.Duration, pc backend.PooledConnect, sql string, maxRows int) (*mysql.Result, error) {
+	if shardTimeout <= 0 {
+		return executeWithContext(ctx, pc, sql, maxRows)
+	}
+	shardCtx, cancel := context.WithTimeout(ctx, shardTimeout)
+	defer cancel()
+	return executeWithContext(shardCtx, pc, sql, maxRows)
+}
+
+// getPartialResults return results of succeeded sqls in scatter select, failed ones are ignored.
+// ok is false if all sqls fail.
+func getPartialResults(sqls map[string]map[string][]string, rs []interface{}) (r []*mysql.Result, ok bool) {
+	var firstErr error
+	for _, v := range rs {
+		switch vv := v.(type) {
+		case *mysql.Result:
+			r = append(r, vv)
+		case error:
+			if firstErr == nil {
+				firstErr = vv
+			}
 		}
-		startTime := time.Now()
-		rs, err = pc.Execute(sql, se.GetNamespace().GetMaxResultSize())
+	}
+	if len(r) == 0 {
+		return nil, false
+	}
+	if firstErr != nil {
+		log.Warn("exec sqls: %v, return partial results, succeeded: %d, total: %d, first error: %v", sqls, len(r), len(rs), firstErr)
+	}
+	return r, true
+}
 
-		se.manager.RecordBackendSQLMetrics(reqCtx, se, "slice0", sql, pc.GetAddr(), startTime, err)
-		done <- struct{}{}
-	}()
+// executeWithContext execute sql on pc, ctx may carry deadline and result memory budget of the statement
+func executeWithContext(ctx context.Context, pc backend.PooledConnect, sql string, maxRows int) (*mysql.Result, error) {
+	return pc.ExecuteWithContext(ctx, sql, maxRows)
+}
+
+// killTimeoutQuery kill the running query on backend and close the interrupted connection,
+// the connection is in the middle of a response and can't be reused.
+func (se *SessionExecutor) killTimeoutQuery(sliceName string, pc backend.PooledConnect) {
+	connID := pc.GetConnectionID()
+	addr := pc.GetAddr()
+	pc.Close()
+
+	dc, err := se.GetNamespace().GetSlice(sliceName).GetDirectConn(addr)
+	if err != nil {
+		log.Warn("kill thread id: %d failed, get connection err: %v", connID, err.Error())
+		return
+	}
+	defer dc.Close()
+	if _, err = dc.Execute(fmt.Sprintf("KILL QUERY %d", connID), 0); err != nil {
+		log.Warn("kill thread id: %d failed, err: %v", connID, err.Error())
+	}
+}
+
+// statementContext return context with deadline of current statement, so that all backend executions of the
+// statement share the same deadline, including sqls of every slice in scatter query and retries
+func (se *SessionExecutor) statementContext(reqCtx *util.RequestContext) (context.Context, context.CancelFunc, int) {
+	maxExecuteTime, ok := reqCtx.GetMaxExecuteTime()
+	if !ok {
+		// statement is not started by doQuery, such as field list
+		maxExecuteTime = se.getMaxExecuteTime(reqCtx.GetStmtType(), 0)
+		reqCtx.SetMaxExecuteTime(maxExecuteTime)
+	}
+	if maxExecuteTime <= 0 {
+		return context.Background(), func() {}, 0
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), reqCtx.GetDeadline())
+	return ctx, cancel, maxExecuteTime
+}
+
+// trackSlowSQL register statement to slow sql reaper if kill time of user is set,
+// untrackSlowSQL should be called with the returned statement after execution
+func (se *SessionExecutor) trackSlowSQL(ctx context.Context, reqCtx *util.RequestContext) (context.Context, *runningStatement) {
+	ns := se.GetNamespace()
+	if ns.slowSQLReaper == nil {
+		return ctx, nil
+	}
+	killTime := ns.getUserSlowSQLKillTime(se.user)
+	if killTime <= 0 {
+		return ctx, nil
+	}
+	return ns.slowSQLReaper.track(ctx, se.user, reqCtx.GetFingerprintMD5(), reqCtx.GetFingerprint(), killTime)
+}
 
-	select {
-	case <-ctx.Done():
-		log.Warn("exec sql: %s, error: %s", sql, errors.ErrTimeLimitExceeded.Error())
-		return nil, fmt.Errorf("%v %dms", errors.ErrTimeLimitExceeded, maxExecuteTime)
-	case <-done:
-		return rs, err
+// untrackSlowSQL return error if statement is killed by slow sql reaper
+func untrackSlowSQL(s *runningStatement) error {
+	if s == nil || !s.untrack() {
+		return nil
 	}
+	return newSlowSQLKilledError(s.threshold)
+}
+
+// dropClosedConn remove closed connection held by session, so a new one will be got next time.
+// the transaction is aborted if the connection belongs to it, since its changes on the connection are lost.
+func (se *SessionExecutor) dropClosedConn(sliceName string, pc backend.PooledConnect) {
+	dropped := false
+	if se.IsKeepSession() {
+		if ksConn, ok := se.ksConns[sliceName]; ok && ksConn == pc {
+			delete(se.ksConns, sliceName)
+			dropped = true
+		}
+	}
+	if se.isInTransaction() {
+		se.txLock.Lock()
+		if txConn, ok := se.txConns[sliceName]; ok && txConn == pc {
+			delete(se.txConns, sliceName)
+			dropped = true
+		}
+		if dropped {
+			se.abortTx()
+		}
+		se.txLock.Unlock()
+	}
+}
+
+// abortTx roll back the rest of transaction whose backend connection is lost, so it won't be partially committed.
+// the session is still in transaction, statements using backend fail and COMMIT fails until the transaction ends.
+// closed connections are recycled by callers. must be called with txLock held.
+func (se *SessionExecutor) abortTx() {
+	for sliceName, pc := range se.txConns {
+		if !pc.IsClosed() {
+			if err := pc.Rollback(); err != nil {
+				log.Warn("rollback aborted transaction on slice %s error: %v", sliceName, err)
+			}
+			pc.Recycle()
+		}
+	}
+	for sliceName, pc := range se.ksConns {
+		if !pc.IsClosed() {
+			if err := pc.Rollback(); err != nil {
+				log.Warn("rollback aborted transaction on slice %s error: %v", sliceName, err)
+			}
+		}
+	}
+	se.resetCDCEvents()
+	se.txConns = make(map[string]backend.PooledConnect)
+	se.savepoints = []string{}
+	se.releaseTxNamespace()
+	se.txAborted = true
+}
+
+func newTxAbortedError() error {
+	return mysql.NewError(mysql.ErrQueryTimeout, "transaction has been rolled back since its backend connection was lost or a statement in it timed out, ROLLBACK is required")
+}
+
+func newQueryTimeoutError(maxExecuteTime int) error {
+	return mysql.NewError(mysql.ErrQueryTimeout, fmt.Sprintf("%v %dms", errors.ErrTimeLimitExceeded, maxExecuteTime))
 }
 
 func canHandleWithoutPlan(stmtType int) bool {
@@ -811,6 +1355,36 @@ func extractPrefixCommentsAndRewrite(sql string, version *util.VersionCompareSta
 	return trimmed, comments
 }
 
+// isPartialResultAllowed check if scatter select can return results of succeeded slices when some slices fail,
+// hint in sql comments takes precedence over session gaea_partial_result and namespace scatter_partial_result.
+// Writes and transactions always fail fast.
+func (se *SessionExecutor) isPartialResultAllowed(reqCtx *util.RequestContext, sql string) bool {
+	if reqCtx.GetStmtType() != parser.StmtSelect || se.isInTransaction() {
+		return false
+	}
+	_, comments := parser.SplitMarginComments(sql)
+	hints := strings.ToLower(comments.Leading + comments.Trailing)
+	if strings.Contains(hints, partialResultHint) {
+		return true
+	}
+	if strings.Contains(hints, failFastHint) {
+		return false
+	}
+	if se.partialResult != nil {
+		return *se.partialResult
+	}
+	return se.GetNamespace().scatterPartialResult
+}
+
+// shouldMirror check if sql should be duplicated to mirror slice of namespace
+func (se *SessionExecutor) shouldMirror(reqCtx *util.RequestContext) bool {
+	mirror := se.GetNamespace().mirror
+	if mirror == nil {
+		return false
+	}
+	return mirror.shouldMirror(reqCtx.GetStmtType(), reqCtx.GetTables(), se.isInTransaction())
+}
+
 // master-slave routing
 func checkExecuteFromSlave(reqCtx *util.RequestContext, c *SessionExecutor, sql string) bool {
 	stmtType := reqCtx.GetStmtType()
@@ -919,6 +1493,18 @@ func modifyResultStatus(r *mysql.Result, cc *SessionExecutor) {
 	r.Status = r.Status | cc.GetStatus()
 }
 
+// addResultWarnings add warnings of request to result, such as skipped sqls of partial result query
+func addResultWarnings(reqCtx *util.RequestContext, r *mysql.Result) {
+	if r == nil || reqCtx.GetWarnings() == 0 {
+		return
+	}
+	warnings := int(r.Warnings) + reqCtx.GetWarnings()
+	if warnings > math.MaxUint16 {
+		warnings = math.MaxUint16
+	}
+	r.Warnings = uint16(warnings)
+}
+
 func createShowDatabaseResult(dbs []string) *mysql.Result {
 	r := new(mysql.Resultset)
 
@@ -1010,9 +1596,19 @@ func (se *SessionExecutor) handleShow(reqCtx *util.RequestContext, sql string) (
 
 	// handle show databases;
 	if len(tokens) == 2 && strings.ToLower(tokens[1]) == "databases" {
-		dbs := se.GetNamespace().GetAllowedDBs()
+		var dbs []string
+		for _, db := range se.GetNamespace().GetAllowedDBs() {
+			if se.GetNamespace().IsUserAllowedDB(se.user, db) {
+				dbs = append(dbs, db)
+			}
+		}
 		return createShowDatabaseResult(dbs), nil
 	}
+	// database and table in show statement are checked if user has acl
+	aclStmt, err := se.checkShowACL(sql)
+	if err != nil {
+		return nil, err
+	}
 	// readonly && readwrite user send to slave
 	if !se.GetNamespace().IsAllowWrite(se.user) || se.GetNamespace().IsRWSplit(se.user) {
 		reqCtx.SetFromSlave(1)
@@ -1021,28 +1617,98 @@ func (se *SessionExecutor) handleShow(reqCtx *util.RequestContext, sql string) (
 	if strings.Contains(sql, readonlyVariable) && se.GetNamespace().IsAllowWrite(se.user) {
 		reqCtx.SetFromSlave(0)
 	}
+	// warnings of last statement are kept by proxy since it may be executed on multiple slices
+	if r, handled, err := se.handleShowWarnings(reqCtx); handled {
+		if err != nil {
+			return nil, err
+		}
+		modifyResultStatus(r, se)
+		return r, nil
+	}
+	// show variables and status are merged with proxy level values
+	if r, handled, err := se.handleShowVariablesOrStatus(reqCtx, sql); handled {
+		if err != nil {
+			return nil, err
+		}
+		modifyResultStatus(r, se)
+		return r, nil
+	}
+	// show create table of sharding table returns ddl of the first sub table
+	if r, handled, err := se.handleShowCreateTable(reqCtx, sql); handled {
+		if err != nil {
+			return nil, err
+		}
+		modifyResultStatus(r, se)
+		return r, nil
+	}
 	r, err := se.ExecuteSQL(reqCtx, se.GetNamespace().GetDefaultSlice(), se.db, sql)
 	if err != nil {
 		return nil, fmt.Errorf("execute sql error, sql: %s, err: %v", sql, err)
 	}
+	if aclStmt != nil {
+		if err := se.filterShowTablesResult(r, aclStmt); err != nil {
+			return nil, err
+		}
+	}
 
 	modifyResultStatus(r, se)
 	return r, nil
 }
 
-func (se *SessionExecutor) handleBegin() error {
+// isReadOnlyTxToSlave check if transaction should be routed to slaves, readOnly is true if it's
+// started by START TRANSACTION READ ONLY or after SET TRANSACTION READ ONLY, otherwise session transaction_read_only is checked
+func (se *SessionExecutor) isReadOnlyTxToSlave(readOnly bool) bool {
+	ns := se.GetNamespace()
+	if !ns.readOnlyTxToSlave || se.IsKeepSession() || !ns.IsRWSplit(se.user) {
+		return false
+	}
+	return readOnly || se.getIntSessionVariable("transaction_read_only") == 1 || se.getIntSessionVariable("tx_read_only") == 1
+}
+
+// beginTx start transaction on backend connection, read only transaction is also read only on backend
+// so that writes in it are rejected even if it's executed on master
+func (se *SessionExecutor) beginTx(pc backend.PooledConnect) error {
+	if se.txReadOnly {
+		_, err := pc.Execute("start transaction read only", 0)
+		return err
+	}
+	return pc.Begin()
+}
+
+func (se *SessionExecutor) handleBegin(readOnly bool) error {
+	// begin commits current transaction implicitly, which fails if it's aborted
+	if se.txAborted {
+		return se.commit()
+	}
+
+	// access mode set by SET TRANSACTION only takes effect in next transaction
+	readOnly = readOnly || se.nextTxReadOnly
+	se.nextTxReadOnly = false
+
+	// begin commits current transaction implicitly, connections of it are released
+	// if the new transaction is routed to another role
+	se.txLock.Lock()
+	reroute := len(se.txConns) > 0 && se.txFromSlave != se.isReadOnlyTxToSlave(readOnly)
+	se.txLock.Unlock()
+	if reroute {
+		if err := se.commit(); err != nil {
+			return err
+		}
+	}
+
 	se.txLock.Lock()
 	defer se.txLock.Unlock()
 
+	se.txReadOnly = readOnly
 	for _, co := range se.txConns {
-		if err := co.Begin(); err != nil {
+		if err := se.beginTx(co); err != nil {
 			return err
 		}
 	}
 
 	// 客户端执行 begin 时后端 MySQL 实际并未执行
 	for _, co := range se.ksConns {
-		if err := co.Begin(); err != nil {
+		if err := se.beginTx(co); err != nil {
 			return err
 		}
 	}
@@ -1074,6 +1740,10 @@ func (se *SessionExecutor) commit() (err error) {
 	defer se.txLock.Unlock()
 
 	se.status &= ^mysql.ServerStatusInTrans
+	if se.txAborted {
+		err = newTxAbortedError()
+		se.txAborted = false
+	}
 
 	for _, pc := range se.txConns {
 		if e := pc.Commit(); e != nil {
@@ -1088,8 +1758,17 @@ func (se *SessionExecutor) commit() (err error) {
 			err = e
 		}
 	}
+	// events of transaction failed to commit are dropped, it may be partially committed in multiple slices
+	if err == nil && se.txNamespace != nil && se.txNamespace.cdc != nil && len(se.cdcEvents) > 0 {
+		se.txNamespace.cdc.publish(se.cdcEvents)
+	}
+	se.resetCDCEvents()
 	se.txConns = make(map[string]backend.PooledConnect)
+	se.txReadOnly = false
+	se.txFromSlave = false
+	se.releaseTxNamespace()
 	se.savepoints = []string{}
+	se.detachKsConns()
 	return
 }
 
@@ -1097,6 +1776,7 @@ func (se *SessionExecutor) rollback() (err error) {
 	se.txLock.Lock()
 	defer se.txLock.Unlock()
 	se.status &= ^mysql.ServerStatusInTrans
+	se.txAborted = false
 	for _, pc := range se.txConns {
 		err = pc.Rollback()
 		pc.Recycle()
@@ -1105,14 +1785,47 @@ func (se *SessionExecutor) rollback() (err error) {
 	for _, pc := range se.ksConns {
 		err = pc.Rollback()
 	}
+	se.resetCDCEvents()
 	se.txConns = make(map[string]backend.PooledConnect)
+	se.txReadOnly = false
+	se.txFromSlave = false
+	se.releaseTxNamespace()
 	se.savepoints = []string{}
+	se.detachKsConns()
 	return
 }
 
+// discardBackendConns close backend connections held by session and reset transaction state,
+// it's used when connections may be left in the middle of a request or response.
+func (se *SessionExecutor) discardBackendConns() {
+	se.txLock.Lock()
+	defer se.txLock.Unlock()
+	se.status &= ^mysql.ServerStatusInTrans
+	se.txAborted = false
+	for _, pc := range se.txConns {
+		pc.Close()
+		pc.Recycle()
+	}
+	se.resetCDCEvents()
+	se.txConns = make(map[string]backend.PooledConnect)
+	se.txReadOnly = false
+	se.txFromSlave = false
+	se.releaseTxNamespace()
+	se.savepoints = []string{}
+	se.handleKsQuit()
+	if se.session != nil && se.session.continueConn != nil {
+		se.session.continueConn.Close()
+		se.session.continueConn.Recycle()
+		se.session.continueConn = nil
+	}
+}
+
 func (se *SessionExecutor) rollbackSavepoint(savepoint string) (err error) {
 	se.txLock.Lock()
 	defer se.txLock.Unlock()
+	if se.txAborted {
+		return newTxAbortedError()
+	}
 	for _, pc := range se.txConns {
 		_, err = pc.Execute("rollback to "+savepoint, 0)
 	}
@@ -1123,6 +1836,9 @@ func (se *SessionExecutor) rollbackSavepoint(savepoint string) (err error) {
 		if index := util.ArrayFindIndex(se.savepoints, savepoint); index > -1 {
 			se.savepoints = se.savepoints[0:index]
 		}
+		if count, ok := se.cdcSavepoints[savepoint]; ok && count <= len(se.cdcEvents) {
+			se.cdcEvents = se.cdcEvents[:count]
+		}
 	}
 	return
 }
@@ -1149,6 +1865,10 @@ func (se *SessionExecutor) handleSavepoint(stmt *ast.SavepointStmt) (err error)
 				se.savepoints = util.ArrayRemoveItem(se.savepoints, stmt.Savepoint)
 			}
 			se.savepoints = append(se.savepoints, stmt.Savepoint)
+			if se.cdcSavepoints == nil {
+				se.cdcSavepoints = make(map[string]int)
+			}
+			se.cdcSavepoints[stmt.Savepoint] = len(se.cdcEvents)
 		}
 	}
 	return
@@ -1160,7 +1880,38 @@ func (se *SessionExecutor) recycleTx() {
 	}
 	se.txLock.Lock()
 	defer se.txLock.Unlock()
-	se.txConns = make(map[string]backend.PooledConnect)
+	se.abortTx()
+}
+
+// recordCDC record change events of succeeded write, they are published at once out of transaction,
+// or buffered until the transaction is committed
+func (se *SessionExecutor) recordCDC(reqCtx *util.RequestContext, slice, phyDB, sql string) {
+	ns := se.GetNamespace()
+	if ns.cdc == nil {
+		return
+	}
+	switch reqCtx.GetStmtType() {
+	case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete:
+	default:
+		return
+	}
+	events := ns.cdc.buildEvents(reqCtx.GetTables(), slice, phyDB, sql)
+	if len(events) == 0 {
+		return
+	}
+	if !se.isInTransaction() {
+		ns.cdc.publish(events)
+		return
+	}
+	se.txLock.Lock()
+	se.cdcEvents = append(se.cdcEvents, events...)
+	se.txLock.Unlock()
+}
+
+// resetCDCEvents clear change events of transaction, must be called with txLock held
+func (se *SessionExecutor) resetCDCEvents() {
+	se.cdcEvents = nil
+	se.cdcSavepoints = nil
 }
 
 // handleKQuit close backend connection and recycle, only called when client exit
@@ -1172,15 +1923,111 @@ func (se *SessionExecutor) handleKsQuit() {
 	se.ksConns = make(map[string]backend.PooledConnect)
 }
 
+// statefulFuncs are functions leaving state on backend connection, such as named lock and last insert id
+var statefulFuncs = map[string]bool{
+	ast.GetLock:         true,
+	ast.ReleaseLock:     true,
+	ast.ReleaseAllLocks: true,
+	ast.LastInsertId:    true,
+}
+
+// statefulStmtChecker check if statement leaves state on backend connection
+type statefulStmtChecker struct {
+	stateful bool
+}
+
+// Enter for node visit
+func (c *statefulStmtChecker) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch x := n.(type) {
+	case *ast.CreateTableStmt:
+		c.stateful = x.IsTemporary
+	case *ast.LockTablesStmt, *ast.PrepareStmt:
+		c.stateful = true
+	case *ast.VariableAssignment:
+		// SET @a = 1
+		c.stateful = !x.IsSystem && x.Name != ast.SetNames
+	case *ast.VariableExpr:
+		// SELECT @a := 1
+		c.stateful = !x.IsSystem && x.Value != nil
+	case *ast.FuncCallExpr:
+		c.stateful = statefulFuncs[x.FnName.L]
+	}
+	return n, c.stateful
+}
+
+// Leave for node visit
+func (c *statefulStmtChecker) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, !c.stateful
+}
+
+// pinKsConns keep the backend connections attached if sql leaves state on them
+func (se *SessionExecutor) pinKsConns(sql string) {
+	if !se.multiplexing || se.pinned {
+		return
+	}
+	// sql can't be parsed may still be sent to backend by unshard plan, it's unknown what it leaves
+	stmt, err := se.Parse(sql)
+	if err != nil {
+		se.pinned = true
+		return
+	}
+	se.pinKsConnsByStmt(stmt)
+}
+
+// pinKsConnsByStmt keep the backend connections attached if stmt leaves state on them
+func (se *SessionExecutor) pinKsConnsByStmt(stmt ast.StmtNode) {
+	if !se.multiplexing || se.pinned {
+		return
+	}
+	if isStatefulStmt(stmt) {
+		se.pinned = true
+	}
+}
+
+func isStatefulStmt(stmt ast.StmtNode) bool {
+	checker := &statefulStmtChecker{}
+	stmt.Accept(checker)
+	return checker.stateful
+}
+
+// detachKsConns return keep session connections to pool after statement or transaction in multiplexing mode,
+// session variables will be replayed when they are attached again.
+func (se *SessionExecutor) detachKsConns() {
+	if !se.multiplexing || se.pinned || se.isInTransaction() {
+		return
+	}
+	for _, pc := range se.ksConns {
+		// rows or results of streaming query are still being read
+		if pc.MoreRowsExist() || pc.MoreResultsExist() {
+			return
+		}
+	}
+	for sliceName, pc := range se.ksConns {
+		pc.Recycle()
+		delete(se.ksConns, sliceName)
+	}
+}
+
 // ExecuteSQL execute sql
 func (se *SessionExecutor) ExecuteSQL(reqCtx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
-	phyDB, err := se.GetNamespace().GetDefaultPhyDB(db)
+	ns := se.GetNamespace()
+	phyDB, err := ns.GetDefaultPhyDB(db)
 	if err != nil {
 		return nil, err
 	}
 
+	if err = ns.budget.acquireConcurrency(ns.name, 1); err != nil {
+		return nil, err
+	}
+	defer ns.budget.releaseConcurrency(1)
+
+	se.sampleIndexAdvisor(reqCtx, slice, phyDB, sql)
+
 	pc, err := se.getBackendConn(slice, getFromSlave(reqCtx))
-	defer se.recycleBackendConn(pc)
+	// pc may be replaced by retry
+	defer func() {
+		se.recycleBackendConn(pc)
+	}()
 
 	if err != nil {
 		log.Warn("[ns:%s]getBackendConn failed: %v", se.GetNamespace().name, err)
@@ -1190,10 +2037,24 @@ func (se *SessionExecutor) ExecuteSQL(reqCtx *util.RequestContext, slice, db, sq
 	se.backendAddr = pc.GetAddr()
 	se.backendConnectionId = pc.GetConnectionID()
 
-	rs, err := se.executeInSlice(reqCtx, pc, phyDB, sql)
+	rs, err := se.executeInSlice(reqCtx, pc, slice, phyDB, sql)
+	if err != nil && se.canRetryRead(reqCtx, err) {
+		pc, rs, err = se.retryReadInSlice(reqCtx, pc, slice, phyDB, sql, err)
+	}
+	if err != nil && se.canRetryDML(reqCtx, err) {
+		err = se.retryDML(sql, err, func() (e error) {
+			rs, e = se.executeInSlice(reqCtx, pc, slice, phyDB, sql)
+			return e
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
+	// only succeeded sqls are mirrored, so that data of mirror slice follows the source
+	if reqCtx.IsMirror() {
+		ns.mirror.Send(phyDB, sql)
+	}
+	se.recordCDC(reqCtx, slice, phyDB, sql)
 
 	if pc.MoreRowsExist() || pc.MoreResultsExist() {
 		se.session.continueConn = pc
@@ -1201,13 +2062,109 @@ func (se *SessionExecutor) ExecuteSQL(reqCtx *util.RequestContext, slice, db, sq
 	return rs, nil
 }
 
+// canRetryRead check if failed sql can be retried on another slave, only select out of transaction
+// and keep session is idempotent, and only failures of backend connection are worth retrying
+func (se *SessionExecutor) canRetryRead(reqCtx *util.RequestContext, err error) bool {
+	return se.GetNamespace().readRetryAttempts > 1 &&
+		reqCtx.GetStmtType() == parser.StmtSelect &&
+		getFromSlave(reqCtx) &&
+		!se.IsKeepSession() &&
+		!se.isInTransaction() &&
+		backend.IsBackendFailure(err)
+}
+
+// retryReadInSlice retry failed read on other slaves until succeed or attempts are used up,
+// return the last connection used, it should be recycled by caller
+func (se *SessionExecutor) retryReadInSlice(reqCtx *util.RequestContext, pc backend.PooledConnect, sliceName, phyDB, sql string, err error) (backend.PooledConnect, *mysql.Result, error) {
+	ns := se.GetNamespace()
+	triedAddrs := make(map[string]bool)
+	var rs *mysql.Result
+	for attempt := 1; attempt < ns.readRetryAttempts && backend.IsBackendFailure(err); attempt++ {
+		triedAddrs[pc.GetAddr()] = true
+		retryPc, getErr := ns.GetSlice(sliceName).GetOtherSlaveConn(ns.GetUserProperty(se.user), ns.localSlaveReadPriority, triedAddrs)
+		if getErr != nil {
+			log.Warn("[ns:%s]no other slave to retry read, addr: %s, error: %v", ns.name, pc.GetAddr(), getErr)
+			break
+		}
+		log.Warn("[ns:%s]read failed on %s, retry on %s, error: %v", ns.name, pc.GetAddr(), retryPc.GetAddr(), err)
+		se.recycleBackendConn(pc)
+		pc = retryPc
+		se.backendAddr = pc.GetAddr()
+		se.backendConnectionId = pc.GetConnectionID()
+		rs, err = se.executeInSlice(reqCtx, pc, sliceName, phyDB, sql)
+	}
+	return pc, rs, err
+}
+
+const defaultDMLRetryBackoff = 10 // millisecond
+
+// canRetryDML check if failed dml can be retried, only dml out of transaction is retried, because a statement
+// failed by deadlock or lock wait timeout is rolled back as a whole and nothing is left to the client
+func (se *SessionExecutor) canRetryDML(reqCtx *util.RequestContext, err error) bool {
+	switch reqCtx.GetStmtType() {
+	case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete:
+	default:
+		return false
+	}
+	return se.GetNamespace().dmlRetryAttempts > 1 && !se.isInTransaction() && isLockConflictErr(err)
+}
+
+// isLockConflictErr check if error is deadlock or lock wait timeout
+func isLockConflictErr(err error) bool {
+	return mysql.IsSQLErrorCode(err, mysql.ErrLockDeadlock) || mysql.IsSQLErrorCode(err, mysql.ErrLockWaitTimeout)
+}
+
+// retryDML execute dml again with exponential backoff until it doesn't fail by lock conflict or attempts are used up
+func (se *SessionExecutor) retryDML(sql string, err error, execute func() error) error {
+	ns := se.GetNamespace()
+	backoff := ns.dmlRetryBackoff
+	for attempt := 1; attempt < ns.dmlRetryAttempts && isLockConflictErr(err); attempt++ {
+		log.Warn("[ns:%s]dml failed by lock conflict, retry after %v, sql: %s, error: %v", ns.name, backoff, ns.redactLogSQL(sql), ns.redactLogError(err))
+		se.manager.statistics.RecordDMLRetry(ns.name, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		err = execute()
+	}
+	return err
+}
+
+// countSQLs return count of sqls in all slices and dbs
+func countSQLs(sqls map[string]map[string][]string) int {
+	count := 0
+	for _, dbSQLs := range sqls {
+		for _, ss := range dbSQLs {
+			count += len(ss)
+		}
+	}
+	return count
+}
+
 // ExecuteSQLs len(sqls) must not be 0, or return error
 func (se *SessionExecutor) ExecuteSQLs(reqCtx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
 	if len(sqls) == 0 {
 		return nil, fmt.Errorf("no sql to execute")
 	}
 
-	pcs, err := se.getBackendConns(sqls, getFromSlave(reqCtx))
+	ns := se.GetNamespace()
+	if err := ns.budget.acquireConcurrency(ns.name, len(sqls)); err != nil {
+		return nil, err
+	}
+	defer ns.budget.releaseConcurrency(len(sqls))
+
+	if ns.indexAdvisor != nil {
+		// sqls of all slices have the same plan usually, any of them is sampled
+		if slice, db, sql, ok := anySQL(sqls); ok {
+			se.sampleIndexAdvisor(reqCtx, slice, db, sql)
+		}
+	}
+
+	var pcs map[string]backend.PooledConnect
+	var err error
+	if reqCtx.IsPartialResult() {
+		pcs, sqls, err = se.getHealthyBackendConns(reqCtx, sqls)
+	} else {
+		pcs, err = se.getBackendConns(sqls, getFromSlave(reqCtx))
+	}
 	defer se.recycleBackendConns(pcs, false)
 	if err != nil {
 		log.Warn("getShardConns failed: %v", err)
@@ -1215,8 +2172,60 @@ func (se *SessionExecutor) ExecuteSQLs(reqCtx *util.RequestContext, sqls map[str
 	}
 
 	rs, err := se.executeInMultiSlices(reqCtx, pcs, sqls)
+	// dml of multiple sqls may be partially applied, so only single sql is retried
+	if err != nil && countSQLs(sqls) == 1 && se.canRetryDML(reqCtx, err) {
+		err = se.retryDML(fmt.Sprint(sqls), err, func() (e error) {
+			rs, e = se.executeInMultiSlices(reqCtx, pcs, sqls)
+			return e
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
+	if reqCtx.IsMirror() {
+		for _, dbSQLs := range sqls {
+			for db, ss := range dbSQLs {
+				for _, sql := range ss {
+					ns.mirror.Send(db, sql)
+				}
+			}
+		}
+	}
+	if ns.cdc != nil {
+		for slice, dbSQLs := range sqls {
+			for db, ss := range dbSQLs {
+				for _, sql := range ss {
+					se.recordCDC(reqCtx, slice, db, sql)
+				}
+			}
+		}
+	}
 	return rs, nil
 }
+
+// resultMemoryContext return ctx which accounts memory of rows to namespace budget while they are read from backend,
+// so the statement is aborted as soon as the budget is exceeded. The memory is released after response is written.
+func (se *SessionExecutor) resultMemoryContext(ctx context.Context) context.Context {
+	ns := se.GetNamespace()
+	if se.memoryBudget != nil && se.memoryBudget != ns.budget {
+		se.releaseResultMemory()
+	}
+	se.memoryBudget = ns.budget
+	// rows of scatter shards are read concurrently
+	return backend.WithResultMemory(ctx, func(size int64) error {
+		if err := ns.budget.reserveMemory(ns.name, size); err != nil {
+			return err
+		}
+		se.reservedMemory.Add(size)
+		return nil
+	})
+}
+
+// releaseResultMemory release result memory reserved by current command
+func (se *SessionExecutor) releaseResultMemory() {
+	if se.memoryBudget != nil {
+		se.memoryBudget.releaseMemory(se.reservedMemory.Get())
+		se.memoryBudget = nil
+		se.reservedMemory.Set(0)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"runtime"
 	"strings"
 	"time"
@@ -35,14 +36,15 @@ import (
 
 // Parse parse sql
 func (se *SessionExecutor) Parse(sql string) (ast.StmtNode, error) {
-	return parser.New().ParseOneStmt(sql, "", "")
+	return parser.ParseOneStmt(sql)
 }
 
 // 处理query语句
 func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			log.Warn("handle query command failed, error: %v, sql: %s", e, sql)
+			ns := se.GetNamespace()
+			log.Warn("handle query command failed, error: %v, sql: %s", e, ns.redactLogSQL(sql))
 
 			if err, ok := e.(error); ok {
 				const size = 4096
@@ -50,7 +52,7 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 				buf = buf[:runtime.Stack(buf, false)]
 
 				log.Warn("handle query command catch panic error, sql: %s, error: %s, stack: %s",
-					sql, err.Error(), string(buf))
+					ns.redactLogSQL(sql), ns.redactLogError(err), string(buf))
 			}
 
 			err = fmt.Errorf("%s:%s", errors.ErrInternalServer, e)
@@ -77,6 +79,8 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 	} else if se.GetNamespace().clientQPSLimit > 0 && !se.GetNamespace().supportLimitTx && !se.isInTransaction() && !se.GetNamespace().limiter.Allow() {
 		// if non-transaction connection is limited, gaea will not close client connection
 		err = fmt.Errorf(mysql.ErrClientQpsLimitedMsg)
+	} else if limitErr := se.holdQuerySlot(sql); limitErr != nil {
+		err = limitErr
 	} else {
 		if ns.supportMultiQuery && se.session.c.capability&mysql.ClientMultiStatements != 0 {
 			r, err = se.doMultiStmts(reqCtx, sql)
@@ -85,6 +89,13 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 		}
 	}
 
+	if r != nil {
+		rowsSent := 0
+		if r.Resultset != nil {
+			rowsSent = len(r.RowDatas)
+		}
+		reqCtx.SetResultRows(rowsSent, r.AffectedRows)
+	}
 	se.manager.RecordSessionSQLMetrics(reqCtx, se, sql, startTime, err)
 	return r, err
 }
@@ -92,13 +103,20 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 func (se *SessionExecutor) checkSQLAllowed(reqCtx *util.RequestContext, sql string) error {
 	stmtType := parser.Preview(sql)
 	reqCtx.SetStmtType(stmtType)
+	ns := se.GetNamespace()
+	if err := ns.mode.check(stmtType); err != nil {
+		return err
+	}
 	if isSQLNotAllowedByUser(se, stmtType) {
 		return fmt.Errorf("write DML is now allowed by read user")
 	}
-	ns := se.GetNamespace()
+	if ns.slowSQLReaper != nil || ns.indexAdvisor != nil {
+		// whitelist of slow sql reaper and hints of index advisor are matched by fingerprint of client sql
+		getSQLFingerprintMd5(reqCtx, sql)
+	}
 	if !ns.IsSQLAllowed(reqCtx, sql) {
 		fingerprint := getSQLFingerprint(reqCtx, sql)
-		log.Warn("catch black sql, sql: %s", sql)
+		log.Warn("catch black sql, sql: %s", ns.redactLogSQL(sql))
 		se.manager.GetStatisticManager().RecordSQLForbidden(fingerprint, se.GetNamespace().GetName())
 		err := mysql.NewError(mysql.ErrUnknown, "sql in blacklist")
 		return err
@@ -106,6 +124,147 @@ func (se *SessionExecutor) checkSQLAllowed(reqCtx *util.RequestContext, sql stri
 	return nil
 }
 
+// tableNameCollector collect all table names in sql
+type tableNameCollector struct {
+	tableNames []*ast.TableName
+}
+
+// Enter for node visit
+func (c *tableNameCollector) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if t, ok := n.(*ast.TableName); ok {
+		c.tableNames = append(c.tableNames, t)
+	}
+	return n, false
+}
+
+// Leave for node visit
+func (c *tableNameCollector) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+// checkUserACL check databases and tables in sql against user's allowed dbs and tables
+func (se *SessionExecutor) checkUserACL(sql string) error {
+	ns := se.GetNamespace()
+	if !ns.hasUserACL(se.user) {
+		return nil
+	}
+
+	// sql can't be parsed is denied, or it may bypass the acl by unshard plan
+	stmt, err := se.Parse(sql)
+	if err != nil {
+		return fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
+	}
+
+	collector := &tableNameCollector{}
+	stmt.Accept(collector)
+
+	for _, t := range collector.tableNames {
+		if err := se.checkUserTableACL(t.Schema.O, t.Name.O, getACLCommandName(stmt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkShowACL check database and table in show statement against user's allowed dbs and tables,
+// the parsed statement is returned to filter result if user has acl, otherwise it's nil
+func (se *SessionExecutor) checkShowACL(sql string) (*ast.ShowStmt, error) {
+	if !se.GetNamespace().hasUserACL(se.user) {
+		return nil, nil
+	}
+
+	n, err := se.Parse(sql)
+	if err != nil {
+		return nil, fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
+	}
+	stmt, ok := n.(*ast.ShowStmt)
+	if !ok {
+		return nil, fmt.Errorf("invalid show statement, sql: %s", sql)
+	}
+	if stmt.DBName != "" {
+		if err := se.checkUserDBACL(stmt.DBName); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.Table != nil {
+		db := stmt.Table.Schema.O
+		if db == "" {
+			db = stmt.DBName
+		}
+		if err := se.checkUserTableACL(db, stmt.Table.Name.O, "SELECT"); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// filterShowTablesResult remove tables not allowed to user from result of show tables and show table status
+func (se *SessionExecutor) filterShowTablesResult(r *mysql.Result, stmt *ast.ShowStmt) error {
+	if stmt.Tp != ast.ShowTables && stmt.Tp != ast.ShowTableStatus {
+		return nil
+	}
+	if r == nil || r.Resultset == nil || len(r.Fields) == 0 || len(r.Values) != len(r.RowDatas) {
+		return nil
+	}
+	db := stmt.DBName
+	if db == "" {
+		db = se.db
+	}
+	ns := se.GetNamespace()
+	values := r.Values[:0]
+	for _, row := range r.Values {
+		if ns.IsUserAllowedTable(se.user, db, fmt.Sprintf("%s", row[0])) {
+			values = append(values, row)
+		}
+	}
+	if len(values) == len(r.Values) {
+		return nil
+	}
+	r.Values = values
+	r.AffectedRows = uint64(len(values))
+	return plan.GenerateSelectResultRowData(r)
+}
+
+// checkUserDBACL check database against user's allowed dbs
+func (se *SessionExecutor) checkUserDBACL(db string) error {
+	if !se.GetNamespace().IsUserAllowedDB(se.user, db) {
+		host, _, _ := net.SplitHostPort(se.clientAddr)
+		return mysql.NewDefaultError(mysql.ErrDBaccessDenied, se.user, host, db)
+	}
+	return nil
+}
+
+// checkUserTableACL check table against user's allowed dbs and tables, current database is used if db is empty
+func (se *SessionExecutor) checkUserTableACL(db, table, command string) error {
+	if db == "" {
+		db = se.db
+	}
+	if err := se.checkUserDBACL(db); err != nil {
+		return err
+	}
+	if !se.GetNamespace().IsUserAllowedTable(se.user, db, table) {
+		host, _, _ := net.SplitHostPort(se.clientAddr)
+		return mysql.NewDefaultError(mysql.ErrTableaccessDenied, command, se.user, host, table)
+	}
+	return nil
+}
+
+func getACLCommandName(stmt ast.StmtNode) string {
+	switch s := stmt.(type) {
+	case *ast.InsertStmt:
+		if s.IsReplace {
+			return "REPLACE"
+		}
+		return "INSERT"
+	case *ast.UpdateStmt:
+		return "UPDATE"
+	case *ast.DeleteStmt:
+		return "DELETE"
+	default:
+		return "SELECT"
+	}
+}
+
 // handle multi-stmts,like `select 1;set autcommit=0;insert into...;`
 func (se *SessionExecutor) doMultiStmts(reqCtx *util.RequestContext, sql string) (r *mysql.Result, errRet error) {
 	if se.session.c.hasRecycledReadPacket.CompareAndSwap(false, true) {
@@ -114,7 +273,7 @@ func (se *SessionExecutor) doMultiStmts(reqCtx *util.RequestContext, sql string)
 
 	piecesSql, err := parser.SplitStatementToPieces(sql)
 	if err != nil {
-		log.Warn("parse sql error. sql: [%s], err: %v", sql, err)
+		log.Warn("parse sql error. sql: [%s], err: %v", se.GetNamespace().redactLogSQL(sql), err)
 		return nil, err
 	}
 
@@ -145,15 +304,39 @@ func (se *SessionExecutor) doMultiStmts(reqCtx *util.RequestContext, sql string)
 	return r, errRet
 }
 
-func (se *SessionExecutor) doQuery(reqCtx *util.RequestContext, sql string) (*mysql.Result, error) {
+func (se *SessionExecutor) doQuery(reqCtx *util.RequestContext, sql string) (r *mysql.Result, err error) {
+	// found_rows(), row_count() and SHOW WARNINGS are answered by proxy, result of every statement is recorded
+	defer func() {
+		se.recordRowCount(r, err)
+		se.recordWarnings(reqCtx, err)
+	}()
 	if err := se.checkSQLAllowed(reqCtx, sql); err != nil {
 		return nil, err
 	}
+	sql = se.rewriteSQL(reqCtx, sql)
+	sql = se.injectIndexHint(reqCtx, sql)
+	// deadline of statement is counted from here, it's shared by all backend executions of the statement
+	reqCtx.SetMaxExecuteTime(se.getMaxExecuteTime(reqCtx.GetStmtType(), getMaxExecutionTimeHint(reqCtx.GetStmtType(), sql)))
 
 	if canHandleWithoutPlan(reqCtx.GetStmtType()) {
 		return se.handleQueryWithoutPlan(reqCtx, sql)
 	}
 
+	if err := se.checkUserACL(sql); err != nil {
+		return nil, err
+	}
+
+	if err := se.checkMaskedColumns(reqCtx, sql); err != nil {
+		return nil, err
+	}
+
+	sql, err = se.encryptSQL(reqCtx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	se.pinKsConns(sql)
+
 	db := se.db
 	if se.session == nil {
 		return nil, fmt.Errorf("session is nil")
@@ -172,17 +355,73 @@ func (se *SessionExecutor) doQuery(reqCtx *util.RequestContext, sql string) (*my
 		reqCtx.SetFromSlave(0)
 	}
 
+	reqCtx.SetPartialResult(se.isPartialResultAllowed(reqCtx, sql))
+	reqCtx.SetMirror(se.shouldMirror(reqCtx))
 	reqCtx.SetDefaultSlice(se.GetNamespace().GetDefaultSlice())
-	r, err := p.ExecuteIn(reqCtx, se)
+	undo, err := se.checkGlobalUnique(reqCtx, p)
 	if err != nil {
 		return nil, err
 	}
+	r, err = p.ExecuteIn(reqCtx, se)
+	if err != nil {
+		if undo != nil {
+			undo()
+		}
+		return nil, err
+	}
 
+	se.limitSelectResult(reqCtx, p, r)
+	se.rewriteSelectResult(reqCtx, r)
 	modifyResultStatus(r, se)
+	addResultWarnings(reqCtx, r)
 
 	return r, nil
 }
 
+// limitSelectResult truncate select result to session sql_select_limit.
+// backend mysql limits the rows of each slice, but merged result of multi slices may exceed it.
+// Like mysql, sql_select_limit doesn't apply to select with its own LIMIT clause.
+func (se *SessionExecutor) limitSelectResult(reqCtx *util.RequestContext, p plan.Plan, r *mysql.Result) {
+	if r == nil || r.Resultset == nil || reqCtx.GetStmtType() != parser.StmtSelect {
+		return
+	}
+	if sp, ok := p.(*plan.SelectPlan); !ok || sp.HasLimit() {
+		return
+	}
+	// streamed result is limited by backend
+	if se.session != nil && se.session.continueConn != nil {
+		return
+	}
+	limit := se.getSelectLimit()
+	if limit == 0 {
+		return
+	}
+	if len(r.RowDatas) > limit {
+		r.RowDatas = r.RowDatas[:limit]
+	}
+	if len(r.Values) > limit {
+		r.Values = r.Values[:limit]
+	}
+}
+
+// rewriteSelectResult decrypt and mask columns of select result
+func (se *SessionExecutor) rewriteSelectResult(reqCtx *util.RequestContext, r *mysql.Result) {
+	if reqCtx.GetStmtType() != parser.StmtSelect {
+		return
+	}
+	se.rewriteResultRows(r)
+}
+
+// rewriteResultRows decrypt encrypt columns and then mask columns, it's also used for rows streamed from backend
+func (se *SessionExecutor) rewriteResultRows(r *mysql.Result) {
+	if r == nil || r.Resultset == nil {
+		return
+	}
+	se.decryptRows(r)
+	se.maskRows(r)
+	se.rewriteMaxAllowedPacket(r)
+}
+
 func checkMyCatHintPlan(reqCtx *util.RequestContext, se *SessionExecutor, db string, comments parser.MarginComments) (plan.Plan, error) {
 	if !strings.HasPrefix(strings.TrimSpace(comments.Trailing), mycatHint) {
 		return nil, nil
@@ -218,19 +457,19 @@ func (se *SessionExecutor) handleQueryWithoutPlan(reqCtx *util.RequestContext, s
 	if err != nil {
 		return nil, fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
 	}
+	se.pinKsConnsByStmt(n)
 
 	switch stmt := n.(type) {
 	case *ast.SetStmt:
 		return se.handleSet(reqCtx, sql, stmt)
 	case *ast.BeginStmt:
-		return nil, se.handleBegin()
+		return nil, se.handleBegin(stmt.ReadOnly)
 	case *ast.CommitStmt:
 		return nil, se.handleCommit()
 	case *ast.LockTablesStmt:
 		// TODO: handle lock tables
 		// TODO: unify sql exec time
-		se.manager.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
-			SQLExecStatusIgnore, 0, se.namespace, se.user, se.clientAddr, "", se.db, se.session.c.GetConnectionID(), 0, se.isInTransaction(), sql, "ignore lock tables")
+		se.logIgnoredSQL(sql, "ignore lock tables")
 		return nil, nil
 	case *ast.RollbackStmt:
 		return nil, se.handleRollback(stmt)
@@ -248,25 +487,43 @@ func (se *SessionExecutor) handleUseDB(dbName string) error {
 		return fmt.Errorf("must have database, the length of dbName is zero")
 	}
 
-	if se.GetNamespace().IsAllowedDB(dbName) {
-		se.db = dbName
-		return nil
+	if !se.GetNamespace().IsAllowedDB(dbName) {
+		return mysql.NewDefaultError(mysql.ErrNoDB)
 	}
 
-	return mysql.NewDefaultError(mysql.ErrNoDB)
+	if err := se.checkUserDBACL(dbName); err != nil {
+		return err
+	}
+
+	se.db = dbName
+	return nil
 }
 
 func (se *SessionExecutor) getPlan(reqCtx *util.RequestContext, ns *Namespace, db string, sql string, checkHint bool) (plan.Plan, error) {
-	p, isUnshardPlan := se.preBuildUnshardPlan(reqCtx, db, sql)
-	if isUnshardPlan {
-		return p, nil
+	// tables are extracted from ast, so sql is always parsed if they are needed
+	if !ns.needStmtTables() {
+		p, isUnshardPlan := se.preBuildUnshardPlan(reqCtx, db, sql)
+		if isUnshardPlan {
+			return p, nil
+		}
+	} else {
+		// to be used to check master hint
+		reqCtx.SetTokens(parser.Tokenize(sql))
+		reqCtx.SetTables(nil)
+	}
+	// statements differing only in literals share template of unshard plan
+	key, cacheable := planCacheKey(ns, db, sql)
+	if cacheable {
+		if t, ok := se.getPlanTemplate(ns, key); ok {
+			reqCtx.SetTables(t.tables)
+			return plan.CreateUnshardPlanWithSQL(sql, ns.GetPhysicalDBs(), db), nil
+		}
 	}
 	n, err := se.Parse(sql)
 	if err != nil {
 		// 如果是注释的情况，则忽略
 		if reqCtx.GetStmtType() == parser.StmtComment {
-			se.manager.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
-				SQLExecStatusIgnore, 0, se.namespace, se.user, se.clientAddr, "", se.db, se.session.c.GetConnectionID(), 0, se.isInTransaction(), sql, "ignore syntax error")
+			se.logIgnoredSQL(sql, "ignore syntax error")
 			return plan.CreateIgnorePlan(), nil
 		}
 		return nil, fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
@@ -275,7 +532,7 @@ func (se *SessionExecutor) getPlan(reqCtx *util.RequestContext, ns *Namespace, d
 	var hintPlan plan.Plan
 	if checkHint {
 		//TODO: 获取 token 没有处理 `/* !mycat:sql=` hint，所以需要在这里处理下
-		_, comments := extractPrefixCommentsAndRewrite(sql, se.session.proxy.ServerVersionCompareStatus)
+		_, comments := extractPrefixCommentsAndRewrite(sql, se.getVersionCompareStatus())
 		hintPlan, err = checkMyCatHintPlan(reqCtx, se, db, comments)
 		// get MyCat hint plan error,will only log
 		if err != nil {
@@ -283,10 +540,17 @@ func (se *SessionExecutor) getPlan(reqCtx *util.RequestContext, ns *Namespace, d
 		}
 	}
 
-	p, err = plan.BuildPlan(n, ns.GetPhysicalDBs(), db, sql, ns.GetRouter(), ns.GetSequences(), hintPlan)
+	if ns.needStmtTables() {
+		reqCtx.SetTables(plan.GetStmtTables(n, db))
+	}
+
+	p, err := plan.BuildPlan(n, ns.GetPhysicalDBs(), db, sql, ns.GetRouter(), ns.GetSequences(), hintPlan)
 	if err != nil {
 		return nil, fmt.Errorf("build plan error: %v", err)
 	}
+	if cacheable && hintPlan == nil {
+		se.setPlanTemplate(ns, key, p, reqCtx.GetTables())
+	}
 
 	return p, nil
 }
@@ -309,13 +573,14 @@ func (se *SessionExecutor) preBuildUnshardPlan(reqCtx *util.RequestContext, db s
 		return nil, false
 	}
 
-	// select last_insert_id() not in UnshardPlan 使用长度判断，进一步降低命中的概率
-	if len(tokens) > 1 && len(tokens[1]) > 13 && len(tokens[1]) < 17 {
-		// select last_insert_id(); select last_insert_id (); select last_insert_id ( );select last_insert_id( );
-		// select last_insert_id() as last_id; select last_insert_id ()  as last_id; select last_insert_id ( )  as last_id; select last_insert_id( )  as last_id;
-		if compressSQL := strings.Join(tokens, ""); util.HasUpperPrefix(compressSQL, lastInsetIdMark) {
-			return nil, false
-		}
+	// select last_insert_id(), found_rows() and row_count() not in UnshardPlan, they're answered by proxy
+	if isSessionFuncQuery(tokens) {
+		return nil, false
+	}
+
+	// select with SQL_CALC_FOUND_ROWS needs a count sql generated from ast
+	if hasCalcFoundRows(tokens) {
+		return nil, false
 	}
 
 	// preCheck unshard sql
@@ -326,7 +591,7 @@ func (se *SessionExecutor) preBuildUnshardPlan(reqCtx *util.RequestContext, db s
 			return p, true
 		}
 		// if err occur, will further check sql
-		log.Notice("pre create unshard plan with no sharding rules,will further check sql, ns:%s, sql: %s, err: %v", se.GetNamespace().GetName(), sql, err)
+		log.Notice("pre create unshard plan with no sharding rules,will further check sql, ns:%s, sql: %s, err: %v", se.GetNamespace().GetName(), se.GetNamespace().redactLogSQL(sql), err)
 	}
 
 	// 2. check sql, if all tables in sql are unshard, return unshard plan
@@ -339,7 +604,13 @@ func (se *SessionExecutor) preBuildUnshardPlan(reqCtx *util.RequestContext, db s
 
 	// TODO: deal with more sql type and optimize
 	switch tokenId {
-	case mysql.TkIdSelect, mysql.TkIdDelete:
+	case mysql.TkIdSelect:
+		// information_schema of sharding tables is merged by plan
+		if plan.IsInformationSchemaSQL(tokens, db) {
+			return nil, false
+		}
+		ruleDB, isUnshardPlan = plan.CheckUnshardBase(tokenId, tokens, rt, db)
+	case mysql.TkIdDelete:
 		ruleDB, isUnshardPlan = plan.CheckUnshardBase(tokenId, tokens, rt, db)
 	case mysql.TkIdReplace, mysql.TkIdInsert:
 		ruleDB, isUnshardPlan = plan.CheckUnshardInsert(tokens, rt, db)
@@ -360,6 +631,34 @@ func (se *SessionExecutor) preBuildUnshardPlan(reqCtx *util.RequestContext, db s
 	return nil, false
 }
 
+// isSessionFuncQuery check if tokens may be of select of session last insert id, found rows or row count, like
+// select last_insert_id(); select last_insert_id ( ) as id; select last_insert_id(1); select @@identity; select found_rows()
+func isSessionFuncQuery(tokens []string) bool {
+	if len(tokens) < 2 || !strings.EqualFold(tokens[0], "select") {
+		return false
+	}
+	second := strings.ToLower(tokens[1])
+	for _, t := range sessionFuncTokens {
+		if strings.HasPrefix(second, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCalcFoundRows check if tokens of select contains SQL_CALC_FOUND_ROWS
+func hasCalcFoundRows(tokens []string) bool {
+	if !strings.EqualFold(tokens[0], "select") {
+		return false
+	}
+	for _, t := range tokens[1:] {
+		if strings.EqualFold(t, "sql_calc_found_rows") {
+			return true
+		}
+	}
+	return false
+}
+
 func (se *SessionExecutor) handleSet(reqCtx *util.RequestContext, sql string, stmt *ast.SetStmt) (*mysql.Result, error) {
 	for _, v := range stmt.Variables {
 		if err := se.handleSetVariable(sql, v); err != nil {
@@ -440,8 +739,7 @@ func (se *SessionExecutor) handleSetVariable(sql string, v *ast.VariableAssignme
 		se.collation = collationID
 		return nil
 	case "sql_mode":
-		sqlMode := getSqlModeExprResult(v.Value)
-		return se.setStringSessionVariable(mysql.SQLModeStr, sqlMode)
+		return se.setNamespaceDefaultVariable(mysql.SQLModeStr, getSqlModeExprResult(v.Value), se.GetNamespace().sqlMode)
 	case "sql_safe_updates":
 		value := getVariableExprResult(v.Value)
 		onOffValue, err := getOnOffVariable(value)
@@ -451,7 +749,7 @@ func (se *SessionExecutor) handleSetVariable(sql string, v *ast.VariableAssignme
 		return se.setIntSessionVariable(mysql.SQLSafeUpdates, onOffValue)
 	case "time_zone":
 		value := getVariableExprResult(v.Value)
-		return se.setStringSessionVariable(mysql.TimeZone, value)
+		return se.setNamespaceDefaultVariable(mysql.TimeZone, value, se.GetNamespace().timeZone)
 	case "max_allowed_packet":
 		return mysql.NewDefaultError(mysql.ErrVariableIsReadonly, "SESSION", mysql.MaxAllowedPacket, "GLOBAL")
 
@@ -472,11 +770,30 @@ func (se *SessionExecutor) handleSetVariable(sql string, v *ast.VariableAssignme
 		}
 
 		// mysql 8.0.3 not support tx_read_only
-		if name == "tx_read_only" && !se.session.proxy.ServerVersionCompareStatus.LessThanMySQLVersion803 {
+		if name == "tx_read_only" && !se.getVersionCompareStatus().LessThanMySQLVersion803 {
 			return se.setIntSessionVariable("transaction_read_only", onOffValue)
 		}
 
 		return se.setIntSessionVariable(name, onOffValue)
+	case "tx_read_only_one_shot":
+		// set transaction read only; set transaction read write
+		if se.status&mysql.ServerStatusInTrans > 0 {
+			return mysql.NewDefaultError(mysql.ErrCantChangeTxCharacteristics)
+		}
+		value := getVariableExprResult(v.Value)
+		onOffValue, err := getOnOffVariable(value)
+		if err != nil {
+			return mysql.NewDefaultError(mysql.ErrWrongValueForVar, "tx_read_only", value)
+		}
+		se.nextTxReadOnly = onOffValue == "1"
+		return nil
+	case gaeaPartialResultVariable:
+		value := getVariableExprResult(v.Value)
+		onOffValue, err := getOnOffVariable(value)
+		if err != nil {
+			return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, value)
+		}
+		return se.setPartialResultVariable(onOffValue)
 	case gaeaGeneralLogVariable:
 		value := getVariableExprResult(v.Value)
 		onOffValue, err := getOnOffVariable(value)
@@ -487,22 +804,23 @@ func (se *SessionExecutor) handleSetVariable(sql string, v *ast.VariableAssignme
 	default:
 		// 从命名空间获取允许用户配置的会话变量
 		allowedVariables := se.GetNamespace().GetAllowedSessionVariables()
+		variableType, ok := allowedVariables[name]
+		if !ok && se.GetNamespace().trackSessionVariables {
+			// 开启 track_session_variables 时跟踪常用的会话变量, 切换后端连接时重放
+			variableType, ok = mysql.GetTrackedVariableType(name)
+		}
 		// 如果变量名在命名空间中，则进行类型检查
-		if variableType, ok := allowedVariables[name]; ok {
+		if ok {
 			switch variableType {
-			case "int":
+			case mysql.VariableTypeInt:
 				value := getVariableExprResult(v.Value)
 				return se.setIntSessionVariable(name, value)
-			case "string":
+			case mysql.VariableTypeString:
 				value := getVariableExprResult(v.Value)
 				return se.setStringSessionVariable(name, value)
-			case "bool":
+			case mysql.VariableTypeBool:
 				value := getVariableExprResult(v.Value)
-				onOffValue, err := getOnOffVariable(value)
-				if err != nil {
-					return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, value)
-				}
-				return se.setIntSessionVariable(name, onOffValue)
+				return se.setOnOffSessionVariable(name, value)
 			default:
 				value := getVariableExprResult(v.Value)
 				log.Warn("Unsupported session variable type for variable name: %s\n variable value %s\n", name, value)
@@ -511,9 +829,7 @@ func (se *SessionExecutor) handleSetVariable(sql string, v *ast.VariableAssignme
 
 		// unsupported variables will be ignored and logged to avoid user confusion
 		// TODO: refactor sql exec time log
-		se.manager.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
-			SQLExecStatusIgnore, 0, se.namespace, se.user, se.clientAddr, "", se.db, se.session.c.GetConnectionID(), 0, se.isInTransaction(),
-			sql, fmt.Sprintf("variable(%s) not supported", name))
+		se.logIgnoredSQL(sql, fmt.Sprintf("variable(%s) not supported", name))
 		return nil
 	}
 }
@@ -527,6 +843,11 @@ func (se *SessionExecutor) handleSetAutoCommit(autocommit bool) (err error) {
 		if se.status&mysql.ServerStatusInTrans > 0 {
 			se.status &= ^mysql.ServerStatusInTrans
 		}
+		// the transaction is committed implicitly, which fails if it's aborted
+		if se.txAborted {
+			err = newTxAbortedError()
+			se.txAborted = false
+		}
 		for _, pc := range se.txConns {
 			if e := pc.SetAutoCommit(1); e != nil {
 				err = fmt.Errorf("set autocommit error, %v", e)
@@ -534,6 +855,7 @@ func (se *SessionExecutor) handleSetAutoCommit(autocommit bool) (err error) {
 			pc.Recycle()
 		}
 		se.txConns = make(map[string]backend.PooledConnect)
+		se.releaseTxNamespace()
 		return
 	}
 
@@ -542,7 +864,7 @@ func (se *SessionExecutor) handleSetAutoCommit(autocommit bool) (err error) {
 }
 
 func (se *SessionExecutor) handleStmtPrepare(sql string) (*Stmt, error) {
-	log.Debug("namespace: %s use prepare, sql: %s", se.GetNamespace().GetName(), sql)
+	log.Debug("namespace: %s use prepare, sql: %s", se.GetNamespace().GetName(), se.GetNamespace().redactLogSQL(sql))
 
 	stmt := new(Stmt)
 
@@ -551,7 +873,7 @@ func (se *SessionExecutor) handleStmtPrepare(sql string) (*Stmt, error) {
 
 	paramCount, offsets, sqlItems, err := CalcParams(stmt.sql)
 	if err != nil {
-		log.Warn("prepare calc params failed, namespace: %s, sql: %s", se.GetNamespace().GetName(), sql)
+		log.Warn("prepare calc params failed, namespace: %s, sql: %s", se.GetNamespace().GetName(), se.GetNamespace().redactLogSQL(sql))
 		return nil, err
 	}
 
@@ -585,6 +907,10 @@ func (se *SessionExecutor) handleFieldList(data []byte) ([]*mysql.Field, error)
 	table := string(data[0:index])
 	wildcard := string(data[index+1:])
 
+	if err := se.checkUserTableACL("", table, "SELECT"); err != nil {
+		return nil, err
+	}
+
 	sliceName := se.GetNamespace().GetRouter().GetRule(se.GetDatabase(), table).GetSlice(0)
 
 	pc, err := se.getBackendConn(sliceName, se.GetNamespace().IsRWSplit(se.user))
@@ -598,7 +924,7 @@ func (se *SessionExecutor) handleFieldList(data []byte) ([]*mysql.Field, error)
 		return nil, err
 	}
 
-	if err = initBackendConn(pc, phyDB, se.GetCharset(), se.GetCollationID(), se.GetVariables()); err != nil {
+	if err = initBackendConn(pc, phyDB, se.GetCharset(), se.GetCollationID(), se.GetVariables(), se.GetNamespace().sqlMode != ""); err != nil {
 		return nil, err
 	}
 
@@ -639,3 +965,16 @@ func getMyCatHintSQL(hints string) string {
 	}
 	return strings.TrimSpace(strings.TrimRight(tmp[1], "*/"))
 }
+
+// logIgnoredSQL write sql which is ignored by gaea to sql log
+// TODO: unify sql exec time
+func (se *SessionExecutor) logIgnoredSQL(sql, reason string) {
+	entry := newSQLLogEntry(se, SQLExecStatusIgnore, 0, sql, fmt.Errorf("%s", reason))
+	entry.backend = ""
+	entry.mysqlConnID = 0
+	if se.manager.statistics.writeSQLLogFields(true, entry) {
+		return
+	}
+	se.manager.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
+		SQLExecStatusIgnore, 0, se.namespace, se.user, se.clientAddr, "", se.db, se.session.c.GetConnectionID(), 0, se.isInTransaction(), sql, reason)
+}
@@ -319,6 +319,9 @@ func (se *SessionExecutor) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramVa
 
 			n = int(paramValues[pos])
 			pos++
+			if len(paramValues) < (pos + n) {
+				return mysql.ErrMalformPacket
+			}
 			tVal, err := mysql.FormatBinaryDate(n, paramValues[pos:pos+n])
 			pos += n
 			if err != nil {
@@ -334,6 +337,9 @@ func (se *SessionExecutor) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramVa
 
 			n = int(paramValues[pos])
 			pos++
+			if len(paramValues) < (pos + n) {
+				return mysql.ErrMalformPacket
+			}
 			tVal, err := mysql.FormatBinaryTime(n, paramValues[pos:pos+n])
 			pos += n
 			if err != nil {
@@ -349,6 +355,9 @@ func (se *SessionExecutor) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramVa
 
 			n := int(paramValues[pos])
 			pos++
+			if len(paramValues) < (pos + n) {
+				return mysql.ErrMalformPacket
+			}
 			tVal, err := mysql.FormatBinaryDateTime(n, paramValues[pos:pos+n])
 			pos += n
 			if err != nil {
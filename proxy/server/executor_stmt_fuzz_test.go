@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// FuzzBindStmtArgs check that binding malformed COM_STMT_EXECUTE parameters returns error instead of panic
+func FuzzBindStmtArgs(f *testing.F) {
+	f.Add(uint8(1), []byte{0}, []byte{mysql.TypeLonglong, 0}, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	f.Add(uint8(2), []byte{0}, []byte{mysql.TypeVarString, 0, mysql.TypeDate, 0}, []byte{3, 'a', 'b', 'c', 4, 0xe4, 0x07, 1, 2})
+	f.Add(uint8(1), []byte{0}, []byte{mysql.TypeDatetime, 0}, []byte{11, 0xe4, 0x07, 1, 2, 3, 4, 5, 0, 0, 0, 0})
+	f.Add(uint8(1), []byte{0}, []byte{mysql.TypeDuration, 0}, []byte{12, 1, 0, 0, 0, 0, 1, 2, 3, 0, 0, 0, 0})
+	f.Add(uint8(3), []byte{2}, []byte{mysql.TypeTiny, 0x80, mysql.TypeNull, 0, mysql.TypeDouble, 0}, []byte{1})
+
+	se := &SessionExecutor{}
+	f.Fuzz(func(t *testing.T, paramCount uint8, nullBitmap, paramTypes, paramValues []byte) {
+		// clip capacity, so reading beyond the packet panics instead of reading garbage
+		paramTypes = paramTypes[:len(paramTypes):len(paramTypes)]
+		paramValues = paramValues[:len(paramValues):len(paramValues)]
+		n := int(paramCount)%16 + 1
+		// null bitmap length is checked by handleStmtExecute
+		for len(nullBitmap) < (n+7)>>3 {
+			nullBitmap = append(nullBitmap, 0)
+		}
+		sql := "select " + strings.TrimSuffix(strings.Repeat("?,", n), ",")
+		count, offsets, sqlItems, err := CalcParams(sql)
+		if err != nil || count != n {
+			t.Fatalf("calc params of %s error: %v", sql, err)
+		}
+		s := &Stmt{sql: sql, paramCount: count, offsets: offsets, sqlItems: sqlItems}
+		s.ResetParams()
+		if err := se.bindStmtArgs(s, nullBitmap, paramTypes, paramValues); err != nil {
+			return
+		}
+		_, _ = s.GetRewriteSQL()
+	})
+}
@@ -17,10 +17,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/log"
@@ -32,6 +35,7 @@ import (
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/ini.v1"
 )
 
@@ -159,7 +163,8 @@ func TestExecute(t *testing.T) {
 	slice0MasterConn.EXPECT().SetCharset("utf8", mysql.CharsetIds["utf8"]).Return(false, nil)
 	slice0MasterConn.EXPECT().SetSessionVariables(mysql.NewSessionVariables()).Return(false, nil)
 	slice0MasterConn.EXPECT().GetAddr().Return("127.0.0.1:3306").AnyTimes()
-	slice0MasterConn.EXPECT().Execute("SELECT * FROM `tbl_mycat` WHERE `k`=0", defaultMaxSqlResultSize).Return(expectResult1, nil)
+	slice0MasterConn.EXPECT().ExecuteWithContext(gomock.Any(), "SELECT * FROM `tbl_mycat` WHERE `k`=0", defaultMaxSqlResultSize).Return(expectResult1, nil)
+	slice0MasterConn.EXPECT().IsClosed().Return(false).AnyTimes()
 	slice0MasterConn.EXPECT().Recycle().Return()
 
 	//slice-1
@@ -169,7 +174,8 @@ func TestExecute(t *testing.T) {
 	slice1MasterConn.EXPECT().SetCharset("utf8", mysql.CharsetIds["utf8"]).Return(false, nil)
 	slice1MasterConn.EXPECT().SetSessionVariables(mysql.NewSessionVariables()).Return(false, nil)
 	slice1MasterConn.EXPECT().GetAddr().Return("127.0.0.1:3306").AnyTimes()
-	slice1MasterConn.EXPECT().Execute("SELECT * FROM `tbl_mycat` WHERE `k`=0", defaultMaxSqlResultSize).Return(expectResult2, nil)
+	slice1MasterConn.EXPECT().ExecuteWithContext(gomock.Any(), "SELECT * FROM `tbl_mycat` WHERE `k`=0", defaultMaxSqlResultSize).Return(expectResult2, nil)
+	slice1MasterConn.EXPECT().IsClosed().Return(false).AnyTimes()
 	slice1MasterConn.EXPECT().Recycle().Return()
 
 	slice0MasterPool.EXPECT().Get(context.TODO()).Return(slice0MasterConn, nil)
@@ -530,6 +536,597 @@ func newDefaultSessionExecutor(mnFunc ModifyNamespaceFunc) (*SessionExecutor, er
 	return c, nil
 }
 
+func TestGetMaxExecuteTime(t *testing.T) {
+	testCases := []struct {
+		stmtType     int
+		nsLimit      int
+		sessionLimit int64
+		hintLimit    int
+		expect       int
+	}{
+		{parser.StmtSelect, 0, 0, 0, 0},
+		{parser.StmtSelect, 0, 100, 0, 100},
+		{parser.StmtSelect, 1000, 0, 0, 1000},
+		{parser.StmtSelect, 1000, 100, 0, 100},
+		{parser.StmtSelect, 1000, 2000, 0, 1000},
+		{parser.StmtSelect, 0, 0, 300, 300},
+		{parser.StmtSelect, 0, 100, 300, 300},
+		{parser.StmtSelect, 1000, 100, 300, 300},
+		{parser.StmtSelect, 1000, 0, 2000, 1000},
+		// session max_execution_time doesn't limit other statements
+		{parser.StmtUpdate, 0, 100, 0, 0},
+		{parser.StmtInsert, 1000, 100, 0, 1000},
+		{parser.StmtDelete, 1000, 2000, 0, 1000},
+	}
+	for _, ca := range testCases {
+		se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+			ns.MaxSqlExecuteTime = ca.nsLimit
+		})
+		require.NoError(t, err)
+		if ca.sessionLimit > 0 {
+			require.NoError(t, se.sessionVariables.Set(mysql.MaxExecutionTime, ca.sessionLimit))
+		}
+		assert.Equal(t, ca.expect, se.getMaxExecuteTime(ca.stmtType, ca.hintLimit))
+	}
+}
+
+func TestGetMaxExecutionTimeHint(t *testing.T) {
+	testCases := []struct {
+		stmtType int
+		sql      string
+		expect   int
+	}{
+		{parser.StmtSelect, "select * from t", 0},
+		{parser.StmtSelect, "select /*+ MAX_EXECUTION_TIME(1000) */ * from t", 1000},
+		{parser.StmtSelect, "SELECT /*+ BKA(t1) max_execution_time( 200 ) */ * FROM t1", 200},
+		{parser.StmtSelect, "select /* MAX_EXECUTION_TIME(1000) */ * from t", 0},
+		{parser.StmtSelect, "select /*+ MAX_EXECUTION_TIME(abc) */ * from t", 0},
+		{parser.StmtUpdate, "update /*+ MAX_EXECUTION_TIME(1000) */ t set a = 1", 0},
+	}
+	for _, ca := range testCases {
+		assert.Equal(t, ca.expect, getMaxExecutionTimeHint(ca.stmtType, ca.sql), ca.sql)
+	}
+}
+
+func TestLimitSelectResult(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+
+	newResult := func() *mysql.Result {
+		rs := &mysql.Resultset{}
+		for i := 0; i < 5; i++ {
+			rs.Values = append(rs.Values, []interface{}{int64(i)})
+			rs.RowDatas = append(rs.RowDatas, mysql.RowData{})
+		}
+		return &mysql.Result{Resultset: rs}
+	}
+	getPlan := func(sql string) plan.Plan {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.Preview(sql))
+		p, err := se.getPlan(reqCtx, se.GetNamespace(), se.db, sql, false)
+		require.NoError(t, err)
+		return p
+	}
+	scatter := getPlan("select id from tbl_ks")
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtSelect)
+
+	// no sql_select_limit
+	r := newResult()
+	se.limitSelectResult(reqCtx, scatter, r)
+	assert.Len(t, r.Values, 5)
+
+	require.NoError(t, se.sessionVariables.Set(mysql.SQLSelectLimit, int64(3)))
+	r = newResult()
+	se.limitSelectResult(reqCtx, scatter, r)
+	assert.Len(t, r.Values, 3)
+	assert.Len(t, r.RowDatas, 3)
+
+	// select with its own limit is not limited
+	r = newResult()
+	se.limitSelectResult(reqCtx, getPlan("select id from tbl_ks limit 10"), r)
+	assert.Len(t, r.Values, 5)
+
+	// only select is limited
+	reqCtx.SetStmtType(parser.StmtShow)
+	r = newResult()
+	se.limitSelectResult(reqCtx, scatter, r)
+	assert.Len(t, r.Values, 5)
+}
+
+func TestDetachKsConns(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	se.keepSession = true
+
+	pc := backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().MoreRowsExist().Return(false).AnyTimes()
+	pc.EXPECT().MoreResultsExist().Return(false).AnyTimes()
+
+	// keep session without multiplexing holds the connection
+	se.ksConns["slice-0"] = pc
+	se.detachKsConns()
+	assert.Len(t, se.ksConns, 1)
+
+	// connection is held in transaction
+	se.multiplexing = true
+	se.status |= mysql.ServerStatusInTrans
+	se.detachKsConns()
+	assert.Len(t, se.ksConns, 1)
+
+	se.status &= ^mysql.ServerStatusInTrans
+	pc.EXPECT().Recycle().Times(1)
+	se.detachKsConns()
+	assert.Len(t, se.ksConns, 0)
+
+	// pinned by stateful sql
+	se.pinKsConns("select get_lock('a', 10)")
+	assert.True(t, se.pinned)
+	se.ksConns["slice-0"] = pc
+	se.detachKsConns()
+	assert.Len(t, se.ksConns, 1)
+}
+
+func TestCanRetryRead(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.ReadRetryAttempts = 2
+	})
+	require.NoError(t, err)
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtSelect)
+	reqCtx.SetFromSlave(1)
+	connErr := fmt.Errorf("connection reset by peer")
+	assert.True(t, se.canRetryRead(reqCtx, connErr))
+
+	// error of sql itself
+	assert.False(t, se.canRetryRead(reqCtx, mysql.NewError(mysql.ErrNoSuchTable, "table doesn't exist")))
+
+	// read from master
+	reqCtx.SetFromSlave(0)
+	assert.False(t, se.canRetryRead(reqCtx, connErr))
+	reqCtx.SetFromSlave(1)
+
+	// in transaction
+	se.status |= mysql.ServerStatusInTrans
+	assert.False(t, se.canRetryRead(reqCtx, connErr))
+	se.status &= ^mysql.ServerStatusInTrans
+
+	// not select
+	reqCtx.SetStmtType(parser.StmtShow)
+	assert.False(t, se.canRetryRead(reqCtx, connErr))
+
+	// retry is disabled
+	se, err = newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	reqCtx.SetStmtType(parser.StmtSelect)
+	assert.False(t, se.canRetryRead(reqCtx, connErr))
+}
+
+func TestCanRetryDML(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.DMLRetryAttempts = 3
+	})
+	require.NoError(t, err)
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	deadlockErr := mysql.NewDefaultError(mysql.ErrLockDeadlock)
+	assert.True(t, se.canRetryDML(reqCtx, deadlockErr))
+	assert.True(t, se.canRetryDML(reqCtx, mysql.NewDefaultError(mysql.ErrLockWaitTimeout)))
+
+	// other errors
+	assert.False(t, se.canRetryDML(reqCtx, mysql.NewError(mysql.ErrNoSuchTable, "table doesn't exist")))
+	assert.False(t, se.canRetryDML(reqCtx, fmt.Errorf("connection reset by peer")))
+
+	// in transaction
+	se.status |= mysql.ServerStatusInTrans
+	assert.False(t, se.canRetryDML(reqCtx, deadlockErr))
+	se.status &= ^mysql.ServerStatusInTrans
+
+	// not dml
+	reqCtx.SetStmtType(parser.StmtSelect)
+	assert.False(t, se.canRetryDML(reqCtx, deadlockErr))
+
+	// retry is disabled
+	se, err = newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	assert.False(t, se.canRetryDML(reqCtx, deadlockErr))
+}
+
+func TestRetryDML(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.DMLRetryAttempts = 3
+		ns.DMLRetryBackoff = 1
+	})
+	require.NoError(t, err)
+	deadlockErr := mysql.NewDefaultError(mysql.ErrLockDeadlock)
+
+	// succeed after retry
+	executions := 0
+	err = se.retryDML("update t set a = 1", deadlockErr, func() error {
+		executions++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, executions)
+
+	// attempts are used up
+	executions = 0
+	err = se.retryDML("update t set a = 1", deadlockErr, func() error {
+		executions++
+		return deadlockErr
+	})
+	assert.Equal(t, deadlockErr, err)
+	assert.Equal(t, 2, executions)
+
+	// other errors are not retried
+	executions = 0
+	otherErr := mysql.NewError(mysql.ErrNoSuchTable, "table doesn't exist")
+	err = se.retryDML("update t set a = 1", deadlockErr, func() error {
+		executions++
+		return otherErr
+	})
+	assert.Equal(t, otherErr, err)
+	assert.Equal(t, 1, executions)
+}
+
+func TestCountSQLs(t *testing.T) {
+	assert.Equal(t, 1, countSQLs(map[string]map[string][]string{"slice-0": {"db": {"update t set a = 1"}}}))
+	assert.Equal(t, 3, countSQLs(map[string]map[string][]string{
+		"slice-0": {"db_0": {"update t_0 set a = 1", "update t_1 set a = 1"}},
+		"slice-1": {"db_1": {"update t_2 set a = 1"}},
+	}))
+}
+
+func TestIsPartialResultAllowed(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtSelect)
+	assert.False(t, se.isPartialResultAllowed(reqCtx, "select * from t"))
+	assert.True(t, se.isPartialResultAllowed(reqCtx, "/*partial_result*/ select * from t"))
+	assert.True(t, se.isPartialResultAllowed(reqCtx, "select * from t /*PARTIAL_RESULT*/"))
+
+	// namespace default is overridden by hint
+	se.GetNamespace().scatterPartialResult = true
+	defer func() {
+		se.GetNamespace().scatterPartialResult = false
+	}()
+	assert.True(t, se.isPartialResultAllowed(reqCtx, "select * from t"))
+	assert.False(t, se.isPartialResultAllowed(reqCtx, "/*fail_fast*/ select * from t"))
+
+	// session variable takes precedence over namespace default
+	require.NoError(t, se.setPartialResultVariable("0"))
+	assert.False(t, se.isPartialResultAllowed(reqCtx, "select * from t"))
+	assert.True(t, se.isPartialResultAllowed(reqCtx, "/*partial_result*/ select * from t"))
+	require.NoError(t, se.setPartialResultVariable("1"))
+	assert.True(t, se.isPartialResultAllowed(reqCtx, "select * from t"))
+
+	// in transaction
+	se.status |= mysql.ServerStatusInTrans
+	assert.False(t, se.isPartialResultAllowed(reqCtx, "/*partial_result*/ select * from t"))
+	se.status &= ^mysql.ServerStatusInTrans
+
+	// not select
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	assert.False(t, se.isPartialResultAllowed(reqCtx, "/*partial_result*/ update t set a = 1"))
+}
+
+func TestGetPartialResults(t *testing.T) {
+	sqls := map[string]map[string][]string{"slice-0": {"db": {"select 1", "select 2"}}, "slice-1": {"db": {"select 3"}}}
+	r0, r2 := &mysql.Result{}, &mysql.Result{}
+	rs, ok := getPartialResults(sqls, []interface{}{r0, fmt.Errorf("connection reset"), r2})
+	assert.True(t, ok)
+	assert.Equal(t, []*mysql.Result{r0, r2}, rs)
+
+	// slice skipped after init connection failed
+	rs, ok = getPartialResults(sqls, []interface{}{fmt.Errorf("use db failed"), nil, r2})
+	assert.True(t, ok)
+	assert.Equal(t, []*mysql.Result{r2}, rs)
+
+	_, ok = getPartialResults(sqls, []interface{}{backend.ErrExecuteTimeout, nil, fmt.Errorf("connection reset")})
+	assert.False(t, ok)
+}
+
+func TestAddResultWarnings(t *testing.T) {
+	reqCtx := util.NewRequestContext()
+	r := &mysql.Result{Resultset: &mysql.Resultset{}}
+	addResultWarnings(reqCtx, r)
+	assert.Equal(t, uint16(0), r.Warnings)
+
+	reqCtx.AddWarnings(2)
+	reqCtx.AddWarnings(1)
+	addResultWarnings(reqCtx, r)
+	assert.Equal(t, uint16(3), r.Warnings)
+
+	reqCtx.AddWarnings(math.MaxUint16)
+	addResultWarnings(reqCtx, r)
+	assert.Equal(t, uint16(math.MaxUint16), r.Warnings)
+	addResultWarnings(reqCtx, nil)
+}
+
+func TestRecordRowCount(t *testing.T) {
+	se := &SessionExecutor{}
+	rs, err := mysql.BuildResultset(nil, []string{"id"}, [][]interface{}{{1}, {2}, {3}})
+	assert.Nil(t, err)
+
+	se.recordRowCount(&mysql.Result{Resultset: rs}, nil)
+	assert.Equal(t, uint64(3), se.GetFoundRows())
+	assert.Equal(t, int64(-1), se.GetRowCount())
+
+	// found_rows() is kept by statements without result set
+	se.recordRowCount(&mysql.Result{AffectedRows: 5}, nil)
+	assert.Equal(t, uint64(3), se.GetFoundRows())
+	assert.Equal(t, int64(5), se.GetRowCount())
+
+	se.recordRowCount(nil, nil)
+	assert.Equal(t, int64(0), se.GetRowCount())
+
+	se.recordRowCount(nil, fmt.Errorf("duplicate entry"))
+	assert.Equal(t, int64(-1), se.GetRowCount())
+	assert.Equal(t, uint64(3), se.GetFoundRows())
+
+	// found rows counted for SQL_CALC_FOUND_ROWS are kept for the statement only
+	se.SetFoundRows(100)
+	se.recordRowCount(&mysql.Result{Resultset: rs}, nil)
+	assert.Equal(t, uint64(100), se.GetFoundRows())
+	se.recordRowCount(&mysql.Result{Resultset: rs}, nil)
+	assert.Equal(t, uint64(3), se.GetFoundRows())
+}
+
+func TestHasCalcFoundRows(t *testing.T) {
+	assert.True(t, hasCalcFoundRows(parser.Tokenize("select SQL_CALC_FOUND_ROWS * from t limit 10")))
+	assert.True(t, hasCalcFoundRows(parser.Tokenize("SELECT distinct sql_calc_found_rows a from t limit 10")))
+	assert.False(t, hasCalcFoundRows(parser.Tokenize("select * from t where a = 'sql_calc_found_rows'")))
+	assert.False(t, hasCalcFoundRows(parser.Tokenize("update t set a = 1")))
+}
+
+func TestReleaseTxNamespace(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+
+	ns := se.GetNamespace()
+	se.txNamespace = ns
+	ns.activeTxs.Add(1)
+	se.status |= mysql.ServerStatusInTrans
+	require.NoError(t, se.rollback())
+	assert.Nil(t, se.txNamespace)
+	assert.Equal(t, int64(0), ns.activeTxs.Get())
+}
+
+func TestIsReadOnlyTxToSlave(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.ReadOnlyTxToSlave = true
+	})
+	require.NoError(t, err)
+	assert.True(t, se.isReadOnlyTxToSlave(true))
+	assert.False(t, se.isReadOnlyTxToSlave(false))
+
+	// session transaction_read_only makes all transactions read only
+	require.NoError(t, se.setIntSessionVariable("transaction_read_only", "1"))
+	assert.True(t, se.isReadOnlyTxToSlave(false))
+	require.NoError(t, se.setIntSessionVariable("transaction_read_only", "0"))
+
+	// user without read write split
+	se.user = "test_executor_w"
+	assert.False(t, se.isReadOnlyTxToSlave(true))
+	se.user = "test_executor"
+
+	se.keepSession = true
+	assert.False(t, se.isReadOnlyTxToSlave(true))
+	se.keepSession = false
+
+	se, err = newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	assert.False(t, se.isReadOnlyTxToSlave(true))
+}
+
+func TestHandleBeginReadOnly(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.ReadOnlyTxToSlave = true
+	})
+	require.NoError(t, err)
+
+	// connection of read write transaction on master is committed and released
+	pc := backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().Commit().Return(nil).Times(1)
+	pc.EXPECT().Recycle().Times(1)
+	se.txConns["slice-0"] = pc
+	se.status |= mysql.ServerStatusInTrans
+	require.NoError(t, se.handleBegin(true))
+	assert.Len(t, se.txConns, 0)
+	assert.True(t, se.txReadOnly)
+	assert.True(t, se.isInTransaction())
+
+	// connection of read only transaction on slave is reused
+	pc = backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().Execute("start transaction read only", 0).Return(nil, nil).Times(1)
+	se.txConns["slice-0"] = pc
+	se.txFromSlave = true
+	require.NoError(t, se.handleBegin(true))
+	assert.Len(t, se.txConns, 1)
+
+	pc.EXPECT().Commit().Return(nil).Times(1)
+	pc.EXPECT().Recycle().Times(1)
+	require.NoError(t, se.commit())
+	assert.False(t, se.txReadOnly)
+	assert.False(t, se.txFromSlave)
+}
+
+func TestSetTransactionReadOnlyBeforeBegin(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.ReadOnlyTxToSlave = true
+	})
+	require.NoError(t, err)
+
+	setTransaction := func(sql string) error {
+		stmt, err := parser.ParseOneStmt(sql)
+		require.NoError(t, err)
+		_, err = se.handleSet(util.NewRequestContext(), sql, stmt.(*ast.SetStmt))
+		return err
+	}
+
+	// access mode only takes effect in next transaction
+	require.NoError(t, setTransaction("set transaction read only"))
+	assert.Equal(t, int64(0), se.getIntSessionVariable("tx_read_only"))
+	require.NoError(t, se.handleBegin(false))
+	assert.True(t, se.txReadOnly)
+	assert.True(t, se.isReadOnlyTxToSlave(se.txReadOnly))
+	assert.False(t, se.nextTxReadOnly)
+
+	// access mode can't be changed in transaction
+	err = setTransaction("set transaction read write")
+	assert.Equal(t, uint16(mysql.ErrCantChangeTxCharacteristics), err.(*mysql.SQLError).SQLCode())
+	require.NoError(t, se.commit())
+	require.NoError(t, se.handleBegin(false))
+	assert.False(t, se.txReadOnly)
+	require.NoError(t, se.commit())
+
+	require.NoError(t, setTransaction("set transaction read only"))
+	require.NoError(t, setTransaction("set transaction read write"))
+	require.NoError(t, se.handleBegin(false))
+	assert.False(t, se.txReadOnly)
+	require.NoError(t, se.commit())
+}
+
+func TestTrackSessionVariables(t *testing.T) {
+	for _, track := range []bool{false, true} {
+		se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+			ns.TrackSessionVariables = track
+		})
+		require.NoError(t, err)
+
+		sql := "set session foreign_key_checks = 0"
+		stmt, err := parser.ParseOneStmt(sql)
+		require.NoError(t, err)
+		_, err = se.handleSet(util.NewRequestContext(), sql, stmt.(*ast.SetStmt))
+		require.NoError(t, err)
+		_, ok := se.sessionVariables.Get("foreign_key_checks")
+		assert.Equal(t, track, ok, "track_session_variables: %v", track)
+	}
+}
+
+func TestExecuteBatchInScatterShard(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctx := context.Background()
+	r1, r2 := &mysql.Result{AffectedRows: 1}, &mysql.Result{AffectedRows: 2}
+
+	pc := backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().ExecuteWithContext(ctx, "delete from t_0", 0).Return(r1, nil).Times(1)
+	rs, errs := executeBatchInScatterShard(ctx, 0, pc, []string{"delete from t_0"}, 0)
+	assert.Equal(t, []*mysql.Result{r1}, rs)
+	assert.Equal(t, []error{nil}, errs)
+
+	sqls := []string{"delete from t_0", "delete from t_1"}
+	pc.EXPECT().ExecutePipeline(ctx, sqls, 0).Return([]*mysql.Result{r1, r2}, []error{nil, nil}).Times(1)
+	rs, errs = executeBatchInScatterShard(ctx, 0, pc, sqls, 0)
+	assert.Equal(t, []*mysql.Result{r1, r2}, rs)
+	assert.Equal(t, []error{nil, nil}, errs)
+}
+
+func TestExecuteInMultiSlicesInterruptedByFailure(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.session.c = &ClientConn{Conn: &mysql.Conn{}}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newConn := func(db string) *backend.MockPooledConnect {
+		pc := backend.NewMockPooledConnect(mockCtl)
+		pc.EXPECT().UseDB(db).Return(nil)
+		pc.EXPECT().SetCharset("utf8", mysql.CharsetIds["utf8"]).Return(false, nil)
+		pc.EXPECT().SetSessionVariables(gomock.Any()).Return(false, nil)
+		pc.EXPECT().GetAddr().Return("127.0.0.1:3306").AnyTimes()
+		pc.EXPECT().GetConnectionID().Return(int64(1)).AnyTimes()
+		return pc
+	}
+	failedErr := mysql.NewError(mysql.ErrDupEntry, "duplicate entry")
+	slice0 := newConn("db_mycat_0")
+	slice0.EXPECT().ExecuteWithContext(gomock.Any(), "delete from t_0", gomock.Any()).Return(nil, failedErr)
+	slice0.EXPECT().IsClosed().Return(false).AnyTimes()
+	// slow slice is interrupted once the statement fails, instead of being waited for
+	slice1 := newConn("db_mycat_2")
+	slice1.EXPECT().ExecuteWithContext(gomock.Any(), "delete from t_2", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, sql string, maxRows int) (*mysql.Result, error) {
+			select {
+			case <-ctx.Done():
+				return nil, backend.ErrExecuteTimeout
+			case <-time.After(5 * time.Second):
+				return &mysql.Result{}, nil
+			}
+		})
+	slice1.EXPECT().Close()
+	slice1.EXPECT().IsClosed().Return(true).AnyTimes()
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtDelete)
+	pcs := map[string]backend.PooledConnect{"slice-0": slice0, "slice-1": slice1}
+	sqls := map[string]map[string][]string{
+		"slice-0": {"db_mycat_0": {"delete from t_0"}},
+		"slice-1": {"db_mycat_2": {"delete from t_2"}},
+	}
+	start := time.Now()
+	_, err = se.executeInMultiSlices(reqCtx, pcs, sqls)
+	assert.Equal(t, failedErr, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestIsStatefulStmt(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect bool
+	}{
+		{"select * from t where id = 1", false},
+		{"update t set a = 1", false},
+		{"create table t (id int)", false},
+		{"CREATE TEMPORARY TABLE tmp (id int)", true},
+		{"SELECT GET_LOCK('a', 10)", true},
+		{"select * from t where id = release_lock('a')", true},
+		{"select @a := max(id) from t", true},
+		{"select @a from t", false},
+		{"set @a = 1", true},
+		{"set names utf8", false},
+		{"set session sql_mode = ''", false},
+		{"lock tables t read", true},
+		{"prepare stmt1 from 'select 1'", true},
+		{"insert into t values (last_insert_id(10))", true},
+		{"select last_insert_id()", true},
+		{"select SQL_CALC_FOUND_ROWS * from t limit 10", false},
+		{"select * from t where name = 'temporary get_lock :='", false},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseOneStmt(test.sql)
+		require.NoError(t, err, test.sql)
+		assert.Equal(t, test.expect, isStatefulStmt(stmt), test.sql)
+	}
+}
+
+func TestPinKsConns(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.multiplexing = true
+
+	se.pinKsConns("select * from t where name = 'get_lock'")
+	assert.False(t, se.pinned)
+	se.pinKsConns("select get_lock('a', 10)")
+	assert.True(t, se.pinned)
+
+	se.pinned = false
+	se.pinKsConns("unparsable sql get_lock")
+	assert.True(t, se.pinned)
+}
+
 // test checkExecuteFromSlave
 func TestCanExecuteFromSlave(t *testing.T) {
 	var userPriv = map[string]string{
@@ -1137,7 +1734,7 @@ func TestUnshardPlan(t *testing.T) {
 				expectSql:         "select last_insert_id () as id",
 				expectPlan:        &plan.SelectLastInsertIDPlan{},
 			},
-			// 带参数的 laster insert id 直接转发 mysql
+			// 整数常量参数的 last insert id 设置 session 的值，由 proxy 处理
 			{
 				name: "test select last_insert_id(1)",
 				sql:  "select last_insert_id(1)",
@@ -1149,6 +1746,72 @@ func TestUnshardPlan(t *testing.T) {
 				expectUnshardPlan: true,
 				expectDB:          defaltDb,
 				expectSql:         "select last_insert_id(1)",
+				expectPlan:        &plan.SelectLastInsertIDPlan{},
+			},
+			{
+				name: "test select @@identity",
+				sql:  "select @@identity",
+				mnFunc: func(nsConfig *models.Namespace) {
+					nsConfig.AllowedDBS = map[string]bool{"db_unshard": true}
+					nsConfig.DefaultPhyDBS = map[string]string{"db_unshard": "db_unshard"}
+					nsConfig.ShardRules = nil
+				},
+				expectUnshardPlan: true,
+				expectDB:          defaltDb,
+				expectSql:         "select @@identity",
+				expectPlan:        &plan.SelectLastInsertIDPlan{},
+			},
+			{
+				name: "test select @@session.last_insert_id as id",
+				sql:  "select @@session.last_insert_id as id",
+				mnFunc: func(nsConfig *models.Namespace) {
+					nsConfig.AllowedDBS = map[string]bool{"db_unshard": true}
+					nsConfig.DefaultPhyDBS = map[string]string{"db_unshard": "db_unshard"}
+					nsConfig.ShardRules = nil
+				},
+				expectUnshardPlan: true,
+				expectDB:          defaltDb,
+				expectSql:         "select @@session.last_insert_id as id",
+				expectPlan:        &plan.SelectLastInsertIDPlan{},
+			},
+			{
+				name: "test select found_rows()",
+				sql:  "select found_rows()",
+				mnFunc: func(nsConfig *models.Namespace) {
+					nsConfig.AllowedDBS = map[string]bool{"db_unshard": true}
+					nsConfig.DefaultPhyDBS = map[string]string{"db_unshard": "db_unshard"}
+					nsConfig.ShardRules = nil
+				},
+				expectUnshardPlan: true,
+				expectDB:          defaltDb,
+				expectSql:         "select found_rows()",
+				expectPlan:        &plan.SelectFoundRowsPlan{},
+			},
+			{
+				name: "test select row_count() as cnt",
+				sql:  "select row_count() as cnt",
+				mnFunc: func(nsConfig *models.Namespace) {
+					nsConfig.AllowedDBS = map[string]bool{"db_unshard": true}
+					nsConfig.DefaultPhyDBS = map[string]string{"db_unshard": "db_unshard"}
+					nsConfig.ShardRules = nil
+				},
+				expectUnshardPlan: true,
+				expectDB:          defaltDb,
+				expectSql:         "select row_count() as cnt",
+				expectPlan:        &plan.SelectFoundRowsPlan{},
+			},
+			// 表达式参数的 last insert id 直接转发 mysql
+			{
+				name: "test select last_insert_id(id + 1)",
+				sql:  "select last_insert_id(id + 1)",
+				mnFunc: func(nsConfig *models.Namespace) {
+					nsConfig.AllowedDBS = map[string]bool{"db_unshard": true}
+					nsConfig.DefaultPhyDBS = map[string]string{"db_unshard": "db_unshard"}
+					nsConfig.ShardRules = nil
+				},
+				expectUnshardPlan: true,
+				expectDB:          defaltDb,
+				expectSql:         "select last_insert_id(id + 1)",
 				expectPlan:        &plan.UnshardPlan{},
 			},
 		}
@@ -1351,3 +2014,199 @@ func BenchmarkGetNamespace(b *testing.B) {
 		}
 	}
 }
+
+func TestExecuteStatisticsAndDebugCommand(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	if err != nil {
+		t.Fatalf("new session executor error: %v", err)
+	}
+
+	rs := se.ExecuteCommand(mysql.ComStatistics, nil)
+	assert.Equal(t, RespStatistics, rs.RespType)
+	assert.True(t, strings.HasPrefix(rs.Data.(string), "Uptime: "), rs.Data)
+	assert.Contains(t, rs.Data.(string), "Queries per second avg: ")
+
+	rs = se.ExecuteCommand(mysql.ComDebug, nil)
+	assert.Equal(t, RespOK, rs.RespType)
+}
+
+func TestExecCommandRecoverPanic(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	cc := se.session
+	cc.executor = se
+	cc.manager = localManager
+	cc.namespace = se.namespace
+
+	// nil stmts map makes handleStmtPrepare panic
+	se.stmts = nil
+	rs := cc.execCommand(mysql.ComStmtPrepare, []byte("select * from t where id = ?"))
+	require.Equal(t, RespError, rs.RespType)
+	sqlErr, ok := rs.Data.(*mysql.SQLError)
+	require.True(t, ok)
+	assert.Equal(t, uint16(mysql.ErrInternal), sqlErr.SQLCode())
+
+	// session is still usable after the panic
+	se.stmts = make(map[uint32]*Stmt)
+	rs = cc.execCommand(mysql.ComStmtPrepare, []byte("select * from t where id = ?"))
+	require.Equal(t, RespPrepare, rs.RespType)
+
+	// connections of transaction are discarded and session is closed
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	pc := backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().Close().Times(1)
+	pc.EXPECT().Recycle().Times(1)
+	se.txConns["slice-0"] = pc
+	se.status |= mysql.ServerStatusInTrans
+	se.stmts = nil
+	rs = cc.execCommand(mysql.ComStmtPrepare, []byte("select * from t where id = ?"))
+	require.Equal(t, RespError, rs.RespType)
+	_, ok = rs.Data.(*mysql.SessionCloseRespError)
+	assert.True(t, ok)
+	assert.Len(t, se.txConns, 0)
+	assert.False(t, se.isInTransaction())
+}
+
+func TestTimeoutAbortsTransaction(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.session.c = &ClientConn{Conn: &mysql.Conn{}}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newConn := func(db string) *backend.MockPooledConnect {
+		pc := backend.NewMockPooledConnect(mockCtl)
+		pc.EXPECT().UseDB(db).Return(nil)
+		pc.EXPECT().SetCharset("utf8", mysql.CharsetIds["utf8"]).Return(false, nil)
+		pc.EXPECT().SetSessionVariables(gomock.Any()).Return(false, nil)
+		// killing the timed out query fails fast since nothing listens on the address
+		pc.EXPECT().GetAddr().Return("127.0.0.1:1").AnyTimes()
+		pc.EXPECT().GetConnectionID().Return(int64(1)).AnyTimes()
+		return pc
+	}
+	pc0 := newConn("db_mycat_0")
+	pc0.EXPECT().ExecuteWithContext(gomock.Any(), "insert into t_0 values(1)", gomock.Any()).Return(&mysql.Result{AffectedRows: 1}, nil)
+	pc0.EXPECT().IsClosed().Return(false).AnyTimes()
+	pc1 := newConn("db_mycat_1")
+	pc1.EXPECT().ExecuteWithContext(gomock.Any(), "update t_1 set a = 1", gomock.Any()).Return(nil, backend.ErrExecuteTimeout)
+	pc1.EXPECT().Close()
+	pc1.EXPECT().IsClosed().Return(true).AnyTimes()
+	// the rest of transaction is rolled back instead of being committed
+	pc0.EXPECT().Rollback().Return(nil)
+	pc0.EXPECT().Recycle()
+
+	ns := se.GetNamespace()
+	maxSqlExecuteTime := ns.maxSqlExecuteTime
+	ns.maxSqlExecuteTime = 1000
+	defer func() { ns.maxSqlExecuteTime = maxSqlExecuteTime }()
+	se.status |= mysql.ServerStatusInTrans
+	se.txConns = map[string]backend.PooledConnect{"slice-0": pc0, "slice-1": pc1}
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtInsert)
+	_, err = se.executeInSlice(reqCtx, pc0, "slice-0", "db_mycat_0", "insert into t_0 values(1)")
+	require.NoError(t, err)
+
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	_, err = se.executeInSlice(reqCtx, pc1, "slice-1", "db_mycat_1", "update t_1 set a = 1")
+	require.Error(t, err)
+	assert.Equal(t, uint16(mysql.ErrQueryTimeout), err.(*mysql.SQLError).Code)
+	assert.True(t, se.isInTransaction())
+	assert.Empty(t, se.txConns)
+
+	// statements fail until the transaction ends
+	_, err = se.getTransactionConn("slice-0")
+	assert.Error(t, err)
+
+	err = se.handleCommit()
+	require.Error(t, err)
+	assert.Equal(t, uint16(mysql.ErrQueryTimeout), err.(*mysql.SQLError).Code)
+	assert.False(t, se.isInTransaction())
+	assert.False(t, se.txAborted)
+}
+
+func TestUserACLOfNonPlanStatements(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.clientAddr = "127.0.0.1:3306"
+	ns := se.GetNamespace()
+	up := ns.userProperties[se.user]
+	allowedDBs, allowedTables := up.allowedDBs, up.allowedTables
+	up.allowedDBs = map[string]bool{"db_ks": true}
+	up.allowedTables = map[string]map[string]bool{"db_ks": {"tbl_ks": true}}
+	defer func() { up.allowedDBs, up.allowedTables = allowedDBs, allowedTables }()
+
+	// show statements
+	showCases := []struct {
+		sql     string
+		allowed bool
+	}{
+		{"show create table tbl_ks", true},
+		{"show columns from tbl_ks", true},
+		{"show tables", true},
+		{"show columns from tbl_other", false},
+		{"show index from db_mycat.tbl_ks", false},
+		{"show columns from tbl_ks from db_mycat", false},
+		{"show tables from db_mycat", false},
+		{"show table status from db_mycat", false},
+	}
+	for _, c := range showCases {
+		_, err := se.checkShowACL(c.sql)
+		assert.Equal(t, c.allowed, err == nil, c.sql)
+	}
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetTokens(parser.Tokenize("show databases"))
+	r, err := se.handleShow(reqCtx, "show databases")
+	require.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{"db_ks"}}, r.Values)
+
+	stmt, err := se.checkShowACL("show tables")
+	require.NoError(t, err)
+	r = &mysql.Result{Resultset: &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: []byte("Tables_in_db_ks")}},
+		Values: [][]interface{}{{[]byte("tbl_ks")}, {[]byte("tbl_other")}},
+	}}
+	require.NoError(t, plan.GenerateSelectResultRowData(r))
+	require.NoError(t, se.filterShowTablesResult(r, stmt))
+	assert.Equal(t, [][]interface{}{{[]byte("tbl_ks")}}, r.Values)
+	assert.Len(t, r.RowDatas, 1)
+
+	// COM_FIELD_LIST is rejected before getting backend connection
+	_, err = se.handleFieldList([]byte("tbl_other\x00"))
+	require.Error(t, err)
+	assert.Equal(t, uint16(mysql.ErrTableaccessDenied), err.(*mysql.SQLError).Code)
+
+	// COM_INIT_DB
+	err = se.handleUseDB("db_mycat")
+	require.Error(t, err)
+	assert.Equal(t, uint16(mysql.ErrDBaccessDenied), err.(*mysql.SQLError).Code)
+	assert.Equal(t, "db_ks", se.GetDatabase())
+	require.NoError(t, se.handleUseDB("db_ks"))
+
+	// database in handshake
+	for _, db := range []string{"db_ks", "db_mycat"} {
+		server, client := net.Pipe()
+		cc := &Session{c: NewClientConn(mysql.NewConn(server), localManager), manager: localManager}
+		cc.executor = newSessionExecutor(localManager)
+		cc.executor.clientAddr = se.clientAddr
+		salt := []byte("abcdefghij0123456789")
+		err := cc.handleHandshakeResponse(HandshakeResponseInfo{
+			User:         se.user,
+			Salt:         salt,
+			AuthPlugin:   mysql.MysqlNativePassword,
+			AuthResponse: mysql.CalcPassword(salt, []byte("test_executor")),
+			CollationID:  mysql.DefaultCollationID,
+			Database:     db,
+		})
+		if db == "db_ks" {
+			assert.NoError(t, err)
+		} else {
+			require.Error(t, err)
+			assert.Equal(t, uint16(mysql.ErrDBaccessDenied), err.(*mysql.SQLError).Code)
+		}
+		server.Close()
+		client.Close()
+	}
+}
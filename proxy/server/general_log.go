@@ -0,0 +1,67 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// generalLogFilter decide whether a successful statement is written to general log,
+// nil filter logs all statements
+type generalLogFilter struct {
+	matched    uint64 // statements passed user and fingerprint filters, first field to be 64-bit aligned
+	sampleRate uint64
+	users      map[string]bool   // empty means all users
+	suppressed map[string]string // key: md5 of fingerprint, value: fingerprint
+}
+
+func newGeneralLogFilter(cfg *models.GeneralLog) *generalLogFilter {
+	if cfg == nil {
+		return nil
+	}
+	f := &generalLogFilter{
+		users:      make(map[string]bool, len(cfg.Users)),
+		suppressed: parseBlackSqls(cfg.SuppressSQLs),
+	}
+	if cfg.SampleRate > 1 {
+		f.sampleRate = uint64(cfg.SampleRate)
+	}
+	for _, user := range cfg.Users {
+		f.users[user] = true
+	}
+	return f
+}
+
+// shouldLog return true if statement of user should be logged, 1 of every sample rate matched statements is logged
+func (f *generalLogFilter) shouldLog(reqCtx *util.RequestContext, user, sql string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.users) != 0 && !f.users[user] {
+		return false
+	}
+	if len(f.suppressed) != 0 {
+		if _, ok := f.suppressed[getSQLFingerprintMd5(reqCtx, sql)]; ok {
+			return false
+		}
+	}
+	if f.sampleRate == 0 {
+		return true
+	}
+	return (atomic.AddUint64(&f.matched, 1)-1)%f.sampleRate == 0
+}
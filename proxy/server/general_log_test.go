@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneralLogFilter(t *testing.T) {
+	var f *generalLogFilter
+	assert.True(t, f.shouldLog(util.NewRequestContext(), "u1", "select 1"))
+	assert.Nil(t, newGeneralLogFilter(nil))
+
+	f = newGeneralLogFilter(&models.GeneralLog{
+		SampleRate:   3,
+		Users:        []string{"u1"},
+		SuppressSQLs: []string{"select * from heartbeat where id = 1"},
+	})
+	assert.False(t, f.shouldLog(util.NewRequestContext(), "u2", "select 1"))
+	assert.False(t, f.shouldLog(util.NewRequestContext(), "u1", "SELECT * FROM heartbeat WHERE id = 2"))
+
+	var logged int
+	for i := 0; i < 9; i++ {
+		if f.shouldLog(util.NewRequestContext(), "u1", "select 1") {
+			logged++
+		}
+	}
+	assert.Equal(t, 3, logged)
+
+	// sample rate 1 logs all statements
+	f = newGeneralLogFilter(&models.GeneralLog{SampleRate: 1})
+	for i := 0; i < 3; i++ {
+		assert.True(t, f.shouldLog(util.NewRequestContext(), "u1", "select 1"))
+	}
+}
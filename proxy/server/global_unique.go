@@ -0,0 +1,245 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// parseGlobalUniqueKeys group global unique keys by table, key of result is db.table in lower case
+func parseGlobalUniqueKeys(keys []*models.GlobalUniqueKey) map[string][]*models.GlobalUniqueKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	ret := make(map[string][]*models.GlobalUniqueKey)
+	for _, k := range keys {
+		table := strings.ToLower(strings.TrimSpace(k.DB) + "." + strings.TrimSpace(k.Table))
+		ret[table] = append(ret[table], k)
+	}
+	return ret
+}
+
+// getGlobalUniqueKeys return global unique keys of logical table
+func (n *Namespace) getGlobalUniqueKeys(db, table string) []*models.GlobalUniqueKey {
+	if len(n.globalUniqueKeys) == 0 {
+		return nil
+	}
+	return n.globalUniqueKeys[strings.ToLower(db+"."+table)]
+}
+
+// uniqueValueSQL format value as string literal, values are stored as strings in index tables
+func uniqueValueSQL(v interface{}) string {
+	return "'" + mysql.Escape(fmt.Sprint(v)) + "'"
+}
+
+func uniqueValuesSQL(values []interface{}) string {
+	literals := make([]string, 0, len(values))
+	for _, v := range values {
+		literals = append(literals, uniqueValueSQL(v))
+	}
+	return strings.Join(literals, ",")
+}
+
+func newDupEntryError(value interface{}, column string) error {
+	return mysql.NewError(mysql.ErrDupEntry, fmt.Sprintf("Duplicate entry '%v' for key '%s'", value, column))
+}
+
+func isDupEntryError(err error) bool {
+	sqlErr, ok := err.(*mysql.SQLError)
+	return ok && sqlErr.SQLCode() == mysql.ErrDupEntry
+}
+
+// checkGlobalUnique write values of global unique columns of insert to their index tables before the insert is
+// executed, ER_DUP_ENTRY is returned if any value exists in another shard. Index rows are written by connections
+// of session, so they're rolled back with the transaction. The returned undo deletes them if the insert fails.
+// Update of global unique columns is rejected, since index tables can't be maintained by it.
+func (se *SessionExecutor) checkGlobalUnique(reqCtx *util.RequestContext, p plan.Plan) (func(), error) {
+	ns := se.GetNamespace()
+	if len(ns.globalUniqueKeys) == 0 {
+		return nil, nil
+	}
+	if up, ok := p.(*plan.UpdatePlan); ok {
+		return nil, checkGlobalUniqueUpdate(ns, up)
+	}
+	ip, ok := p.(*plan.InsertPlan)
+	if !ok {
+		return nil, nil
+	}
+	db, table := ip.GetTable()
+	keys := ns.getGlobalUniqueKeys(db, table)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	stmt := ip.GetStmt()
+	if stmt.IsReplace || stmt.IgnoreErr || len(stmt.OnDuplicate) > 0 {
+		return nil, fmt.Errorf("REPLACE, INSERT IGNORE and ON DUPLICATE KEY UPDATE are not supported by table %s.%s with global unique keys", db, table)
+	}
+
+	var undos []func()
+	undo := func() {
+		for _, u := range undos {
+			u()
+		}
+	}
+	for _, k := range keys {
+		values, err := ip.GetColumnValues(strings.ToLower(k.Column))
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		seen := make(map[string]bool, len(values))
+		for _, v := range values {
+			if seen[fmt.Sprint(v)] {
+				undo()
+				return nil, newDupEntryError(v, k.Column)
+			}
+			seen[fmt.Sprint(v)] = true
+		}
+		if err := se.insertUniqueValues(reqCtx, k, values); err != nil {
+			undo()
+			return nil, err
+		}
+		key, vs := k, values
+		undos = append(undos, func() {
+			if err := se.deleteUniqueValues(reqCtx, key, vs); err != nil {
+				log.Warn("[ns:%s] delete values of global unique key %s.%s.%s failed, err: %v", ns.name, key.DB, key.Table, key.Column, err)
+			}
+		})
+	}
+	return undo, nil
+}
+
+// checkGlobalUniqueUpdate return error if update assigns any global unique column
+func checkGlobalUniqueUpdate(ns *Namespace, up *plan.UpdatePlan) error {
+	db, table := up.GetTable()
+	keys := ns.getGlobalUniqueKeys(db, table)
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, column := range up.GetAssignedColumns() {
+		for _, k := range keys {
+			if strings.ToLower(k.Column) == column {
+				return fmt.Errorf("UPDATE of global unique column %s is not supported by table %s.%s", k.Column, db, table)
+			}
+		}
+	}
+	return nil
+}
+
+// insertUniqueValues insert values to index table. If some of them exist, they're checked in all sub tables,
+// values not found in any sub table are left by deleted or failed rows, they're taken over by this insert.
+func (se *SessionExecutor) insertUniqueValues(reqCtx *util.RequestContext, k *models.GlobalUniqueKey, values []interface{}) error {
+	indexDB, indexTable := k.GetIndexTable()
+	sql := fmt.Sprintf("INSERT INTO %s (`v`) VALUES (%s)", quoteIdentifier(indexTable), uniqueValuesSQL(values))
+	_, err := se.executeGlobalUniqueSQL(reqCtx, k.SliceName, indexDB, sql)
+	if !isDupEntryError(err) {
+		return err
+	}
+
+	sql = fmt.Sprintf("SELECT `v` FROM %s WHERE `v` IN (%s) FOR UPDATE", quoteIdentifier(indexTable), uniqueValuesSQL(values))
+	r, err := se.executeGlobalUniqueSQL(reqCtx, k.SliceName, indexDB, sql)
+	if err != nil {
+		return err
+	}
+	var stale []interface{}
+	for i := range r.Values {
+		v, err := r.GetString(i, 0)
+		if err != nil {
+			return err
+		}
+		exist, err := se.uniqueValueExists(reqCtx, k, v)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return newDupEntryError(v, k.Column)
+		}
+		stale = append(stale, v)
+	}
+	if len(stale) > 0 {
+		if err := se.deleteUniqueValues(reqCtx, k, stale); err != nil {
+			return err
+		}
+	}
+
+	sql = fmt.Sprintf("INSERT INTO %s (`v`) VALUES (%s)", quoteIdentifier(indexTable), uniqueValuesSQL(values))
+	if _, err = se.executeGlobalUniqueSQL(reqCtx, k.SliceName, indexDB, sql); isDupEntryError(err) {
+		// inserted by another session concurrently
+		return newDupEntryError(values[0], k.Column)
+	}
+	return err
+}
+
+func (se *SessionExecutor) deleteUniqueValues(reqCtx *util.RequestContext, k *models.GlobalUniqueKey, values []interface{}) error {
+	indexDB, indexTable := k.GetIndexTable()
+	sql := fmt.Sprintf("DELETE FROM %s WHERE `v` IN (%s)", quoteIdentifier(indexTable), uniqueValuesSQL(values))
+	_, err := se.executeGlobalUniqueSQL(reqCtx, k.SliceName, indexDB, sql)
+	return err
+}
+
+// uniqueValueExists check if value of global unique column exists in any sub table of the logical table
+func (se *SessionExecutor) uniqueValueExists(reqCtx *util.RequestContext, k *models.GlobalUniqueKey, value string) (bool, error) {
+	targets, err := se.GetNamespace().getPurgeTargets(k.DB, k.Table)
+	if err != nil {
+		return false, err
+	}
+	sqls := make(map[string]map[string][]string)
+	for _, t := range targets {
+		if sqls[t.slice] == nil {
+			sqls[t.slice] = make(map[string][]string)
+		}
+		sql := fmt.Sprintf("SELECT 1 FROM %s WHERE %s = %s LIMIT 1", quoteIdentifier(t.table), quoteIdentifier(k.Column), uniqueValueSQL(value))
+		sqls[t.slice][t.db] = append(sqls[t.slice][t.db], sql)
+	}
+	rs, err := se.executeGlobalUniqueSQLs(reqCtx, sqls)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rs {
+		if r.Resultset != nil && len(r.Values) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (se *SessionExecutor) executeGlobalUniqueSQL(reqCtx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
+	rs, err := se.executeGlobalUniqueSQLs(reqCtx, map[string]map[string][]string{slice: {db: {sql}}})
+	if err != nil {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+// executeGlobalUniqueSQLs execute sqls of index tables by connections of session on masters,
+// they're not mirrored or published as row changes like sqls of clients
+func (se *SessionExecutor) executeGlobalUniqueSQLs(reqCtx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
+	pcs, err := se.getBackendConns(sqls, false)
+	defer se.recycleBackendConns(pcs, false)
+	if err != nil {
+		return nil, err
+	}
+	return se.executeInMultiSlices(reqCtx, pcs, sqls)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalUniqueKeys(t *testing.T) {
+	keys := []*models.GlobalUniqueKey{
+		{DB: "db", Table: "t_user", Column: "email", SliceName: "slice-0", IndexTable: "gaea_unique.t_user_email"},
+		{DB: "db", Table: "T_USER", Column: "phone", SliceName: "slice-0", IndexTable: "gaea_unique.t_user_phone"},
+		{DB: "db", Table: "t_order", Column: "order_no", SliceName: "slice-1", IndexTable: "gaea_unique.t_order_no"},
+	}
+	n := &Namespace{globalUniqueKeys: parseGlobalUniqueKeys(keys)}
+	require.Len(t, n.getGlobalUniqueKeys("DB", "t_user"), 2)
+	require.Len(t, n.getGlobalUniqueKeys("db", "t_order"), 1)
+	require.Len(t, n.getGlobalUniqueKeys("db", "t_item"), 0)
+	require.Nil(t, parseGlobalUniqueKeys(nil))
+
+	require.Equal(t, "'a@b.com','it\\'s','1'", uniqueValuesSQL([]interface{}{"a@b.com", "it's", int64(1)}))
+}
+
+func TestDupEntryError(t *testing.T) {
+	err := newDupEntryError("a@b.com", "email")
+	require.True(t, isDupEntryError(err))
+	require.Equal(t, "ERROR 1062 (23000): Duplicate entry 'a@b.com' for key 'email'", err.Error())
+	require.False(t, isDupEntryError(mysql.NewError(mysql.ErrUnknown, "unknown")))
+	require.False(t, isDupEntryError(errors.New("lost connection")))
+	require.False(t, isDupEntryError(nil))
+}
+
+func TestCheckGlobalUniqueUpdate(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.GlobalUniqueKeys = []*models.GlobalUniqueKey{
+			{DB: "db_ks", Table: "tbl_ks", Column: "Email", SliceName: "slice-0", IndexTable: "gaea_unique.tbl_ks_email"},
+		}
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		sql    string
+		reject bool
+	}{
+		{"update tbl_ks set email = 'a@b.com' where id = 1", true},
+		{"update tbl_ks set name = 'a', EMAIL = 'a@b.com' where id = 1", true},
+		{"update tbl_ks set name = 'a' where id = 1", false},
+	}
+	for _, tt := range tests {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.Preview(tt.sql))
+		p, err := se.getPlan(reqCtx, se.GetNamespace(), se.db, tt.sql, false)
+		require.NoError(t, err)
+		_, err = se.checkGlobalUnique(reqCtx, p)
+		require.Equal(t, tt.reject, err != nil, "sql: %s, err: %v", tt.sql, err)
+	}
+}
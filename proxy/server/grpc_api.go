@@ -0,0 +1,529 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	gaea "github.com/XiaoMi/Gaea/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// grpcQueryBatchRows max rows in one message of query stream
+const grpcQueryBatchRows = 1000
+
+// grpcAdminRoles roles required by methods of admin service, methods requiring more than viewer are recorded in audit log
+var grpcAdminRoles = map[string]string{
+	"/gaea.Admin/Ping":                  models.AdminRoleViewer,
+	"/gaea.Admin/ListNamespaces":        models.AdminRoleViewer,
+	"/gaea.Admin/PrepareNamespace":      models.AdminRoleNamespaceOperator,
+	"/gaea.Admin/CommitNamespace":       models.AdminRoleNamespaceOperator,
+	"/gaea.Admin/DeleteNamespace":       models.AdminRoleSuperAdmin,
+	"/gaea.Admin/GetConfigFingerprint":  models.AdminRoleViewer,
+	"/gaea.Admin/GetStats":              models.AdminRoleViewer,
+	"/gaea.Admin/GetBackendConnections": models.AdminRoleViewer,
+	"/gaea.Admin/SetBackendStatus":      models.AdminRoleNamespaceOperator,
+}
+
+// grpcAdmin serve admin operations over grpc, it shares config of admin server
+type grpcAdmin struct {
+	admin *AdminServer
+}
+
+type grpcQuery struct {
+	proxy *Server
+}
+
+// newGRPCServer create grpc server of admin service, query service is registered if query api is enabled
+func newGRPCServer(s *Server, admin *AdminServer, cfg *models.Proxy) *grpc.Server {
+	a := &grpcAdmin{admin: admin}
+	gs := grpc.NewServer(grpc.UnaryInterceptor(a.intercept))
+	gaea.RegisterAdminServer(gs, a)
+	if cfg.QueryAPIEnabled {
+		gaea.RegisterQueryServer(gs, &grpcQuery{proxy: s})
+	}
+	return gs
+}
+
+// grpcAdminAccountKey is context key of authenticated admin account
+type grpcAdminAccountKey struct{}
+
+// intercept authenticate request of admin service and check it by role of method before it's handled
+func (a *grpcAdmin) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	role, ok := grpcAdminRoles[info.FullMethod]
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "unknown method")
+	}
+	account, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if role != models.AdminRoleViewer {
+		defer func() {
+			client := ""
+			if p, ok := peer.FromContext(ctx); ok {
+				client = p.Addr.String()
+			}
+			auditAdmin(account, client, "grpc "+info.FullMethod, status.Code(err).String())
+		}()
+	}
+	if !account.HasRole(role) {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return handler(context.WithValue(ctx, grpcAdminAccountKey{}, account), req)
+}
+
+// grpcBasicAuth return user and password of basic authorization in metadata
+func grpcBasicAuth(ctx context.Context) (string, string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", "", false
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(values[0], "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func (a *grpcAdmin) authenticate(ctx context.Context) (*models.AdminAccount, error) {
+	user, password, _ := grpcBasicAuth(ctx)
+	account := a.admin.accounts.check(user, password)
+	if account == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid admin user or password")
+	}
+	return account, nil
+}
+
+// checkNamespace check if namespace is in scope of account
+func (a *grpcAdmin) checkNamespace(ctx context.Context, name string) error {
+	if !ctx.Value(grpcAdminAccountKey{}).(*models.AdminAccount).CanAccess(name) {
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return nil
+}
+
+// checkGlobal check if account isn't limited to namespaces, methods of whole proxy require global account
+func (a *grpcAdmin) checkGlobal(ctx context.Context) error {
+	if !ctx.Value(grpcAdminAccountKey{}).(*models.AdminAccount).IsGlobal() {
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return nil
+}
+
+func (a *grpcAdmin) getNamespace(ctx context.Context, name string) (*Namespace, error) {
+	name = strings.TrimSpace(name)
+	if err := a.checkNamespace(ctx, name); err != nil {
+		return nil, err
+	}
+	namespace := a.admin.proxy.manager.GetNamespace(name)
+	if namespace == nil {
+		return nil, status.Error(codes.NotFound, "namespace not found")
+	}
+	return namespace, nil
+}
+
+func (a *grpcAdmin) Ping(ctx context.Context, req *emptypb.Empty) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (a *grpcAdmin) ListNamespaces(ctx context.Context, req *emptypb.Empty) (*gaea.ListNamespacesResponse, error) {
+	account := ctx.Value(grpcAdminAccountKey{}).(*models.AdminAccount)
+	names := make([]string, 0)
+	for _, name := range a.admin.proxy.manager.GetNamespaceNames() {
+		if account.CanAccess(name) {
+			names = append(names, name)
+		}
+	}
+	return &gaea.ListNamespacesResponse{Names: names}, nil
+}
+
+func (a *grpcAdmin) PrepareNamespace(ctx context.Context, req *gaea.NamespaceRequest) (*emptypb.Empty, error) {
+	name := strings.TrimSpace(req.GetName())
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing namespace name")
+	}
+	if err := a.checkNamespace(ctx, name); err != nil {
+		return nil, err
+	}
+	client := models.NewClient(a.admin.configType, a.admin.coordinatorAddr, a.admin.coordinatorUsername, a.admin.coordinatorPassword, a.admin.coordinatorRoot)
+	defer client.Close()
+	if err := a.admin.proxy.ReloadNamespacePrepare(name, client); err != nil {
+		log.Warn("prepare config of namespace: %s failed, err: %v", name, err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *grpcAdmin) CommitNamespace(ctx context.Context, req *gaea.NamespaceRequest) (*emptypb.Empty, error) {
+	name := strings.TrimSpace(req.GetName())
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing namespace name")
+	}
+	if err := a.checkNamespace(ctx, name); err != nil {
+		return nil, err
+	}
+	if err := a.admin.proxy.ReloadNamespaceCommit(name); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *grpcAdmin) DeleteNamespace(ctx context.Context, req *gaea.NamespaceRequest) (*emptypb.Empty, error) {
+	name := strings.TrimSpace(req.GetName())
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing namespace name")
+	}
+	if err := a.checkNamespace(ctx, name); err != nil {
+		return nil, err
+	}
+	if err := a.admin.proxy.DeleteNamespace(name); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (a *grpcAdmin) GetConfigFingerprint(ctx context.Context, req *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	if err := a.checkGlobal(ctx); err != nil {
+		return nil, err
+	}
+	return wrapperspb.String(a.admin.proxy.manager.ConfigFingerprint()), nil
+}
+
+// GetStats return stats of namespace in the same json format as http admin api
+func (a *grpcAdmin) GetStats(ctx context.Context, req *gaea.StatsRequest) (*gaea.StatsResponse, error) {
+	namespace, err := a.getNamespace(ctx, req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	var window time.Duration
+	if w := strings.TrimSpace(req.GetWindow()); w != "" {
+		if window, err = time.ParseDuration(w); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid window: %s", w)
+		}
+	}
+
+	var stats interface{}
+	switch typ := req.GetType(); typ {
+	case "sql_fingerprint":
+		stats = &SQLFingerprint{SlowSQL: namespace.GetSlowSQLFingerprints(), ErrorSQL: namespace.GetErrorSQLFingerprints()}
+	case "backend_sql_fingerprint":
+		stats = &SQLFingerprint{SlowSQL: namespace.GetBackendSlowSQLFingerprints(), ErrorSQL: namespace.GetBackendErrorSQLFingerprints()}
+	case "sql":
+		limit := 10
+		if req.GetLimit() != 0 {
+			limit = int(req.GetLimit())
+		}
+		stats, err = namespace.GetSQLStatsTopN(req.GetSort(), limit, window)
+	case "table":
+		if window == 0 {
+			window = time.Minute
+		}
+		stats, err = namespace.GetTableStats(window)
+	case "mirror":
+		if window == 0 {
+			window = time.Minute
+		}
+		stats, err = namespace.GetMirrorStats(window)
+	case "binlog":
+		stats, err = namespace.GetBinlogStats()
+	case "cdc":
+		stats, err = namespace.GetCDCStats()
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid stats type: %s", typ)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	v, err := jsonToValue(stats)
+	if err != nil {
+		return nil, err
+	}
+	return &gaea.StatsResponse{Stats: v}, nil
+}
+
+func (a *grpcAdmin) GetBackendConnections(ctx context.Context, req *gaea.NamespaceRequest) (*gaea.BackendConnectionsResponse, error) {
+	namespace, err := a.getNamespace(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	slices := make(map[string]*gaea.SliceBackendConnections)
+	for name, infos := range namespace.GetBackendConnections() {
+		connections := make([]*gaea.BackendConnection, 0, len(infos))
+		for _, info := range infos {
+			connections = append(connections, &gaea.BackendConnection{
+				Addr:         info.Addr,
+				ConnectionId: info.ConnectionID,
+				InUse:        info.InUse,
+				AgeMs:        info.AgeMs,
+				IdleMs:       info.IdleMs,
+				LastSql:      info.LastSQL,
+			})
+		}
+		slices[name] = &gaea.SliceBackendConnections{Connections: connections}
+	}
+	return &gaea.BackendConnectionsResponse{Slices: slices}, nil
+}
+
+func (a *grpcAdmin) SetBackendStatus(ctx context.Context, req *gaea.SetBackendStatusRequest) (*emptypb.Empty, error) {
+	namespace, err := a.getNamespace(ctx, req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	sliceName := strings.TrimSpace(req.GetSlice())
+	slice := namespace.GetSlice(sliceName)
+	if slice == nil {
+		return nil, status.Error(codes.NotFound, "slice not found")
+	}
+	addr := strings.TrimSpace(req.GetAddr())
+	if addr == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing backend addr")
+	}
+
+	offline := req.GetOffline()
+	if offline {
+		err = slice.SetOffline(addr)
+	} else {
+		err = slice.SetOnline(addr)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	log.Notice("set backend offline: %v, namespace: %s, slice: %s, addr: %s", offline, namespace.GetName(), sliceName, addr)
+	return &emptypb.Empty{}, nil
+}
+
+// jsonToValue convert v to struct value by its json, so fields are the same as http admin api
+func jsonToValue(v interface{}) (*structpb.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var i interface{}
+	if err = json.Unmarshal(data, &i); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	value, err := structpb.NewValue(i)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return value, nil
+}
+
+// Query execute sql in a new session of namespace user like http query api, results are streamed in batches
+func (q *grpcQuery) Query(req *structpb.Struct, stream gaea.Query_QueryServer) error {
+	user, password, ok := grpcBasicAuth(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, "user and password of namespace are required")
+	}
+	fields := req.GetFields()
+	ns := fields["namespace"].GetStringValue()
+	sql := fields["sql"].GetStringValue()
+	if ns == "" || strings.TrimSpace(sql) == "" {
+		return status.Error(codes.InvalidArgument, "namespace and sql are required")
+	}
+	params, err := grpcQueryParams(fields["params"].GetListValue())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if sql, err = interpolateParams(sql, params); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	clientAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		clientAddr = p.Addr.String()
+	}
+	cc := newQuerySession(q.proxy, clientAddr)
+	defer cc.Close()
+	if err := cc.login(user, password, fields["db"].GetStringValue()); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if cc.namespace != ns {
+		return status.Errorf(codes.PermissionDenied, "user %s is not allowed to access namespace %s", user, ns)
+	}
+
+	defer func() {
+		if pc := cc.continueConn; pc != nil && (pc.MoreRowsExist() || pc.MoreResultsExist()) {
+			// rows left on connection are not read as stream is broken, it can't be reused
+			pc.Close()
+		}
+		cc.executor.releaseResultMemory()
+		cc.executor.releaseQuerySlot()
+		cc.executor.recycleBackendConn(cc.continueConn)
+		cc.continueConn = nil
+	}()
+	r, err := cc.executor.handleQuery(sql)
+	if err != nil {
+		return grpcSQLError(err)
+	}
+	return q.sendResult(cc, stream, r)
+}
+
+// sendResult send columns, rows and summary of result, rows left in continueConn and more results are sent too
+func (q *grpcQuery) sendResult(cc *Session, stream gaea.Query_QueryServer, r *mysql.Result) error {
+	if r == nil {
+		return stream.Send(grpcQuerySummary(0, 0))
+	}
+	affectedRows, insertID := r.AffectedRows, r.InsertID
+	if r.Resultset == nil {
+		r.Free()
+		return stream.Send(grpcQuerySummary(affectedRows, insertID))
+	}
+
+	fields := r.Fields
+	columns := make([]*structpb.Value, 0, len(fields))
+	for _, f := range fields {
+		columns = append(columns, structpb.NewStringValue(string(f.Name)))
+	}
+	if err := stream.Send(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"columns": structpb.NewListValue(&structpb.ListValue{Values: columns}),
+	}}); err != nil {
+		r.Free()
+		return err
+	}
+	err := sendRows(stream, fields, r.RowDatas)
+	r.Free()
+	if err != nil {
+		return err
+	}
+	if pc := cc.continueConn; pc != nil {
+		for pc.MoreRowsExist() {
+			result := mysql.ResultPool.Get()
+			result.Resultset = &mysql.Resultset{Fields: fields}
+			if err = pc.FetchMoreRows(result, cc.getNamespace().GetMaxResultSize()); err != nil {
+				result.Free()
+				return grpcSQLError(err)
+			}
+			cc.executor.rewriteResultRows(result)
+			err = sendRows(stream, fields, result.RowDatas)
+			result.Free()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = stream.Send(grpcQuerySummary(affectedRows, insertID)); err != nil {
+		return err
+	}
+
+	// results of multi statements in a procedure
+	if pc := cc.continueConn; pc != nil {
+		for pc.MoreResultsExist() {
+			rs, err := pc.ReadMoreResult(cc.getNamespace().GetMaxResultSize())
+			if err != nil {
+				return grpcSQLError(err)
+			}
+			if err = q.sendResult(cc, stream, rs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendRows send rows of mysql text protocol in batches, values are strings of mysql text or null
+func sendRows(stream gaea.Query_QueryServer, fields []*mysql.Field, rows []mysql.RowData) error {
+	for start := 0; start < len(rows); start += grpcQueryBatchRows {
+		end := start + grpcQueryBatchRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := make([]*structpb.Value, 0, end-start)
+		for _, data := range rows[start:end] {
+			row := make([]*structpb.Value, 0, len(fields))
+			pos := 0
+			for range fields {
+				v, next, isNull, ok := mysql.ReadLenEncStringAsBytes(data, pos)
+				if !ok {
+					return status.Error(codes.Internal, "invalid row data")
+				}
+				pos = next
+				if isNull {
+					row = append(row, structpb.NewNullValue())
+				} else {
+					row = append(row, structpb.NewStringValue(string(v)))
+				}
+			}
+			batch = append(batch, structpb.NewListValue(&structpb.ListValue{Values: row}))
+		}
+		if err := stream.Send(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"rows": structpb.NewListValue(&structpb.ListValue{Values: batch}),
+		}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func grpcQuerySummary(affectedRows, insertID uint64) *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"affected_rows":  structpb.NewNumberValue(float64(affectedRows)),
+		"last_insert_id": structpb.NewNumberValue(float64(insertID)),
+	}}
+}
+
+// grpcQueryParams convert params to types accepted by interpolateParams, integral numbers are kept without exponent
+func grpcQueryParams(list *structpb.ListValue) ([]interface{}, error) {
+	params := make([]interface{}, 0, len(list.GetValues()))
+	for i, v := range list.GetValues() {
+		switch k := v.GetKind().(type) {
+		case *structpb.Value_NullValue:
+			params = append(params, nil)
+		case *structpb.Value_NumberValue:
+			params = append(params, json.Number(strconv.FormatFloat(k.NumberValue, 'f', -1, 64)))
+		case *structpb.Value_StringValue:
+			params = append(params, k.StringValue)
+		case *structpb.Value_BoolValue:
+			params = append(params, k.BoolValue)
+		default:
+			return nil, fmt.Errorf("unsupported type of param %d", i)
+		}
+	}
+	return params, nil
+}
+
+// grpcSQLError convert error of sql to status, mysql error code is kept in message
+func grpcSQLError(err error) error {
+	if e, ok := err.(*mysql.SQLError); ok {
+		return status.Errorf(codes.Unknown, "ERROR %d (%s): %s", e.Code, e.State, e.Message)
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	gaea "github.com/XiaoMi/Gaea/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func withBasicAuth(ctx context.Context, user, password string) context.Context {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+}
+
+func TestGRPCAPI(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &Server{}
+	accounts, _ := newAdminAccounts(&models.Proxy{AdminUser: "admin", AdminPassword: "secret"})
+	accounts.accounts["viewer"] = &models.AdminAccount{User: "viewer", Password: "v", Role: models.AdminRoleViewer, Namespaces: []string{"ns1"}}
+	admin := &AdminServer{proxy: s, accounts: accounts}
+	gs := newGRPCServer(s, admin, &models.Proxy{QueryAPIEnabled: true})
+	go gs.Serve(l)
+	defer gs.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	client := gaea.NewAdminClient(conn)
+	_, err = client.Ping(withBasicAuth(ctx, "admin", "secret"), &emptypb.Empty{})
+	assert.Nil(t, err)
+	_, err = client.Ping(withBasicAuth(ctx, "admin", "wrong"), &emptypb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Ping(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// viewer can't prepare namespace, and namespace out of its scope is denied
+	_, err = client.Ping(withBasicAuth(ctx, "viewer", "v"), &emptypb.Empty{})
+	assert.Nil(t, err)
+	_, err = client.PrepareNamespace(withBasicAuth(ctx, "viewer", "v"), &gaea.NamespaceRequest{Name: "ns1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.GetBackendConnections(withBasicAuth(ctx, "viewer", "v"), &gaea.NamespaceRequest{Name: "ns2"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.SetBackendStatus(withBasicAuth(ctx, "viewer", "v"), &gaea.SetBackendStatusRequest{Namespace: "ns1", Slice: "slice-0", Addr: "127.0.0.1:3306", Offline: true})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	// config fingerprint of whole proxy requires account not limited to namespaces
+	_, err = client.GetConfigFingerprint(withBasicAuth(ctx, "viewer", "v"), &emptypb.Empty{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// query requires user of namespace
+	req, _ := structpb.NewStruct(map[string]interface{}{"namespace": "ns", "sql": "select 1"})
+	stream, err := gaea.NewQueryClient(conn).Query(ctx, req)
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCQueryParams(t *testing.T) {
+	list, err := structpb.NewList([]interface{}{nil, 10, 1.5, "a", true})
+	assert.Nil(t, err)
+	params, err := grpcQueryParams(list)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{nil, json.Number("10"), json.Number("1.5"), "a", true}, params)
+
+	sql, err := interpolateParams("select ?, ?, ?, ?, ?", params)
+	assert.Nil(t, err)
+	assert.Equal(t, "select NULL, 10, 1.5, 'a', 1", sql)
+
+	list, _ = structpb.NewList([]interface{}{[]interface{}{1}})
+	_, err = grpcQueryParams(list)
+	assert.NotNil(t, err)
+}
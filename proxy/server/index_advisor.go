@@ -0,0 +1,418 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/parser/format"
+	"github.com/XiaoMi/Gaea/parser/model"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+const (
+	indexAdvisorMaxAdvices  = 1024 // fingerprints whose indexes are learned
+	indexAdvisorMinBaseline = 3    // plans using the same index before it's learned as baseline
+)
+
+// status of IndexAdvice
+const (
+	IndexAdviceLearning = "learning" // baseline index is not learned yet
+	IndexAdviceStable   = "stable"   // latest plan uses baseline index
+	IndexAdvicePending  = "pending"  // latest plan regressed, hint of baseline index waits for approval
+	IndexAdviceApproved = "approved" // hint is injected into sqls of the fingerprint
+)
+
+// IndexAdvice learned index and proposed hint of a sql fingerprint
+type IndexAdvice struct {
+	MD5           string `json:"md5"`
+	Fingerprint   string `json:"fingerprint"`
+	Table         string `json:"table"`          // table in plan, alias of table if it's aliased
+	BaselineIndex string `json:"baseline_index"` // index used by most plans, empty if it's not learned
+	CurrentIndex  string `json:"current_index"`  // index used by latest plan, empty means no index is used
+	Hint          string `json:"hint"`           // proposed or approved hint
+	Status        string `json:"status"`
+	ExplainTime   string `json:"explain_time"`
+}
+
+// indexSample backend sql of a fingerprint, it's explained on the same slice and db
+type indexSample struct {
+	slice string
+	db    string
+	sql   string
+}
+
+type indexAdvice struct {
+	fingerprint string
+	table       string
+	counts      map[string]int // key: index used by plans
+	current     string
+	status      string
+	explainTime time.Time
+}
+
+// baseline return index used by most plans, it's empty until some index is used by enough plans
+func (a *indexAdvice) baseline() string {
+	var ret string
+	for index, count := range a.counts {
+		if count >= indexAdvisorMinBaseline && (count > a.counts[ret] || count == a.counts[ret] && index < ret) {
+			ret = index
+		}
+	}
+	return ret
+}
+
+func (a *indexAdvice) hint() string {
+	if a.status != IndexAdvicePending && a.status != IndexAdviceApproved {
+		return ""
+	}
+	return "FORCE INDEX(`" + a.baseline() + "`)"
+}
+
+// indexHint approved hint, it's injected into single table select of the table
+type indexHint struct {
+	table string
+	index string
+}
+
+// indexAdvisor explain sqls of top fingerprints by total latency periodically to learn indexes used by them.
+// When the plan of a fingerprint no longer uses the learned index, FORCE INDEX of it is proposed, and it's
+// injected into sqls of the fingerprint after approved by admin api.
+type indexAdvisor struct {
+	namespace string
+	interval  time.Duration
+	topN      int
+	stats     func(n int, window time.Duration) ([]*SQLStats, error)
+	explain   func(slice, db, sql string) (*mysql.Result, error)
+
+	lock      sync.RWMutex
+	wanted    map[string]bool         // fingerprints to be sampled, key: md5 of fingerprint
+	samples   map[string]*indexSample // key: md5 of fingerprint
+	advices   map[string]*indexAdvice // key: md5 of fingerprint
+	hints     map[string]*indexHint   // approved hints, key: md5 of fingerprint
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newIndexAdvisor(namespace string, interval time.Duration, topN int,
+	stats func(n int, window time.Duration) ([]*SQLStats, error), explain func(slice, db, sql string) (*mysql.Result, error)) *indexAdvisor {
+	return &indexAdvisor{
+		namespace: namespace,
+		interval:  interval,
+		topN:      topN,
+		stats:     stats,
+		explain:   explain,
+		wanted:    make(map[string]bool),
+		samples:   make(map[string]*indexSample),
+		advices:   make(map[string]*indexAdvice),
+		hints:     make(map[string]*indexHint),
+		done:      make(chan struct{}),
+	}
+}
+
+// inherit keep learned indexes and approved hints of advisor of old namespace
+func (a *indexAdvisor) inherit(old *indexAdvisor) {
+	if old == nil {
+		return
+	}
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for md5, advice := range old.advices {
+		copied := *advice
+		copied.counts = make(map[string]int, len(advice.counts))
+		for index, count := range advice.counts {
+			copied.counts[index] = count
+		}
+		a.advices[md5] = &copied
+	}
+	for md5, hint := range old.hints {
+		a.hints[md5] = hint
+	}
+}
+
+func (a *indexAdvisor) run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.advise(now)
+		}
+	}
+}
+
+// sample keep backend sql of fingerprint if it's wanted by next round of explaining
+func (a *indexAdvisor) sample(md5, slice, db, sql string) {
+	a.lock.RLock()
+	wanted := a.wanted[md5]
+	a.lock.RUnlock()
+	if !wanted {
+		return
+	}
+	a.lock.Lock()
+	if a.wanted[md5] {
+		delete(a.wanted, md5)
+		a.samples[md5] = &indexSample{slice: slice, db: db, sql: sql}
+	}
+	a.lock.Unlock()
+}
+
+// advise explain samples of last round, and choose fingerprints to be sampled in next round
+func (a *indexAdvisor) advise(now time.Time) {
+	window := a.interval
+	if window > sqlStatsWindowMinutes*time.Minute {
+		window = sqlStatsWindowMinutes * time.Minute
+	}
+	stats, err := a.stats(a.topN, window)
+	if err != nil {
+		log.Warn("[ns:%s] get sql stats of index advisor failed, %v", a.namespace, err)
+		return
+	}
+	fingerprints := make(map[string]string, len(stats))
+	for _, s := range stats {
+		fingerprints[s.MD5] = s.Fingerprint
+	}
+
+	a.lock.Lock()
+	samples := a.samples
+	a.samples = make(map[string]*indexSample)
+	a.wanted = make(map[string]bool, len(stats))
+	for md5 := range fingerprints {
+		a.wanted[md5] = true
+	}
+	a.lock.Unlock()
+
+	for md5, s := range samples {
+		fingerprint, ok := fingerprints[md5]
+		if !ok {
+			continue
+		}
+		table, index, ok, err := a.explainSample(s)
+		if err != nil {
+			log.Warn("[ns:%s] explain sql of index advisor failed, slice: %s, db: %s, sql: %s, err: %v", a.namespace, s.slice, s.db, s.sql, err)
+			continue
+		}
+		if ok {
+			a.update(md5, fingerprint, table, index, now)
+		}
+	}
+}
+
+// explainSample return table and index in plan of sample, ok is false if it's not a plan of single table
+func (a *indexAdvisor) explainSample(s *indexSample) (table string, index string, ok bool, err error) {
+	r, err := a.explain(s.slice, s.db, "EXPLAIN "+s.sql)
+	if err != nil {
+		return "", "", false, err
+	}
+	if r == nil || r.Resultset == nil || r.RowNumber() != 1 {
+		return "", "", false, nil
+	}
+	if table, err = r.GetStringByName(0, "table"); err != nil {
+		return "", "", false, err
+	}
+	if index, err = r.GetStringByName(0, "key"); err != nil {
+		return "", "", false, err
+	}
+	if table == "" || strings.HasPrefix(table, "<") {
+		// derived table or union result
+		return "", "", false, nil
+	}
+	// values may refer to buffer of the connection
+	return trimShardTableSuffix(strings.ToLower(string([]byte(table)))), string([]byte(index)), true, nil
+}
+
+func (a *indexAdvisor) update(md5, fingerprint, table, index string, now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	advice, ok := a.advices[md5]
+	if !ok || advice.table != table {
+		if !ok && len(a.advices) >= indexAdvisorMaxAdvices {
+			return
+		}
+		advice = &indexAdvice{fingerprint: fingerprint, table: table, counts: make(map[string]int)}
+		a.advices[md5] = advice
+		delete(a.hints, md5)
+	}
+	advice.current = index
+	advice.explainTime = now
+	if advice.status == IndexAdviceApproved {
+		return
+	}
+
+	baseline := advice.baseline()
+	switch {
+	case baseline == "":
+		if index != "" {
+			advice.counts[index]++
+		}
+		advice.status = IndexAdviceLearning
+		if advice.baseline() != "" {
+			advice.status = IndexAdviceStable
+		}
+	case index == baseline:
+		advice.counts[index]++
+		advice.status = IndexAdviceStable
+	default:
+		// plans regressed are not counted, otherwise the regressed index would be learned as baseline
+		if advice.status != IndexAdvicePending {
+			log.Notice("[ns:%s] plan of sql regressed, fingerprint: %s, baseline index: %s, current index: %s", a.namespace, fingerprint, baseline, index)
+		}
+		advice.status = IndexAdvicePending
+	}
+}
+
+// approve inject proposed hint of fingerprint into its sqls
+func (a *indexAdvisor) approve(md5 string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	advice, ok := a.advices[md5]
+	if !ok {
+		return fmt.Errorf("index advice of %s not found", md5)
+	}
+	if advice.status != IndexAdvicePending {
+		return fmt.Errorf("index advice of %s is %s, only pending advice can be approved", md5, advice.status)
+	}
+	advice.status = IndexAdviceApproved
+	a.hints[md5] = &indexHint{table: advice.table, index: advice.baseline()}
+	return nil
+}
+
+// remove drop hint and learned index of fingerprint, its index is learned again
+func (a *indexAdvisor) remove(md5 string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, ok := a.advices[md5]
+	delete(a.advices, md5)
+	delete(a.hints, md5)
+	return ok
+}
+
+func (a *indexAdvisor) getHint(md5 string) (*indexHint, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	h, ok := a.hints[md5]
+	return h, ok
+}
+
+// list return advices ordered by md5 of fingerprint
+func (a *indexAdvisor) list() []*IndexAdvice {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	ret := make([]*IndexAdvice, 0, len(a.advices))
+	for md5, advice := range a.advices {
+		ret = append(ret, &IndexAdvice{
+			MD5:           md5,
+			Fingerprint:   advice.fingerprint,
+			Table:         advice.table,
+			BaselineIndex: advice.baseline(),
+			CurrentIndex:  advice.current,
+			Hint:          advice.hint(),
+			Status:        advice.status,
+			ExplainTime:   advice.explainTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].MD5 < ret[j].MD5
+	})
+	return ret
+}
+
+func (a *indexAdvisor) close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+	})
+}
+
+// sampleIndexAdvisor keep backend sql of select for index advisor
+func (se *SessionExecutor) sampleIndexAdvisor(reqCtx *util.RequestContext, slice, db, sql string) {
+	ns := se.GetNamespace()
+	if ns.indexAdvisor == nil || reqCtx.GetStmtType() != parser.StmtSelect || reqCtx.GetFingerprintMD5() == "" {
+		return
+	}
+	ns.indexAdvisor.sample(reqCtx.GetFingerprintMD5(), slice, db, sql)
+}
+
+// anySQL return one of sqls to be executed on slices
+func anySQL(sqls map[string]map[string][]string) (slice, db, sql string, ok bool) {
+	for slice, dbSQLs := range sqls {
+		for db, ss := range dbSQLs {
+			if len(ss) > 0 {
+				return slice, db, ss[0], true
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+// injectIndexHint add approved FORCE INDEX to single table select, sqls which already have index hints are kept
+func (se *SessionExecutor) injectIndexHint(reqCtx *util.RequestContext, sql string) string {
+	ns := se.GetNamespace()
+	if ns.indexAdvisor == nil || reqCtx.GetStmtType() != parser.StmtSelect {
+		return sql
+	}
+	h, ok := ns.indexAdvisor.getHint(reqCtx.GetFingerprintMD5())
+	if !ok {
+		return sql
+	}
+
+	query, comments := parser.SplitMarginComments(sql)
+	stmt, err := se.Parse(query)
+	if err != nil {
+		return sql
+	}
+	s, ok := stmt.(*ast.SelectStmt)
+	if !ok || s.From == nil || s.From.TableRefs == nil || s.From.TableRefs.Right != nil {
+		return sql
+	}
+	ts, ok := s.From.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return sql
+	}
+	tn, ok := ts.Source.(*ast.TableName)
+	if !ok || len(tn.IndexHints) > 0 {
+		return sql
+	}
+	table := tn.Name.L
+	if ts.AsName.L != "" {
+		table = ts.AsName.L
+	}
+	if table != h.table {
+		return sql
+	}
+
+	tn.IndexHints = append(tn.IndexHints, &ast.IndexHint{
+		IndexNames: []model.CIStr{model.NewCIStr(h.index)},
+		HintType:   ast.HintForce,
+		HintScope:  ast.HintForScan,
+	})
+	sb := &strings.Builder{}
+	if err := stmt.Restore(format.NewRestoreCtx(format.EscapeRestoreFlags, sb)); err != nil {
+		log.Warn("[ns:%s] restore sql with index hint error, sql: %s, err: %v", ns.GetName(), ns.redactLogSQL(sql), err)
+		return sql
+	}
+	return comments.Leading + sb.String() + comments.Trailing
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIndexAdvisor(t *testing.T, key *string) *indexAdvisor {
+	stats := func(n int, window time.Duration) ([]*SQLStats, error) {
+		return []*SQLStats{{MD5: "m1", Fingerprint: "select * from t where a = ?"}}, nil
+	}
+	explain := func(slice, db, sql string) (*mysql.Result, error) {
+		require.Equal(t, "slice-0", slice)
+		require.Equal(t, "db_0", db)
+		require.Equal(t, "EXPLAIN select * from t_0001 where a = 1", sql)
+		fields := []*mysql.Field{{Name: []byte("id")}, {Name: []byte("table")}, {Name: []byte("key")}}
+		rs, err := mysql.BuildResultset(fields, []string{"id", "table", "key"}, [][]interface{}{{int64(1), "t_0001", *key}})
+		require.NoError(t, err)
+		return &mysql.Result{Resultset: rs}, nil
+	}
+	return newIndexAdvisor("test", time.Minute, 10, stats, explain)
+}
+
+// round sample and explain sql of fingerprint once
+func adviseRound(a *indexAdvisor) {
+	a.sample("m1", "slice-0", "db_0", "select * from t_0001 where a = 1")
+	a.advise(time.Now())
+}
+
+func TestIndexAdvisorLearnAndApprove(t *testing.T) {
+	key := "idx_a"
+	a := newTestIndexAdvisor(t, &key)
+
+	// nothing is wanted before the first round
+	a.sample("m1", "slice-0", "db_0", "select * from t_0001 where a = 1")
+	a.advise(time.Now())
+	require.Empty(t, a.list())
+
+	for i := 0; i < indexAdvisorMinBaseline-1; i++ {
+		adviseRound(a)
+	}
+	advices := a.list()
+	require.Len(t, advices, 1)
+	require.Equal(t, IndexAdviceLearning, advices[0].Status)
+	require.Equal(t, "t", advices[0].Table)
+	require.Equal(t, "", advices[0].BaselineIndex)
+
+	adviseRound(a)
+	advices = a.list()
+	require.Equal(t, IndexAdviceStable, advices[0].Status)
+	require.Equal(t, "idx_a", advices[0].BaselineIndex)
+	require.Error(t, a.approve("m1"))
+
+	// full scan is a regression, it's not learned
+	key = ""
+	adviseRound(a)
+	adviseRound(a)
+	advices = a.list()
+	require.Equal(t, IndexAdvicePending, advices[0].Status)
+	require.Equal(t, "idx_a", advices[0].BaselineIndex)
+	require.Equal(t, "", advices[0].CurrentIndex)
+	require.Equal(t, "FORCE INDEX(`idx_a`)", advices[0].Hint)
+	_, ok := a.getHint("m1")
+	require.False(t, ok)
+
+	require.NoError(t, a.approve("m1"))
+	h, ok := a.getHint("m1")
+	require.True(t, ok)
+	require.Equal(t, &indexHint{table: "t", index: "idx_a"}, h)
+
+	// approved hints and learned indexes are kept after reload
+	b := newTestIndexAdvisor(t, &key)
+	b.inherit(a)
+	require.Equal(t, a.list(), b.list())
+	_, ok = b.getHint("m1")
+	require.True(t, ok)
+
+	require.True(t, b.remove("m1"))
+	require.False(t, b.remove("m1"))
+	_, ok = b.getHint("m1")
+	require.False(t, ok)
+	require.Empty(t, b.list())
+}
+
+func TestIndexAdvisorRegressionResolved(t *testing.T) {
+	key := "idx_a"
+	a := newTestIndexAdvisor(t, &key)
+	a.advise(time.Now())
+	for i := 0; i < indexAdvisorMinBaseline; i++ {
+		adviseRound(a)
+	}
+	key = "idx_b"
+	adviseRound(a)
+	require.Equal(t, IndexAdvicePending, a.list()[0].Status)
+	key = "idx_a"
+	adviseRound(a)
+	require.Equal(t, IndexAdviceStable, a.list()[0].Status)
+	require.Equal(t, "", a.list()[0].Hint)
+}
+
+func TestInjectIndexHint(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.SQLStatsCapacity = 10
+		ns.IndexAdvisor = &models.IndexAdvisor{Interval: 3600}
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, modifyDefaultNamespace(func(ns *models.Namespace) {}, localManager))
+	}()
+	a := se.GetNamespace().indexAdvisor
+	require.NotNil(t, a)
+	a.hints["m1"] = &indexHint{table: "tbl_ks", index: "idx_a"}
+	a.hints["m2"] = &indexHint{table: "t", index: "idx_b"}
+
+	tests := []struct {
+		md5    string
+		sql    string
+		expect string
+	}{
+		{"m1", "/* app */ select * from tbl_ks where a = 1", "/* app */ SELECT * FROM `tbl_ks` FORCE INDEX (`idx_a`) WHERE `a`=1"},
+		{"m2", "select * from tbl_ks as t where a = 1", "SELECT * FROM `tbl_ks` AS `t` FORCE INDEX (`idx_b`) WHERE `a`=1"},
+		{"m1", "select * from tbl_ks use index(idx_b) where a = 1", "select * from tbl_ks use index(idx_b) where a = 1"},
+		{"m1", "select * from tbl_ks t join tbl_ks2 t2 on t.id = t2.id", "select * from tbl_ks t join tbl_ks2 t2 on t.id = t2.id"},
+		{"m2", "select * from tbl_ks where a = 1", "select * from tbl_ks where a = 1"},
+		{"m3", "select * from tbl_ks where a = 1", "select * from tbl_ks where a = 1"},
+	}
+	for _, tt := range tests {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.StmtSelect)
+		reqCtx.SetFingerprintMD5(tt.md5)
+		require.Equal(t, tt.expect, se.injectIndexHint(reqCtx, tt.sql), tt.sql)
+	}
+}
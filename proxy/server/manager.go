@@ -35,12 +35,15 @@ import (
 
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/log/capture"
+	"github.com/XiaoMi/Gaea/log/slowlog"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/stats"
 	"github.com/XiaoMi/Gaea/stats/prometheus"
 	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/keystore"
 	"github.com/XiaoMi/Gaea/util/sync2"
 	"github.com/shirou/gopsutil/process"
 )
@@ -61,6 +64,14 @@ const (
 
 // LoadAndCreateManager load namespace config, and create manager
 func LoadAndCreateManager(cfg *models.Proxy) (*Manager, error) {
+	// keys of encrypt columns are loaded when namespace created
+	if err := keystore.Init(cfg.EncryptKeyProvider, cfg.EncryptKeyFile, cfg.VaultAddr, cfg.VaultToken, cfg.EncryptKeyVaultPath); err != nil {
+		log.Warn("init key provider failed, %v", err)
+		return nil, err
+	}
+	// secret uri in slice config is resolved when namespace created
+	models.InitSecretProviders(cfg)
+
 	namespaceConfigs, err := loadAllNamespace(cfg)
 	if err != nil {
 		log.Warn("init namespace manager failed, %v", err)
@@ -175,6 +186,7 @@ func CreateManager(cfg *models.Proxy, namespaceConfigs map[string]*models.Namesp
 	current, _, _ := m.switchIndex.Get()
 
 	// init namespace
+	slowLogDir.Set(cfg.LogPath)
 	m.namespaces[current] = CreateNamespaceManager(namespaceConfigs)
 
 	// init user
@@ -248,10 +260,12 @@ func (m *Manager) ReloadNamespaceCommit(name string) error {
 		return err
 	}
 
-	current, _, index := m.switchIndex.Get()
+	current, other, index := m.switchIndex.Get()
 
 	currentNamespace := m.namespaces[current].GetNamespace(name)
 	if currentNamespace != nil {
+		// slices reused by new namespace keep alive
+		currentNamespace.retainSlices(m.namespaces[other].GetNamespace(name))
 		go currentNamespace.Close(true)
 	}
 
@@ -297,6 +311,27 @@ func (m *Manager) GetNamespace(name string) *Namespace {
 	return m.namespaces[current].GetNamespace(name)
 }
 
+// GetNamespaceNames return sorted names of namespaces
+func (m *Manager) GetNamespaceNames() []string {
+	current, _, _ := m.switchIndex.Get()
+	names := make([]string, 0, len(m.namespaces[current].GetNamespaces()))
+	for name := range m.namespaces[current].GetNamespaces() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetNamespaceVersions return config versions of namespaces, key: namespace name
+func (m *Manager) GetNamespaceVersions() map[string]string {
+	current, _, _ := m.switchIndex.Get()
+	versions := make(map[string]string, len(m.namespaces[current].GetNamespaces()))
+	for name, namespace := range m.namespaces[current].GetNamespaces() {
+		versions[name] = namespace.GetVersion()
+	}
+	return versions
+}
+
 // CheckUser check if user in users
 func (m *Manager) CheckUser(user string) bool {
 	current, _, _ := m.switchIndex.Get()
@@ -315,12 +350,33 @@ func (m *Manager) CheckHashPassword(user string, salt, auth []byte) (bool, strin
 	return m.users[current].CheckHashPassword(user, salt, auth)
 }
 
+// CheckNativePassword check mysql_native_password auth response, both hashed and plain passwords in config are supported
+func (m *Manager) CheckNativePassword(user string, salt, auth []byte) (bool, string) {
+	if succ, matched := m.CheckHashPassword(user, salt, auth); succ {
+		return true, matched
+	}
+	return m.CheckPassword(user, salt, auth)
+}
+
 // CheckPassword check if right password with specific user
 func (m *Manager) CheckSha2Password(user string, salt, auth []byte) (bool, string) {
 	current, _, _ := m.switchIndex.Get()
 	return m.users[current].CheckSha2Password(user, salt, auth)
 }
 
+// CheckPlainPassword check cleartext password of user from clients not speaking mysql protocol,
+// it's checked as mysql_native_password and caching_sha2_password with random salt, so hashed passwords in config are supported
+func (m *Manager) CheckPlainPassword(user, password string) (bool, string) {
+	salt, err := mysql.RandomBuf(20)
+	if err != nil {
+		return false, ""
+	}
+	if succ, matched := m.CheckNativePassword(user, salt, mysql.CalcPassword(salt, []byte(password))); succ {
+		return true, matched
+	}
+	return m.CheckSha2Password(user, salt, mysql.CalcCachingSha2Password(salt, password))
+}
+
 // GetStatisticManager return proxy status to record status
 func (m *Manager) GetStatisticManager() *StatisticManager {
 	return m.statistics
@@ -343,7 +399,8 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 	namespace := se.namespace
 	ns := m.GetNamespace(namespace)
 	if ns == nil {
-		log.Warn("record session SQL metrics error, namespace: %s, sql: %s, err: %s", namespace, sql, "namespace not found")
+		// log_sql_fingerprint is unknown without namespace, so only fingerprint is logged
+		log.Warn("record session SQL metrics error, namespace: %s, sql: %s, err: %s", namespace, mysql.GetFingerprint(sql), "namespace not found")
 		return
 	}
 
@@ -363,30 +420,82 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 
 	durationFloat := float64(time.Since(startTime).Microseconds()) / 1000.0
 
+	// record execution stats of sql fingerprint
+	if ns.sqlStats != nil && !(err != nil && err.Error() == mysql.ErrClientQpsLimitedMsg) {
+		rows := uint64(reqCtx.GetRowsSent()) + reqCtx.GetRowsAffected()
+		ns.sqlStats.Record(getSQLFingerprintMd5(reqCtx, sql), getSQLFingerprint(reqCtx, sql), durationFloat, rows, err != nil)
+	}
+
+	// record read and write stats of logical tables
+	if ns.tableStats != nil && len(reqCtx.GetTables()) > 0 {
+		if op, ok := tableStatsOperation(reqCtx.GetStmtType()); ok {
+			rows := uint64(reqCtx.GetRowsSent()) + reqCtx.GetRowsAffected()
+			for _, table := range reqCtx.GetTables() {
+				ns.tableStats.Record(table, op == tableStatsWrite, durationFloat, rows, err != nil)
+				m.statistics.recordTableSQLTiming(namespace, table, op, startTime)
+			}
+		}
+	}
+
 	if err == nil {
-		se.manager.statistics.generalLogger.Notice("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
-			SQLExecStatusOk, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
-			se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), sql)
+		// successful statements not sampled or filtered out by general log config are not logged
+		if ns.generalLogFilter.shouldLog(reqCtx, se.user, sql) && !m.statistics.writeSQLLogFields(false, newSQLLogEntry(se, SQLExecStatusOk, durationFloat, ns.redactLogSQL(sql), nil)) {
+			se.manager.statistics.generalLogger.Notice("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
+				SQLExecStatusOk, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
+				se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), ns.redactLogSQL(sql))
+		}
 	} else {
 		// record error sql
-		se.manager.statistics.generalLogger.Warn("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
-			SQLExecStatusErr, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
-			se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), sql, err)
+		if !m.statistics.writeSQLLogFields(true, newSQLLogEntry(se, SQLExecStatusErr, durationFloat, ns.redactLogSQL(sql), ns.redactLogError(err))) {
+			se.manager.statistics.generalLogger.Warn("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v. err:%s",
+				SQLExecStatusErr, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
+				se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), ns.redactLogSQL(sql), ns.redactLogError(err))
+		}
 		fingerprint := getSQLFingerprint(reqCtx, sql)
 		md5 := getSQLFingerprintMd5(reqCtx, sql)
 		ns.SetErrorSQLFingerprint(md5, fingerprint)
 		m.statistics.recordSessionErrorSQLFingerprint(namespace, operation, md5)
 	}
 
+	// record statement to capture file for replay
+	if ns.captureWriter != nil {
+		ns.writeCapture(&capture.Record{
+			StartTime:    startTime,
+			Duration:     time.Since(startTime),
+			ConnectionID: se.session.c.GetConnectionID(),
+			Failed:       err != nil,
+			User:         se.user,
+			ClientAddr:   se.clientAddr,
+			DB:           se.db,
+			SQL:          sql,
+		})
+	}
+
 	// record slow sql, only durationFloat > slowSQLTime will be recorded
 	if ns.getSessionSlowSQLTime() > 0 && int64(durationFloat) > ns.getSessionSlowSQLTime() {
-		se.manager.statistics.generalLogger.Warn("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
-			SQLExecStatusSlow, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
-			se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), sql)
+		if !m.statistics.writeSQLLogFields(true, newSQLLogEntry(se, SQLExecStatusSlow, durationFloat, ns.redactLogSQL(sql), nil)) {
+			se.manager.statistics.generalLogger.Warn("%s - %.1fms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
+				SQLExecStatusSlow, durationFloat, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
+				se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), ns.redactLogSQL(sql))
+		}
+		ns.writeSlowLog(&slowlog.Entry{
+			StartTime:    startTime,
+			QueryTime:    time.Since(startTime),
+			User:         se.user,
+			ClientAddr:   se.clientAddr,
+			ConnectionID: se.session.c.GetConnectionID(),
+			DB:           se.db,
+			RowsSent:     reqCtx.GetRowsSent(),
+			RowsAffected: reqCtx.GetRowsAffected(),
+			SQL:          ns.redactLogSQL(sql),
+		})
 		fingerprint := getSQLFingerprint(reqCtx, sql)
 		md5 := getSQLFingerprintMd5(reqCtx, sql)
 		ns.SetSlowSQLFingerprint(md5, fingerprint)
 		m.statistics.recordSessionSlowSQLFingerprint(namespace, md5)
+		if ns.slowSQLExplainer != nil {
+			ns.slowSQLExplainer.collect(reqCtx, md5, fingerprint)
+		}
 	}
 }
 
@@ -394,7 +503,7 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, se *SessionExecutor, sliceName, sql, backendAddr string, startTime time.Time, err error) {
 	ns := m.GetNamespace(se.namespace)
 	if ns == nil {
-		log.Warn("record backend SQL metrics error, namespace: %s, backend addr: %s, sql: %s, err: %s", se.namespace, backendAddr, sql, "namespace not found")
+		log.Warn("record backend SQL metrics error, namespace: %s, backend addr: %s, sql: %s, err: %s", se.namespace, backendAddr, mysql.GetFingerprint(sql), "namespace not found")
 		return
 	}
 
@@ -410,12 +519,18 @@ func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 	// record sql timing
 	go m.statistics.recordBackendSQLTiming(se.namespace, operation, sliceName, backendAddr, startTime)
 
+	if slice := ns.GetSlice(sliceName); slice != nil {
+		slice.RecordBackendResult(backendAddr, time.Since(startTime), err)
+	}
+
 	// record backend slow sql
 	duration := time.Since(startTime).Milliseconds()
 	if m.statistics.isBackendSlowSQL(duration) {
-		m.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
-			SQLBackendExecStatusSlow, duration, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
-			se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), sql)
+		if !m.statistics.writeSQLLogFields(true, newSQLLogEntry(se, SQLBackendExecStatusSlow, float64(duration), ns.redactLogSQL(sql), nil)) {
+			m.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v",
+				SQLBackendExecStatusSlow, duration, se.namespace, se.user, se.clientAddr, se.backendAddr, se.db,
+				se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), ns.redactLogSQL(sql))
+		}
 		fingerprint := getSQLFingerprint(reqCtx, sql)
 		md5 := getSQLFingerprintMd5(reqCtx, sql)
 		ns.SetBackendSlowSQLFingerprint(md5, fingerprint)
@@ -424,9 +539,11 @@ func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 
 	// record backend error sql
 	if err != nil {
-		m.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v, error: %v",
-			SQLBackendExecStatusErr, duration, se.user, se.namespace, se.clientAddr, se.backendAddr, se.db,
-			se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), sql, err)
+		if !m.statistics.writeSQLLogFields(true, newSQLLogEntry(se, SQLBackendExecStatusErr, float64(duration), ns.redactLogSQL(sql), ns.redactLogError(err))) {
+			m.statistics.generalLogger.Warn("%s - %dms - ns=%s, %s@%s->%s/%s, connect_id=%d, mysql_connect_id=%d, transaction=%t|%v, error: %v",
+				SQLBackendExecStatusErr, duration, se.user, se.namespace, se.clientAddr, se.backendAddr, se.db,
+				se.session.c.GetConnectionID(), se.backendConnectionId, se.isInTransaction(), ns.redactLogSQL(sql), ns.redactLogError(err))
+		}
 		fingerprint := getSQLFingerprint(reqCtx, sql)
 		md5 := getSQLFingerprintMd5(reqCtx, sql)
 		ns.SetBackendErrorSQLFingerprint(md5, fingerprint)
@@ -434,6 +551,80 @@ func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 	}
 }
 
+// sqlLogEntry is one line of sql log, used by json format
+type sqlLogEntry struct {
+	status        string
+	namespace     string
+	user          string
+	client        string
+	backend       string
+	db            string
+	program       string
+	connID        uint32
+	mysqlConnID   int64
+	inTransaction bool
+	latencyMs     float64
+	sql           string
+	err           error
+}
+
+func newSQLLogEntry(se *SessionExecutor, status string, latencyMs float64, sql string, err error) *sqlLogEntry {
+	return &sqlLogEntry{
+		status:        status,
+		namespace:     se.namespace,
+		user:          se.user,
+		client:        se.clientAddr,
+		backend:       se.backendAddr,
+		db:            se.db,
+		program:       se.getProgramName(),
+		connID:        se.session.c.GetConnectionID(),
+		mysqlConnID:   se.backendConnectionId,
+		inTransaction: se.isInTransaction(),
+		latencyMs:     latencyMs,
+		sql:           sql,
+		err:           err,
+	}
+}
+
+func (e *sqlLogEntry) fields() []log.Field {
+	fields := []log.Field{
+		{Key: "ns", Value: e.namespace},
+		{Key: "user", Value: e.user},
+		{Key: "client", Value: e.client},
+		{Key: "backend", Value: e.backend},
+		{Key: "db", Value: e.db},
+		{Key: "conn_id", Value: e.connID},
+		{Key: "mysql_conn_id", Value: e.mysqlConnID},
+		{Key: "transaction", Value: e.inTransaction},
+		{Key: "latency_ms", Value: e.latencyMs},
+		{Key: "sql", Value: e.sql},
+	}
+	if e.program != "" {
+		fields = append(fields, log.Field{Key: "program", Value: e.program})
+	}
+	if e.err != nil {
+		fields = append(fields, log.Field{Key: "error", Value: e.err.Error()})
+	}
+	return fields
+}
+
+// writeSQLLogFields write sql log with structured fields, return false if sql log is not in json format
+func (s *StatisticManager) writeSQLLogFields(warn bool, entry *sqlLogEntry) bool {
+	if !s.generalLogJSON {
+		return false
+	}
+	fl, ok := s.generalLogger.(log.FieldsLogger)
+	if !ok {
+		return false
+	}
+	if warn {
+		fl.WarnFields(entry.status, entry.fields()...)
+	} else {
+		fl.NoticeFields(entry.status, entry.fields()...)
+	}
+	return true
+}
+
 func (m *Manager) startConnectPoolMetricsTask(interval int) {
 	current, _, _ := m.switchIndex.Get()
 	for _, ns := range m.namespaces[current].namespaces {
@@ -489,6 +680,8 @@ func (m *Manager) recordBackendConnectPoolMetrics(namespace string) {
 		}
 	}
 
+	m.statistics.recordNamespaceBudget(namespace, ns.budget.memory.Get(), ns.budget.concurrency.Get())
+
 	for sliceName, slice := range ns.slices {
 		m.statistics.recordInstanceDownCount(namespace, sliceName, slice.Master.ConnPool[0].Addr(), getStatusDownCounts(slice.Master.StatusMap, 0), MasterRole)
 		m.statistics.recordConnectPoolInuseCount(namespace, sliceName, slice.Master.ConnPool[0].Addr(), slice.Master.ConnPool[0].InUse(), MasterRole)
@@ -504,6 +697,9 @@ func (m *Manager) recordBackendConnectPoolMetrics(namespace string) {
 			m.statistics.recordConnectPoolWaitCount(namespace, sliceName, slave.Addr(), slave.WaitCount(), SlaveRole)
 			m.statistics.recordConnectPoolActiveCount(namespace, sliceName, slave.Addr(), slave.Active(), SlaveRole)
 			m.statistics.recordConnectPoolCount(namespace, sliceName, slave.Addr(), slave.Capacity(), SlaveRole)
+			if lag, ok := slice.GetHeartbeatLag(slave.Addr()); ok {
+				m.statistics.recordHeartbeatLag(namespace, sliceName, slave.Addr(), lag, SlaveRole)
+			}
 		}
 		for i, statisticSlave := range slice.StatisticSlave.ConnPool {
 			m.statistics.recordInstanceDownCount(namespace, sliceName, statisticSlave.Addr(), getStatusDownCounts(slice.StatisticSlave.StatusMap, i), StatisticSlaveRole)
@@ -512,6 +708,9 @@ func (m *Manager) recordBackendConnectPoolMetrics(namespace string) {
 			m.statistics.recordConnectPoolWaitCount(namespace, sliceName, statisticSlave.Addr(), statisticSlave.WaitCount(), StatisticSlaveRole)
 			m.statistics.recordConnectPoolActiveCount(namespace, sliceName, statisticSlave.Addr(), statisticSlave.Active(), StatisticSlaveRole)
 			m.statistics.recordConnectPoolCount(namespace, sliceName, statisticSlave.Addr(), statisticSlave.Capacity(), StatisticSlaveRole)
+			if lag, ok := slice.GetHeartbeatLag(statisticSlave.Addr()); ok {
+				m.statistics.recordHeartbeatLag(namespace, sliceName, statisticSlave.Addr(), lag, StatisticSlaveRole)
+			}
 		}
 	}
 }
@@ -563,7 +762,8 @@ func (n *NamespaceManager) RebuildNamespace(config *models.Namespace) error {
 	if err != nil {
 		log.Fatal("get local proxy datacenter err:%s", err)
 	}
-	namespace, err := NewNamespace(config, proxyDatacenter)
+	// unchanged slices of current namespace are reused
+	namespace, err := newNamespace(config, proxyDatacenter, n.namespaces[config.Name])
 	if err != nil {
 		log.Warn("create namespace %s failed, err: %v", config.Name, err)
 		return err
@@ -687,6 +887,9 @@ func (u *UserManager) CheckUser(user string) bool {
 // CheckPassword check if right password with specific user
 func (u *UserManager) CheckPassword(user string, salt, auth []byte) (bool, string) {
 	for _, password := range u.users[user] {
+		if isHashedPassword(password) {
+			continue
+		}
 		checkAuth := mysql.CalcPassword(salt, []byte(password))
 		if bytes.Equal(auth, checkAuth) {
 			return true, password
@@ -698,7 +901,7 @@ func (u *UserManager) CheckPassword(user string, salt, auth []byte) (bool, strin
 // CheckHashPassword check encrypt password with specific user
 func (u *UserManager) CheckHashPassword(user string, salt, auth []byte) (bool, string) {
 	for _, password := range u.users[user] {
-		if strings.HasPrefix(password, "*") && len(password) == 41 {
+		if mysql.IsNativePasswordHash(password) {
 			if mysql.CheckHashPassword(auth, salt, []byte(password)[1:]) {
 				return true, password
 			}
@@ -710,6 +913,15 @@ func (u *UserManager) CheckHashPassword(user string, salt, auth []byte) (bool, s
 // CheckPassword check if right password with specific user
 func (u *UserManager) CheckSha2Password(user string, salt, auth []byte) (bool, string) {
 	for _, password := range u.users[user] {
+		if mysql.IsCachingSha2Digest(password) {
+			if mysql.CheckCachingSha2Digest(auth, salt, password) {
+				return true, password
+			}
+			continue
+		}
+		if mysql.IsNativePasswordHash(password) {
+			continue
+		}
 		checkAuth := mysql.CalcCachingSha2Password(salt, password)
 		if bytes.Equal(auth, checkAuth) {
 			return true, password
@@ -718,6 +930,12 @@ func (u *UserManager) CheckSha2Password(user string, salt, auth []byte) (bool, s
 	return false, ""
 }
 
+// isHashedPassword check if password in config is native password hash or caching_sha2_password digest,
+// plaintext of hashed password is unknown and can't be used to calculate auth response
+func isHashedPassword(password string) bool {
+	return mysql.IsNativePasswordHash(password) || mysql.IsCachingSha2Digest(password)
+}
+
 // GetNamespaceByUser return namespace by user
 func (u *UserManager) GetNamespaceByUser(userName, password string) string {
 	key := getUserKey(userName, password)
@@ -745,6 +963,8 @@ const (
 	statsLabelSlice         = "Slice"
 	statsLabelIPAddr        = "IPAddr"
 	statsLabelRole          = "role"
+	statsLabelTable         = "Table"
+	statsLabelReason        = "Reason"
 )
 
 // StatisticManager statistics manager
@@ -753,19 +973,25 @@ type StatisticManager struct {
 	clusterName string
 	startTime   int64
 
-	statsType     string // 监控后端类型
-	handlers      map[string]http.Handler
-	generalLogger log.Logger
+	statsType      string // 监控后端类型
+	handlers       map[string]http.Handler
+	generalLogger  log.Logger
+	generalLogJSON bool // write sql log with structured fields
 
 	sqlTimings                *stats.MultiTimings            // SQL耗时统计
+	tableSQLTimings           *stats.MultiTimings            // 逻辑表读写SQL耗时统计
 	sqlFingerprintSlowCounts  *stats.CountersWithMultiLabels // 慢SQL指纹数量统计
 	sqlErrorCounts            *stats.CountersWithMultiLabels // SQL错误数统计
 	sqlFingerprintErrorCounts *stats.CountersWithMultiLabels // SQL指纹错误数统计
 	sqlForbidenCounts         *stats.CountersWithMultiLabels // SQL黑名单请求统计
 	flowCounts                *stats.CountersWithMultiLabels // 业务流量统计
+	dmlRetryCounts            *stats.CountersWithMultiLabels // DML因死锁或锁等待超时的重试次数统计
+	statisticQueryCounts      *stats.CountersWithMultiLabels // 统计用户读请求按实际服务的实例角色统计
+	sessionPanicCounts        *stats.CountersWithMultiLabels // 执行命令时 panic 的次数统计
 	sessionCounts             *stats.GaugesWithMultiLabels   // 前端会话数统计
 	CPUBusy                   *stats.GaugesWithMultiLabels   // Gaea服务器CPU消耗情况
 	clientConnecions          sync.Map                       // 等同于sessionCounts, 用于限制前端连接
+	userConnections           sync.Map                       // key: namespace:user, 用于限制用户的前端连接
 
 	backendSQLTimings                *stats.MultiTimings            // 后端SQL耗时统计
 	backendSQLFingerprintSlowCounts  *stats.CountersWithMultiLabels // 后端慢SQL指纹数量统计
@@ -777,6 +1003,9 @@ type StatisticManager struct {
 	backendConnectPoolWaitCounts     *stats.GaugesWithMultiLabels   // 后端等待队列统计
 	backendConnectPoolCapacityCounts *stats.GaugesWithMultiLabels   // 当前连接池大小
 	backendInstanceDownCounts        *stats.GaugesWithMultiLabels   // 后端实例状态统计
+	backendHeartbeatLags             *stats.GaugesWithMultiLabels   // 心跳表计算的从库延迟, 单位: 毫秒
+	namespaceResultMemory            *stats.GaugesWithMultiLabels   // namespace 结果集占用内存, 单位: 字节
+	namespaceBackendConcurrency      *stats.GaugesWithMultiLabels   // namespace 正在执行的后端 SQL 数
 	uptimeCounts                     *stats.GaugesWithMultiLabels   // 启动时间记录
 	backendSQLResponse99MaxCounts    *stats.GaugesWithMultiLabels   // 后端 SQL 耗时 P99 最大响应时间
 	backendSQLResponse99AvgCounts    *stats.GaugesWithMultiLabels   // 后端 SQL 耗时 P99 平均响应时间
@@ -853,11 +1082,13 @@ type proxyStatsConfig struct {
 
 func initGeneralLogger(cfg *models.Proxy) (log.Logger, error) {
 	c := make(map[string]string, 5)
+	c["output"] = cfg.LogOutput
 	c["path"] = cfg.LogPath
 	c["filename"] = cfg.LogFileName + "_sql"
 	c["level"] = cfg.LogLevel
 	c["service"] = cfg.Service
 	c["runtime"] = "false"
+	c["format"] = strings.ToLower(cfg.LogFormat)
 
 	// LogKeepDays 或者 LogKeepCounts 只配置一个且大于默认值，实际日志保留天数为配置的天数
 	if cfg.LogKeepDays > log.DefaultLogKeepDays && cfg.LogKeepCounts == 0 {
@@ -877,6 +1108,8 @@ func initGeneralLogger(cfg *models.Proxy) (log.Logger, error) {
 	if cfg.LogKeepCounts != 0 {
 		c["log_keep_counts"] = strconv.Itoa(cfg.LogKeepCounts)
 	}
+	c["max_size"] = strconv.Itoa(cfg.LogMaxSize)
+	c["compress"] = strconv.FormatBool(cfg.LogCompress)
 
 	return zap.CreateLogManager(c)
 }
@@ -901,6 +1134,7 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 	s.handlers = make(map[string]http.Handler)
 	s.slowSQLTime = cfg.SlowSQLTime
 	s.CPUNums = cfg.NumCPU
+	s.generalLogJSON = strings.ToLower(cfg.LogFormat) == models.LogFormatJSON
 	statsCfg, err := parseProxyStatsConfig(cfg)
 	if err != nil {
 		return err
@@ -912,6 +1146,8 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 
 	s.sqlTimings = stats.NewMultiTimings("SqlTimings",
 		"gaea proxy sql sqlTimings", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation})
+	s.tableSQLTimings = stats.NewMultiTimings("TableSqlTimings",
+		"gaea proxy sql timings per logical table", []string{statsLabelCluster, statsLabelNamespace, statsLabelTable, statsLabelOperation})
 	s.sqlFingerprintSlowCounts = stats.NewCountersWithMultiLabels("SqlFingerprintSlowCounts",
 		"gaea proxy sql fingerprint slow counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint})
 	s.sqlErrorCounts = stats.NewCountersWithMultiLabels("SqlErrorCounts",
@@ -922,6 +1158,12 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 		"gaea proxy sql error counts per error type", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint})
 	s.flowCounts = stats.NewCountersWithMultiLabels("FlowCounts",
 		"gaea proxy flow counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFlowDirection})
+	s.dmlRetryCounts = stats.NewCountersWithMultiLabels("DMLRetryCounts",
+		"gaea proxy dml retry counts per reason", []string{statsLabelCluster, statsLabelNamespace, statsLabelReason})
+	s.statisticQueryCounts = stats.NewCountersWithMultiLabels("StatisticQueryCounts",
+		"gaea proxy statistic user read counts per role of serving instance", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelRole})
+	s.sessionPanicCounts = stats.NewCountersWithMultiLabels("SessionPanicCounts",
+		"gaea proxy panic counts of executing client commands", []string{statsLabelCluster, statsLabelNamespace})
 	s.sessionCounts = stats.NewGaugesWithMultiLabels("SessionCounts",
 		"gaea proxy session counts", []string{statsLabelCluster, statsLabelNamespace})
 	s.CPUBusy = stats.NewGaugesWithMultiLabels("CPUBusyByCore", "gaea proxy CPU busy by core", []string{statsLabelCluster})
@@ -946,6 +1188,12 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 		"gaea proxy backend capacity connect counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelIPAddr, statsLabelRole})
 	s.backendInstanceDownCounts = stats.NewGaugesWithMultiLabels("backendInstanceDownCounts",
 		"gaea proxy backend DB status down counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelIPAddr, statsLabelRole})
+	s.backendHeartbeatLags = stats.NewGaugesWithMultiLabels("backendHeartbeatLags",
+		"gaea proxy backend slave lag measured by heartbeat table in milliseconds", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelIPAddr, statsLabelRole})
+	s.namespaceResultMemory = stats.NewGaugesWithMultiLabels("NamespaceResultMemory",
+		"gaea proxy result set memory held by namespace in bytes", []string{statsLabelCluster, statsLabelNamespace})
+	s.namespaceBackendConcurrency = stats.NewGaugesWithMultiLabels("NamespaceBackendConcurrency",
+		"gaea proxy backend sql executing concurrently of namespace", []string{statsLabelCluster, statsLabelNamespace})
 	s.backendSQLResponse99MaxCounts = stats.NewGaugesWithMultiLabels("backendSQLResponse99MaxCounts",
 		"gaea proxy backend sql sqlTimings P99 max", []string{statsLabelCluster, statsLabelNamespace, statsLabelIPAddr})
 	s.backendSQLResponse99AvgCounts = stats.NewGaugesWithMultiLabels("backendSQLResponse99AvgCounts",
@@ -957,6 +1205,7 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 	s.uptimeCounts = stats.NewGaugesWithMultiLabels("UptimeCounts",
 		"gaea proxy uptime counts", []string{statsLabelCluster})
 	s.clientConnecions = sync.Map{}
+	s.userConnections = sync.Map{}
 	s.startClearTask()
 	return nil
 }
@@ -1019,6 +1268,11 @@ func (s *StatisticManager) recordSessionSQLTiming(namespace string, operation st
 	s.sqlTimings.Record(operationStatsKey, startTime)
 }
 
+func (s *StatisticManager) recordTableSQLTiming(namespace string, table string, operation string, startTime time.Time) {
+	tableStatsKey := []string{s.clusterName, namespace, table, operation}
+	s.tableSQLTimings.Record(tableStatsKey, startTime)
+}
+
 // isBackendSlowSQL return true only gaea.ini slow_sql_time > 0 and duration > slow_sql_time
 func (s *StatisticManager) isBackendSlowSQL(duration int64) bool {
 	return s.slowSQLTime > 0 && duration > s.slowSQLTime
@@ -1066,6 +1320,25 @@ func (s *StatisticManager) RecordSQLForbidden(fingerprint, namespace string) {
 	s.sqlForbidenCounts.Add([]string{s.clusterName, namespace, md5}, 1)
 }
 
+// RecordDMLRetry record retry of dml failed by deadlock or lock wait timeout
+func (s *StatisticManager) RecordDMLRetry(namespace string, err error) {
+	reason := "lock_wait_timeout"
+	if mysql.IsSQLErrorCode(err, mysql.ErrLockDeadlock) {
+		reason = "deadlock"
+	}
+	s.dmlRetryCounts.Add([]string{s.clusterName, namespace, reason}, 1)
+}
+
+// RecordStatisticQuery record role of instance serving read of statistic user
+func (s *StatisticManager) RecordStatisticQuery(namespace, slice, role string) {
+	s.statisticQueryCounts.Add([]string{s.clusterName, namespace, slice, role}, 1)
+}
+
+// RecordSessionPanic record panic of executing client command
+func (s *StatisticManager) RecordSessionPanic(namespace string) {
+	s.sessionPanicCounts.Add([]string{s.clusterName, namespace}, 1)
+}
+
 // IncrSessionCount incr session count
 func (s *StatisticManager) IncrSessionCount(namespace string) {
 	statsKey := []string{s.clusterName, namespace}
@@ -1096,6 +1369,35 @@ func (s *StatisticManager) DescConnectionCount(namespace string) {
 	}
 }
 
+// IncrUserConnectionCount incr client connection count of user
+func (s *StatisticManager) IncrUserConnectionCount(namespace, user string) {
+	value, _ := s.userConnections.LoadOrStore(namespace+":"+user, atomic.NewInt32(0))
+	value.(*atomic.Int32).Inc()
+}
+
+// DescUserConnectionCount decr client connection count of user
+func (s *StatisticManager) DescUserConnectionCount(namespace, user string) {
+	if value, ok := s.userConnections.Load(namespace + ":" + user); ok {
+		value.(*atomic.Int32).Dec()
+	}
+}
+
+// GetUserConnectionCount return current client connections of user
+func (s *StatisticManager) GetUserConnectionCount(namespace, user string) int {
+	if value, ok := s.userConnections.Load(namespace + ":" + user); ok {
+		return int(value.(*atomic.Int32).Load())
+	}
+	return 0
+}
+
+// GetConnectionCount return current client connections of namespace
+func (s *StatisticManager) GetConnectionCount(namespace string) int {
+	if value, ok := s.clientConnecions.Load(namespace); ok {
+		return int(value.(*atomic.Int32).Load())
+	}
+	return 0
+}
+
 // AddReadFlowCount add read flow count
 func (s *StatisticManager) AddReadFlowCount(namespace string, byteCount int) {
 	statsKey := []string{s.clusterName, namespace, "read"}
@@ -1144,6 +1446,35 @@ func (s *StatisticManager) recordInstanceDownCount(namespace string, slice strin
 	s.backendInstanceDownCounts.Set(statsKey, count)
 }
 
+// recordHeartbeatLag records replication lag of slave measured by heartbeat table
+func (s *StatisticManager) recordHeartbeatLag(namespace string, slice string, addr string, lag int64, role string) {
+	statsKey := []string{s.clusterName, namespace, slice, addr, role}
+	s.backendHeartbeatLags.Set(statsKey, lag)
+}
+
+// statisticsInfo return proxy status in the format of mysql COM_STATISTICS response
+func (s *StatisticManager) statisticsInfo() string {
+	uptime := time.Now().Unix() - s.startTime
+	if uptime <= 0 {
+		uptime = 1
+	}
+	var threads int32
+	s.clientConnecions.Range(func(_, value interface{}) bool {
+		threads += value.(*atomic.Int32).Load()
+		return true
+	})
+	questions := s.sqlTimings.Count()
+	return fmt.Sprintf("Uptime: %d  Threads: %d  Questions: %d  Queries per second avg: %.3f",
+		uptime, threads, questions, float64(questions)/float64(uptime))
+}
+
+// recordNamespaceBudget records result memory and backend concurrency used by namespace
+func (s *StatisticManager) recordNamespaceBudget(namespace string, memory int64, concurrency int64) {
+	statsKey := []string{s.clusterName, namespace}
+	s.namespaceResultMemory.Set(statsKey, memory)
+	s.namespaceBackendConcurrency.Set(statsKey, concurrency)
+}
+
 // record wait queue length
 func (s *StatisticManager) recordBackendSQLTimingP99Max(namespace, backendAddr string, count int64) {
 	statsKey := []string{s.clusterName, namespace, backendAddr}
@@ -14,6 +14,7 @@
 package server
 
 import (
+	"net"
 	"testing"
 
 	"github.com/XiaoMi/Gaea/models"
@@ -302,6 +303,114 @@ func TestUserManager_CheckPassword(t *testing.T) {
 	}
 }
 
+func TestUserManager_CheckHashedPassword(t *testing.T) {
+	nsCfg := map[string]*models.Namespace{
+		"namespace1": createNamespaceUsers("namespace1", []*userinfo{
+			{username: "user1", password: mysql.NativePasswordHash("pwd1")},
+			{username: "user2", password: mysql.CachingSha2PasswordDigest("pwd2")},
+		}),
+	}
+	userManager, err := CreateUserManager(nsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("abcdefghij0123456789")
+
+	tests := []struct {
+		username string
+		password string
+		sha2     bool
+		valid    bool
+	}{
+		{username: "user1", password: "pwd1", valid: true},
+		{username: "user1", password: "pwd2", valid: false},
+		{username: "user1", password: "pwd1", sha2: true, valid: false},
+		{username: "user2", password: "pwd2", sha2: true, valid: true},
+		{username: "user2", password: "pwd1", sha2: true, valid: false},
+		{username: "user2", password: "pwd2", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.username, func(t *testing.T) {
+			var actualValid bool
+			var actualPassword string
+			if test.sha2 {
+				auth := mysql.CalcCachingSha2Password(salt, test.password)
+				actualValid, actualPassword = userManager.CheckSha2Password(test.username, salt, auth)
+			} else {
+				auth := mysql.CalcPassword(salt, []byte(test.password))
+				if actualValid, actualPassword = userManager.CheckHashPassword(test.username, salt, auth); !actualValid {
+					actualValid, actualPassword = userManager.CheckPassword(test.username, salt, auth)
+				}
+			}
+			if actualValid != test.valid {
+				t.Errorf("valid not equal, expect: %v, acutal: %t, %s", test, actualValid, actualPassword)
+			}
+			// hashed password is matched, it's used as key of user namespace
+			if actualValid && userManager.GetNamespaceByUser(test.username, actualPassword) != "namespace1" {
+				t.Errorf("namespace of user not found, %v", test)
+			}
+		})
+	}
+}
+
+func TestSession_NativePasswordAfterAuthSwitch(t *testing.T) {
+	nsCfg := map[string]*models.Namespace{
+		"namespace1": createNamespaceUsers("namespace1", []*userinfo{
+			{username: "user1", password: mysql.NativePasswordHash("pwd1")},
+			{username: "user2", password: "pwd2"},
+		}),
+	}
+	userManager, err := CreateUserManager(nsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	m.users[0] = userManager
+	m.namespaces[0] = &NamespaceManager{namespaces: map[string]*Namespace{}}
+	salt := []byte("abcdefghij0123456789")
+
+	tests := []struct {
+		username string
+		password string
+		valid    bool
+	}{
+		{username: "user1", password: "pwd1", valid: true},
+		{username: "user1", password: "pwd2", valid: false},
+		{username: "user2", password: "pwd2", valid: true},
+		{username: "user2", password: "pwd1", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.username, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			cc := &Session{
+				c:        NewClientConn(mysql.NewConn(server), m),
+				manager:  m,
+				executor: newSessionExecutor(m),
+			}
+			// auth response of client after switching auth plugin to mysql_native_password
+			info := HandshakeResponseInfo{
+				User:         test.username,
+				Salt:         salt,
+				AuthPlugin:   mysql.MysqlNativePassword,
+				AuthResponse: mysql.CalcPassword(salt, []byte(test.password)),
+				CollationID:  mysql.DefaultCollationID,
+			}
+			err := cc.handleHandshakeResponse(info)
+			if test.valid && err != nil {
+				t.Errorf("expect auth succeeded, got: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("expect auth failed, user: %s, password: %s", test.username, test.password)
+			}
+			if test.valid && cc.namespace != "namespace1" {
+				t.Errorf("namespace not equal, expect: namespace1, actual: %s", cc.namespace)
+			}
+		})
+	}
+}
+
 func prepareNamespaceUsers() map[string]*models.Namespace {
 	nsMap := make(map[string]*models.Namespace)
 	ns1 := "namespace1"
@@ -0,0 +1,368 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// shardTableSuffix is the suffix of sub table name, such as tbl_0001
+var shardTableSuffix = regexp.MustCompile(`_\d{4}$`)
+
+func parseMaskRules(rules []*models.MaskRule) map[string]map[string]string {
+	if len(rules) == 0 {
+		return nil
+	}
+	ret := make(map[string]map[string]string)
+	for _, r := range rules {
+		table := strings.ToLower(strings.TrimSpace(r.Table))
+		if ret[table] == nil {
+			ret[table] = make(map[string]string)
+		}
+		ret[table][strings.ToLower(strings.TrimSpace(r.Column))] = r.Type
+	}
+	return ret
+}
+
+// isUserUnmasked check if result set of user should not be masked
+func (n *Namespace) isUserUnmasked(user string) bool {
+	up, ok := n.userProperties[user]
+	return ok && up.unmasked
+}
+
+// getMaskType return mask type of column, table may be sub table name of shard table.
+// it returns empty string if column need not be masked
+func (n *Namespace) getMaskType(table, column string) string {
+	if column == "" {
+		return ""
+	}
+	return n.getMaskColumns(table)[strings.ToLower(column)]
+}
+
+// getMaskColumns return column to mask type of table, table may be sub table name of shard table
+func (n *Namespace) getMaskColumns(table string) map[string]string {
+	if len(n.maskRules) == 0 || table == "" {
+		return nil
+	}
+	table = strings.ToLower(table)
+	if columns, ok := n.maskRules[table]; ok {
+		return columns
+	}
+	return n.maskRules[trimShardTableSuffix(table)]
+}
+
+// trimShardTableSuffix return logic table name of sub table, such as tbl_0001 to tbl
+func trimShardTableSuffix(table string) string {
+	return shardTableSuffix.ReplaceAllString(table, "")
+}
+
+// maskRows mask columns of result according to mask rules of namespace.
+// columns are matched by original table and column name, so alias of column is also masked,
+// expression of column like CONCAT(col) is rejected by checkMaskedColumns before execution.
+func (se *SessionExecutor) maskRows(r *mysql.Result) {
+	ns := se.GetNamespace()
+	if len(ns.maskRules) == 0 || ns.isUserUnmasked(se.user) {
+		return
+	}
+
+	rewriters := make(map[int]columnRewriter)
+	for i, f := range r.Fields {
+		tp := ns.getMaskType(string(f.OrgTable), string(f.OrgName))
+		if tp == "" {
+			continue
+		}
+		rewriters[i] = func(v []byte) []byte { return maskValue(tp, ns.maskKey, v) }
+		// masked value is string or NULL, or the binary protocol can't encode it
+		f.Flag &^= uint16(mysql.NotNullFlag)
+		if tp != models.MaskTypeNull {
+			f.Type = mysql.TypeVarString
+			f.Decimal = 0
+			if tp == models.MaskTypeHash && f.ColumnLength < sha256.Size*2 {
+				f.ColumnLength = sha256.Size * 2
+			}
+		}
+	}
+	if err := rewriteColumns(r, rewriters); err != nil {
+		log.Warn("[ns:%s, %s@%s] mask result error: %v", se.namespace, se.user, se.clientAddr, err)
+	}
+}
+
+// columnRewriter rewrite value of column, nil means NULL
+type columnRewriter func(v []byte) []byte
+
+// rewriteColumns rewrite not null values of columns in both row datas and values, key of rewriters is column index
+func rewriteColumns(r *mysql.Result, rewriters map[int]columnRewriter) error {
+	if len(rewriters) == 0 {
+		return nil
+	}
+
+	for i := range r.RowDatas {
+		row, err := rewriteRowData(r.RowDatas[i], len(r.Fields), rewriters)
+		if err != nil {
+			return err
+		}
+		r.RowDatas[i] = row
+	}
+	for row, values := range r.Values {
+		for i, rewrite := range rewriters {
+			if i >= len(values) || values[i] == nil {
+				continue
+			}
+			v, err := r.GetString(row, i)
+			if err != nil {
+				return err
+			}
+			if rewritten := rewrite([]byte(v)); rewritten != nil {
+				values[i] = string(rewritten)
+			} else {
+				values[i] = nil
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteRowData rebuild text protocol row with rewritten columns
+func rewriteRowData(row mysql.RowData, columnCount int, rewriters map[int]columnRewriter) (mysql.RowData, error) {
+	ret := make(mysql.RowData, 0, len(row))
+	pos := 0
+	for i := 0; i < columnCount; i++ {
+		start := pos
+		v, next, isNull, ok := mysql.ReadLenEncStringAsBytes(row, pos)
+		if !ok {
+			return nil, mysql.ErrMalformPacket
+		}
+		pos = next
+		rewrite, needRewrite := rewriters[i]
+		if !needRewrite || isNull {
+			ret = append(ret, row[start:pos]...)
+			continue
+		}
+		if rewritten := rewrite(v); rewritten != nil {
+			ret = mysql.AppendLenEncStringBytes(ret, rewritten)
+		} else {
+			// NULL is sent as 0xfb in text protocol
+			ret = append(ret, 0xfb)
+		}
+	}
+	return ret, nil
+}
+
+// maskValue return masked value, nil means NULL. hash is keyed by key of namespace,
+// so it can't be reversed by lookup table of low entropy values
+func maskValue(tp string, key []byte, v []byte) []byte {
+	switch tp {
+	case models.MaskTypePartial:
+		return maskPartial(v)
+	case models.MaskTypeHash:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(v)
+		return []byte(hex.EncodeToString(mac.Sum(nil)))
+	default:
+		return nil
+	}
+}
+
+// maskPartial keep a quarter of characters at the beginning and end, and replace others with *
+func maskPartial(v []byte) []byte {
+	if !utf8.Valid(v) {
+		return []byte(strings.Repeat("*", len(v)))
+	}
+	runes := []rune(string(v))
+	keep := len(runes) / 4
+	for i := keep; i < len(runes)-keep; i++ {
+		runes[i] = '*'
+	}
+	return []byte(string(runes))
+}
+
+// checkMaskedColumns reject select whose masked columns can't be masked in result set. masking matches
+// columns by original table and column name of result, which is lost if masked column is selected by
+// expression such as CONCAT(col), derived table or union.
+func (se *SessionExecutor) checkMaskedColumns(reqCtx *util.RequestContext, sql string) error {
+	ns := se.GetNamespace()
+	if len(ns.maskRules) == 0 || ns.isUserUnmasked(se.user) || reqCtx.GetStmtType() != parser.StmtSelect {
+		return nil
+	}
+	stmt, err := se.Parse(sql)
+	if err != nil {
+		return fmt.Errorf("parse sql error, sql: %s, err: %v", sql, err)
+	}
+
+	collector := &tableSourceCollector{tables: make(map[string]string)}
+	stmt.Accept(collector)
+	checker := &maskedColumnChecker{ns: ns, tables: collector.tables}
+	switch s := stmt.(type) {
+	case *ast.SelectStmt:
+		checker.checkSelect(s, true)
+	case *ast.UnionStmt:
+		checker.checkUnion(s)
+	}
+	if checker.column != "" {
+		return fmt.Errorf("masked column %s can only be selected directly, not in expression, derived table or union", checker.column)
+	}
+	return nil
+}
+
+// tableSourceCollector collect tables in sql, key of tables is table name or alias, value is table name
+type tableSourceCollector struct {
+	tables map[string]string
+}
+
+// Enter for node visit
+func (c *tableSourceCollector) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if ts, ok := n.(*ast.TableSource); ok {
+		if t, ok := ts.Source.(*ast.TableName); ok {
+			c.tables[t.Name.L] = t.Name.L
+			if ts.AsName.L != "" {
+				c.tables[ts.AsName.L] = t.Name.L
+			}
+		}
+	}
+	return n, false
+}
+
+// Leave for node visit
+func (c *tableSourceCollector) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
+
+// maskedColumnChecker find the first masked column selected in the way can't be masked
+type maskedColumnChecker struct {
+	ns     *Namespace
+	tables map[string]string
+	column string
+}
+
+// checkSelect check fields of select, top is false if result of select is not returned to client directly
+func (c *maskedColumnChecker) checkSelect(s *ast.SelectStmt, top bool) {
+	if s.Fields != nil {
+		for _, f := range s.Fields.Fields {
+			switch {
+			case f.WildCard != nil:
+				if !top {
+					c.checkWildCard(f.WildCard)
+				}
+			case !top:
+				f.Expr.Accept(c)
+			default:
+				// column selected directly is masked by metadata of result
+				if _, ok := f.Expr.(*ast.ColumnNameExpr); !ok {
+					f.Expr.Accept(c)
+				}
+			}
+			if c.column != "" {
+				return
+			}
+		}
+	}
+	if s.With != nil {
+		for _, cte := range s.With.CTEs {
+			if cte.Query != nil {
+				c.checkDerivedTables(cte.Query.Query)
+			}
+		}
+	}
+	if s.From != nil && c.column == "" {
+		c.checkDerivedTables(s.From.TableRefs)
+	}
+}
+
+func (c *maskedColumnChecker) checkUnion(s *ast.UnionStmt) {
+	if s.SelectList == nil {
+		return
+	}
+	for _, sel := range s.SelectList.Selects {
+		if c.checkSelect(sel, false); c.column != "" {
+			return
+		}
+	}
+}
+
+func (c *maskedColumnChecker) checkDerivedTables(node ast.ResultSetNode) {
+	switch n := node.(type) {
+	case *ast.Join:
+		c.checkDerivedTables(n.Left)
+		if n.Right != nil {
+			c.checkDerivedTables(n.Right)
+		}
+	case *ast.TableSource:
+		c.checkDerivedTables(n.Source)
+	case *ast.SelectStmt:
+		c.checkSelect(n, false)
+	case *ast.UnionStmt:
+		c.checkUnion(n)
+	}
+}
+
+func (c *maskedColumnChecker) checkWildCard(w *ast.WildCardField) {
+	for alias, table := range c.tables {
+		if w.Table.L != "" && w.Table.L != alias {
+			continue
+		}
+		for column := range c.ns.getMaskColumns(table) {
+			c.column = table + "." + column
+			return
+		}
+	}
+}
+
+// Enter for node visit
+func (c *maskedColumnChecker) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch x := n.(type) {
+	case *ast.AggregateFuncExpr:
+		// count of masked column reveals nothing
+		if strings.EqualFold(x.F, ast.AggFuncCount) {
+			return n, true
+		}
+	case *ast.ColumnName:
+		c.checkColumn(x)
+	}
+	return n, c.column != ""
+}
+
+// Leave for node visit
+func (c *maskedColumnChecker) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, c.column == ""
+}
+
+// checkColumn check if column is masked, column without table may belong to any table in sql
+func (c *maskedColumnChecker) checkColumn(col *ast.ColumnName) {
+	if col.Table.L != "" {
+		if table, ok := c.tables[col.Table.L]; ok && c.ns.getMaskType(table, col.Name.L) != "" {
+			c.column = table + "." + col.Name.L
+		}
+		return
+	}
+	for _, table := range c.tables {
+		if c.ns.getMaskType(table, col.Name.L) != "" {
+			c.column = table + "." + col.Name.L
+			return
+		}
+	}
+}
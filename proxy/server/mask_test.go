@@ -0,0 +1,124 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMaskType(t *testing.T) {
+	n := &Namespace{maskRules: parseMaskRules([]*models.MaskRule{
+		{Table: "User", Column: "Phone", Type: models.MaskTypePartial},
+		{Table: "user", Column: "id_card", Type: models.MaskTypeHash},
+	})}
+	require.Equal(t, models.MaskTypePartial, n.getMaskType("user", "phone"))
+	require.Equal(t, models.MaskTypePartial, n.getMaskType("user_0001", "PHONE"))
+	require.Equal(t, models.MaskTypeHash, n.getMaskType("user", "id_card"))
+	require.Equal(t, "", n.getMaskType("user", "name"))
+	require.Equal(t, "", n.getMaskType("user_1", "phone"))
+	require.Equal(t, "", n.getMaskType("", "phone"))
+}
+
+func TestMaskValue(t *testing.T) {
+	key := []byte("key")
+	require.Equal(t, "13*******78", string(maskValue(models.MaskTypePartial, key, []byte("13812345678"))))
+	require.Equal(t, "***", string(maskValue(models.MaskTypePartial, key, []byte("abc"))))
+	require.Equal(t, "张**四", string(maskValue(models.MaskTypePartial, key, []byte("张三李四"))))
+	require.Equal(t, "", string(maskValue(models.MaskTypePartial, key, []byte(""))))
+	require.Equal(t, "9c196e32dc0175f86f4b1cb89289d6619de6bee699e4c378e68309ed97a1a6ab", string(maskValue(models.MaskTypeHash, key, []byte("abc"))))
+	// unkeyed sha256 of value can't be looked up
+	require.NotEqual(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", string(maskValue(models.MaskTypeHash, nil, []byte("abc"))))
+	require.NotEqual(t, string(maskValue(models.MaskTypeHash, key, []byte("abc"))), string(maskValue(models.MaskTypeHash, []byte("other"), []byte("abc"))))
+	require.Nil(t, maskValue(models.MaskTypeNull, key, []byte("abc")))
+}
+
+func TestRewriteRowData(t *testing.T) {
+	var row mysql.RowData
+	row = mysql.AppendLenEncStringBytes(row, []byte("1"))
+	row = mysql.AppendLenEncStringBytes(row, []byte("13812345678"))
+	row = append(row, 0xfb)
+	row = mysql.AppendLenEncStringBytes(row, []byte("abc"))
+
+	maskers := func(maskTypes map[int]string) map[int]columnRewriter {
+		ret := make(map[int]columnRewriter)
+		for i, tp := range maskTypes {
+			tp := tp
+			ret[i] = func(v []byte) []byte { return maskValue(tp, []byte("key"), v) }
+		}
+		return ret
+	}
+	masked, err := rewriteRowData(row, 4, maskers(map[int]string{1: models.MaskTypePartial, 2: models.MaskTypeHash, 3: models.MaskTypeNull}))
+	require.NoError(t, err)
+
+	fields := make([]*mysql.Field, 4)
+	for i := range fields {
+		fields[i] = &mysql.Field{Type: mysql.TypeVarString}
+	}
+	values, err := masked.ParseText(fields)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"1", "13*******78", nil, nil}, values)
+
+	_, err = rewriteRowData(row, 5, maskers(map[int]string{1: models.MaskTypePartial}))
+	require.Error(t, err)
+}
+
+func TestCheckMaskedColumns(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.GetNamespace().maskRules = parseMaskRules([]*models.MaskRule{
+		{Table: "user", Column: "phone", Type: models.MaskTypePartial},
+	})
+	defer func() { se.GetNamespace().maskRules = nil }()
+
+	tests := []struct {
+		sql    string
+		denied bool
+	}{
+		{"select phone, name from user", false},
+		{"select u.phone as p from user u", false},
+		{"select * from user where phone = '1'", false},
+		{"select count(phone), concat(name, '') from user", false},
+		{"select concat(phone, '') from user", true},
+		{"select concat(u.phone, '') from user u", true},
+		{"select concat(o.phone, '') from user u join orders o on u.id = o.uid", false},
+		{"select substr(phone, 1, 3) from user_0001", true},
+		{"select max(phone) from user", true},
+		{"select (select phone from user limit 1) from orders", true},
+		{"select p from (select phone as p from user) t", true},
+		{"select * from (select * from user) t", true},
+		{"select * from (select id from user) t", false},
+		{"select phone from user union select '1'", true},
+		{"select id from user union select id from orders", false},
+		{"with t as (select phone from user) select * from t", true},
+		{"select id from orders where uid in (select id from user where phone = '1')", false},
+	}
+	for _, test := range tests {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.StmtSelect)
+		err := se.checkMaskedColumns(reqCtx, test.sql)
+		require.Equal(t, test.denied, err != nil, test.sql)
+	}
+
+	// statements other than select are not checked
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	require.NoError(t, se.checkMaskedColumns(reqCtx, "update user set phone = concat(phone, '')"))
+}
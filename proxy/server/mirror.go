@@ -0,0 +1,182 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// MirrorStats stats of sqls duplicated to mirror slice
+type MirrorStats struct {
+	Slice      string  `json:"slice"`
+	Count      uint64  `json:"count"`
+	Errors     uint64  `json:"errors"`
+	Dropped    uint64  `json:"dropped"`     // dropped since mirror started, because queue is full
+	AvgLatency float64 `json:"avg_latency"` // millisecond
+	MaxLatency float64 `json:"max_latency"` // millisecond
+	P95Latency float64 `json:"p95_latency"` // millisecond
+	P99Latency float64 `json:"p99_latency"` // millisecond
+}
+
+type mirrorTask struct {
+	db  string
+	sql string
+}
+
+// sqlMirror duplicate sqls to mirror slice asynchronously, results are discarded and only latency and errors are recorded
+type sqlMirror struct {
+	dropped     uint64 // first field to be 64-bit aligned for atomic operations
+	namespace   string
+	slice       string
+	readPercent int
+	tables      map[string]bool
+	getConn     func() (backend.PooledConnect, error)
+
+	tasks chan *mirrorTask
+	done  chan struct{}
+	wg    sync.WaitGroup
+	stats sqlStatsEntry
+}
+
+func newSQLMirror(namespace string, cfg *models.Mirror, getConn func() (backend.PooledConnect, error)) *sqlMirror {
+	m := &sqlMirror{
+		namespace:   namespace,
+		slice:       cfg.Slice,
+		readPercent: cfg.ReadPercent,
+		tables:      make(map[string]bool, len(cfg.Tables)),
+		getConn:     getConn,
+		tasks:       make(chan *mirrorTask, cfg.GetQueueSize()),
+		done:        make(chan struct{}),
+	}
+	for _, t := range cfg.Tables {
+		m.tables[t] = true
+	}
+	for i := 0; i < cfg.GetConcurrency(); i++ {
+		m.wg.Add(1)
+		go m.run()
+	}
+	return m
+}
+
+// hasTables return true if all traffic of some tables are mirrored, tables of sql are needed to check it
+func (m *sqlMirror) hasTables() bool {
+	return len(m.tables) > 0
+}
+
+// shouldMirror check if sql should be mirrored, sqls in transaction are never mirrored
+// because mirror slice don't share the transaction
+func (m *sqlMirror) shouldMirror(stmtType int, tables []string, inTransaction bool) bool {
+	if inTransaction {
+		return false
+	}
+	switch stmtType {
+	case parser.StmtSelect, parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete:
+	default:
+		return false
+	}
+	for _, t := range tables {
+		if m.tables[t] {
+			return true
+		}
+	}
+	return stmtType == parser.StmtSelect && m.readPercent > 0 && rand.Intn(100) < m.readPercent
+}
+
+// Send put sql to queue, it's dropped if queue is full
+func (m *sqlMirror) Send(db, sql string) {
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+	select {
+	case m.tasks <- &mirrorTask{db: db, sql: sql}:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
+
+func (m *sqlMirror) run() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case t := <-m.tasks:
+			m.execute(t)
+		}
+	}
+}
+
+func (m *sqlMirror) execute(t *mirrorTask) {
+	start := time.Now()
+	err := m.doExecute(t)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	m.stats.record(time.Now(), latency, 0, err != nil)
+	if err != nil {
+		log.Debug("[ns:%s]execute mirror sql failed, slice: %s, db: %s, sql: %s, err: %v", m.namespace, m.slice, t.db, t.sql, err)
+	}
+}
+
+func (m *sqlMirror) doExecute(t *mirrorTask) error {
+	pc, err := m.getConn()
+	if err != nil {
+		return err
+	}
+	// connection with packet error is closed when it's recycled
+	defer pc.Recycle()
+
+	if err = pc.UseDB(t.db); err != nil {
+		return err
+	}
+	_, err = pc.Execute(t.sql, 0)
+	return err
+}
+
+// Stats return stats of mirror in window, all stats since mirror started if window is 0
+func (m *sqlMirror) Stats(window time.Duration) (*MirrorStats, error) {
+	if window < 0 || window > sqlStatsWindowMinutes*time.Minute {
+		return nil, fmt.Errorf("window should be in [0, %dm]", sqlStatsWindowMinutes)
+	}
+	// round up to minutes
+	window = (window + time.Minute - 1) / time.Minute * time.Minute
+
+	s := m.stats.stats("", time.Now(), window)
+	return &MirrorStats{
+		Slice:      m.slice,
+		Count:      s.Count,
+		Errors:     s.Errors,
+		Dropped:    atomic.LoadUint64(&m.dropped),
+		AvgLatency: s.AvgLatency,
+		MaxLatency: s.MaxLatency,
+		P95Latency: s.P95Latency,
+		P99Latency: s.P99Latency,
+	}, nil
+}
+
+// Close stop workers, sqls left in queue are discarded
+func (m *sqlMirror) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLMirrorShouldMirror(t *testing.T) {
+	m := newSQLMirror("ns", &models.Mirror{Slice: "slice-mirror", Tables: []string{"db.t1"}}, nil)
+	defer m.Close()
+
+	assert.True(t, m.hasTables())
+	assert.True(t, m.shouldMirror(parser.StmtSelect, []string{"db.t0", "db.t1"}, false))
+	assert.True(t, m.shouldMirror(parser.StmtUpdate, []string{"db.t1"}, false))
+	assert.False(t, m.shouldMirror(parser.StmtUpdate, []string{"db.t1"}, true))
+	assert.False(t, m.shouldMirror(parser.StmtSelect, []string{"db.t0"}, false))
+	assert.False(t, m.shouldMirror(parser.StmtSet, []string{"db.t1"}, false))
+
+	// all reads are mirrored, writes are not
+	m.readPercent = 100
+	assert.True(t, m.shouldMirror(parser.StmtSelect, nil, false))
+	assert.False(t, m.shouldMirror(parser.StmtInsert, []string{"db.t0"}, false))
+}
+
+func TestSQLMirrorExecute(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	pc := backend.NewMockPooledConnect(mockCtl)
+	pc.EXPECT().UseDB("db_0").Return(nil).Times(2)
+	pc.EXPECT().Execute("select 1", 0).Return(&mysql.Result{}, nil)
+	pc.EXPECT().Execute("select 2", 0).Return(nil, errors.New("table not exists"))
+	pc.EXPECT().Recycle().Times(2)
+
+	executed := make(chan struct{}, 2)
+	m := newSQLMirror("ns", &models.Mirror{Slice: "slice-mirror", Concurrency: 1, QueueSize: 1}, func() (backend.PooledConnect, error) {
+		executed <- struct{}{}
+		return pc, nil
+	})
+	m.Send("db_0", "select 1")
+	<-executed
+	m.Send("db_0", "select 2")
+	<-executed
+
+	// wait until stats of the last sql are recorded
+	var stats *MirrorStats
+	for i := 0; i < 100; i++ {
+		stats, _ = m.Stats(0)
+		if stats.Count == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Close()
+	assert.Equal(t, "slice-mirror", stats.Slice)
+	assert.Equal(t, uint64(2), stats.Count)
+	assert.Equal(t, uint64(1), stats.Errors)
+
+	// sqls are dropped after closed
+	m.Send("db_0", "select 3")
+	_, err := m.Stats(2 * time.Hour)
+	assert.NotNil(t, err)
+}
+
+func TestSQLMirrorDropWhenQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	m := newSQLMirror("ns", &models.Mirror{Slice: "slice-mirror", Concurrency: 1, QueueSize: 1}, func() (backend.PooledConnect, error) {
+		<-block
+		return nil, errors.New("no connection")
+	})
+	for i := 0; i < 5; i++ {
+		m.Send("db_0", "select 1")
+	}
+	stats, err := m.Stats(time.Minute)
+	assert.Nil(t, err)
+	// one is executing and one is in queue at most
+	assert.True(t, stats.Dropped >= 3)
+	close(block)
+	m.Close()
+}
@@ -15,33 +15,40 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/log/capture"
+	"github.com/XiaoMi/Gaea/log/slowlog"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
-	"github.com/XiaoMi/Gaea/proxy/plan"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/XiaoMi/Gaea/proxy/sequence"
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/cache"
+	"github.com/XiaoMi/Gaea/util/kafka"
+	"github.com/XiaoMi/Gaea/util/keystore"
+	"github.com/XiaoMi/Gaea/util/sync2"
 	"golang.org/x/time/rate"
 )
 
 const (
-	namespaceDelayClose = 60
+	waitTransactionsInterval = time.Second
+	namespaceDelayClose      = 60
+	namespaceMaxDelayClose   = 600 // hard cap of waiting for transactions on old namespace
 )
 
 const (
-	defaultSQLCacheCapacity  = 64
-	defaultPlanCacheCapacity = 128
+	defaultSQLCacheCapacity = 64
 
 	defaultSlowSQLTime       = 1000  // millisecond
 	defaultMaxSqlExecuteTime = 0     // 默认为0，不开启慢sql熔断功能
@@ -50,18 +57,34 @@ const (
 	// 认为Slave已下线，如果需要快速判定状态，可减少该值
 	defaultMaxClientConnections = 100000000 //Big enough
 
+	defaultCaptureMaxSize = 1024 // MB
+
 )
 
+// slowLogDir log_path of proxy config, slow log files of namespaces are created in it
+var slowLogDir sync2.AtomicString
+
 // UserProperty means runtime user properties
 type UserProperty struct {
 	RWFlag        int
 	RWSplit       int
 	OtherProperty int
+
+	// user level acl, nil means no limit. key of allowedTables is db, value is tables or *
+	allowedDBs     map[string]bool
+	allowedTables  map[string]map[string]bool
+	unmasked       bool
+	queryLimiter   *queryLimiter // nil means no limit
+	queryPriority  int           // priority of queries waiting in queue of concurrent query limit
+	maxConnections int           // 0 means no limit
+
+	slowSQLKillTime time.Duration // statements running longer are killed, 0 means never
 }
 
 // Namespace is struct driected used by server
 type Namespace struct {
 	name                   string
+	version                string // version of config loaded from store
 	allowedDBs             map[string]bool
 	defaultPhyDBs          map[string]string // logicDBName-phyDBName
 	sqls                   map[string]string //key: sql fingerprint
@@ -69,33 +92,80 @@ type Namespace struct {
 	allowips               []util.IPInfo
 	router                 *router.Router
 	sequences              *sequence.SequenceManager
-	slices                 map[string]*backend.Slice // key: slice name
-	userProperties         map[string]*UserProperty  // key: user name ,value: user's properties
+	slices                 map[string]*backend.Slice     // key: slice name
+	sliceCancels           map[string]context.CancelFunc // key: slice name, cancel health check of slice
+	retainedSlices         map[string]bool               // key: slice name, slices reused by new namespace are not closed
+	userProperties         map[string]*UserProperty      // key: user name ,value: user's properties
 	defaultCharset         string
 	defaultCollationID     mysql.CollationID
-	openGeneralLog         bool // 已废弃
-	maxSqlExecuteTime      int  // session max sql execute time,millisecond
+	sqlMode                string               // quoted default sql_mode of sessions, set and verified on backend connections, empty if not pinned
+	timeZone               string               // default time_zone of sessions, empty means time_zone of backend mysql
+	serverVersion          string               // server version seen by authenticated clients, empty means server version of proxy
+	disabledCapability     uint32               // capability flags disabled after clients are authenticated
+	openGeneralLog         bool                 // 已废弃
+	generalLogFilter       *generalLogFilter    // sample and filter general log of successful statements, nil logs all
+	logSQLFingerprint      bool                 // write fingerprints instead of sqls with literals to sql log and slow log
+	backendError           *models.BackendError // append slice, db and backend to errors of backend mysql, nil if disabled
+	maxSqlExecuteTime      int                  // session max sql execute time,millisecond
 	maxSqlResultSize       int
+	slowSQLReaper          *slowSQLReaper // kill statements exceeding kill time of users, nil if disabled
 	defaultSlice           string
 	downAfterNoAlive       int
 	secondsBehindMaster    uint64
 	supportMultiQuery      bool
 	maxClientConnections   int
+	sessionIdleTimeout     time.Duration // 0 means session_timeout of proxy is used
+	netReadTimeout         time.Duration // 0 means no limit
+	netWriteTimeout        time.Duration // 0 means no limit
+	maxAllowedPacket       int           // max length of client request, 0 means no limit
 	CheckSelectLock        bool
 	localSlaveReadPriority int
+	statisticSpillOver     string // how reads of statistic users are served when no statistic slave is available
 	setForKeepSession      bool
+	multiplexing           bool
+	readRetryAttempts      int
+	readOnlyTxToSlave      bool            // route read only transactions of rw split users to slaves
+	dmlRetryAttempts       int             // max executions of single dml failed by lock conflict, 0 or 1 means no retry
+	dmlRetryBackoff        time.Duration   // wait time before the first dml retry, doubled for each retry
+	scatterParallelism     int             // max slices executed at the same time in scatter query, 0 means no limit
+	scatterShardTimeout    int             // execute time limit of each slice in scatter query, millisecond, 0 means no limit
+	scatterPipelineDepth   int             // max sqls sent to connection of a slice before reading results, 0 or 1 means no pipelining
+	scatterPartialResult   bool            // return results of succeeded slices when some slices of scatter select fail
+	budget                 *resourceBudget // result memory and backend concurrency of namespace
+	queryLimiter           *queryLimiter   // concurrent queries of namespace, nil means no limit
 	clientQPSLimit         uint32
 	supportLimitTx         bool
+	maskRules              map[string]map[string]string         // key: table, value: column to mask type
+	maskKey                []byte                               // key of HMAC used by hash mask
+	encryptColumns         map[string]map[string]*encryptColumn // key: table, value: column to encrypt column
+	rewriteRules           []*rewriteRule                       // applied to sqls of clients before planning, the first matched one wins
+	globalUniqueKeys       map[string][]*models.GlobalUniqueKey // key: db.table, checked by index tables before inserts
 
 	slowSQLCache            *cache.LRUCache
 	errorSQLCache           *cache.LRUCache
 	backendSlowSQLCache     *cache.LRUCache
 	backendErrorSQLCache    *cache.LRUCache
 	planCache               *cache.LRUCache
-	CloseCancel             context.CancelFunc
+	sqlStats                *sqlStatsTable    // execution stats of sql fingerprints, nil if disabled
+	tableStats              *tableStatsTable  // read and write stats of logical tables, nil if disabled
+	mirror                  *sqlMirror        // duplicate sqls to mirror slice, nil if disabled
+	indexAdvisor            *indexAdvisor     // learn indexes of frequent sqls and inject approved hints, nil if disabled
+	slowSQLExplainer        *slowSQLExplainer // collect plans of slow sqls, nil if disabled
+	purger                  *purger           // purge expired rows of logical tables, nil if no purge rule
+	precreator              *precreator       // create sub tables of future periods of date sharded tables, nil if disabled
+	checksums               *checksumChecker  // compare checksums of sub tables between masters and slaves
+	binlogTailers           *binlogTailers    // tail binlog of slice masters, nil if disabled
+	cdc                     *cdcPublisher     // publish row change events of committed writes, nil if disabled
 	limiter                 *rate.Limiter
+	versionCompareStatus    *util.VersionCompareStatus // of serverVersion, nil if serverVersion is empty
 	namespaceChangeIndex    uint32
+	activeTxs               sync2.AtomicInt64 // transactions holding backend connections of this namespace
+	mode                    *namespaceMode    // runtime mode switched by admin api
 	allowedSessionVariables map[string]string
+	trackSessionVariables   bool            // track common session variables besides allowedSessionVariables
+	slowLogger              *slowlog.Writer // nil if slow log file is not configured
+	captureWriter           *capture.Writer // nil if capture file is not configured
+	captureFull             sync2.AtomicBool
 }
 
 // DumpToJSON  means easy encode json
@@ -105,28 +175,44 @@ func (n *Namespace) DumpToJSON() []byte {
 
 // NewNamespace init namespace
 func NewNamespace(namespaceConfig *models.Namespace, proxyDatacenter string) (*Namespace, error) {
+	return newNamespace(namespaceConfig, proxyDatacenter, nil)
+}
+
+// newNamespace init namespace, unchanged slices of old namespace are reused to keep their connection pools
+func newNamespace(namespaceConfig *models.Namespace, proxyDatacenter string, old *Namespace) (*Namespace, error) {
 	var err error
+	var reused map[string]bool
 	namespace := &Namespace{
 		name:                    namespaceConfig.Name,
+		version:                 namespaceConfig.Version(),
 		sqls:                    make(map[string]string, 16),
 		userProperties:          make(map[string]*UserProperty, 2),
 		openGeneralLog:          namespaceConfig.OpenGeneralLog,
+		generalLogFilter:        newGeneralLogFilter(namespaceConfig.GeneralLog),
+		logSQLFingerprint:       namespaceConfig.LogSQLFingerprint,
+		backendError:            namespaceConfig.BackendError,
 		slowSQLCache:            cache.NewLRUCache(defaultSQLCacheCapacity),
 		errorSQLCache:           cache.NewLRUCache(defaultSQLCacheCapacity),
 		backendSlowSQLCache:     cache.NewLRUCache(defaultSQLCacheCapacity),
 		backendErrorSQLCache:    cache.NewLRUCache(defaultSQLCacheCapacity),
-		planCache:               cache.NewLRUCache(defaultPlanCacheCapacity),
 		defaultSlice:            namespaceConfig.DefaultSlice,
 		allowedSessionVariables: namespaceConfig.AllowedSessionVariables,
+		trackSessionVariables:   namespaceConfig.TrackSessionVariables,
+		sliceCancels:            make(map[string]context.CancelFunc),
+		mode:                    newNamespaceMode(),
+	}
+	// mode switched by admin api is kept across reloads
+	if old != nil {
+		namespace.mode = old.mode
 	}
 
 	defer func() {
 		if err != nil {
+			// slices reused from old namespace are still in use
+			namespace.retainedSlices = reused
 			namespace.Close(false)
 		}
 	}()
-	var ctx context.Context
-	ctx, namespace.CloseCancel = context.WithCancel(context.TODO())
 
 	// init SupportMultiQuery default true
 	namespace.supportMultiQuery = false
@@ -149,6 +235,27 @@ func NewNamespace(namespaceConfig *models.Namespace, proxyDatacenter string) (*N
 		return nil, fmt.Errorf("parse slowSQLTime error: %v", err)
 	}
 
+	// init slow log in mysql format
+	if namespaceConfig.SlowLogFile != "" {
+		slowLogFile := filepath.Join(slowLogDir.Get(), namespaceConfig.SlowLogFile)
+		namespace.slowLogger, err = slowlog.NewWriter(slowLogFile, namespaceConfig.SlowLogKeepDays, namespaceConfig.SlowLogKeepCounts)
+		if err != nil {
+			return nil, fmt.Errorf("init slow log error: %v", err)
+		}
+	}
+
+	// init traffic capture
+	if namespaceConfig.CaptureFile != "" {
+		maxSize := namespaceConfig.CaptureMaxSize
+		if maxSize == 0 {
+			maxSize = defaultCaptureMaxSize
+		}
+		namespace.captureWriter, err = capture.NewWriter(namespaceConfig.CaptureFile, int64(maxSize)<<20)
+		if err != nil {
+			return nil, fmt.Errorf("init capture file error: %v", err)
+		}
+	}
+
 	// init session slow sql max execute time
 	if namespaceConfig.MaxSqlExecuteTime <= 0 {
 		namespace.maxSqlExecuteTime = defaultMaxSqlExecuteTime
@@ -191,18 +298,86 @@ func NewNamespace(namespaceConfig *models.Namespace, proxyDatacenter string) (*N
 		return nil, fmt.Errorf("parse charset error: %v", err)
 	}
 
+	sqlMode, err := mysql.NormalizeSQLMode(namespaceConfig.SQLMode)
+	if err != nil {
+		return nil, fmt.Errorf("parse sql_mode error: %v", err)
+	}
+	if sqlMode != "" {
+		namespace.sqlMode = "'" + sqlMode + "'"
+	}
+
+	if version := strings.TrimSpace(namespaceConfig.ServerVersion); version != "" {
+		namespace.serverVersion = version
+		namespace.versionCompareStatus = util.NewVersionCompareStatus(version)
+	}
+	namespace.disabledCapability, err = models.ParseDisabledCapabilities(namespaceConfig.DisabledCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("parse disabled_capabilities error: %v", err)
+	}
+
+	namespace.timeZone = strings.TrimSpace(namespaceConfig.TimeZone)
+	if namespace.timeZone != "" {
+		if err = mysql.VerifyTimeZone(namespace.timeZone); err != nil {
+			return nil, fmt.Errorf("parse time_zone error: %v", err)
+		}
+	}
+
+	// init concurrent query limit, users share queue config of namespace
+	queryQueueTimeout := time.Duration(namespaceConfig.QueryQueueTimeout) * time.Millisecond
+	if queryQueueTimeout <= 0 {
+		queryQueueTimeout = defaultQueryQueueTimeout * time.Millisecond
+	}
+	namespace.queryLimiter = newQueryLimiter("namespace "+namespace.name, namespaceConfig.MaxConcurrentQueries, namespaceConfig.QueryQueueSize, queryQueueTimeout)
+
 	// init user properties
 	for _, user := range namespaceConfig.Users {
-		up := &UserProperty{RWFlag: user.RWFlag, RWSplit: user.RWSplit, OtherProperty: user.OtherProperty}
+		up := &UserProperty{RWFlag: user.RWFlag, RWSplit: user.RWSplit, OtherProperty: user.OtherProperty, unmasked: user.Unmasked, maxConnections: user.MaxConnections}
+		up.queryLimiter = newQueryLimiter("user "+user.UserName, user.MaxConcurrentQueries, namespaceConfig.QueryQueueSize, queryQueueTimeout)
+		up.queryPriority = parseQueryPriority(user, namespaceConfig.QueryPriority)
+		up.slowSQLKillTime = parseSlowSQLKillTime(user, namespaceConfig.SlowSQLKillTime)
+		if up.allowedDBs, up.allowedTables, err = parseUserACL(user); err != nil {
+			return nil, fmt.Errorf("parse user acl error: %v", err)
+		}
 		namespace.userProperties[user.UserName] = up
 	}
 
+	for _, up := range namespace.userProperties {
+		if up.slowSQLKillTime > 0 {
+			namespace.slowSQLReaper = newSlowSQLReaper(namespace.name, namespaceConfig.SlowSQLKillWhitelist)
+			if old != nil {
+				namespace.slowSQLReaper.inherit(old.slowSQLReaper)
+			}
+			break
+		}
+	}
+
+	namespace.maskRules = parseMaskRules(namespaceConfig.MaskRules)
+	if namespaceConfig.MaskKeyID != "" {
+		if namespace.maskKey, err = keystore.GetKey(namespaceConfig.MaskKeyID); err != nil {
+			return nil, fmt.Errorf("get mask key error: %v", err)
+		}
+	}
+	namespace.encryptColumns, err = parseEncryptColumns(namespaceConfig.EncryptColumns)
+	if err != nil {
+		return nil, fmt.Errorf("parse encrypt columns error: %v", err)
+	}
+	namespace.rewriteRules, err = parseRewriteRules(namespaceConfig.RewriteRules)
+	if err != nil {
+		return nil, fmt.Errorf("parse rewrite rules error: %v", err)
+	}
+	namespace.globalUniqueKeys = parseGlobalUniqueKeys(namespaceConfig.GlobalUniqueKeys)
+
 	if namespaceConfig.MaxClientConnections <= 0 {
 		namespace.maxClientConnections = defaultMaxClientConnections
 	} else {
 		namespace.maxClientConnections = namespaceConfig.MaxClientConnections
 	}
 
+	namespace.sessionIdleTimeout = time.Duration(namespaceConfig.SessionIdleTimeout) * time.Minute
+	namespace.netReadTimeout = time.Duration(namespaceConfig.NetReadTimeout) * time.Second
+	namespace.netWriteTimeout = time.Duration(namespaceConfig.NetWriteTimeout) * time.Second
+	namespace.maxAllowedPacket = namespaceConfig.MaxAllowedPacket
+
 	namespace.downAfterNoAlive = namespaceConfig.DownAfterNoAlive
 	if namespace.downAfterNoAlive < 0 {
 		return nil, fmt.Errorf("downAfterNoAlive should be greater than 0")
@@ -223,16 +398,24 @@ func NewNamespace(namespaceConfig *models.Namespace, proxyDatacenter string) (*N
 	default:
 		namespace.localSlaveReadPriority = backend.LocalSlaveReadClosed
 	}
+	namespace.statisticSpillOver = namespaceConfig.StatisticSpillOver
 
 	// init backend slices
-	namespace.slices, err = parseSlices(namespaceConfig.Slices, namespace.defaultCharset, namespace.defaultCollationID, proxyDatacenter)
+	namespace.slices, reused, err = parseSlices(namespaceConfig.Slices, namespace.defaultCharset, namespace.defaultCollationID, proxyDatacenter, namespace.reusableSlices(old))
 	if err != nil {
 		return nil, fmt.Errorf("init slices of namespace: %s failed, err: %v", namespaceConfig.Name, err)
 	}
 
 	//Check slice master and slave status and mark them as unavailable when detect down
-	if namespace.downAfterNoAlive > 0 {
-		namespace.CheckSliceStatus(ctx)
+	for name, slice := range namespace.slices {
+		if reused[name] {
+			// health check of reused slice keeps running
+			namespace.sliceCancels[name] = old.sliceCancels[name]
+			continue
+		}
+		if namespace.downAfterNoAlive > 0 {
+			namespace.checkSliceStatus(name, slice)
+		}
 	}
 
 	// init router
@@ -257,6 +440,78 @@ func NewNamespace(namespaceConfig *models.Namespace, proxyDatacenter string) (*N
 
 	// init global keepSession in namespace
 	namespace.setForKeepSession = namespaceConfig.SetForKeepSession
+	namespace.multiplexing = namespaceConfig.Multiplexing
+	namespace.readRetryAttempts = namespaceConfig.ReadRetryAttempts
+	namespace.readOnlyTxToSlave = namespaceConfig.ReadOnlyTxToSlave
+	namespace.dmlRetryAttempts = namespaceConfig.DMLRetryAttempts
+	namespace.dmlRetryBackoff = time.Duration(namespaceConfig.DMLRetryBackoff) * time.Millisecond
+	if namespace.dmlRetryBackoff <= 0 {
+		namespace.dmlRetryBackoff = defaultDMLRetryBackoff * time.Millisecond
+	}
+	namespace.scatterParallelism = namespaceConfig.ScatterParallelism
+	namespace.scatterShardTimeout = namespaceConfig.ScatterShardTimeout
+	namespace.scatterPipelineDepth = namespaceConfig.ScatterPipelineDepth
+	namespace.scatterPartialResult = namespaceConfig.ScatterPartialResult
+	if namespaceConfig.SQLStatsCapacity > 0 {
+		namespace.sqlStats = newSQLStatsTable(namespaceConfig.SQLStatsCapacity)
+	}
+	if namespaceConfig.TableStatsCapacity > 0 {
+		namespace.tableStats = newTableStatsTable(namespaceConfig.TableStatsCapacity)
+	}
+	if namespaceConfig.PlanCacheCapacity > 0 {
+		namespace.planCache = cache.NewLRUCache(int64(namespaceConfig.PlanCacheCapacity))
+	}
+	if namespaceConfig.SlowSQLExplain != "" {
+		namespace.slowSQLExplainer = newSlowSQLExplainer(namespace.name, namespaceConfig.SlowSQLExplain, defaultSQLCacheCapacity, namespace.explainOnBackend)
+	}
+	if namespaceConfig.IndexAdvisor != nil && namespace.sqlStats != nil {
+		interval := time.Duration(namespaceConfig.IndexAdvisor.GetInterval()) * time.Second
+		namespace.indexAdvisor = newIndexAdvisor(namespace.name, interval, namespaceConfig.IndexAdvisor.GetTopN(),
+			func(n int, window time.Duration) ([]*SQLStats, error) {
+				return namespace.sqlStats.TopN(SQLStatsSortTotal, n, window)
+			}, namespace.explainOnSlave)
+		if old != nil {
+			namespace.indexAdvisor.inherit(old.indexAdvisor)
+		}
+		go namespace.indexAdvisor.run()
+	}
+	if namespaceConfig.Mirror != nil {
+		mirrorSlice, ok := namespace.slices[namespaceConfig.Mirror.Slice]
+		if !ok {
+			return nil, fmt.Errorf("init mirror error: slice not found: %s", namespaceConfig.Mirror.Slice)
+		}
+		namespace.mirror = newSQLMirror(namespace.name, namespaceConfig.Mirror, mirrorSlice.GetMasterConn)
+	}
+	if namespaceConfig.BinlogTailer != nil {
+		namespace.binlogTailers, err = newBinlogTailers(namespaceConfig.BinlogTailer, namespace.slices)
+		if err != nil {
+			return nil, fmt.Errorf("init binlog tailer error: %v", err)
+		}
+		namespace.binlogTailers.start()
+	}
+	if len(namespaceConfig.PurgeRules) > 0 {
+		namespace.purger, err = newPurger(namespace.name, namespaceConfig.PurgeRules, namespace.getPurgeTargets, namespace.executeOnMaster)
+		if err != nil {
+			return nil, fmt.Errorf("init purger error: %v", err)
+		}
+		if old != nil && old.purger != nil {
+			namespace.purger.inherit(old.purger)
+		}
+		namespace.purger.start()
+	}
+	namespace.precreator = newPrecreator(namespace.name, namespace.router, namespaceConfig.ShardRules, namespace.executeOnMaster)
+	if namespace.precreator != nil {
+		if old != nil {
+			namespace.precreator.inherit(old.precreator)
+		}
+		namespace.precreator.start()
+	}
+	namespace.checksums = newChecksumChecker(namespace.name, namespace.getPurgeTargets, namespace.getSliceInstances, namespace.connectBackend)
+	if namespaceConfig.CDC != nil {
+		producer := kafka.NewProducer(namespaceConfig.CDC.Brokers, cdcSendTimeout)
+		namespace.cdc = newCDCPublisher(namespace.name, namespaceConfig.CDC, producer)
+	}
+	namespace.budget = newResourceBudget(namespaceConfig.MaxResultMemory, namespaceConfig.MaxBackendConcurrency)
 
 	// init client qps limit config
 	if namespaceConfig.ClientQPSLimit > 0 {
@@ -273,11 +528,34 @@ func (n *Namespace) GetName() string {
 	return n.name
 }
 
+// GetVersion return version of config loaded by namespace
+func (n *Namespace) GetVersion() string {
+	return n.version
+}
+
 // GetSlice return slice of namespace
 func (n *Namespace) GetSlice(name string) *backend.Slice {
 	return n.slices[name]
 }
 
+// GetBackendConnections return pooled backend connections of all slices, key: slice name
+func (n *Namespace) GetBackendConnections() map[string][]*backend.PooledConnectInfo {
+	ret := make(map[string][]*backend.PooledConnectInfo, len(n.slices))
+	for name, slice := range n.slices {
+		ret[name] = slice.GetConnectionInfos()
+	}
+	return ret
+}
+
+// GetBackendStatus return status of backends in all slices, key: slice name
+func (n *Namespace) GetBackendStatus() map[string][]*backend.BackendStatus {
+	ret := make(map[string][]*backend.BackendStatus, len(n.slices))
+	for name, slice := range n.slices {
+		ret[name] = slice.GetBackendStatus()
+	}
+	return ret
+}
+
 // GetDefaultSessionVariables return default session variables of namespace
 func (n *Namespace) GetAllowedSessionVariables() map[string]string {
 	return n.allowedSessionVariables
@@ -309,6 +587,82 @@ func (n *Namespace) getSessionSlowSQLTime() int64 {
 	return n.slowSQLTime
 }
 
+// redactLogSQL return sql written to sql log and slow log, literals are replaced by ? if log_sql_fingerprint is set
+func (n *Namespace) redactLogSQL(sql string) string {
+	if !n.logSQLFingerprint {
+		return sql
+	}
+	return mysql.GetFingerprint(sql)
+}
+
+// redactLogSQLs return sqls of slices written to log like redactLogSQL
+func (n *Namespace) redactLogSQLs(sqls map[string]map[string][]string) map[string]map[string][]string {
+	if !n.logSQLFingerprint {
+		return sqls
+	}
+	ret := make(map[string]map[string][]string, len(sqls))
+	for slice, dbSQLs := range sqls {
+		ret[slice] = make(map[string][]string, len(dbSQLs))
+		for db, ss := range dbSQLs {
+			for _, sql := range ss {
+				ret[slice][db] = append(ret[slice][db], mysql.GetFingerprint(sql))
+			}
+		}
+	}
+	return ret
+}
+
+// redactLogError return error written to sql log, message of mysql error may contain literals like duplicate key,
+// so only code and state are kept if log_sql_fingerprint is set. Other errors may contain the sql, literals in
+// their messages are replaced by ? like fingerprint.
+func (n *Namespace) redactLogError(err error) error {
+	if !n.logSQLFingerprint || err == nil {
+		return err
+	}
+	if e, ok := err.(*mysql.SQLError); ok {
+		return fmt.Errorf("ERROR %d (%s)", e.Code, e.State)
+	}
+	return errors.New(mysql.GetFingerprint(err.Error()))
+}
+
+// enrichBackendError append slice, db and backend addr to message of mysql error returned by backend,
+// addr is replaced by its alias or hidden according to backend_error config
+func (n *Namespace) enrichBackendError(err error, slice, db, addr string) error {
+	e, ok := err.(*mysql.SQLError)
+	if !ok || n.backendError == nil {
+		return err
+	}
+	context := fmt.Sprintf("slice=%s db=%s", slice, db)
+	if display := n.backendError.DisplayAddr(addr); display != "" {
+		context += " addr=" + display
+	}
+	return &mysql.SQLError{Code: e.Code, State: e.State, Message: fmt.Sprintf("%s [%s]", e.Message, context)}
+}
+
+// writeSlowLog write slow sql to slow log file if configured
+func (n *Namespace) writeSlowLog(e *slowlog.Entry) {
+	if n.slowLogger == nil {
+		return
+	}
+	if err := n.slowLogger.Write(e); err != nil {
+		log.Warn("write slow log of namespace: %s failed, err: %v", n.name, err)
+	}
+}
+
+// writeCapture write statement to capture file, capturing stops when the file is full
+func (n *Namespace) writeCapture(r *capture.Record) {
+	err := n.captureWriter.Write(r)
+	if err == capture.ErrFull {
+		if n.captureFull.CompareAndSwap(false, true) {
+			log.Warn("capture file of namespace: %s is full, capturing stops", n.name)
+		}
+		return
+	}
+	if err != nil {
+		log.Warn("write capture file of namespace: %s failed, err: %v", n.name, err)
+	}
+}
+
 // IsAllowWrite check if user allow to write
 func (n *Namespace) IsAllowWrite(user string) bool {
 	return n.userProperties[user].RWFlag == models.ReadWrite
@@ -356,6 +710,59 @@ func (n *Namespace) IsAllowedDB(dbname string) bool {
 	return ok && allowed
 }
 
+// hasUserACL check if user has db or table level acl
+func (n *Namespace) hasUserACL(user string) bool {
+	up, ok := n.userProperties[user]
+	return ok && (up.allowedDBs != nil || up.allowedTables != nil)
+}
+
+// getUserMaxConnections return connection limit of user, 0 means no limit
+func (n *Namespace) getUserMaxConnections(user string) int {
+	if up, ok := n.userProperties[user]; ok {
+		return up.maxConnections
+	}
+	return 0
+}
+
+// getUserSlowSQLKillTime return kill time of user's statements, 0 means never killed
+func (n *Namespace) getUserSlowSQLKillTime(user string) time.Duration {
+	if up, ok := n.userProperties[user]; ok {
+		return up.slowSQLKillTime
+	}
+	return 0
+}
+
+// getUserConnections return current client connections of users in namespace
+func (n *Namespace) getUserConnections(stats *StatisticManager) map[string]int {
+	ret := make(map[string]int, len(n.userProperties))
+	for user := range n.userProperties {
+		ret[user] = stats.GetUserConnectionCount(n.name, user)
+	}
+	return ret
+}
+
+// IsUserAllowedDB check db against user's allowed dbs, it's true if user has no db acl
+func (n *Namespace) IsUserAllowedDB(user, db string) bool {
+	up, ok := n.userProperties[user]
+	if !ok || up.allowedDBs == nil {
+		return true
+	}
+	return up.allowedDBs[strings.ToLower(db)]
+}
+
+// IsUserAllowedTable check table against user's allowed tables, it's true if user has no table acl
+func (n *Namespace) IsUserAllowedTable(user, db, table string) bool {
+	up, ok := n.userProperties[user]
+	if !ok || up.allowedTables == nil {
+		return true
+	}
+	tables, ok := up.allowedTables[strings.ToLower(db)]
+	if !ok {
+		return false
+	}
+	return tables["*"] || tables[strings.ToLower(table)]
+}
+
 // GetAllowedDBs return all allowed databases
 func (n *Namespace) GetAllowedDBs() []string {
 	var ret []string
@@ -395,18 +802,192 @@ func (n *Namespace) GetDefaultCollationID() mysql.CollationID {
 	return n.defaultCollationID
 }
 
-// GetCachedPlan get plan in cache
-func (n *Namespace) GetCachedPlan(db, sql string) (plan.Plan, bool) {
-	v, ok := n.planCache.Get(db + "|" + sql)
+// getPlanTemplate get plan template of parameterized sql in cache
+func (n *Namespace) getPlanTemplate(key string) (*planTemplate, bool) {
+	if n.planCache == nil {
+		return nil, false
+	}
+	v, ok := n.planCache.Get(key)
 	if !ok {
 		return nil, false
 	}
-	return v.(plan.Plan), true
+	return v.(*planTemplate), true
+}
+
+// setPlanTemplate set plan template of parameterized sql in cache
+func (n *Namespace) setPlanTemplate(key string, t *planTemplate) {
+	if n.planCache != nil {
+		n.planCache.SetIfAbsent(key, t)
+	}
 }
 
-// SetCachedPlan set plan in cache
-func (n *Namespace) SetCachedPlan(db, sql string, p plan.Plan) {
-	n.planCache.SetIfAbsent(db+"|"+sql, p)
+// GetSQLStatsTopN return top n execution stats of sql fingerprints in window
+func (n *Namespace) GetSQLStatsTopN(sortBy string, limit int, window time.Duration) ([]*SQLStats, error) {
+	if n.sqlStats == nil {
+		return nil, fmt.Errorf("sql stats of namespace %s is not enabled", n.name)
+	}
+	return n.sqlStats.TopN(sortBy, limit, window)
+}
+
+// ResetSQLStats clear execution stats of sql fingerprints
+func (n *Namespace) ResetSQLStats() {
+	if n.sqlStats != nil {
+		n.sqlStats.Reset()
+	}
+}
+
+// GetTableStats return read and write stats of logical tables in window
+func (n *Namespace) GetTableStats(window time.Duration) ([]*TableStats, error) {
+	if n.tableStats == nil {
+		return nil, fmt.Errorf("table stats of namespace %s is not enabled", n.name)
+	}
+	return n.tableStats.Stats(window)
+}
+
+// ResetTableStats clear read and write stats of logical tables
+func (n *Namespace) ResetTableStats() {
+	if n.tableStats != nil {
+		n.tableStats.Reset()
+	}
+}
+
+// explainOnSlave execute explain sql on slave of slice, it's executed on master if no slave is available
+func (n *Namespace) explainOnSlave(slice, db, sql string) (*mysql.Result, error) {
+	s, ok := n.slices[slice]
+	if !ok {
+		return nil, fmt.Errorf("slice %s not found", slice)
+	}
+	pc, err := s.GetConn(true, 0, n.localSlaveReadPriority)
+	if err != nil {
+		return nil, err
+	}
+	// connection with packet error is closed when it's recycled
+	defer pc.Recycle()
+
+	if err = pc.UseDB(db); err != nil {
+		return nil, err
+	}
+	return pc.Execute(sql, 0)
+}
+
+// getPurgeTargets return sub tables of logical table, table in default slice is returned if it's not sharded
+func (n *Namespace) getPurgeTargets(db, table string) ([]*purgeTarget, error) {
+	rule, ok := n.router.GetShardRule(db, table)
+	if !ok {
+		phyDB, err := n.GetDefaultPhyDB(db)
+		if err != nil {
+			return nil, err
+		}
+		return []*purgeTarget{{slice: n.defaultSlice, db: phyDB, table: table}}, nil
+	}
+	indexes := rule.GetSubTableIndexes()
+	targets := make([]*purgeTarget, 0, len(indexes))
+	for _, index := range indexes {
+		slice, phyDB, phyTable, err := subTable(rule, index)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, &purgeTarget{slice: slice, db: phyDB, table: phyTable})
+	}
+	return targets, nil
+}
+
+// executeOnMaster execute sql on master of slice, return affected rows
+func (n *Namespace) executeOnMaster(slice, sql string) (uint64, error) {
+	s, ok := n.slices[slice]
+	if !ok {
+		return 0, fmt.Errorf("slice %s not found", slice)
+	}
+	pc, err := s.GetMasterConn()
+	if err != nil {
+		return 0, err
+	}
+	// connection with packet error is closed when it's recycled
+	defer pc.Recycle()
+
+	r, err := pc.Execute(sql, 0)
+	if err != nil {
+		return 0, err
+	}
+	return r.AffectedRows, nil
+}
+
+// getSliceInstances return addrs of master and slaves of slice, statistic slaves are included
+func (n *Namespace) getSliceInstances(slice string) (string, []string, error) {
+	s, ok := n.slices[slice]
+	if !ok {
+		return "", nil, fmt.Errorf("slice %s not found", slice)
+	}
+	var slaves []string
+	for _, dbInfo := range []*backend.DBInfo{s.Slave, s.StatisticSlave} {
+		if dbInfo == nil {
+			continue
+		}
+		for _, cp := range dbInfo.ConnPool {
+			slaves = append(slaves, cp.Addr())
+		}
+	}
+	return s.Master.ConnPool[0].Addr(), slaves, nil
+}
+
+// connectBackend create a new connection to backend of slice, it's not pooled and should be closed by caller
+func (n *Namespace) connectBackend(slice, addr string) (checksumConn, error) {
+	s, ok := n.slices[slice]
+	if !ok {
+		return nil, fmt.Errorf("slice %s not found", slice)
+	}
+	dc, err := s.GetDirectConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// explainOnBackend execute explain sql on backend of slice by a new connection
+func (n *Namespace) explainOnBackend(slice, addr, db, sql string) (*mysql.Result, error) {
+	s, ok := n.slices[slice]
+	if !ok {
+		return nil, fmt.Errorf("slice %s not found", slice)
+	}
+	dc, err := s.GetDirectConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer dc.Close()
+
+	if err = dc.UseDB(db); err != nil {
+		return nil, err
+	}
+	return dc.ExecuteWithTimeout(sql, 0, slowSQLExplainTimeout)
+}
+
+// GetMirrorStats return stats of sqls duplicated to mirror slice in window
+func (n *Namespace) GetMirrorStats(window time.Duration) (*MirrorStats, error) {
+	if n.mirror == nil {
+		return nil, fmt.Errorf("mirror of namespace %s is not enabled", n.name)
+	}
+	return n.mirror.Stats(window)
+}
+
+// GetBinlogStats return status of binlog tailers and tables changed on slice masters
+func (n *Namespace) GetBinlogStats() (*BinlogStats, error) {
+	if n.binlogTailers == nil {
+		return nil, fmt.Errorf("binlog tailer of namespace %s is not enabled", n.name)
+	}
+	return n.binlogTailers.stats(), nil
+}
+
+// GetCDCStats return stats of row change events published to kafka
+func (n *Namespace) GetCDCStats() (*CDCStats, error) {
+	if n.cdc == nil {
+		return nil, fmt.Errorf("cdc of namespace %s is not enabled", n.name)
+	}
+	return n.cdc.Stats(), nil
+}
+
+// needStmtTables return true if logical tables of sql are needed by table stats, mirror or cdc
+func (n *Namespace) needStmtTables() bool {
+	return n.tableStats != nil || (n.mirror != nil && n.mirror.hasTables()) || n.cdc != nil
 }
 
 // SetSlowSQLFingerprint store slow sql fingerprint
@@ -436,6 +1017,9 @@ func (n *Namespace) GetSlowSQLFingerprints() map[string]string {
 // ClearSlowSQLFingerprints clear all slow sql fingerprints
 func (n *Namespace) ClearSlowSQLFingerprints() {
 	n.slowSQLCache.Clear()
+	if n.slowSQLExplainer != nil {
+		n.slowSQLExplainer.clear()
+	}
 }
 
 // SetErrorSQLFingerprint store error sql fingerprint
@@ -529,13 +1113,46 @@ func (n *Namespace) ClearBackendErrorSQLFingerprints() {
 func (n *Namespace) Close(delay bool) {
 	var err error
 	// close check alive
-	n.CloseCancel()
+	for k, cancel := range n.sliceCancels {
+		if !n.retainedSlices[k] {
+			cancel()
+		}
+	}
 
 	// delay close time
 	if delay {
-		time.Sleep(time.Second * namespaceDelayClose)
+		if remain := n.waitTransactions(time.Second*namespaceDelayClose, time.Second*namespaceMaxDelayClose); remain > 0 {
+			log.Warn("close ns:%s with %d transactions not finished in %ds", n.name, remain, namespaceMaxDelayClose)
+		}
+	}
+	if n.slowSQLReaper != nil {
+		n.slowSQLReaper.close()
+	}
+	if n.indexAdvisor != nil {
+		n.indexAdvisor.close()
+	}
+	if n.purger != nil {
+		n.purger.close()
+	}
+	if n.precreator != nil {
+		n.precreator.close()
+	}
+	if n.checksums != nil {
+		n.checksums.close()
+	}
+	if n.mirror != nil {
+		n.mirror.Close()
+	}
+	if n.binlogTailers != nil {
+		n.binlogTailers.close()
+	}
+	if n.cdc != nil {
+		n.cdc.Close()
 	}
 	for k := range n.slices {
+		if n.retainedSlices[k] {
+			continue
+		}
 		err = n.slices[k].Close()
 		if err != nil {
 			log.Warn("delay close slice: %s failed, err: %v", k, err)
@@ -546,26 +1163,116 @@ func (n *Namespace) Close(delay bool) {
 	n.errorSQLCache.Clear()
 	n.backendSlowSQLCache.Clear()
 	n.backendErrorSQLCache.Clear()
-	n.planCache.Clear()
+	if n.planCache != nil {
+		n.planCache.Clear()
+	}
+	if n.slowLogger != nil {
+		n.slowLogger.Close()
+	}
+	if n.captureWriter != nil {
+		n.captureWriter.Close()
+	}
 	_ = log.Warn("close ns:%s", n.name)
 }
 
-func (n *Namespace) CheckSliceStatus(ctx context.Context) {
+// waitTransactions wait at least minWait for running requests, then wait until all transactions
+// on the namespace end or maxWait passes, return number of transactions not finished.
+func (n *Namespace) waitTransactions(minWait, maxWait time.Duration) int64 {
+	start := time.Now()
+	time.Sleep(minWait)
+	for n.activeTxs.Get() > 0 && time.Since(start) < maxWait {
+		time.Sleep(waitTransactionsInterval)
+	}
+	return n.activeTxs.Get()
+}
+
+// checkSliceStatus start health check of slice, it's canceled when slice is closed with namespace
+func (n *Namespace) checkSliceStatus(name string, slice *backend.Slice) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Notice("checkSlicesStatus recover error: %s", err)
 		}
 	}()
 
-	for _, slice := range n.slices {
-		slice.CheckStatus(ctx, n.name, n.downAfterNoAlive, int(n.secondsBehindMaster))
+	ctx, cancel := context.WithCancel(context.TODO())
+	n.sliceCancels[name] = cancel
+	slice.CheckStatus(ctx, n.name, n.downAfterNoAlive, int(n.secondsBehindMaster))
+}
+
+// reusableSlices return slices of old namespace which can be reused if their config is not changed,
+// health check of slice depends on charset and down settings of namespace, so they should not change either.
+func (n *Namespace) reusableSlices(old *Namespace) map[string]*backend.Slice {
+	if old == nil ||
+		old.defaultCharset != n.defaultCharset ||
+		old.defaultCollationID != n.defaultCollationID ||
+		old.downAfterNoAlive != n.downAfterNoAlive ||
+		old.secondsBehindMaster != n.secondsBehindMaster {
+		return nil
 	}
+	return old.slices
 }
 
-func parseSlice(cfg *models.Slice, charset string, collationID mysql.CollationID, dc string) (*backend.Slice, error) {
+// retainSlices mark slices shared with new namespace, they are not closed with the namespace
+func (n *Namespace) retainSlices(newNamespace *Namespace) {
+	if newNamespace == nil {
+		return
+	}
+	retained := make(map[string]bool)
+	for name, slice := range n.slices {
+		if newNamespace.slices[name] == slice {
+			retained[name] = true
+		}
+	}
+	n.retainedSlices = retained
+}
+
+func parseUserACL(user *models.User) (map[string]bool, map[string]map[string]bool, error) {
+	var allowedDBs map[string]bool
+	if len(user.AllowedDBs) > 0 {
+		allowedDBs = make(map[string]bool, len(user.AllowedDBs))
+		for _, db := range user.AllowedDBs {
+			allowedDBs[strings.ToLower(strings.TrimSpace(db))] = true
+		}
+	}
+
+	var allowedTables map[string]map[string]bool
+	if len(user.AllowedTables) > 0 {
+		allowedTables = make(map[string]map[string]bool)
+		for _, t := range user.AllowedTables {
+			db, table, err := models.ParseAllowedTable(t)
+			if err != nil {
+				return nil, nil, err
+			}
+			if allowedTables[db] == nil {
+				allowedTables[db] = make(map[string]bool)
+			}
+			allowedTables[db][table] = true
+		}
+	}
+	return allowedDBs, allowedTables, nil
+}
+
+// resolveSliceConfig resolve secret uri of slice, config of namespace is not changed
+func resolveSliceConfig(cfg *models.Slice) (models.Slice, error) {
 	var err error
+	resolved := *cfg
+	if resolved.UserName, err = models.ResolveSecret(cfg.UserName); err != nil {
+		return resolved, fmt.Errorf("resolve user name of slice %s error: %v", cfg.Name, err)
+	}
+	if resolved.Password, err = models.ResolveSecret(cfg.Password); err != nil {
+		return resolved, fmt.Errorf("resolve password of slice %s error: %v", cfg.Name, err)
+	}
+	return resolved, nil
+}
+
+func parseSlice(cfg models.Slice, charset string, collationID mysql.CollationID, dc string) (*backend.Slice, error) {
+	// namespace config loaded by proxy is not verified, compress unsupported should not fall back to zlib
+	err := models.VerifyCompress(cfg.Compress)
+	if err != nil {
+		return nil, err
+	}
 	s := new(backend.Slice)
-	s.Cfg = *cfg
+	s.Cfg = cfg
 	s.ProxyDatacenter = dc
 	s.SetCharsetInfo(charset, collationID)
 	s.HealthCheckSql = cfg.HealthCheckSql
@@ -591,23 +1298,49 @@ func parseSlice(cfg *models.Slice, charset string, collationID mysql.CollationID
 	return s, nil
 }
 
-func parseSlices(cfgSlices []*models.Slice, charset string, collationID mysql.CollationID, dc string) (map[string]*backend.Slice, error) {
+// parseSlices create slices by config, slice in reusable with the same config is reused rather than created,
+// return names of reused slices. Slices created are closed if error occurs.
+func parseSlices(cfgSlices []*models.Slice, charset string, collationID mysql.CollationID, dc string, reusable map[string]*backend.Slice) (map[string]*backend.Slice, map[string]bool, error) {
 	slices := make(map[string]*backend.Slice, len(cfgSlices))
+	reused := make(map[string]bool)
+	closeCreated := func() {
+		for name, s := range slices {
+			if !reused[name] {
+				s.Close()
+			}
+		}
+	}
+
 	for _, v := range cfgSlices {
 		v.Name = strings.TrimSpace(v.Name) // modify origin slice name, trim space
 		if _, ok := slices[v.Name]; ok {
-			return nil, fmt.Errorf("duplicate slice [%s]", v.Name)
+			closeCreated()
+			return nil, nil, fmt.Errorf("duplicate slice [%s]", v.Name)
 		}
 
-		s, err := parseSlice(v, charset, collationID, dc)
+		cfg, err := resolveSliceConfig(v)
 		if err != nil {
-			return nil, err
+			closeCreated()
+			return nil, nil, err
+		}
+
+		if old, ok := reusable[v.Name]; ok && bytes.Equal(models.JSONEncode(&old.Cfg), models.JSONEncode(&cfg)) {
+			log.Notice("slice %s is not changed, reuse it", v.Name)
+			slices[v.Name] = old
+			reused[v.Name] = true
+			continue
+		}
+
+		s, err := parseSlice(cfg, charset, collationID, dc)
+		if err != nil {
+			closeCreated()
+			return nil, nil, err
 		}
 
 		slices[v.Name] = s
 	}
 
-	return slices, nil
+	return slices, reused, nil
 }
 
 func parseAllowIps(allowedIP []string) ([]util.IPInfo, error) {
@@ -640,6 +1373,14 @@ func parseBlackSqls(sqls []string) map[string]string {
 	return sqlMap
 }
 
+// parseSlowSQLKillTime return kill time of user, kill time of namespace is used if user's is not set
+func parseSlowSQLKillTime(user *models.User, nsKillTime int) time.Duration {
+	if user.SlowSQLKillTime > 0 {
+		return time.Duration(user.SlowSQLKillTime) * time.Millisecond
+	}
+	return time.Duration(nsKillTime) * time.Millisecond
+}
+
 func parseSlowSQLTime(str string) (int64, error) {
 	if str == "" {
 		return defaultSlowSQLTime, nil
@@ -0,0 +1,101 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// runtime modes of namespace, switched by admin api
+const (
+	namespaceModeNormal      = "normal"
+	namespaceModeReadOnly    = "readonly"    // dml and ddl are rejected
+	namespaceModeMaintenance = "maintenance" // all new queries except commit and rollback are rejected
+)
+
+const (
+	defaultReadOnlyMessage    = "namespace is read only"
+	defaultMaintenanceMessage = "namespace is under maintenance"
+)
+
+type namespaceModeState struct {
+	mode    string
+	message string // error message returned to client for rejected queries
+}
+
+// namespaceMode runtime mode of namespace, it's shared by namespaces rebuilt from the same name
+// so that the mode is kept across reloads, but it's not persisted and reset to normal on restart
+type namespaceMode struct {
+	state atomic.Value // *namespaceModeState
+}
+
+func newNamespaceMode() *namespaceMode {
+	m := &namespaceMode{}
+	m.state.Store(&namespaceModeState{mode: namespaceModeNormal})
+	return m
+}
+
+// get return current mode and message
+func (m *namespaceMode) get() (string, string) {
+	s := m.state.Load().(*namespaceModeState)
+	return s.mode, s.message
+}
+
+// set switch mode, default message of mode is used if message is empty
+func (m *namespaceMode) set(mode, message string) error {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	message = strings.TrimSpace(message)
+	switch mode {
+	case namespaceModeNormal:
+		message = ""
+	case namespaceModeReadOnly:
+		if message == "" {
+			message = defaultReadOnlyMessage
+		}
+	case namespaceModeMaintenance:
+		if message == "" {
+			message = defaultMaintenanceMessage
+		}
+	default:
+		return fmt.Errorf("invalid namespace mode: %s", mode)
+	}
+	m.state.Store(&namespaceModeState{mode: mode, message: message})
+	return nil
+}
+
+// check return error if statement is rejected by current mode, queries being executed are not affected,
+// commit and rollback are allowed in maintenance mode so that open transactions can be finished
+func (m *namespaceMode) check(stmtType int) error {
+	s := m.state.Load().(*namespaceModeState)
+	switch s.mode {
+	case namespaceModeReadOnly:
+		switch stmtType {
+		case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete, parser.StmtDDL:
+			return mysql.NewError(mysql.ErrOptionPreventsStatement, s.message)
+		}
+	case namespaceModeMaintenance:
+		switch stmtType {
+		case parser.StmtCommit, parser.StmtRollback:
+		default:
+			return mysql.NewError(mysql.ErrUnknown, s.message)
+		}
+	}
+	return nil
+}
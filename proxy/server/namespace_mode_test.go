@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceMode(t *testing.T) {
+	m := newNamespaceMode()
+	mode, message := m.get()
+	assert.Equal(t, namespaceModeNormal, mode)
+	assert.Equal(t, "", message)
+	assert.Nil(t, m.check(parser.StmtInsert))
+	assert.Nil(t, m.check(parser.StmtDDL))
+
+	assert.Nil(t, m.set(" ReadOnly ", ""))
+	mode, message = m.get()
+	assert.Equal(t, namespaceModeReadOnly, mode)
+	assert.Equal(t, defaultReadOnlyMessage, message)
+	for _, stmtType := range []int{parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete, parser.StmtDDL} {
+		err := m.check(stmtType)
+		if assert.IsType(t, &mysql.SQLError{}, err) {
+			assert.Equal(t, uint16(mysql.ErrOptionPreventsStatement), err.(*mysql.SQLError).Code)
+			assert.Equal(t, defaultReadOnlyMessage, err.(*mysql.SQLError).Message)
+		}
+	}
+	assert.Nil(t, m.check(parser.StmtSelect))
+	assert.Nil(t, m.check(parser.StmtBegin))
+
+	assert.Nil(t, m.set(namespaceModeMaintenance, "backend upgrading"))
+	for _, stmtType := range []int{parser.StmtSelect, parser.StmtBegin, parser.StmtSet, parser.StmtInsert} {
+		err := m.check(stmtType)
+		if assert.IsType(t, &mysql.SQLError{}, err) {
+			assert.Equal(t, "backend upgrading", err.(*mysql.SQLError).Message)
+		}
+	}
+	assert.Nil(t, m.check(parser.StmtCommit))
+	assert.Nil(t, m.check(parser.StmtRollback))
+
+	assert.NotNil(t, m.set("offline", ""))
+	mode, _ = m.get()
+	assert.Equal(t, namespaceModeMaintenance, mode)
+
+	assert.Nil(t, m.set(namespaceModeNormal, "ignored"))
+	mode, message = m.get()
+	assert.Equal(t, namespaceModeNormal, mode)
+	assert.Equal(t, "", message)
+	assert.Nil(t, m.check(parser.StmtSelect))
+}
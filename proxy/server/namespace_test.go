@@ -1,9 +1,16 @@
 package server
 
 import (
-	"github.com/XiaoMi/Gaea/models"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log/slowlog"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
 )
 
 type phyDBCase struct {
@@ -33,3 +40,240 @@ func TestParsePhyDBs(t *testing.T) {
 		})
 	}
 }
+
+func TestUserACL(t *testing.T) {
+	allowedDBs, allowedTables, err := parseUserACL(&models.User{
+		UserName:      "u1",
+		AllowedDBs:    []string{"DB1", "db2"},
+		AllowedTables: []string{"db1.T1", "db2.*"},
+	})
+	if err != nil {
+		t.Fatalf("parse user acl error: %v", err)
+	}
+	n := &Namespace{userProperties: map[string]*UserProperty{
+		"u1": {allowedDBs: allowedDBs, allowedTables: allowedTables},
+		"u2": {},
+	}}
+
+	if !n.hasUserACL("u1") || n.hasUserACL("u2") {
+		t.Errorf("hasUserACL error")
+	}
+
+	dbCases := []struct {
+		user    string
+		db      string
+		allowed bool
+	}{
+		{"u1", "db1", true},
+		{"u1", "Db2", true},
+		{"u1", "db3", false},
+		{"u2", "db3", true},
+	}
+	for _, c := range dbCases {
+		if n.IsUserAllowedDB(c.user, c.db) != c.allowed {
+			t.Errorf("IsUserAllowedDB error, user: %s, db: %s, expect: %v", c.user, c.db, c.allowed)
+		}
+	}
+
+	tableCases := []struct {
+		user    string
+		db      string
+		table   string
+		allowed bool
+	}{
+		{"u1", "db1", "t1", true},
+		{"u1", "DB1", "T1", true},
+		{"u1", "db1", "t2", false},
+		{"u1", "db2", "any", true},
+		{"u1", "db3", "t1", false},
+		{"u2", "db3", "t1", true},
+	}
+	for _, c := range tableCases {
+		if n.IsUserAllowedTable(c.user, c.db, c.table) != c.allowed {
+			t.Errorf("IsUserAllowedTable error, user: %s, db: %s, table: %s, expect: %v", c.user, c.db, c.table, c.allowed)
+		}
+	}
+}
+
+func TestReuseUnchangedSlices(t *testing.T) {
+	oldNs, err := NewNamespace(initNamespaceConfig(), "")
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+
+	cfg := initNamespaceConfig()
+	cfg.Slices[1].Slaves = []string{"127.0.0.1:13308"}
+	newNs, err := newNamespace(cfg, "", oldNs)
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+	if newNs.GetSlice("slice-0") != oldNs.GetSlice("slice-0") {
+		t.Errorf("unchanged slice-0 should be reused")
+	}
+	if newNs.GetSlice("slice-1") == oldNs.GetSlice("slice-1") {
+		t.Errorf("changed slice-1 should be rebuilt")
+	}
+
+	oldNs.retainSlices(newNs)
+	if !reflect.DeepEqual(oldNs.retainedSlices, map[string]bool{"slice-0": true}) {
+		t.Errorf("retained slices error, %v", oldNs.retainedSlices)
+	}
+	oldNs.Close(false)
+	newNs.Close(false)
+
+	// slices are rebuilt if charset of namespace changes
+	oldNs, err = NewNamespace(initNamespaceConfig(), "")
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+	cfg = initNamespaceConfig()
+	cfg.DefaultCharset = "utf8mb4"
+	newNs, err = newNamespace(cfg, "", oldNs)
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+	if newNs.GetSlice("slice-0") == oldNs.GetSlice("slice-0") {
+		t.Errorf("slice-0 should be rebuilt")
+	}
+	oldNs.Close(false)
+	newNs.Close(false)
+}
+
+func TestWaitTransactions(t *testing.T) {
+	n := &Namespace{}
+	n.activeTxs.Add(1)
+	if remain := n.waitTransactions(10*time.Millisecond, 30*time.Millisecond); remain != 1 {
+		t.Errorf("transaction should not finish, remain: %d", remain)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		n.activeTxs.Add(-1)
+	}()
+	if remain := n.waitTransactions(10*time.Millisecond, 5*time.Second); remain != 0 {
+		t.Errorf("transaction should finish, remain: %d", remain)
+	}
+}
+
+func TestUserConnectionLimit(t *testing.T) {
+	cfg := initNamespaceConfig()
+	cfg.SessionIdleTimeout = 30
+	cfg.Users[0].MaxConnections = 2
+	ns, err := NewNamespace(cfg, "")
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+	defer ns.Close(false)
+
+	if ns.sessionIdleTimeout != 30*time.Minute {
+		t.Errorf("session idle timeout error: %v", ns.sessionIdleTimeout)
+	}
+	if max := ns.getUserMaxConnections(cfg.Users[0].UserName); max != 2 {
+		t.Errorf("max connections of user error: %d", max)
+	}
+	if max := ns.getUserMaxConnections(cfg.Users[1].UserName); max != 0 {
+		t.Errorf("max connections of user without limit error: %d", max)
+	}
+
+	stats := &StatisticManager{}
+	user := cfg.Users[0].UserName
+	stats.IncrUserConnectionCount(ns.name, user)
+	stats.IncrUserConnectionCount(ns.name, user)
+	stats.DescUserConnectionCount(ns.name, user)
+	stats.DescUserConnectionCount(ns.name, cfg.Users[1].UserName)
+	if n := stats.GetUserConnectionCount(ns.name, user); n != 1 {
+		t.Errorf("connections of user error: %d", n)
+	}
+	connections := ns.getUserConnections(stats)
+	if connections[user] != 1 || connections[cfg.Users[1].UserName] != 0 {
+		t.Errorf("connections of users error: %v", connections)
+	}
+}
+
+func TestRedactLog(t *testing.T) {
+	sql := "insert into t(name, phone) values('alice', '13800000000')"
+	sqlErr := mysql.NewDefaultError(mysql.ErrDupEntry, "13800000000", "phone")
+
+	n := &Namespace{}
+	if ret := n.redactLogSQL(sql); ret != sql {
+		t.Errorf("sql should not be redacted, got: %s", ret)
+	}
+	if ret := n.redactLogError(sqlErr); ret != sqlErr {
+		t.Errorf("error should not be redacted, got: %v", ret)
+	}
+
+	n.logSQLFingerprint = true
+	if ret := n.redactLogSQL(sql); ret != "insert into t(name, phone) values(?+)" {
+		t.Errorf("sql should be redacted to fingerprint, got: %s", ret)
+	}
+	if ret := n.redactLogError(sqlErr).Error(); ret != "ERROR 1062 (23000)" {
+		t.Errorf("mysql error should be redacted to code, got: %s", ret)
+	}
+	if ret := n.redactLogError(mysql.ErrBadConn).Error(); ret != mysql.ErrBadConn.Error() {
+		t.Errorf("error of proxy without literals should be kept, got: %v", ret)
+	}
+	planErr := fmt.Errorf("get plan error, db: db_ks, origin sql: %s, err: unknown column", sql)
+	if ret := n.redactLogError(planErr).Error(); ret != "get plan error, db: db_ks, origin sql: insert into t(name, phone) values(?+) err: unknown column" {
+		t.Errorf("literals in error of proxy should be redacted, got: %s", ret)
+	}
+	if ret := n.redactLogSQLs(map[string]map[string][]string{"slice-0": {"db_0": {sql}}}); ret["slice-0"]["db_0"][0] != "insert into t(name, phone) values(?+)" {
+		t.Errorf("sqls should be redacted to fingerprints, got: %v", ret)
+	}
+}
+
+func TestEnrichBackendError(t *testing.T) {
+	sqlErr := mysql.NewDefaultError(mysql.ErrNoSuchTable, "db_0", "t")
+
+	n := &Namespace{}
+	if ret := n.enrichBackendError(sqlErr, "slice-0", "db_0", "10.0.0.1:3306"); ret != sqlErr {
+		t.Errorf("error should not be enriched, got: %v", ret)
+	}
+
+	n.backendError = &models.BackendError{AddrAliases: map[string]string{"10.0.0.1:3306": "mysql-a"}}
+	tests := []struct {
+		addr   string
+		expect string
+	}{
+		{"10.0.0.1:3306", "Table 'db_0.t' doesn't exist [slice=slice-0 db=db_0 addr=mysql-a]"},
+		{"10.0.0.2:3306", "Table 'db_0.t' doesn't exist [slice=slice-0 db=db_0]"},
+	}
+	for _, test := range tests {
+		ret := n.enrichBackendError(sqlErr, "slice-0", "db_0", test.addr)
+		e, ok := ret.(*mysql.SQLError)
+		if !ok || e.Message != test.expect || e.Code != sqlErr.Code || e.State != sqlErr.State {
+			t.Errorf("enrich error of %s, expect: %s, got: %v", test.addr, test.expect, ret)
+		}
+	}
+	if sqlErr.Message != "Table 'db_0.t' doesn't exist" {
+		t.Errorf("original error should not be modified, got: %s", sqlErr.Message)
+	}
+
+	n.backendError.ShowAddr = true
+	if ret := n.enrichBackendError(sqlErr, "slice-0", "db_0", "10.0.0.2:3306"); ret.(*mysql.SQLError).Message != "Table 'db_0.t' doesn't exist [slice=slice-0 db=db_0 addr=10.0.0.2:3306]" {
+		t.Errorf("real addr should be shown, got: %v", ret)
+	}
+	if ret := n.enrichBackendError(mysql.ErrBadConn, "slice-0", "db_0", "10.0.0.2:3306"); ret != mysql.ErrBadConn {
+		t.Errorf("error of proxy should not be enriched, got: %v", ret)
+	}
+}
+
+func TestNamespaceSlowLogFile(t *testing.T) {
+	dir := t.TempDir()
+	old := slowLogDir.Get()
+	slowLogDir.Set(dir)
+	defer slowLogDir.Set(old)
+
+	cfg := initNamespaceConfig()
+	cfg.SlowLogFile = "slow.log"
+	ns, err := NewNamespace(cfg, "")
+	if err != nil {
+		t.Fatalf("create namespace error: %v", err)
+	}
+	defer ns.Close(false)
+	ns.writeSlowLog(&slowlog.Entry{StartTime: time.Now(), QueryTime: time.Second, User: "u", DB: "db", SQL: "select 1"})
+
+	// slow log file is relative to log directory of proxy
+	if _, err := os.Stat(filepath.Join(dir, "slow.log")); err != nil {
+		t.Errorf("slow log file should be created in log directory, err: %v", err)
+	}
+}
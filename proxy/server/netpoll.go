@@ -0,0 +1,154 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+const (
+	pollEventsSize = 128
+	// pollWaitTimeout bounds waiting of poller so that it can exit after closed, in milliseconds
+	pollWaitTimeout = 1000
+)
+
+var errSessionClosed = errors.New("session is closed")
+
+// sessionPoller parks idle sessions of netpoll frontend mode, a parked session has no goroutine
+// and is resumed in a new goroutine when its connection becomes readable.
+type sessionPoller struct {
+	fd       int
+	closed   sync2.AtomicBool
+	mu       sync.Mutex
+	sessions map[int]*Session // parked sessions by fd of connection
+}
+
+func newSessionPoller() (*sessionPoller, error) {
+	fd, err := pollCreate()
+	if err != nil {
+		return nil, err
+	}
+	p := &sessionPoller{fd: fd, sessions: make(map[int]*Session)}
+	go p.run()
+	return p, nil
+}
+
+// pollableConn return connection whose fd can be added to poller, connections wrapped with buffered data are not pollable
+func pollableConn(c net.Conn) syscall.Conn {
+	switch conn := c.(type) {
+	case *net.TCPConn:
+		return conn
+	case *net.UnixConn:
+		return conn
+	}
+	return nil
+}
+
+// park wait for next request of session in poller
+func (p *sessionPoller) park(cc *Session) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cc.IsClosed() {
+		return errSessionClosed
+	}
+	if cc.pollFD < 0 {
+		rc, err := cc.pollConn.SyscallConn()
+		if err != nil {
+			return err
+		}
+		if err = rc.Control(func(fd uintptr) { cc.pollFD = int(fd) }); err != nil {
+			return err
+		}
+	}
+
+	add := !cc.pollRegistered
+	cc.pollRegistered = true
+	p.sessions[cc.pollFD] = cc
+	if err := pollArm(p.fd, cc.pollFD, add); err != nil {
+		delete(p.sessions, cc.pollFD)
+		if add {
+			cc.pollRegistered = false
+		}
+		return err
+	}
+	return nil
+}
+
+// closeConn close connection of session, return true if the session is parked,
+// fd is removed from poller when it's closed so it's done with lock held.
+func (p *sessionPoller) closeConn(cc *Session) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	parked := false
+	if cc.pollFD >= 0 && p.sessions[cc.pollFD] == cc {
+		delete(p.sessions, cc.pollFD)
+		parked = true
+	}
+	cc.c.Close()
+	return parked
+}
+
+// parkedCount return count of parked sessions
+func (p *sessionPoller) parkedCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+func (p *sessionPoller) run() {
+	defer func() {
+		if err := recover(); err != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Fatal("[server] session poller panic: %v, stack: %s", err, string(buf))
+		}
+	}()
+
+	fds := make([]int, pollEventsSize)
+	for !p.closed.Get() {
+		n, err := pollWait(p.fd, fds, pollWaitTimeout)
+		if err != nil {
+			if p.closed.Get() {
+				return
+			}
+			log.Warn("[server] session poller wait error: %v", err)
+			continue
+		}
+		for _, fd := range fds[:n] {
+			p.mu.Lock()
+			cc, ok := p.sessions[fd]
+			delete(p.sessions, fd)
+			p.mu.Unlock()
+			if ok {
+				go cc.runPolled(true)
+			}
+		}
+	}
+}
+
+// Close stop poller, sessions parked are not closed
+func (p *sessionPoller) Close() error {
+	if !p.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return pollClose(p.fd)
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package server
+
+import "syscall"
+
+func pollCreate() (int, error) {
+	return syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+}
+
+// pollArm wait for readable event of fd, the event is reported once until fd is armed again
+func pollArm(pfd, fd int, add bool) error {
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT, Fd: int32(fd)}
+	op := syscall.EPOLL_CTL_MOD
+	if add {
+		op = syscall.EPOLL_CTL_ADD
+	}
+	return syscall.EpollCtl(pfd, op, fd, &ev)
+}
+
+// pollWait wait for readable fds at most timeout milliseconds, return count of fds
+func pollWait(pfd int, fds []int, timeout int) (int, error) {
+	events := make([]syscall.EpollEvent, len(fds))
+	n, err := syscall.EpollWait(pfd, events, timeout)
+	if err == syscall.EINTR {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < n; i++ {
+		fds[i] = int(events[i].Fd)
+	}
+	return n, nil
+}
+
+func pollClose(pfd int) error {
+	return syscall.Close(pfd)
+}
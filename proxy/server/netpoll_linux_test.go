@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTCPConnPair(t *testing.T) (*net.TCPConn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	server, err := l.Accept()
+	require.NoError(t, err)
+	return server.(*net.TCPConn), client
+}
+
+func connFD(t *testing.T, c *net.TCPConn) int {
+	rc, err := c.SyscallConn()
+	require.NoError(t, err)
+	var fd int
+	require.NoError(t, rc.Control(func(f uintptr) { fd = int(f) }))
+	return fd
+}
+
+func TestPollArmAndWait(t *testing.T) {
+	server, client := newTCPConnPair(t)
+	defer server.Close()
+	defer client.Close()
+	pfd, err := pollCreate()
+	require.NoError(t, err)
+	defer pollClose(pfd)
+
+	fd := connFD(t, server)
+	require.NoError(t, pollArm(pfd, fd, true))
+	fds := make([]int, 8)
+	n, err := pollWait(pfd, fds, 10)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	_, err = client.Write([]byte{1})
+	require.NoError(t, err)
+	n, err = pollWait(pfd, fds, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, fd, fds[0])
+
+	// event is reported once until fd is armed again
+	n, err = pollWait(pfd, fds, 10)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.NoError(t, pollArm(pfd, fd, false))
+	n, err = pollWait(pfd, fds, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestSessionPollerParkAndClose(t *testing.T) {
+	server, client := newTCPConnPair(t)
+	defer client.Close()
+	pfd, err := pollCreate()
+	require.NoError(t, err)
+	p := &sessionPoller{fd: pfd, sessions: make(map[int]*Session)}
+	defer p.Close()
+
+	require.NotNil(t, pollableConn(server))
+	require.Nil(t, pollableConn(&proxyProtocolConn{Conn: server}))
+	cc := &Session{c: NewClientConn(mysql.NewConn(server), nil), pollConn: pollableConn(server), pollFD: -1}
+	cc.closed.Store(false)
+
+	require.NoError(t, p.park(cc))
+	require.Equal(t, 1, p.parkedCount())
+	require.True(t, cc.pollRegistered)
+	require.Equal(t, connFD(t, server), cc.pollFD)
+
+	// parked session is reported by close
+	require.True(t, p.closeConn(cc))
+	require.Equal(t, 0, p.parkedCount())
+	require.False(t, p.closeConn(cc))
+
+	cc.closed.Store(true)
+	require.Equal(t, errSessionClosed, p.park(cc))
+	require.Equal(t, 0, p.parkedCount())
+}
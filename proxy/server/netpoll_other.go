@@ -0,0 +1,38 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package server
+
+import "errors"
+
+var errNetpollNotSupported = errors.New("netpoll frontend mode is only supported on linux")
+
+func pollCreate() (int, error) {
+	return -1, errNetpollNotSupported
+}
+
+func pollArm(pfd, fd int, add bool) error {
+	return errNetpollNotSupported
+}
+
+func pollWait(pfd int, fds []int, timeout int) (int, error) {
+	return 0, errNetpollNotSupported
+}
+
+func pollClose(pfd int) error {
+	return nil
+}
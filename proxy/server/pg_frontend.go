@@ -0,0 +1,567 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// experimental frontend of postgresql protocol v3, only simple query protocol is supported,
+// sqls are parsed and executed as mysql sqls.
+// https://www.postgresql.org/docs/current/protocol-flow.html
+
+const (
+	pgProtocolVersion = 196608 // 3.0
+	pgSSLRequest      = 80877103
+	pgGSSENCRequest   = 80877104
+
+	pgMaxStartupSize = 10000
+	pgMaxMessageSize = 64 << 20
+
+	pgServerVersion = "9.6.0"
+)
+
+// message types of frontend and backend
+const (
+	pgMsgQuery     = 'Q'
+	pgMsgPassword  = 'p'
+	pgMsgSync      = 'S'
+	pgMsgFlush     = 'H'
+	pgMsgTerminate = 'X'
+
+	pgMsgAuthentication  = 'R'
+	pgMsgParameterStatus = 'S'
+	pgMsgBackendKeyData  = 'K'
+	pgMsgReadyForQuery   = 'Z'
+	pgMsgRowDescription  = 'T'
+	pgMsgDataRow         = 'D'
+	pgMsgCommandComplete = 'C'
+	pgMsgEmptyQuery      = 'I'
+	pgMsgErrorResponse   = 'E'
+)
+
+// oids of types in pg_type
+const (
+	pgTypeInt8    = 20
+	pgTypeText    = 25
+	pgTypeFloat4  = 700
+	pgTypeFloat8  = 701
+	pgTypeNumeric = 1700
+)
+
+// pgSession serves client of postgresql protocol, queries are executed by executor of session like mysql clients
+type pgSession struct {
+	*Session
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	buf  []byte // message being written
+
+	skipUntilSync bool // error occurs in extended query, messages are discarded until sync
+}
+
+func newPGSession(s *Server, co net.Conn) *pgSession {
+	cc := newSession(s, co)
+	cc.executor.serverAddr = co.LocalAddr()
+	return &pgSession{
+		Session: cc,
+		conn:    co,
+		r:       bufio.NewReader(co),
+		w:       bufio.NewWriter(co),
+	}
+}
+
+func (s *Server) onPGConn(c net.Conn) {
+	ps := newPGSession(s, c)
+	defer func() {
+		if err := recover(); err != nil {
+			const size = 4096
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Warn("[server] onPGConn panic error, remoteAddr: %s, stack: %s", c.RemoteAddr().String(), string(buf))
+		}
+		ps.Close()
+	}()
+
+	if err := ps.startup(); err != nil {
+		if err != io.EOF {
+			log.Warn("[server] onPGConn error: %v", err)
+		}
+		return
+	}
+
+	ps.resetIdleTimer(ps.writeIdleError)
+	_ = s.manager.statistics.generalLogger.Notice("Connected - conn_id=%d, ns=%s, %s@%s/%s, protocol: postgresql",
+		ps.c.ConnectionID,
+		ps.executor.namespace,
+		ps.executor.user,
+		ps.executor.clientAddr,
+		ps.executor.db)
+
+	ps.run()
+}
+
+// startup handle startup message and cleartext password authentication
+func (ps *pgSession) startup() error {
+	var params map[string]string
+	for params == nil {
+		msg, err := ps.readStartupMessage()
+		if err != nil {
+			return err
+		}
+		switch code := binary.BigEndian.Uint32(msg); code {
+		case pgSSLRequest, pgGSSENCRequest:
+			// encryption is not supported, client may continue with plain connection
+			if _, err := ps.conn.Write([]byte{'N'}); err != nil {
+				return err
+			}
+		case pgProtocolVersion:
+			params = parsePGStartupParams(msg[4:])
+		default:
+			err := fmt.Errorf("unsupported frontend protocol %d.%d", code>>16, code&0xffff)
+			ps.writeError(err)
+			ps.w.Flush()
+			return err
+		}
+	}
+
+	ps.startMessage(pgMsgAuthentication)
+	ps.appendInt32(3) // cleartext password
+	if err := ps.finishMessage(); err != nil {
+		return err
+	}
+	if err := ps.w.Flush(); err != nil {
+		return err
+	}
+	typ, body, err := ps.readMessage()
+	if err != nil {
+		return err
+	}
+	if typ != pgMsgPassword {
+		return fmt.Errorf("expect password message, got %c", typ)
+	}
+
+	if err := ps.authenticate(params["user"], pgCString(body), params["database"]); err != nil {
+		ps.writeError(err)
+		ps.w.Flush()
+		return err
+	}
+
+	ps.startMessage(pgMsgAuthentication)
+	ps.appendInt32(0)
+	ps.finishMessage()
+	for _, kv := range [][2]string{
+		{"server_version", pgServerVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		ps.startMessage(pgMsgParameterStatus)
+		ps.appendString(kv[0])
+		ps.appendString(kv[1])
+		ps.finishMessage()
+	}
+	ps.startMessage(pgMsgBackendKeyData)
+	ps.appendInt32(int32(ps.c.GetConnectionID()))
+	ps.appendInt32(0)
+	ps.finishMessage()
+	return ps.writeReadyForQuery()
+}
+
+// authenticate check cleartext password and connection limit of namespace
+func (ps *pgSession) authenticate(user, password, db string) error {
+	if err := ps.login(user, password, db); err != nil {
+		return err
+	}
+	if reachLimit, connectionNum := ps.clientConnectionReachLimit(); reachLimit {
+		return mysql.NewError(mysql.ErrConCount, fmt.Sprintf("[ns:%s, %s@%s/%s] too many connections, current:%d, max:%d",
+			ps.namespace, user, ps.executor.clientAddr, db, connectionNum, ps.getNamespace().maxClientConnections))
+	}
+	if reachLimit, connectionNum, maxConnections := ps.userConnectionReachLimit(); reachLimit {
+		return mysql.NewError(mysql.ErrConCount, fmt.Sprintf("[ns:%s, %s@%s/%s] too many connections of user, current:%d, max:%d",
+			ps.namespace, user, ps.executor.clientAddr, db, connectionNum, maxConnections))
+	}
+	return nil
+}
+
+func (ps *pgSession) run() {
+	defer func() {
+		if err := recover(); err != nil {
+			const size = 4096
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Warn("[server] pgSession run panic error, error: %v, stack: %s", err, string(buf))
+		}
+		ps.Close()
+		ps.proxy.tw.Remove(ps.Session)
+		ps.manager.GetStatisticManager().DescSessionCount(ps.namespace)
+		ps.manager.GetStatisticManager().DescConnectionCount(ps.namespace)
+		ps.manager.GetStatisticManager().DescUserConnectionCount(ps.namespace, ps.executor.user)
+	}()
+
+	ps.manager.GetStatisticManager().IncrSessionCount(ps.namespace)
+	ps.manager.GetStatisticManager().IncrConnectionCount(ps.namespace)
+	ps.manager.GetStatisticManager().IncrUserConnectionCount(ps.namespace, ps.executor.user)
+
+	for !ps.IsClosed() {
+		ps.executor.nsChangeIndexOld = ps.executor.GetNamespace().namespaceChangeIndex
+		typ, body, err := ps.readMessage()
+		if err != nil {
+			ps.clearKsConns(ps.executor.nsChangeIndexOld)
+			return
+		}
+
+		ps.Lock()
+		ps.lastActive = time.Now()
+		ps.resetIdleTimer(ps.writeIdleError)
+		ps.manager.GetStatisticManager().AddReadFlowCount(ps.namespace, len(body)+5)
+		ps.executor.SetContextNamespace()
+		ps.clearKsConns(ps.executor.nsChangeIndexOld)
+		if typ == pgMsgTerminate {
+			ps.Unlock()
+			return
+		}
+
+		switch {
+		case typ == pgMsgSync:
+			ps.skipUntilSync = false
+			err = ps.writeReadyForQuery()
+		case ps.skipUntilSync:
+		case typ == pgMsgQuery:
+			err = ps.handleQuery(pgCString(body))
+		case typ == pgMsgFlush:
+			err = ps.w.Flush()
+		default:
+			// messages of extended query are discarded until sync as error occurs
+			ps.skipUntilSync = true
+			err = ps.writeError(fmt.Errorf("message type %c is not supported, only simple query protocol is supported", typ))
+			if err == nil {
+				err = ps.w.Flush()
+			}
+		}
+		ps.lastActive = time.Now()
+		ps.Unlock()
+		if err != nil {
+			log.Warn("pgSession write response error, connId: %d, err: %v", ps.c.GetConnectionID(), err)
+			ps.clearKsConns(ps.executor.nsChangeIndexOld)
+			return
+		}
+		if ps.shouldClearKsAndCloseSession(ps.executor.nsChangeIndexOld) {
+			return
+		}
+	}
+}
+
+func (ps *pgSession) handleQuery(sql string) error {
+	defer func() {
+		ps.executor.releaseResultMemory()
+		ps.executor.releaseQuerySlot()
+		ps.executor.recycleBackendConn(ps.continueConn)
+		ps.continueConn = nil
+	}()
+
+	if strings.TrimSpace(strings.TrimRight(strings.TrimSpace(sql), ";")) == "" {
+		ps.startMessage(pgMsgEmptyQuery)
+		ps.finishMessage()
+		return ps.writeReadyForQuery()
+	}
+
+	r, err := ps.executor.handleQuery(sql)
+	if err != nil {
+		ps.writeError(err)
+		if _, ok := err.(mysql.SessionCloseError); ok {
+			ps.w.Flush()
+			return err
+		}
+		return ps.writeReadyForQuery()
+	}
+	if err = ps.writeResult(sql, r); err != nil {
+		return err
+	}
+	return ps.writeReadyForQuery()
+}
+
+// writeResult write result of sql, rows left in continueConn are written too
+func (ps *pgSession) writeResult(sql string, r *mysql.Result) error {
+	if r == nil || r.Resultset == nil {
+		var affectedRows uint64
+		if r != nil {
+			affectedRows = r.AffectedRows
+			r.Free()
+		}
+		return ps.writeCommandComplete(pgCommandTag(sql, affectedRows))
+	}
+
+	fields := r.Fields
+	if err := ps.writeRowDescription(fields); err != nil {
+		r.Free()
+		return err
+	}
+	count, err := ps.writeRows(fields, r.RowDatas)
+	r.Free()
+	if err != nil {
+		return err
+	}
+	if pc := ps.continueConn; pc != nil {
+		for pc.MoreRowsExist() {
+			result := mysql.ResultPool.Get()
+			result.Resultset = &mysql.Resultset{Fields: fields}
+			err = pc.FetchMoreRows(result, ps.getNamespace().GetMaxResultSize())
+			if err != nil {
+				result.Free()
+				return err
+			}
+			ps.executor.rewriteResultRows(result)
+			n, err := ps.writeRows(fields, result.RowDatas)
+			result.Free()
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+	}
+	if err = ps.writeCommandComplete("SELECT " + strconv.Itoa(count)); err != nil {
+		return err
+	}
+
+	// results of multi statements in a procedure
+	if pc := ps.continueConn; pc != nil {
+		for pc.MoreResultsExist() {
+			rs, err := pc.ReadMoreResult(ps.getNamespace().GetMaxResultSize())
+			if err != nil {
+				return fmt.Errorf("readMoreresult error: %v", err)
+			}
+			if err = ps.writeResult(sql, rs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ps *pgSession) writeRowDescription(fields []*mysql.Field) error {
+	ps.startMessage(pgMsgRowDescription)
+	ps.appendInt16(int16(len(fields)))
+	for _, f := range fields {
+		ps.appendString(string(f.Name))
+		ps.appendInt32(0) // table oid
+		ps.appendInt16(0) // column number
+		oid, size := pgType(f)
+		ps.appendInt32(oid)
+		ps.appendInt16(size)
+		ps.appendInt32(-1) // type modifier
+		ps.appendInt16(0)  // text format
+	}
+	return ps.finishMessage()
+}
+
+// writeRows write rows of mysql text protocol as data rows
+func (ps *pgSession) writeRows(fields []*mysql.Field, rows []mysql.RowData) (int, error) {
+	size := 0
+	for _, row := range rows {
+		ps.startMessage(pgMsgDataRow)
+		ps.appendInt16(int16(len(fields)))
+		pos := 0
+		for range fields {
+			v, next, isNull, ok := mysql.ReadLenEncStringAsBytes(row, pos)
+			if !ok {
+				return 0, fmt.Errorf("invalid row data")
+			}
+			pos = next
+			if isNull {
+				ps.appendInt32(-1)
+				continue
+			}
+			ps.appendInt32(int32(len(v)))
+			ps.buf = append(ps.buf, v...)
+		}
+		size += len(ps.buf)
+		if err := ps.finishMessage(); err != nil {
+			return 0, err
+		}
+	}
+	ps.manager.GetStatisticManager().AddWriteFlowCount(ps.namespace, size)
+	return len(rows), nil
+}
+
+func (ps *pgSession) writeCommandComplete(tag string) error {
+	ps.startMessage(pgMsgCommandComplete)
+	ps.appendString(tag)
+	return ps.finishMessage()
+}
+
+func (ps *pgSession) writeReadyForQuery() error {
+	status := byte('I')
+	if ps.executor.isInTransaction() {
+		status = 'T'
+	}
+	ps.startMessage(pgMsgReadyForQuery)
+	ps.buf = append(ps.buf, status)
+	if err := ps.finishMessage(); err != nil {
+		return err
+	}
+	return ps.w.Flush()
+}
+
+// writeIdleError write error response to client before idle session is closed
+func (ps *pgSession) writeIdleError(err error) error {
+	if e := ps.writeError(err); e != nil {
+		return e
+	}
+	return ps.w.Flush()
+}
+
+// writeError write error response, sqlstate of mysql error is kept as it has the same format
+func (ps *pgSession) writeError(err error) error {
+	code := "XX000"
+	msg := err.Error()
+	if e, ok := err.(*mysql.SQLError); ok {
+		msg = e.Message
+		if len(e.State) == 5 {
+			code = e.State
+		}
+	}
+	ps.startMessage(pgMsgErrorResponse)
+	for _, field := range [][2]string{{"S", "ERROR"}, {"V", "ERROR"}, {"C", code}, {"M", msg}} {
+		ps.buf = append(ps.buf, field[0][0])
+		ps.appendString(field[1])
+	}
+	ps.buf = append(ps.buf, 0)
+	return ps.finishMessage()
+}
+
+func (ps *pgSession) startMessage(typ byte) {
+	ps.buf = append(ps.buf[:0], typ, 0, 0, 0, 0)
+}
+
+func (ps *pgSession) appendInt16(v int16) {
+	ps.buf = append(ps.buf, byte(v>>8), byte(v))
+}
+
+func (ps *pgSession) appendInt32(v int32) {
+	ps.buf = append(ps.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (ps *pgSession) appendString(s string) {
+	ps.buf = append(ps.buf, s...)
+	ps.buf = append(ps.buf, 0)
+}
+
+// finishMessage set length of message and write it to buffer, it's sent by flush
+func (ps *pgSession) finishMessage() error {
+	binary.BigEndian.PutUint32(ps.buf[1:], uint32(len(ps.buf)-1))
+	_, err := ps.w.Write(ps.buf)
+	return err
+}
+
+func (ps *pgSession) readStartupMessage() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(ps.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size < 8 || size > pgMaxStartupSize {
+		return nil, fmt.Errorf("invalid length of startup message: %d", size)
+	}
+	msg := make([]byte, size-4)
+	if _, err := io.ReadFull(ps.r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (ps *pgSession) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(ps.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[1:]))
+	if size < 4 || size > pgMaxMessageSize {
+		return 0, nil, fmt.Errorf("invalid length of message: %d", size)
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(ps.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// parsePGStartupParams parse name and value pairs of startup message
+func parsePGStartupParams(data []byte) map[string]string {
+	params := make(map[string]string)
+	parts := bytes.Split(data, []byte{0})
+	for i := 0; i+1 < len(parts); i += 2 {
+		if len(parts[i]) == 0 {
+			break
+		}
+		params[string(parts[i])] = string(parts[i+1])
+	}
+	return params
+}
+
+// pgCString return string before the first null byte
+func pgCString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+// pgType return oid and size of mysql field, values are sent in text format of mysql
+func pgType(f *mysql.Field) (int32, int16) {
+	switch f.Type {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+		return pgTypeInt8, 8
+	case mysql.TypeFloat:
+		return pgTypeFloat4, 4
+	case mysql.TypeDouble:
+		return pgTypeFloat8, 8
+	case mysql.TypeDecimal, mysql.TypeNewDecimal:
+		return pgTypeNumeric, -1
+	default:
+		return pgTypeText, -1
+	}
+}
+
+// pgCommandTag return tag of command complete, rows are affected rows of dml
+func pgCommandTag(sql string, affectedRows uint64) string {
+	switch parser.Preview(sql) {
+	case parser.StmtInsert, parser.StmtReplace:
+		return "INSERT 0 " + strconv.FormatUint(affectedRows, 10)
+	case parser.StmtUpdate:
+		return "UPDATE " + strconv.FormatUint(affectedRows, 10)
+	case parser.StmtDelete:
+		return "DELETE " + strconv.FormatUint(affectedRows, 10)
+	}
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		return strings.ToUpper(strings.TrimRight(fields[0], ";"))
+	}
+	return ""
+}
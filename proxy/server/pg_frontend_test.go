@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePGStartupParams(t *testing.T) {
+	data := []byte("user\x00root\x00database\x00db_0\x00application_name\x00psql\x00\x00")
+	assert.Equal(t, map[string]string{"user": "root", "database": "db_0", "application_name": "psql"}, parsePGStartupParams(data))
+	assert.Equal(t, map[string]string{}, parsePGStartupParams([]byte{0}))
+	assert.Equal(t, "select 1", pgCString([]byte("select 1\x00")))
+}
+
+func TestPGCommandTag(t *testing.T) {
+	tests := []struct {
+		sql          string
+		affectedRows uint64
+		tag          string
+	}{
+		{"insert into t values (1), (2)", 2, "INSERT 0 2"},
+		{"replace into t values (1)", 1, "INSERT 0 1"},
+		{"/* comment */ update t set a = 1", 3, "UPDATE 3"},
+		{"delete from t", 0, "DELETE 0"},
+		{"begin", 0, "BEGIN"},
+		{"set autocommit = 0", 0, "SET"},
+		{"commit;", 0, "COMMIT"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.tag, pgCommandTag(test.sql, test.affectedRows), test.sql)
+	}
+}
+
+func TestPGType(t *testing.T) {
+	oid, size := pgType(&mysql.Field{Type: mysql.TypeLonglong})
+	assert.Equal(t, int32(pgTypeInt8), oid)
+	assert.Equal(t, int16(8), size)
+	oid, _ = pgType(&mysql.Field{Type: mysql.TypeNewDecimal})
+	assert.Equal(t, int32(pgTypeNumeric), oid)
+	oid, size = pgType(&mysql.Field{Type: mysql.TypeDatetime})
+	assert.Equal(t, int32(pgTypeText), oid)
+	assert.Equal(t, int16(-1), size)
+}
+
+// readPGMessages split backend messages into types and bodies
+func readPGMessages(data []byte) ([]byte, [][]byte) {
+	var types []byte
+	var bodies [][]byte
+	for len(data) >= 5 {
+		size := int(binary.BigEndian.Uint32(data[1:]))
+		types = append(types, data[0])
+		bodies = append(bodies, data[5:1+size])
+		data = data[1+size:]
+	}
+	return types, bodies
+}
+
+func TestPGSessionWriteMessages(t *testing.T) {
+	var out bytes.Buffer
+	ps := &pgSession{w: bufio.NewWriter(&out)}
+
+	fields := []*mysql.Field{{Name: []byte("id"), Type: mysql.TypeLonglong}, {Name: []byte("name"), Type: mysql.TypeVarString}}
+	assert.Nil(t, ps.writeRowDescription(fields))
+	assert.Nil(t, ps.writeCommandComplete("SELECT 0"))
+	assert.Nil(t, ps.writeError(mysql.NewError(mysql.ErrNoSuchTable, "Table 'db.t' doesn't exist")))
+	assert.Nil(t, ps.w.Flush())
+
+	types, bodies := readPGMessages(out.Bytes())
+	assert.Equal(t, []byte{pgMsgRowDescription, pgMsgCommandComplete, pgMsgErrorResponse}, types)
+
+	desc := bodies[0]
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(desc))
+	assert.Equal(t, "id", pgCString(desc[2:]))
+	assert.Equal(t, uint32(pgTypeInt8), binary.BigEndian.Uint32(desc[2+3+6:]))
+
+	assert.Equal(t, "SELECT 0\x00", string(bodies[1]))
+	assert.Contains(t, string(bodies[2]), "C42S02\x00")
+	assert.Contains(t, string(bodies[2]), "MTable 'db.t' doesn't exist\x00")
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+// sessionPlanCacheCapacity max templates kept by session, they are dropped at once when it's full
+const sessionPlanCacheCapacity = 32
+
+// planTemplate literal independent part of plan, shared by statements with the same parameterized sql.
+// only unshard plans whose sql needs no rewriting are cached, they are bound by sql of the statement.
+// plans of sharding tables are built for each statement, because routing depends on sharding key values.
+type planTemplate struct {
+	tables []string // tables of statement, used by table stats, mirror and cdc
+}
+
+// Size implement cache.Value
+func (t *planTemplate) Size() int {
+	return 1
+}
+
+// sessionPlanCache session local templates in front of plan cache of namespace,
+// so that hot statements of session are found without locking the shared cache
+type sessionPlanCache struct {
+	ns        *Namespace // templates are dropped when namespace is reloaded
+	templates map[string]*planTemplate
+}
+
+func (c *sessionPlanCache) get(ns *Namespace, key string) (*planTemplate, bool) {
+	if c.ns != ns {
+		c.ns = ns
+		c.templates = nil
+		return nil, false
+	}
+	t, ok := c.templates[key]
+	return t, ok
+}
+
+func (c *sessionPlanCache) set(key string, t *planTemplate) {
+	if c.templates == nil || len(c.templates) >= sessionPlanCacheCapacity {
+		c.templates = make(map[string]*planTemplate, sessionPlanCacheCapacity)
+	}
+	c.templates[key] = t
+}
+
+// planCacheKey return key of plan template, false if plan cache is disabled or plan of sql may depend on literals
+func planCacheKey(ns *Namespace, db, sql string) (string, bool) {
+	if ns.planCache == nil {
+		return "", false
+	}
+	// mycat hint plan and information schema plan are built from literals
+	if strings.Contains(sql, mycatHint) || strings.Contains(strings.ToLower(sql), plan.InformationSchemaDB) {
+		return "", false
+	}
+	psql, ok := parser.ParameterizeSQL(sql)
+	if !ok {
+		return "", false
+	}
+	return db + "|" + psql, true
+}
+
+// getPlanTemplate find template in session cache, then in namespace cache
+func (se *SessionExecutor) getPlanTemplate(ns *Namespace, key string) (*planTemplate, bool) {
+	if t, ok := se.planTemplates.get(ns, key); ok {
+		return t, true
+	}
+	t, ok := ns.getPlanTemplate(key)
+	if ok {
+		se.planTemplates.set(key, t)
+	}
+	return t, ok
+}
+
+// setPlanTemplate cache template of plan if it can be reused by statements differing only in literals
+func (se *SessionExecutor) setPlanTemplate(ns *Namespace, key string, p plan.Plan, tables []string) {
+	up, ok := p.(*plan.UnshardPlan)
+	if !ok || up.IsRewritten() || up.NeedFoundRowsCount() {
+		return
+	}
+	t := &planTemplate{tables: tables}
+	ns.setPlanTemplate(key, t)
+	if se.planTemplates.ns == ns {
+		se.planTemplates.set(key, t)
+	}
+}
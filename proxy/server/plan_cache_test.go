@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanCacheKey(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.PlanCacheCapacity = 16
+	})
+	require.NoError(t, err)
+	ns := se.GetNamespace()
+
+	key1, ok := planCacheKey(ns, "db_ks", "select * from t where id = 1")
+	assert.True(t, ok)
+	key2, ok := planCacheKey(ns, "db_ks", "select * from t where id = 'a'")
+	assert.True(t, ok)
+	assert.Equal(t, key1, key2)
+	key3, _ := planCacheKey(ns, "db_mycat", "select * from t where id = 1")
+	assert.NotEqual(t, key1, key3)
+
+	_, ok = planCacheKey(ns, "db_ks", "/* !mycat:sql=select * from t where id = 1 */ select * from t")
+	assert.False(t, ok)
+	_, ok = planCacheKey(ns, "db_ks", "select * from INFORMATION_SCHEMA.tables where table_name = 't'")
+	assert.False(t, ok)
+
+	se, err = newDefaultSessionExecutor(nil)
+	require.NoError(t, err)
+	_, ok = planCacheKey(se.GetNamespace(), "db_ks", "select * from t where id = 1")
+	assert.False(t, ok)
+}
+
+func TestGetPlanWithTemplate(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.PlanCacheCapacity = 16
+		ns.TableStatsCapacity = 16
+	})
+	require.NoError(t, err)
+	ns := se.GetNamespace()
+
+	getPlan := func(sql string) (plan.Plan, *util.RequestContext) {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.Preview(sql))
+		p, err := se.getPlan(reqCtx, ns, "db_ks", sql, false)
+		require.NoError(t, err)
+		return p, reqCtx
+	}
+
+	p, reqCtx := getPlan("select * from tbl_unshard where id = 1")
+	assert.IsType(t, &plan.UnshardPlan{}, p)
+	tables := reqCtx.GetTables()
+	assert.NotEmpty(t, tables)
+
+	key, _ := planCacheKey(ns, "db_ks", "select * from tbl_unshard where id = 2")
+	_, ok := ns.getPlanTemplate(key)
+	assert.True(t, ok)
+	_, ok = se.planTemplates.get(ns, key)
+	assert.True(t, ok)
+
+	// plan is bound from template
+	p, reqCtx = getPlan("select * from tbl_unshard where id = 2")
+	assert.IsType(t, &plan.UnshardPlan{}, p)
+	assert.Equal(t, tables, reqCtx.GetTables())
+
+	// plan of sharding table depends on literals
+	p, _ = getPlan("select * from tbl_ks where id = 1")
+	assert.IsType(t, &plan.SelectPlan{}, p)
+	key, _ = planCacheKey(ns, "db_ks", "select * from tbl_ks where id = 1")
+	_, ok = ns.getPlanTemplate(key)
+	assert.False(t, ok)
+
+	// session templates are dropped when namespace is changed
+	_, ok = se.planTemplates.get(&Namespace{}, key)
+	assert.False(t, ok)
+	assert.Nil(t, se.planTemplates.templates)
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// precreateInterval interval of creating sub tables of future periods
+const precreateInterval = time.Hour
+
+// precreateTable date sharded table whose sub tables of future periods are created ahead
+type precreateTable struct {
+	db      string
+	table   string
+	periods int
+}
+
+// precreator create sub tables of current and future periods of date sharded tables by CREATE TABLE LIKE the latest
+// sub table in the same slice. Sub tables after date range of config are created in slice of the last sub table
+// and added to router, so that inserts at rollover of periods don't fail.
+type precreator struct {
+	namespace string
+	router    *router.Router
+	tables    []*precreateTable
+	execute   func(slice, sql string) (uint64, error)
+	now       func() time.Time
+
+	lock  sync.Mutex
+	added map[string]map[int]string // key: db.table, value: sub tables added to router, key is table index and value is slice name
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// newPrecreator return nil if precreate_periods of all shard rules are not set
+func newPrecreator(namespace string, rt *router.Router, rules []*models.Shard, execute func(slice, sql string) (uint64, error)) *precreator {
+	var tables []*precreateTable
+	for _, r := range rules {
+		if r.PrecreatePeriods > 0 {
+			tables = append(tables, &precreateTable{db: r.DB, table: strings.ToLower(r.Table), periods: r.PrecreatePeriods})
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	return &precreator{
+		namespace: namespace,
+		router:    rt,
+		tables:    tables,
+		execute:   execute,
+		now:       time.Now,
+		added:     make(map[string]map[int]string),
+		done:      make(chan struct{}),
+	}
+}
+
+// inherit add sub tables added by precreator of old namespace to router, they are not in date range of config
+func (p *precreator) inherit(old *precreator) {
+	if old == nil {
+		return
+	}
+	old.lock.Lock()
+	defer old.lock.Unlock()
+	for _, t := range p.tables {
+		added := old.added[t.db+"."+t.table]
+		indexes := make([]int, 0, len(added))
+		for index := range added {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			if err := p.addSubTable(t, index, added[index]); err != nil {
+				log.Warn("[ns:%s] add precreated sub table %s.%s_%04d failed, err: %v", p.namespace, t.db, t.table, index, err)
+				break
+			}
+		}
+	}
+}
+
+func (p *precreator) addSubTable(t *precreateTable, index int, slice string) error {
+	rule, ok := p.router.GetShardRule(t.db, t.table)
+	if !ok {
+		return fmt.Errorf("shard rule not found")
+	}
+	if index <= rule.GetLastTableIndex() {
+		return nil
+	}
+	sliceIndex := -1
+	for i, s := range rule.GetSlices() {
+		if s == slice {
+			sliceIndex = i
+			break
+		}
+	}
+	if err := p.router.AddSubTable(t.db, t.table, index, sliceIndex); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := t.db + "." + t.table
+	if p.added[key] == nil {
+		p.added[key] = make(map[int]string)
+	}
+	p.added[key][index] = slice
+	return nil
+}
+
+func (p *precreator) start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+func (p *precreator) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(precreateInterval)
+	defer ticker.Stop()
+	for {
+		for _, t := range p.tables {
+			if err := p.precreate(t); err != nil {
+				log.Warn("[ns:%s] precreate sub tables of %s.%s failed, err: %v", p.namespace, t.db, t.table, err)
+			}
+		}
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// precreate create sub tables of current and next periods of table if not exist
+func (p *precreator) precreate(t *precreateTable) error {
+	rule, ok := p.router.GetShardRule(t.db, t.table)
+	if !ok {
+		return fmt.Errorf("shard rule not found")
+	}
+	for _, index := range dateTableIndexes(rule.GetType(), p.now(), t.periods) {
+		sliceIndex := rule.GetSliceIndexFromTableIndex(index)
+		add := sliceIndex < 0
+		if add {
+			if index < rule.GetLastTableIndex() {
+				// not in date range of config
+				continue
+			}
+			sliceIndex = rule.GetSliceIndexFromTableIndex(rule.GetLastTableIndex())
+		}
+		like, ok := templateTableIndex(rule, sliceIndex, index)
+		if !ok {
+			// the first sub table of slice in config should be created by user
+			continue
+		}
+
+		slice := rule.GetSlice(sliceIndex)
+		db, err := rule.GetDatabaseNameByTableIndex(index)
+		if err != nil {
+			return err
+		}
+		sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s LIKE %s.%s", quoteIdentifier(db),
+			quoteIdentifier(fmt.Sprintf("%s_%04d", rule.GetTable(), index)), quoteIdentifier(db),
+			quoteIdentifier(fmt.Sprintf("%s_%04d", rule.GetTable(), like)))
+		if _, err := p.execute(slice, sql); err != nil {
+			return fmt.Errorf("execute sql error, slice: %s, sql: %s, err: %v", slice, sql, err)
+		}
+		if !add {
+			continue
+		}
+		if err := p.addSubTable(t, index, slice); err != nil {
+			return err
+		}
+		log.Notice("[ns:%s] sub table %s.%s_%04d is created in slice %s and added to router", p.namespace, t.db, t.table, index, slice)
+	}
+	return nil
+}
+
+// templateTableIndex return the latest sub table before index in slice
+func templateTableIndex(rule router.Rule, sliceIndex int, index int) (int, bool) {
+	indexes := rule.GetSubTableIndexes()
+	for i := len(indexes) - 1; i >= 0; i-- {
+		if indexes[i] < index && rule.GetSliceIndexFromTableIndex(indexes[i]) == sliceIndex {
+			return indexes[i], true
+		}
+	}
+	return 0, false
+}
+
+// dateTableIndexes return sub table indexes of current and next periods of date rule, e.g. 202101 of month rule
+func dateTableIndexes(ruleType string, now time.Time, periods int) []int {
+	var indexes []int
+	for i := 0; i <= periods; i++ {
+		switch ruleType {
+		case router.DateYearRuleType:
+			indexes = append(indexes, now.Year()+i)
+		case router.DateMonthRuleType:
+			t := time.Date(now.Year(), now.Month()+time.Month(i), 1, 0, 0, 0, 0, now.Location())
+			indexes = append(indexes, t.Year()*100+int(t.Month()))
+		case router.DateDayRuleType:
+			t := time.Date(now.Year(), now.Month(), now.Day()+i, 0, 0, 0, 0, now.Location())
+			indexes = append(indexes, t.Year()*10000+int(t.Month())*100+t.Day())
+		}
+	}
+	return indexes
+}
+
+// close stop creating sub tables, the running sql is finished
+func (p *precreator) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPrecreator(t *testing.T, execute func(slice, sql string) (uint64, error)) *precreator {
+	cfg := &models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db", Table: "t_order", Type: models.ShardMonth, Key: "create_time", Slices: []string{"slice-0", "slice-1"},
+				DateRange: []string{"202011-202012", "202101"}, PrecreatePeriods: 2},
+			{DB: "db", Table: "t_user", Type: models.ShardHash, Key: "id", Locations: []int{1}, Slices: []string{"slice-0"}},
+		},
+	}
+	rt, err := router.NewRouter(cfg)
+	require.NoError(t, err)
+	p := newPrecreator("test", rt, cfg.ShardRules, execute)
+	require.NotNil(t, p)
+	require.Len(t, p.tables, 1)
+	return p
+}
+
+func TestDateTableIndexes(t *testing.T) {
+	now := time.Date(2020, 12, 31, 23, 0, 0, 0, time.Local)
+	require.Equal(t, []int{2020, 2021}, dateTableIndexes(router.DateYearRuleType, now, 1))
+	require.Equal(t, []int{202012, 202101, 202102}, dateTableIndexes(router.DateMonthRuleType, now, 2))
+	require.Equal(t, []int{20201231, 20210101}, dateTableIndexes(router.DateDayRuleType, now, 1))
+	require.Nil(t, dateTableIndexes(router.HashRuleType, now, 1))
+}
+
+func TestPrecreate(t *testing.T) {
+	var sqls []string
+	execute := func(slice, sql string) (uint64, error) {
+		sqls = append(sqls, slice+": "+sql)
+		return 0, nil
+	}
+	p := newTestPrecreator(t, execute)
+	p.now = func() time.Time { return time.Date(2020, 12, 15, 0, 0, 0, 0, time.Local) }
+	require.NoError(t, p.precreate(p.tables[0]))
+	require.Equal(t, []string{
+		"slice-0: CREATE TABLE IF NOT EXISTS `db`.`t_order_202012` LIKE `db`.`t_order_202011`",
+		"slice-1: CREATE TABLE IF NOT EXISTS `db`.`t_order_202102` LIKE `db`.`t_order_202101`",
+	}, sqls)
+	rule := p.router.GetRule("db", "t_order")
+	require.Equal(t, []int{202011, 202012, 202101, 202102}, rule.GetSubTableIndexes())
+	require.Equal(t, 1, rule.GetSliceIndexFromTableIndex(202102))
+
+	// the rest are created next time if sql fails
+	p.execute = func(slice, sql string) (uint64, error) {
+		return 0, errors.New("table is locked")
+	}
+	p.now = func() time.Time { return time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local) }
+	require.Error(t, p.precreate(p.tables[0]))
+	require.Equal(t, 202102, rule.GetLastTableIndex())
+
+	// sub tables added are kept after reloading
+	n := newTestPrecreator(t, execute)
+	n.inherit(p)
+	require.Equal(t, []int{202011, 202012, 202101, 202102}, n.router.GetRule("db", "t_order").GetSubTableIndexes())
+	require.Nil(t, newPrecreator("test", n.router, []*models.Shard{{DB: "db", Table: "t_user", Type: models.ShardHash}}, execute))
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// PROXY protocol, see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+const (
+	proxyProtocolHeaderTimeout = 5 * time.Second
+	proxyProtocolV1MaxLen      = 107
+	proxyProtocolV2MaxAddrLen  = 4096
+
+	proxyProtocolV2CmdLocal = 0x0
+	proxyProtocolV2CmdProxy = 0x1
+	proxyProtocolV2TCP4     = 0x11
+	proxyProtocolV2TCP6     = 0x21
+)
+
+var (
+	proxyProtocolV1Prefix = []byte("PROXY ")
+	proxyProtocolV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolConn is a connection whose remote addr is the real client addr in PROXY protocol header
+type proxyProtocolConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+// RemoteAddr return client addr sent by load balancer
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetNoDelay set no delay of underlying tcp connection
+func (c *proxyProtocolConn) SetNoDelay(noDelay bool) error {
+	if tcpConn, ok := c.Conn.(*net.TCPConn); ok {
+		return tcpConn.SetNoDelay(noDelay)
+	}
+	return nil
+}
+
+// parseProxyTrustedIPs parse comma separated ips or cidrs of load balancers
+func parseProxyTrustedIPs(s string) ([]util.IPInfo, error) {
+	var trusted []util.IPInfo
+	for _, ipStr := range strings.Split(s, ",") {
+		ipStr = strings.TrimSpace(ipStr)
+		if ipStr == "" {
+			continue
+		}
+		ipInfo, err := util.ParseIPInfo(ipStr)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, ipInfo)
+	}
+	return trusted, nil
+}
+
+// acceptProxyProtocol read PROXY protocol header from trusted load balancer, connections from
+// other addrs are returned as is, so client can't forge its address by header.
+func acceptProxyProtocol(c net.Conn, trusted []util.IPInfo) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+	ip := util.ParseClientIP(host)
+	isTrusted := false
+	for i := range trusted {
+		if trusted[i].Match(ip) {
+			isTrusted = true
+			break
+		}
+	}
+	if !isTrusted {
+		return c, nil
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout)); err != nil {
+		return nil, err
+	}
+	addr, err := readProxyProtocolHeader(c)
+	if err != nil {
+		return nil, fmt.Errorf("read proxy protocol header from %s error: %v", c.RemoteAddr(), err)
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if addr == nil {
+		// LOCAL or UNKNOWN, connection is made by load balancer itself
+		return c, nil
+	}
+	return &proxyProtocolConn{Conn: c, remoteAddr: addr}, nil
+}
+
+// readProxyProtocolHeader read exactly the header of v1 or v2, so no client data is consumed.
+// nil addr means the header doesn't carry client addr.
+func readProxyProtocolHeader(r io.Reader) (net.Addr, error) {
+	// any valid header is not shorter than signature of v2
+	buf := make([]byte, len(proxyProtocolV2Sig), proxyProtocolV1MaxLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(buf, proxyProtocolV2Sig) {
+		return readProxyProtocolV2(r)
+	}
+	if bytes.HasPrefix(buf, proxyProtocolV1Prefix) {
+		return readProxyProtocolV1(r, buf)
+	}
+	return nil, fmt.Errorf("invalid proxy protocol header")
+}
+
+func readProxyProtocolV1(r io.Reader, line []byte) (net.Addr, error) {
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyProtocolV1MaxLen {
+			return nil, fmt.Errorf("proxy protocol v1 header too long")
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	// PROXY TCP4 srcIP dstIP srcPort dstPort
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid proxy protocol v1 header: %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol v1 source: %s %s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyProtocolV2(r io.Reader) (net.Addr, error) {
+	// version and command, address family, length of address
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[0]>>4 != 2 {
+		return nil, fmt.Errorf("invalid proxy protocol v2 version: %d", head[0]>>4)
+	}
+	length := int(binary.BigEndian.Uint16(head[2:]))
+	if length > proxyProtocolV2MaxAddrLen {
+		return nil, fmt.Errorf("proxy protocol v2 address too long: %d", length)
+	}
+	addr := make([]byte, length)
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return nil, err
+	}
+
+	switch head[0] & 0x0f {
+	case proxyProtocolV2CmdLocal:
+		return nil, nil
+	case proxyProtocolV2CmdProxy:
+	default:
+		return nil, fmt.Errorf("invalid proxy protocol v2 command: %d", head[0]&0x0f)
+	}
+
+	// source addr, dest addr, source port, dest port, tlvs may follow
+	switch head[1] {
+	case proxyProtocolV2TCP4:
+		if length < 12 {
+			return nil, fmt.Errorf("invalid proxy protocol v2 tcp4 address length: %d", length)
+		}
+		return &net.TCPAddr{IP: net.IP(addr[0:4]), Port: int(binary.BigEndian.Uint16(addr[8:10]))}, nil
+	case proxyProtocolV2TCP6:
+		if length < 36 {
+			return nil, fmt.Errorf("invalid proxy protocol v2 tcp6 address length: %d", length)
+		}
+		return &net.TCPAddr{IP: net.IP(addr[0:16]), Port: int(binary.BigEndian.Uint16(addr[32:34]))}, nil
+	default:
+		// unix or udp, client addr is useless for allowed ips
+		return nil, nil
+	}
+}
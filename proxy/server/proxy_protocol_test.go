@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestReadProxyProtocolV1(t *testing.T) {
+	tests := []struct {
+		header string
+		addr   string
+		hasErr bool
+	}{
+		{header: "PROXY TCP4 192.168.1.10 10.0.0.1 56324 13306\r\n", addr: "192.168.1.10:56324"},
+		{header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 13306\r\n", addr: "[2001:db8::1]:56324"},
+		{header: "PROXY UNKNOWN\r\n"},
+		{header: "PROXY TCP4 bad 10.0.0.1 56324 13306\r\n", hasErr: true},
+		{header: "GET / HTTP/1.1\r\n", hasErr: true},
+	}
+	for _, test := range tests {
+		r := bytes.NewBufferString(test.header + "client data")
+		addr, err := readProxyProtocolHeader(r)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("header %q should be invalid", test.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("read header %q error: %v", test.header, err)
+		}
+		if (addr == nil && test.addr != "") || (addr != nil && addr.String() != test.addr) {
+			t.Errorf("header %q, addr should be %q, got: %v", test.header, test.addr, addr)
+		}
+		if r.String() != "client data" {
+			t.Errorf("client data should not be consumed, left: %q", r.String())
+		}
+	}
+}
+
+func TestReadProxyProtocolV2(t *testing.T) {
+	build := func(cmd, fam byte, addr []byte) *bytes.Buffer {
+		buf := bytes.NewBuffer(nil)
+		buf.Write(proxyProtocolV2Sig)
+		buf.WriteByte(0x20 | cmd)
+		buf.WriteByte(fam)
+		binary.Write(buf, binary.BigEndian, uint16(len(addr)))
+		buf.Write(addr)
+		buf.WriteString("client data")
+		return buf
+	}
+
+	tcp4 := append(append(net.ParseIP("192.168.1.10").To4(), net.ParseIP("10.0.0.1").To4()...), 0xdc, 0x04, 0x34, 0x02)
+	r := build(proxyProtocolV2CmdProxy, proxyProtocolV2TCP4, tcp4)
+	addr, err := readProxyProtocolHeader(r)
+	if err != nil {
+		t.Fatalf("read v2 header error: %v", err)
+	}
+	if addr.String() != "192.168.1.10:56324" {
+		t.Errorf("addr should be 192.168.1.10:56324, got: %v", addr)
+	}
+	if r.String() != "client data" {
+		t.Errorf("client data should not be consumed, left: %q", r.String())
+	}
+
+	addr, err = readProxyProtocolHeader(build(proxyProtocolV2CmdLocal, 0, nil))
+	if err != nil || addr != nil {
+		t.Errorf("local command should keep addr, addr: %v, err: %v", addr, err)
+	}
+
+	if _, err = readProxyProtocolHeader(build(proxyProtocolV2CmdProxy, proxyProtocolV2TCP4, tcp4[:6])); err == nil {
+		t.Errorf("short tcp4 address should be invalid")
+	}
+}
+
+func TestAcceptProxyProtocolTrusted(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accept := func(trustedIPs string) net.Conn {
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		if _, err := client.Write([]byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 13306\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusted, err := parseProxyTrustedIPs(trustedIPs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err := acceptProxyProtocol(c, trusted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pc
+	}
+
+	// header from untrusted peer is not parsed, empty trusted list trusts nobody
+	for _, trustedIPs := range []string{"", "10.0.0.0/8"} {
+		c := accept(trustedIPs)
+		if c.RemoteAddr().String() == "192.168.1.10:56324" {
+			t.Errorf("address of untrusted peer should not be replaced, trusted: %q", trustedIPs)
+		}
+		c.Close()
+	}
+
+	c := accept("127.0.0.1")
+	defer c.Close()
+	if c.RemoteAddr().String() != "192.168.1.10:56324" {
+		t.Errorf("address of trusted peer should be replaced, got: %s", c.RemoteAddr())
+	}
+}
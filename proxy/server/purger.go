@@ -0,0 +1,324 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+)
+
+const (
+	purgeCheckInterval = time.Minute // interval of checking if purge rules should run
+	purgeRunInterval   = time.Hour   // a rule is run at most once in it unless it's triggered by admin api
+)
+
+// PurgeStatus progress of purging expired rows of a logical table, counters are of the current or last run
+type PurgeStatus struct {
+	DB           string `json:"db"`
+	Table        string `json:"table"`
+	Running      bool   `json:"running"`
+	Shard        string `json:"shard"`       // sub table being purged, as slice/db.table
+	Shards       int    `json:"shards"`      // sub tables to purge
+	ShardsDone   int    `json:"shards_done"` // sub tables purged
+	Deleted      uint64 `json:"deleted"`
+	TotalDeleted uint64 `json:"total_deleted"` // deleted since namespace loaded
+	StartTime    string `json:"start_time"`
+	EndTime      string `json:"end_time"`
+	Error        string `json:"error"`
+}
+
+// purgeTarget sub table of logical table to purge
+type purgeTarget struct {
+	slice string
+	db    string
+	table string
+}
+
+type purgeTask struct {
+	rule        *models.PurgeRule
+	hasWindow   bool
+	windowStart int // minutes of day
+	windowEnd   int
+	lastStart   time.Time
+
+	lock      sync.Mutex
+	status    PurgeStatus
+	triggered bool // run now regardless of window and run interval
+}
+
+// inWindow check if t is in window of rule, window may cross midnight
+func (t *purgeTask) inWindow(now time.Time) bool {
+	if !t.hasWindow {
+		return true
+	}
+	m := now.Hour()*60 + now.Minute()
+	if t.windowStart < t.windowEnd {
+		return m >= t.windowStart && m < t.windowEnd
+	}
+	return m >= t.windowStart || m < t.windowEnd
+}
+
+// deleteSQL return sql deleting a batch of expired rows of sub table, expiration is calculated by backend
+// so that it's not affected by time zone of proxy
+func (t *purgeTask) deleteSQL(target *purgeTarget) string {
+	column := quoteIdentifier(t.rule.Column)
+	cutoff := fmt.Sprintf("NOW() - INTERVAL %d HOUR", t.rule.Retention)
+	if t.rule.GetColumnType() == models.PurgeColumnUnix {
+		cutoff = fmt.Sprintf("UNIX_TIMESTAMP() - %d", t.rule.Retention*3600)
+	}
+	return fmt.Sprintf("DELETE FROM %s.%s WHERE %s < %s ORDER BY %s LIMIT %d",
+		quoteIdentifier(target.db), quoteIdentifier(target.table), column, cutoff, column, t.rule.GetBatchSize())
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// purger delete expired rows of logical tables in background, sub tables are purged one by one in small batches
+// on masters, and a run is stopped when its window ends
+type purger struct {
+	namespace string
+	tasks     []*purgeTask
+	targets   func(db, table string) ([]*purgeTarget, error)
+	execute   func(slice, sql string) (uint64, error) // return affected rows
+	now       func() time.Time
+
+	trigger   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newPurger(namespace string, rules []*models.PurgeRule, targets func(db, table string) ([]*purgeTarget, error),
+	execute func(slice, sql string) (uint64, error)) (*purger, error) {
+	p := &purger{
+		namespace: namespace,
+		targets:   targets,
+		execute:   execute,
+		now:       time.Now,
+		trigger:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	for _, r := range rules {
+		start, end, ok, err := r.ParseWindow()
+		if err != nil {
+			return nil, err
+		}
+		p.tasks = append(p.tasks, &purgeTask{
+			rule:        r,
+			hasWindow:   ok,
+			windowStart: start,
+			windowEnd:   end,
+			status:      PurgeStatus{DB: r.DB, Table: r.Table},
+		})
+	}
+	return p, nil
+}
+
+// inherit keep start time of last runs and deleted rows of purger of old namespace, so that reloading
+// namespace doesn't run purge rules again
+func (p *purger) inherit(old *purger) {
+	if old == nil {
+		return
+	}
+	for _, t := range p.tasks {
+		o := old.getTask(t.rule.DB, t.rule.Table)
+		if o == nil {
+			continue
+		}
+		o.lock.Lock()
+		t.lastStart = o.lastStart
+		t.status.TotalDeleted = o.status.TotalDeleted
+		o.lock.Unlock()
+	}
+}
+
+func (p *purger) start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+func (p *purger) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(purgeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.trigger:
+		}
+		for _, t := range p.tasks {
+			if p.closed() {
+				return
+			}
+			if p.shouldRun(t) {
+				p.purge(t)
+			}
+		}
+	}
+}
+
+func (p *purger) shouldRun(t *purgeTask) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.triggered {
+		return true
+	}
+	now := p.now()
+	return t.inWindow(now) && now.Sub(t.lastStart) >= purgeRunInterval
+}
+
+func (p *purger) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// purge delete expired rows of all sub tables of task, it's stopped if window ends or purger is closed
+func (p *purger) purge(t *purgeTask) {
+	targets, err := p.targets(t.rule.DB, t.rule.Table)
+
+	t.lock.Lock()
+	triggered := t.triggered
+	t.triggered = false
+	t.lastStart = p.now()
+	t.status.Running = err == nil
+	t.status.Shard = ""
+	t.status.Shards = len(targets)
+	t.status.ShardsDone = 0
+	t.status.Deleted = 0
+	t.status.StartTime = t.lastStart.Format("2006-01-02 15:04:05")
+	t.status.EndTime = ""
+	t.status.Error = ""
+	if err != nil {
+		t.status.Error = err.Error()
+	}
+	t.lock.Unlock()
+	if err != nil {
+		log.Warn("[ns:%s] get sub tables of purge rule failed, table: %s.%s, err: %v", p.namespace, t.rule.DB, t.rule.Table, err)
+		return
+	}
+
+	err = p.purgeTargets(t, targets, triggered)
+
+	t.lock.Lock()
+	t.status.Running = false
+	t.status.Shard = ""
+	t.status.EndTime = p.now().Format("2006-01-02 15:04:05")
+	if err != nil {
+		t.status.Error = err.Error()
+	}
+	deleted := t.status.Deleted
+	t.lock.Unlock()
+	if err != nil {
+		log.Warn("[ns:%s] purge table %s.%s failed, deleted: %d, err: %v", p.namespace, t.rule.DB, t.rule.Table, deleted, err)
+		return
+	}
+	log.Notice("[ns:%s] purge table %s.%s finished, deleted: %d", p.namespace, t.rule.DB, t.rule.Table, deleted)
+}
+
+func (p *purger) purgeTargets(t *purgeTask, targets []*purgeTarget, triggered bool) error {
+	interval := time.Duration(t.rule.GetBatchInterval()) * time.Millisecond
+	for _, target := range targets {
+		t.lock.Lock()
+		t.status.Shard = target.slice + "/" + target.db + "." + target.table
+		t.lock.Unlock()
+
+		sql := t.deleteSQL(target)
+		for {
+			if p.closed() {
+				return fmt.Errorf("purge is stopped by closing namespace")
+			}
+			if !triggered && !t.inWindow(p.now()) {
+				return fmt.Errorf("purge is stopped by end of window")
+			}
+			affected, err := p.execute(target.slice, sql)
+			if err != nil {
+				return fmt.Errorf("execute sql error, slice: %s, sql: %s, err: %v", target.slice, sql, err)
+			}
+			t.lock.Lock()
+			t.status.Deleted += affected
+			t.status.TotalDeleted += affected
+			t.lock.Unlock()
+			if affected < uint64(t.rule.GetBatchSize()) {
+				break
+			}
+			select {
+			case <-p.done:
+			case <-time.After(interval):
+			}
+		}
+
+		t.lock.Lock()
+		t.status.ShardsDone++
+		t.lock.Unlock()
+	}
+	return nil
+}
+
+// runNow trigger purging of table regardless of window, it's run after the running one finishes
+func (p *purger) runNow(db, table string) error {
+	t := p.getTask(db, table)
+	if t == nil {
+		return fmt.Errorf("purge rule of %s.%s not found", db, table)
+	}
+	t.lock.Lock()
+	t.triggered = true
+	t.lock.Unlock()
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *purger) getTask(db, table string) *purgeTask {
+	for _, t := range p.tasks {
+		if strings.EqualFold(t.rule.DB, db) && strings.EqualFold(t.rule.Table, table) {
+			return t
+		}
+	}
+	return nil
+}
+
+// status return progress of purge rules in order of config
+func (p *purger) status() []*PurgeStatus {
+	ret := make([]*PurgeStatus, 0, len(p.tasks))
+	for _, t := range p.tasks {
+		t.lock.Lock()
+		s := t.status
+		t.lock.Unlock()
+		ret = append(ret, &s)
+	}
+	return ret
+}
+
+// close stop purging, the running batch is finished
+func (p *purger) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPurger(t *testing.T, rule *models.PurgeRule, execute func(slice, sql string) (uint64, error)) *purger {
+	targets := func(db, table string) ([]*purgeTarget, error) {
+		return []*purgeTarget{
+			{slice: "slice-0", db: "db_0", table: table + "_0000"},
+			{slice: "slice-1", db: "db_1", table: table + "_0001"},
+		}, nil
+	}
+	p, err := newPurger("test", []*models.PurgeRule{rule}, targets, execute)
+	require.NoError(t, err)
+	return p
+}
+
+func TestPurgeTaskInWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2020, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	p := newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "c", Retention: 1}, nil)
+	require.True(t, p.tasks[0].inWindow(at(12, 0)))
+
+	p = newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "c", Retention: 1, Window: "02:00-05:30"}, nil)
+	require.False(t, p.tasks[0].inWindow(at(1, 59)))
+	require.True(t, p.tasks[0].inWindow(at(2, 0)))
+	require.True(t, p.tasks[0].inWindow(at(5, 29)))
+	require.False(t, p.tasks[0].inWindow(at(5, 30)))
+
+	p = newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "c", Retention: 1, Window: "23:00-01:00"}, nil)
+	require.True(t, p.tasks[0].inWindow(at(23, 30)))
+	require.True(t, p.tasks[0].inWindow(at(0, 30)))
+	require.False(t, p.tasks[0].inWindow(at(1, 0)))
+	require.False(t, p.tasks[0].inWindow(at(12, 0)))
+}
+
+func TestPurgeTaskDeleteSQL(t *testing.T) {
+	p := newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "created_at", Retention: 720, BatchSize: 500}, nil)
+	target := &purgeTarget{slice: "slice-0", db: "db_0", table: "t_0000"}
+	require.Equal(t, "DELETE FROM `db_0`.`t_0000` WHERE `created_at` < NOW() - INTERVAL 720 HOUR ORDER BY `created_at` LIMIT 500",
+		p.tasks[0].deleteSQL(target))
+
+	p = newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "ts", ColumnType: models.PurgeColumnUnix, Retention: 2}, nil)
+	require.Equal(t, "DELETE FROM `db_0`.`t_0000` WHERE `ts` < UNIX_TIMESTAMP() - 7200 ORDER BY `ts` LIMIT 1000",
+		p.tasks[0].deleteSQL(target))
+}
+
+func TestPurge(t *testing.T) {
+	batches := map[string][]uint64{"slice-0": {2, 2, 1}, "slice-1": {0}}
+	var slices []string
+	execute := func(slice, sql string) (uint64, error) {
+		slices = append(slices, slice)
+		ret := batches[slice][0]
+		batches[slice] = batches[slice][1:]
+		return ret, nil
+	}
+	rule := &models.PurgeRule{DB: "db", Table: "t", Column: "c", Retention: 1, BatchSize: 2, BatchInterval: 1}
+	p := newTestPurger(t, rule, execute)
+	require.True(t, p.shouldRun(p.tasks[0]))
+	p.purge(p.tasks[0])
+	require.Equal(t, []string{"slice-0", "slice-0", "slice-0", "slice-1"}, slices)
+	require.False(t, p.shouldRun(p.tasks[0]))
+
+	s := p.status()[0]
+	require.False(t, s.Running)
+	require.Equal(t, 2, s.Shards)
+	require.Equal(t, 2, s.ShardsDone)
+	require.Equal(t, uint64(5), s.Deleted)
+	require.Equal(t, uint64(5), s.TotalDeleted)
+	require.Equal(t, "", s.Error)
+
+	// triggered run ignores run interval
+	require.Error(t, p.runNow("db", "t2"))
+	require.NoError(t, p.runNow("DB", "T"))
+	require.True(t, p.shouldRun(p.tasks[0]))
+	batches = map[string][]uint64{"slice-0": {1}, "slice-1": {1}}
+	p.purge(p.tasks[0])
+	s = p.status()[0]
+	require.Equal(t, uint64(2), s.Deleted)
+	require.Equal(t, uint64(7), s.TotalDeleted)
+
+	// progress is kept after reloading
+	n := newTestPurger(t, rule, execute)
+	n.inherit(p)
+	require.False(t, n.shouldRun(n.tasks[0]))
+	require.Equal(t, uint64(7), n.status()[0].TotalDeleted)
+}
+
+func TestPurgeStopped(t *testing.T) {
+	now := time.Date(2020, 1, 1, 2, 0, 0, 0, time.Local)
+	batches := []uint64{2, 0}
+	execute := func(slice, sql string) (uint64, error) {
+		if slice == "slice-1" {
+			return 0, errors.New("lost connection")
+		}
+		// window ends after the first batch
+		now = now.Add(time.Hour)
+		ret := batches[0]
+		batches = batches[1:]
+		return ret, nil
+	}
+	p := newTestPurger(t, &models.PurgeRule{DB: "db", Table: "t", Column: "c", Retention: 1, BatchSize: 2, Window: "02:00-03:00"}, execute)
+	p.now = func() time.Time { return now }
+	p.purge(p.tasks[0])
+	s := p.status()[0]
+	require.Equal(t, uint64(2), s.Deleted)
+	require.Equal(t, 0, s.ShardsDone)
+	require.Equal(t, "purge is stopped by end of window", s.Error)
+
+	require.NoError(t, p.runNow("db", "t"))
+	p.purge(p.tasks[0])
+	s = p.status()[0]
+	require.Equal(t, 1, s.ShardsDone)
+	require.Contains(t, s.Error, "lost connection")
+}
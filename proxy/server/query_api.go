@@ -0,0 +1,223 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/gin-gonic/gin"
+)
+
+const maxQueryRequestSize = 16 << 20
+
+// QueryRequest request of http query api, ? in sql is replaced by params in order
+type QueryRequest struct {
+	Namespace string        `json:"namespace"`
+	DB        string        `json:"db"`
+	SQL       string        `json:"sql"`
+	Params    []interface{} `json:"params"`
+}
+
+// QueryResponse response of http query api, numbers in rows are kept as they are in mysql
+type QueryResponse struct {
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	AffectedRows uint64          `json:"affected_rows"`
+	LastInsertID uint64          `json:"last_insert_id"`
+	Error        *QueryError     `json:"error,omitempty"`
+}
+
+// QueryError error of http query api, code is mysql error code if it's returned by mysql or gaea
+type QueryError struct {
+	Code    uint16 `json:"code"`
+	Message string `json:"message"`
+}
+
+func newQueryErrorResponse(err error) *QueryResponse {
+	qe := &QueryError{Code: mysql.ErrUnknown, Message: err.Error()}
+	if e, ok := err.(*mysql.SQLError); ok {
+		qe.Code = e.Code
+		qe.Message = e.Message
+	}
+	return &QueryResponse{Error: qe}
+}
+
+func (s *AdminServer) registerQuery() {
+	queryGroup := s.engine.Group("/api")
+	queryGroup.POST("/query", s.query)
+}
+
+// @Summary 执行SQL
+// @Description 以namespace用户的账号密码(HTTP Basic Auth)认证, 按namespace的路由、用户权限、SQL黑名单和结果集限制执行一条SQL, 返回JSON格式的结果
+// @Accept  json
+// @Produce  json
+// @Param request body QueryRequest true "namespace, db, sql and params"
+// @Success 200 {object} QueryResponse
+// @Security BasicAuth
+// @Router /api/query [post]
+func (s *AdminServer) query(c *gin.Context) {
+	user, password, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="gaea"`)
+		c.JSON(http.StatusUnauthorized, newQueryErrorResponse(fmt.Errorf("user and password of namespace are required")))
+		return
+	}
+
+	var req QueryRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxQueryRequestSize))
+	// keep numbers of params as they are
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, newQueryErrorResponse(fmt.Errorf("invalid request: %v", err)))
+		return
+	}
+	if req.Namespace == "" || strings.TrimSpace(req.SQL) == "" {
+		c.JSON(http.StatusBadRequest, newQueryErrorResponse(fmt.Errorf("namespace and sql are required")))
+		return
+	}
+
+	code, resp := s.proxy.executeQuery(user, password, c.Request.RemoteAddr, &req)
+	c.JSON(code, resp)
+}
+
+// executeQuery execute sql of http query api in a new session of user, the session is closed after sql is executed
+func (s *Server) executeQuery(user, password, clientAddr string, req *QueryRequest) (int, *QueryResponse) {
+	sql, err := interpolateParams(req.SQL, req.Params)
+	if err != nil {
+		return http.StatusBadRequest, newQueryErrorResponse(err)
+	}
+
+	cc := newQuerySession(s, clientAddr)
+	defer cc.Close()
+	if err := cc.login(user, password, req.DB); err != nil {
+		return http.StatusUnauthorized, newQueryErrorResponse(err)
+	}
+	if cc.namespace != req.Namespace {
+		return http.StatusForbidden, newQueryErrorResponse(fmt.Errorf("user %s is not allowed to access namespace %s", user, req.Namespace))
+	}
+
+	defer func() {
+		cc.executor.releaseResultMemory()
+		cc.executor.releaseQuerySlot()
+		cc.executor.recycleBackendConn(cc.continueConn)
+		cc.continueConn = nil
+	}()
+	r, err := cc.executor.handleQuery(sql)
+	if err != nil {
+		return http.StatusOK, newQueryErrorResponse(err)
+	}
+	if pc := cc.continueConn; pc != nil && (pc.MoreRowsExist() || pc.MoreResultsExist()) {
+		// rows left on connection are not read, it can't be reused
+		pc.Close()
+		return http.StatusOK, newQueryErrorResponse(fmt.Errorf("result exceeds max_sql_result_size %d, add limit to sql", cc.getNamespace().GetMaxResultSize()))
+	}
+	resp, err := buildQueryResponse(r)
+	if err != nil {
+		return http.StatusOK, newQueryErrorResponse(err)
+	}
+	return http.StatusOK, resp
+}
+
+// newQuerySession create session without client connection, one end of closed pipe is used,
+// so that it's closed like sessions of mysql clients
+func newQuerySession(s *Server, clientAddr string) *Session {
+	local, remote := net.Pipe()
+	remote.Close()
+	cc := newSession(s, local)
+	cc.executor.clientAddr = clientAddr
+	return cc
+}
+
+// interpolateParams replace ? out of quotes in sql with params, strings are quoted and escaped
+func interpolateParams(sql string, params []interface{}) (string, error) {
+	count, offsets, sqlItems, err := CalcParams(sql)
+	if err != nil {
+		return "", fmt.Errorf("quotes of sql are not matched")
+	}
+	if count != len(params) {
+		return "", fmt.Errorf("sql has %d placeholders but %d params are given", count, len(params))
+	}
+	if count == 0 {
+		return sql, nil
+	}
+
+	args := make([]interface{}, len(params))
+	for i, p := range params {
+		switch v := p.(type) {
+		case nil, json.Number:
+			args[i] = v
+		case string:
+			args[i] = []byte(v)
+		case bool:
+			if v {
+				args[i] = 1
+			} else {
+				args[i] = 0
+			}
+		default:
+			return "", fmt.Errorf("unsupported type of param %d: %T", i, p)
+		}
+	}
+	stmt := &Stmt{sql: sql, args: args, paramCount: count, offsets: offsets, sqlItems: sqlItems}
+	return stmt.GetRewriteSQL()
+}
+
+// buildQueryResponse convert result of text protocol to json, numbers are json numbers of mysql text to keep precision
+func buildQueryResponse(r *mysql.Result) (*QueryResponse, error) {
+	if r == nil {
+		return &QueryResponse{}, nil
+	}
+	defer r.Free()
+	resp := &QueryResponse{AffectedRows: r.AffectedRows, LastInsertID: r.InsertID}
+	if r.Resultset == nil {
+		return resp, nil
+	}
+
+	resp.Columns = make([]string, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		resp.Columns = append(resp.Columns, string(f.Name))
+	}
+	resp.Rows = make([][]interface{}, 0, len(r.RowDatas))
+	for _, data := range r.RowDatas {
+		row := make([]interface{}, len(r.Fields))
+		pos := 0
+		for i, f := range r.Fields {
+			v, next, isNull, ok := mysql.ReadLenEncStringAsBytes(data, pos)
+			if !ok {
+				log.Warn("invalid row data of query api, columns: %v", resp.Columns)
+				return nil, fmt.Errorf("invalid row data")
+			}
+			pos = next
+			if isNull {
+				continue
+			}
+			switch f.Type {
+			case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear,
+				mysql.TypeFloat, mysql.TypeDouble, mysql.TypeDecimal, mysql.TypeNewDecimal:
+				row[i] = json.Number(v)
+			default:
+				row[i] = string(v)
+			}
+		}
+		resp.Rows = append(resp.Rows, row)
+	}
+	return resp, nil
+}
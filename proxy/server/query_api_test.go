@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolateParams(t *testing.T) {
+	tests := []struct {
+		sql    string
+		params []interface{}
+		expect string
+	}{
+		{"select 1", nil, "select 1"},
+		{"select * from t where id = ? and name = ?", []interface{}{json.Number("10"), "a'b"}, "select * from t where id = 10 and name = 'a\\'b'"},
+		{"insert into t values (?, ?, '?')", []interface{}{nil, true}, "insert into t values (NULL, 1, '?')"},
+	}
+	for _, test := range tests {
+		sql, err := interpolateParams(test.sql, test.params)
+		assert.Nil(t, err, test.sql)
+		assert.Equal(t, test.expect, sql)
+	}
+
+	errTests := []struct {
+		sql    string
+		params []interface{}
+	}{
+		{"select ?", nil},
+		{"select 1", []interface{}{"a"}},
+		{"select ?", []interface{}{map[string]interface{}{"a": 1}}},
+		{"select 'a", nil},
+	}
+	for _, test := range errTests {
+		_, err := interpolateParams(test.sql, test.params)
+		assert.NotNil(t, err, test.sql)
+	}
+}
+
+func TestBuildQueryResponse(t *testing.T) {
+	fields := []*mysql.Field{
+		{Name: []byte("id"), Type: mysql.TypeLonglong},
+		{Name: []byte("price"), Type: mysql.TypeNewDecimal},
+		{Name: []byte("name"), Type: mysql.TypeVarString},
+	}
+	var row mysql.RowData
+	row = mysql.AppendLenEncStringBytes(row, []byte("18446744073709551615"))
+	row = mysql.AppendLenEncStringBytes(row, []byte("1.50"))
+	row = append(row, 0xfb)
+	r := &mysql.Result{Resultset: &mysql.Resultset{Fields: fields, RowDatas: []mysql.RowData{row}}}
+
+	resp, err := buildQueryResponse(r)
+	assert.Nil(t, err)
+	data, err := json.Marshal(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"columns":["id","price","name"],"rows":[[18446744073709551615,1.50,null]],"affected_rows":0,"last_insert_id":0}`, string(data))
+
+	resp, err = buildQueryResponse(&mysql.Result{AffectedRows: 2, InsertID: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryResponse{AffectedRows: 2, LastInsertID: 10}, resp)
+
+	resp = newQueryErrorResponse(mysql.NewError(mysql.ErrNoSuchTable, "Table 'db.t' doesn't exist"))
+	assert.Equal(t, &QueryError{Code: mysql.ErrNoSuchTable, Message: "Table 'db.t' doesn't exist"}, resp.Error)
+}
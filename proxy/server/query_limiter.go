@@ -0,0 +1,232 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+const defaultQueryQueueTimeout = 1000 // millisecond
+
+// priorities of queries waiting in queue, released slots are given to waiting queries of high priority first
+const (
+	queryPriorityLow = iota
+	queryPriorityHigh
+)
+
+// queryLimiter limits concurrent in-flight queries, queries exceeding the limit wait in a bounded priority queue
+type queryLimiter struct {
+	name         string // namespace or user name, used in error message
+	queueSize    int64
+	queueTimeout time.Duration // 0 means waiting until a slot is released
+
+	mu        sync.Mutex
+	available int // free slots
+	queue     queryWaiterQueue
+	seq       uint64 // arrival order of waiters
+	waiting   sync2.AtomicInt64
+}
+
+// queryWaiter query waiting in queue, ready is closed when a released slot is given to it
+type queryWaiter struct {
+	priority int
+	seq      uint64
+	index    int // index in queue, -1 after it's removed from queue
+	ready    chan struct{}
+}
+
+// queryWaiterQueue implements heap.Interface, waiters of higher priority and then earlier arrival come first
+type queryWaiterQueue []*queryWaiter
+
+func (q queryWaiterQueue) Len() int { return len(q) }
+
+func (q queryWaiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q queryWaiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queryWaiterQueue) Push(x interface{}) {
+	w := x.(*queryWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *queryWaiterQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
+
+// newQueryLimiter return nil if maxConcurrent is not positive, which means no limit
+func newQueryLimiter(name string, maxConcurrent, queueSize int, queueTimeout time.Duration) *queryLimiter {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &queryLimiter{
+		name:         name,
+		available:    maxConcurrent,
+		queueSize:    int64(queueSize),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire get a slot at once or wait in queue until timeout, release must be called if no error returned
+func (l *queryLimiter) acquire(priority int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.available > 0 {
+		l.available--
+		l.mu.Unlock()
+		return nil
+	}
+	if l.waiting.Get() >= l.queueSize {
+		l.mu.Unlock()
+		return mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("too many concurrent queries of %s, wait queue is full", l.name))
+	}
+	l.seq++
+	w := &queryWaiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	heap.Push(&l.queue, w)
+	l.waiting.Add(1)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		tm := time.NewTimer(l.queueTimeout)
+		defer tm.Stop()
+		timeout = tm.C
+	}
+	select {
+	case <-w.ready:
+		return nil
+	case <-timeout:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// slot is given to it while timer fires
+	if w.index < 0 {
+		return nil
+	}
+	heap.Remove(&l.queue, w.index)
+	l.waiting.Add(-1)
+	return mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("too many concurrent queries of %s, wait in queue timeout", l.name))
+}
+
+// release give the slot to the first waiting query, or free it if queue is empty
+func (l *queryLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		l.available++
+		return
+	}
+	w := heap.Pop(&l.queue).(*queryWaiter)
+	l.waiting.Add(-1)
+	close(w.ready)
+}
+
+// parseQueryPriority return priority of user, priority of namespace is used if user's is not set,
+// statistic users are low priority and others are high priority if neither is set
+func parseQueryPriority(user *models.User, nsPriority string) int {
+	priority := user.QueryPriority
+	if priority == "" {
+		priority = nsPriority
+	}
+	switch priority {
+	case models.QueryPriorityHigh:
+		return queryPriorityHigh
+	case models.QueryPriorityLow:
+		return queryPriorityLow
+	}
+	if user.OtherProperty == models.StatisticUser {
+		return queryPriorityLow
+	}
+	return queryPriorityHigh
+}
+
+// acquireQuerySlot acquire slots of namespace and user concurrent query limit, the returned
+// function must be called after the query is done if no error returned
+func (se *SessionExecutor) acquireQuerySlot() (func(), error) {
+	ns := se.GetNamespace()
+	var userLimiter *queryLimiter
+	priority := queryPriorityHigh
+	if up, ok := ns.userProperties[se.user]; ok {
+		userLimiter = up.queryLimiter
+		priority = up.queryPriority
+	}
+	if err := userLimiter.acquire(priority); err != nil {
+		return nil, err
+	}
+	if err := ns.queryLimiter.acquire(priority); err != nil {
+		userLimiter.release()
+		return nil, err
+	}
+	return func() {
+		ns.queryLimiter.release()
+		userLimiter.release()
+	}, nil
+}
+
+// holdQuerySlot acquire query slot for sql, the slot is held until response is written and
+// released by releaseQuerySlot. COMMIT, ROLLBACK and statements in transaction are not limited,
+// otherwise transaction holding locks on backend may be blocked by queries waiting for its locks.
+func (se *SessionExecutor) holdQuerySlot(sql string) error {
+	se.releaseQuerySlot()
+	if se.isInTransaction() {
+		return nil
+	}
+	if stmtType := parser.Preview(sql); stmtType == parser.StmtCommit || stmtType == parser.StmtRollback {
+		return nil
+	}
+	release, err := se.acquireQuerySlot()
+	if err != nil {
+		return err
+	}
+	se.querySlotRelease = release
+	return nil
+}
+
+// releaseQuerySlot release query slot held by current command
+func (se *SessionExecutor) releaseQuerySlot() {
+	if se.querySlotRelease != nil {
+		se.querySlotRelease()
+		se.querySlotRelease = nil
+	}
+}
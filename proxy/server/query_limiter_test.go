@@ -0,0 +1,150 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestQueryLimiter(t *testing.T) {
+	var noLimit *queryLimiter
+	if err := noLimit.acquire(queryPriorityHigh); err != nil {
+		t.Fatalf("nil limiter means no limit, err: %v", err)
+	}
+	noLimit.release()
+	if newQueryLimiter("ns", 0, 10, time.Second) != nil {
+		t.Fatalf("limiter should be nil when max concurrent is 0")
+	}
+
+	l := newQueryLimiter("namespace ns", 1, 1, 20*time.Millisecond)
+	if err := l.acquire(queryPriorityHigh); err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+	if err := l.acquire(queryPriorityHigh); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("acquire should timeout in queue, err: %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.release()
+	}()
+	if err := l.acquire(queryPriorityHigh); err != nil {
+		t.Fatalf("queued query should get the released slot, err: %v", err)
+	}
+	if l.waiting.Get() != 0 {
+		t.Errorf("waiting should be 0, got: %d", l.waiting.Get())
+	}
+
+	noQueue := newQueryLimiter("namespace ns", 1, 0, time.Second)
+	noQueue.acquire(queryPriorityHigh)
+	if err := noQueue.acquire(queryPriorityHigh); err == nil || !strings.Contains(err.Error(), "queue is full") {
+		t.Fatalf("acquire should fail when queue is full, err: %v", err)
+	}
+}
+
+func TestQueryLimiterPriority(t *testing.T) {
+	l := newQueryLimiter("namespace ns", 1, 10, time.Second)
+	if err := l.acquire(queryPriorityHigh); err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+
+	// low priority query waits first, then high priority ones
+	order := make(chan string, 3)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	wait := func(name string, priority int) {
+		defer wg.Done()
+		if err := l.acquire(priority); err != nil {
+			t.Errorf("acquire of %s error: %v", name, err)
+			return
+		}
+		order <- name
+		l.release()
+	}
+	go wait("report", queryPriorityLow)
+	for l.waiting.Get() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	go wait("oltp1", queryPriorityHigh)
+	for l.waiting.Get() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	go wait("oltp2", queryPriorityHigh)
+	for l.waiting.Get() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	l.release()
+	for _, expect := range []string{"oltp1", "oltp2", "report"} {
+		if name := <-order; name != expect {
+			t.Fatalf("expect %s, got %s", expect, name)
+		}
+	}
+	wg.Wait()
+	if l.available != 1 {
+		t.Errorf("slot should be free, available: %d", l.available)
+	}
+}
+
+func TestParseQueryPriority(t *testing.T) {
+	tests := []struct {
+		user   models.User
+		ns     string
+		expect int
+	}{
+		{models.User{}, "", queryPriorityHigh},
+		{models.User{OtherProperty: models.StatisticUser}, "", queryPriorityLow},
+		{models.User{OtherProperty: models.StatisticUser}, models.QueryPriorityHigh, queryPriorityHigh},
+		{models.User{}, models.QueryPriorityLow, queryPriorityLow},
+		{models.User{QueryPriority: models.QueryPriorityHigh}, models.QueryPriorityLow, queryPriorityHigh},
+	}
+	for i, tt := range tests {
+		if p := parseQueryPriority(&tt.user, tt.ns); p != tt.expect {
+			t.Errorf("case %d, expect %d, got %d", i, tt.expect, p)
+		}
+	}
+}
+
+func TestHoldQuerySlot(t *testing.T) {
+	se, err := newDefaultSessionExecutor(nil)
+	if err != nil {
+		t.Fatalf("create session executor error: %v", err)
+	}
+	ns := se.GetNamespace()
+	origin := ns.queryLimiter
+	defer func() { ns.queryLimiter = origin }()
+	ns.queryLimiter = newQueryLimiter("namespace ns", 1, 0, time.Second)
+
+	// slot is held after query until response is written
+	if err := se.holdQuerySlot("select 1"); err != nil {
+		t.Fatalf("hold query slot error: %v", err)
+	}
+	if err := ns.queryLimiter.acquire(queryPriorityHigh); err == nil {
+		t.Fatalf("slot should be held until released")
+	}
+	se.releaseQuerySlot()
+	if ns.queryLimiter.available != 1 {
+		t.Fatalf("slot should be free after released, available: %d", ns.queryLimiter.available)
+	}
+
+	// commit, rollback and statements in transaction are not limited
+	ns.queryLimiter.acquire(queryPriorityHigh)
+	defer ns.queryLimiter.release()
+	for _, sql := range []string{"commit", "rollback"} {
+		if err := se.holdQuerySlot(sql); err != nil {
+			t.Errorf("%s should not be limited, err: %v", sql, err)
+		}
+	}
+	if err := se.holdQuerySlot("select 1"); err == nil {
+		t.Errorf("select should be limited")
+	}
+	se.status |= mysql.ServerStatusInTrans
+	if err := se.holdQuerySlot("select 1"); err != nil {
+		t.Errorf("select in transaction should not be limited, err: %v", err)
+	}
+	se.releaseQuerySlot()
+}
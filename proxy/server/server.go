@@ -16,17 +16,23 @@ package server
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"fmt"
 
 	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/log/zap"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/sync2"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -38,8 +44,16 @@ var (
 type Server struct {
 	closed                     sync2.AtomicBool
 	listener                   net.Listener
+	socketListener             net.Listener // unix socket for local clients, nil if not configured
+	pgListener                 net.Listener // experimental postgresql protocol, nil if not configured
+	grpcListener               net.Listener // nil if grpc api is not configured
+	grpcServer                 *grpc.Server
+	proxyProtocol              bool          // parse PROXY protocol header of tcp connections
+	proxyTrustedIPs            []util.IPInfo // load balancers sending PROXY protocol header, empty means all
 	sessionTimeout             time.Duration
 	tw                         *util.TimeWheel
+	poller                     *sessionPoller // parks idle sessions in netpoll frontend mode, nil in goroutine mode
+	sessions                   sync.Map       // key: connection id, value: *Session, sessions after handshake
 	adminServer                *AdminServer
 	manager                    *Manager
 	EncryptKey                 string
@@ -47,6 +61,8 @@ type Server struct {
 	ServerVersionCompareStatus *util.VersionCompareStatus
 	AuthPlugin                 string
 	ServerConfig               *models.Proxy
+	configLock                 sync.Mutex // guards log config of ServerConfig changed at runtime
+	logDir                     string     // log_path of proxy config file, log output changed by admin api must be in it
 }
 
 // NewServer create new server
@@ -57,6 +73,7 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 	// init key
 	s.EncryptKey = cfg.EncryptKey
 	s.ServerConfig = cfg
+	s.logDir = cfg.LogPath
 	s.manager = manager
 	s.ServerVersion = util.CompactServerVersion(cfg.ServerVersion)
 	s.ServerVersionCompareStatus = util.NewVersionCompareStatus(cfg.ServerVersion)
@@ -66,6 +83,10 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 		DefaultCapability |= mysql.ClientPluginAuth
 	}
 
+	if cfg.ClientCompress {
+		DefaultCapability |= mysql.ClientCompress
+	}
+
 	// if error occurs, recycle the resources during creation.
 	defer func() {
 		if e := recover(); e != nil {
@@ -84,6 +105,36 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 		return nil, err
 	}
 
+	s.proxyProtocol = cfg.ProxyProtocol
+	if s.proxyTrustedIPs, err = parseProxyTrustedIPs(cfg.ProxyProtocolTrustedIPs); err != nil {
+		return nil, err
+	}
+	if s.proxyProtocol && len(s.proxyTrustedIPs) == 0 {
+		return nil, fmt.Errorf("proxy_protocol_trusted_ips must be specified if proxy_protocol is on")
+	}
+
+	if cfg.ProxySocket != "" {
+		mode, _ := cfg.GetProxySocketMode()
+		if s.socketListener, err = listenUnixSocket(cfg.ProxySocket, mode); err != nil {
+			return nil, err
+		}
+		log.Notice("server listen on unix socket: %s, mode: %o", cfg.ProxySocket, mode)
+	}
+
+	if cfg.PGProxyAddr != "" {
+		if s.pgListener, err = net.Listen(cfg.ProtoType, cfg.PGProxyAddr); err != nil {
+			return nil, err
+		}
+		log.Notice("server listen on postgresql protocol: %s", cfg.PGProxyAddr)
+	}
+
+	if cfg.FrontendMode == models.FrontendModeNetpoll {
+		if s.poller, err = newSessionPoller(); err != nil {
+			return nil, err
+		}
+		log.Notice("server frontend mode: %s", cfg.FrontendMode)
+	}
+
 	st := strconv.Itoa(cfg.SessionTimeout)
 	st = st + "s"
 	s.sessionTimeout, err = time.ParseDuration(st)
@@ -105,6 +156,14 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 	}
 	s.adminServer = adminServer
 
+	if cfg.GRPCAddr != "" {
+		if s.grpcListener, err = net.Listen(cfg.ProtoType, cfg.GRPCAddr); err != nil {
+			return nil, err
+		}
+		s.grpcServer = newGRPCServer(s, adminServer, cfg)
+		log.Notice("server listen on grpc: %s", cfg.GRPCAddr)
+	}
+
 	log.Notice("server start succ, netProtoType: %s, addr: %s", cfg.ProtoType, cfg.ProxyAddr)
 	return s, nil
 }
@@ -114,8 +173,46 @@ func (s *Server) Listener() net.Listener {
 	return s.listener
 }
 
+// listenUnixSocket listen on unix socket, stale socket file left by exited process is removed
+func listenUnixSocket(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("proxy_socket %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy_socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
 func (s *Server) onConn(c net.Conn) {
+	// real client addr is in PROXY protocol header if proxy is behind load balancer
+	if _, ok := c.(*net.TCPConn); ok && s.proxyProtocol {
+		pc, err := acceptProxyProtocol(c, s.proxyTrustedIPs)
+		if err != nil {
+			log.Warn("[server] onConn error: %v", err)
+			c.Close()
+			return
+		}
+		c = pc
+	}
+
 	cc := newSession(s, c) //新建一个conn
+	polled := false
 	defer func() {
 		err := recover()
 		if err != nil {
@@ -125,8 +222,10 @@ func (s *Server) onConn(c net.Conn) {
 			log.Warn("[server] onConn panic error, remoteAddr: %s, stack: %s", c.RemoteAddr().String(), string(buf))
 		}
 
-		// close session finally
-		cc.Close()
+		// close session finally, polled session is closed by itself
+		if !polled {
+			cc.Close()
+		}
 	}()
 
 	if _, err := cc.Handshake(); err != nil {
@@ -139,20 +238,32 @@ func (s *Server) onConn(c net.Conn) {
 
 	// set keep session flag
 	cc.executor.keepSession = cc.getNamespace().setForKeepSession
+	cc.executor.multiplexing = cc.getNamespace().multiplexing
+	cc.executor.setNamespaceSessionVariables()
+	cc.applyNamespaceCapability()
 
 	// set user privileges flag
 	cc.executor.userPriv = cc.getNamespace().userProperties[cc.executor.user].RWFlag
 
 	// added into time wheel
-	s.tw.Add(s.sessionTimeout, cc, cc.Close)
-	_ = s.manager.statistics.generalLogger.Notice("Connected - conn_id=%d, ns=%s, %s@%s/%s, capability: %d",
+	cc.resetIdleTimer(cc.writeIdleError)
+	cc.clearActivity()
+	s.addSession(cc)
+	_ = s.manager.statistics.generalLogger.Notice("Connected - conn_id=%d, ns=%s, %s@%s/%s, capability: %d, attrs: %s",
 		cc.c.ConnectionID,
 		cc.executor.namespace,
 		cc.executor.user,
 		cc.executor.clientAddr,
 		cc.executor.db,
-		cc.c.capability)
+		cc.c.capability,
+		formatConnectAttrs(cc.executor.connectAttrs))
 
+	if cc.pollConn != nil {
+		polled = true
+		cc.incrConnectionCount()
+		cc.runPolled(false)
+		return
+	}
 	cc.Run()
 }
 
@@ -163,17 +274,56 @@ func (s *Server) Run() error {
 
 	// start Server
 	s.closed.Set(false)
+	if s.socketListener != nil {
+		go s.serve(s.socketListener, s.onConn)
+	}
+	if s.pgListener != nil {
+		go s.serve(s.pgListener, s.onPGConn)
+	}
+	if s.grpcServer != nil {
+		go func() {
+			if err := s.grpcServer.Serve(s.grpcListener); err != nil {
+				log.Warn("[server] grpc server exit: %v", err)
+			}
+		}()
+	}
+	s.serve(s.listener, s.onConn)
+
+	return nil
+}
+
+func (s *Server) serve(l net.Listener, onConn func(net.Conn)) {
 	for s.closed.Get() != true {
-		conn, err := s.listener.Accept()
+		conn, err := l.Accept()
 		if err != nil {
 			log.Warn("[server] listener accept error: %s", err.Error())
 			continue
 		}
 
-		go s.onConn(conn)
+		s.setSocketBuffers(conn)
+		go onConn(conn)
 	}
+}
 
-	return nil
+// setSocketBuffers set kernel buffer sizes of client connection if they are configured
+func (s *Server) setSocketBuffers(c net.Conn) {
+	conn, ok := c.(interface {
+		SetReadBuffer(int) error
+		SetWriteBuffer(int) error
+	})
+	if !ok {
+		return
+	}
+	if n := s.ServerConfig.NetSocketReadBuffer; n > 0 {
+		if err := conn.SetReadBuffer(n); err != nil {
+			log.Warn("[server] set read buffer of %s error: %v", c.RemoteAddr(), err)
+		}
+	}
+	if n := s.ServerConfig.NetSocketWriteBuffer; n > 0 {
+		if err := conn.SetWriteBuffer(n); err != nil {
+			log.Warn("[server] set write buffer of %s error: %v", c.RemoteAddr(), err)
+		}
+	}
 }
 
 // Close close proxy server
@@ -183,12 +333,33 @@ func (s *Server) Close() error {
 	}
 
 	s.closed.Set(true)
+	if s.socketListener != nil {
+		// the socket file is removed by closing unix listener
+		if err := s.socketListener.Close(); err != nil {
+			log.Warn("[server] close unix socket listener error: %v", err)
+		}
+	}
+	if s.pgListener != nil {
+		if err := s.pgListener.Close(); err != nil {
+			log.Warn("[server] close postgresql listener error: %v", err)
+		}
+	}
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.grpcListener != nil {
+		// listener is not closed by grpc server if it's not served yet
+		s.grpcListener.Close()
+	}
 	if s.listener != nil {
 		err := s.listener.Close()
 		if err != nil {
 			return err
 		}
 	}
+	if s.poller != nil {
+		s.poller.Close()
+	}
 
 	s.manager.Close()
 	return nil
@@ -213,6 +384,27 @@ func (s *Server) ReloadNamespacePrepare(name string, client models.Client) error
 	return nil
 }
 
+// ReloadNamespaceCanaryPrepare config change prepare phase with canary config of namespace
+func (s *Server) ReloadNamespaceCanaryPrepare(name string, client models.Client) error {
+	log.Notice("prepare canary config of namespace: %s begin", name)
+	store := models.NewStore(client)
+	canary, err := store.LoadNamespaceCanary(s.EncryptKey, name)
+	if err != nil {
+		return err
+	}
+	if canary == nil {
+		return fmt.Errorf("canary of namespace %s not found", name)
+	}
+
+	if err = s.manager.ReloadNamespacePrepare(canary.Namespace); err != nil {
+		log.Warn("Manager ReloadNamespacePrepare error: %v", err)
+		return err
+	}
+
+	log.Notice("prepare canary config of namespace: %s end", name)
+	return nil
+}
+
 // ReloadNamespaceCommit config change commit phase
 // commit namespace does not need lock
 func (s *Server) ReloadNamespaceCommit(name string) error {
@@ -241,6 +433,8 @@ func (s *Server) DeleteNamespace(name string) error {
 }
 
 func (s *Server) ReloadProxyConfig() error {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
 	cfg := s.ServerConfig
 	log.Notice("reload proxy config,old config:%#v", cfg)
 	newCfg, err := models.ParseProxyConfigFromFile(cfg.ConfigFile)
@@ -250,12 +444,90 @@ func (s *Server) ReloadProxyConfig() error {
 	cfg.LogFileName = newCfg.LogFileName
 	cfg.LogLevel = newCfg.LogLevel
 	cfg.LogOutput = newCfg.LogOutput
+	cfg.LogFormat = newCfg.LogFormat
 	cfg.LogPath = newCfg.LogPath
+	s.logDir = newCfg.LogPath
+	slowLogDir.Set(newCfg.LogPath)
 	cfg.LogKeepDays = newCfg.LogKeepDays
 	cfg.LogKeepCounts = newCfg.LogKeepCounts
+	if s.adminServer != nil {
+		if err = s.adminServer.accounts.reload(newCfg); err != nil {
+			return fmt.Errorf("reload admin accounts error:%s", err)
+		}
+		cfg.AdminUser = newCfg.AdminUser
+		cfg.AdminPassword = newCfg.AdminPassword
+		cfg.AdminAccountsFile = newCfg.AdminAccountsFile
+	}
 	log.Notice("reload proxy config,new config:%#v", cfg)
+	return s.reloadLogger(cfg)
+}
+
+// SetLogLevel change level of sys log and general log at runtime
+func (s *Server) SetLogLevel(level string) error {
+	if !zap.IsValidLevel(level) {
+		return fmt.Errorf("invalid log level: %s", level)
+	}
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	if err := log.SetLevel("", level); err != nil {
+		return err
+	}
+	if err := s.manager.GetStatisticManager().generalLogger.SetLevel("", level); err != nil {
+		return err
+	}
+	s.ServerConfig.LogLevel = level
+	log.Notice("set log level to %s", level)
+	return nil
+}
+
+// SetLogOutput change output of sys log and general log at runtime, empty path or filename keeps the current one.
+// path is relative to log_path of proxy config and can't be out of it, filename can't contain path separator
+func (s *Server) SetLogOutput(output, path, filename string) error {
+	if strings.ContainsAny(filename, `/\`) || filename == "." || filename == ".." {
+		return fmt.Errorf("invalid log filename: %s", filename)
+	}
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	cfg := *s.ServerConfig
+	cfg.LogOutput = output
+	if path != "" {
+		logPath, err := resolveLogPath(s.logDir, path)
+		if err != nil {
+			return err
+		}
+		cfg.LogPath = logPath
+	}
+	if filename != "" {
+		cfg.LogFileName = filename
+	}
+	if err := s.reloadLogger(&cfg); err != nil {
+		return err
+	}
+	s.ServerConfig.LogOutput = cfg.LogOutput
+	s.ServerConfig.LogPath = cfg.LogPath
+	s.ServerConfig.LogFileName = cfg.LogFileName
+	log.Notice("set log output to %s, path: %s, filename: %s", cfg.LogOutput, cfg.LogPath, cfg.LogFileName)
+	return nil
+}
+
+// resolveLogPath return path relative to logDir, absolute path is allowed only if it's in logDir
+func resolveLogPath(logDir, path string) (string, error) {
+	logDir = filepath.Clean(logDir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(logDir, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(logDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("log path %s is out of log directory %s", path, logDir)
+	}
+	return path, nil
+}
+
+func (s *Server) reloadLogger(cfg *models.Proxy) error {
+	var err error
 	// reload sys log
-	if err = models.InitXLog(cfg.LogOutput, cfg.LogPath, cfg.LogFileName, cfg.LogLevel, cfg.Service, cfg.LogKeepDays, cfg.LogKeepCounts); err != nil {
+	if err = models.InitXLog(cfg.LogOutput, cfg.LogPath, cfg.LogFileName, cfg.LogLevel, cfg.Service, cfg.LogKeepDays, cfg.LogKeepCounts, cfg.LogMaxSize, cfg.LogCompress); err != nil {
 		return fmt.Errorf("init xlog error:%s", err)
 	}
 	// reload general log
@@ -264,6 +536,7 @@ func (s *Server) ReloadProxyConfig() error {
 	if stm.generalLogger, err = initGeneralLogger(cfg); err != nil {
 		return fmt.Errorf("reset general logger error:%s", err)
 	}
+	stm.generalLogJSON = strings.ToLower(cfg.LogFormat) == models.LogFormatJSON
 	oldGeneralLogger.Close()
 
 	return nil
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gaea.sock")
+	l, err := listenUnixSocket(path, 0600)
+	if err != nil {
+		t.Fatalf("listen unix socket error: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket error: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode should be 0600, got: %o", fi.Mode().Perm())
+	}
+
+	if _, err := listenUnixSocket(path, 0600); err == nil {
+		t.Errorf("socket in use should not be replaced")
+	}
+
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file should be removed after close, err: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatalf("write file error: %v", err)
+	}
+	if _, err := listenUnixSocket(path, 0600); err == nil {
+		t.Errorf("regular file should not be removed")
+	}
+}
+
+func TestResolveLogPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect string
+		valid  bool
+	}{
+		{"sub", "/data/logs/sub", true},
+		{"sub/../other", "/data/logs/other", true},
+		{"/data/logs/sub", "/data/logs/sub", true},
+		{"/data/logs", "/data/logs", true},
+		{"..", "", false},
+		{"../etc", "", false},
+		{"sub/../../etc", "", false},
+		{"/etc", "", false},
+		{"/data/logs2", "", false},
+	}
+	for _, test := range tests {
+		path, err := resolveLogPath("/data/logs/", test.path)
+		if test.valid != (err == nil) {
+			t.Errorf("resolve log path %s, expect valid: %v, err: %v", test.path, test.valid, err)
+			continue
+		}
+		if path != test.expect {
+			t.Errorf("resolve log path %s, expect: %s, actual: %s", test.path, test.expect, path)
+		}
+	}
+}
+
+func TestSetLogOutputInvalidPath(t *testing.T) {
+	s := &Server{ServerConfig: &models.Proxy{LogPath: "/data/logs", LogFileName: "gaea"}, logDir: "/data/logs"}
+	for _, filename := range []string{"../gaea", "a/b", `a\b`, ".."} {
+		if err := s.SetLogOutput("file", "", filename); err == nil {
+			t.Errorf("log filename %s should be rejected", filename)
+		}
+	}
+	if err := s.SetLogOutput("file", "/tmp", "gaea"); err == nil {
+		t.Errorf("log path out of log directory should be rejected")
+	}
+	if s.ServerConfig.LogPath != "/data/logs" || s.ServerConfig.LogFileName != "gaea" {
+		t.Errorf("log config should be kept, path: %s, filename: %s", s.ServerConfig.LogPath, s.ServerConfig.LogFileName)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// handshakeServerVersion return server version in initial handshake. Namespace of client is unknown before
+// it's authenticated, so server version of namespaces is used only if all of them configure the same one.
+func (m *Manager) handshakeServerVersion(proxyVersion string) string {
+	current, _, _ := m.switchIndex.Get()
+	version := ""
+	for _, ns := range m.namespaces[current].GetNamespaces() {
+		if ns.serverVersion == "" || (version != "" && ns.serverVersion != version) {
+			return proxyVersion
+		}
+		version = ns.serverVersion
+	}
+	if version == "" {
+		return proxyVersion
+	}
+	return version
+}
+
+// handshakeCapability return capability flags in initial handshake, flags disabled by all namespaces are not advertised
+func (m *Manager) handshakeCapability(proxyCapability uint32) uint32 {
+	current, _, _ := m.switchIndex.Get()
+	namespaces := m.namespaces[current].GetNamespaces()
+	if len(namespaces) == 0 {
+		return proxyCapability
+	}
+	disabled := ^uint32(0)
+	for _, ns := range namespaces {
+		disabled &= ns.disabledCapability
+	}
+	return proxyCapability &^ disabled
+}
+
+// getServerVersion return server version seen by client, server version of namespace takes precedence
+func (se *SessionExecutor) getServerVersion() string {
+	if ns := se.GetNamespace(); ns != nil && ns.serverVersion != "" {
+		return ns.serverVersion
+	}
+	return se.session.proxy.ServerVersion
+}
+
+// getVersionCompareStatus return version status of server version seen by client, sqls of client are
+// rewritten according to it
+func (se *SessionExecutor) getVersionCompareStatus() *util.VersionCompareStatus {
+	if ns := se.GetNamespace(); ns != nil && ns.versionCompareStatus != nil {
+		return ns.versionCompareStatus
+	}
+	return se.session.proxy.ServerVersionCompareStatus
+}
+
+// applyNamespaceCapability disable capability flags of client by namespace after it's authenticated
+func (cc *Session) applyNamespaceCapability() {
+	if ns := cc.getNamespace(); ns != nil {
+		cc.c.capability &^= ns.disabledCapability
+	}
+}
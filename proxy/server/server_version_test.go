@@ -0,0 +1,68 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceServerVersion(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	ns := se.GetNamespace()
+	m := se.manager
+
+	assert.Equal(t, "5.7.25-gaea", se.getServerVersion())
+	assert.Equal(t, "5.7.25-gaea", m.handshakeServerVersion("5.7.25-gaea"))
+	assert.Equal(t, DefaultCapability, m.handshakeCapability(DefaultCapability))
+
+	ns.serverVersion = "8.0.32"
+	ns.versionCompareStatus = util.NewVersionCompareStatus("8.0.32")
+	ns.disabledCapability = mysql.ClientMultiStatements | mysql.ClientLocalFiles
+	defer func() {
+		ns.serverVersion = ""
+		ns.versionCompareStatus = nil
+		ns.disabledCapability = 0
+	}()
+
+	// the only namespace decides server version and capability of handshake
+	assert.Equal(t, "8.0.32", se.getServerVersion())
+	assert.False(t, se.getVersionCompareStatus().LessThanMySQLVersion80)
+	assert.Equal(t, "8.0.32", m.handshakeServerVersion("5.7.25-gaea"))
+	capability := m.handshakeCapability(DefaultCapability)
+	assert.Zero(t, capability&mysql.ClientMultiStatements)
+	assert.Zero(t, capability&mysql.ClientLocalFiles)
+	assert.NotZero(t, capability&mysql.ClientProtocol41)
+
+	// other namespaces without server version use server version of proxy
+	current, _, _ := m.switchIndex.Get()
+	m.namespaces[current].namespaces["test_other_namespace"] = &Namespace{}
+	defer delete(m.namespaces[current].namespaces, "test_other_namespace")
+	assert.Equal(t, "5.7.25-gaea", m.handshakeServerVersion("5.7.25-gaea"))
+	assert.Equal(t, DefaultCapability, m.handshakeCapability(DefaultCapability))
+
+	// capability disabled by namespace is removed after client is authenticated
+	se.session.c = &ClientConn{Conn: &mysql.Conn{}, capability: DefaultCapability}
+	se.session.namespace = ns.name
+	se.session.manager = m
+	se.session.applyNamespaceCapability()
+	assert.Zero(t, se.session.c.capability&mysql.ClientMultiStatements)
+	assert.NotZero(t, se.session.c.capability&mysql.ClientProtocol41)
+}
@@ -19,10 +19,13 @@ import (
 	"github.com/XiaoMi/Gaea/backend"
 	"net"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"syscall"
 
 	"sync/atomic"
+	"time"
 
 	uber_atomic "go.uber.org/atomic"
 
@@ -36,7 +39,7 @@ var DefaultCapability = mysql.ClientLongPassword | mysql.ClientLongFlag |
 	mysql.ClientConnectWithDB | mysql.ClientProtocol41 |
 	mysql.ClientTransactions | mysql.ClientSecureConnection | mysql.ClientFoundRows |
 	mysql.ClientMultiResults | mysql.ClientMultiStatements | mysql.ClientPSMultiResults |
-	mysql.ClientLocalFiles | mysql.ClientPluginAuth
+	mysql.ClientLocalFiles | mysql.ClientPluginAuth | mysql.ClientConnectAtts
 
 //下面的会根据配置文件参数加进去
 //mysql.ClientPluginAuth
@@ -45,6 +48,9 @@ var baseConnID uint32 = 10000
 
 const initClientConnStatus = mysql.ServerStatusAutocommit
 
+// unixSocketClientAddr is client addr of unix socket connections
+const unixSocketClientAddr = "localhost"
+
 // Session means session between client and proxy
 type Session struct {
 	sync.Mutex
@@ -61,20 +67,28 @@ type Session struct {
 	closed atomic.Value
 
 	continueConn backend.PooledConnect
+	unixSocket   bool         // client connects by unix socket
+	lastActive   time.Time    // time of last request, protected by mutex
+	activity     atomic.Value // *sessionActivity, read by diagnostics without lock of session
+
+	// connection parked in poller of netpoll frontend mode, pollConn is nil if it's not pollable
+	pollConn       syscall.Conn
+	pollFD         int
+	pollRegistered bool
 }
 
 // create session between client<->proxy
 func newSession(s *Server, co net.Conn) *Session {
 	cc := new(Session)
-	tcpConn := co.(*net.TCPConn)
-
-	//SetNoDelay controls whether the operating system should delay packet transmission
-	// in hopes of sending fewer packets (Nagle's algorithm).
-	// The default is true (no delay),
-	// meaning that data is sent as soon as possible after a Write.
-	//I set this option false.
-	tcpConn.SetNoDelay(true)
-	cc.c = NewClientConn(mysql.NewConn(tcpConn), s.manager)
+	if tcpConn, ok := co.(interface{ SetNoDelay(bool) error }); ok {
+		//SetNoDelay controls whether the operating system should delay packet transmission
+		// in hopes of sending fewer packets (Nagle's algorithm).
+		// The default is true (no delay),
+		// meaning that data is sent as soon as possible after a Write.
+		//I set this option false.
+		tcpConn.SetNoDelay(true)
+	}
+	cc.c = NewClientConn(mysql.NewConn(co), s.manager)
 	cc.proxy = s
 	cc.manager = s.manager
 
@@ -84,8 +98,19 @@ func newSession(s *Server, co net.Conn) *Session {
 	cc.executor = newSessionExecutor(s.manager)
 	cc.executor.clientAddr = co.RemoteAddr().String()
 	cc.closed.Store(false)
+	cc.lastActive = time.Now()
 	cc.executor.session = cc
 	cc.executor.serverAddr = s.listener.Addr()
+	cc.pollFD = -1
+	if s.poller != nil {
+		cc.pollConn = pollableConn(co)
+	}
+	if _, ok := co.(*net.UnixConn); ok {
+		// peer of unix socket has no address, show it as local client like mysql
+		cc.unixSocket = true
+		cc.executor.clientAddr = unixSocketClientAddr
+		cc.executor.serverAddr = co.LocalAddr()
+	}
 	return cc
 }
 
@@ -111,14 +136,65 @@ func (cc *Session) clientConnectionReachLimit() (bool, int) {
 	return false, v
 }
 
+// userConnectionReachLimit check connection limit of user, return current connections and limit of user
+func (cc *Session) userConnectionReachLimit() (bool, int, int) {
+	maxConnections := cc.getNamespace().getUserMaxConnections(cc.executor.user)
+	if maxConnections <= 0 {
+		return false, 0, 0
+	}
+	v := cc.manager.GetStatisticManager().GetUserConnectionCount(cc.namespace, cc.executor.user)
+	return v >= maxConnections, v, maxConnections
+}
+
+// resetIdleTimer restart idle timer of session, session_idle_timeout of namespace takes precedence over session_timeout of proxy,
+// notify is called to send error to client before session is closed by session_idle_timeout
+func (cc *Session) resetIdleTimer(notify func(error) error) {
+	timeout := cc.getNamespace().sessionIdleTimeout
+	if timeout <= 0 {
+		cc.proxy.tw.Add(cc.proxy.sessionTimeout, cc, cc.Close)
+		return
+	}
+	cc.proxy.tw.Add(timeout, cc, func() { cc.closeIdle(timeout, notify) })
+}
+
+// closeIdle close session if no request is received in timeout, the timer is restarted with time left
+// if the session is active, e.g. a long query finished recently
+func (cc *Session) closeIdle(timeout time.Duration, notify func(error) error) {
+	cc.Lock()
+	defer cc.Unlock()
+	if cc.IsClosed() {
+		return
+	}
+	if idle := time.Since(cc.lastActive); idle < timeout {
+		cc.proxy.tw.Add(timeout-idle, cc, func() { cc.closeIdle(timeout, notify) })
+		return
+	}
+	log.Notice("close idle session, conn_id=%d, namespace=%s, %s@%s, timeout: %v",
+		cc.c.GetConnectionID(), cc.namespace, cc.executor.user, cc.executor.clientAddr, timeout)
+	if err := notify(mysql.NewDefaultError(mysql.ErrServerShutdown)); err != nil {
+		log.Debug("write error to idle session failed, conn_id=%d, err: %v", cc.c.GetConnectionID(), err)
+	}
+	cc.Close()
+}
+
+// writeIdleError write unsolicited error packet to client before idle session is closed
+func (cc *Session) writeIdleError(err error) error {
+	cc.c.SetSequence(0)
+	return cc.c.writeErrorPacket(err)
+}
+
 // IsAllowConnect check if allow to connect
 func (cc *Session) IsAllowConnect() bool {
 	ns := cc.getNamespace() // maybe nil, and panic!
+	// access of unix socket is controlled by file permissions
+	if cc.unixSocket {
+		return true
+	}
 	clientHost, _, err := net.SplitHostPort(cc.c.RemoteAddr().String())
 	if err != nil {
 		log.Warn("[server] Session parse host error: %v", err)
 	}
-	clientIP := net.ParseIP(clientHost)
+	clientIP := util.ParseClientIP(clientHost)
 
 	return ns.IsClientIPAllowed(clientIP)
 }
@@ -175,6 +251,12 @@ func (cc *Session) Handshake() (*HandshakeResponseInfo, error) {
 		log.Warn(errMsg)
 		return &info, mysql.NewError(mysql.ErrConCount, errMsg)
 	}
+	if reachLimit, connectionNum, maxConnections := cc.userConnectionReachLimit(); reachLimit {
+		errMsg := fmt.Sprintf("[ns:%s, %s@%s/%s] too many connections of user, current:%d, max:%d",
+			cc.namespace, cc.executor.user, cc.executor.clientAddr, cc.executor.db, connectionNum, maxConnections)
+		log.Warn(errMsg)
+		return &info, mysql.NewError(mysql.ErrConCount, errMsg)
+	}
 
 	if err := cc.c.writeOK(cc.executor.GetStatus()); err != nil {
 		log.Warn("[server] Session readHandshakeResponse error, connId %d, msg: %s, error: %s",
@@ -182,6 +264,11 @@ func (cc *Session) Handshake() (*HandshakeResponseInfo, error) {
 		return &info, err
 	}
 
+	// compressed protocol starts after the ok packet of authentication
+	if cc.c.capability&DefaultCapability&mysql.ClientCompress != 0 {
+		cc.c.EnableCompression()
+	}
+
 	return &info, nil
 }
 
@@ -200,15 +287,13 @@ func (cc *Session) handleHandshakeResponse(info HandshakeResponseInfo) error {
 		if len(info.AuthResponse) == 32 {
 			succ, password = cc.manager.CheckSha2Password(user, info.Salt, info.AuthResponse)
 		} else {
-			succ, password = cc.manager.CheckHashPassword(user, info.Salt, info.AuthResponse)
-			if !succ {
-				succ, password = cc.manager.CheckPassword(user, info.Salt, info.AuthResponse)
-			}
+			succ, password = cc.manager.CheckNativePassword(user, info.Salt, info.AuthResponse)
 		}
 	} else if info.AuthPlugin == mysql.CachingSHA2Password {
 		succ, password = cc.manager.CheckSha2Password(user, info.Salt, info.AuthResponse)
 	} else {
-		succ, password = cc.manager.CheckPassword(user, info.Salt, info.AuthResponse)
+		// also reached after switching auth to mysql_native_password, hashed passwords must be accepted as well
+		succ, password = cc.manager.CheckNativePassword(user, info.Salt, info.AuthResponse)
 	}
 
 	if !succ {
@@ -230,6 +315,7 @@ func (cc *Session) handleHandshakeResponse(info HandshakeResponseInfo) error {
 
 	// set database
 	cc.executor.SetDatabase(info.Database)
+	cc.executor.connectAttrs = info.ConnectAttrs
 
 	// set namespace
 	namespace := cc.manager.GetNamespaceByUser(user, password)
@@ -237,6 +323,50 @@ func (cc *Session) handleHandshakeResponse(info HandshakeResponseInfo) error {
 	cc.executor.namespace = namespace
 	cc.c.namespace = namespace // TODO: remove it when refactor is done
 	cc.executor.SetContextNamespace()
+
+	// database in handshake is checked against user's acl like COM_INIT_DB
+	if info.Database != "" {
+		return cc.executor.checkUserDBACL(info.Database)
+	}
+	return nil
+}
+
+// login set user, database and namespace of session authenticated by cleartext password instead of mysql handshake
+func (cc *Session) login(user, password, db string) error {
+	host := cc.executor.clientAddr
+	if !cc.manager.CheckUser(user) {
+		return mysql.NewDefaultError(mysql.ErrAccessDenied, user, host, "Yes")
+	}
+	succ, matched := cc.manager.CheckPlainPassword(user, password)
+	if !succ {
+		return mysql.NewDefaultError(mysql.ErrAccessDenied, user, host, "Yes")
+	}
+
+	cc.executor.user = user
+	cc.executor.SetCollationID(mysql.DefaultCollationID)
+	cc.executor.SetCharset(mysql.DefaultCharset)
+	cc.executor.SetDatabase(db)
+	namespace := cc.manager.GetNamespaceByUser(user, matched)
+	cc.namespace = namespace
+	cc.executor.namespace = namespace
+	cc.c.namespace = namespace
+	cc.executor.SetContextNamespace()
+	if db != "" {
+		if err := cc.executor.checkUserDBACL(db); err != nil {
+			return err
+		}
+	}
+
+	ns := cc.getNamespace()
+	clientHost, _, _ := net.SplitHostPort(host)
+	if !ns.IsClientIPAllowed(util.ParseClientIP(clientHost)) {
+		return mysql.NewError(mysql.ErrAccessDenied, fmt.Sprintf("[ns:%s, %s@%s/%s] ip not allowed to connect.", namespace, user, host, db))
+	}
+	cc.executor.keepSession = ns.setForKeepSession
+	cc.executor.multiplexing = ns.multiplexing
+	cc.executor.setNamespaceSessionVariables()
+	cc.applyNamespaceCapability()
+	cc.executor.userPriv = ns.userProperties[user].RWFlag
 	return nil
 }
 
@@ -251,7 +381,12 @@ func (cc *Session) Close() {
 	}
 
 	cc.executor.handleKsQuit()
-	cc.c.Close()
+	if cc.pollConn != nil && cc.proxy.poller.closeConn(cc) {
+		// no goroutine is serving parked session
+		cc.release()
+	} else {
+		cc.c.Close()
+	}
 	log.Debug("client closed, %d", cc.c.GetConnectionID())
 
 	return
@@ -265,67 +400,146 @@ func (cc *Session) IsClosed() bool {
 // Run start session to server client request packets
 func (cc *Session) Run() {
 	defer func() {
-		r := recover()
-		if err, ok := r.(error); ok {
+		if r := recover(); r != nil {
 			const size = 4096
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
 
-			log.Warn("[server] Session Run panic error, error: %s, stack: %s", err.Error(), string(buf))
+			log.Warn("[server] Session Run panic error, error: %v, stack: %s", r, string(buf))
 		}
-		cc.Close()
-		cc.proxy.tw.Remove(cc)
-		cc.manager.GetStatisticManager().DescSessionCount(cc.namespace)
-		cc.manager.GetStatisticManager().DescConnectionCount(cc.namespace)
+		cc.release()
 	}()
 
-	cc.manager.GetStatisticManager().IncrSessionCount(cc.namespace)
-	cc.manager.GetStatisticManager().IncrConnectionCount(cc.namespace)
+	cc.incrConnectionCount()
+	for !cc.IsClosed() {
+		cc.serveRequest()
+	}
+}
+
+// runPolled serve requests of session in netpoll frontend mode, the session is parked in poller
+// and the goroutine exits when no request is buffered. A request is read first if resumed by poller.
+func (cc *Session) runPolled(resumed bool) {
+	parked := false
+	defer func() {
+		if r := recover(); r != nil {
+			const size = 4096
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+
+			log.Warn("[server] Session Run panic error, error: %v, stack: %s", r, string(buf))
+		}
+		if !parked {
+			cc.release()
+		}
+	}()
 
 	for !cc.IsClosed() {
-		cc.executor.nsChangeIndexOld = cc.executor.GetNamespace().namespaceChangeIndex
-		cc.c.SetSequence(0)
-		data, err := cc.c.ReadEphemeralPacket()
-		if err != nil {
-			cc.c.RecycleReadPacket()
-			cc.clearKsConns(cc.executor.nsChangeIndexOld)
-			cc.Close()
+		if resumed {
+			cc.serveRequest()
+			if cc.IsClosed() {
+				return
+			}
+		}
+		resumed = true
+		if !cc.c.ReleaseReadBuffer() {
+			continue
+		}
+		err := cc.proxy.poller.park(cc)
+		if err == nil {
+			parked = true
 			return
 		}
+		if err != errSessionClosed {
+			// serve it in this goroutine like goroutine frontend mode
+			log.Warn("[server] park session failed, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+			for !cc.IsClosed() {
+				cc.serveRequest()
+			}
+		}
+		return
+	}
+}
 
-		cc.proxy.tw.Add(cc.proxy.sessionTimeout, cc, cc.Close)
-		cc.manager.GetStatisticManager().AddReadFlowCount(cc.namespace, len(data))
-		cc.executor.SetContextNamespace()
-		cc.clearKsConns(cc.executor.nsChangeIndexOld)
+func (cc *Session) incrConnectionCount() {
+	cc.manager.GetStatisticManager().IncrSessionCount(cc.namespace)
+	cc.manager.GetStatisticManager().IncrConnectionCount(cc.namespace)
+	cc.manager.GetStatisticManager().IncrUserConnectionCount(cc.namespace, cc.executor.user)
+}
 
-		cmd := data[0]
-		data = data[1:]
-		rs := cc.execCommand(cmd, data)
+// release close session and decrease connection counts, it's called once when session ends
+func (cc *Session) release() {
+	cc.Close()
+	cc.proxy.removeSession(cc)
+	cc.proxy.tw.Remove(cc)
+	cc.manager.GetStatisticManager().DescSessionCount(cc.namespace)
+	cc.manager.GetStatisticManager().DescConnectionCount(cc.namespace)
+	cc.manager.GetStatisticManager().DescUserConnectionCount(cc.namespace, cc.executor.user)
+}
 
-		// 如果其他地方已经回收过,不再回收
-		if !cc.c.hasRecycledReadPacket.CompareAndSwap(true, false) {
-			cc.c.RecycleReadPacket()
+// serveRequest read a request packet and write response, session is closed if error occurs
+func (cc *Session) serveRequest() {
+	ns := cc.executor.GetNamespace()
+	cc.executor.nsChangeIndexOld = ns.namespaceChangeIndex
+	cc.c.SetNetTimeouts(ns.netReadTimeout, ns.netWriteTimeout)
+	cc.c.SetMaxAllowedPacket(ns.maxAllowedPacket)
+	cc.c.SetSequence(0)
+	data, err := cc.c.ReadEphemeralPacket()
+	if err != nil {
+		cc.c.RecycleReadPacket()
+		if e, ok := err.(*mysql.SQLError); ok && e.Code == mysql.ErrNetPacketTooLarge {
+			// like mysql, the error is sent and then connection is closed since rest of the packet is not read
+			log.Notice("packet too large, conn_id=%d, namespace=%s, %s@%s, max_allowed_packet: %d",
+				cc.c.GetConnectionID(), cc.namespace, cc.executor.user, cc.executor.clientAddr, ns.maxAllowedPacket)
+			cc.Lock()
+			cc.c.writeErrorPacket(err)
+			cc.Unlock()
 		}
+		cc.clearKsConns(cc.executor.nsChangeIndexOld)
+		cc.Close()
+		return
+	}
 
-		if err = cc.writeResponse(rs); err != nil {
-			log.Warn("Session write response error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
-			if _, ok := err.(mysql.SessionCloseError); ok {
-				log.Notice("Aborted - conn_id=%d, namespace=%s, clientAddr=%s, remoteAddr=%s",
-					cc.c.GetConnectionID(), cc.namespace, cc.executor.clientAddr, cc.c.RemoteAddr())
-			}
-			cc.clearKsConns(cc.executor.nsChangeIndexOld)
-			cc.Close()
-			return
-		}
+	cc.Lock()
+	cc.lastActive = time.Now()
+	cc.resetIdleTimer(cc.writeIdleError)
+	cc.manager.GetStatisticManager().AddReadFlowCount(cc.namespace, len(data))
+	cc.executor.SetContextNamespace()
+	cc.clearKsConns(cc.executor.nsChangeIndexOld)
+
+	cmd := data[0]
+	data = data[1:]
+	cc.setActivity(cmd, data)
+	rs := cc.execCommand(cmd, data)
 
-		if cmd == mysql.ComQuit || cc.shouldClearKsAndCloseSession(cc.executor.nsChangeIndexOld) {
-			cc.Close()
+	// 如果其他地方已经回收过,不再回收
+	if !cc.c.hasRecycledReadPacket.CompareAndSwap(true, false) {
+		cc.c.RecycleReadPacket()
+	}
+
+	err = cc.writeResponse(rs)
+	cc.lastActive = time.Now()
+	cc.clearActivity()
+	cc.Unlock()
+	if err != nil {
+		log.Warn("Session write response error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+		if _, ok := err.(mysql.SessionCloseError); ok {
+			log.Notice("Aborted - conn_id=%d, namespace=%s, clientAddr=%s, remoteAddr=%s",
+				cc.c.GetConnectionID(), cc.namespace, cc.executor.clientAddr, cc.c.RemoteAddr())
 		}
+		cc.clearKsConns(cc.executor.nsChangeIndexOld)
+		cc.Close()
+		return
+	}
+
+	if cmd == mysql.ComQuit || cc.shouldClearKsAndCloseSession(cc.executor.nsChangeIndexOld) {
+		cc.Close()
 	}
 }
 
 func (cc *Session) writeResponse(r Response) error {
 	defer func() {
+		cc.executor.releaseResultMemory()
+		cc.executor.releaseQuerySlot()
 		cc.executor.recycleBackendConn(cc.continueConn)
 		cc.continueConn = nil
 	}()
@@ -339,7 +553,7 @@ func (cc *Session) writeResponse(r Response) error {
 		}
 		if cc.continueConn != nil {
 			return cc.c.writeOKResultStream(r.Status, r.Data.(*mysql.Result), cc.continueConn,
-				cc.manager.GetNamespace(cc.namespace).GetMaxResultSize(), r.IsBinary)
+				cc.manager.GetNamespace(cc.namespace).GetMaxResultSize(), r.IsBinary, cc.executor.rewriteResultRows)
 		}
 		if r.IsBinary {
 			if err := rs.BuildBinaryResultSet(); err != nil {
@@ -378,6 +592,8 @@ func (cc *Session) writeResponse(r Response) error {
 		return cc.c.writeOK(r.Status)
 	case RespNoop:
 		return nil
+	case RespStatistics:
+		return cc.c.writeStatistics(r.Data.(string))
 	default:
 		err := fmt.Errorf("invalid response type: %T", r)
 		log.Fatal(err.Error())
@@ -401,8 +617,35 @@ func (cc *Session) shouldClearKsAndCloseSession(nsChangeIndex uint32) bool {
 	return cc.executor.IsKeepSession() && cc.executor.isInTransaction() && cc.executor.GetNamespace().namespaceChangeIndex > nsChangeIndex
 }
 
+// handleCommandPanic log panic of executing a command with stack and the sql fingerprint,
+// and convert it to an error response, so the session is still usable for next command.
+// Backend connections held by session are discarded since their state is unknown, and the
+// session is closed if it's in transaction, which can't continue without the connections.
+func (cc *Session) handleCommandPanic(cmd byte, data []byte, r interface{}) Response {
+	// only fingerprint is logged, literals in sql may contain sensitive data
+	var fingerprint string
+	if cmd == mysql.ComQuery || cmd == mysql.ComStmtPrepare {
+		fingerprint = mysql.GetFingerprint(string(data))
+	}
+	log.Warn("[server] Session command panic, conn_id=%d, namespace=%s, %s@%s, cmd: %d, sql: %s, error: %v, stack: %s",
+		cc.c.GetConnectionID(), cc.namespace, cc.executor.user, cc.executor.clientAddr, cmd, fingerprint, r, debug.Stack())
+	cc.manager.GetStatisticManager().RecordSessionPanic(cc.namespace)
+
+	inTransaction := cc.executor.isInTransaction()
+	cc.executor.discardBackendConns()
+	if inTransaction {
+		return CreateErrorResponse(cc.executor.status, mysql.NewSessionCloseRespError("unexpected error in proxy, transaction is rolled back and connection is closed, see log of gaea"))
+	}
+	return CreateErrorResponse(cc.executor.status, mysql.NewDefaultError(mysql.ErrInternal, "unexpected error in proxy, see log of gaea"))
+}
+
 // execCommand create error response or execute sql
 func (cc *Session) execCommand(cmd byte, data []byte) (rs Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			rs = cc.handleCommandPanic(cmd, data, r)
+		}
+	}()
 	if cc.shouldClearKsAndCloseSession(cc.executor.nsChangeIndexOld) {
 		rs = CreateErrorResponse(cc.executor.status, mysql.ErrTxNsChanged)
 	} else {
@@ -31,6 +31,7 @@ func TestSessionRunNamespaceChangedWithMock(t *testing.T) {
 
 	mockey.PatchConvey("test", t, func() {
 		mockey.Mock((*mysql.Conn).SetSequence).Return().Build()
+		mockey.Mock((*mysql.Conn).SetNetTimeouts).Return().Build()
 		mockey.Mock((*mysql.Conn).Close).Return().Build()
 		mockey.Mock((*mysql.Conn).ReadEphemeralPacket).To(func() ([]byte, error) {
 			time.Sleep(time.Millisecond * 10)
@@ -135,6 +136,7 @@ func TestSessionRunInTxNamespaceChangedWithMock(t *testing.T) {
 
 	mockey.PatchConvey("test", t, func() {
 		mockey.Mock((*mysql.Conn).SetSequence).Return().Build()
+		mockey.Mock((*mysql.Conn).SetNetTimeouts).Return().Build()
 		mockey.Mock((*mysql.Conn).Close).Return().Build()
 		mockey.Mock((*mysql.Conn).ReadEphemeralPacket).To(func() ([]byte, error) {
 			time.Sleep(time.Millisecond * 10)
@@ -0,0 +1,105 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// handleShowCreateTable answer SHOW CREATE TABLE of sharding table with the DDL of the first sub table,
+// and the name of sub table is replaced by the logical one. handled is false if it's not a sharding table.
+func (se *SessionExecutor) handleShowCreateTable(reqCtx *util.RequestContext, sql string) (r *mysql.Result, handled bool, err error) {
+	if !isShowCreateTable(reqCtx.GetTokens()) {
+		return nil, false, nil
+	}
+	n, err := se.Parse(sql)
+	if err != nil {
+		return nil, false, nil
+	}
+	stmt, ok := n.(*ast.ShowStmt)
+	if !ok || stmt.Tp != ast.ShowCreateTable || stmt.Table == nil {
+		return nil, false, nil
+	}
+
+	db := stmt.Table.Schema.O
+	if db == "" {
+		db = se.db
+	}
+	table := stmt.Table.Name.O
+	rule, ok := se.GetNamespace().GetRouter().GetShardRule(db, table)
+	if !ok {
+		return nil, false, nil
+	}
+
+	slice, phyDB, phyTable, err := firstSubTable(rule)
+	if err != nil {
+		return nil, true, err
+	}
+	phySQL := fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", phyDB, phyTable)
+	r, err = se.ExecuteSQL(reqCtx, slice, se.db, phySQL)
+	if err != nil {
+		return nil, true, fmt.Errorf("execute sql error, sql: %s, err: %v", phySQL, err)
+	}
+	return r, true, rewriteShowCreateTableResult(r, phyTable, table)
+}
+
+// isShowCreateTable check tokens of SHOW CREATE TABLE
+func isShowCreateTable(tokens []string) bool {
+	return len(tokens) > 3 && strings.ToLower(tokens[1]) == "create" && strings.ToLower(tokens[2]) == "table"
+}
+
+// firstSubTable return slice, physical db and table name of the first sub table of rule
+func firstSubTable(rule router.Rule) (slice, phyDB, phyTable string, err error) {
+	return subTable(rule, rule.GetFirstTableIndex())
+}
+
+// subTable return slice, physical db and table name of sub table of rule at index
+func subTable(rule router.Rule, index int) (slice, phyDB, phyTable string, err error) {
+	sliceIndex := rule.GetSliceIndexFromTableIndex(index)
+	if sliceIndex < 0 {
+		return "", "", "", fmt.Errorf("slice of table %s index %d not found", rule.GetTable(), index)
+	}
+	if phyDB, err = rule.GetDatabaseNameByTableIndex(index); err != nil {
+		return "", "", "", err
+	}
+
+	// kingshard sub tables have suffix, mycat and global tables don't
+	phyTable = rule.GetTable()
+	if rule.GetType() != router.GlobalTableRuleType && !router.IsMycatShardingRule(rule.GetType()) {
+		phyTable = fmt.Sprintf("%s_%04d", rule.GetTable(), index)
+	}
+	return rule.GetSlice(sliceIndex), phyDB, phyTable, nil
+}
+
+// rewriteShowCreateTableResult replace sub table name in result with logical table name
+func rewriteShowCreateTableResult(r *mysql.Result, phyTable, table string) error {
+	if r == nil || r.Resultset == nil || len(r.Fields) < 2 || len(r.Values) != len(r.RowDatas) {
+		return nil
+	}
+	for _, row := range r.Values {
+		row[0] = table
+		if ddl, ok := row[1].([]byte); ok {
+			row[1] = strings.Replace(string(ddl), "TABLE `"+phyTable+"`", "TABLE `"+table+"`", 1)
+		}
+	}
+	return plan.GenerateSelectResultRowData(r)
+}
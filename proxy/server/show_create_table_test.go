@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util/hack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsShowCreateTable(t *testing.T) {
+	assert.True(t, isShowCreateTable(parser.Tokenize("show create table tbl_ks")))
+	assert.True(t, isShowCreateTable(parser.Tokenize("SHOW CREATE TABLE db_ks.tbl_ks")))
+	assert.False(t, isShowCreateTable(parser.Tokenize("show create database db_ks")))
+	assert.False(t, isShowCreateTable(parser.Tokenize("show tables")))
+}
+
+func TestFirstSubTable(t *testing.T) {
+	ns := &models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: "hash", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+			{DB: "db_mycat", Table: "tbl_mycat", Type: "mycat_mod", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}, Databases: []string{"db_mycat_[0-3]"}},
+		},
+	}
+	rt, err := router.NewRouter(ns)
+	assert.Nil(t, err)
+
+	rule, _ := rt.GetShardRule("db_ks", "tbl_ks")
+	slice, phyDB, phyTable, err := firstSubTable(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"slice-0", "db_ks", "tbl_ks_0000"}, []string{slice, phyDB, phyTable})
+
+	rule, _ = rt.GetShardRule("db_mycat", "tbl_mycat")
+	slice, phyDB, phyTable, err = firstSubTable(rule)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"slice-0", "db_mycat_0", "tbl_mycat"}, []string{slice, phyDB, phyTable})
+}
+
+func TestRewriteShowCreateTableResult(t *testing.T) {
+	ddl := "CREATE TABLE `tbl_ks_0000` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+	rs := &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: hack.Slice("Table"), Type: mysql.TypeVarString}, {Name: hack.Slice("Create Table"), Type: mysql.TypeVarString}},
+		Values: [][]interface{}{{[]byte("tbl_ks_0000"), []byte(ddl)}},
+	}
+	r := &mysql.Result{Resultset: rs}
+	assert.Nil(t, plan.GenerateSelectResultRowData(r))
+
+	assert.Nil(t, rewriteShowCreateTableResult(r, "tbl_ks_0000", "tbl_ks"))
+	assert.Equal(t, "tbl_ks", r.Values[0][0])
+	assert.Equal(t, "CREATE TABLE `tbl_ks` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB", r.Values[0][1])
+
+	values, err := r.RowDatas[0].ParseText(r.Fields)
+	assert.Nil(t, err)
+	assert.Equal(t, "tbl_ks", values[0])
+}
@@ -0,0 +1,295 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/hack"
+	"go.uber.org/atomic"
+)
+
+// handleShowVariablesOrStatus answer SHOW VARIABLES and SHOW STATUS with values of backend overridden
+// by proxy level ones, and with proxy level values only if no backend is available, so clients probing
+// variables on connect work. handled is false if sql is not one of them.
+func (se *SessionExecutor) handleShowVariablesOrStatus(reqCtx *util.RequestContext, sql string) (r *mysql.Result, handled bool, err error) {
+	if !isShowVariablesOrStatus(reqCtx.GetTokens()) {
+		return nil, false, nil
+	}
+	// forward as before if it can't be parsed, e.g. sql mode has ANSI_QUOTES
+	n, err := se.Parse(sql)
+	if err != nil {
+		return nil, false, nil
+	}
+	stmt, ok := n.(*ast.ShowStmt)
+	if !ok || (stmt.Tp != ast.ShowVariables && stmt.Tp != ast.ShowStatus) {
+		return nil, false, nil
+	}
+
+	var overrides map[string]string
+	if stmt.Tp == ast.ShowVariables {
+		overrides = se.proxyVariables(stmt.GlobalScope)
+	} else {
+		overrides = se.proxyStatus()
+	}
+
+	r, err = se.ExecuteSQL(reqCtx, se.GetNamespace().GetDefaultSlice(), se.db, sql)
+	if err == nil {
+		return r, true, overrideShowResult(r, overrides)
+	}
+	if stmt.Where != nil {
+		return nil, true, fmt.Errorf("execute sql error, sql: %s, err: %v", sql, err)
+	}
+
+	log.Warn("[ns:%s]show from backend failed, return proxy level values, sql: %s, err: %v", se.namespace, se.GetNamespace().redactLogSQL(sql), err)
+	if stmt.Tp == ast.ShowVariables && !stmt.GlobalScope {
+		// backend connection is not initialized with session, so add session values here
+		for name, value := range se.sessionLevelVariables() {
+			overrides[name] = value
+		}
+	}
+	r, err = createShowVariablesResult(overrides, stmt.Pattern)
+	return r, true, err
+}
+
+// isShowVariablesOrStatus check tokens of SHOW [GLOBAL | SESSION | LOCAL] {VARIABLES | STATUS}
+func isShowVariablesOrStatus(tokens []string) bool {
+	if len(tokens) < 2 {
+		return false
+	}
+	kind := strings.ToLower(tokens[1])
+	switch kind {
+	case "global", "session", "local":
+		if len(tokens) < 3 {
+			return false
+		}
+		kind = strings.ToLower(tokens[2])
+	}
+	return kind == "variables" || kind == "status"
+}
+
+// proxyVariables return variables decided by proxy instead of backend
+func (se *SessionExecutor) proxyVariables(global bool) map[string]string {
+	vars := map[string]string{}
+	if se.session != nil && se.session.proxy != nil {
+		vars["version"] = se.getServerVersion()
+		// setting wait_timeout is ignored, session idle timeout of namespace or session timeout of proxy takes effect
+		timeout := se.session.proxy.sessionTimeout
+		if ns := se.GetNamespace(); ns != nil && ns.sessionIdleTimeout > 0 {
+			timeout = ns.sessionIdleTimeout
+		}
+		if timeout > 0 {
+			vars["wait_timeout"] = strconv.Itoa(int(timeout / time.Second))
+			vars["interactive_timeout"] = vars["wait_timeout"]
+		}
+	}
+	if ns := se.GetNamespace(); ns != nil {
+		if ns.netReadTimeout > 0 {
+			vars["net_read_timeout"] = strconv.Itoa(int(ns.netReadTimeout / time.Second))
+		}
+		if ns.netWriteTimeout > 0 {
+			vars["net_write_timeout"] = strconv.Itoa(int(ns.netWriteTimeout / time.Second))
+		}
+		if ns.maxAllowedPacket > 0 {
+			vars[mysql.MaxAllowedPacket] = strconv.Itoa(ns.maxAllowedPacket)
+		}
+	}
+	if global {
+		return vars
+	}
+
+	vars["autocommit"] = "OFF"
+	if se.isAutoCommit() {
+		vars["autocommit"] = "ON"
+	}
+	return vars
+}
+
+// maxAllowedPacketColumns are names of select columns reading max_allowed_packet
+var maxAllowedPacketColumns = []string{
+	"@@" + mysql.MaxAllowedPacket,
+	"@@session." + mysql.MaxAllowedPacket,
+	"@@global." + mysql.MaxAllowedPacket,
+}
+
+// rewriteMaxAllowedPacket replace max_allowed_packet selected from backend by the limit of namespace,
+// so clients don't send requests larger than it. Only columns not aliased are replaced.
+func (se *SessionExecutor) rewriteMaxAllowedPacket(r *mysql.Result) {
+	ns := se.GetNamespace()
+	if ns == nil || ns.maxAllowedPacket <= 0 {
+		return
+	}
+	value := []byte(strconv.Itoa(ns.maxAllowedPacket))
+	rewriters := make(map[int]columnRewriter)
+	for i, f := range r.Fields {
+		if len(f.OrgTable) == 0 && isMaxAllowedPacketColumn(string(f.Name)) {
+			rewriters[i] = func([]byte) []byte { return value }
+		}
+	}
+	if len(rewriters) == 0 {
+		return
+	}
+	for i := range r.RowDatas {
+		row, err := rewriteRowData(r.RowDatas[i], len(r.Fields), rewriters)
+		if err != nil {
+			log.Warn("[ns:%s, %s@%s] rewrite max_allowed_packet error: %v", se.namespace, se.user, se.clientAddr, err)
+			return
+		}
+		r.RowDatas[i] = row
+	}
+	// values keep the integer type, binary result set is built from them
+	for _, values := range r.Values {
+		for i := range rewriters {
+			if i < len(values) && values[i] != nil {
+				values[i] = uint64(ns.maxAllowedPacket)
+			}
+		}
+	}
+}
+
+func isMaxAllowedPacketColumn(name string) bool {
+	for _, c := range maxAllowedPacketColumns {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionLevelVariables return charset and variables set in session
+func (se *SessionExecutor) sessionLevelVariables() map[string]string {
+	vars := map[string]string{
+		"character_set_client":     se.charset,
+		"character_set_connection": se.charset,
+		"character_set_results":    se.charset,
+		"collation_connection":     mysql.Collations[se.collation],
+	}
+	if se.sessionVariables != nil {
+		for name, v := range se.sessionVariables.GetAll() {
+			vars[name] = fmt.Sprint(v.Get())
+		}
+	}
+	return vars
+}
+
+// proxyStatus return status decided by proxy instead of backend
+func (se *SessionExecutor) proxyStatus() map[string]string {
+	stats := se.manager.GetStatisticManager()
+	status := map[string]string{
+		"Uptime": strconv.FormatInt(time.Now().Unix()-stats.startTime, 10),
+	}
+	if v, ok := stats.clientConnecions.Load(se.namespace); ok {
+		status["Threads_connected"] = strconv.Itoa(int(v.(*atomic.Int32).Load()))
+	}
+	return status
+}
+
+// overrideShowResult replace values of rows in result whose name is in overrides
+func overrideShowResult(r *mysql.Result, overrides map[string]string) error {
+	if r == nil || r.Resultset == nil || len(r.Fields) != 2 || len(r.Values) != len(r.RowDatas) {
+		return nil
+	}
+	changed := false
+	for _, row := range r.Values {
+		name, ok := row[0].([]byte)
+		if !ok {
+			continue
+		}
+		for k, v := range overrides {
+			if strings.EqualFold(k, string(name)) {
+				row[1] = v
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return plan.GenerateSelectResultRowData(r)
+}
+
+// createShowVariablesResult create result of values filtered by like pattern
+func createShowVariablesResult(values map[string]string, pattern *ast.PatternLikeExpr) (*mysql.Result, error) {
+	var matcher *regexp.Regexp
+	if pattern != nil {
+		v, ok := pattern.Pattern.(ast.ValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("unsupported like pattern")
+		}
+		var err error
+		if matcher, err = likePatternToRegexp(v.GetString(), pattern.Escape); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if matcher == nil || matcher.MatchString(name) != pattern.Not {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	rs := new(mysql.Resultset)
+	for _, name := range []string{"Variable_name", "Value"} {
+		rs.Fields = append(rs.Fields, &mysql.Field{Name: hack.Slice(name), Charset: 33, Type: mysql.TypeVarString})
+	}
+	for _, name := range names {
+		rs.Values = append(rs.Values, []interface{}{name, values[name]})
+	}
+
+	result := mysql.ResultPool.Get()
+	result.AffectedRows = uint64(len(names))
+	result.Resultset = rs
+	return result, plan.GenerateSelectResultRowData(result)
+}
+
+// likePatternToRegexp convert pattern of LIKE to case insensitive regexp
+func likePatternToRegexp(pattern string, escape byte) (*regexp.Regexp, error) {
+	if escape == 0 {
+		escape = '\\'
+	}
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		case c == rune(escape):
+			escaped = true
+		case c == '%':
+			b.WriteString(".*")
+		case c == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
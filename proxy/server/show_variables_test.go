@@ -0,0 +1,124 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/parser/ast"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util/hack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsShowVariablesOrStatus(t *testing.T) {
+	testCases := []struct {
+		sql    string
+		expect bool
+	}{
+		{"show variables like 'autocommit'", true},
+		{"SHOW GLOBAL VARIABLES", true},
+		{"show session status", true},
+		{"show status where Variable_name = 'Uptime'", true},
+		{"show databases", false},
+		{"show global", false},
+		{"show tables", false},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expect, isShowVariablesOrStatus(parser.Tokenize(tt.sql)), tt.sql)
+	}
+}
+
+func TestCreateShowVariablesResult(t *testing.T) {
+	values := map[string]string{"autocommit": "ON", "version": "5.7.25-gaea", "character_set_client": "utf8mb4"}
+	testCases := []struct {
+		sql    string
+		expect []string
+	}{
+		{"show variables", []string{"autocommit", "character_set_client", "version"}},
+		{"show variables like 'AUTO%'", []string{"autocommit"}},
+		{"show variables like 'character\\_set\\_%'", []string{"character_set_client"}},
+		{"show variables like 'ver_ion'", []string{"version"}},
+		{"show variables like 'none'", nil},
+	}
+	for _, tt := range testCases {
+		n, err := parser.ParseSQL(tt.sql)
+		assert.Nil(t, err, tt.sql)
+		r, err := createShowVariablesResult(values, n.(*ast.ShowStmt).Pattern)
+		assert.Nil(t, err, tt.sql)
+		var names []string
+		for _, row := range r.Values {
+			names = append(names, row[0].(string))
+		}
+		assert.Equal(t, tt.expect, names, tt.sql)
+		assert.Equal(t, len(tt.expect), len(r.RowDatas), tt.sql)
+	}
+}
+
+func TestOverrideShowResult(t *testing.T) {
+	rs := &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: hack.Slice("Variable_name"), Type: mysql.TypeVarString}, {Name: hack.Slice("Value"), Type: mysql.TypeVarString}},
+		Values: [][]interface{}{
+			{[]byte("autocommit"), []byte("OFF")},
+			{[]byte("version"), []byte("5.7.25-log")},
+			{[]byte("sql_mode"), []byte("STRICT_TRANS_TABLES")},
+		},
+	}
+	r := &mysql.Result{Resultset: rs}
+	assert.Nil(t, plan.GenerateSelectResultRowData(r))
+
+	err := overrideShowResult(r, map[string]string{"autocommit": "ON", "Version": "5.7.25-gaea"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ON", r.Values[0][1])
+	assert.Equal(t, "5.7.25-gaea", r.Values[1][1])
+	assert.Equal(t, []byte("STRICT_TRANS_TABLES"), r.Values[2][1])
+
+	values, err := r.RowDatas[1].ParseText(r.Fields)
+	assert.Nil(t, err)
+	assert.Equal(t, "5.7.25-gaea", values[1])
+}
+
+func TestProxyVariablesTimeouts(t *testing.T) {
+	se := &SessionExecutor{session: &Session{proxy: &Server{sessionTimeout: time.Hour}}}
+	se.contextNamespace = &Namespace{}
+	vars := se.proxyVariables(true)
+	assert.Equal(t, "3600", vars["wait_timeout"])
+	assert.Equal(t, "3600", vars["interactive_timeout"])
+	_, ok := vars["net_read_timeout"]
+	assert.False(t, ok)
+
+	se.contextNamespace = &Namespace{sessionIdleTimeout: 10 * time.Minute, netReadTimeout: 30 * time.Second, netWriteTimeout: 60 * time.Second}
+	vars = se.proxyVariables(true)
+	assert.Equal(t, "600", vars["wait_timeout"])
+	assert.Equal(t, "600", vars["interactive_timeout"])
+	assert.Equal(t, "30", vars["net_read_timeout"])
+	assert.Equal(t, "60", vars["net_write_timeout"])
+}
+
+func TestRewriteMaxAllowedPacket(t *testing.T) {
+	rs := &mysql.Resultset{
+		Fields: []*mysql.Field{
+			{Name: hack.Slice("@@max_allowed_packet"), Type: mysql.TypeLonglong},
+			{Name: hack.Slice("@@SESSION.max_allowed_packet"), Type: mysql.TypeLonglong},
+			{Name: hack.Slice("max_allowed_packet"), Type: mysql.TypeLonglong},
+		},
+		Values: [][]interface{}{{uint64(67108864), uint64(67108864), uint64(67108864)}},
+	}
+	r := &mysql.Result{Resultset: rs}
+	assert.Nil(t, plan.GenerateSelectResultRowData(r))
+
+	se := &SessionExecutor{}
+	se.contextNamespace = &Namespace{}
+	se.rewriteMaxAllowedPacket(r)
+	assert.Equal(t, uint64(67108864), r.Values[0][0])
+
+	se.contextNamespace = &Namespace{maxAllowedPacket: 4194304}
+	se.rewriteMaxAllowedPacket(r)
+	assert.Equal(t, []interface{}{uint64(4194304), uint64(4194304), uint64(67108864)}, r.Values[0])
+	values, err := r.RowDatas[0].ParseText(r.Fields)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(4194304), int64(4194304), int64(67108864)}, values)
+
+	assert.Equal(t, "4194304", se.proxyVariables(true)[mysql.MaxAllowedPacket])
+}
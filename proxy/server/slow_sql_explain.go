@@ -0,0 +1,171 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/cache"
+)
+
+const (
+	slowSQLExplainConcurrency = 2                // explains running at the same time, slow sqls are not explained if exceeded
+	slowSQLExplainTimeout     = time.Minute      // EXPLAIN ANALYZE executes sql again, so it may be slow too
+	slowSQLExplainInterval    = 10 * time.Minute // plan of a fingerprint is collected at most once in it
+)
+
+// SlowSQLPlan execution plan of slow sql, it's collected on the backend which executed the sql
+type SlowSQLPlan struct {
+	MD5         string     `json:"md5"`
+	Fingerprint string     `json:"fingerprint"`
+	Slice       string     `json:"slice"`
+	Addr        string     `json:"addr"`
+	DB          string     `json:"db"`  // physical db
+	SQL         string     `json:"sql"` // sql sent to backend
+	Running     bool       `json:"running"`
+	Columns     []string   `json:"columns"`
+	Rows        [][]string `json:"rows"`
+	Error       string     `json:"error"`
+	ExplainTime string     `json:"explain_time"`
+
+	explainTime time.Time
+}
+
+// Size implements cache.Value, the capacity of cache is number of fingerprints
+func (p *SlowSQLPlan) Size() int {
+	return 1
+}
+
+// slowSQLExplainer explain slow sqls on the backends executing them asynchronously, latest plan of each
+// fingerprint is kept
+type slowSQLExplainer struct {
+	namespace string
+	analyze   bool
+	plans     *cache.LRUCache // key: md5 of fingerprint
+	running   chan struct{}
+	explain   func(slice, addr, db, sql string) (*mysql.Result, error)
+}
+
+func newSlowSQLExplainer(namespace, mode string, capacity int, explain func(slice, addr, db, sql string) (*mysql.Result, error)) *slowSQLExplainer {
+	return &slowSQLExplainer{
+		namespace: namespace,
+		analyze:   mode == models.SlowSQLExplainAnalyze,
+		plans:     cache.NewLRUCache(int64(capacity)),
+		running:   make(chan struct{}, slowSQLExplainConcurrency),
+		explain:   explain,
+	}
+}
+
+// explainable check if statement can be explained, EXPLAIN ANALYZE executes sql so only select is allowed
+func (e *slowSQLExplainer) explainable(stmtType int) bool {
+	switch stmtType {
+	case parser.StmtSelect:
+		return true
+	case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete:
+		return !e.analyze
+	}
+	return false
+}
+
+// collect explain the last backend execution of slow sql asynchronously
+func (e *slowSQLExplainer) collect(reqCtx *util.RequestContext, md5, fingerprint string) {
+	slice, addr, db, sql := reqCtx.GetBackendExecution()
+	if sql == "" || !e.explainable(reqCtx.GetStmtType()) {
+		return
+	}
+	now := time.Now()
+	if v, ok := e.plans.Peek(md5); ok && now.Sub(v.(*SlowSQLPlan).explainTime) < slowSQLExplainInterval {
+		return
+	}
+	select {
+	case e.running <- struct{}{}:
+	default:
+		return
+	}
+
+	p := &SlowSQLPlan{
+		MD5:         md5,
+		Fingerprint: fingerprint,
+		Slice:       slice,
+		Addr:        addr,
+		DB:          db,
+		SQL:         sql,
+		Running:     true,
+		ExplainTime: now.Format("2006-01-02 15:04:05"),
+		explainTime: now,
+	}
+	e.plans.Set(md5, p)
+	go func() {
+		defer func() { <-e.running }()
+		e.plans.Set(md5, e.doExplain(p))
+	}()
+}
+
+// doExplain return a new plan with result of explaining
+func (e *slowSQLExplainer) doExplain(running *SlowSQLPlan) *SlowSQLPlan {
+	p := *running
+	p.Running = false
+	prefix := "EXPLAIN "
+	if e.analyze {
+		prefix = "EXPLAIN ANALYZE "
+	}
+	r, err := e.explain(p.Slice, p.Addr, p.DB, prefix+p.SQL)
+	if err != nil {
+		log.Warn("[ns:%s] explain slow sql failed, slice: %s, addr: %s, sql: %s, err: %v", e.namespace, p.Slice, p.Addr, p.SQL, err)
+		p.Error = err.Error()
+		return &p
+	}
+	if r == nil || r.Resultset == nil {
+		p.Error = "empty result of explain"
+		return &p
+	}
+	p.Columns = make([]string, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		p.Columns = append(p.Columns, string(f.Name))
+	}
+	p.Rows = make([][]string, 0, r.RowNumber())
+	for i := range r.Values {
+		row := make([]string, len(r.Fields))
+		for j := range r.Fields {
+			v, err := r.GetString(i, j)
+			if err != nil {
+				v = fmt.Sprint(r.Values[i][j])
+			}
+			// values may refer to buffer of the connection
+			row[j] = string([]byte(v))
+		}
+		p.Rows = append(p.Rows, row)
+	}
+	return &p
+}
+
+// get return plan of fingerprint
+func (e *slowSQLExplainer) get(md5 string) (*SlowSQLPlan, bool) {
+	v, ok := e.plans.Peek(md5)
+	if !ok {
+		return nil, false
+	}
+	return v.(*SlowSQLPlan), true
+}
+
+func (e *slowSQLExplainer) clear() {
+	e.plans.Clear()
+}
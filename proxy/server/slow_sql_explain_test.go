@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/require"
+)
+
+func waitSlowSQLPlan(t *testing.T, e *slowSQLExplainer, md5 string) *SlowSQLPlan {
+	for i := 0; i < 100; i++ {
+		if p, ok := e.get(md5); ok && !p.Running {
+			return p
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("plan of %s is not collected", md5)
+	return nil
+}
+
+func TestSlowSQLExplainerCollect(t *testing.T) {
+	var explained []string
+	explain := func(slice, addr, db, sql string) (*mysql.Result, error) {
+		require.Equal(t, "slice-0", slice)
+		require.Equal(t, "127.0.0.1:3306", addr)
+		require.Equal(t, "db_0", db)
+		explained = append(explained, sql)
+		if sql == "EXPLAIN select * from t_0001 where b = 1" {
+			return nil, errors.New("table not found")
+		}
+		fields := []*mysql.Field{{Name: []byte("table")}, {Name: []byte("key")}}
+		rs, err := mysql.BuildResultset(fields, []string{"table", "key"}, [][]interface{}{{"t_0001", nil}})
+		require.NoError(t, err)
+		return &mysql.Result{Resultset: rs}, nil
+	}
+	e := newSlowSQLExplainer("test", models.SlowSQLExplainPlain, 10, explain)
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtSelect)
+	e.collect(reqCtx, "m0", "select * from t where a = ?")
+	_, ok := e.get("m0")
+	require.False(t, ok, "backend execution is not recorded")
+
+	reqCtx.SetBackendExecution("slice-0", "127.0.0.1:3306", "db_0", "select * from t_0001 where a = 1")
+	e.collect(reqCtx, "m1", "select * from t where a = ?")
+	p := waitSlowSQLPlan(t, e, "m1")
+	require.Equal(t, "select * from t where a = ?", p.Fingerprint)
+	require.Equal(t, []string{"table", "key"}, p.Columns)
+	require.Equal(t, [][]string{{"t_0001", ""}}, p.Rows)
+	require.Equal(t, "", p.Error)
+
+	// plan is collected at most once in interval
+	e.collect(reqCtx, "m1", "select * from t where a = ?")
+	waitSlowSQLPlan(t, e, "m1")
+	require.Len(t, explained, 1)
+
+	reqCtx.SetBackendExecution("slice-0", "127.0.0.1:3306", "db_0", "select * from t_0001 where b = 1")
+	e.collect(reqCtx, "m2", "select * from t where b = ?")
+	p = waitSlowSQLPlan(t, e, "m2")
+	require.Equal(t, "table not found", p.Error)
+
+	e.clear()
+	_, ok = e.get("m1")
+	require.False(t, ok)
+}
+
+func TestSlowSQLExplainerExplainable(t *testing.T) {
+	e := newSlowSQLExplainer("test", models.SlowSQLExplainPlain, 10, nil)
+	require.True(t, e.explainable(parser.StmtSelect))
+	require.True(t, e.explainable(parser.StmtUpdate))
+	require.False(t, e.explainable(parser.StmtDDL))
+
+	e = newSlowSQLExplainer("test", models.SlowSQLExplainAnalyze, 10, nil)
+	require.True(t, e.explainable(parser.StmtSelect))
+	require.False(t, e.explainable(parser.StmtUpdate))
+	require.False(t, e.explainable(parser.StmtInsert))
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// slowSQLReapInterval interval of scanning running statements, it's the precision of kill time
+const slowSQLReapInterval = 100 * time.Millisecond
+
+// SlowSQLKillStatus statements killed by slow sql reaper and its whitelist
+type SlowSQLKillStatus struct {
+	Killed    uint64            `json:"killed"`    // killed since namespace loaded
+	Running   int               `json:"running"`   // statements being tracked
+	Whitelist map[string]string `json:"whitelist"` // key: md5 of fingerprint, value: fingerprint
+}
+
+// runningStatement statement executing on backends, tracked by slow sql reaper
+type runningStatement struct {
+	reaper      *slowSQLReaper
+	user        string
+	md5         string // md5 of fingerprint of client sql
+	fingerprint string
+	start       time.Time
+	threshold   time.Duration
+	cancel      context.CancelFunc
+	killed      bool // protected by lock of reaper
+}
+
+// slowSQLReaper kill statements running longer than kill time of their users by interrupting them,
+// statements whose fingerprints are in whitelist are never killed
+type slowSQLReaper struct {
+	killed    uint64 // first field to be 64-bit aligned for atomic operations
+	namespace string
+
+	lock      sync.Mutex
+	running   map[*runningStatement]struct{}
+	whitelist map[string]string // key: md5 of fingerprint, value: fingerprint
+	added     map[string]string // entries added by admin api, kept across reloads of namespace
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSlowSQLReaper(namespace string, whitelist []string) *slowSQLReaper {
+	r := &slowSQLReaper{
+		namespace: namespace,
+		running:   make(map[*runningStatement]struct{}),
+		whitelist: parseBlackSqls(whitelist),
+		added:     make(map[string]string),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// inherit keep whitelist entries added by admin api to reaper of old namespace
+func (r *slowSQLReaper) inherit(old *slowSQLReaper) {
+	if old == nil {
+		return
+	}
+	old.lock.Lock()
+	defer old.lock.Unlock()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for md5, fingerprint := range old.added {
+		r.whitelist[md5] = fingerprint
+		r.added[md5] = fingerprint
+	}
+}
+
+func (r *slowSQLReaper) run() {
+	ticker := time.NewTicker(slowSQLReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			r.reap(now)
+		}
+	}
+}
+
+// reap interrupt statements exceeding their kill time, return count of killed statements
+func (r *slowSQLReaper) reap(now time.Time) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	count := 0
+	for s := range r.running {
+		if s.killed || now.Sub(s.start) < s.threshold {
+			continue
+		}
+		if _, ok := r.whitelist[s.md5]; ok {
+			continue
+		}
+		s.killed = true
+		s.cancel()
+		count++
+		log.Warn("kill slow sql, namespace: %s, user: %s, elapsed: %v, kill time: %v, fingerprint: %s",
+			r.namespace, s.user, now.Sub(s.start), s.threshold, s.fingerprint)
+	}
+	atomic.AddUint64(&r.killed, uint64(count))
+	return count
+}
+
+// track register statement until untrack is called, the returned context is canceled when statement is killed
+func (r *slowSQLReaper) track(ctx context.Context, user, md5, fingerprint string, threshold time.Duration) (context.Context, *runningStatement) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &runningStatement{
+		reaper:      r,
+		user:        user,
+		md5:         md5,
+		fingerprint: fingerprint,
+		start:       time.Now(),
+		threshold:   threshold,
+		cancel:      cancel,
+	}
+	r.lock.Lock()
+	r.running[s] = struct{}{}
+	r.lock.Unlock()
+	return ctx, s
+}
+
+// untrack remove statement from its reaper, return true if it's killed
+func (s *runningStatement) untrack() bool {
+	r := s.reaper
+	r.lock.Lock()
+	delete(r.running, s)
+	killed := s.killed
+	r.lock.Unlock()
+	s.cancel()
+	return killed
+}
+
+// addWhitelist add fingerprint of sql to whitelist, return md5 of fingerprint
+func (r *slowSQLReaper) addWhitelist(sql string) (string, error) {
+	sql = strings.TrimSpace(sql)
+	if sql == "" {
+		return "", fmt.Errorf("sql is empty")
+	}
+	fingerprint := mysql.GetFingerprint(sql)
+	md5 := mysql.GetMd5(fingerprint)
+	r.lock.Lock()
+	r.whitelist[md5] = fingerprint
+	r.added[md5] = fingerprint
+	r.lock.Unlock()
+	return md5, nil
+}
+
+// removeWhitelist remove fingerprint from whitelist by md5, return false if not found
+func (r *slowSQLReaper) removeWhitelist(md5 string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.whitelist[md5]; !ok {
+		return false
+	}
+	delete(r.whitelist, md5)
+	delete(r.added, md5)
+	return true
+}
+
+func (r *slowSQLReaper) status() *SlowSQLKillStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	whitelist := make(map[string]string, len(r.whitelist))
+	for md5, fingerprint := range r.whitelist {
+		whitelist[md5] = fingerprint
+	}
+	return &SlowSQLKillStatus{
+		Killed:    atomic.LoadUint64(&r.killed),
+		Running:   len(r.running),
+		Whitelist: whitelist,
+	}
+}
+
+func (r *slowSQLReaper) close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func newSlowSQLKilledError(threshold time.Duration) error {
+	return mysql.NewError(mysql.ErrQueryInterrupted, fmt.Sprintf("query killed by proxy after running longer than %dms", threshold.Milliseconds()))
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestSlowSQLReaper(t *testing.T) {
+	batchSQL := "insert into t_report select * from t_order where id > 100"
+	r := newSlowSQLReaper("ns", []string{batchSQL})
+	defer r.close()
+
+	batchFingerprint := mysql.GetFingerprint(batchSQL)
+	slowFingerprint := mysql.GetFingerprint("select * from t_order where name like '%a%'")
+	_, batch := r.track(context.Background(), "u1", mysql.GetMd5(batchFingerprint), batchFingerprint, time.Second)
+	slowCtx, slow := r.track(context.Background(), "u1", mysql.GetMd5(slowFingerprint), slowFingerprint, time.Second)
+	fastCtx, fast := r.track(context.Background(), "u2", mysql.GetMd5(slowFingerprint), slowFingerprint, time.Minute)
+
+	if n := r.reap(time.Now()); n != 0 {
+		t.Fatalf("nothing should be killed before kill time, killed: %d", n)
+	}
+	if n := r.reap(time.Now().Add(2 * time.Second)); n != 1 {
+		t.Fatalf("only slow sql should be killed, killed: %d", n)
+	}
+	if slowCtx.Err() == nil {
+		t.Errorf("context of killed statement should be canceled")
+	}
+	if fastCtx.Err() != nil {
+		t.Errorf("statement of user with longer kill time should not be killed")
+	}
+	// killed statement is not counted again
+	if n := r.reap(time.Now().Add(2 * time.Second)); n != 0 {
+		t.Errorf("killed statement should be skipped, killed: %d", n)
+	}
+	if status := r.status(); status.Killed != 1 || status.Running != 3 || len(status.Whitelist) != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if !slow.untrack() {
+		t.Errorf("slow statement should be killed")
+	}
+	if batch.untrack() || fast.untrack() {
+		t.Errorf("batch and fast statements should not be killed")
+	}
+	if fastCtx.Err() == nil {
+		t.Errorf("context should be canceled after untrack")
+	}
+	if status := r.status(); status.Running != 0 {
+		t.Errorf("all statements should be untracked, running: %d", status.Running)
+	}
+}
+
+func TestSlowSQLReaperWhitelist(t *testing.T) {
+	old := newSlowSQLReaper("ns", []string{"select 1"})
+	defer old.close()
+	if _, err := old.addWhitelist(" "); err == nil {
+		t.Errorf("empty sql should not be added")
+	}
+	md5, err := old.addWhitelist("select * from t where id = 1")
+	if err != nil {
+		t.Fatalf("add whitelist error: %v", err)
+	}
+	if md5 != mysql.GetMd5(mysql.GetFingerprint("select * from t where id = 2")) {
+		t.Errorf("whitelist should be matched by fingerprint, md5: %s", md5)
+	}
+
+	// whitelist added by admin api is kept by reaper of reloaded namespace
+	r := newSlowSQLReaper("ns", nil)
+	defer r.close()
+	r.inherit(old)
+	if status := r.status(); len(status.Whitelist) != 1 || status.Whitelist[md5] == "" {
+		t.Errorf("unexpected whitelist: %v", status.Whitelist)
+	}
+
+	fingerprint := mysql.GetFingerprint("select * from t where id = 3")
+	_, s := r.track(context.Background(), "u1", md5, fingerprint, time.Millisecond)
+	if n := r.reap(time.Now().Add(time.Second)); n != 0 {
+		t.Errorf("statement in whitelist should not be killed, killed: %d", n)
+	}
+	if !r.removeWhitelist(md5) || r.removeWhitelist(md5) {
+		t.Errorf("whitelist should be removed once")
+	}
+	if n := r.reap(time.Now().Add(time.Second)); n != 1 {
+		t.Errorf("statement removed from whitelist should be killed, killed: %d", n)
+	}
+	if err := untrackSlowSQL(s); err == nil {
+		t.Errorf("error of killed statement should be returned")
+	} else if sqlErr, ok := err.(*mysql.SQLError); !ok || sqlErr.Code != mysql.ErrQueryInterrupted {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := untrackSlowSQL(nil); err != nil {
+		t.Errorf("untracked statement should not return error, err: %v", err)
+	}
+}
+
+func TestParseSlowSQLKillTime(t *testing.T) {
+	if d := parseSlowSQLKillTime(&models.User{}, 0); d != 0 {
+		t.Errorf("kill time should be 0, got: %v", d)
+	}
+	if d := parseSlowSQLKillTime(&models.User{}, 3000); d != 3*time.Second {
+		t.Errorf("kill time of namespace should be used, got: %v", d)
+	}
+	if d := parseSlowSQLKillTime(&models.User{SlowSQLKillTime: 500}, 3000); d != 500*time.Millisecond {
+		t.Errorf("kill time of user should be used, got: %v", d)
+	}
+}
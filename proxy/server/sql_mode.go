@@ -0,0 +1,103 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// parseSQLModeLiteral return modes of quoted sql_mode like 'STRICT_TRANS_TABLES,NO_ZERO_DATE',
+// ok is false if sql_mode is an expression which can't be verified
+func parseSQLModeLiteral(sqlMode string) (modes []string, ok bool) {
+	if len(sqlMode) < 2 || sqlMode[0] != '\'' || sqlMode[len(sqlMode)-1] != '\'' {
+		return nil, false
+	}
+	value := sqlMode[1 : len(sqlMode)-1]
+	if strings.Contains(value, "'") {
+		return nil, false
+	}
+	for _, mode := range strings.Split(value, ",") {
+		if mode = strings.ToUpper(strings.TrimSpace(mode)); mode != "" {
+			modes = append(modes, mode)
+		}
+	}
+	return modes, true
+}
+
+// verifyBackendSQLMode check sql_mode of backend connection is what session set, so shards with different
+// server configs behave the same on truncation, zero dates and so on. Modes expanded from combination modes
+// like TRADITIONAL are allowed, otherwise modes of backend must be exactly the same. The connection is closed
+// if they are different, since it's not usable by sessions of the namespace.
+func verifyBackendSQLMode(pc backend.PooledConnect, sessionVariables *mysql.SessionVariables) error {
+	v, ok := sessionVariables.Get(mysql.SQLModeStr)
+	if !ok {
+		return nil
+	}
+	value, _ := v.(*mysql.Variable).Get().(string)
+	expect, ok := parseSQLModeLiteral(value)
+	if !ok {
+		return nil
+	}
+
+	r, err := pc.Execute("SELECT @@SESSION.sql_mode", 0)
+	if err != nil {
+		return err
+	}
+	if r.Resultset == nil || len(r.Values) == 0 {
+		return fmt.Errorf("get sql_mode of backend %s error: empty result", pc.GetAddr())
+	}
+	actual, err := r.GetString(0, 0)
+	if err != nil {
+		return fmt.Errorf("get sql_mode of backend %s error: %v", pc.GetAddr(), err)
+	}
+	actualModes := make(map[string]bool)
+	for _, mode := range strings.Split(actual, ",") {
+		if mode != "" {
+			actualModes[strings.ToUpper(mode)] = true
+		}
+	}
+
+	combination := false
+	expectModes := make(map[string]bool)
+	for _, mode := range expect {
+		if mysql.IsCombinationSQLMode(mode) {
+			combination = true
+			continue
+		}
+		expectModes[mode] = true
+	}
+	consistent := true
+	for mode := range expectModes {
+		if !actualModes[mode] {
+			consistent = false
+		}
+	}
+	// other modes of backend are allowed only if they may be expanded from combination modes
+	if !combination && len(actualModes) != len(expectModes) {
+		consistent = false
+	}
+	if consistent {
+		return nil
+	}
+
+	log.Warn("sql_mode of backend %s is '%s' after set to %s, close it", pc.GetAddr(), actual, value)
+	pc.Close()
+	return mysql.NewError(mysql.ErrInternal, fmt.Sprintf("sql_mode of backend %s is inconsistent, expect: %s, actual: '%s'", pc.GetAddr(), value, actual))
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSQLModeLiteral(t *testing.T) {
+	modes, ok := parseSQLModeLiteral("'strict_trans_tables, NO_ZERO_DATE'")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"STRICT_TRANS_TABLES", "NO_ZERO_DATE"}, modes)
+
+	modes, ok = parseSQLModeLiteral("''")
+	assert.True(t, ok)
+	assert.Empty(t, modes)
+
+	_, ok = parseSQLModeLiteral("concat(@@sql_mode, ',NO_ZERO_DATE')")
+	assert.False(t, ok)
+}
+
+func TestVerifyBackendSQLMode(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newSQLModeResult := func(sqlMode string) *mysql.Result {
+		rs := &mysql.Resultset{Fields: make([]*mysql.Field, 1)}
+		rs.Values = append(rs.Values, []interface{}{sqlMode})
+		return &mysql.Result{Resultset: rs}
+	}
+	tests := []struct {
+		expect     string
+		actual     string
+		consistent bool
+	}{
+		{"'STRICT_TRANS_TABLES,NO_ZERO_DATE'", "NO_ZERO_DATE,STRICT_TRANS_TABLES", true},
+		{"''", "", true},
+		{"'STRICT_TRANS_TABLES'", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", false},
+		{"'STRICT_TRANS_TABLES,NO_ZERO_DATE'", "STRICT_TRANS_TABLES", false},
+		{"'TRADITIONAL'", "STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION", true},
+	}
+	for _, test := range tests {
+		pc := backend.NewMockPooledConnect(mockCtl)
+		pc.EXPECT().GetAddr().Return("127.0.0.1:3306").AnyTimes()
+		pc.EXPECT().Execute("SELECT @@SESSION.sql_mode", 0).Return(newSQLModeResult(test.actual), nil)
+		if !test.consistent {
+			pc.EXPECT().Close()
+		}
+		variables := mysql.NewSessionVariables()
+		require.NoError(t, variables.Set(mysql.SQLModeStr, test.expect))
+		err := verifyBackendSQLMode(pc, variables)
+		assert.Equal(t, test.consistent, err == nil, test.expect)
+	}
+
+	// sql_mode set by expression is not verified
+	pc := backend.NewMockPooledConnect(mockCtl)
+	variables := mysql.NewSessionVariables()
+	require.NoError(t, variables.Set(mysql.SQLModeStr, "concat(@@sql_mode, ',NO_ZERO_DATE')"))
+	assert.NoError(t, verifyBackendSQLMode(pc, variables))
+}
+
+func TestNamespaceSQLMode(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.GetNamespace().sqlMode = "'STRICT_TRANS_TABLES'"
+	defer func() { se.GetNamespace().sqlMode = "" }()
+
+	se.setNamespaceSessionVariables()
+	v, ok := se.sessionVariables.Get(mysql.SQLModeStr)
+	require.True(t, ok)
+	assert.Equal(t, "'STRICT_TRANS_TABLES'", v.(*mysql.Variable).Get())
+
+	require.NoError(t, se.setNamespaceDefaultVariable(mysql.SQLModeStr, "''", se.GetNamespace().sqlMode))
+	v, _ = se.sessionVariables.Get(mysql.SQLModeStr)
+	assert.Equal(t, "''", v.(*mysql.Variable).Get())
+
+	// DEFAULT restores sql_mode of namespace instead of the one of backend
+	require.NoError(t, se.setNamespaceDefaultVariable(mysql.SQLModeStr, "DEFAULT", se.GetNamespace().sqlMode))
+	v, ok = se.sessionVariables.Get(mysql.SQLModeStr)
+	require.True(t, ok)
+	assert.Equal(t, "'STRICT_TRANS_TABLES'", v.(*mysql.Variable).Get())
+}
+
+func TestNamespaceTimeZone(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.GetNamespace().timeZone = "+08:00"
+	defer func() { se.GetNamespace().timeZone = "" }()
+
+	// time_zone of namespace is set on every backend connection used by session
+	se.setNamespaceSessionVariables()
+	backendVariables := mysql.NewSessionVariables()
+	changed, err := backendVariables.SetEqualsWith(se.sessionVariables)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	v, ok := backendVariables.Get(mysql.TimeZone)
+	require.True(t, ok)
+	assert.Equal(t, "+08:00", v.(*mysql.Variable).Get())
+
+	require.NoError(t, se.setNamespaceDefaultVariable(mysql.TimeZone, "utc", se.GetNamespace().timeZone))
+	v, _ = se.sessionVariables.Get(mysql.TimeZone)
+	assert.Equal(t, "utc", v.(*mysql.Variable).Get())
+	require.NoError(t, se.setNamespaceDefaultVariable(mysql.TimeZone, "default", se.GetNamespace().timeZone))
+	v, _ = se.sessionVariables.Get(mysql.TimeZone)
+	assert.Equal(t, "+08:00", v.(*mysql.Variable).Get())
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// leadingKeywordRegexp matches the first keyword of sql, leading comments are skipped
+var leadingKeywordRegexp = regexp.MustCompile(`(?s)^\s*(?:/\*.*?\*/\s*)*[A-Za-z]+`)
+
+// rewriteRule compiled rewrite rule of namespace
+type rewriteRule struct {
+	md5     string         // md5 of fingerprint, set if matched by fingerprint
+	regex   *regexp.Regexp // set if matched by regex
+	rewrite string
+	hint    string
+}
+
+func parseRewriteRules(rules []*models.RewriteRule) ([]*rewriteRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	ret := make([]*rewriteRule, 0, len(rules))
+	for _, r := range rules {
+		rule := &rewriteRule{rewrite: strings.TrimSpace(r.Rewrite), hint: strings.TrimSpace(r.Hint)}
+		switch r.Match {
+		case models.RewriteMatchFingerprint:
+			rule.md5 = mysql.GetMd5(mysql.GetFingerprint(strings.TrimSpace(r.Pattern)))
+		case models.RewriteMatchRegex:
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			rule.regex = re
+		default:
+			return nil, fmt.Errorf("invalid match type: %s", r.Match)
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+// apply return rewritten sql, ok is false if sql doesn't match the rule or can't be rewritten
+func (r *rewriteRule) apply(reqCtx *util.RequestContext, sql string) (string, bool) {
+	ret := sql
+	if r.regex != nil {
+		if !r.regex.MatchString(sql) {
+			return "", false
+		}
+		if r.rewrite != "" {
+			ret = r.regex.ReplaceAllString(sql, r.rewrite)
+		}
+	} else {
+		if getSQLFingerprintMd5(reqCtx, sql) != r.md5 {
+			return "", false
+		}
+		if r.rewrite != "" {
+			literals, ok := parser.ExtractLiterals(sql)
+			if !ok {
+				return "", false
+			}
+			if ret, ok = fillRewriteTemplate(r.rewrite, literals); !ok {
+				return "", false
+			}
+		}
+	}
+	if r.hint != "" {
+		loc := leadingKeywordRegexp.FindStringIndex(ret)
+		if loc == nil {
+			return "", false
+		}
+		ret = ret[:loc[1]] + " /*+ " + r.hint + " */" + ret[loc[1]:]
+	}
+	return ret, true
+}
+
+// fillRewriteTemplate replace ? out of quotes in template with literals in order,
+// template without ? is returned as it is. ok is false if count of ? doesn't match literals,
+// e.g. in list of different length has the same fingerprint.
+func fillRewriteTemplate(template string, literals []string) (string, bool) {
+	if !strings.Contains(template, "?") {
+		return template, true
+	}
+	var b strings.Builder
+	var quote byte
+	n := 0
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' && i+1 < len(template) {
+				b.WriteByte(c)
+				i++
+				c = template[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			if n >= len(literals) {
+				return "", false
+			}
+			b.WriteString(literals[n])
+			n++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), n == len(literals)
+}
+
+// rewriteSQL rewrite sql by the first matched rewrite rule of namespace, so that bad queries can be fixed
+// without release of applications. The rewritten sql must be the same type of statement as the original one,
+// fingerprint of reqCtx is still the original one so that stats and slow logs are grouped by client sql.
+func (se *SessionExecutor) rewriteSQL(reqCtx *util.RequestContext, sql string) string {
+	ns := se.GetNamespace()
+	for _, r := range ns.rewriteRules {
+		ret, ok := r.apply(reqCtx, sql)
+		if !ok {
+			continue
+		}
+		if stmtType := parser.Preview(ret); stmtType != reqCtx.GetStmtType() {
+			log.Warn("[ns:%s] rewritten sql is ignored, statement type changed from %s to %s, sql: %s, rewritten: %s",
+				ns.GetName(), parser.StmtType(reqCtx.GetStmtType()), parser.StmtType(stmtType), ns.redactLogSQL(sql), ns.redactLogSQL(ret))
+			return sql
+		}
+		log.Debug("[ns:%s] sql is rewritten, sql: %s, rewritten: %s", ns.GetName(), ns.redactLogSQL(sql), ns.redactLogSQL(ret))
+		return ret
+	}
+	return sql
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFillRewriteTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		literals []string
+		expect   string
+		ok       bool
+	}{
+		{"select * from t force index(a) where a = ?", []string{"1"}, "select * from t force index(a) where a = 1", true},
+		{"select * from t where a = ? and b = '?' and c = ?", []string{"'x'", "2"}, "select * from t where a = 'x' and b = '?' and c = 2", true},
+		{"select * from t where a = 'it\\'s?' and b = ?", []string{"1"}, "select * from t where a = 'it\\'s?' and b = 1", true},
+		{"select * from t limit 10", []string{"1"}, "select * from t limit 10", true},
+		{"select * from t where a in (?, ?)", []string{"1", "2", "3"}, "", false},
+		{"select * from t where a = ? and b = ?", []string{"1"}, "", false},
+	}
+	for _, tt := range tests {
+		actual, ok := fillRewriteTemplate(tt.template, tt.literals)
+		require.Equal(t, tt.ok, ok, tt.template)
+		if ok {
+			require.Equal(t, tt.expect, actual, tt.template)
+		}
+	}
+}
+
+func TestRewriteSQL(t *testing.T) {
+	se, err := newDefaultSessionExecutor(func(ns *models.Namespace) {
+		ns.RewriteRules = []*models.RewriteRule{
+			{Match: models.RewriteMatchFingerprint, Pattern: "select * from tbl_ks where id = 1 and name = 'a'", Rewrite: "select * from tbl_ks force index(idx_name) where id = ? and name = ?"},
+			{Match: models.RewriteMatchFingerprint, Pattern: "select * from tbl_ks where name = 'a'", Hint: "MAX_EXECUTION_TIME(1000)"},
+			{Match: models.RewriteMatchRegex, Pattern: `(?i)^select (.*) from tbl_ks order by id$`, Rewrite: "select $1 from tbl_ks order by id limit 1000"},
+			{Match: models.RewriteMatchRegex, Pattern: `^select \* from tbl_ks where id > 100$`, Rewrite: "delete from tbl_ks where id > 100"},
+		}
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, modifyDefaultNamespace(func(ns *models.Namespace) {}, localManager))
+	}()
+
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{"SELECT * FROM tbl_ks WHERE id = 5 AND name = 'b\\'c'", "select * from tbl_ks force index(idx_name) where id = 5 and name = 'b\\'c'"},
+		{"/* app */ select * from tbl_ks where name = \"x\"", "/* app */ select /*+ MAX_EXECUTION_TIME(1000) */ * from tbl_ks where name = \"x\""},
+		{"select id, name from tbl_ks order by id", "select id, name from tbl_ks order by id limit 1000"},
+		{"select * from tbl_ks where id > 100", "select * from tbl_ks where id > 100"},
+		{"select * from tbl_ks where id = 1", "select * from tbl_ks where id = 1"},
+	}
+	for _, tt := range tests {
+		reqCtx := util.NewRequestContext()
+		reqCtx.SetStmtType(parser.Preview(tt.sql))
+		require.Equal(t, tt.expect, se.rewriteSQL(reqCtx, tt.sql), tt.sql)
+	}
+}
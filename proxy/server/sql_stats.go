@@ -0,0 +1,249 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/util/cache"
+)
+
+// sqlStatsWindowMinutes is the max time window of sql stats, stats are kept per minute
+const sqlStatsWindowMinutes = 60
+
+// sort keys of top n sql stats
+const (
+	SQLStatsSortLatency = "latency" // p99 latency
+	SQLStatsSortAvg     = "avg"
+	SQLStatsSortTotal   = "total" // total latency
+	SQLStatsSortCount   = "count"
+	SQLStatsSortErrors  = "errors"
+	SQLStatsSortRows    = "rows"
+)
+
+// sqlLatencyBounds upper bounds of latency histogram buckets, millisecond
+var sqlLatencyBounds = [...]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000}
+
+// SQLStats execution stats of a sql fingerprint
+type SQLStats struct {
+	MD5          string  `json:"md5"`
+	Fingerprint  string  `json:"fingerprint"`
+	Count        uint64  `json:"count"`
+	Errors       uint64  `json:"errors"`
+	Rows         uint64  `json:"rows"`
+	AvgLatency   float64 `json:"avg_latency"`   // millisecond
+	TotalLatency float64 `json:"total_latency"` // millisecond
+	MaxLatency   float64 `json:"max_latency"`   // millisecond
+	P50Latency   float64 `json:"p50_latency"`   // millisecond
+	P95Latency   float64 `json:"p95_latency"`   // millisecond
+	P99Latency   float64 `json:"p99_latency"`   // millisecond
+}
+
+// sqlStatsBucket counters of a sql fingerprint in one minute, or since it's recorded
+type sqlStatsBucket struct {
+	minute       int64
+	count        uint64
+	errors       uint64
+	rows         uint64
+	totalLatency float64
+	maxLatency   float64
+	histogram    [len(sqlLatencyBounds) + 1]uint64 // the last one is for latency out of bounds
+}
+
+func (b *sqlStatsBucket) record(latency float64, rows uint64, failed bool) {
+	b.count++
+	b.rows += rows
+	if failed {
+		b.errors++
+	}
+	b.totalLatency += latency
+	if latency > b.maxLatency {
+		b.maxLatency = latency
+	}
+	b.histogram[sort.SearchFloat64s(sqlLatencyBounds[:], latency)]++
+}
+
+func (b *sqlStatsBucket) merge(o *sqlStatsBucket) {
+	b.count += o.count
+	b.errors += o.errors
+	b.rows += o.rows
+	b.totalLatency += o.totalLatency
+	if o.maxLatency > b.maxLatency {
+		b.maxLatency = o.maxLatency
+	}
+	for i := range b.histogram {
+		b.histogram[i] += o.histogram[i]
+	}
+}
+
+// percentile return upper bound of the histogram bucket where percentile p falls in
+func (b *sqlStatsBucket) percentile(p float64) float64 {
+	if b.count == 0 {
+		return 0
+	}
+	rank := uint64(float64(b.count)*p + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range b.histogram {
+		n += c
+		if n >= rank {
+			if i < len(sqlLatencyBounds) && sqlLatencyBounds[i] < b.maxLatency {
+				return sqlLatencyBounds[i]
+			}
+			return b.maxLatency
+		}
+	}
+	return b.maxLatency
+}
+
+// sqlStatsEntry stats of a sql fingerprint, stored in lru cache of sqlStatsTable
+type sqlStatsEntry struct {
+	sync.Mutex
+	fingerprint string
+	total       sqlStatsBucket
+	minutes     [sqlStatsWindowMinutes]sqlStatsBucket
+}
+
+// Size implements cache.Value, the capacity of table is number of fingerprints
+func (e *sqlStatsEntry) Size() int {
+	return 1
+}
+
+func (e *sqlStatsEntry) record(now time.Time, latency float64, rows uint64, failed bool) {
+	minute := now.Unix() / 60
+	e.Lock()
+	defer e.Unlock()
+	e.total.record(latency, rows, failed)
+	b := &e.minutes[minute%sqlStatsWindowMinutes]
+	if b.minute > minute {
+		// clock goes back, don't overwrite newer bucket
+		return
+	}
+	if b.minute != minute {
+		*b = sqlStatsBucket{minute: minute}
+	}
+	b.record(latency, rows, failed)
+}
+
+// stats return stats in window, all stats since recorded if window is 0
+func (e *sqlStatsEntry) stats(md5 string, now time.Time, window time.Duration) *SQLStats {
+	e.Lock()
+	b := e.total
+	if window > 0 {
+		b = sqlStatsBucket{}
+		minute := now.Unix() / 60
+		for i := range e.minutes {
+			if m := e.minutes[i].minute; m > minute-int64(window/time.Minute) && m <= minute {
+				b.merge(&e.minutes[i])
+			}
+		}
+	}
+	e.Unlock()
+
+	s := &SQLStats{
+		MD5:          md5,
+		Fingerprint:  e.fingerprint,
+		Count:        b.count,
+		Errors:       b.errors,
+		Rows:         b.rows,
+		TotalLatency: b.totalLatency,
+		MaxLatency:   b.maxLatency,
+		P50Latency:   b.percentile(0.50),
+		P95Latency:   b.percentile(0.95),
+		P99Latency:   b.percentile(0.99),
+	}
+	if b.count > 0 {
+		s.AvgLatency = b.totalLatency / float64(b.count)
+	}
+	return s
+}
+
+// sqlStatsTable execution stats of sql fingerprints, least recently executed ones are evicted when it's full
+type sqlStatsTable struct {
+	entries *cache.LRUCache
+}
+
+func newSQLStatsTable(capacity int) *sqlStatsTable {
+	return &sqlStatsTable{entries: cache.NewLRUCache(int64(capacity))}
+}
+
+// Record record an execution of sql fingerprint, latency in millisecond
+func (t *sqlStatsTable) Record(md5, fingerprint string, latency float64, rows uint64, failed bool) {
+	v, ok := t.entries.Get(md5)
+	if !ok {
+		t.entries.SetIfAbsent(md5, &sqlStatsEntry{fingerprint: fingerprint})
+		if v, ok = t.entries.Get(md5); !ok {
+			return
+		}
+	}
+	v.(*sqlStatsEntry).record(time.Now(), latency, rows, failed)
+}
+
+// TopN return top n sql stats in window sorted by sortBy desc, all of them are returned if n <= 0
+func (t *sqlStatsTable) TopN(sortBy string, n int, window time.Duration) ([]*SQLStats, error) {
+	less, err := sqlStatsLess(sortBy)
+	if err != nil {
+		return nil, err
+	}
+	if window < 0 || window > sqlStatsWindowMinutes*time.Minute {
+		return nil, fmt.Errorf("window should be in [0, %dm]", sqlStatsWindowMinutes)
+	}
+	// round up to minutes
+	window = (window + time.Minute - 1) / time.Minute * time.Minute
+
+	now := time.Now()
+	ret := make([]*SQLStats, 0, t.entries.Length())
+	for _, item := range t.entries.Items() {
+		s := item.Value.(*sqlStatsEntry).stats(item.Key, now, window)
+		if s.Count > 0 {
+			ret = append(ret, s)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return less(ret[j], ret[i])
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret, nil
+}
+
+// Reset clear all stats
+func (t *sqlStatsTable) Reset() {
+	t.entries.Clear()
+}
+
+func sqlStatsLess(sortBy string) (func(a, b *SQLStats) bool, error) {
+	switch sortBy {
+	case "", SQLStatsSortLatency:
+		return func(a, b *SQLStats) bool { return a.P99Latency < b.P99Latency }, nil
+	case SQLStatsSortAvg:
+		return func(a, b *SQLStats) bool { return a.AvgLatency < b.AvgLatency }, nil
+	case SQLStatsSortTotal:
+		return func(a, b *SQLStats) bool { return a.TotalLatency < b.TotalLatency }, nil
+	case SQLStatsSortCount:
+		return func(a, b *SQLStats) bool { return a.Count < b.Count }, nil
+	case SQLStatsSortErrors:
+		return func(a, b *SQLStats) bool { return a.Errors < b.Errors }, nil
+	case SQLStatsSortRows:
+		return func(a, b *SQLStats) bool { return a.Rows < b.Rows }, nil
+	}
+	return nil, fmt.Errorf("unsupported sort: %s", sortBy)
+}
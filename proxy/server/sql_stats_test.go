@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLStatsBucketPercentile(t *testing.T) {
+	b := &sqlStatsBucket{}
+	assert.Equal(t, float64(0), b.percentile(0.99))
+
+	for i := 0; i < 98; i++ {
+		b.record(3, 1, false)
+	}
+	b.record(150, 1, false)
+	b.record(45000, 1, true)
+	assert.Equal(t, uint64(100), b.count)
+	assert.Equal(t, uint64(1), b.errors)
+	assert.Equal(t, float64(5), b.percentile(0.50))
+	assert.Equal(t, float64(5), b.percentile(0.95))
+	assert.Equal(t, float64(200), b.percentile(0.99))
+	assert.Equal(t, float64(45000), b.percentile(1))
+
+	// upper bound is capped by max latency
+	b = &sqlStatsBucket{}
+	b.record(3, 0, false)
+	assert.Equal(t, float64(3), b.percentile(0.99))
+}
+
+func TestSQLStatsEntryWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	e := &sqlStatsEntry{fingerprint: "select * from t where id = ?"}
+	e.record(now.Add(-30*time.Minute), 100, 1, false)
+	e.record(now.Add(-2*time.Minute), 10, 2, false)
+	e.record(now, 1, 3, true)
+
+	s := e.stats("md5", now, 0)
+	assert.Equal(t, uint64(3), s.Count)
+	assert.Equal(t, uint64(6), s.Rows)
+	assert.Equal(t, float64(111), s.TotalLatency)
+	assert.Equal(t, float64(37), s.AvgLatency)
+
+	s = e.stats("md5", now, 5*time.Minute)
+	assert.Equal(t, uint64(2), s.Count)
+	assert.Equal(t, uint64(1), s.Errors)
+	assert.Equal(t, float64(10), s.MaxLatency)
+
+	s = e.stats("md5", now, time.Minute)
+	assert.Equal(t, uint64(1), s.Count)
+
+	// bucket of the same slot an hour ago is not counted
+	e.record(now.Add(-time.Hour), 1000, 0, false)
+	s = e.stats("md5", now, time.Minute)
+	assert.Equal(t, uint64(1), s.Count)
+}
+
+func TestSQLStatsTableTopN(t *testing.T) {
+	table := newSQLStatsTable(2)
+	table.Record("a", "select a", 100, 1, false)
+	table.Record("b", "select b", 1, 10, false)
+	table.Record("b", "select b", 2, 10, true)
+
+	stats, err := table.TopN("", 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, "a", stats[0].MD5)
+	assert.Equal(t, "select a", stats[0].Fingerprint)
+
+	stats, err = table.TopN(SQLStatsSortCount, 1, 5*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, "b", stats[0].MD5)
+	assert.Equal(t, uint64(20), stats[0].Rows)
+
+	// least recently executed fingerprint is evicted
+	table.Record("c", "select c", 1, 0, false)
+	stats, _ = table.TopN(SQLStatsSortErrors, 0, 0)
+	assert.Equal(t, []string{"b", "c"}, []string{stats[0].MD5, stats[1].MD5})
+
+	_, err = table.TopN("unknown", 10, 0)
+	assert.NotNil(t, err)
+	_, err = table.TopN("", 10, 2*time.Hour)
+	assert.NotNil(t, err)
+
+	table.Reset()
+	stats, _ = table.TopN("", 10, 0)
+	assert.Equal(t, 0, len(stats))
+}
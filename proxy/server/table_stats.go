@@ -0,0 +1,153 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util/cache"
+)
+
+// operations of table stats
+const (
+	tableStatsRead  = "read"
+	tableStatsWrite = "write"
+)
+
+// TableStats read and write stats of a logical table
+type TableStats struct {
+	Table string        `json:"table"` // db.table
+	Read  *TableOpStats `json:"read"`
+	Write *TableOpStats `json:"write"`
+}
+
+// TableOpStats stats of read or write sql on a table
+type TableOpStats struct {
+	Count      uint64  `json:"count"`
+	Errors     uint64  `json:"errors"`
+	Rows       uint64  `json:"rows"`
+	QPS        float64 `json:"qps"`
+	AvgLatency float64 `json:"avg_latency"` // millisecond
+	MaxLatency float64 `json:"max_latency"` // millisecond
+	P95Latency float64 `json:"p95_latency"` // millisecond
+	P99Latency float64 `json:"p99_latency"` // millisecond
+}
+
+// tableStatsEntry stats of a table, stored in lru cache of tableStatsTable
+type tableStatsEntry struct {
+	created time.Time
+	read    sqlStatsEntry
+	write   sqlStatsEntry
+}
+
+// Size implements cache.Value, the capacity of table is number of tables
+func (e *tableStatsEntry) Size() int {
+	return 1
+}
+
+func (e *tableStatsEntry) stats(table string, now time.Time, window time.Duration) *TableStats {
+	// qps is calculated in window, or since the table is recorded
+	start := e.created
+	if window > 0 {
+		start = time.Unix((now.Unix()/60-int64(window/time.Minute)+1)*60, 0)
+	}
+	seconds := now.Sub(start).Seconds()
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	opStats := func(s *SQLStats) *TableOpStats {
+		return &TableOpStats{
+			Count:      s.Count,
+			Errors:     s.Errors,
+			Rows:       s.Rows,
+			QPS:        float64(s.Count) / seconds,
+			AvgLatency: s.AvgLatency,
+			MaxLatency: s.MaxLatency,
+			P95Latency: s.P95Latency,
+			P99Latency: s.P99Latency,
+		}
+	}
+	return &TableStats{
+		Table: table,
+		Read:  opStats(e.read.stats("", now, window)),
+		Write: opStats(e.write.stats("", now, window)),
+	}
+}
+
+// tableStatsTable read and write stats of logical tables, least recently used tables are evicted when it's full
+type tableStatsTable struct {
+	entries *cache.LRUCache
+}
+
+func newTableStatsTable(capacity int) *tableStatsTable {
+	return &tableStatsTable{entries: cache.NewLRUCache(int64(capacity))}
+}
+
+// Record record an execution on table, latency in millisecond
+func (t *tableStatsTable) Record(table string, write bool, latency float64, rows uint64, failed bool) {
+	v, ok := t.entries.Get(table)
+	if !ok {
+		t.entries.SetIfAbsent(table, &tableStatsEntry{created: time.Now()})
+		if v, ok = t.entries.Get(table); !ok {
+			return
+		}
+	}
+	e := v.(*tableStatsEntry)
+	if write {
+		e.write.record(time.Now(), latency, rows, failed)
+	} else {
+		e.read.record(time.Now(), latency, rows, failed)
+	}
+}
+
+// Stats return stats of all tables in window sorted by table name
+func (t *tableStatsTable) Stats(window time.Duration) ([]*TableStats, error) {
+	if window < 0 || window > sqlStatsWindowMinutes*time.Minute {
+		return nil, fmt.Errorf("window should be in [0, %dm]", sqlStatsWindowMinutes)
+	}
+	// round up to minutes
+	window = (window + time.Minute - 1) / time.Minute * time.Minute
+
+	now := time.Now()
+	items := t.entries.Items()
+	ret := make([]*TableStats, 0, len(items))
+	for _, item := range items {
+		ret = append(ret, item.Value.(*tableStatsEntry).stats(item.Key, now, window))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Table < ret[j].Table
+	})
+	return ret, nil
+}
+
+// Reset clear all stats
+func (t *tableStatsTable) Reset() {
+	t.entries.Clear()
+}
+
+// tableStatsOperation return read or write of statement, ok is false if it's neither
+func tableStatsOperation(stmtType int) (string, bool) {
+	switch stmtType {
+	case parser.StmtSelect:
+		return tableStatsRead, true
+	case parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete:
+		return tableStatsWrite, true
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableStatsOperation(t *testing.T) {
+	op, ok := tableStatsOperation(parser.StmtSelect)
+	assert.True(t, ok)
+	assert.Equal(t, tableStatsRead, op)
+	op, ok = tableStatsOperation(parser.StmtReplace)
+	assert.True(t, ok)
+	assert.Equal(t, tableStatsWrite, op)
+	_, ok = tableStatsOperation(parser.StmtShow)
+	assert.False(t, ok)
+}
+
+func TestTableStatsEntry(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	e := &tableStatsEntry{created: now.Add(-100 * time.Second)}
+	for i := 0; i < 10; i++ {
+		e.read.record(now, 2, 1, false)
+	}
+	e.write.record(now.Add(-10*time.Minute), 30, 1, true)
+
+	// qps since recorded
+	s := e.stats("db.t", now, 0)
+	assert.Equal(t, "db.t", s.Table)
+	assert.Equal(t, uint64(10), s.Read.Count)
+	assert.Equal(t, 0.1, s.Read.QPS)
+	assert.Equal(t, uint64(1), s.Write.Errors)
+	assert.Equal(t, float64(30), s.Write.P99Latency)
+
+	// qps in current minute, 30 seconds passed
+	s = e.stats("db.t", now, time.Minute)
+	assert.Equal(t, float64(10)/30, s.Read.QPS)
+	assert.Equal(t, uint64(0), s.Write.Count)
+}
+
+func TestTableStatsTable(t *testing.T) {
+	table := newTableStatsTable(10)
+	table.Record("db.b", true, 1, 1, false)
+	table.Record("db.a", false, 1, 5, false)
+	table.Record("db.a", true, 1, 1, false)
+
+	stats, err := table.Stats(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, "db.a", stats[0].Table)
+	assert.Equal(t, uint64(5), stats[0].Read.Rows)
+	assert.Equal(t, uint64(1), stats[0].Write.Count)
+	assert.Equal(t, uint64(0), stats[1].Read.Count)
+
+	_, err = table.Stats(-time.Minute)
+	assert.NotNil(t, err)
+
+	table.Reset()
+	stats, _ = table.Stats(0)
+	assert.Equal(t, 0, len(stats))
+}
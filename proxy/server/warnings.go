@@ -0,0 +1,204 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/log"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// maxWarningRows warnings kept for a statement, like default max_error_count of mysql
+const maxWarningRows = 64
+
+const (
+	warningLevelWarning = "Warning"
+	warningLevelError   = "Error"
+)
+
+// partialResultWarning message of warning of sqls skipped by partial result query
+const partialResultWarning = "statement on unavailable slice is skipped in partial result query"
+
+// warningRow a row of SHOW WARNINGS
+type warningRow struct {
+	level   string
+	code    uint64
+	message string
+}
+
+// fetchWarnings read warnings of the last statement executed on backend connection, it's called only if
+// result has warnings so statements without warnings don't pay for another round trip
+func fetchWarnings(pc backend.PooledConnect, r *mysql.Result) []warningRow {
+	if r == nil || r.Warnings == 0 {
+		return nil
+	}
+	rs, err := pc.Execute("SHOW WARNINGS", 0)
+	if err != nil {
+		log.Warn("fetch warnings from backend %s error: %v", pc.GetAddr(), err)
+		return nil
+	}
+	if rs.Resultset == nil {
+		return nil
+	}
+	rows := make([]warningRow, 0, len(rs.Values))
+	for i := range rs.Values {
+		level, _ := rs.GetString(i, 0)
+		code, _ := rs.GetUint(i, 1)
+		message, _ := rs.GetString(i, 2)
+		// strings may share memory of result, copy them since they are kept after the result is released
+		rows = append(rows, warningRow{level: string([]byte(level)), code: code, message: string([]byte(message))})
+	}
+	return rows
+}
+
+// addStmtWarnings add warnings got from backend to current statement
+func (se *SessionExecutor) addStmtWarnings(rows []warningRow) {
+	if len(rows) == 0 || len(se.stmtWarnings) >= maxWarningRows {
+		return
+	}
+	if n := maxWarningRows - len(se.stmtWarnings); len(rows) > n {
+		rows = rows[:n]
+	}
+	se.stmtWarnings = append(se.stmtWarnings, rows...)
+}
+
+// recordWarnings keep warnings of current statement for SHOW WARNINGS like mysql, warnings of backends of
+// all slices are merged. SHOW WARNINGS and SHOW ERRORS themselves don't change them.
+func (se *SessionExecutor) recordWarnings(reqCtx *util.RequestContext, err error) {
+	rows := se.stmtWarnings
+	se.stmtWarnings = nil
+	if _, ok := parseShowWarnings(reqCtx.GetTokens()); ok {
+		return
+	}
+	for i := 0; i < reqCtx.GetWarnings() && len(rows) < maxWarningRows; i++ {
+		rows = append(rows, warningRow{level: warningLevelWarning, code: mysql.ErrUnknown, message: partialResultWarning})
+	}
+	if err != nil && len(rows) < maxWarningRows {
+		if e, ok := err.(*mysql.SQLError); ok {
+			rows = append(rows, warningRow{level: warningLevelError, code: uint64(e.Code), message: e.Message})
+		} else {
+			rows = append(rows, warningRow{level: warningLevelError, code: mysql.ErrUnknown, message: err.Error()})
+		}
+	}
+	se.warnings = rows
+}
+
+// showWarningsStmt SHOW WARNINGS, SHOW ERRORS and SHOW COUNT(*) WARNINGS/ERRORS
+type showWarningsStmt struct {
+	errorsOnly bool
+	count      bool
+	offset     int
+	limit      int // -1 means no limit
+}
+
+// parseShowWarnings parse tokens of SHOW {WARNINGS | ERRORS} [LIMIT [offset,] row_count]
+// and SHOW COUNT(*) {WARNINGS | ERRORS}
+func parseShowWarnings(tokens []string) (*showWarningsStmt, bool) {
+	if len(tokens) < 2 || strings.ToLower(tokens[0]) != "show" {
+		return nil, false
+	}
+	stmt := &showWarningsStmt{limit: -1}
+	kind := strings.ToLower(tokens[1])
+	rest := tokens[2:]
+	if kind == "count(*)" {
+		if len(tokens) != 3 {
+			return nil, false
+		}
+		stmt.count = true
+		kind = strings.ToLower(tokens[2])
+		rest = nil
+	}
+	switch kind {
+	case "warnings":
+	case "errors":
+		stmt.errorsOnly = true
+	default:
+		return nil, false
+	}
+	if len(rest) == 0 {
+		return stmt, true
+	}
+	if strings.ToLower(rest[0]) != "limit" || len(rest) < 2 || len(rest) > 3 {
+		return nil, false
+	}
+	nums := make([]int, 0, 2)
+	for _, t := range rest[1:] {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	stmt.limit = nums[len(nums)-1]
+	if len(nums) == 2 {
+		stmt.offset = nums[0]
+	}
+	return stmt, true
+}
+
+// handleShowWarnings answer SHOW WARNINGS and SHOW ERRORS by warnings of last statement kept by proxy,
+// since the last statement may be executed on other backend connections or on multiple slices
+func (se *SessionExecutor) handleShowWarnings(reqCtx *util.RequestContext) (*mysql.Result, bool, error) {
+	stmt, ok := parseShowWarnings(reqCtx.GetTokens())
+	if !ok {
+		return nil, false, nil
+	}
+	rows := se.warnings
+	if stmt.errorsOnly {
+		rows = make([]warningRow, 0, len(se.warnings))
+		for _, w := range se.warnings {
+			if w.level == warningLevelError {
+				rows = append(rows, w)
+			}
+		}
+	}
+
+	rs := new(mysql.Resultset)
+	if stmt.count {
+		name := "@@session.warning_count"
+		if stmt.errorsOnly {
+			name = "@@session.error_count"
+		}
+		rs.Fields = append(rs.Fields, &mysql.Field{Name: hack.Slice(name), Charset: 63, Type: mysql.TypeLonglong})
+		rs.Values = append(rs.Values, []interface{}{int64(len(rows))})
+	} else {
+		if stmt.offset < len(rows) {
+			rows = rows[stmt.offset:]
+		} else {
+			rows = nil
+		}
+		if stmt.limit >= 0 && stmt.limit < len(rows) {
+			rows = rows[:stmt.limit]
+		}
+		rs.Fields = append(rs.Fields,
+			&mysql.Field{Name: hack.Slice("Level"), Charset: 33, Type: mysql.TypeVarString},
+			&mysql.Field{Name: hack.Slice("Code"), Charset: 63, Type: mysql.TypeLong, Flag: uint16(mysql.UnsignedFlag)},
+			&mysql.Field{Name: hack.Slice("Message"), Charset: 33, Type: mysql.TypeVarString})
+		for _, w := range rows {
+			rs.Values = append(rs.Values, []interface{}{w.level, w.code, w.message})
+		}
+	}
+
+	result := mysql.ResultPool.Get()
+	result.AffectedRows = uint64(len(rs.Values))
+	result.Resultset = rs
+	return result, true, plan.GenerateSelectResultRowData(result)
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShowWarnings(t *testing.T) {
+	tests := []struct {
+		sql    string
+		ok     bool
+		expect showWarningsStmt
+	}{
+		{"show warnings", true, showWarningsStmt{limit: -1}},
+		{"SHOW ERRORS", true, showWarningsStmt{errorsOnly: true, limit: -1}},
+		{"show warnings limit 3", true, showWarningsStmt{limit: 3}},
+		{"show warnings limit 1, 2", true, showWarningsStmt{offset: 1, limit: 2}},
+		{"SHOW COUNT(*) WARNINGS", true, showWarningsStmt{count: true, limit: -1}},
+		{"show count(*) errors", true, showWarningsStmt{count: true, errorsOnly: true, limit: -1}},
+		{"show warnings limit a", false, showWarningsStmt{}},
+		{"show variables", false, showWarningsStmt{}},
+		{"select 1", false, showWarningsStmt{}},
+	}
+	for _, test := range tests {
+		stmt, ok := parseShowWarnings(parser.Tokenize(test.sql))
+		require.Equal(t, test.ok, ok, test.sql)
+		if ok {
+			assert.Equal(t, test.expect, *stmt, test.sql)
+		}
+	}
+}
+
+func newWarningsResult(rows ...warningRow) *mysql.Result {
+	rs := &mysql.Resultset{Fields: make([]*mysql.Field, 3)}
+	for _, w := range rows {
+		rs.Values = append(rs.Values, []interface{}{w.level, w.code, w.message})
+	}
+	return &mysql.Result{Resultset: rs}
+}
+
+func TestMergeWarningsOfSlices(t *testing.T) {
+	se, err := prepareSessionExecutor()
+	require.NoError(t, err)
+	se.session.c = &ClientConn{Conn: &mysql.Conn{}}
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	newConn := func(db, sql string, r *mysql.Result) *backend.MockPooledConnect {
+		pc := backend.NewMockPooledConnect(mockCtl)
+		pc.EXPECT().UseDB(db).Return(nil)
+		pc.EXPECT().SetCharset("utf8", mysql.CharsetIds["utf8"]).Return(false, nil)
+		pc.EXPECT().SetSessionVariables(gomock.Any()).Return(false, nil)
+		pc.EXPECT().GetAddr().Return("127.0.0.1:3306").AnyTimes()
+		pc.EXPECT().GetConnectionID().Return(int64(1)).AnyTimes()
+		pc.EXPECT().IsClosed().Return(false).AnyTimes()
+		pc.EXPECT().ExecuteWithContext(gomock.Any(), sql, gomock.Any()).Return(r, nil)
+		return pc
+	}
+	w0 := warningRow{level: warningLevelWarning, code: 1265, message: "Data truncated for column 'name' at row 1"}
+	w1 := warningRow{level: warningLevelWarning, code: 1366, message: "Incorrect integer value: 'a' for column 'age' at row 1"}
+	slice0 := newConn("db_mycat_0", "update t_0 set name = 'abc'", &mysql.Result{AffectedRows: 1, Warnings: 1})
+	slice0.EXPECT().Execute("SHOW WARNINGS", 0).Return(newWarningsResult(w0), nil)
+	slice1 := newConn("db_mycat_2", "update t_2 set name = 'abc'", &mysql.Result{AffectedRows: 1, Warnings: 1})
+	slice1.EXPECT().Execute("SHOW WARNINGS", 0).Return(newWarningsResult(w1), nil)
+	// statement without warnings doesn't fetch them
+	slice2 := newConn("db_mycat_4", "update t_4 set name = 'abc'", &mysql.Result{AffectedRows: 1})
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.SetStmtType(parser.StmtUpdate)
+	pcs := map[string]backend.PooledConnect{"slice-0": slice0, "slice-1": slice1, "slice-2": slice2}
+	sqls := map[string]map[string][]string{
+		"slice-0": {"db_mycat_0": {"update t_0 set name = 'abc'"}},
+		"slice-1": {"db_mycat_2": {"update t_2 set name = 'abc'"}},
+		"slice-2": {"db_mycat_4": {"update t_4 set name = 'abc'"}},
+	}
+	rs, err := se.executeInMultiSlices(reqCtx, pcs, sqls)
+	require.NoError(t, err)
+	r, err := plan.MergeExecResult(rs)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(2), r.Warnings)
+	se.recordWarnings(reqCtx, nil)
+
+	showCtx := util.NewRequestContext()
+	showCtx.SetTokens(parser.Tokenize("show warnings"))
+	r, handled, err := se.handleShowWarnings(showCtx)
+	require.NoError(t, err)
+	require.True(t, handled)
+	require.Len(t, r.Values, 2)
+	assert.Equal(t, []interface{}{w0.level, w0.code, w0.message}, r.Values[0])
+	assert.Equal(t, []interface{}{w1.level, w1.code, w1.message}, r.Values[1])
+
+	// SHOW WARNINGS doesn't clear warnings
+	se.recordWarnings(showCtx, nil)
+	showCtx.SetTokens(parser.Tokenize("show count(*) warnings"))
+	r, _, err = se.handleShowWarnings(showCtx)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(2)}, r.Values[0])
+
+	// error of next statement replaces warnings
+	se.recordWarnings(reqCtx, mysql.NewDefaultError(mysql.ErrNoSuchTable, "db", "t"))
+	showCtx.SetTokens(parser.Tokenize("show errors"))
+	r, _, err = se.handleShowWarnings(showCtx)
+	require.NoError(t, err)
+	require.Len(t, r.Values, 1)
+	assert.Equal(t, []interface{}{warningLevelError, uint64(mysql.ErrNoSuchTable), "Table 'db.t' doesn't exist"}, r.Values[0])
+
+	se.recordWarnings(reqCtx, nil)
+	assert.Empty(t, se.warnings)
+}
@@ -0,0 +1,53 @@
+#!/bin/bash
+
+# Run gaea-bench workloads against a running gaea and compare results with baseline.
+# The namespace of gaea should contain db_bench.tbl_bench, sharded by id for scatter workload.
+#
+# Usage:
+#   ./tests/bench/run.sh                  compare with tests/bench/baseline.json
+#   SAVE_BASELINE=1 ./tests/bench/run.sh  save results as baseline
+#
+# Env:
+#   GAEA_ADDR, GAEA_USER, GAEA_PASSWORD gaea address and user, default 127.0.0.1:13306 gaea_user gaea_pass
+#   THREADS, DURATION concurrency and duration of each workload, default 8 and 30s
+#   ROWS rows of bench table, default 10000
+#   MAX_REGRESSION max regression percent of qps and p99 latency, default 10
+
+set -euo pipefail
+
+ROOT=$(cd "$(dirname "$0")/../.." && pwd)
+BENCH="$ROOT/bin/gaea-bench"
+BASELINE="$ROOT/tests/bench/baseline.json"
+
+GAEA_ADDR=${GAEA_ADDR:-127.0.0.1:13306}
+GAEA_USER=${GAEA_USER:-gaea_user}
+GAEA_PASSWORD=${GAEA_PASSWORD:-gaea_pass}
+THREADS=${THREADS:-8}
+DURATION=${DURATION:-30s}
+ROWS=${ROWS:-10000}
+MAX_REGRESSION=${MAX_REGRESSION:-10}
+
+if [ ! -x "$BENCH" ]; then
+    (cd "$ROOT" && make gaea-bench)
+fi
+
+args=(-addr "$GAEA_ADDR" -user "$GAEA_USER" -password "$GAEA_PASSWORD" -threads "$THREADS" -duration "$DURATION" -rows "$ROWS")
+if [ "${SAVE_BASELINE:-0}" = "1" ]; then
+    args+=(-baseline "$BASELINE" -save-baseline)
+elif [ -f "$BASELINE" ]; then
+    args+=(-baseline "$BASELINE" -max-regression "$MAX_REGRESSION")
+else
+    echo "baseline $BASELINE not found, run with SAVE_BASELINE=1 to create it"
+fi
+
+failed=0
+prepare=-prepare
+for workload in point-select read-write scatter; do
+    echo "=== $workload"
+    if ! "$BENCH" "${args[@]}" $prepare -workload "$workload"; then
+        failed=1
+    fi
+    # the table is only prepared once, read-write workload doesn't change row count
+    prepare=
+done
+exit $failed
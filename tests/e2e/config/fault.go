@@ -0,0 +1,58 @@
+// Copyright 2024 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/util/requests"
+)
+
+const (
+	// 注意这里的端口和账号要和 gaea.ini 中的 admin_addr、admin_user、admin_password 一致
+	gaeaAdminFaultRouter = "http://localhost:13307/api/proxy/chaos/fault"
+	gaeaAdminUser        = "test"
+	gaeaAdminPassword    = "test"
+)
+
+// InjectFault 向 gaea 注入后端故障, gaea 需要使用 chaos tag 编译, 见 Makefile 中的 gaea-chaos
+func (e *E2eManager) InjectFault(f *backend.Fault) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return sendFaultRequest(requests.Put, data)
+}
+
+// ClearFaults 清除 gaea 中注入的所有后端故障
+func (e *E2eManager) ClearFaults() error {
+	return sendFaultRequest(requests.Delete, nil)
+}
+
+func sendFaultRequest(method string, data []byte) error {
+	req := requests.NewRequest(gaeaAdminFaultRouter, method, map[string]string{"Content-Type": "application/json"}, nil, data)
+	req.SetBasicAuth(gaeaAdminUser, gaeaAdminPassword)
+	resp, err := requests.Send(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(string(resp.Body))
+	}
+	return nil
+}
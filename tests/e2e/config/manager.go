@@ -24,7 +24,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
@@ -59,8 +58,6 @@ const (
 	SliceSingleSlave = "slice-single-slave"
 	// SliceDualSlave 表示测试的主从 MySQL 集群 3319 3329 3339
 	SliceDualSlave = "slice-dual-slave"
-	// LogExpression 标识 Gaea SQL Log 的格式
-	LogExpression = `\[(.*?)\] \[INFO\] \[(\d+)\] OK - (\d+\.\d+)ms - ns=(.*?), (.*?)@(.*?)->(.*?)/(.*?), connect_id=(\d+), mysql_connect_id=(\d+), transaction=(\w+)\|(.*?)$`
 )
 
 var logDirectory = "cmd/logs"
@@ -133,127 +130,9 @@ func NewE2eManager() *E2eManager {
 		},
 	}
 
-	// 3379
-	sliceSingleTestMaster := &NsSlice{
-		Name: SliceSingleTestMaster,
-		Slices: []*models.Slice{
-			{
-				Name:            "slice-0",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3379),
-				Slaves:          nil,
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-			},
-		},
-		GaeaUsers: GaeaUsers,
-	}
-	// 3349
-	sliceSingleMaster := &NsSlice{
-		Name: SliceSingleMaster,
-		Slices: []*models.Slice{
-			{
-				Name:            "slice-0",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3349),
-				Slaves:          nil,
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-				Capability:      500357,
-			},
-		},
-		GaeaUsers: GaeaUsers,
-	}
-	// 3319 3329 3339
-	sliceMasterSlaves := &NsSlice{
-		Name: SliceDualSlave,
-		Slices: []*models.Slice{
-			{
-				Name:            "slice-0",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3319),
-				Slaves:          []string{fmt.Sprintf("%s:%d", defaultHost, 3329), fmt.Sprintf("%s:%d", defaultHost, 3339)},
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-			},
-		},
-		GaeaUsers: GaeaUsers,
-	}
-
-	// 3319 3329
-	sliceMasterSingleSlave := &NsSlice{
-		Name: SliceSingleSlave,
-		Slices: []*models.Slice{
-			{
-				Name:            "slice-0",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3319),
-				Slaves:          []string{fmt.Sprintf("%s:%d", defaultHost, 3329)},
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-			},
-		},
-		GaeaUsers: GaeaUsers,
-	}
-	// 3319 3349
-	sliceMultiMasters := &NsSlice{
-		Name: SliceDualMaster,
-		Slices: []*models.Slice{
-			{
-				Name:            "slice-0",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3319),
-				Slaves:          nil,
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-			},
-			{
-				Name:            "slice-1",
-				UserName:        defaultGaeaBackendUser,
-				Password:        defaultGaeaBackendPass,
-				Master:          fmt.Sprintf("%s:%d", defaultHost, 3349),
-				Slaves:          nil,
-				StatisticSlaves: nil,
-				Capacity:        12,
-				HealthCheckSql:  "",
-				MaxCapacity:     24,
-				IdleTimeout:     60,
-			},
-		},
-		GaeaUsers: GaeaUsers,
-	}
-
-	nsSlices := map[string]*NsSlice{
-		//3349
-		sliceSingleMaster.Name: sliceSingleMaster,
-		//3379
-		sliceSingleTestMaster.Name: sliceSingleTestMaster,
-		//3319 3329 3339
-		sliceMasterSlaves.Name: sliceMasterSlaves,
-		//3329 3339
-		sliceMultiMasters.Name: sliceMultiMasters,
-		//3319 3329
-		sliceMasterSingleSlave.Name: sliceMasterSingleSlave,
+	nsSlices := make(map[string]*NsSlice)
+	for _, topology := range DefaultTopologies() {
+		nsSlices[topology.Name] = topology.NsSlice(GaeaUsers)
 	}
 	E2eMgr = &E2eManager{
 		NsManager: NewNamespaceRegisterManger(),
@@ -430,45 +309,22 @@ func (g *GaeaCCManager) listNamespaces() ([]string, error) {
 	return listResp.Data, nil
 }
 
-// SearchSqlLog function in the provided code is designed to search through SQL log files for specific entries.
-// It takes a search string and a timestamp, and returns a slice of log entries that match the criteria.
-// The incoming searchString will be unblocked.
-// The function reads log files within a specified directory, looking for files named with the prefix "gaea_sql.log".
-// It uses regular expressions to parse and match log entries based on the input parameters.
-// If a matching entry is found, it's added to the result slice. The function handles errors such as file access issues and returns an error if any problems occur during the file reading and parsing process.
+// SearchSqlLog 返回 currentTime 之后 sql 和 searchString 相同的 sql 日志, searchString 末尾的分号会被忽略.
+// 更复杂的过滤条件请使用 SqlLogReader.
 func (e *E2eManager) SearchSqlLog(searchString string, currentTime time.Time) ([]util.LogEntry, error) {
 	// 等待日志落盘
 	time.Sleep(100 * time.Millisecond)
-	searchString = strings.TrimSuffix(searchString, ";")
-	var allEntries []util.LogEntry
-
-	err := filepath.Walk(e.GCluster.LogDirectory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && strings.HasPrefix(info.Name(), "gaea_sql.log") && info.Mode()&os.ModeSymlink == 0 {
-			file, err := os.Open(path)
-			if err != nil {
-				return fmt.Errorf("open file:%s error %v", path, err)
-			}
-			defer file.Close()
-
-			re := regexp.MustCompile(LogExpression)
-
-			entries, err := util.ParseLogEntries(file, re, currentTime, searchString)
-			if err != nil {
-				return err
-			}
-			allEntries = append(allEntries, entries...)
-		}
-		return nil
+	return e.SqlLogReader().Read(util.LogFilter{
+		Query: searchString,
+		Since: currentTime,
 	})
+}
 
-	if err != nil {
-		return []util.LogEntry{}, err
-	}
-	return allEntries, nil
+// SqlLogReader 返回读取 gaea sql 日志的 LogReader
+func (e *E2eManager) SqlLogReader() *util.LogReader {
+	return util.NewLogReader(e.GCluster.LogDirectory)
 }
+
 func (e *E2eManager) ClearSqlLog() error {
 	err := filepath.Walk(e.GCluster.LogDirectory, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
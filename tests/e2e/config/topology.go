@@ -0,0 +1,278 @@
+// Copyright 2024 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+const (
+	// SliceEightShard 表示 8 个分片的多主 MySQL 集群 3400-3407
+	SliceEightShard = "slice-eight-shard"
+
+	defaultTopologyImage = "mysql:5.7"
+	composeFileName      = "docker-compose.yml"
+)
+
+//go:embed docker/compose.template
+var composeTmpl string
+
+// SliceTopology 声明一个 slice 的 MySQL 实例布局, 以端口区分实例
+type SliceTopology struct {
+	Master          int
+	Slaves          []int
+	StatisticSlaves []int
+	Capability      uint32
+}
+
+// Topology 声明式地描述一组 slice, 可以生成 NsSlice 以及 docker-compose 配置
+type Topology struct {
+	Name   string
+	Image  string
+	Slices []SliceTopology
+}
+
+// NewTopology 创建一个空的拓扑, 通过 AddSlice 追加 slice
+func NewTopology(name string) *Topology {
+	return &Topology{Name: name, Image: defaultTopologyImage}
+}
+
+// AddSlice 追加一个 slice, slaves 和 statisticSlaves 均从 master 复制
+func (t *Topology) AddSlice(master int, slaves []int, statisticSlaves []int) *Topology {
+	t.Slices = append(t.Slices, SliceTopology{
+		Master:          master,
+		Slaves:          slaves,
+		StatisticSlaves: statisticSlaves,
+	})
+	return t
+}
+
+// AddShards 追加 n 个单主 slice, 端口从 basePort 开始递增
+func (t *Topology) AddShards(n int, basePort int) *Topology {
+	for i := 0; i < n; i++ {
+		t.AddSlice(basePort+i, nil, nil)
+	}
+	return t
+}
+
+// WithCapability 设置最后一个 slice 的 capability
+func (t *Topology) WithCapability(capability uint32) *Topology {
+	if len(t.Slices) != 0 {
+		t.Slices[len(t.Slices)-1].Capability = capability
+	}
+	return t
+}
+
+// NsSlice 根据拓扑生成 namespace 模板使用的 NsSlice
+func (t *Topology) NsSlice(users []*models.User) *NsSlice {
+	slices := make([]*models.Slice, 0, len(t.Slices))
+	for i, s := range t.Slices {
+		slices = append(slices, &models.Slice{
+			Name:            fmt.Sprintf("slice-%d", i),
+			UserName:        defaultGaeaBackendUser,
+			Password:        defaultGaeaBackendPass,
+			Master:          hostAddr(s.Master),
+			Slaves:          hostAddrs(s.Slaves),
+			StatisticSlaves: hostAddrs(s.StatisticSlaves),
+			Capacity:        12,
+			MaxCapacity:     24,
+			IdleTimeout:     60,
+			Capability:      s.Capability,
+		})
+	}
+	return &NsSlice{
+		Name:      t.Name,
+		Slices:    slices,
+		GaeaUsers: users,
+	}
+}
+
+// Verify 检查拓扑中的端口是否重复
+func (t *Topology) Verify() error {
+	if len(t.Slices) == 0 {
+		return fmt.Errorf("topology %s has no slice", t.Name)
+	}
+	seen := make(map[int]bool)
+	for _, instance := range t.instances() {
+		if instance.Port <= 0 {
+			return fmt.Errorf("topology %s has invalid port %d", t.Name, instance.Port)
+		}
+		if seen[instance.Port] {
+			return fmt.Errorf("topology %s has duplicate port %d", t.Name, instance.Port)
+		}
+		seen[instance.Port] = true
+	}
+	return nil
+}
+
+// Ports 返回拓扑中所有实例的端口, 升序排列
+func (t *Topology) Ports() []int {
+	var ports []int
+	for _, instance := range t.instances() {
+		ports = append(ports, instance.Port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// topologyInstance 是 docker-compose 模板中的一个 mysqld 服务
+type topologyInstance struct {
+	Port       int
+	ServerID   int
+	MasterPort int
+	ReadOnly   bool
+}
+
+func (t *Topology) instances() []topologyInstance {
+	var instances []topologyInstance
+	for _, s := range t.Slices {
+		instances = append(instances, topologyInstance{Port: s.Master, ServerID: s.Master})
+		for _, slave := range append(append([]int{}, s.Slaves...), s.StatisticSlaves...) {
+			instances = append(instances, topologyInstance{
+				Port:       slave,
+				ServerID:   slave,
+				MasterPort: s.Master,
+				ReadOnly:   true,
+			})
+		}
+	}
+	return instances
+}
+
+// ComposeFile 渲染 docker-compose 配置, 所有实例使用 host 网络以保证 127.0.0.1:port 可达
+func (t *Topology) ComposeFile() ([]byte, error) {
+	if err := t.Verify(); err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(t.Name).Parse(composeTmpl)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"Name":          t.Name,
+		"Image":         t.Image,
+		"Instances":     t.instances(),
+		"AdminUser":     defaultMysqlAdminUser,
+		"AdminPassword": defaultMysqlAdminPasswd,
+		"BackendUser":   defaultGaeaBackendUser,
+		"BackendPass":   defaultGaeaBackendPass,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Up 在 dir 下生成 docker-compose 配置并启动, 等待所有实例可连接
+func (t *Topology) Up(dir string, timeout time.Duration) error {
+	content, err := t.ComposeFile()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, composeFileName)
+	if err = ioutil.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+	if err = runCompose(file, "up", "-d"); err != nil {
+		return err
+	}
+	return t.waitReady(timeout)
+}
+
+// Down 停止并删除 dir 下 docker-compose 启动的实例
+func (t *Topology) Down(dir string) error {
+	return runCompose(filepath.Join(dir, composeFileName), "down", "-v")
+}
+
+func (t *Topology) waitReady(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, port := range t.Ports() {
+		for {
+			db, err := InitConn(defaultMysqlAdminUser, defaultMysqlAdminPasswd, hostAddr(port), "")
+			if err == nil {
+				err = db.PingContext(ctx)
+				db.Close()
+			}
+			if err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("topology %s wait mysql %d ready error: %v", t.Name, port, err)
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+func runCompose(file string, args ...string) error {
+	cmd := exec.Command("docker", append([]string{"compose", "-f", file}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker compose %v error: %v, output: %s", args, err, output)
+	}
+	return nil
+}
+
+func hostAddr(port int) string {
+	return fmt.Sprintf("%s:%d", defaultHost, port)
+}
+
+func hostAddrs(ports []int) []string {
+	if len(ports) == 0 {
+		return nil
+	}
+	addrs := make([]string, 0, len(ports))
+	for _, port := range ports {
+		addrs = append(addrs, hostAddr(port))
+	}
+	return addrs
+}
+
+// DefaultTopologies 返回 e2e 用例使用的预定义拓扑
+func DefaultTopologies() []*Topology {
+	return []*Topology{
+		// 3379
+		NewTopology(SliceSingleTestMaster).AddSlice(3379, nil, nil),
+		// 3349
+		NewTopology(SliceSingleMaster).AddSlice(3349, nil, nil).WithCapability(500357),
+		// 3319 3329 3339
+		NewTopology(SliceDualSlave).AddSlice(3319, []int{3329, 3339}, nil),
+		// 3319 3329
+		NewTopology(SliceSingleSlave).AddSlice(3319, []int{3329}, nil),
+		// 3319 3349
+		NewTopology(SliceDualMaster).AddSlice(3319, nil, nil).AddSlice(3349, nil, nil),
+		// 3400-3407
+		NewTopology(SliceEightShard).AddShards(8, 3400),
+	}
+}
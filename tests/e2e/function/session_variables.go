@@ -359,6 +359,54 @@ var _ = ginkgo.Describe("Test Gaea SET SESSION Variables", func() {
 		})
 	})
 
+	ginkgo.Context("When tracking of common session variables is enabled", func() {
+		ginkgo.BeforeEach(func() {
+			// Namespace preparation and modification per test to ensure isolation
+			initNs, err := config.ParseNamespaceTmpl(config.DefaultNamespaceTmpl, slice)
+			util.ExpectNoError(err, "parse namespace template")
+			initNs.TrackSessionVariables = true
+			err = e2eMgr.ModifyNamespace(initNs)
+			util.ExpectNoError(err)
+		})
+
+		ginkgo.It("should allow tracked session variables not configured in allowedSessionVariables", func() {
+			needCleanup = true // Set this flag only if the test modifies the namespace
+			tests := []struct {
+				VariableName      string
+				Type              string
+				AlternativeValues []interface{}
+			}{
+				// session variable in trackedSessionVariables but not configured in allowedSessionVariables
+				{"max_heap_table_size", "int", []interface{}{16384, 16777216}},
+			}
+
+			for _, test := range tests {
+				gaeaConn, err := e2eMgr.GetReadWriteGaeaUserConn()
+				util.ExpectNoError(err)
+				// Check current value to avoid testing with the default value
+				getCurrentValueSQL := fmt.Sprintf("SELECT @@SESSION.%s", test.VariableName)
+				row := gaeaConn.QueryRow(getCurrentValueSQL)
+				defaultValue, err := scanVariableValue(row, test.Type)
+				util.ExpectNoError(err)
+
+				for _, setValue := range test.AlternativeValues {
+					if setValue != defaultValue {
+						setSQL := generateSetSessionSQL(test.VariableName, test.Type, setValue)
+						_, err = gaeaConn.Exec(setSQL)
+						util.ExpectNoError(err)
+
+						// Verify that the session variable's value has changed
+						row = gaeaConn.QueryRow(getCurrentValueSQL)
+						actualValue, err := scanVariableValue(row, test.Type)
+						util.ExpectNoError(err)
+						util.ExpectEqual(actualValue, setValue)
+						break
+					}
+				}
+			}
+		})
+	})
+
 	ginkgo.AfterEach(func() {
 		if needCleanup {
 			e2eMgr.Clean()
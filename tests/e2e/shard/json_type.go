@@ -0,0 +1,121 @@
+// Copyright 2024 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/tests/e2e/config"
+	"github.com/XiaoMi/Gaea/tests/e2e/util"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// 通过 kingshard hash 分表读写 JSON 列，文本协议和二进制协议(prepare)的结果都要和单个 MySQL 一致
+var _ = ginkgo.Describe("json type test in king shard hash", func() {
+	e2eMgr := config.NewE2eManager()
+	sliceTest := e2eMgr.NsSlices[config.SliceSingleTestMaster]
+	sliceMulti := e2eMgr.NsSlices[config.SliceDualMaster]
+	createTable := "CREATE TABLE IF NOT EXISTS sbtest.%s (`id` int(11) NOT NULL, `data` json DEFAULT NULL, PRIMARY KEY (`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	ginkgo.BeforeEach(func() {
+		ns, err := config.ParseNamespaceTmpl(config.KingShardHashNamespaceTmpl, sliceMulti)
+		util.ExpectNoError(err)
+		err = e2eMgr.ModifyNamespace(ns)
+		util.ExpectNoError(err)
+
+		// t 表的 4 个分表分布在 slice-0 和 slice-1 上
+		prepareCases := []struct {
+			slice  *config.NsSlice
+			index  int
+			tables []string
+		}{
+			{sliceMulti, 0, []string{"t_0000", "t_0001"}},
+			{sliceMulti, 1, []string{"t_0002", "t_0003"}},
+			{sliceTest, 0, []string{"t"}},
+		}
+		for _, c := range prepareCases {
+			conn, err := c.slice.GetMasterAdminConn(c.index)
+			util.ExpectNoError(err)
+			util.ExpectNoError(util.CleanUpDatabases(conn))
+			_, err = util.MysqlExec(conn, "CREATE DATABASE IF NOT EXISTS sbtest")
+			util.ExpectNoError(err)
+			for _, table := range c.tables {
+				_, err = util.MysqlExec(conn, fmt.Sprintf(createTable, table))
+				util.ExpectNoError(err)
+			}
+		}
+	})
+
+	ginkgo.Context("json column read and write", func() {
+		ginkgo.It("should return the same json values as mysql", func() {
+			gaeaConn, err := e2eMgr.GetReadWriteGaeaUserDBConn("sbtest")
+			util.ExpectNoError(err)
+			singleMaster, err := sliceTest.GetMasterCommonDBConn(0, "sbtest")
+			util.ExpectNoError(err)
+
+			writeSQLs := []string{
+				`INSERT INTO t (id, data) VALUES (1, '{"name": "a", "tags": [1, 2]}'), (2, '{"name": "b\\"c", "tags": []}'), (3, NULL)`,
+				`INSERT INTO t (id, data) VALUES (4, JSON_OBJECT('name', 'd', 'tags', JSON_ARRAY(4)))`,
+				`UPDATE t SET data = JSON_SET(data, '$.age', 18) WHERE id = 1`,
+				`UPDATE t SET data = JSON_ARRAY_APPEND(data, '$.tags', 3) WHERE data->>'$.name' = 'b"c'`,
+			}
+			for _, execSQL := range writeSQLs {
+				for _, conn := range []*sql.DB{gaeaConn, singleMaster} {
+					_, err = util.MysqlExec(conn, execSQL)
+					util.ExpectNoError(err)
+				}
+			}
+
+			querySQLs := []string{
+				"SELECT id, data FROM t",
+				"SELECT id, data->'$.name', data->>'$.name', t.data->>'$.tags[0]' FROM t",
+				"SELECT id, JSON_EXTRACT(data, '$.age') FROM t WHERE id = 1",
+				`SELECT id FROM t WHERE data->>'$.name' = 'b"c'`,
+				"SELECT id, JSON_LENGTH(data->'$.tags') FROM t WHERE JSON_CONTAINS(data->'$.tags', '1')",
+				"SELECT id, JSON_TYPE(data) FROM t WHERE data IS NOT NULL ORDER BY id",
+			}
+			for _, query := range querySQLs {
+				// text protocol
+				gaeaRes, err := util.MysqlQuery(gaeaConn, query)
+				util.ExpectNoError(err, fmt.Sprintf("gaea exec sql: %s, err: %v", query, err))
+				mysqlRes, err := util.MysqlQuery(singleMaster, query)
+				util.ExpectNoError(err, fmt.Sprintf("mysql exec sql: %s, err: %v", query, err))
+				_, err = util.CompareIgnoreSort(gaeaRes, mysqlRes)
+				util.ExpectNoError(err, fmt.Sprintf("compare sql: %s, err: %v", query, err))
+
+				// binary protocol
+				gaeaRes, err = queryWithArgs(gaeaConn, query+" LIMIT ?", 100)
+				util.ExpectNoError(err, fmt.Sprintf("gaea prepare sql: %s, err: %v", query, err))
+				_, err = util.CompareIgnoreSort(gaeaRes, mysqlRes)
+				util.ExpectNoError(err, fmt.Sprintf("compare prepare sql: %s, err: %v", query, err))
+			}
+		})
+	})
+
+	ginkgo.AfterEach(func() {
+		e2eMgr.Clean()
+	})
+})
+
+// queryWithArgs query with args by prepare statement, so the result is in binary protocol
+func queryWithArgs(db *sql.DB, query string, args ...interface{}) ([][]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return util.GetDataFromRows(rows)
+}
@@ -16,15 +16,25 @@ package util
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
 )
 
+// LogTimeFormat 是 sql 日志中时间的格式
+const LogTimeFormat = "2006-01-02 15:04:05.999"
+
+// sqlLogPrefix 是 sql 日志文件名前缀, 包括轮转后的文件
+const sqlLogPrefix = "gaea_sql.log"
+
 type LogEntry struct {
-	Timestamp         string
+	Timestamp         time.Time
+	Status            string
 	Namespace         string
 	User              string
 	ClientAddr        string
@@ -35,67 +45,137 @@ type LogEntry struct {
 	Query             string
 	ResponseTimeMs    float64
 	InTx              bool
+	Error             string
 }
 
-// CompareTimeStrings 比较两个时间字符串的大小
-// 返回值为-1，0或1。-1表示time Before time2，0表示time1 = time2，1表示time1 After time2
-func CompareTimeStrings(currentTime string, time2 string) (int, error) {
-	// 解析时间字符串
-	t1, err1 := time.Parse("2006-01-02 15:04:05.999", currentTime)
-	t2, err2 := time.Parse("2006-01-02 15:04:05.999", time2)
-	if err1 != nil || err2 != nil {
-		return 0, fmt.Errorf("解析错误：%v %v", err1, err2)
-	}
+// jsonLogEntry is one line of sql log in json format, see log_format in gaea.ini
+type jsonLogEntry struct {
+	Timestamp         string  `json:"ts"`
+	Status            string  `json:"msg"`
+	Namespace         string  `json:"ns"`
+	User              string  `json:"user"`
+	ClientAddr        string  `json:"client"`
+	BackendAddr       string  `json:"backend"`
+	Database          string  `json:"db"`
+	ConnectionID      int     `json:"conn_id"`
+	MySQLConnectionID int     `json:"mysql_conn_id"`
+	InTx              bool    `json:"transaction"`
+	ResponseTimeMs    float64 `json:"latency_ms"`
+	Query             string  `json:"sql"`
+	Error             string  `json:"error"`
+}
+
+// LogFilter 是 LogReader 的过滤条件, 零值字段不参与过滤
+type LogFilter struct {
+	Namespace   string
+	User        string
+	BackendAddr string
+	// Query 和日志中的 sql 完全相同, 末尾的分号会被忽略
+	Query string
+	// Fingerprint 和日志中 sql 的指纹相同, 即 mysql.GetFingerprint 的结果
+	Fingerprint string
+	// Since 和 Until 是日志时间的范围, 包含边界
+	Since time.Time
+	Until time.Time
+}
 
-	// 比较时间
-	if t1.Before(t2) {
-		return -1, nil
+func (f *LogFilter) match(e *LogEntry) bool {
+	if f.Namespace != "" && f.Namespace != e.Namespace {
+		return false
 	}
-	if t1.After(t2) {
-		return 1, nil
+	if f.User != "" && f.User != e.User {
+		return false
 	}
-	return 0, nil
+	if f.BackendAddr != "" && f.BackendAddr != e.BackendAddr {
+		return false
+	}
+	if f.Query != "" && strings.TrimSuffix(f.Query, ";") != e.Query {
+		return false
+	}
+	if f.Fingerprint != "" && f.Fingerprint != mysql.GetFingerprint(e.Query) {
+		return false
+	}
+	// 日志时间精确到毫秒
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since.Truncate(time.Millisecond)) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
 }
 
-func ParseLogEntries(file *os.File, re *regexp.Regexp, currentTime time.Time, searchString string) ([]LogEntry, error) {
-	startTime := currentTime.Format("2006-01-02 15:04:05.999")
+// LogReader 读取目录下 json 格式的 gaea sql 日志, 需要 gaea.ini 中配置 log_format=json
+type LogReader struct {
+	dir string
+}
 
+func NewLogReader(dir string) *LogReader {
+	return &LogReader{dir: dir}
+}
+
+// Read 返回目录下所有 sql 日志文件中满足 filter 的日志
+func (r *LogReader) Read(filter LogFilter) ([]LogEntry, error) {
+	var entries []LogEntry
+	err := filepath.Walk(r.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasPrefix(info.Name(), sqlLogPrefix) || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open file:%s error %v", path, err)
+		}
+		defer file.Close()
+
+		res, err := ParseLogEntries(file, filter)
+		if err != nil {
+			return fmt.Errorf("parse file:%s error %v", path, err)
+		}
+		entries = append(entries, res...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseLogEntries 解析 json 格式的 sql 日志, 返回满足 filter 的日志, 非 json 的行会被忽略
+func ParseLogEntries(file *os.File, filter LogFilter) ([]LogEntry, error) {
 	scanner := bufio.NewScanner(file)
 
 	var logEntryRes []LogEntry
 	for scanner.Scan() {
-		line := scanner.Text()
-		// 使用正则表达式匹配日志行
-		matches := re.FindStringSubmatch(line)
-		if len(matches) != 13 {
+		var e jsonLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
 			continue
 		}
-		// 解析并填充结构体
-		logEntry := LogEntry{}
-		logEntry.Timestamp = matches[1]
-		// 检查时间是否在startTime之后
-		res, err := CompareTimeStrings(startTime, logEntry.Timestamp)
+		ts, err := time.ParseInLocation(LogTimeFormat, e.Timestamp, time.Local)
 		if err != nil {
-			return []LogEntry{}, nil
+			return nil, fmt.Errorf("parse log time %s error: %v", e.Timestamp, err)
 		}
-		if res > 0 {
-			continue
+		entry := LogEntry{
+			Timestamp:         ts,
+			Status:            e.Status,
+			Namespace:         e.Namespace,
+			User:              e.User,
+			ClientAddr:        e.ClientAddr,
+			BackendAddr:       e.BackendAddr,
+			Database:          e.Database,
+			ConnectionID:      e.ConnectionID,
+			MySQLConnectionID: e.MySQLConnectionID,
+			Query:             e.Query,
+			ResponseTimeMs:    e.ResponseTimeMs,
+			InTx:              e.InTx,
+			Error:             e.Error,
 		}
-		fmt.Sscanf(matches[3], "%f", &logEntry.ResponseTimeMs)
-		logEntry.Namespace = matches[4]
-		logEntry.User = matches[5]
-		logEntry.ClientAddr = matches[6]
-		logEntry.BackendAddr = matches[7]
-		logEntry.Database = matches[8]
-		fmt.Sscanf(matches[9], "%d", &logEntry.ConnectionID)
-		fmt.Sscanf(matches[10], "%d", &logEntry.MySQLConnectionID)
-		fmt.Sscanf(matches[11], "%t", &logEntry.InTx)
-		logEntry.Query = matches[12]
-
-		if strings.Compare(searchString, logEntry.Query) != 0 {
+		if !filter.match(&entry) {
 			continue
 		}
-		logEntryRes = append(logEntryRes, logEntry)
+		logEntryRes = append(logEntryRes, entry)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -0,0 +1,71 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// EncryptGCM encrypt data in gcm mode, key should be 16, 24 or 32 bytes.
+// result is random nonce followed by cipher text, so the same data is encrypted to different result.
+func EncryptGCM(key []byte, data []byte) ([]byte, error) {
+	return EncryptGCMWithAAD(key, data, nil)
+}
+
+// EncryptGCMWithAAD encrypt data in gcm mode like EncryptGCM, additional data is authenticated but not encrypted,
+// the same additional data must be given to decrypt it.
+func EncryptGCMWithAAD(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// DecryptGCM decrypt data encrypted by EncryptGCM
+func DecryptGCM(key []byte, data []byte) ([]byte, error) {
+	return DecryptGCMWithAAD(key, data, nil)
+}
+
+// DecryptGCMWithAAD decrypt data encrypted by EncryptGCMWithAAD with the same additional data
+func DecryptGCMWithAAD(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("decrypt gcm failed, invalid data length: %d", len(data))
+	}
+	nonce, cipherText := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, cipherText, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -44,3 +44,62 @@ func TestEncryptECB(t *testing.T) {
 	}
 	t.Log("decrypt succ")
 }
+
+func TestEncryptGCM(t *testing.T) {
+	key := []byte("1234abcd5678efg*1234abcd5678efg*")
+	msg := "13812345678"
+
+	data1, err := EncryptGCM(key, []byte(msg))
+	if err != nil {
+		t.Fatalf("encrypt failed, err:%v", err)
+	}
+	data2, err := EncryptGCM(key, []byte(msg))
+	if err != nil {
+		t.Fatalf("encrypt failed, err:%v", err)
+	}
+	if string(data1) == string(data2) {
+		t.Fatalf("encrypt result should be different with random nonce")
+	}
+
+	origin, err := DecryptGCM(key, data1)
+	if err != nil {
+		t.Fatalf("decrypt failed, err:%v", err)
+	}
+	if string(origin) != msg {
+		t.Fatalf("origin not equal msg")
+	}
+
+	data1[len(data1)-1] ^= 0xff
+	if _, err := DecryptGCM(key, data1); err == nil {
+		t.Fatalf("decrypt modified data should fail")
+	}
+	if _, err := DecryptGCM(key, []byte("short")); err == nil {
+		t.Fatalf("decrypt short data should fail")
+	}
+	if _, err := EncryptGCM([]byte("short key"), []byte(msg)); err == nil {
+		t.Fatalf("encrypt with invalid key should fail")
+	}
+}
+
+func TestEncryptGCMWithAAD(t *testing.T) {
+	key := []byte("1234abcd5678efg*1234abcd5678efg*")
+	msg := "13812345678"
+
+	data, err := EncryptGCMWithAAD(key, []byte(msg), []byte("user.phone"))
+	if err != nil {
+		t.Fatalf("encrypt failed, err:%v", err)
+	}
+	origin, err := DecryptGCMWithAAD(key, data, []byte("user.phone"))
+	if err != nil {
+		t.Fatalf("decrypt failed, err:%v", err)
+	}
+	if string(origin) != msg {
+		t.Fatalf("origin not equal msg")
+	}
+	if _, err := DecryptGCMWithAAD(key, data, []byte("user.id_card")); err == nil {
+		t.Fatalf("decrypt with other additional data should fail")
+	}
+	if _, err := DecryptGCM(key, data); err == nil {
+		t.Fatalf("decrypt without additional data should fail")
+	}
+}
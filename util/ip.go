@@ -15,22 +15,39 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// hostResolveInterval is the interval of resolving host names in allowed ips again
+	hostResolveInterval = time.Minute
+	// hostResolveTimeout limits lookup of host name, connections wait for the first lookup of it
+	hostResolveTimeout = time.Second
+)
+
+// lookupIP is replaced in tests
+var lookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
 // IPInfo ip information
 type IPInfo struct {
 	info    string
 	isIPNet bool
 	ip      net.IP
 	ipNet   net.IPNet
+	host    *hostResolver // not nil if info is a host name
 }
 
-// ParseIPInfo parse ip
+// ParseIPInfo parse ip, ipv4 and ipv6 address, cidr and host name are supported
 func ParseIPInfo(v string) (IPInfo, error) {
 	if ip, ipNet, err := net.ParseCIDR(v); err == nil {
 		return IPInfo{
@@ -41,7 +58,7 @@ func ParseIPInfo(v string) (IPInfo, error) {
 		}, nil
 	}
 
-	if ip := net.ParseIP(v); ip != nil {
+	if ip := ParseClientIP(strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")); ip != nil {
 		return IPInfo{
 			info:    v,
 			isIPNet: false,
@@ -49,9 +66,24 @@ func ParseIPInfo(v string) (IPInfo, error) {
 		}, nil
 	}
 
+	if isHostName(v) {
+		return IPInfo{
+			info: v,
+			host: &hostResolver{host: v},
+		}, nil
+	}
+
 	return IPInfo{}, errors.New("invalid ip address")
 }
 
+// ParseClientIP parse ip of client, zone of ipv6 link local address is ignored
+func ParseClientIP(host string) net.IP {
+	if i := strings.LastIndexByte(host, '%'); i > 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host)
+}
+
 // Info return information of ip
 func (t *IPInfo) Info() string {
 	return t.info
@@ -59,12 +91,77 @@ func (t *IPInfo) Info() string {
 
 // Match check if ip matched
 func (t *IPInfo) Match(ip net.IP) bool {
+	if t.host != nil {
+		return t.host.match(ip)
+	}
 	if t.isIPNet {
 		return t.ipNet.Contains(ip)
 	}
 	return t.ip.Equal(ip)
 }
 
+// isHostName check if v is a domain name like db-agent.example.com, which has at least two labels
+// and the last one is not numeric, so malformed ipv4 address is not taken as host name
+func isHostName(v string) bool {
+	v = strings.TrimSuffix(v, ".")
+	if len(v) == 0 || len(v) > 253 || !strings.Contains(v, ".") {
+		return false
+	}
+	labels := strings.Split(v, ".")
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	_, err := strconv.Atoi(labels[len(labels)-1])
+	return err != nil
+}
+
+// hostResolver resolve host name periodically, so ip changes of the host take effect
+type hostResolver struct {
+	host       string
+	ips        atomic.Value // []net.IP
+	resolvedAt int64        // unix nano, 0 means never resolved
+	resolving  int32
+}
+
+func (r *hostResolver) match(ip net.IP) bool {
+	resolvedAt := atomic.LoadInt64(&r.resolvedAt)
+	if resolvedAt == 0 {
+		r.resolve()
+	} else if time.Since(time.Unix(0, resolvedAt)) > hostResolveInterval && atomic.CompareAndSwapInt32(&r.resolving, 0, 1) {
+		// resolve in background, connection is checked with last resolved ips
+		go func() {
+			defer atomic.StoreInt32(&r.resolving, 0)
+			r.resolve()
+		}()
+	}
+
+	ips, _ := r.ips.Load().([]net.IP)
+	for _, resolved := range ips {
+		if resolved.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve lookup ips of host, last resolved ips are kept if lookup failed
+func (r *hostResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), hostResolveTimeout)
+	defer cancel()
+	ips, err := lookupIP(ctx, r.host)
+	atomic.StoreInt64(&r.resolvedAt, time.Now().UnixNano())
+	if err == nil {
+		r.ips.Store(ips)
+	}
+}
+
 func parseAllowIps(allowIpsStr string) ([]IPInfo, error) {
 	if len(allowIpsStr) == 0 {
 		return make([]IPInfo, 0, 10), nil
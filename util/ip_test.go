@@ -14,9 +14,11 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -90,6 +92,63 @@ func TestCreateIPInfoIPNetError2(t *testing.T) {
 	}
 }
 
+func TestIPInfoMatchIPv6(t *testing.T) {
+	testCases := []struct {
+		allowed string
+		client  string
+		match   bool
+	}{
+		{"2408:4000::/32", "2408:4000:1::1", true},
+		{"2408:4000::/32", "2408:4001::1", false},
+		{"2001:db8::1", "2001:db8:0:0:0:0:0:1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"fe80::1", "fe80::1%eth0", true},
+		{"10.0.0.0/8", "::ffff:10.1.2.3", true},
+		{"10.1.2.3", "::ffff:10.1.2.3", true},
+		{"::1", "127.0.0.1", false},
+	}
+	for _, tt := range testCases {
+		info, err := ParseIPInfo(tt.allowed)
+		assert.Nil(t, err, tt.allowed)
+		assert.Equal(t, tt.match, info.Match(ParseClientIP(tt.client)), "allowed: %s, client: %s", tt.allowed, tt.client)
+	}
+}
+
+func TestIPInfoMatchHostName(t *testing.T) {
+	lookup := lookupIP
+	defer func() { lookupIP = lookup }()
+	resolved := []net.IP{net.ParseIP("10.0.0.1")}
+	lookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+		return resolved, nil
+	}
+
+	for _, invalid := range []string{"abcdefg", "127.255.256.1", "-bad.example.com", "db_agent.example.com"} {
+		_, err := ParseIPInfo(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+
+	info, err := ParseIPInfo("db-agent.example.com")
+	assert.Nil(t, err)
+	assert.True(t, info.Match(net.ParseIP("10.0.0.1")))
+	assert.False(t, info.Match(net.ParseIP("10.0.0.2")))
+
+	// ip of host changes, it takes effect after resolved again
+	resolved = []net.IP{net.ParseIP("10.0.0.2")}
+	info.host.resolvedAt = time.Now().Add(-2 * hostResolveInterval).UnixNano()
+	info.Match(net.ParseIP("10.0.0.2"))
+	assert.Eventually(t, func() bool { return info.Match(net.ParseIP("10.0.0.2")) }, time.Second, 10*time.Millisecond)
+
+	// lookup is interrupted by timeout, last resolved ips are kept
+	lookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	info.host.resolvedAt = 0
+	start := time.Now()
+	assert.True(t, info.Match(net.ParseIP("10.0.0.2")))
+	assert.True(t, time.Since(start) < 2*hostResolveTimeout)
+}
+
 func TestGetInstanceDatacenter(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -0,0 +1,302 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kafka is a minimal kafka producer without compression, transaction and sasl.
+// Messages are sent by Produce v3 with record batch, which is supported since kafka 0.11.
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientID = "gaea"
+	maxResponseSize = 64 << 20
+)
+
+// Producer send messages to partition leaders, it's safe for concurrent use but requests are sent one by one
+type Producer struct {
+	brokers  []string
+	clientID string
+	timeout  time.Duration
+
+	mu            sync.Mutex
+	correlationID int32
+	conns         map[string]*brokerConn // key: broker addr
+	brokerAddrs   map[int32]string       // key: node id
+	leaders       map[string][]int32     // key: topic, value: leader of each partition
+}
+
+type brokerConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewProducer create producer of kafka cluster, brokers are used to get metadata of cluster.
+// timeout is used to connect and wait for each request.
+func NewProducer(brokers []string, timeout time.Duration) *Producer {
+	return &Producer{
+		brokers:     brokers,
+		clientID:    defaultClientID,
+		timeout:     timeout,
+		conns:       make(map[string]*brokerConn),
+		brokerAddrs: make(map[int32]string),
+		leaders:     make(map[string][]int32),
+	}
+}
+
+// Send send messages to topic and wait until they are written to all in-sync replicas.
+// Messages are partitioned by key, messages without key are sent to partition 0.
+func (p *Producer) Send(topic string, msgs []*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	leaders, ok := p.leaders[topic]
+	if !ok {
+		if err := p.refreshMetadata(topic); err != nil {
+			return err
+		}
+		leaders = p.leaders[topic]
+	}
+
+	// key: leader, value: messages of each partition
+	batches := make(map[int32]map[int32][]*Message)
+	for _, m := range msgs {
+		partition := 0
+		if m.Key != nil {
+			partition = partitionOf(m.Key, len(leaders))
+		}
+		leader := leaders[partition]
+		if batches[leader] == nil {
+			batches[leader] = make(map[int32][]*Message)
+		}
+		batches[leader][int32(partition)] = append(batches[leader][int32(partition)], m)
+	}
+
+	for leader, partitions := range batches {
+		addr, ok := p.brokerAddrs[leader]
+		if !ok {
+			delete(p.leaders, topic)
+			return fmt.Errorf("broker of node %d not found", leader)
+		}
+		if err := p.produce(addr, topic, partitions); err != nil {
+			// leaders may be changed
+			delete(p.leaders, topic)
+			return err
+		}
+	}
+	return nil
+}
+
+// Close close connections to brokers
+func (p *Producer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, c := range p.conns {
+		c.conn.Close()
+		delete(p.conns, addr)
+	}
+}
+
+func (p *Producer) produce(addr, topic string, partitions map[int32][]*Message) error {
+	e := &encoder{}
+	e.nullString() // transactional id
+	e.int16(-1)    // acks of all in-sync replicas
+	e.int32(int32(p.timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(partitions)))
+	for partition, msgs := range partitions {
+		e.int32(partition)
+		e.bytes(encodeRecordBatch(msgs))
+	}
+
+	resp, err := p.request(addr, apiKeyProduce, produceVersion, e.buf)
+	if err != nil {
+		return err
+	}
+	d := &decoder{buf: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != errNone {
+				return fmt.Errorf("produce to %s-%d failed: %v", topic, partition, Error(code))
+			}
+		}
+	}
+	return d.err
+}
+
+// refreshMetadata get brokers and partition leaders of topic from any broker
+func (p *Producer) refreshMetadata(topic string) error {
+	e := &encoder{}
+	e.int32(1)
+	e.string(topic)
+
+	var lastErr error
+	for _, addr := range p.brokers {
+		resp, err := p.request(addr, apiKeyMetadata, metadataVersion, e.buf)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return p.parseMetadata(topic, resp)
+	}
+	return fmt.Errorf("get metadata of topic %s failed: %v", topic, lastErr)
+}
+
+func (p *Producer) parseMetadata(topic string, resp []byte) error {
+	d := &decoder{buf: resp}
+	brokerAddrs := make(map[int32]string)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokerAddrs[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+
+	var leaders []int32
+	var topicErr error
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		partitionLeaders := make(map[int32]int32)
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			pcode := d.int16()
+			partition := d.int32()
+			leader := d.int32()
+			for k, r := 0, d.arrayLen(); k < r; k++ {
+				d.int32() // replicas
+			}
+			for k, r := 0, d.arrayLen(); k < r; k++ {
+				d.int32() // isr
+			}
+			if pcode != errNone && name == topic && topicErr == nil {
+				topicErr = fmt.Errorf("partition %d of topic %s is not available: %v", partition, topic, Error(pcode))
+			}
+			partitionLeaders[partition] = leader
+		}
+		if name != topic {
+			continue
+		}
+		if code != errNone {
+			topicErr = fmt.Errorf("topic %s is not available: %v", topic, Error(code))
+			continue
+		}
+		leaders = make([]int32, len(partitionLeaders))
+		for partition, leader := range partitionLeaders {
+			if int(partition) >= len(leaders) || partition < 0 {
+				return fmt.Errorf("invalid partition %d of topic %s", partition, topic)
+			}
+			leaders[partition] = leader
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if topicErr != nil {
+		return topicErr
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("no partition of topic %s", topic)
+	}
+	p.brokerAddrs = brokerAddrs
+	p.leaders[topic] = leaders
+	return nil
+}
+
+// request send request to broker and return response body, connection is closed if error occurs
+func (p *Producer) request(addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	c, err := p.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.roundTrip(c, apiKey, apiVersion, body)
+	if err != nil {
+		c.conn.Close()
+		delete(p.conns, addr)
+		return nil, fmt.Errorf("request to kafka broker %s failed: %v", addr, err)
+	}
+	return resp, nil
+}
+
+func (p *Producer) getConn(addr string) (*brokerConn, error) {
+	if c, ok := p.conns[addr]; ok {
+		return c, nil
+	}
+	conn, err := net.DialTimeout("tcp", addr, p.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to kafka broker %s failed: %v", addr, err)
+	}
+	c := &brokerConn{conn: conn, r: bufio.NewReader(conn)}
+	p.conns[addr] = c
+	return c, nil
+}
+
+func (p *Producer) roundTrip(c *brokerConn, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	p.correlationID++
+	correlationID := p.correlationID
+
+	// request header v1: api key, api version, correlation id and client id
+	e := &encoder{}
+	e.int32(0) // size
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(correlationID)
+	e.string(p.clientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+
+	// broker waits for replicas at most timeout, so response is waited twice of it
+	if err := c.conn.SetDeadline(time.Now().Add(2 * p.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(e.buf); err != nil {
+		return nil, err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(header[:]))
+	if size < 4 || size > maxResponseSize {
+		return nil, fmt.Errorf("invalid response size: %d", size)
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != correlationID {
+		return nil, fmt.Errorf("unexpected correlation id: %d, expect: %d", id, correlationID)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2(t *testing.T) {
+	// values are from tests of java client
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"": 275646681,
+	}
+	for s, expect := range tests {
+		assert.Equal(t, expect, murmur2([]byte(s)), s)
+	}
+}
+
+// fakeBroker is a single broker cluster, it answers metadata and records produced messages
+type fakeBroker struct {
+	ln         net.Listener
+	partitions int
+	errorCode  int16
+
+	mu       sync.Mutex
+	messages map[int32][]*Message // key: partition
+}
+
+func newFakeBroker(t *testing.T, partitions int, errorCode int16) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	b := &fakeBroker{ln: ln, partitions: partitions, errorCode: errorCode, messages: make(map[int32][]*Message)}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey := d.int16()
+		d.int16()
+		correlationID := d.int32()
+		d.string()
+
+		e := &encoder{}
+		e.int32(0)
+		e.int32(correlationID)
+		switch apiKey {
+		case apiKeyMetadata:
+			b.writeMetadata(e)
+		case apiKeyProduce:
+			b.produce(d, e)
+		default:
+			return
+		}
+		binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+		if _, err := conn.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) writeMetadata(e *encoder) {
+	host, port, _ := net.SplitHostPort(b.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	e.int32(1)
+	e.int32(1)
+	e.string(host)
+	e.int32(int32(p))
+	e.nullString()
+	e.int32(1) // controller
+	e.int32(1)
+	e.int16(0)
+	e.string("gaea_cdc")
+	e.int8(0)
+	e.int32(int32(b.partitions))
+	for i := 0; i < b.partitions; i++ {
+		e.int16(0)
+		e.int32(int32(i))
+		e.int32(1)
+		e.int32(1)
+		e.int32(1)
+		e.int32(1)
+		e.int32(1)
+	}
+}
+
+func (b *fakeBroker) produce(d *decoder, e *encoder) {
+	d.string() // transactional id
+	d.int16()
+	d.int32()
+	d.arrayLen()
+	topic := d.string()
+	n := d.arrayLen()
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(n))
+	for i := 0; i < n; i++ {
+		partition := d.int32()
+		size := int(d.int32())
+		batch := d.buf[:size]
+		d.buf = d.buf[size:]
+		msgs := decodeRecordBatch(batch)
+		b.mu.Lock()
+		b.messages[partition] = append(b.messages[partition], msgs...)
+		b.mu.Unlock()
+
+		e.int32(partition)
+		e.int16(b.errorCode)
+		e.int64(0)
+		e.int64(-1)
+	}
+	e.int32(0) // throttle time
+}
+
+// decodeRecordBatch decode record batch, nil is returned if crc is wrong
+func decodeRecordBatch(batch []byte) []*Message {
+	d := &decoder{buf: batch}
+	d.int64()
+	d.int32()
+	d.int32()
+	if d.int8() != recordBatchMagic {
+		return nil
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.buf, crc32c) != crc {
+		return nil
+	}
+	d.int16()
+	d.int32()
+	baseTime := d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	count := int(d.int32())
+	msgs := make([]*Message, 0, count)
+	buf := d.buf
+	readVarint := func() int64 {
+		v, n := binary.Varint(buf)
+		buf = buf[n:]
+		return v
+	}
+	for i := 0; i < count; i++ {
+		readVarint() // length
+		buf = buf[1:]
+		delta := readVarint()
+		readVarint() // offset delta
+		m := &Message{Time: time.Unix(0, (baseTime+delta)*int64(time.Millisecond))}
+		if keyLen := readVarint(); keyLen >= 0 {
+			m.Key = buf[:keyLen]
+			buf = buf[keyLen:]
+		}
+		valueLen := readVarint()
+		m.Value = buf[:valueLen]
+		buf = buf[valueLen:]
+		readVarint() // headers
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+func TestProducerSend(t *testing.T) {
+	b := newFakeBroker(t, 3, 0)
+	defer b.ln.Close()
+
+	p := NewProducer([]string{b.ln.Addr().String()}, time.Second)
+	defer p.Close()
+
+	now := time.Unix(1700000000, 123000000)
+	msgs := []*Message{
+		{Key: []byte("db.tbl.1"), Value: []byte("v1"), Time: now},
+		{Key: []byte("db.tbl.2"), Value: []byte("v2"), Time: now.Add(time.Millisecond)},
+		{Key: []byte("db.tbl.1"), Value: []byte("v3"), Time: now.Add(2 * time.Millisecond)},
+		{Value: []byte("v4"), Time: now},
+	}
+	assert.Nil(t, p.Send("gaea_cdc", msgs))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := 0
+	for partition, received := range b.messages {
+		for _, m := range received {
+			count++
+			if m.Key == nil {
+				assert.Equal(t, int32(0), partition)
+				continue
+			}
+			assert.Equal(t, int32(partitionOf(m.Key, 3)), partition)
+		}
+	}
+	assert.Equal(t, 4, count)
+
+	// messages of the same key are in order
+	key1 := b.messages[int32(partitionOf([]byte("db.tbl.1"), 3))]
+	var values []string
+	for _, m := range key1 {
+		if string(m.Key) == "db.tbl.1" {
+			values = append(values, string(m.Value))
+			assert.True(t, !m.Time.Before(now))
+		}
+	}
+	assert.Equal(t, []string{"v1", "v3"}, values)
+}
+
+func TestProducerError(t *testing.T) {
+	// not leader for partition
+	b := newFakeBroker(t, 1, 6)
+	p := NewProducer([]string{b.ln.Addr().String()}, time.Second)
+	defer p.Close()
+
+	msgs := []*Message{{Key: []byte("k"), Value: []byte("v"), Time: time.Now()}}
+	assert.NotNil(t, p.Send("gaea_cdc", msgs))
+	// metadata is refreshed after failure
+	assert.Equal(t, 0, len(p.leaders))
+
+	b.ln.Close()
+	p.Close()
+	assert.NotNil(t, p.Send("gaea_cdc", msgs))
+}
@@ -0,0 +1,261 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	apiKeyProduce  = 0
+	apiKeyMetadata = 3
+
+	produceVersion  = 3 // the first version with record batch, supported since kafka 0.11
+	metadataVersion = 1
+
+	recordBatchMagic = 2
+)
+
+const errNone = 0
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Error is error code returned by kafka
+type Error int16
+
+func (e Error) Error() string {
+	return fmt.Sprintf("kafka error code: %d", int16(e))
+}
+
+// encoder append big endian values of kafka protocol
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.int32(int32(v >> 32))
+	e.int32(int32(v))
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// decoder read big endian values of kafka protocol, err is set by the first failure
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.buf) < n {
+		d.err = fmt.Errorf("invalid kafka response")
+		return false
+	}
+	return true
+}
+
+func (d *decoder) int8() int8 {
+	if !d.need(1) {
+		return 0
+	}
+	v := int8(d.buf[0])
+	d.buf = d.buf[1:]
+	return v
+}
+
+func (d *decoder) int16() int16 {
+	if !d.need(2) {
+		return 0
+	}
+	v := int16(binary.BigEndian.Uint16(d.buf))
+	d.buf = d.buf[2:]
+	return v
+}
+
+func (d *decoder) int32() int32 {
+	if !d.need(4) {
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(d.buf))
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if !d.need(8) {
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := int(d.int16())
+	if n < 0 || !d.need(n) {
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// arrayLen return length of array, it's limited by remaining bytes to protect from corrupted length
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if n < 0 {
+		return 0
+	}
+	if n > len(d.buf) {
+		d.err = fmt.Errorf("invalid kafka response")
+		return 0
+	}
+	return n
+}
+
+// Message is a record sent to kafka
+type Message struct {
+	Key   []byte // messages of the same key are sent to the same partition
+	Value []byte
+	Time  time.Time
+}
+
+// encodeRecordBatch encode messages as record batch of magic 2
+func encodeRecordBatch(msgs []*Message) []byte {
+	baseTime := msgs[0].Time
+	maxTime := baseTime
+	records := &encoder{}
+	for i, m := range msgs {
+		if m.Time.After(maxTime) {
+			maxTime = m.Time
+		}
+		r := &encoder{}
+		r.int8(0) // attributes
+		r.varint(unixMilli(m.Time) - unixMilli(baseTime))
+		r.varint(int64(i))
+		if m.Key == nil {
+			r.varint(-1)
+		} else {
+			r.varint(int64(len(m.Key)))
+			r.buf = append(r.buf, m.Key...)
+		}
+		r.varint(int64(len(m.Value)))
+		r.buf = append(r.buf, m.Value...)
+		r.varint(0) // headers
+		records.varint(int64(len(r.buf)))
+		records.buf = append(records.buf, r.buf...)
+	}
+
+	// fields covered by crc
+	body := &encoder{}
+	body.int16(0) // attributes, no compression
+	body.int32(int32(len(msgs) - 1))
+	body.int64(unixMilli(baseTime))
+	body.int64(unixMilli(maxTime))
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(msgs)))
+	body.buf = append(body.buf, records.buf...)
+
+	e := &encoder{}
+	e.int64(0)                                // base offset
+	e.int32(int32(4 + 1 + 4 + len(body.buf))) // batch length, from partition leader epoch to the end
+	e.int32(-1)                               // partition leader epoch
+	e.int8(recordBatchMagic)
+	e.int32(int32(crc32.Checksum(body.buf, crc32c)))
+	e.buf = append(e.buf, body.buf...)
+	return e.buf
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// murmur2 is the hash used by default partitioner of java client, so messages with the same key
+// are sent to the same partition with other producers
+func murmur2(data []byte) int32 {
+	const (
+		seed = uint32(0x9747b28c)
+		m    = uint32(0x5bd1e995)
+		r    = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// partitionOf return partition of key in the same way as default partitioner of java client
+func partitionOf(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/util/vault"
+)
+
+// supported key providers
+const (
+	ProviderNone  = ""
+	ProviderFile  = "file"
+	ProviderVault = "vault"
+)
+
+// Provider provide encrypt keys by key id
+type Provider interface {
+	GetKey(keyID string) ([]byte, error)
+}
+
+var (
+	lock     sync.RWMutex
+	provider Provider
+)
+
+// Init init global key provider, keys are loaded when GetKey called, so rotated keys take effect after namespace reload
+func Init(providerType, keyFile, vaultAddr, vaultToken, vaultPath string) error {
+	var p Provider
+	switch providerType {
+	case ProviderNone:
+	case ProviderFile:
+		if keyFile == "" {
+			return fmt.Errorf("key file must be specified for provider %s", providerType)
+		}
+		p = &fileProvider{path: keyFile}
+	case ProviderVault:
+		if vaultPath == "" {
+			return fmt.Errorf("vault path must be specified for provider %s", providerType)
+		}
+		client, err := vault.NewClient(vaultAddr, vaultToken)
+		if err != nil {
+			return err
+		}
+		p = &vaultProvider{client: client, path: vaultPath}
+	default:
+		return fmt.Errorf("unsupported key provider: %s", providerType)
+	}
+
+	lock.Lock()
+	provider = p
+	lock.Unlock()
+	return nil
+}
+
+// GetKey get key by key id from global key provider
+func GetKey(keyID string) ([]byte, error) {
+	lock.RLock()
+	p := provider
+	lock.RUnlock()
+	if p == nil {
+		return nil, fmt.Errorf("key provider is not configured")
+	}
+	return p.GetKey(keyID)
+}
+
+// fileProvider read keys from json file, content is like {"key_id": "base64 encoded key"}
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) GetKey(keyID string) ([]byte, error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file error: %v", err)
+	}
+	keys := make(map[string]string)
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse key file error: %v", err)
+	}
+	key, ok := keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in key file", keyID)
+	}
+	return decodeKey(keyID, key)
+}
+
+// vaultProvider read keys from fields of vault secret, value of field is base64 encoded key
+type vaultProvider struct {
+	client *vault.Client
+	path   string
+}
+
+func (p *vaultProvider) GetKey(keyID string) ([]byte, error) {
+	key, err := p.client.ReadField(p.path, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(keyID, key)
+}
+
+func decodeKey(keyID, key string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s is not base64 encoded: %v", keyID, err)
+	}
+	switch len(b) {
+	case 16, 24, 32:
+		return b, nil
+	default:
+		return nil, fmt.Errorf("invalid length of key %s: %d, should be 16, 24 or 32", keyID, len(b))
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "MTIzNGFiY2Q1Njc4ZWZnKjEyMzRhYmNkNTY3OGVmZyo=" // 1234abcd5678efg*1234abcd5678efg*
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys.json")
+	err = ioutil.WriteFile(keyFile, []byte(`{"k1":"`+testKey+`","k2":"c2hvcnQ=","k3":"!"}`), 0600)
+	require.NoError(t, err)
+
+	require.NoError(t, Init(ProviderFile, keyFile, "", "", ""))
+	defer Init(ProviderNone, "", "", "", "")
+
+	key, err := GetKey("k1")
+	require.NoError(t, err)
+	require.Equal(t, "1234abcd5678efg*1234abcd5678efg*", string(key))
+
+	for _, id := range []string{"k2", "k3", "k4"} {
+		_, err = GetKey(id)
+		require.Error(t, err, id)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"data":{"k1":"` + testKey + `"},"metadata":{}}}`))
+	}))
+	defer s.Close()
+
+	require.NoError(t, Init(ProviderVault, "", s.URL, "token", "secret/data/gaea"))
+	defer Init(ProviderNone, "", "", "", "")
+
+	key, err := GetKey("k1")
+	require.NoError(t, err)
+	require.Equal(t, "1234abcd5678efg*1234abcd5678efg*", string(key))
+	_, err = GetKey("k2")
+	require.Error(t, err)
+}
+
+func TestInit(t *testing.T) {
+	require.Error(t, Init("kms", "", "", "", ""))
+	require.Error(t, Init(ProviderFile, "", "", "", ""))
+	require.Error(t, Init(ProviderVault, "", "127.0.0.1:8200", "", ""))
+
+	require.NoError(t, Init(ProviderNone, "", "", "", ""))
+	_, err := GetKey("k1")
+	require.Error(t, err)
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/util/requests"
+)
+
+const (
+	serviceName   = "kms"
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat = "20060102T150405Z"
+	contentType   = "application/x-amz-json-1.1"
+	targetDecrypt = "TrentService.Decrypt"
+)
+
+// Client call AWS KMS api signed with signature version 4, only Decrypt is supported.
+// credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN in environment.
+type Client struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	now          func() time.Time
+}
+
+// NewClient create kms client, region is read from AWS_REGION in environment if empty,
+// endpoint is https://kms.{region}.amazonaws.com if empty
+func NewClient(region, endpoint string) (*Client, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("kms region is not specified")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", region)
+	}
+
+	c := &Client{
+		endpoint:     strings.TrimSuffix(endpoint, "/") + "/",
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		now:          time.Now,
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("aws credentials are not found in environment")
+	}
+	return c, nil
+}
+
+type decryptRequest struct {
+	CiphertextBlob []byte `json:"CiphertextBlob"`
+}
+
+type decryptResponse struct {
+	Plaintext []byte `json:"Plaintext"`
+	Type      string `json:"__type"`
+	Message   string `json:"message"`
+}
+
+// Decrypt decrypt cipher text encrypted by kms, such as encrypted data key of envelope encryption
+func (c *Client) Decrypt(ciphertextBlob []byte) ([]byte, error) {
+	body, err := json.Marshal(&decryptRequest{CiphertextBlob: ciphertextBlob})
+	if err != nil {
+		return nil, err
+	}
+
+	req := requests.NewRequest(c.endpoint, requests.Post, map[string]string{
+		"Content-Type": contentType,
+		"X-Amz-Target": targetDecrypt,
+	}, nil, body)
+	if err := c.sign(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := requests.Send(req)
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt error: %v", err)
+	}
+	var ret decryptResponse
+	if err := json.Unmarshal(resp.Body, &ret); err != nil {
+		return nil, fmt.Errorf("kms decrypt error, status: %d, %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms decrypt error, status: %d, %s: %s", resp.StatusCode, ret.Type, ret.Message)
+	}
+	return ret.Plaintext, nil
+}
+
+// sign add signature version 4 headers to request
+func (c *Client) sign(req *requests.Request) error {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return err
+	}
+
+	now := c.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := amzDate[:8]
+
+	req.Header["X-Amz-Date"] = amzDate
+	if c.sessionToken != "" {
+		req.Header["X-Amz-Security-Token"] = c.sessionToken
+	}
+
+	headers := map[string]string{"host": u.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(req.Body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		u.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, c.region, serviceName, "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(c.secretKey, date, c.region, serviceName), []byte(stringToSign)))
+	req.Header["Authorization"] = fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, c.accessKey, scope, signedHeaders, signature)
+	return nil
+}
+
+func signingKey(secretKey, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secretKey), []byte(date))
+	k = hmacSHA256(k, []byte(region))
+	k = hmacSHA256(k, []byte(service))
+	return hmacSHA256(k, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
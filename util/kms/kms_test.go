@@ -0,0 +1,108 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setEnv(t *testing.T, kv map[string]string) func() {
+	old := make(map[string]string, len(kv))
+	for k, v := range kv {
+		old[k] = os.Getenv(k)
+		require.NoError(t, os.Setenv(k, v))
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// example of aws signature version 4 document
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	require.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
+
+func TestDecrypt(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-west-2/kms/aws4_request, ") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, ") ||
+			r.Header.Get("X-Amz-Target") != targetDecrypt || r.Header.Get("X-Amz-Date") != "20240102T030405Z" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"InvalidSignatureException","message":"bad signature"}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req decryptRequest
+		if err := json.Unmarshal(body, &req); err != nil || string(req.CiphertextBlob) != "encrypted" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"InvalidCiphertextException","message":""}`))
+			return
+		}
+		w.Write([]byte(`{"Plaintext":"cGxhaW4="}`))
+	}))
+	defer s.Close()
+
+	defer setEnv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "token",
+	})()
+
+	c, err := NewClient("us-west-2", s.URL)
+	require.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	plain, err := c.Decrypt([]byte("encrypted"))
+	require.NoError(t, err)
+	require.Equal(t, "plain", string(plain))
+
+	_, err = c.Decrypt([]byte("unknown"))
+	require.Error(t, err)
+}
+
+func TestNewClient(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"AWS_REGION":            "",
+		"AWS_DEFAULT_REGION":    "",
+		"AWS_ACCESS_KEY_ID":     "",
+		"AWS_SECRET_ACCESS_KEY": "",
+	})()
+
+	_, err := NewClient("", "")
+	require.Error(t, err)
+	_, err = NewClient("us-west-2", "")
+	require.Error(t, err)
+
+	os.Setenv("AWS_DEFAULT_REGION", "us-east-1")
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	c, err := NewClient("", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://kms.us-east-1.amazonaws.com/", c.endpoint)
+}
@@ -14,6 +14,8 @@
 
 package util
 
+import "time"
+
 // RequestContext means request scope context with values
 // 旧版 thread safe，因为 context 是顺序执行的，把锁去掉，提升性能，新版本 thread unsafe
 type RequestContext struct {
@@ -23,6 +25,24 @@ type RequestContext struct {
 	fingerprint    string
 	fingerprintMD5 string
 	defaultSlice   string
+	rowsSent       int
+	rowsAffected   uint64
+	partialResult  bool
+	warnings       int
+	tables         []string  // logical tables used in sql as db.table
+	mirror         bool      // duplicate sql to mirror slice
+	maxExecuteTime int       // execute time limit of statement in milliseconds, 0 means no limit
+	deadline       time.Time // deadline of backend executions of statement, zero means no limit
+	executeLimited bool      // maxExecuteTime and deadline are set for current statement
+	backend        backendExecution
+}
+
+// backendExecution slice, address, physical db and sql of a backend execution of statement
+type backendExecution struct {
+	slice string
+	addr  string
+	db    string
+	sql   string
 }
 
 // NewRequestContext return request scopre context
@@ -46,6 +66,14 @@ func (reqCtx *RequestContext) SetTokens(value []string) {
 	reqCtx.tokens = value
 }
 
+func (reqCtx *RequestContext) GetTables() []string {
+	return reqCtx.tables
+}
+
+func (reqCtx *RequestContext) SetTables(value []string) {
+	reqCtx.tables = value
+}
+
 func (reqCtx *RequestContext) GetFromSlave() int {
 	return reqCtx.fromSlave
 }
@@ -77,3 +105,76 @@ func (reqCtx *RequestContext) GetDefaultSlice() string {
 func (reqCtx *RequestContext) SetDefaultSlice(value string) {
 	reqCtx.defaultSlice = value
 }
+
+func (reqCtx *RequestContext) GetRowsSent() int {
+	return reqCtx.rowsSent
+}
+
+func (reqCtx *RequestContext) GetRowsAffected() uint64 {
+	return reqCtx.rowsAffected
+}
+
+// SetResultRows record rows of result returned to client
+func (reqCtx *RequestContext) SetResultRows(rowsSent int, rowsAffected uint64) {
+	reqCtx.rowsSent = rowsSent
+	reqCtx.rowsAffected = rowsAffected
+}
+
+// IsPartialResult return true if scatter query can return results of succeeded slices when some slices fail
+func (reqCtx *RequestContext) IsPartialResult() bool {
+	return reqCtx.partialResult
+}
+
+func (reqCtx *RequestContext) SetPartialResult(value bool) {
+	reqCtx.partialResult = value
+}
+
+// AddWarnings add warnings which are returned to client with result, such as skipped slices of partial result query
+func (reqCtx *RequestContext) AddWarnings(n int) {
+	reqCtx.warnings += n
+}
+
+func (reqCtx *RequestContext) GetWarnings() int {
+	return reqCtx.warnings
+}
+
+// IsMirror return true if sql should be duplicated to mirror slice of namespace
+func (reqCtx *RequestContext) IsMirror() bool {
+	return reqCtx.mirror
+}
+
+func (reqCtx *RequestContext) SetMirror(value bool) {
+	reqCtx.mirror = value
+}
+
+// SetMaxExecuteTime set execute time limit of current statement in milliseconds, its deadline is counted from now
+// and shared by all backend executions of the statement
+func (reqCtx *RequestContext) SetMaxExecuteTime(value int) {
+	reqCtx.maxExecuteTime = value
+	reqCtx.deadline = time.Time{}
+	if value > 0 {
+		reqCtx.deadline = time.Now().Add(time.Duration(value) * time.Millisecond)
+	}
+	reqCtx.executeLimited = true
+}
+
+// GetMaxExecuteTime return execute time limit of current statement, ok is false if it's not set
+func (reqCtx *RequestContext) GetMaxExecuteTime() (value int, ok bool) {
+	return reqCtx.maxExecuteTime, reqCtx.executeLimited
+}
+
+// GetDeadline return deadline of current statement, zero means no limit
+func (reqCtx *RequestContext) GetDeadline() time.Time {
+	return reqCtx.deadline
+}
+
+// SetBackendExecution record a backend execution of statement, the last one is kept
+func (reqCtx *RequestContext) SetBackendExecution(slice, addr, db, sql string) {
+	reqCtx.backend = backendExecution{slice: slice, addr: addr, db: db, sql: sql}
+}
+
+// GetBackendExecution return the last backend execution of statement, sql is empty if it's not recorded
+func (reqCtx *RequestContext) GetBackendExecution() (slice, addr, db, sql string) {
+	b := reqCtx.backend
+	return b.slice, b.addr, b.db, b.sql
+}
@@ -37,9 +37,19 @@ var (
 	ErrTimeout = errors.New("resource pool timed out")
 )
 
+// idleLimitsInterval is the interval to keep idle resources between min idle and max idle
+const idleLimitsInterval = time.Second
+
 // Factory is a function that can be used to create a resource.
 type Factory func() (Resource, error)
 
+// AgedResource is the resource that knows when it's created,
+// it will be closed by pool after max lifetime if it's idle.
+type AgedResource interface {
+	Resource
+	CreateTime() time.Time
+}
+
 // Resource defines the interface that every resource must provide.
 // Thread synchronization between Close() and IsClosed()
 // is the responsibility of the caller.
@@ -56,6 +66,13 @@ type ResourcePool struct {
 	idleTimeout sync2.AtomicDuration
 	idleTimer   *timer.Timer
 	capTimer    *timer.Timer
+	limitTimer  *timer.Timer
+	ageTimer    *timer.Timer
+	maxLifetime sync2.AtomicDuration
+
+	// idle resources limits kept by limitTimer, 0 means no limit
+	minIdle sync2.AtomicInt64
+	maxIdle sync2.AtomicInt64
 
 	// stats
 	available    sync2.AtomicInt64
@@ -64,6 +81,7 @@ type ResourcePool struct {
 	waitCount    sync2.AtomicInt64
 	waitTime     sync2.AtomicDuration
 	idleClosed   sync2.AtomicInt64
+	ageClosed    sync2.AtomicInt64
 	baseCapacity sync2.AtomicInt64
 	maxCapacity  sync2.AtomicInt64
 	lock         *sync.Mutex
@@ -130,6 +148,14 @@ func (rp *ResourcePool) Close() {
 	if rp.capTimer != nil {
 		rp.capTimer.Stop()
 	}
+	rp.lock.Lock()
+	if rp.limitTimer != nil {
+		rp.limitTimer.Stop()
+	}
+	if rp.ageTimer != nil {
+		rp.ageTimer.Stop()
+	}
+	rp.lock.Unlock()
 	_ = rp.ScaleCapacity(0)
 }
 
@@ -168,6 +194,158 @@ func (rp *ResourcePool) closeIdleResources() {
 	}
 }
 
+// SetIdleLimits keeps the number of idle resources between minIdle and maxIdle periodically,
+// 0 means no limit.
+// 定期补充空闲资源到minIdle, 并关闭超过maxIdle的空闲资源
+func (rp *ResourcePool) SetIdleLimits(minIdle, maxIdle int) {
+	rp.minIdle.Set(int64(minIdle))
+	rp.maxIdle.Set(int64(maxIdle))
+
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	if rp.limitTimer != nil || (minIdle <= 0 && maxIdle <= 0) {
+		return
+	}
+	rp.limitTimer = timer.NewTimer(idleLimitsInterval)
+	rp.limitTimer.Start(rp.maintainIdleResources)
+}
+
+// Idle returns the number of created resources that are not in use.
+func (rp *ResourcePool) Idle() int64 {
+	return rp.active.Get() - rp.inUse.Get()
+}
+
+// WarmUp creates resources in the pool until there are size idle resources,
+// return the number of resources created.
+// 预先创建资源, 避免首次使用时创建资源的延迟
+func (rp *ResourcePool) WarmUp(size int) (int, error) {
+	return rp.fillIdleResources(size - int(rp.Idle()))
+}
+
+func (rp *ResourcePool) maintainIdleResources() {
+	idle := rp.Idle()
+	if minIdle := rp.minIdle.Get(); minIdle > 0 && idle < minIdle {
+		_, _ = rp.fillIdleResources(int(minIdle - idle))
+		return
+	}
+	if maxIdle := rp.maxIdle.Get(); maxIdle > 0 && idle > maxIdle {
+		rp.trimIdleResources(maxIdle)
+	}
+}
+
+// fillIdleResources creates at most n resources in empty slots of the pool.
+// Slots are taken and put back one by one through the whole pool, so the order of slots is kept
+// and resources created in the front slots are reused by Get before empty slots
+func (rp *ResourcePool) fillIdleResources(n int) (created int, err error) {
+	available := int(rp.Available())
+	for i := 0; i < available; i++ {
+		var wrapper resourceWrapper
+		var ok bool
+		select {
+		case wrapper, ok = <-rp.resources:
+		default:
+			return created, err
+		}
+		if !ok {
+			return created, ErrClosed
+		}
+
+		if wrapper.resource == nil && created < n && err == nil {
+			var r Resource
+			if r, err = rp.factory(); err == nil {
+				wrapper = resourceWrapper{resource: r, timeUsed: time.Now()}
+				rp.active.Add(1)
+				created++
+			}
+		}
+		rp.resources <- wrapper
+	}
+	return created, err
+}
+
+// trimIdleResources closes idle resources until there are at most maxIdle ones,
+// resources idle for the longest time are in the front, empty slots taken are moved to the back
+func (rp *ResourcePool) trimIdleResources(maxIdle int64) {
+	available := int(rp.Available())
+	for i := 0; i < available && rp.Idle() > maxIdle; i++ {
+		var wrapper resourceWrapper
+		var ok bool
+		select {
+		case wrapper, ok = <-rp.resources:
+		default:
+			return
+		}
+		if !ok {
+			return
+		}
+
+		if wrapper.resource != nil {
+			wrapper.resource.Close()
+			wrapper.resource = nil
+			rp.idleClosed.Add(1)
+			rp.active.Add(-1)
+		}
+		rp.resources <- wrapper
+	}
+}
+
+// SetMaxLifetime closes idle AgedResource created more than maxLifetime ago periodically,
+// 0 means no limit.
+// 定期关闭存活时间超过maxLifetime的空闲资源
+func (rp *ResourcePool) SetMaxLifetime(maxLifetime time.Duration) {
+	rp.maxLifetime.Set(maxLifetime)
+
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	if maxLifetime <= 0 {
+		if rp.ageTimer != nil {
+			rp.ageTimer.Stop()
+			rp.ageTimer = nil
+		}
+		return
+	}
+	if rp.ageTimer != nil {
+		rp.ageTimer.SetInterval(maxLifetime / 10)
+		return
+	}
+	rp.ageTimer = timer.NewTimer(maxLifetime / 10)
+	rp.ageTimer.Start(rp.closeAgedResources)
+}
+
+// MaxLifetime returns the max lifetime of resources.
+func (rp *ResourcePool) MaxLifetime() time.Duration {
+	return rp.maxLifetime.Get()
+}
+
+// closeAgedResources scans the pool for idle resources exceeding max lifetime
+func (rp *ResourcePool) closeAgedResources() {
+	available := int(rp.Available())
+	maxLifetime := rp.MaxLifetime()
+
+	for i := 0; i < available; i++ {
+		var wrapper resourceWrapper
+		var ok bool
+		select {
+		case wrapper, ok = <-rp.resources:
+		default:
+			// stop early if we don't get anything new from the pool
+			return
+		}
+		if !ok {
+			return
+		}
+
+		if r, ok := wrapper.resource.(AgedResource); ok && maxLifetime > 0 && time.Since(r.CreateTime()) > maxLifetime {
+			wrapper.resource.Close()
+			wrapper.resource = nil
+			rp.ageClosed.Add(1)
+			rp.active.Add(-1)
+		}
+
+		rp.resources <- wrapper
+	}
+}
+
 // Get will return the next available resource. If capacity
 // has not been reached, it will create a new one using the factory. Otherwise,
 // it will wait till the next resource becomes available or a timeout.
@@ -436,6 +614,11 @@ func (rp *ResourcePool) IdleTimeout() time.Duration {
 	return rp.idleTimeout.Get()
 }
 
+// AgeClosed returns the count of resources closed due to max lifetime.
+func (rp *ResourcePool) AgeClosed() int64 {
+	return rp.ageClosed.Get()
+}
+
 // IdleClosed returns the count of resources closed due to idle timeout.
 func (rp *ResourcePool) IdleClosed() int64 {
 	return rp.idleClosed.Get()
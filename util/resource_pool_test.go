@@ -708,3 +708,116 @@ func TestScaleOutResource(t *testing.T) {
 	t.Logf("capacity is %d", p.capacity.Get())
 	t.Logf("err timeout count is %d", errTimeoutCount.Get())
 }
+
+func TestWarmUp(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p, _ := NewResourcePool(PoolFactory, 5, 5, time.Second)
+	defer p.Close()
+
+	created, err := p.WarmUp(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created)
+	assert.Equal(t, int64(3), p.Active())
+	assert.Equal(t, int64(3), p.Idle())
+	assert.Equal(t, int64(5), p.Available())
+
+	// warm up resources are reused
+	r, err := p.Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), p.Active())
+	assert.Equal(t, int64(2), p.Idle())
+
+	created, err = p.WarmUp(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	p.Put(r)
+	assert.Equal(t, int64(4), p.Idle())
+
+	// warm up is limited by capacity
+	created, err = p.WarmUp(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, int64(5), count.Get())
+
+	f, _ := NewResourcePool(FailFactory, 5, 5, time.Second)
+	defer f.Close()
+	created, err = f.WarmUp(3)
+	assert.Error(t, err)
+	assert.Equal(t, 0, created)
+	assert.Equal(t, int64(5), f.Available())
+}
+
+func TestIdleLimits(t *testing.T) {
+	lastID.Set(0)
+	count.Set(0)
+	p, _ := NewResourcePool(PoolFactory, 6, 6, 0)
+	defer p.Close()
+
+	p.minIdle.Set(2)
+	p.maintainIdleResources()
+	assert.Equal(t, int64(2), p.Idle())
+
+	_, _ = p.WarmUp(6)
+	assert.Equal(t, int64(6), p.Idle())
+	p.maxIdle.Set(4)
+	p.maintainIdleResources()
+	assert.Equal(t, int64(4), p.Idle())
+	assert.Equal(t, int64(4), count.Get())
+	assert.Equal(t, int64(2), p.IdleClosed())
+	assert.Equal(t, int64(6), p.Available())
+
+	// empty slots of trimmed resources are behind idle ones
+	r, err := p.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), count.Get())
+	p.Put(r)
+
+	// maintained by timer
+	p.SetIdleLimits(5, 5)
+	time.Sleep(idleLimitsInterval + 500*time.Millisecond)
+	assert.Equal(t, int64(5), p.Idle())
+}
+
+type agedResource struct {
+	TestResource
+	createTime time.Time
+}
+
+func (ar *agedResource) CreateTime() time.Time {
+	return ar.createTime
+}
+
+func TestMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	count.Set(0)
+	createTime := time.Now().Add(-time.Hour)
+	factory := func() (Resource, error) {
+		count.Add(1)
+		return &agedResource{createTime: createTime}, nil
+	}
+	p, _ := NewResourcePool(factory, 3, 3, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	assert.NoError(t, err)
+	_, _ = p.WarmUp(2)
+	assert.Equal(t, int64(3), p.Active())
+
+	// resources in use are not closed
+	p.SetMaxLifetime(time.Minute)
+	p.closeAgedResources()
+	assert.Equal(t, int64(1), p.Active())
+	assert.Equal(t, int64(2), p.AgeClosed())
+	p.Put(r)
+
+	createTime = time.Now()
+	_, _ = p.WarmUp(3)
+	p.closeAgedResources()
+	assert.Equal(t, int64(2), p.Active())
+	assert.Equal(t, int64(3), p.AgeClosed())
+
+	p.SetMaxLifetime(0)
+	assert.Nil(t, p.ageTimer)
+}
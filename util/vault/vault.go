@@ -0,0 +1,102 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/util/requests"
+)
+
+const (
+	envVaultAddr  = "VAULT_ADDR"
+	envVaultToken = "VAULT_TOKEN"
+	tokenHeader   = "X-Vault-Token"
+)
+
+// Client read secrets from HashiCorp Vault by http api
+type Client struct {
+	addr  string
+	token string
+}
+
+// NewClient create vault client, VAULT_ADDR and VAULT_TOKEN in environment are used if addr or token is empty
+func NewClient(addr, token string) (*Client, error) {
+	if addr == "" {
+		addr = os.Getenv(envVaultAddr)
+	}
+	if token == "" {
+		token = os.Getenv(envVaultToken)
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault addr is not specified")
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	return &Client{addr: strings.TrimSuffix(addr, "/"), token: token}, nil
+}
+
+type secretResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []string               `json:"errors"`
+}
+
+// Read read secret of path, such as secret/data/gaea for kv v2 or secret/gaea for kv v1
+func (c *Client) Read(path string) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/v1/%s", c.addr, strings.TrimPrefix(path, "/"))
+	req := requests.NewRequest(url, requests.Get, map[string]string{tokenHeader: c.token}, nil, nil)
+	resp, err := requests.Send(req)
+	if err != nil {
+		return nil, fmt.Errorf("read vault secret %s error: %v", path, err)
+	}
+
+	var secret secretResponse
+	if err := json.Unmarshal(resp.Body, &secret); err != nil {
+		return nil, fmt.Errorf("read vault secret %s error, status: %d, %v", path, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("read vault secret %s error, status: %d, errors: %v", path, resp.StatusCode, secret.Errors)
+	}
+
+	// data of kv v2 is wrapped with metadata
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return secret.Data, nil
+}
+
+// ReadField read field of secret as string
+func (c *Client) ReadField(path, field string) (string, error) {
+	data, err := c.Read(path)
+	if err != nil {
+		return "", err
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %s not found in vault secret %s", field, path)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("field %s of vault secret %s is not string", field, path)
+	}
+	return s, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(tokenHeader) != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/gaea":
+			w.Write([]byte(`{"data":{"data":{"k1":"v1","n":1},"metadata":{"version":2}}}`))
+		case "/v1/kv/gaea":
+			w.Write([]byte(`{"data":{"k1":"v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestRead(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	c, err := NewClient(s.URL, "test-token")
+	require.NoError(t, err)
+
+	v, err := c.ReadField("secret/data/gaea", "k1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", v)
+
+	v, err = c.ReadField("/kv/gaea", "k1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", v)
+
+	_, err = c.ReadField("secret/data/gaea", "n")
+	require.Error(t, err)
+	_, err = c.ReadField("secret/data/gaea", "k2")
+	require.Error(t, err)
+	_, err = c.Read("secret/data/unknown")
+	require.Error(t, err)
+
+	c, err = NewClient(s.URL, "wrong")
+	require.NoError(t, err)
+	_, err = c.Read("secret/data/gaea")
+	require.Error(t, err)
+}
+
+func TestNewClient(t *testing.T) {
+	addr, token := os.Getenv(envVaultAddr), os.Getenv(envVaultToken)
+	defer func() {
+		os.Setenv(envVaultAddr, addr)
+		os.Setenv(envVaultToken, token)
+	}()
+
+	os.Setenv(envVaultAddr, "")
+	_, err := NewClient("", "")
+	require.Error(t, err)
+
+	os.Setenv(envVaultAddr, "127.0.0.1:8200/")
+	os.Setenv(envVaultToken, "env-token")
+	c, err := NewClient("", "")
+	require.NoError(t, err)
+	require.Equal(t, "http://127.0.0.1:8200", c.addr)
+	require.Equal(t, "env-token", c.token)
+}